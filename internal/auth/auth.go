@@ -18,6 +18,7 @@ package auth
 
 import (
 	"context"
+	"time"
 
 	internalErrors "github.com/hyperledger/firefly-fabconnect/internal/errors"
 	"github.com/hyperledger/firefly-fabconnect/pkg/plugins"
@@ -29,6 +30,10 @@ const (
 	ContextKeySystemAuth ContextKey = iota
 	ContextKeyAuthContext
 	ContextKeyAccessToken
+	ContextKeyServiceIdentity
+	ContextKeyClientCertSigner
+	ContextKeyConsumerScope
+	ContextKeyTokenExpiry
 )
 
 var securityModule plugins.SecurityModule
@@ -43,6 +48,123 @@ func NewSystemAuthContext() context.Context {
 	return context.WithValue(context.Background(), ContextKeySystemAuth, true)
 }
 
+// NewServiceAuthContext derives a context for a named service identity from the parent,
+// which controls its cancellation. If the security module can resolve service identities,
+// authorization checks on the context are made against the resolved identity. Otherwise
+// it is a system context, with the service identity recorded for audit
+func NewServiceAuthContext(parent context.Context, identity string) (context.Context, error) {
+	systemCtx := context.WithValue(parent, ContextKeySystemAuth, true)
+	if identity == "" {
+		return systemCtx, nil
+	}
+	if resolver, ok := securityModule.(plugins.ServiceIdentityResolver); ok {
+		ctxValue, err := resolver.ResolveServiceIdentity(identity)
+		if err != nil {
+			return nil, internalErrors.Errorf(internalErrors.SecurityModuleServiceIdentity, identity, err)
+		}
+		ctx := context.WithValue(parent, ContextKeyServiceIdentity, identity)
+		return context.WithValue(ctx, ContextKeyAuthContext, ctxValue), nil
+	}
+	return context.WithValue(systemCtx, ContextKeyServiceIdentity, identity), nil
+}
+
+// AssignServiceIdentity authorizes the caller to have a background operation run as a service
+// identity. Without a resolver the identity is only recorded for audit, so there is nothing to
+// authorize beyond the operation itself
+func AssignServiceIdentity(ctx context.Context, identity string) error {
+	resolver, ok := securityModule.(plugins.ServiceIdentityResolver)
+	if ok && identity != "" && !IsSystemContext(ctx) {
+		authCtx := GetAuthContext(ctx)
+		if authCtx == nil {
+			return internalErrors.Errorf(internalErrors.SecurityModuleNoAuthContext)
+		}
+		return resolver.AuthServiceIdentity(authCtx, identity)
+	}
+	return nil
+}
+
+// GetServiceIdentity extracts the service identity a background context was created for
+func GetServiceIdentity(ctx context.Context) string {
+	v, ok := ctx.Value(ContextKeyServiceIdentity).(string)
+	if ok {
+		return v
+	}
+	return ""
+}
+
+// WithClientCertSigner records the signer a client is bound to by its TLS client certificate
+func WithClientCertSigner(ctx context.Context, signer string) context.Context {
+	return context.WithValue(ctx, ContextKeyClientCertSigner, signer)
+}
+
+// GetClientCertSigner extracts the signer the client of a request is bound to by its TLS client
+// certificate, if any
+func GetClientCertSigner(ctx context.Context) string {
+	v, ok := ctx.Value(ContextKeyClientCertSigner).(string)
+	if ok {
+		return v
+	}
+	return ""
+}
+
+// ConsumerScope is what a consumer token grants access to: listening on the websocket topics,
+// and reading the event streams
+type ConsumerScope struct {
+	Subject string
+	Topics  []string
+	Streams []string
+}
+
+// WithConsumerScope records the scope of the consumer token a request was made with. The gateway
+// authorizes the request by the scope, rather than the security module, so it is a system context
+func WithConsumerScope(ctx context.Context, scope *ConsumerScope) context.Context {
+	ctx = context.WithValue(ctx, ContextKeySystemAuth, true)
+	return context.WithValue(ctx, ContextKeyConsumerScope, scope)
+}
+
+// GetConsumerScope extracts the scope of the consumer token a request was made with, if any
+func GetConsumerScope(ctx context.Context) *ConsumerScope {
+	v, ok := ctx.Value(ContextKeyConsumerScope).(*ConsumerScope)
+	if ok {
+		return v
+	}
+	return nil
+}
+
+// AllowsTopic checks the consumer can listen on a websocket topic
+func (s *ConsumerScope) AllowsTopic(topic string) bool {
+	return containsString(s.Topics, topic)
+}
+
+// AllowsStream checks the consumer can read an event stream
+func (s *ConsumerScope) AllowsStream(streamID string) bool {
+	return containsString(s.Streams, streamID)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// WithTokenExpiry records when the access token a request was made with expires
+func WithTokenExpiry(ctx context.Context, expires time.Time) context.Context {
+	return context.WithValue(ctx, ContextKeyTokenExpiry, expires)
+}
+
+// GetTokenExpiry extracts when the access token a request was made with expires. It is the zero
+// time if the token does not expire, or its expiry is not known
+func GetTokenExpiry(ctx context.Context) time.Time {
+	v, ok := ctx.Value(ContextKeyTokenExpiry).(time.Time)
+	if ok {
+		return v
+	}
+	return time.Time{}
+}
+
 // IsSystemContext checks if a context was created as a system context
 func IsSystemContext(ctx context.Context) bool {
 	b, ok := ctx.Value(ContextKeySystemAuth).(bool)
@@ -58,6 +180,9 @@ func WithAuthContext(ctx context.Context, token string) (context.Context, error)
 		}
 		ctx = context.WithValue(ctx, ContextKeyAccessToken, token)
 		ctx = context.WithValue(ctx, ContextKeyAuthContext, ctxValue)
+		if provider, ok := securityModule.(plugins.TokenExpiryProvider); ok {
+			ctx = WithTokenExpiry(ctx, provider.TokenExpiry(ctxValue))
+		}
 		return ctx, nil
 	}
 	return ctx, nil
@@ -136,3 +261,29 @@ func ReadAsyncReplyByUUID(ctx context.Context) error {
 	}
 	return nil
 }
+
+// AuthorizesAdmin returns whether the security module authorizes admin operations, so they can be
+// served on the application listener
+func AuthorizesAdmin() bool {
+	_, ok := securityModule.(plugins.AdminAuthorizer)
+	return ok
+}
+
+// Admin authorizes an admin operation, named by its method and route
+func Admin(ctx context.Context, operation string) error {
+	if GetConsumerScope(ctx) != nil {
+		return internalErrors.Errorf(internalErrors.SecurityModuleAdminConsumerToken)
+	}
+	if securityModule != nil && !IsSystemContext(ctx) {
+		authorizer, ok := securityModule.(plugins.AdminAuthorizer)
+		if !ok {
+			return internalErrors.Errorf(internalErrors.SecurityModuleNoAdminAuth)
+		}
+		authCtx := GetAuthContext(ctx)
+		if authCtx == nil {
+			return internalErrors.Errorf(internalErrors.SecurityModuleNoAuthContext)
+		}
+		return authorizer.AuthAdmin(authCtx, operation)
+	}
+	return nil
+}
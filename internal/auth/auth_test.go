@@ -21,6 +21,7 @@ import (
 	"testing"
 
 	"github.com/hyperledger/firefly-fabconnect/internal/auth/authtest"
+	"github.com/hyperledger/firefly-fabconnect/pkg/plugins"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -48,6 +49,8 @@ func TestAccessToken(t *testing.T) {
 	assert.NoError(err)
 	assert.Equal("verified", GetAuthContext(ctx))
 	assert.Equal("testat", GetAccessToken(ctx))
+	assert.Equal(authtest.TestTokenExpiry, GetTokenExpiry(ctx))
+	assert.True(GetTokenExpiry(context.Background()).IsZero())
 
 	assert.Equal(nil, GetAuthContext(context.Background()))
 	assert.Equal("", GetAccessToken(context.Background()))
@@ -149,3 +152,99 @@ func TestAuthReadAsyncReplyByUUID(t *testing.T) {
 	RegisterSecurityModule(nil)
 
 }
+
+func TestServiceAuthContext(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx, err := NewServiceAuthContext(context.Background(), "")
+	assert.NoError(err)
+	assert.True(IsSystemContext(ctx))
+	assert.Equal("", GetServiceIdentity(ctx))
+
+	// without a resolver, the identity is only recorded
+	ctx, err = NewServiceAuthContext(context.Background(), "anyservice")
+	assert.NoError(err)
+	assert.True(IsSystemContext(ctx))
+	assert.Equal("anyservice", GetServiceIdentity(ctx))
+	assert.NoError(AssignServiceIdentity(context.Background(), "anyservice"))
+
+	RegisterSecurityModule(&authtest.TestSecurityModule{})
+
+	ctx, err = NewServiceAuthContext(context.Background(), "testservice")
+	assert.NoError(err)
+	assert.False(IsSystemContext(ctx))
+	assert.Equal("testservice", GetServiceIdentity(ctx))
+	assert.Equal("verified", GetAuthContext(ctx))
+	assert.NoError(RPCSubscribe(ctx, "testns", nil))
+	assert.EqualError(RPCSubscribe(ctx, "anything", nil), "badness")
+
+	_, err = NewServiceAuthContext(context.Background(), "anyservice")
+	assert.EqualError(err, "Failed to resolve service identity 'anyservice': badness")
+
+	// callers can only assign the service identities they are authorized to
+	assert.EqualError(AssignServiceIdentity(context.Background(), "testservice"), "No auth context")
+	assert.NoError(AssignServiceIdentity(NewSystemAuthContext(), "anyservice"))
+	assert.NoError(AssignServiceIdentity(context.Background(), ""))
+	callerCtx, _ := WithAuthContext(context.Background(), "testat")
+	assert.NoError(AssignServiceIdentity(callerCtx, "testservice"))
+	assert.EqualError(AssignServiceIdentity(callerCtx, "anyservice"), "badness")
+
+	// cancellation of the parent carries through to the service context
+	parent, cancel := context.WithCancel(context.Background())
+	ctx, err = NewServiceAuthContext(parent, "testservice")
+	assert.NoError(err)
+	cancel()
+	assert.Equal(context.Canceled, ctx.Err())
+
+	RegisterSecurityModule(nil)
+}
+
+func TestClientCertSigner(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("", GetClientCertSigner(context.Background()))
+	ctx := WithClientCertSigner(context.Background(), "user1")
+	assert.Equal("user1", GetClientCertSigner(ctx))
+}
+
+func TestConsumerScope(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(GetConsumerScope(context.Background()))
+	scope := &ConsumerScope{Subject: "app1", Topics: []string{"topic1"}, Streams: []string{"es-1"}}
+	ctx := WithConsumerScope(context.Background(), scope)
+	assert.Same(scope, GetConsumerScope(ctx))
+	assert.True(IsSystemContext(ctx))
+
+	assert.True(scope.AllowsTopic("topic1"))
+	assert.False(scope.AllowsTopic("topic2"))
+	assert.True(scope.AllowsStream("es-1"))
+	assert.False(scope.AllowsStream("es-2"))
+}
+
+func TestAuthAdmin(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.False(AuthorizesAdmin())
+	assert.NoError(Admin(context.Background(), "POST /subsystems/:name/stop"))
+
+	RegisterSecurityModule(&authtest.TestSecurityModule{})
+
+	assert.True(AuthorizesAdmin())
+	assert.EqualError(Admin(context.Background(), "POST /subsystems/:name/stop"), "No auth context")
+	assert.NoError(Admin(NewSystemAuthContext(), "POST /subsystems/:name/stop"))
+
+	ctx, _ := WithAuthContext(context.Background(), "testat")
+	assert.NoError(Admin(ctx, "POST /subsystems/:name/stop"))
+	assert.EqualError(Admin(ctx, "POST /consumertokens"), "badness")
+	consumer := WithConsumerScope(context.Background(), &ConsumerScope{Subject: "app1"})
+	assert.EqualError(Admin(consumer, "POST /subsystems/:name/stop"), "Consumer tokens do not grant access to admin operations")
+
+	// a security module without the extension does not authorize admin operations
+	RegisterSecurityModule(struct{ plugins.SecurityModule }{&authtest.TestSecurityModule{}})
+	assert.False(AuthorizesAdmin())
+	assert.EqualError(Admin(ctx, "POST /subsystems/:name/stop"), "The security module does not authorize admin operations")
+
+	RegisterSecurityModule(nil)
+
+}
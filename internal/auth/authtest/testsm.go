@@ -18,8 +18,13 @@ package authtest
 
 import (
 	"fmt"
+	"strings"
+	"time"
 )
 
+// TestTokenExpiry is when the fixed token of the TEST MODULE expires
+var TestTokenExpiry = time.Unix(1900000000, 0)
+
 // TestSecurityModule designed for unit testing - does not implement security
 type TestSecurityModule struct{}
 
@@ -31,6 +36,38 @@ func (sm *TestSecurityModule) VerifyToken(tok string) (interface{}, error) {
 	return nil, fmt.Errorf("badness")
 }
 
+// ResolveServiceIdentity of TEST MODULE accepts a fixed service identity
+func (sm *TestSecurityModule) ResolveServiceIdentity(identity string) (interface{}, error) {
+	if identity == "testservice" {
+		return "verified", nil
+	}
+	return nil, fmt.Errorf("badness")
+}
+
+// AuthServiceIdentity of TEST MODULE lets a verified caller assign the fixed service identity
+func (sm *TestSecurityModule) AuthServiceIdentity(authCtx interface{}, identity string) error {
+	if authCtx == "verified" && identity == "testservice" {
+		return nil
+	}
+	return fmt.Errorf("badness")
+}
+
+// AuthAdmin of TEST MODULE lets a verified caller stop and start the subsystems, and nothing else
+func (sm *TestSecurityModule) AuthAdmin(authCtx interface{}, operation string) error {
+	if authCtx == "verified" && strings.HasPrefix(operation, "POST /subsystems/") {
+		return nil
+	}
+	return fmt.Errorf("badness")
+}
+
+// TokenExpiry of TEST MODULE returns a fixed expiry for the fixed token
+func (sm *TestSecurityModule) TokenExpiry(authCtx interface{}) time.Time {
+	if authCtx == "verified" {
+		return TestTokenExpiry
+	}
+	return time.Time{}
+}
+
 // AuthRPC of TEST MODULE checks if a token matches a fixed string
 func (sm *TestSecurityModule) AuthRPC(authCtx interface{}, method string, _ ...interface{}) error {
 	switch authCtx.(type) {
@@ -38,6 +38,203 @@ type RESTGatewayConf struct {
 	Events          EventstreamConf `mapstructure:"events"`
 	HTTP            HTTPConf        `mapstructure:"http"`
 	RPC             RPCConf         `mapstructure:"rpc"`
+	// Shape receipts and replies the same as firefly-ethconnect, for tooling migrated from it
+	EthconnectCompat bool `mapstructure:"ethconnectCompat"`
+	// Caps the transactions in-flight to each chaincode, when sendConcurrency > 1
+	ChaincodeConcurrency ChaincodeConcurrencyConf `mapstructure:"chaincodeConcurrency"`
+	// Slows submission to chaincodes whose recent transactions fail validation with conflicts
+	AdaptivePacing AdaptivePacingConf `mapstructure:"adaptivePacing"`
+	// Tracks the time from submit to commit of transactions, and alerts when it is too slow
+	CommitSLO CommitSLOConf `mapstructure:"commitSLO"`
+	// Pushes metrics to a StatsD agent or OpenTelemetry collector
+	Metrics MetricsConf `mapstructure:"metrics"`
+	// Exports the transactions, events and data volume of each tenant, for chargeback
+	Usage UsageConf `mapstructure:"usage"`
+	// Admin endpoints of the orderers, whose channel participation API is proxied on the admin listener
+	OrdererAdmin OrdererAdminConf `mapstructure:"ordererAdmin"`
+	// Posts the identities registered, modified, enrolled and revoked through the API to a webhook
+	IdentitySync IdentitySyncConf `mapstructure:"identitySync"`
+	// Caps or reports the transactions submitted by the signers of each organization
+	SubmissionQuotas SubmissionQuotasConf `mapstructure:"submissionQuotas"`
+	// Decodes the results chaincodes return to queries and transactions, by chaincode
+	ResultDecoders []ResultDecoderConf `mapstructure:"resultDecoders"`
+	// Persists the transactions accepted asynchronously without Kafka, until they are processed
+	AsyncQueue AsyncQueueConf `mapstructure:"asyncQueue"`
+	// Scheme of the IDs generated for streams, subscriptions and receipts
+	IDs IDsConf `mapstructure:"ids"`
+	// Further Fabric networks served under /networks/<name>, keyed by name
+	Networks map[string]NetworkConf `mapstructure:"networks"`
+	// Processes the requests a gateway with Kafka configured sends to topicIn, replying to topicOut
+	KafkaBridge KafkaConf `mapstructure:"kafkaBridge"`
+}
+
+// NetworkConf is a Fabric network the gateway serves under /networks/<name>, alongside the one it
+// serves at the root, so a single gateway can bridge several consortia. Each network has its own
+// connection profile, with its CAs and identities, and its own stores, which must not be shared
+// with the root network or the other networks. Everything else is configured by the root
+type NetworkConf struct {
+	RPC        RPCConf             `mapstructure:"rpc"`
+	Receipts   NetworkReceiptsConf `mapstructure:"receipts"`
+	Events     NetworkEventsConf   `mapstructure:"events"`
+	AsyncQueue AsyncQueueConf      `mapstructure:"asyncQueue"`
+}
+
+// NetworkReceiptsConf is the store of the receipts of a network, which are otherwise handled as
+// configured by the root, such as with its routes and the push to FireFly
+type NetworkReceiptsConf struct {
+	MongoDB MongoDBReceiptsConf `mapstructure:"mongodb"`
+	LevelDB LevelDBReceiptsConf `mapstructure:"leveldb"`
+}
+
+// NetworkEventsConf enables the event streams of a network, when the path of its store is set
+type NetworkEventsConf struct {
+	LevelDB LevelDBReceiptsConf `mapstructure:"leveldb"`
+}
+
+// IDsConf is how the IDs of streams, subscriptions and receipts are generated
+type IDsConf struct {
+	// Added to each ID, such as an identifier of the instance in multi-instance deployments
+	Prefix string `mapstructure:"prefix"`
+	// "uuid" for random UUIDs, or "ulid" for IDs that sort by the time they were created (empty=uuid)
+	Format string `mapstructure:"format"`
+}
+
+// AsyncQueueConf is the KV store the transactions accepted asynchronously are queued in, when
+// Kafka is not configured, so they survive a restart of the gateway. Memory only when no path is set
+type AsyncQueueConf struct {
+	LevelDB LevelDBReceiptsConf `mapstructure:"leveldb"`
+}
+
+// ResultDecoderConf is a rule for decoding the results returned by the functions of a chaincode,
+// when they are not JSON. The most specific rule matching the channel, chaincode and function applies
+type ResultDecoderConf struct {
+	// Channel of the chaincode (empty=all channels)
+	Channel   string `mapstructure:"channel"`
+	Chaincode string `mapstructure:"chaincode"`
+	// Function returning the result (empty=all functions)
+	Function string `mapstructure:"function"`
+	// "json", "string", "hex" or "base64" to return binary results encoded, "hex-json" or "base64-json"
+	// for JSON the chaincode returns encoded, or "protobuf" to decode a protobuf message into JSON
+	Format string `mapstructure:"format"`
+	// FileDescriptorSet with the protobuf message, as produced by protoc --descriptor_set_out
+	ProtoDescriptorSet string `mapstructure:"protoDescriptorSet"`
+	// Fully qualified name of the protobuf message, such as "example.Asset"
+	ProtoMessage string `mapstructure:"protoMessage"`
+}
+
+// SubmissionQuotasConf configures the quotas of transactions each organization of a consortium
+// may submit, by the MSP of the signer, such as agreed in the governance of the consortium
+type SubmissionQuotasConf struct {
+	// "enforce" rejects submissions over quota, "report" only tracks them and warns (empty=disabled)
+	Mode string `mapstructure:"mode"`
+	// Quota of every organization without its own
+	Default SubmissionQuotaConf `mapstructure:"default"`
+	// Quotas of individual organizations, keyed by MSP ID
+	Orgs map[string]SubmissionQuotaConf `mapstructure:"orgs"`
+}
+
+// SubmissionQuotaConf is the quota of an organization, in UTC hours and days
+type SubmissionQuotaConf struct {
+	// Transactions per hour (0=unlimited)
+	PerHour int `mapstructure:"perHour"`
+	// Transactions per day (0=unlimited)
+	PerDay int `mapstructure:"perDay"`
+}
+
+// IdentitySyncConf configures the webhook that external IAM systems are notified on, to keep in
+// sync with the identities in the Fabric CA registry
+type IdentitySyncConf struct {
+	// The http or https URL each change is posted to (empty=disabled)
+	URL string `mapstructure:"url"`
+	// Set on every request, such as an Authorization header for the IAM system
+	Headers map[string]string `mapstructure:"headers"`
+	// Timeout of each request (default 30s)
+	RequestTimeoutSec int `mapstructure:"requestTimeout"`
+	// Attempts to deliver each change before it is dropped (default 5)
+	Retries int `mapstructure:"retries"`
+}
+
+// OrdererAdminConf configures the admin endpoints of the orderers (osnadmin), keyed by the
+// name used for the orderer in the REST API paths
+type OrdererAdminConf struct {
+	Orderers map[string]OrdererAdminEndpointConf `mapstructure:"orderers"`
+}
+
+// OrdererAdminEndpointConf is the admin endpoint of an orderer, such as https://orderer0:9443,
+// and the TLS client credentials of an orderer admin to call it with
+type OrdererAdminEndpointConf struct {
+	URL string    `mapstructure:"url"`
+	TLS TLSConfig `mapstructure:"tls"`
+}
+
+// ChaincodeConcurrencyConf caps the transactions in-flight to each chaincode on a channel,
+// queuing the excess, to avoid storms of MVCC conflicts on hot keys
+type ChaincodeConcurrencyConf struct {
+	// Limit for every chaincode (0=unlimited)
+	Default int `mapstructure:"default"`
+	// Limits for individual chaincodes, keyed by "channel/chaincode"
+	Limits map[string]int `mapstructure:"limits"`
+}
+
+// AdaptivePacingConf configures the feedback loop that spaces out submissions to a chaincode,
+// while too many of its recent transactions are invalidated by MVCC read conflicts, phantom
+// reads or endorsement policy failures
+type AdaptivePacingConf struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Number of receipts observed between each adjustment of the pacing
+	Window int `mapstructure:"window"`
+	// Ratio of failed receipts in a window, above which submission is slowed
+	FailureThreshold float64 `mapstructure:"failureThreshold"`
+	// Interval between submissions when pacing starts, doubled on each window over the threshold
+	InitialDelayMS int `mapstructure:"initialDelay"`
+	MaxDelayMS     int `mapstructure:"maxDelay"`
+}
+
+// CommitSLOConf configures the service level objective for the time from submitting
+// a transaction to it being committed in a block
+type CommitSLOConf struct {
+	// Number of recent transactions the percentiles are calculated over
+	Window int `mapstructure:"window"`
+	// p95 commit latency, above which the objective is breached (0=no objective)
+	P95ThresholdMS int `mapstructure:"p95Threshold"`
+	// Optional URL, that is POSTed a notification when the objective is breached and recovered
+	WebhookURL string `mapstructure:"webhookURL"`
+}
+
+// MetricsConf configures pushing the metrics of the connector to a StatsD agent,
+// and/or an OpenTelemetry collector over OTLP/HTTP
+type MetricsConf struct {
+	// Interval between pushes (default 10s)
+	IntervalSec int `mapstructure:"interval"`
+	// Prefix of the metric names (default "fabconnect")
+	Prefix string     `mapstructure:"prefix"`
+	StatsD StatsDConf `mapstructure:"statsd"`
+	OTLP   OTLPConf   `mapstructure:"otlp"`
+}
+
+// StatsDConf configures the StatsD exporter
+type StatsDConf struct {
+	// host:port of the agent, that metrics are sent to over UDP. Tags use the DogStatsD format
+	Address string `mapstructure:"address"`
+}
+
+// OTLPConf configures the OpenTelemetry exporter
+type OTLPConf struct {
+	// URL metrics are POSTed to as OTLP/JSON, such as http://collector:4318/v1/metrics
+	Endpoint string `mapstructure:"endpoint"`
+	// Additional headers, such as for authentication to the collector
+	Headers map[string]string `mapstructure:"headers"`
+}
+
+// UsageConf configures the periodic export of the usage of each tenant, which is
+// identified by the signer of its transactions and subscriptions
+type UsageConf struct {
+	// Directory a file is written to for each interval (empty=no export)
+	ExportPath string `mapstructure:"exportPath"`
+	// "json" (default) or "csv"
+	ExportFormat string `mapstructure:"exportFormat"`
+	// Interval covered by each file (default 1h)
+	ExportIntervalSec int `mapstructure:"exportInterval"`
 }
 
 // KafkaConf - Common configuration for Kafka
@@ -66,6 +263,67 @@ type ReceiptsDBConf struct {
 	RetryTimeoutMS      int                 `mapstructure:"retryTimeout"`
 	MongoDB             MongoDBReceiptsConf `mapstructure:"mongodb"`
 	LevelDB             LevelDBReceiptsConf `mapstructure:"leveldb"`
+	// Queues receipts, and writes them to the store in batches from a background routine
+	WriteBatch ReceiptsWriteBatchConf `mapstructure:"writeBatch"`
+	// Sends the receipts whose headers match a route to its destination, instead of to the websocket replies
+	Routes []ReceiptRouteConf `mapstructure:"routes"`
+	// Pushes the receipts of the transactions FireFly submits to the operations API of FireFly core
+	FireFly FireFlyReceiptsConf `mapstructure:"firefly"`
+	// Stores the request of each transaction in its receipt
+	RequestEcho ReceiptsRequestEchoConf `mapstructure:"requestEcho"`
+}
+
+// ReceiptsRequestEchoConf configures the copy of the original request that is stored in the
+// "request" field of receipts, so failed submissions can be reproduced from the receipt store.
+// Requests can opt in or out with the fly-echoRequest param
+type ReceiptsRequestEchoConf struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Dot-separated paths of the fields whose values are replaced with "***", such as
+	// transientMap, args.1 or headers.ctx.token. A "*" matches every field or arg at its
+	// level. Defaults to transientMap
+	Redact []string `mapstructure:"redact"`
+}
+
+// FireFlyReceiptsConf configures the push of receipts to FireFly core, which updates the operation
+// each transaction was submitted for. FireFly submits transactions with IDs of the form
+// <namespace>:<operation ID>, and only the receipts of those are pushed
+type FireFlyReceiptsConf struct {
+	// Base URL of the SPI of FireFly core, such as http://firefly:5101 (empty=disabled)
+	URL     string            `mapstructure:"url"`
+	Headers map[string]string `mapstructure:"headers"`
+	TLS     TLSConfig         `mapstructure:"tls"`
+	// Timeout of each request (default 30s)
+	TimeoutMS int `mapstructure:"timeout"`
+	// Failed pushes are retried with an exponential backoff from the initial delay up to the max
+	// delay (defaults 250ms and 30s), until the retry timeout (default 10m)
+	RetryInitialDelayMS int `mapstructure:"retryInitialDelay"`
+	RetryMaxDelayMS     int `mapstructure:"retryMaxDelay"`
+	RetryTimeoutMS      int `mapstructure:"retryTimeout"`
+}
+
+// ReceiptsWriteBatchConf configures the group commit of receipts, so that bursts of receipts
+// do not hold up the processing of transactions while each is written to the store
+type ReceiptsWriteBatchConf struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Maximum receipts in a single write (default 100)
+	MaxSize int `mapstructure:"maxSize"`
+	// Maximum time a receipt waits for others to join its write (default 50ms)
+	FlushIntervalMS int `mapstructure:"flushInterval"`
+	// Receipts queued for writing, beyond which the processing of replies waits (default 10000)
+	QueueDepth int `mapstructure:"queueDepth"`
+}
+
+// ReceiptRouteConf routes the receipts whose headers all match to a Kafka topic, a webhook or a
+// websocket topic. The first matching route is used
+type ReceiptRouteConf struct {
+	// Regular expressions keyed by the name of a header, such as type, channel, chaincode,
+	// signer, or ctx.<key> for a value of the context of the request
+	Match map[string]string `mapstructure:"match"`
+	// One of kafka, webhook or websocket. Kafka destinations use the brokers of the gateway
+	Type string `mapstructure:"type"`
+	// Go template of the topic or URL, executed with the headers. For example 'receipts-{{.ctx.app}}'
+	Destination string `mapstructure:"destination"`
+	TimeoutMS   int    `mapstructure:"timeout"`
 }
 
 // MongoDBReceiptStoreConf is the configuration for a MongoDB receipt store
@@ -84,6 +342,42 @@ type EventstreamConf struct {
 	PollingIntervalSec      int                 `mapstructure:"pollingInterval"`
 	WebhooksAllowPrivateIPs bool                `json:"webhooksAllowPrivateIPs,omitempty"`
 	LevelDB                 LevelDBReceiptsConf `mapstructure:"leveldb"`
+	// channels known to the gateway, used to expand glob patterns in subscription groups
+	Channels []string `mapstructure:"channels"`
+	// max batches delivered at once across all streams, allocated by stream priority. 0 is unlimited
+	MaxConcurrentBatches int          `mapstructure:"maxConcurrentBatches"`
+	Webhooks             WebhooksConf `mapstructure:"webhooks"`
+	// reject changes to streams and subscriptions that do not have an If-Match header with their ETag
+	RequireIfMatch bool `mapstructure:"requireIfMatch"`
+	// Confluent-compatible schema registry that event schemas are pushed to, when a URL is set
+	SchemaRegistry SchemaRegistryConf `mapstructure:"schemaRegistry"`
+	// goroutines the subscriptions of each stream are sharded across for polling, each with its own checkpoint
+	PollerWorkers int `mapstructure:"pollerWorkers"`
+	// what subscriptions do when the chain is lower than their checkpoint, such as after the channel is
+	// recreated: fail (the default), resetToNewest or resetToZero
+	HeightRegression string `mapstructure:"heightRegression"`
+}
+
+// SchemaRegistryConf locates a Confluent-compatible schema registry
+type SchemaRegistryConf struct {
+	URL      string `mapstructure:"url"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
+// WebhooksConf tunes the HTTP transport shared by all webhook event streams
+type WebhooksConf struct {
+	MaxIdleConns        int    `mapstructure:"maxIdleConns"`
+	MaxIdleConnsPerHost int    `mapstructure:"maxIdleConnsPerHost"`
+	MaxConnsPerHost     int    `mapstructure:"maxConnsPerHost"`
+	IdleConnTimeoutSec  int    `mapstructure:"idleConnTimeoutSec"`
+	DNSCacheTTLSec      int    `mapstructure:"dnsCacheTTLSec"`
+	ProxyURL            string `mapstructure:"proxyURL"`
+	DisableHTTP2        bool   `mapstructure:"disableHTTP2"`
+	// Host names webhooks can be sent to, or "*." followed by a domain for any host in it. Empty allows any host
+	AllowedHosts []string `mapstructure:"allowedHosts"`
+	// responses kept for each webhook stream, to list from /eventstreams/:streamId/deliveries. Defaults to 20
+	DeliveryHistory int `mapstructure:"deliveryHistory"`
 }
 
 type RPCConf struct {
@@ -94,12 +388,97 @@ type RPCConf struct {
 	// only applicable to Fabric node 2.4 or later
 	UseGatewayServer bool   `mapstructure:"useGatewayServer"`
 	ConfigPath       string `mapstructure:"configPath"`
+	// memory budget for blocks cached across all channels, 0 disables the cache
+	BlockCacheSizeMB int `mapstructure:"blockCacheSizeMB"`
+	// proxy URL for each CA, keyed by the CA name in the connection profile.
+	// CAs not listed here use the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables
+	CAProxies map[string]string `mapstructure:"caProxies"`
+	// interval to re-resolve the peer and orderer endpoints at, re-initializing the SDK
+	// when any of them changed. 0 disables it
+	EndpointRefreshIntervalSec int `mapstructure:"endpointRefreshInterval"`
+	// SRV records to resolve peers and orderers from, keyed by their name in the connection profile
+	SRVRecords map[string]string `mapstructure:"srvRecords"`
+	// interval to read the channel config blocks at, to follow changes to the orderers. 0 disables it
+	ChannelConfigRefreshIntervalSec int `mapstructure:"channelConfigRefreshInterval"`
+	// treat every channel as ordered by SmartBFT (Fabric 3.x). Channels are also detected as
+	// SmartBFT from their config blocks, when channelConfigRefreshInterval is set
+	SmartBFT bool `mapstructure:"smartBFT"`
+	// how long to retry the broadcast of a transaction that the orderers of a SmartBFT channel
+	// reject while they change leader. 0 disables the retries
+	BroadcastRetryTimeoutSec int `mapstructure:"broadcastRetryTimeout"`
+	// how the delay between the retries of a broadcast grows: "exponential" (default), "linear" or "fixed",
+	// randomized by up to the jitter fraction of it
+	BroadcastRetryStrategy string  `mapstructure:"broadcastRetryStrategy"`
+	BroadcastRetryJitter   float64 `mapstructure:"broadcastRetryJitter"`
 }
 
 type HTTPConf struct {
 	LocalAddr string    `mapstructure:"localAddr"`
 	Port      int       `mapstructure:"port"`
 	TLS       TLSConfig `mapstructure:"tls"`
+	// The admin UI is served under /ui unless disabled
+	DisableUI bool `mapstructure:"disableUI"`
+	// Headers of transaction requests forwarded to the chaincode
+	HeaderPassthrough HeaderPassthroughConf `mapstructure:"headerPassthrough"`
+	// Timeouts that protect the server from slow clients (0=default)
+	ReadHeaderTimeoutSec int `mapstructure:"readHeaderTimeout"`
+	ReadTimeoutSec       int `mapstructure:"readTimeout"`
+	WriteTimeoutSec      int `mapstructure:"writeTimeout"`
+	IdleTimeoutSec       int `mapstructure:"idleTimeout"`
+	// Write timeouts of routes, keyed by path prefix, that override writeTimeout (0=none)
+	RouteWriteTimeouts map[string]int `mapstructure:"routeWriteTimeouts"`
+	// Maximum connections open at a time, beyond which new connections wait to be accepted (0=unlimited)
+	MaxConnections int `mapstructure:"maxConnections"`
+	// Separate listener for the operational endpoints
+	Admin AdminHTTPConf `mapstructure:"admin"`
+	// Path of a Unix domain socket the APIs are also served on, without TLS. Set port to 0 to serve only on the socket
+	UnixSocket string `mapstructure:"unixSocket"`
+	// Signers that clients authenticated by a TLS client certificate are bound to, when tls.clientAuth is set
+	ClientCertSigners []ClientCertSignerConf `mapstructure:"clientCertSigners"`
+	// Issues tokens to event consumers from the admin API, scoped to websocket topics and event streams
+	ConsumerTokens ConsumerTokensConf `mapstructure:"consumerTokens"`
+}
+
+// ConsumerTokensConf enables the admin API that issues signed, expiring tokens to event consumers.
+// A token only grants access to the websocket topics and event streams it is scoped to, so
+// consumers can be credentialed apart from the clients of the full API
+type ConsumerTokensConf struct {
+	// File containing the HMAC key the tokens are signed with (HS256). The API is enabled when set
+	SigningKeyFile string `mapstructure:"signingKeyFile"`
+	// Set as the issuer of the tokens, defaults to "fabconnect"
+	Issuer string `mapstructure:"issuer"`
+	// Lifetime of a token when the request does not set one (0=1 hour)
+	DefaultTTLSec int `mapstructure:"defaultTTL"`
+	// Longest lifetime a token can be issued with (0=24 hours)
+	MaxTTLSec int `mapstructure:"maxTTL"`
+}
+
+// ClientCertSignerConf binds the clients whose certificate matches the subject and/or SAN to a
+// signer, which they use for all requests instead of specifying one
+type ClientCertSignerConf struct {
+	// Matched against the common name, or the whole distinguished name, of the certificate subject
+	Subject string `mapstructure:"subject"`
+	// Matched against the DNS, email, URI and IP subject alternative names of the certificate
+	SAN    string `mapstructure:"san"`
+	Signer string `mapstructure:"signer"`
+}
+
+// AdminHTTPConf configures a listener for the operational endpoints (/status, /pprof), apart from
+// the application APIs, so network policy can isolate operator access from application traffic
+type AdminHTTPConf struct {
+	LocalAddr string `mapstructure:"localAddr"`
+	// The operational endpoints are served on the main listener, unless a port is set
+	Port int       `mapstructure:"port"`
+	TLS  TLSConfig `mapstructure:"tls"`
+}
+
+// HeaderPassthroughConf maps HTTP headers of transaction requests into the chaincode
+// invocation, so caller context set by a proxy reaches the chaincode
+type HeaderPassthroughConf struct {
+	// Header name to transient data key
+	Transient map[string]string `mapstructure:"transient"`
+	// Header name to property of a JSON object, passed to the chaincode as the last arg
+	Args map[string]string `mapstructure:"args"`
 }
 
 // TLSConfig is the common TLS config
@@ -109,6 +488,8 @@ type TLSConfig struct {
 	CACertsFile        string `mapstructure:"caCertsFile"`
 	Enabled            bool   `mapstructure:"enabled"`
 	InsecureSkipVerify bool   `mapstructure:"insecureSkipVerify"`
+	// Servers only: require a client certificate issued by one of the CAs in caCertsFile (mutual TLS)
+	ClientAuth bool `mapstructure:"clientAuth"`
 }
 
 // CobraInitRPC sets the standard command-line parameters for RPC
@@ -117,10 +498,44 @@ func CobraInit(cmd *cobra.Command, conf *RESTGatewayConf) {
 	_ = viper.BindPFlag("maxinflight", cmd.Flags().Lookup("maxinflight"))
 	cmd.Flags().IntVarP(&conf.MaxTXWaitTime, "tx-timeout", "t", 0, "Maximum wait time for an individual transaction (seconds)")
 	_ = viper.BindPFlag("maxTXWaitTime", cmd.Flags().Lookup("tx-timeout"))
+	cmd.Flags().IntVarP(&conf.ChaincodeConcurrency.Default, "chaincode-concurrency", "", 0, "Maximum transactions in-flight to each chaincode on a channel, when sending concurrently (0=unlimited)")
+	_ = viper.BindPFlag("chaincodeConcurrency.default", cmd.Flags().Lookup("chaincode-concurrency"))
+	cmd.Flags().BoolVarP(&conf.AdaptivePacing.Enabled, "adaptive-pacing", "", false, "Slow submission to chaincodes whose recent transactions fail validation with conflicts")
+	_ = viper.BindPFlag("adaptivePacing.enabled", cmd.Flags().Lookup("adaptive-pacing"))
+	cmd.Flags().IntVarP(&conf.CommitSLO.P95ThresholdMS, "commit-slo-p95", "", 0, "p95 time from submit to commit of transactions, above which the SLO is breached (milliseconds)")
+	_ = viper.BindPFlag("commitSLO.p95Threshold", cmd.Flags().Lookup("commit-slo-p95"))
+	cmd.Flags().StringVarP(&conf.CommitSLO.WebhookURL, "commit-slo-webhook", "", "", "URL notified when the commit latency SLO is breached or recovered")
+	_ = viper.BindPFlag("commitSLO.webhookURL", cmd.Flags().Lookup("commit-slo-webhook"))
+	cmd.Flags().StringVarP(&conf.Metrics.StatsD.Address, "metrics-statsd", "", "", "host:port of a StatsD agent to push metrics to")
+	_ = viper.BindPFlag("metrics.statsd.address", cmd.Flags().Lookup("metrics-statsd"))
+	cmd.Flags().StringVarP(&conf.Metrics.OTLP.Endpoint, "metrics-otlp", "", "", "OTLP/HTTP endpoint of an OpenTelemetry collector to push metrics to")
+	_ = viper.BindPFlag("metrics.otlp.endpoint", cmd.Flags().Lookup("metrics-otlp"))
+	cmd.Flags().IntVarP(&conf.Metrics.IntervalSec, "metrics-interval", "", 0, "Interval between pushes of metrics (seconds)")
+	_ = viper.BindPFlag("metrics.interval", cmd.Flags().Lookup("metrics-interval"))
+	cmd.Flags().StringVarP(&conf.Usage.ExportPath, "usage-export-path", "", "", "Directory the usage of each tenant is periodically exported to")
+	_ = viper.BindPFlag("usage.exportPath", cmd.Flags().Lookup("usage-export-path"))
+	cmd.Flags().StringVarP(&conf.Usage.ExportFormat, "usage-export-format", "", "", "Format of the usage exports: json (default) or csv")
+	_ = viper.BindPFlag("usage.exportFormat", cmd.Flags().Lookup("usage-export-format"))
+	cmd.Flags().BoolVarP(&conf.EthconnectCompat, "ethconnect-compat", "", false, "Shape receipts and replies the same as firefly-ethconnect")
+	_ = viper.BindPFlag("ethconnectCompat", cmd.Flags().Lookup("ethconnect-compat"))
 	cmd.Flags().StringVarP(&conf.HTTP.LocalAddr, "listen-addr", "A", "", "Local address to listen on")
 	_ = viper.BindPFlag("http.localAddr", cmd.Flags().Lookup("listen-addr"))
 	cmd.Flags().IntVarP(&conf.HTTP.Port, "listen-port", "P", 8080, "Port to listen on")
 	_ = viper.BindPFlag("http.port", cmd.Flags().Lookup("listen-port"))
+	cmd.Flags().StringVarP(&conf.HTTP.UnixSocket, "unix-socket", "", "", "Path of a Unix domain socket to also serve the APIs on (with --listen-port 0 to serve only on the socket)")
+	_ = viper.BindPFlag("http.unixSocket", cmd.Flags().Lookup("unix-socket"))
+	cmd.Flags().StringVarP(&conf.HTTP.Admin.LocalAddr, "admin-listen-addr", "", "", "Local address the operational endpoints listen on")
+	_ = viper.BindPFlag("http.admin.localAddr", cmd.Flags().Lookup("admin-listen-addr"))
+	cmd.Flags().IntVarP(&conf.HTTP.Admin.Port, "admin-listen-port", "", 0, "Port the operational endpoints listen on, apart from the application APIs (0=same listener)")
+	_ = viper.BindPFlag("http.admin.port", cmd.Flags().Lookup("admin-listen-port"))
+	cmd.Flags().IntVarP(&conf.HTTP.ReadTimeoutSec, "http-read-timeout", "", 0, "Timeout reading each request, including the body (seconds)")
+	_ = viper.BindPFlag("http.readTimeout", cmd.Flags().Lookup("http-read-timeout"))
+	cmd.Flags().IntVarP(&conf.HTTP.WriteTimeoutSec, "http-write-timeout", "", 0, "Timeout writing each response, extended for routes that wait for transactions (seconds)")
+	_ = viper.BindPFlag("http.writeTimeout", cmd.Flags().Lookup("http-write-timeout"))
+	cmd.Flags().IntVarP(&conf.HTTP.MaxConnections, "http-max-connections", "", 0, "Maximum connections open at a time (0=unlimited)")
+	_ = viper.BindPFlag("http.maxConnections", cmd.Flags().Lookup("http-max-connections"))
+	cmd.Flags().BoolVarP(&conf.HTTP.DisableUI, "disable-ui", "", false, "Do not serve the admin UI under /ui")
+	_ = viper.BindPFlag("http.disableUI", cmd.Flags().Lookup("disable-ui"))
 
 	cmd.Flags().IntVarP(&conf.Receipts.MaxDocs, "receipt-maxdocs", "x", 0, "Receipt store capped size (new collections only)")
 	_ = viper.BindPFlag("receipts.maxDocs", cmd.Flags().Lookup("receipt-maxdocs"))
@@ -134,13 +549,33 @@ func CobraInit(cmd *cobra.Command, conf *RESTGatewayConf) {
 	_ = viper.BindPFlag("receipts.mongodb.collection", cmd.Flags().Lookup("mongodb-receipt-collection"))
 	cmd.Flags().StringVarP(&conf.Receipts.LevelDB.Path, "leveldb-path", "H", "", "Path to LevelDB data directory")
 	_ = viper.BindPFlag("receipts.leveldb.path", cmd.Flags().Lookup("leveldb-path"))
+	cmd.Flags().StringVarP(&conf.AsyncQueue.LevelDB.Path, "async-queue-db", "", "", "Path to the LevelDB data directory to persist the async transaction queue in, when Kafka is not used")
+	_ = viper.BindPFlag("asyncQueue.leveldb.path", cmd.Flags().Lookup("async-queue-db"))
+	cmd.Flags().StringVarP(&conf.IDs.Prefix, "id-prefix", "", "", "Prefix of the IDs generated for streams, subscriptions and receipts, such as an identifier of the instance")
+	_ = viper.BindPFlag("ids.prefix", cmd.Flags().Lookup("id-prefix"))
+	cmd.Flags().StringVarP(&conf.IDs.Format, "id-format", "", "uuid", "Format of the IDs generated for streams, subscriptions and receipts: 'uuid', or 'ulid' to sort them by creation time")
+	_ = viper.BindPFlag("ids.format", cmd.Flags().Lookup("id-format"))
 
 	cmd.Flags().StringVarP(&conf.Events.LevelDB.Path, "events-db", "E", "", "Level DB location for subscription management")
 	_ = viper.BindPFlag("events.leveldb.path", cmd.Flags().Lookup("events-db"))
 	cmd.Flags().IntVarP(&conf.Events.PollingIntervalSec, "events-polling-int", "", 1, "Event polling interval (seconds)")
 	_ = viper.BindPFlag("events.pollingInterval", cmd.Flags().Lookup("events-polling-int"))
+	cmd.Flags().IntVarP(&conf.Events.PollerWorkers, "events-poller-workers", "", 1, "Workers the subscriptions of each event stream are sharded across for polling")
+	_ = viper.BindPFlag("events.pollerWorkers", cmd.Flags().Lookup("events-poller-workers"))
 	cmd.Flags().BoolVarP(&conf.Events.WebhooksAllowPrivateIPs, "events-priv-ips", "", false, "Allow private IPs in Webhooks")
 	_ = viper.BindPFlag("events.webhooksAllowPrivateIPs", cmd.Flags().Lookup("events-priv-ips"))
+	cmd.Flags().StringArrayVarP(&conf.Events.Channels, "events-channels", "", []string{}, "Channels used to expand glob patterns in subscription groups")
+	_ = viper.BindPFlag("events.channels", cmd.Flags().Lookup("events-channels"))
+	cmd.Flags().IntVarP(&conf.Events.MaxConcurrentBatches, "events-max-concurrent-batches", "", 0, "Maximum event batches delivered concurrently across all streams, allocated by stream priority (0=unlimited)")
+	_ = viper.BindPFlag("events.maxConcurrentBatches", cmd.Flags().Lookup("events-max-concurrent-batches"))
+	cmd.Flags().IntVarP(&conf.Events.Webhooks.MaxConnsPerHost, "events-webhooks-max-conns-per-host", "", 0, "Maximum connections to each webhook host (0=unlimited)")
+	_ = viper.BindPFlag("events.webhooks.maxConnsPerHost", cmd.Flags().Lookup("events-webhooks-max-conns-per-host"))
+	cmd.Flags().StringVarP(&conf.Events.Webhooks.ProxyURL, "events-webhooks-proxy", "", "", "Proxy URL for webhook requests (defaults to the HTTP_PROXY/HTTPS_PROXY environment variables)")
+	_ = viper.BindPFlag("events.webhooks.proxyURL", cmd.Flags().Lookup("events-webhooks-proxy"))
+	cmd.Flags().BoolVarP(&conf.Events.RequireIfMatch, "events-require-if-match", "", false, "Require an If-Match header with the ETag on changes to streams and subscriptions")
+	_ = viper.BindPFlag("events.requireIfMatch", cmd.Flags().Lookup("events-require-if-match"))
+	cmd.Flags().StringVarP(&conf.Events.SchemaRegistry.URL, "events-schema-registry-url", "", "", "URL of a Confluent-compatible schema registry to push event schemas to")
+	_ = viper.BindPFlag("events.schemaRegistry.url", cmd.Flags().Lookup("events-schema-registry-url"))
 
 	defBrokerList := strings.Split(os.Getenv("KAFKA_BROKERS"), ",")
 	if len(defBrokerList) == 1 && defBrokerList[0] == "" {
@@ -179,4 +614,18 @@ func CobraInit(cmd *cobra.Command, conf *RESTGatewayConf) {
 	_ = viper.BindPFlag("rpc.useGatewayClient", cmd.Flags().Lookup("gateway-client"))
 	cmd.Flags().BoolVarP(&conf.RPC.UseGatewayServer, "gateway-server", "", false, "Whether to use the server-side gateway support when sending transactions (Fabric 2.4 or later only)")
 	_ = viper.BindPFlag("rpc.useGatewayServer", cmd.Flags().Lookup("gateway-server"))
+	cmd.Flags().IntVarP(&conf.RPC.BlockCacheSizeMB, "rpc-block-cache-mb", "", 64, "Memory budget in MB for blocks cached across all channels (0=disabled)")
+	_ = viper.BindPFlag("rpc.blockCacheSizeMB", cmd.Flags().Lookup("rpc-block-cache-mb"))
+	cmd.Flags().IntVarP(&conf.RPC.EndpointRefreshIntervalSec, "rpc-endpoint-refresh-int", "", 0, "Interval to re-resolve peer and orderer endpoints at (seconds, 0=disabled)")
+	_ = viper.BindPFlag("rpc.endpointRefreshInterval", cmd.Flags().Lookup("rpc-endpoint-refresh-int"))
+	cmd.Flags().IntVarP(&conf.RPC.ChannelConfigRefreshIntervalSec, "rpc-chconfig-refresh-int", "", 0, "Interval to read the orderers from the channel config blocks at (seconds, 0=disabled)")
+	_ = viper.BindPFlag("rpc.channelConfigRefreshInterval", cmd.Flags().Lookup("rpc-chconfig-refresh-int"))
+	cmd.Flags().BoolVarP(&conf.RPC.SmartBFT, "rpc-smartbft", "", false, "Whether all channels are ordered by SmartBFT (Fabric 3.x), rather than only those detected from their config blocks")
+	_ = viper.BindPFlag("rpc.smartBFT", cmd.Flags().Lookup("rpc-smartbft"))
+	cmd.Flags().IntVarP(&conf.RPC.BroadcastRetryTimeoutSec, "rpc-broadcast-retry-timeout", "", 30, "How long to retry transactions rejected by SmartBFT orderers during a leader change (seconds, 0=disabled)")
+	_ = viper.BindPFlag("rpc.broadcastRetryTimeout", cmd.Flags().Lookup("rpc-broadcast-retry-timeout"))
+	cmd.Flags().StringVarP(&conf.RPC.BroadcastRetryStrategy, "rpc-broadcast-retry-strategy", "", "exponential", "How the delay between broadcast retries grows: 'exponential', 'linear' or 'fixed'")
+	_ = viper.BindPFlag("rpc.broadcastRetryStrategy", cmd.Flags().Lookup("rpc-broadcast-retry-strategy"))
+	cmd.Flags().Float64VarP(&conf.RPC.BroadcastRetryJitter, "rpc-broadcast-retry-jitter", "", 0, "Fraction of each broadcast retry delay to randomize it by, between 0 and 1")
+	_ = viper.BindPFlag("rpc.broadcastRetryJitter", cmd.Flags().Lookup("rpc-broadcast-retry-jitter"))
 }
@@ -49,13 +49,33 @@ const (
 	// ConfigYAMLPostParseFile failed to process YAML as JSON after parsing
 	ConfigYAMLPostParseFile = "Failed to process YAML config from %s: %s"
 	// ConfigRESTGatewayRequiredHTTPPort for rest server listening port missing
-	ConfigRESTGatewayRequiredHTTPPort = "Must provide REST Gateway http listening port"
+	ConfigRESTGatewayRequiredHTTPPort = "Must provide REST Gateway http listening port or unix socket"
 	// ConfigRESTGatewayRequiredRPCPath for rest server's Fabric client config file missing
 	ConfigRESTGatewayRequiredRPCPath = "Must provide REST Gateway client configuration path"
+	// ConfigRESTGatewayAdminPortConflict the admin listener was configured on the same address as the application APIs
+	ConfigRESTGatewayAdminPortConflict = "The admin listener must use a different port or address to the application APIs"
+	// ConfigRESTGatewayNetworkRequiredRPCPath a network is missing its client configuration file
+	ConfigRESTGatewayNetworkRequiredRPCPath = "Must provide the client configuration path of network '%s'"
+	// ConfigRESTGatewayNetworksKafka networks dispatch async transactions directly, as their replies cannot be told apart on Kafka
+	ConfigRESTGatewayNetworksKafka = "Networks cannot be configured when async transactions are dispatched through Kafka"
+	// ConfigRESTGatewayNetworkSharedStore a store of a network is also used by the root network, or another network
+	ConfigRESTGatewayNetworkSharedStore = "The %s store of network '%s' at '%s' is already used by %s"
+	// ConfigIDFormatInvalid the format of generated IDs is not supported
+	ConfigIDFormatInvalid = "Invalid ID format '%s'. Must be 'uuid' or 'ulid'"
+	// ConfigIDPrefixInvalid the prefix of generated IDs would not be safe in URLs and store keys
+	ConfigIDPrefixInvalid = "Invalid ID prefix '%s'. Must be up to 32 letters, digits, '_', '.' or '-'"
 	// ConfigRESTGatewayRequiredReceiptStore need to enable params for REST Gatewya
 	ConfigRESTGatewayRequiredReceiptStore = "MongoDB URL, Database and Collection name must be specified to enable the receipt store"
 	// ConfigTLSCertOrKey incomplete TLS config
 	ConfigTLSCertOrKey = "Client private key and certificate must both be provided for mutual auth"
+	// ConfigRESTGatewayClientCertSignersNoMTLS client certificate signers are configured without requiring client certificates
+	ConfigRESTGatewayClientCertSignersNoMTLS = "Client certificate signers require mutual TLS to be enabled with http.tls.clientAuth"
+	// ConfigRESTGatewayClientCertSignerInvalid a client certificate signer cannot match any client, or has no signer
+	ConfigRESTGatewayClientCertSignerInvalid = "Client certificate signer %d must have a signer, and a subject or SAN to match"
+	// ConfigRESTGatewayResultDecoderInvalid a result decoder rule cannot be applied to the results of a chaincode
+	ConfigRESTGatewayResultDecoderInvalid = "Invalid result decoder %d for chaincode '%s': %s"
+	// ResultDecodingFailed the result of a chaincode could not be decoded with the format of its rule
+	ResultDecodingFailed = "Failed to decode result as %s: %s"
 
 	// SecurityModulePluginLoad failed to load .so
 	SecurityModulePluginLoad = "Failed to load plugin: %s"
@@ -63,6 +83,12 @@ const (
 	SecurityModulePluginSymbol = "Failed to load 'SecurityModule' symbol from '%s': %s"
 	// SecurityModuleNoAuthContext missing auth context in context object at point security module is invoked
 	SecurityModuleNoAuthContext = "No auth context"
+	// SecurityModuleServiceIdentity the security module rejected a service identity
+	SecurityModuleServiceIdentity = "Failed to resolve service identity '%s': %s"
+	// SecurityModuleNoAdminAuth the security module does not implement the authorization of admin operations
+	SecurityModuleNoAdminAuth = "The security module does not authorize admin operations"
+	// SecurityModuleAdminConsumerToken consumer tokens only grant access to events
+	SecurityModuleAdminConsumerToken = "Consumer tokens do not grant access to admin operations"
 
 	// RequestHandlerInvalidMsgTypeMissing need to specify a msg type in the header
 	RequestHandlerInvalidMsgTypeMissing = "Invalid message - missing 'headers.type' (or not a string)"
@@ -73,6 +99,10 @@ const (
 
 	// RequestHandlerDirectTooManyInflight when we're not using a buffered store (Kafka) we have to reject
 	RequestHandlerDirectTooManyInflight = "Too many in-flight transactions"
+	// RequestHandlerDirectQueueStore the message could not be persisted to the queue of the direct handler
+	RequestHandlerDirectQueueStore = "Failed to persist the message to the async queue: %s"
+	// RequestHandlerDirectQueueLoad the persisted queue of the direct handler could not be loaded
+	RequestHandlerDirectQueueLoad = "Failed to load the async queue: %s"
 	// RequestHandlerDirectBadHeaders problem processing for in-memory operation
 	RequestHandlerDirectBadHeaders = "Failed to process headers in message"
 
@@ -83,6 +113,8 @@ const (
 	TransactionSendReceiptCheckError = "Error obtaining transaction receipt (%d retries): %s"
 	// TransactionSendReceiptCheckTimeout we didn't have a problem asking the node for a receipt, but the transaction wasn't mined at the end of the timeout
 	TransactionSendReceiptCheckTimeout = "Timed out waiting for transaction receipt"
+	// TransactionOutboxUnavailable a transaction was submitted with an outbox, but event streams are not enabled
+	TransactionOutboxUnavailable = "Event streams must be enabled to submit transactions with an outbox"
 
 	// RPCCallReturnedError specified RPC call returned error
 	RPCCallReturnedError = "%s returned: %s"
@@ -91,6 +123,8 @@ const (
 
 	// RESTGatewayMissingFromAddress did not supply a signing address for the transaction
 	RESTGatewayMissingSigner = "Please specify a valid signer ID in the '%[1]s-signer' query string parameter or x-%[2]s-signer HTTP header"
+	// RESTGatewayClientCertSignerMismatch a client bound to a signer by its certificate specified a different signer
+	RESTGatewayClientCertSignerMismatch = "Signer '%s' cannot be used by a client whose certificate is bound to signer '%s'"
 	// RESTGatewaySyncMsgTypeMismatch sync-invoke code paths in REST API Gateway should be maintained such that this cannot happen
 	RESTGatewaySyncMsgTypeMismatch = "Unexpected condition (message types do not match when processing)"
 	// RESTGatewaySyncWrapErrorWithTXDetail wraps a low level error with transaction hash context on sync APIs before returning
@@ -101,6 +135,62 @@ const (
 	RESTGatewayEventStreamInvalid = "Invalid event stream specification: %s"
 	// RESTGatewaySubscriptionInvalid attempt to create an event stream with invalid parameters
 	RESTGatewaySubscriptionInvalid = "Invalid event subscription specification: %s"
+	// RESTGatewayPrivateDataAccessDenied the org of the signer is not a member of the private data collection
+	RESTGatewayPrivateDataAccessDenied = "Signer %s is not permitted to read collection %s: %s"
+	// RESTGatewayPrivateDataNotFound the key is not in the private data collection
+	RESTGatewayPrivateDataNotFound = "Key %s not found in collection %s"
+	// RESTGatewayQueryFormatInvalid the response format requested for a query is not supported
+	RESTGatewayQueryFormatInvalid = "Invalid format '%s'. Must be 'json', 'stream' or 'ndjson'"
+	// RESTGatewayQueryBlockNotCommitted the block a query must see was not committed before the timeout
+	RESTGatewayQueryBlockNotCommitted = "Block %d is not committed on channel %s. The height of the chain is %d"
+	// RESTGatewayChannelConfigInvalid the requested change cannot be applied to the config of the channel
+	RESTGatewayChannelConfigInvalid = "Invalid config update for channel %s: %s"
+	// RESTGatewayChannelConfigUpdateFailed the config update could not be computed or submitted
+	RESTGatewayChannelConfigUpdateFailed = "Failed to update the config of channel %s: %s"
+	// RESTGatewayMetricsInitFailed the configured metrics exporters could not be set up
+	RESTGatewayMetricsInitFailed = "Metrics exporter failed to initialize: %s"
+	// RESTGatewaySubsystemUnknown the subsystem to stop or start is not one the gateway is running
+	RESTGatewaySubsystemUnknown = "Unknown subsystem '%s'"
+	// RESTGatewaySubsystemStopped a request needs a subsystem that has been stopped through the admin API
+	RESTGatewaySubsystemStopped = "The %s subsystem is stopped"
+	// RESTGatewaySubsystemStartFailed a stopped subsystem could not be started again
+	RESTGatewaySubsystemStartFailed = "Failed to start the %s subsystem: %s"
+	// RESTGatewayNetworkUnknown the network in the path of a request is not configured
+	RESTGatewayNetworkUnknown = "Unknown network '%s'"
+	// RESTGatewayNetworkInitFailed a network failed to initialize
+	RESTGatewayNetworkInitFailed = "Network '%s' failed to initialize: %s"
+
+	// MetricsOTLPFailedHTTPStatus the OpenTelemetry collector returned a non-OK response
+	MetricsOTLPFailedHTTPStatus = "OTLP export to %s failed with status=%d"
+
+	// JSONPatchInvalid the JSON Patch or the document it applies to could not be parsed
+	JSONPatchInvalid = "Invalid JSON Patch: %s"
+	// JSONPatchOperationFailed an operation of a JSON Patch could not be applied
+	JSONPatchOperationFailed = "JSON Patch operation %d (%s %s) failed: %s"
+	// JSONPatchUnknownOp the operation is not one of those in RFC 6902
+	JSONPatchUnknownOp = "Unknown operation '%s'"
+	// JSONPatchMissingValue the operation requires a value
+	JSONPatchMissingValue = "Missing value"
+	// JSONPatchTestFailed the value at the path did not equal the tested value
+	JSONPatchTestFailed = "Value does not match"
+	// JSONPatchMoveIntoChild a value cannot be moved into one of its children
+	JSONPatchMoveIntoChild = "Cannot move a value into one of its children"
+	// JSONPatchInvalidPointer the path is not a JSON Pointer
+	JSONPatchInvalidPointer = "Invalid JSON Pointer '%s'"
+	// JSONPatchPathNotFound the path does not exist in the document
+	JSONPatchPathNotFound = "Path '%s' not found"
+
+	// UsageExportInvalidFormat the usage export format is not supported
+	UsageExportInvalidFormat = "Unknown usage export format '%s'. Must be 'json' or 'csv'"
+	// UsageExportInitFailed the usage export directory could not be created
+	UsageExportInitFailed = "Failed to create the usage export directory %s: %s"
+
+	// OrdererAdminInvalidURL the admin endpoint of an orderer is not a valid URL
+	OrdererAdminInvalidURL = "Invalid admin URL '%s' for orderer %s: %s"
+	// OrdererAdminUnknownOrderer no admin endpoint is configured for the orderer in the request
+	OrdererAdminUnknownOrderer = "No admin endpoint configured for orderer '%s'"
+	// OrdererAdminRequestFailed the request to the channel participation API of an orderer failed
+	OrdererAdminRequestFailed = "Channel participation request to orderer %s failed: %s"
 
 	// ConfigKafkaMissingOutputTopic response topic missing
 	ConfigKafkaMissingOutputTopic = "No output topic specified for bridge to send events to"
@@ -120,6 +210,8 @@ const (
 	WebhooksKafkaMsgtoJSON = "Unable to reserialize message payload as JSON: %s"
 	// WebhooksKafkaErr wrapper on detailed error from Kafka itself
 	WebhooksKafkaErr = "Failed to deliver message to Kafka: %s"
+	// KafkaBridgeInvalidMsg a request consumed from Kafka could not be parsed
+	KafkaBridgeInvalidMsg = "Unable to parse the message consumed from Kafka as JSON: %s"
 
 	// HelperPayloadTooLarge input message too large
 	HelperPayloadTooLarge = "Message exceeds maximum allowable size"
@@ -178,20 +270,44 @@ const (
 	EventStreamsWebhookInvalidURL = "Invalid URL in webhook action"
 	// EventStreamsWebhookResumeActive resume when already resumed
 	EventStreamsResumeActive = "Event processor is already active. Suspending:%t"
+	// EventStreamsSuspendUntilInvalid the time to suspend a stream until is not an RFC3339 timestamp
+	EventStreamsSuspendUntilInvalid = "Invalid suspendUntil '%s'. Must be an RFC3339 timestamp"
+	// EventStreamsSuspendUntilPast the time to suspend a stream until has already passed
+	EventStreamsSuspendUntilPast = "Invalid suspendUntil '%s'. Must be in the future"
 	// EventStreamsWebhookProhibitedAddress some IP ranges can be restricted
 	EventStreamsWebhookProhibitedAddress = "Cannot send Webhook POST to address: %s"
+	// EventStreamsWebhookHostNotAllowed the webhook host is not in the allow-list of webhook hosts
+	EventStreamsWebhookHostNotAllowed = "Cannot send Webhook POST to host '%s', which is not in the allowed hosts"
 	// EventStreamsWebhookFailedHTTPStatus server at the other end of a webhook returned a non-OK response
 	EventStreamsWebhookFailedHTTPStatus = "%s: Failed with status=%d"
+	// EventStreamsWebhookInvalidProxy the configured webhook proxy is not a valid URL
+	EventStreamsWebhookInvalidProxy = "Invalid webhook proxy URL '%s': %s"
+	// EventStreamsWebhookNoIPv4Address the webhook host did not resolve to any IPv4 address
+	EventStreamsWebhookNoIPv4Address = "No IPv4 address found for webhook host: %s"
+	// EventStreamsWebhookUnreachable validating a webhook, its host could not be resolved, connected to, or completed a TLS handshake
+	EventStreamsWebhookUnreachable = "Webhook host '%s' is not reachable: %s"
 	// EventStreamsSubscribeBadBlock the starting block for a subscription request is invalid
 	EventStreamsSubscribeBadBlock = "FromBlock cannot be parsed as a BigInt"
+	// EventStreamsSubscribeBadEventFilter the event filter of a subscription is not a regular expression
+	EventStreamsSubscribeBadEventFilter = "Invalid eventFilter '%s'. Must be a regular expression: %s"
 	// EventStreamsSubscribeStoreFailed problem saving a subscription to our DB
 	EventStreamsSubscribeStoreFailed = "Failed to store subscription: %s"
 	// EventStreamsSubscribeStoreFailed problem saving a subscription to our DB
 	EventStreamsSubscribeLookupKeyStoreFailed = "Failed to store subscription lookup key: %s"
 	// EventStreamsSubscribeNoEvent missing event
 	EventStreamsSubscribeNoEvent = "Chaincode event name must be specified"
+	// EventStreamsSubscribeChannelUnavailable validating a subscription, its channel could not be queried with its signer
+	EventStreamsSubscribeChannelUnavailable = "Channel '%s' cannot be queried by signer '%s': %s"
+	// EventStreamsSubscribeNotChannelMember the peer of the organization has not joined the channel of a subscription
+	EventStreamsSubscribeNotChannelMember = "Channel '%s' has not been joined by the peer of the organization of signer '%s'"
+	// EventStreamsSubscribeHeightRegression the chain is lower than the checkpoint of a subscription, and the policy is to fail
+	EventStreamsSubscribeHeightRegression = "The height %d of channel '%s' is lower than the checkpoint %d of the subscription. Reset the subscription, or configure a heightRegression policy to reset it automatically"
+	// EventStreamsHeightRegressionPolicyInvalid the configured height regression policy is unknown
+	EventStreamsHeightRegressionPolicyInvalid = "Invalid heightRegression policy '%s'. Must be one of fail, resetToNewest or resetToZero"
 	// EventStreamsSubscriptionNotFound sub not found
 	EventStreamsSubscriptionNotFound = "Subscription with ID '%s' not found"
+	// EventStreamsListenerStreamMismatch a listener is created under an event stream, with another stream in its body
+	EventStreamsListenerStreamMismatch = "The \"stream\" %s does not match the event stream %s in the path"
 	// EventStreamsCreateStreamStoreFailed problem saving a subscription to our DB
 	EventStreamsCreateStreamStoreFailed = "Failed to store stream: %s"
 	// EventStreamsCreateStreamResourceErr problem creating a resource required by the eventstream
@@ -214,10 +330,216 @@ const (
 	EventStreamsWebSocketErrorFromClient = "Error received from WebSocket client: %s"
 	// EventStreamsCannotUpdateType cannot change tyep
 	EventStreamsCannotUpdateType = "The type of an event stream cannot be changed"
+	// EventStreamsIfMatchRequired changes must be conditional on the ETag of the resource
+	EventStreamsIfMatchRequired = "An If-Match header with the ETag of the resource is required"
+	// EventStreamsIfMatchConflict the resource has changed since the ETag in the If-Match header was read
+	EventStreamsIfMatchConflict = "The resource has been changed. Current ETag is %s, If-Match is %s"
+	// EventStreamsPatchImmutableField a JSON Patch tried to change a field that is fixed when the stream is created
+	EventStreamsPatchImmutableField = "The '%s' of an event stream cannot be changed"
+	// EventStreamsPatchReadsSecret a JSON Patch tried to test, copy or move a value that holds a secret of the stream
+	EventStreamsPatchReadsSecret = "JSON Patch operation %d (%s) cannot read '%s', which holds a secret of the event stream"
+	// WebSocketAuthNotSupported a websocket client tried to re-authenticate without token authentication enabled
+	WebSocketAuthNotSupported = "Re-authentication is not supported on this WebSocket"
+	// WebSocketAuthFailed the token a websocket client re-authenticated with was rejected
+	WebSocketAuthFailed = "Re-authentication failed: %s"
+	// WebSocketAuthIdentityChanged a websocket client re-authenticated as a different consumer
+	WebSocketAuthIdentityChanged = "Re-authentication must be as the consumer the WebSocket connected as"
+	// WebSocketAuthTopicNotAllowed the new token of a websocket client does not cover a topic it is listening on
+	WebSocketAuthTopicNotAllowed = "The new token does not grant access to topic '%s', which the WebSocket is listening on"
+	// WebSocketTokenExpired the token a websocket client authenticated with expired without being refreshed
+	WebSocketTokenExpired = "The token the WebSocket authenticated with has expired"
+	// EventStreamsWebSocketReservedTopic the topic is used for system events
+	EventStreamsWebSocketReservedTopic = "Topic '%s' is reserved for system events"
 	// EventStreamsInvalidDistributionMode unknown distribution mode
 	EventStreamsInvalidDistributionMode = "Invalid distribution mode '%s'. Valid distribution modes are: 'workloadDistribution' and 'broadcast'."
+	// EventStreamsConsumerGroupBroadcast offsets can only be tracked for batches that are acknowledged
+	EventStreamsConsumerGroupBroadcast = "A consumer group cannot be set with the 'broadcast' distribution mode, as batches are not acknowledged"
+	// EventStreamsConsumerOffsetInvalid the body of an offset commit is invalid
+	EventStreamsConsumerOffsetInvalid = "Invalid consumer offset: %s"
+	// EventStreamsConsumerOffsetWrongTopic the subscription of an offset commit does not deliver to the topic
+	EventStreamsConsumerOffsetWrongTopic = "Subscription '%s' does not deliver events to WebSocket topic '%s'"
+	// EventStreamsConsumerOffsetLoadFailed the offsets of a consumer group could not be read before a batch
+	EventStreamsConsumerOffsetLoadFailed = "Failed to load offsets of consumer group '%s': %s"
 	// EventStreamsUpdateAlreadyInProgress update already in progress
 	EventStreamsUpdateAlreadyInProgress = "Update to event stream already in progress"
+	// EventStreamsSubscriptionGroupNotFound group not found
+	EventStreamsSubscriptionGroupNotFound = "Subscription group with ID '%s' not found"
+	// EventStreamsSubscriptionGroupNoChannels a channel pattern in a group did not match any known channel
+	EventStreamsSubscriptionGroupNoChannels = "Channel pattern '%s' does not match any configured channel"
+	// EventStreamsSubscriptionGroupStoreFailed problem saving a subscription group to our DB
+	EventStreamsSubscriptionGroupStoreFailed = "Failed to store subscription group: %s"
+	// EventStreamsSubscriptionsDeleteNoFilter a bulk delete of subscriptions would delete all of them
+	EventStreamsSubscriptionsDeleteNoFilter = "At least one of the 'stream', 'channel' or 'name-prefix' query parameters is required to delete subscriptions"
+	// EventStreamsSubscriptionsDeleteFailed the subscriptions of a bulk delete could not be deleted from our DB
+	EventStreamsSubscriptionsDeleteFailed = "Failed to delete subscriptions: %s"
+	// EventSchemaInvalid the schema in a registration request is not a valid JSON Schema
+	EventSchemaInvalid = "Invalid event schema: %s"
+	// EventSchemaDuplicate a schema is already registered for the chaincode event
+	EventSchemaDuplicate = "A schema is already registered for event '%s' of chaincode '%s', with ID '%s'"
+	// EventSchemaNotFound schema not found
+	EventSchemaNotFound = "Event schema with ID '%s' not found"
+	// EventSchemaStoreFailed problem saving an event schema to our DB
+	EventSchemaStoreFailed = "Failed to store event schema: %s"
+	// EventSchemaRegistryFailed the schema registry did not accept a schema
+	EventSchemaRegistryFailed = "Failed to register schema for subject '%s' with the schema registry: %s"
+	// EventStreamsOutboxTimeout the chaincode event of a transaction was not delivered to the outbox stream in time
+	EventStreamsOutboxTimeout = "Chaincode event of transaction %s was not delivered to event stream %s within %s"
+	// EventStreamsOutboxSkipped the outbox stream skipped the chaincode event of a transaction after failing to deliver it
+	EventStreamsOutboxSkipped = "Chaincode event of transaction %s could not be delivered to event stream %s, and was skipped"
+	// EventStreamsKafkaNoBrokers attempt to create a Kafka event stream without any brokers
+	EventStreamsKafkaNoBrokers = "Must specify kafka.brokers for action type 'kafka'"
+	// EventStreamsKafkaNoTopic attempt to create a Kafka event stream without a topic
+	EventStreamsKafkaNoTopic = "Must specify kafka.topic for action type 'kafka'"
+	// EventStreamsKafkaInvalidPartitionKey unknown partition key selection
+	EventStreamsKafkaInvalidPartitionKey = "Invalid partition key '%s'. Valid partition keys are: 'subscription', 'chaincode' and 'none'"
+	// EventStreamsKafkaConnectFailed the producer of a Kafka event stream could not connect to the brokers
+	EventStreamsKafkaConnectFailed = "%s: Failed to connect to Kafka: %s"
+	// EventStreamsKafkaPublishFailed the brokers did not acknowledge all the messages of a batch
+	EventStreamsKafkaPublishFailed = "%s: Failed to publish to Kafka topic '%s': %s"
+	// EventStreamsTLSCertsLoadFailed the certificates of a stream that connects to a broker with TLS could not be loaded
+	EventStreamsTLSCertsLoadFailed = "Failed to load the TLS certificates of the stream"
+	// EventStreamsMQTTNoBroker attempt to create an MQTT event stream without a broker
+	EventStreamsMQTTNoBroker = "Must specify mqtt.brokerURL for action type 'mqtt'"
+	// EventStreamsMQTTNoTopic attempt to create an MQTT event stream without a topic
+	EventStreamsMQTTNoTopic = "Must specify mqtt.topic for action type 'mqtt'"
+	// EventStreamsMQTTInvalidTopic wildcards can only be used in subscriptions, not to publish
+	EventStreamsMQTTInvalidTopic = "Invalid MQTT topic '%s'. Topics to publish to cannot contain the wildcards '+' or '#'"
+	// EventStreamsMQTTInvalidQoS unknown quality of service
+	EventStreamsMQTTInvalidQoS = "Invalid MQTT QoS %d. Valid QoS levels are: 0, 1 and 2"
+	// EventStreamsMQTTConnectFailed the client of an MQTT event stream could not connect to the broker
+	EventStreamsMQTTConnectFailed = "%s: Failed to connect to MQTT broker: %s"
+	// EventStreamsMQTTPublishFailed the broker did not acknowledge the batch
+	EventStreamsMQTTPublishFailed = "%s: Failed to publish to MQTT topic '%s': %s"
+	// MQTTInvalidBrokerURL the URL of an MQTT broker is not valid
+	MQTTInvalidBrokerURL = "Invalid MQTT broker URL '%s'. The scheme must be one of: tcp, mqtt, ssl, tls or mqtts"
+	// MQTTRequestTimeout the broker did not complete a connection or acknowledge a message in time
+	MQTTRequestTimeout = "MQTT request timed out after %s"
+	// EventStreamsAMQPNoURL attempt to create an AMQP event stream without a broker URL
+	EventStreamsAMQPNoURL = "Must specify amqp.url for action type 'amqp'"
+	// EventStreamsAMQPNoAddress attempt to create an AMQP event stream without a target address
+	EventStreamsAMQPNoAddress = "Must specify amqp.address for action type 'amqp'"
+	// EventStreamsAMQPConnectFailed the sender of an AMQP event stream could not connect to the broker
+	EventStreamsAMQPConnectFailed = "%s: Failed to connect to AMQP broker: %s"
+	// EventStreamsAMQPSendFailed the broker did not accept all the messages of a batch
+	EventStreamsAMQPSendFailed = "%s: Failed to send to AMQP address '%s': %s"
+	// AMQPInvalidURL the URL of an AMQP broker is not valid
+	AMQPInvalidURL = "Invalid AMQP broker URL '%s'. The scheme must be amqp or amqps"
+	// EventStreamsNATSNoURL attempt to create a NATS event stream without a server URL
+	EventStreamsNATSNoURL = "Must specify nats.url for action type 'nats'"
+	// EventStreamsNATSNoSubject attempt to create a NATS event stream without a subject
+	EventStreamsNATSNoSubject = "Must specify nats.subject for action type 'nats'"
+	// EventStreamsNATSInvalidSubject wildcards can only be used in subscriptions, not to publish
+	EventStreamsNATSInvalidSubject = "Invalid NATS subject '%s'. Subjects to publish to cannot contain wildcards, whitespace or empty tokens"
+	// EventStreamsNATSConnectFailed the client of a NATS event stream could not connect to the server
+	EventStreamsNATSConnectFailed = "%s: Failed to connect to NATS server: %s"
+	// EventStreamsNATSPublishFailed JetStream did not acknowledge all the messages of a batch
+	EventStreamsNATSPublishFailed = "%s: Failed to publish to NATS subject '%s': %s"
+	// NATSInvalidURL the URL of a NATS server is not valid
+	NATSInvalidURL = "Invalid NATS server URL '%s'. The scheme must be nats or tls"
+	// NATSRequestTimeout JetStream did not acknowledge all the messages of a batch in time
+	NATSRequestTimeout = "NATS request timed out after %s"
+	// ReceiptRouteInvalidType the type of a receipt route is not a supported destination
+	ReceiptRouteInvalidType = "Invalid type '%s' for receipts.routes[%d]. Must be 'kafka', 'webhook' or 'websocket'"
+	// ReceiptRouteNoDestination a receipt route has no destination
+	ReceiptRouteNoDestination = "Must specify a destination for receipts.routes[%d]"
+	// ReceiptRouteInvalidMatch a header of a receipt route is not a valid regular expression
+	ReceiptRouteInvalidMatch = "Invalid regular expression for header '%s' of receipts.routes[%d]: %s"
+	// ReceiptRouteInvalidDestination the destination of a receipt route is not a valid template
+	ReceiptRouteInvalidDestination = "Invalid destination template for receipts.routes[%d]: %s"
+	// ReceiptRouteNoKafkaBrokers a receipt route sends to Kafka, without brokers configured for the gateway
+	ReceiptRouteNoKafkaBrokers = "receipts.routes[%d] sends to Kafka, but no Kafka brokers are configured"
+	// ReceiptRouteWebhookFailed a webhook a receipt was routed to returned a failure status
+	ReceiptRouteWebhookFailed = "Webhook %s returned status %d"
+	// ReceiptsFireFlyInvalidURL the URL receipts are pushed to FireFly core at is not an http or https URL
+	ReceiptsFireFlyInvalidURL = "Invalid receipts.firefly.url '%s'"
+	// ReceiptsFireFlyPushFailed FireFly core did not accept the update of an operation with its receipt
+	ReceiptsFireFlyPushFailed = "FireFly returned status %d for the update of operation %s"
+	// EventStreamsGRPCNoAddress attempt to create a gRPC event stream without the address of the consumer
+	EventStreamsGRPCNoAddress = "Must specify grpc.address for action type 'grpc'"
+	// EventStreamsGRPCConnectFailed the stream to the consumer of a gRPC event stream could not be opened
+	EventStreamsGRPCConnectFailed = "%s: Failed to open gRPC stream: %s"
+	// EventStreamsGRPCStreamFailed the stream to the consumer of a gRPC event stream ended
+	EventStreamsGRPCStreamFailed = "%s: gRPC stream failed: %s"
+	// EventStreamsGRPCBatchFailed the consumer of a gRPC event stream acknowledged a batch with an error
+	EventStreamsGRPCBatchFailed = "%s: gRPC consumer failed to process batch %d: %s"
+	// EventStreamsGRPCAckTimeout the consumer of a gRPC event stream did not acknowledge a batch in time
+	EventStreamsGRPCAckTimeout = "%s: Timed out waiting for the gRPC consumer to acknowledge batch %d"
+	// EventStreamsInvalidFormat the format of an event stream is not one of those supported
+	EventStreamsInvalidFormat = "Unknown format '%s'. Must be an empty string, 'cloudevents' or 'avro'"
+	// EventStreamsFormatNotSupported the format of an event stream is not supported for its type
+	EventStreamsFormatNotSupported = "Format '%s' is only supported for event streams of type 'webhook' or 'websocket'"
+	// EventStreamsAvroNotKafka the avro format is set for a stream that does not publish to Kafka
+	EventStreamsAvroNotKafka = "Format 'avro' is only supported for event streams of type 'kafka'"
+	// EventStreamsAvroNoRegistry the avro format is set, but there is no schema registry to register the schema with
+	EventStreamsAvroNoRegistry = "Format 'avro' requires a schema registry. Set events.schemaRegistry.url"
+	// EventStreamsAvroEncodeFailed an event could not be serialized with the Avro schema of the events
+	EventStreamsAvroEncodeFailed = "Failed to encode the event in block %d as Avro: %s"
+	// ConfigRESTGatewayConsumerTokensKey the key consumer tokens are signed with could not be read
+	ConfigRESTGatewayConsumerTokensKey = "Failed to read the consumer token signing key: %s"
+	// ConfigRESTGatewayConsumerTokensShortKey the key consumer tokens are signed with is too short to be secure
+	ConfigRESTGatewayConsumerTokensShortKey = "The consumer token signing key must be at least %d bytes"
+	// ConsumerTokensNotEnabled a consumer token was requested without a signing key configured
+	ConsumerTokensNotEnabled = "Consumer tokens are not enabled"
+	// ConsumerTokenRequestInvalid the body of a request for a consumer token could not be parsed
+	ConsumerTokenRequestInvalid = "Invalid consumer token request: %s"
+	// ConsumerTokenNoSubject a consumer token was requested without the consumer it is for
+	ConsumerTokenNoSubject = "Must specify the subject of a consumer token"
+	// ConsumerTokenNoScope a consumer token was requested without any topics or streams to grant access to
+	ConsumerTokenNoScope = "A consumer token must be scoped to at least one websocket topic or event stream"
+	// ConsumerTokenTTLExceeded a consumer token was requested with a lifetime longer than allowed
+	ConsumerTokenTTLExceeded = "ttlSec must not exceed %d"
+	// ConsumerTokenExpired a request was made with a consumer token that has expired
+	ConsumerTokenExpired = "Consumer token has expired"
+	// ConsumerTokenForbidden a request was made with a consumer token to an API it is not scoped to
+	ConsumerTokenForbidden = "Consumer token does not grant access to %s %s"
+	// ConfigRESTGatewayIdentitySyncURL the identity sync webhook is not an http or https URL
+	ConfigRESTGatewayIdentitySyncURL = "Invalid identity sync URL '%s'"
+	// IdentitySyncWebhookFailed the identity sync webhook did not accept an event
+	IdentitySyncWebhookFailed = "Identity sync webhook returned status %d"
+	// TransactionQuotaExceeded the organization of the signer has used its submission quota
+	TransactionQuotaExceeded = "Organization %s has exceeded its quota of %d transactions per %s"
+	// EventStreamsWebhookClientCertIncomplete only one of the client certificate and key of a webhook was set
+	EventStreamsWebhookClientCertIncomplete = "Both tlsClientCert and tlsClientKey must be set for a webhook to present a client certificate"
+	// EventStreamsWebhookInvalidClientCert the client certificate of a webhook could not be loaded
+	EventStreamsWebhookInvalidClientCert = "Invalid webhook client certificate: %s"
+	// EventStreamsWebhookOAuth2NoClientID the OAuth2 configuration of a webhook has no client ID
+	EventStreamsWebhookOAuth2NoClientID = "Must specify webhook.oauth2.clientId for a webhook to obtain OAuth2 tokens"
+	// EventStreamsWebhookOAuth2InvalidTokenURL the OAuth2 token URL of a webhook is not an http or https URL
+	EventStreamsWebhookOAuth2InvalidTokenURL = "Invalid webhook.oauth2.tokenURL, which must be an http or https URL"
+	// EventStreamsWebhookOAuth2TokenFailed the token endpoint of a webhook did not issue a token
+	EventStreamsWebhookOAuth2TokenFailed = "Failed to obtain an OAuth2 token for the webhook from %s: %s"
+	// EventStreamsWebhookInvalidCompression the compression of a webhook is not supported
+	EventStreamsWebhookInvalidCompression = "Invalid webhook.compression '%s'. Must be 'gzip' or empty"
+	// EventStreamsWebhookInvalidRetryPolicy an entry of the retry policy of a webhook is not a status and an action
+	EventStreamsWebhookInvalidRetryPolicy = "Invalid webhook.retryPolicy entry '%s': '%s'. Keys are status codes such as 503, or classes such as 5xx, and values are 'retry' or 'fail'"
+	// EventStreamsWebhookCircuitBreakerNoThreshold a circuit breaker was configured without the failures that open it
+	EventStreamsWebhookCircuitBreakerNoThreshold = "Must specify webhook.circuitBreaker.failureThreshold"
+	// EventStreamsWebhookCircuitBreakerInvalidProbeURL the URL the circuit breaker probes is not an http or https URL
+	EventStreamsWebhookCircuitBreakerInvalidProbeURL = "Invalid webhook.circuitBreaker.probeURL"
+	// EventStreamsWebhookCircuitBreakerInvalidMethod the method of the probes of a circuit breaker is not supported
+	EventStreamsWebhookCircuitBreakerInvalidMethod = "Invalid webhook.circuitBreaker.probeMethod '%s'. Valid methods are: 'HEAD', 'GET' and 'OPTIONS'"
+	// EventStreamsWebhookProbeFailedHTTPStatus a webhook probed while its circuit is open is not healthy
+	EventStreamsWebhookProbeFailedHTTPStatus = "%s: Webhook probe failed with status %d"
+	// EventStreamsDeadLetterInvalidType the dead-letter destination of a stream has an unknown type
+	EventStreamsDeadLetterInvalidType = "Invalid deadLetter.type '%s'. Must be 'webhook', 'kvstore' or 'kafka'"
+	// EventStreamsInvalidDeliverySemantics the delivery semantics of a stream are not known
+	EventStreamsInvalidDeliverySemantics = "Invalid deliverySemantics '%s'. Must be 'at-least-once' or 'at-most-once'"
+	// RetryStrategyInvalid the strategy of the retries of an operation is not known
+	RetryStrategyInvalid = "Invalid retryStrategy '%s'. Must be 'exponential', 'linear' or 'fixed'"
+	// RetryJitterInvalid the jitter of the retries of an operation is not a fraction
+	RetryJitterInvalid = "Invalid retryJitter %v. Must be between 0 and 1"
+	// EventStreamsInvalidRetryBackoffFactor the retries of a stream would come sooner each time
+	EventStreamsInvalidRetryBackoffFactor = "Invalid retryBackoffFactor %v. Must be at least 1"
+	// EventStreamsConcurrencyTooHigh the concurrency of a stream is over the maximum
+	EventStreamsConcurrencyTooHigh = "Invalid concurrency %d. Must not exceed %d"
+	// EventStreamsConcurrencyNotSupported batches can only be delivered concurrently to webhooks
+	EventStreamsConcurrencyNotSupported = "Batches can only be delivered concurrently by webhook streams, not %s streams"
+	// EventStreamsDeliveriesNotWebhook the deliveries of a stream are requested, but only webhook streams record them
+	EventStreamsDeliveriesNotWebhook = "Deliveries are only recorded for webhook streams. Event stream %s is not a webhook stream"
+	// EventStreamsSecretNotWebhook the secret of a stream is rotated, but only webhook streams sign their requests
+	EventStreamsSecretNotWebhook = "Requests are only signed by webhook streams. Event stream %s is not a webhook stream"
+	// EventStreamsDeadLetterNotFound the dead letter does not exist for the stream
+	EventStreamsDeadLetterNotFound = "Dead letter %s not found for event stream %s"
 )
 
 type RestErrMsg struct {
@@ -0,0 +1,60 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"crypto/tls"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/utils"
+)
+
+// actionTLSInfo configures the TLS connection of the actions that connect to a broker
+type actionTLSInfo struct {
+	Enabled            bool   `json:"enabled,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+	CACertsFile        string `json:"caCertsFile,omitempty"`
+	ClientCertsFile    string `json:"clientCertsFile,omitempty"`
+	ClientKeyFile      string `json:"clientKeyFile,omitempty"`
+}
+
+func (t *actionTLSInfo) validate() error {
+	if t != nil && !utils.AllOrNoneReqd(t.ClientCertsFile, t.ClientKeyFile) {
+		return errors.Errorf(errors.ConfigTLSCertOrKey)
+	}
+	return nil
+}
+
+// tlsConfig returns nil when TLS is not enabled. The connection must not fall back to plain
+// text, or to the system CAs, when the certificates cannot be loaded
+func (t *actionTLSInfo) tlsConfig() (*tls.Config, error) {
+	if t == nil || !t.Enabled {
+		return nil, nil
+	}
+	tlsConfig, err := utils.CreateTLSConfiguration(&conf.TLSConfig{
+		Enabled:            true,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+		CACertsFile:        t.CACertsFile,
+		ClientCertsFile:    t.ClientCertsFile,
+		ClientKeyFile:      t.ClientKeyFile,
+	})
+	if err == nil && tlsConfig == nil {
+		err = errors.Errorf(errors.EventStreamsTLSCertsLoadFailed)
+	}
+	return tlsConfig, err
+}
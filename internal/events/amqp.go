@@ -0,0 +1,319 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-amqp"
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultAMQPRequestTimeoutSec = 30
+)
+
+type amqpActionInfo struct {
+	// amqp:// or amqps://, optionally with the credentials as the user info
+	URL string `json:"url,omitempty"`
+	// The queue or topic the events are sent to
+	Address     string `json:"address,omitempty"`
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"password,omitempty"`
+	ContainerID string `json:"containerID,omitempty"`
+	// Time to wait to connect, and for the broker to accept the messages of a batch
+	RequestTimeoutSec uint32         `json:"requestTimeoutSec,omitempty"`
+	TLS               *actionTLSInfo `json:"tls,omitempty"`
+}
+
+// amqpSender is the subset of the AMQP sender used to send batches
+type amqpSender interface {
+	SendBatch(ctx context.Context, msgs []*amqp.Message) error
+	IsConnected() bool
+	Close() error
+}
+
+// amqpConnectOptions are the settings of the connection to the broker, and the address of the
+// link the messages are sent on
+type amqpConnectOptions struct {
+	URL     string
+	Address string
+	Timeout time.Duration
+	Conn    *amqp.ConnOptions
+}
+
+// defined to allow mocking in tests
+var connectAMQP = func(ctx context.Context, opts *amqpConnectOptions) (amqpSender, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	conn, err := amqp.Dial(ctx, opts.URL, opts.Conn)
+	if err != nil {
+		return nil, err
+	}
+	session, err := conn.NewSession(ctx, nil)
+	if err == nil {
+		var sender *amqp.Sender
+		// unsettled, so each message is only settled once the broker has accepted it
+		sender, err = session.NewSender(ctx, opts.Address, &amqp.SenderOptions{
+			SettlementMode: amqp.SenderSettleModeUnsettled.Ptr(),
+		})
+		if err == nil {
+			return &amqpLinkSender{conn: conn, sender: sender, timeout: opts.Timeout}, nil
+		}
+	}
+	_ = conn.Close()
+	return nil, err
+}
+
+// amqpLinkSender sends batches on a link to the address, over its own connection
+type amqpLinkSender struct {
+	conn    *amqp.Conn
+	sender  *amqp.Sender
+	timeout time.Duration
+}
+
+// SendBatch sends the messages in order, each one once the broker has accepted the one before.
+// A message the broker rejects, releases or modifies fails the batch
+func (s *amqpLinkSender) SendBatch(ctx context.Context, msgs []*amqp.Message) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	for _, msg := range msgs {
+		if err := s.sender.Send(ctx, msg, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *amqpLinkSender) IsConnected() bool {
+	select {
+	case <-s.conn.Done():
+		return false
+	default:
+		return true
+	}
+}
+
+func (s *amqpLinkSender) Close() error {
+	return s.conn.Close()
+}
+
+type amqpAction struct {
+	brokerConnection[amqpSender]
+	spec *amqpActionInfo
+}
+
+func validateAMQPConfig(spec *amqpActionInfo) error {
+	if spec == nil || spec.URL == "" {
+		return errors.Errorf(errors.EventStreamsAMQPNoURL)
+	}
+	if err := validateAMQPURL(spec.URL); err != nil {
+		return err
+	}
+	if spec.Address == "" {
+		return errors.Errorf(errors.EventStreamsAMQPNoAddress)
+	}
+	return spec.TLS.validate()
+}
+
+// validateAMQPURL checks the scheme of the URL of the broker. amqps:// connects with TLS. The port
+// is 5672 by default, or 5671 with TLS
+func validateAMQPURL(brokerURL string) error {
+	u, err := url.Parse(brokerURL)
+	if err != nil || u.Host == "" {
+		return errors.Errorf(errors.AMQPInvalidURL, brokerURL)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "amqp", "amqps":
+		return nil
+	default:
+		return errors.Errorf(errors.AMQPInvalidURL, brokerURL)
+	}
+}
+
+func setAMQPDefaults(spec *amqpActionInfo) {
+	if spec.RequestTimeoutSec == 0 {
+		spec.RequestTimeoutSec = DefaultAMQPRequestTimeoutSec
+	}
+}
+
+// redactAMQPConfig returns a copy of the settings with the credentials redacted
+func redactAMQPConfig(spec *amqpActionInfo) *amqpActionInfo {
+	if spec == nil {
+		return nil
+	}
+	redacted := *spec
+	redacted.URL = redactURLCredentials(spec.URL)
+	redacted.Password = redactSecret(spec.Password)
+	return &redacted
+}
+
+// restoreAMQPSecrets sets the redacted credentials of an update back to the existing ones
+func restoreAMQPSecrets(spec, existing *amqpActionInfo) {
+	if spec == nil {
+		return
+	}
+	if existing == nil {
+		existing = &amqpActionInfo{}
+	}
+	restoreURLCredentials(&spec.URL, existing.URL)
+	restoreSecret(&spec.Password, existing.Password)
+}
+
+// mergeAMQPConfig returns the existing settings, overridden by those set in an update
+func mergeAMQPConfig(existing, update *amqpActionInfo) *amqpActionInfo {
+	merged := *existing
+	if update.URL != "" {
+		merged.URL = update.URL
+	}
+	if update.Address != "" {
+		merged.Address = update.Address
+	}
+	if update.Username != "" {
+		merged.Username = update.Username
+	}
+	if update.Password != "" {
+		merged.Password = update.Password
+	}
+	if update.ContainerID != "" {
+		merged.ContainerID = update.ContainerID
+	}
+	if update.RequestTimeoutSec != 0 {
+		merged.RequestTimeoutSec = update.RequestTimeoutSec
+	}
+	if update.TLS != nil {
+		merged.TLS = update.TLS
+	}
+	return &merged
+}
+
+func newAMQPAction(es *eventStream, spec *amqpActionInfo) (*amqpAction, error) {
+	if err := validateAMQPConfig(spec); err != nil {
+		return nil, err
+	}
+	setAMQPDefaults(spec)
+	a := &amqpAction{
+		brokerConnection: brokerConnection[amqpSender]{
+			es:            es,
+			broker:        "AMQP broker",
+			connectFailed: errors.EventStreamsAMQPConnectFailed,
+			lost:          func(c amqpSender) bool { return !c.IsConnected() },
+		},
+		spec: spec,
+	}
+	a.dial = a.connect
+	return a, nil
+}
+
+func (a *amqpAction) connect(ctx context.Context) (amqpSender, error) {
+	tlsConfig, err := a.spec.TLS.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	containerID := a.spec.ContainerID
+	if containerID == "" {
+		containerID = a.es.spec.ID
+	}
+	// the credentials of the settings replace those in the URL, which is connected to without them
+	u, err := url.Parse(a.spec.URL)
+	if err != nil {
+		return nil, errors.Errorf(errors.AMQPInvalidURL, a.spec.URL)
+	}
+	username, password := a.spec.Username, a.spec.Password
+	if username == "" && u.User != nil {
+		username = u.User.Username()
+		password, _ = u.User.Password()
+	}
+	u.User = nil
+	saslType := amqp.SASLTypeAnonymous()
+	if username != "" {
+		saslType = amqp.SASLTypePlain(username, password)
+	}
+	return connectAMQP(ctx, &amqpConnectOptions{
+		URL:     u.String(),
+		Address: a.spec.Address,
+		Timeout: time.Duration(a.spec.RequestTimeoutSec) * time.Second,
+		Conn: &amqp.ConnOptions{
+			ContainerID: containerID,
+			SASLType:    saslType,
+			TLSConfig:   tlsConfig,
+		},
+	})
+}
+
+// messages returns a message for each event, with the same JSON as an event in the body of a
+// webhook. The message IDs are derived from the events, so brokers that detect duplicates can
+// discard the messages of a batch that is retried
+func (a *amqpAction) messages(events []*api.EventEntry) ([]*amqp.Message, error) {
+	msgs := make([]*amqp.Message, 0, len(events))
+	for _, event := range events {
+		b, err := json.Marshal(event)
+		if err != nil {
+			return nil, err
+		}
+		contentType := "application/json"
+		msg := amqp.NewMessage(b)
+		msg.Properties = &amqp.MessageProperties{
+			MessageID:   eventMessageID(event),
+			ContentType: &contentType,
+		}
+		if len(event.Headers) > 0 {
+			msg.ApplicationProperties = make(map[string]interface{}, len(event.Headers))
+			for k, v := range event.Headers {
+				msg.ApplicationProperties[k] = v
+			}
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// eventMessageID identifies the message of an event by the position of the event in the chain,
+// so the message of an event that is delivered again has the same ID
+func eventMessageID(event *api.EventEntry) string {
+	return fmt.Sprintf("%s/%d/%d/%d", event.SubID, event.BlockNumber, event.TransactionIndex, event.EventIndex)
+}
+
+// attemptBatch sends a message for each event in the batch to the address. The batch succeeds
+// when the broker has accepted every message. Otherwise it is retried by the stream with a new
+// connection, and brokers that detect duplicates discard the messages that were accepted before
+func (a *amqpAction) attemptBatch(ctx context.Context, batchNumber, attempt uint64, events []*api.EventEntry) error {
+	esID := a.es.spec.ID
+	msgs, err := a.messages(events)
+	if err != nil {
+		return err
+	}
+	sender, err := a.connection(ctx, attempt, redactURLCredentials(a.spec.URL))
+	if err != nil {
+		return err
+	}
+	log.Infof("%s: AMQP --> %s batch=%d events=%d (attempt=%d)", esID, a.spec.Address, batchNumber, len(events), attempt)
+	if err := sender.SendBatch(ctx, msgs); err != nil {
+		log.Errorf("%s: AMQP send to %s failed (attempt=%d): %s", esID, a.spec.Address, attempt, err)
+		a.close()
+		return errors.Errorf(errors.EventStreamsAMQPSendFailed, esID, a.spec.Address, err)
+	}
+	log.Infof("%s: AMQP <-- %s batch=%d ok", esID, a.spec.Address, batchNumber)
+	return nil
+}
@@ -16,23 +16,84 @@
 
 package api
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
 
 const (
 	BlockTypeTX                     = "tx"              // corresponds to blocks containing regular transactions
 	BlockTypeConfig                 = "config"          // corresponds to blocks containing channel configurations and updates
+	BlockTypeAll                    = "all"             // corresponds to all blocks, for subscriptions to full blocks that mirror the ledger
+	SubscriptionTypeEvents          = "events"          // the subscription delivers the chaincode events in the blocks, one entry per event. The default
+	SubscriptionTypeBlocks          = "blocks"          // the subscription delivers each block, decoded with all its transactions and metadata
+	DeliverFull                     = "full"            // the subscription reads full blocks from the deliver service of the peers. The default
+	DeliverFiltered                 = "filtered"        // the subscription reads filtered blocks, which are much smaller but omit the payloads of the events
 	EventPayloadTypeBytes           = "bytes"           // default data type of the event payload, no special processing is done before returning to the subscribing client
 	EventPayloadTypeString          = "string"          // event payload will be an UTF-8 encoded string
 	EventPayloadTypeJSON            = "json"            // event payload will be a structured map with UTF-8 encoded string values
 	EventPayloadTypeStringifiedJSON = "stringifiedJSON" // equivalent to "json" (deprecated)
+	TransactionStatusValid          = "VALID"           // the validation code of the transactions the peers committed as valid
+)
+
+// ConfigUpdateEventName is the name of the events of config blocks, whose payloads are the changes
+// the blocks made to the config of the channel
+const ConfigUpdateEventName = "fabconnect:configUpdate"
+
+// TxValidity selects the events of a subscription by the validity of their transactions, as
+// true for the valid transactions, false for those the peers invalidated, or "both"
+type TxValidity string
+
+const (
+	TxValidityValid   TxValidity = "true" // the default
+	TxValidityInvalid TxValidity = "false"
+	TxValidityBoth    TxValidity = "both"
 )
 
+// UnmarshalJSON accepts true and false as booleans or strings
+func (v *TxValidity) UnmarshalJSON(b []byte) error {
+	var valid bool
+	if err := json.Unmarshal(b, &valid); err == nil {
+		*v = TxValidity(strconv.FormatBool(valid))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*v = TxValidity(s)
+	return nil
+}
+
+// MarshalJSON writes true and false as booleans
+func (v TxValidity) MarshalJSON() ([]byte, error) {
+	if v == TxValidityValid || v == TxValidityInvalid {
+		return []byte(v), nil
+	}
+	return json.Marshal(string(v))
+}
+
+// Includes returns whether the events of a transaction with the validity are selected
+func (v TxValidity) Includes(valid bool) bool {
+	switch v {
+	case TxValidityBoth:
+		return true
+	case TxValidityInvalid:
+		return !valid
+	default:
+		return valid
+	}
+}
+
 // persistedFilter is the part of the filter we record to storage
 // BlockType:   optional. only notify on blocks of a specific type
 //
 //	types are defined in github.com/hyperledger/fabric-protos-go/common:
 //	"config": for HeaderType_CONFIG, HeaderType_CONFIG_UPDATE
 //	"tx": for HeaderType_ENDORSER_TRANSACTION
+//	"all": for all blocks
 //
 // ChaincodeID: optional, only notify on blocks containing events for chaincode Id
 // Filter:      optional. regexp applied to the event name. can be used independent of Chaincode ID
@@ -56,6 +117,34 @@ type SubscriptionInfo struct {
 	FromBlock   string          `json:"fromBlock,omitempty"`
 	Filter      persistedFilter `json:"filter"`
 	PayloadType string          `json:"payloadType,omitempty"` // optional. data type of the payload bytes; "bytes", "string" or "stringifiedJSON/json". Default to "bytes"
+	Group       string          `json:"group,omitempty"`       // the subscription group this subscription was expanded from, if any
+	Type        string          `json:"type,omitempty"`        // "events" for the chaincode events in the blocks, or "blocks" for the whole blocks. Default to "events"
+	Deliver     string          `json:"deliver,omitempty"`     // "full" or "filtered" deliver service of the peers. Default to "full"
+	// Incremented on every change that is stored, and returned as the ETag of the subscription
+	ResourceVersion uint64 `json:"resourceVersion,omitempty"`
+	// Why the subscription cannot listen for events, while that is the case. Not persisted
+	Errored string `json:"errored,omitempty"`
+	// Set on the one-shot subscriptions of transaction outboxes, which only deliver the event of the transaction
+	TransactionID string `json:"transactionId,omitempty"`
+	// Added to the webhook requests of batches containing events of this subscription, e.g. for routing
+	Headers map[string]string `json:"headers,omitempty"`
+	// Dot-separated path to a field of the payload that increases by one with each event of the same name,
+	// which is checked for gaps
+	SequencePath string `json:"sequencePath,omitempty"`
+	// CEL expression over the fields of the payload, such as `amount > 1000`. Only matching events are delivered
+	PayloadFilter string `json:"payloadFilter,omitempty"`
+	// Whether the events of valid transactions, invalidated transactions or both are delivered. Default to valid
+	OnlyValidTransactions TxValidity `json:"onlyValidTransactions,omitempty"`
+	// Whether the events include the hashed writes of the transactions to private data collections
+	PrivateData bool `json:"privateData,omitempty"`
+}
+
+// RegistersChaincodeEvents is true for subscriptions to a chaincode that register for its events with
+// the SDK, which only delivers those of valid transactions without their read/write sets. Subscriptions
+// to a chaincode that include the events of invalidated transactions, or private data, read them from
+// the blocks instead
+func (info *SubscriptionInfo) RegistersChaincodeEvents() bool {
+	return info.Filter.ChaincodeID != "" && !info.PrivateData && (info.OnlyValidTransactions == "" || info.OnlyValidTransactions == TxValidityValid)
 }
 
 // GetID returns the ID (for sorting)
@@ -63,22 +152,145 @@ func (info *SubscriptionInfo) GetID() string {
 	return info.ID
 }
 
+// SubscriptionGroupInfo is the persisted data for a subscription template, which
+// expands into one subscription per matching channel. Entries in Channels can be
+// plain channel names, or glob patterns (e.g. "trade-*") that are matched against
+// the channels configured for the gateway
+type SubscriptionGroupInfo struct {
+	TimeSorted
+	ID            string          `json:"id,omitempty"`
+	Path          string          `json:"path"`
+	Name          string          `json:"name"`
+	Channels      []string        `json:"channels"`
+	Stream        string          `json:"stream"`
+	Signer        string          `json:"signer"`
+	FromBlock     string          `json:"fromBlock,omitempty"`
+	Filter        persistedFilter `json:"filter"`
+	PayloadType   string          `json:"payloadType,omitempty"`
+	Type          string          `json:"type,omitempty"`
+	Deliver       string          `json:"deliver,omitempty"`
+	Subscriptions []string        `json:"subscriptions"` // IDs of the per-channel subscriptions managed by this group
+	// Added to the webhook requests of batches containing events of the subscriptions of the group
+	Headers map[string]string `json:"headers,omitempty"`
+	// Path to the sequence field of the payloads, checked for gaps by the subscriptions of the group
+	SequencePath string `json:"sequencePath,omitempty"`
+	// Expression the payloads of the events delivered by the subscriptions of the group must match
+	PayloadFilter string `json:"payloadFilter,omitempty"`
+	// Whether the subscriptions of the group deliver the events of valid transactions, invalidated ones or both
+	OnlyValidTransactions TxValidity `json:"onlyValidTransactions,omitempty"`
+	// Whether the events of the subscriptions of the group include the hashed writes to private data collections
+	PrivateData bool `json:"privateData,omitempty"`
+}
+
+// EventSchemaInfo is a JSON Schema registered for the payloads of a chaincode event.
+// Events with a matching chaincode ID and event name are validated against it before
+// delivery, and annotated with the schema ID and any validation errors
+type EventSchemaInfo struct {
+	TimeSorted
+	ID          string          `json:"id,omitempty"`
+	Path        string          `json:"path"`
+	ChaincodeID string          `json:"chaincodeId"`
+	EventName   string          `json:"eventName"`
+	Schema      json.RawMessage `json:"schema"`
+	Subject     string          `json:"subject,omitempty"`    // subject in the schema registry, defaults to <chaincodeId>-<eventName>
+	RegistryID  int             `json:"registryId,omitempty"` // ID assigned by the schema registry, when one is configured
+}
+
+// SubscriptionStats counts the events delivered for a subscription over a rolling window,
+// by chaincode event name. Events without a name, such as those of block subscriptions,
+// are only counted in the total
+type SubscriptionStats struct {
+	ID         string            `json:"id"`
+	From       time.Time         `json:"from"`
+	To         time.Time         `json:"to"`
+	Total      uint64            `json:"total"`
+	EventNames map[string]uint64 `json:"eventNames"`
+}
+
+// SubscriptionsDeleted summarizes a bulk delete of the subscriptions matching a filter
+type SubscriptionsDeleted struct {
+	Deleted       int            `json:"deleted"`
+	Subscriptions []string       `json:"subscriptions"`
+	Streams       map[string]int `json:"streams"` // the subscriptions deleted from each stream
+}
+
+// GetID returns the ID (for sorting)
+func (info *SubscriptionGroupInfo) GetID() string {
+	return info.ID
+}
+
+// SubscriptionFor builds the subscription for a single channel from the template
+func (info *SubscriptionGroupInfo) SubscriptionFor(channelID string) *SubscriptionInfo {
+	name := channelID
+	if info.Name != "" {
+		name = info.Name + "-" + channelID
+	}
+	return &SubscriptionInfo{
+		ChannelID:             channelID,
+		Name:                  name,
+		Stream:                info.Stream,
+		Signer:                info.Signer,
+		FromBlock:             info.FromBlock,
+		Filter:                info.Filter,
+		PayloadType:           info.PayloadType,
+		Type:                  info.Type,
+		Deliver:               info.Deliver,
+		Group:                 info.ID,
+		Headers:               info.Headers,
+		SequencePath:          info.SequencePath,
+		PayloadFilter:         info.PayloadFilter,
+		OnlyValidTransactions: info.OnlyValidTransactions,
+		PrivateData:           info.PrivateData,
+	}
+}
+
 type EventEntry struct {
-	ChaincodeID      string      `json:"chaincodeId"`
-	BlockNumber      uint64      `json:"blockNumber"`
-	TransactionID    string      `json:"transactionId"`
-	TransactionIndex int         `json:"transactionIndex"`
-	EventIndex       int         `json:"eventIndex"`
-	EventName        string      `json:"eventName"`
-	Payload          interface{} `json:"payload"`
-	Timestamp        int64       `json:"timestamp,omitempty"`
-	SubID            string      `json:"subId"`
-}
-
-func GetKeyForEventClient(channelID string, chaincodeID string) string {
-	// key for a unique event client is <channelID>-<chaincodeID>
+	ChaincodeID       string      `json:"chaincodeId"`
+	BlockNumber       uint64      `json:"blockNumber"`
+	TransactionID     string      `json:"transactionId"`
+	TransactionIndex  int         `json:"transactionIndex"`
+	TransactionStatus string      `json:"transactionStatus,omitempty"` // the validation code of the transaction, such as VALID or MVCC_READ_CONFLICT
+	EventIndex        int         `json:"eventIndex"`
+	EventName         string      `json:"eventName"`
+	Payload           interface{} `json:"payload"`
+	Timestamp         int64       `json:"timestamp,omitempty"`
+	SubID             string      `json:"subId"`
+	SchemaID          string      `json:"schemaId,omitempty"`         // ID of the registered schema for the event
+	RegistrySchemaID  int         `json:"registrySchemaId,omitempty"` // ID of the schema in the schema registry, if pushed to one
+	SchemaErrors      []string    `json:"schemaErrors,omitempty"`     // set when the payload does not match the schema
+	// The hashed writes of the transaction to private data collections, for subscriptions to private data
+	PrivateData []*CollectionWrites `json:"privateData,omitempty"`
+	// Webhook headers of the subscription, not delivered as part of the event
+	Headers map[string]string `json:"-"`
+}
+
+// CollectionWrites are the writes of a transaction to a private data collection, as recorded in the
+// block. Only the SHA-256 hashes of the keys and values are on the ledger, for the members of the
+// collection and for everyone else alike, so they can be matched against the private data without
+// revealing it
+type CollectionWrites struct {
+	Namespace    string          `json:"namespace"`  // the chaincode owning the collection
+	Collection   string          `json:"collection"` // the name of the collection
+	PvtRwsetHash string          `json:"pvtRwsetHash,omitempty"`
+	Writes       []*PrivateWrite `json:"writes"`
+}
+
+// PrivateWrite is the hashed write of a key of a private data collection, with hex encoded hashes
+type PrivateWrite struct {
+	KeyHash   string `json:"keyHash"`
+	ValueHash string `json:"valueHash,omitempty"` // empty for deletes
+	IsDelete  bool   `json:"isDelete,omitempty"`
+	IsPurge   bool   `json:"isPurge,omitempty"`
+}
+
+func GetKeyForEventClient(channelID string, chaincodeID string, filtered bool) string {
+	// key for a unique event client is <channelID>-<chaincodeID>, with a -filtered suffix for the
+	// clients of the filtered deliver service.
 	// note that we don't allow "fromBlock" to be a key segment, because on restart
 	// the "fromBlock" will be set to the checkpoint which will be the same, thus failing
 	// to differentiate unique event clients
+	if filtered {
+		return fmt.Sprintf("%s-%s-filtered", channelID, chaincodeID)
+	}
 	return fmt.Sprintf("%s-%s", channelID, chaincodeID)
 }
@@ -0,0 +1,68 @@
+// Copyright 2021 Kaleido
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTxValidityJSON(t *testing.T) {
+	assert := assert.New(t)
+	for in, expected := range map[string]TxValidity{
+		`true`:    TxValidityValid,
+		`"true"`:  TxValidityValid,
+		`false`:   TxValidityInvalid,
+		`"false"`: TxValidityInvalid,
+		`"both"`:  TxValidityBoth,
+	} {
+		info := &SubscriptionInfo{}
+		err := json.Unmarshal([]byte(`{"onlyValidTransactions":`+in+`}`), info)
+		assert.NoError(err)
+		assert.Equal(expected, info.OnlyValidTransactions)
+	}
+	err := json.Unmarshal([]byte(`{"onlyValidTransactions":1}`), &SubscriptionInfo{})
+	assert.Error(err)
+
+	b, _ := json.Marshal(&SubscriptionInfo{OnlyValidTransactions: TxValidityInvalid})
+	assert.Contains(string(b), `"onlyValidTransactions":false`)
+	b, _ = json.Marshal(&SubscriptionInfo{OnlyValidTransactions: TxValidityBoth})
+	assert.Contains(string(b), `"onlyValidTransactions":"both"`)
+	b, _ = json.Marshal(&SubscriptionInfo{})
+	assert.NotContains(string(b), "onlyValidTransactions")
+}
+
+func TestTxValidityIncludes(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(TxValidity("").Includes(true))
+	assert.False(TxValidity("").Includes(false))
+	assert.False(TxValidityInvalid.Includes(true))
+	assert.True(TxValidityInvalid.Includes(false))
+	assert.True(TxValidityBoth.Includes(true))
+	assert.True(TxValidityBoth.Includes(false))
+
+	info := &SubscriptionInfo{}
+	info.Filter.ChaincodeID = "asset_transfer"
+	assert.True(info.RegistersChaincodeEvents())
+	info.OnlyValidTransactions = TxValidityBoth
+	assert.False(info.RegistersChaincodeEvents())
+	info.OnlyValidTransactions = TxValidityValid
+	info.PrivateData = true
+	assert.False(info.RegistersChaincodeEvents())
+}
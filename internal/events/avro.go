@@ -0,0 +1,136 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/linkedin/goavro/v2"
+)
+
+const (
+	// EventFormatAvro serializes each event published by a Kafka stream with Avro, in the
+	// wire format of the Confluent schema registry
+	EventFormatAvro = "avro"
+
+	// avroMagicByte starts each message in the Confluent wire format, before the schema ID
+	avroMagicByte = 0
+)
+
+// avroEventSchema is the record each event is serialized as. The payload of a chaincode event
+// is free-form, so it is carried as its JSON encoding
+const avroEventSchema = `{
+	"type": "record",
+	"name": "ChaincodeEvent",
+	"namespace": "io.hyperledger.fabconnect",
+	"fields": [
+		{"name": "chaincodeId", "type": "string"},
+		{"name": "blockNumber", "type": "long"},
+		{"name": "transactionId", "type": "string"},
+		{"name": "transactionIndex", "type": "int"},
+		{"name": "transactionStatus", "type": "string", "default": ""},
+		{"name": "eventIndex", "type": "int"},
+		{"name": "eventName", "type": "string"},
+		{"name": "payload", "type": "string"},
+		{"name": "timestamp", "type": "long", "default": 0},
+		{"name": "subId", "type": "string"}
+	]
+}`
+
+// avroEncoder serializes events with the Avro schema of the events, registering the schema
+// under the subject of each chaincode event the first time the event is published
+type avroEncoder struct {
+	registry *schemaRegistryClient
+	codec    *goavro.Codec
+	mux      sync.Mutex
+	ids      map[string]int // the registry ID of the schema, by subject
+}
+
+func newAvroEncoder(registry *schemaRegistryClient) (*avroEncoder, error) {
+	codec, err := goavro.NewCodec(avroEventSchema)
+	if err != nil {
+		return nil, err
+	}
+	return &avroEncoder{
+		registry: registry,
+		codec:    codec,
+		ids:      make(map[string]int),
+	}, nil
+}
+
+// avroSubject returns the subject the schema of an event is registered under, which is
+// <topic>-<chaincodeId>-<eventName>. Events that are not chaincode events, such as those
+// of block subscriptions, use the default <topic>-value subject of the topic
+func avroSubject(topic string, event *api.EventEntry) string {
+	if event.ChaincodeID == "" || event.EventName == "" {
+		return topic + "-value"
+	}
+	return fmt.Sprintf("%s-%s-%s", topic, event.ChaincodeID, event.EventName)
+}
+
+// schemaID returns the registry ID of the schema for a subject, registering it on first use
+func (e *avroEncoder) schemaID(ctx context.Context, subject string) (int, error) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if id, ok := e.ids[subject]; ok {
+		return id, nil
+	}
+	id, err := e.registry.register(ctx, subject, schemaTypeAvro, json.RawMessage(avroEventSchema))
+	if err != nil {
+		return 0, err
+	}
+	e.ids[subject] = id
+	return id, nil
+}
+
+// encode returns the message for an event published to the topic: the magic byte, the
+// 4-byte big-endian ID of the schema, then the Avro binary encoding of the event
+func (e *avroEncoder) encode(ctx context.Context, topic string, event *api.EventEntry) ([]byte, error) {
+	id, err := e.schemaID(ctx, avroSubject(topic, event))
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		return nil, errors.Errorf(errors.EventStreamsAvroEncodeFailed, event.BlockNumber, err)
+	}
+	header := make([]byte, 5)
+	header[0] = avroMagicByte
+	binary.BigEndian.PutUint32(header[1:], uint32(id))
+	b, err := e.codec.BinaryFromNative(header, map[string]interface{}{
+		"chaincodeId":       event.ChaincodeID,
+		"blockNumber":       int64(event.BlockNumber),
+		"transactionId":     event.TransactionID,
+		"transactionIndex":  int32(event.TransactionIndex),
+		"transactionStatus": event.TransactionStatus,
+		"eventIndex":        int32(event.EventIndex),
+		"eventName":         event.EventName,
+		"payload":           string(payload),
+		"timestamp":         event.Timestamp,
+		"subId":             event.SubID,
+	})
+	if err != nil {
+		return nil, errors.Errorf(errors.EventStreamsAvroEncodeFailed, event.BlockNumber, err)
+	}
+	return b, nil
+}
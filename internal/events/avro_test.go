@@ -0,0 +1,158 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/linkedin/goavro/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestAvroRegistry serves a schema registry that assigns an ID to each subject, in the
+// order they are registered, and counts the registrations of each
+func newTestAvroRegistry(t *testing.T) (*httptest.Server, map[string]int) {
+	var mux sync.Mutex
+	registered := make(map[string]int)
+	var order []string
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(req.Body).Decode(&body)
+		assert.Equal(t, "AVRO", body["schemaType"])
+		assert.JSONEq(t, avroEventSchema, body["schema"])
+		subject := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/subjects/"), "/versions")
+		mux.Lock()
+		defer mux.Unlock()
+		if registered[subject] == 0 {
+			order = append(order, subject)
+		}
+		registered[subject]++
+		id := 0
+		for i, s := range order {
+			if s == subject {
+				id = i + 1
+			}
+		}
+		_ = json.NewEncoder(res).Encode(map[string]int{"id": 100 + id})
+	}))
+	t.Cleanup(svr.Close)
+	return svr, registered
+}
+
+func decodeAvroMessage(t *testing.T, b []byte) (int, map[string]interface{}) {
+	codec, err := goavro.NewCodec(avroEventSchema)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(avroMagicByte), b[0])
+	native, remaining, err := codec.NativeFromBinary(b[5:])
+	assert.NoError(t, err)
+	assert.Empty(t, remaining)
+	return int(binary.BigEndian.Uint32(b[1:5])), native.(map[string]interface{})
+}
+
+func TestAvroSubject(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("events-asset_transfer-Created", avroSubject("events", &eventsapi.EventEntry{ChaincodeID: "asset_transfer", EventName: "Created"}))
+	assert.Equal("events-value", avroSubject("events", &eventsapi.EventEntry{BlockNumber: 10}))
+}
+
+func TestAvroEncode(t *testing.T) {
+	assert := assert.New(t)
+	svr, registered := newTestAvroRegistry(t)
+	encoder, err := newAvroEncoder(newSchemaRegistryClient(&conf.SchemaRegistryConf{URL: svr.URL}))
+	assert.NoError(err)
+
+	event := &eventsapi.EventEntry{
+		ChaincodeID:      "asset_transfer",
+		BlockNumber:      10,
+		TransactionID:    "tx1",
+		TransactionIndex: 1,
+		EventIndex:       2,
+		EventName:        "Created",
+		Payload:          map[string]interface{}{"id": "asset1"},
+		Timestamp:        1000,
+		SubID:            "sb-1",
+	}
+	b, err := encoder.encode(context.Background(), "events", event)
+	assert.NoError(err)
+	id, native := decodeAvroMessage(t, b)
+	assert.Equal(101, id)
+	assert.Equal("asset_transfer", native["chaincodeId"])
+	assert.Equal(int64(10), native["blockNumber"])
+	assert.Equal(int32(1), native["transactionIndex"])
+	assert.Equal(int32(2), native["eventIndex"])
+	assert.Equal(`{"id":"asset1"}`, native["payload"])
+	assert.Equal(int64(1000), native["timestamp"])
+	assert.Equal("sb-1", native["subId"])
+
+	// the schema is registered once for each subject
+	_, err = encoder.encode(context.Background(), "events", event)
+	assert.NoError(err)
+	event.EventName = "Deleted"
+	b, err = encoder.encode(context.Background(), "events", event)
+	assert.NoError(err)
+	id, _ = decodeAvroMessage(t, b)
+	assert.Equal(102, id)
+	assert.Equal(map[string]int{"events-asset_transfer-Created": 1, "events-asset_transfer-Deleted": 1}, registered)
+}
+
+func TestAvroEncodeRegistryFailure(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(500)
+	}))
+	defer svr.Close()
+	encoder, err := newAvroEncoder(newSchemaRegistryClient(&conf.SchemaRegistryConf{URL: svr.URL}))
+	assert.NoError(t, err)
+	_, err = encoder.encode(context.Background(), "events", &eventsapi.EventEntry{ChaincodeID: "asset_transfer", EventName: "Created"})
+	assert.Regexp(t, "Failed to register schema for subject 'events-asset_transfer-Created'", err)
+	assert.Empty(t, encoder.ids)
+}
+
+func TestKafkaAttemptBatchAvro(t *testing.T) {
+	assert := assert.New(t)
+	svr, _ := newTestAvroRegistry(t)
+	producer := &mockBrokerClient{}
+	mockBrokerClients(t, producer)
+
+	spec := &kafkaActionInfo{Brokers: []string{"broker:9092"}, Topic: "events"}
+	sm := &mockSubMgr{config: &conf.EventstreamConf{SchemaRegistry: conf.SchemaRegistryConf{URL: svr.URL}}}
+	es := &eventStream{sm: sm, spec: &StreamInfo{ID: "es-1", Type: EventStreamTypeKafka, Format: EventFormatAvro, Kafka: spec}}
+	action, err := newKafkaAction(es, spec)
+	assert.NoError(err)
+
+	err = action.attemptBatch(context.Background(), 1, 1, testKafkaEvents())
+	assert.NoError(err)
+	msgs := producer.sent[0].([]*sarama.ProducerMessage)
+	assert.Equal(2, len(msgs))
+	b, _ := msgs[0].Value.Encode()
+	id, native := decodeAvroMessage(t, b)
+	assert.Equal(101, id)
+	assert.Equal("Created", native["eventName"])
+	b, _ = msgs[1].Value.Encode()
+	id, native = decodeAvroMessage(t, b)
+	assert.Equal(102, id)
+	assert.Equal("Deleted", native["eventName"])
+}
@@ -0,0 +1,151 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// BatchSizeAuto is the batchSize of a stream that tunes its batch size to its consumer
+const BatchSizeAuto = "auto"
+
+// BatchSizeStream is the batchSize of a stream that delivers each event on its own
+const BatchSizeStream = "stream"
+
+const (
+	autoBatchGrowth = 1.5
+	autoBatchShrink = 0.75
+	// Per-event delivery time within this ratio of the best seen still counts as keeping up
+	autoBatchTolerance = 1.1
+	// The best per-event delivery time relaxes each batch, so the tuning follows a consumer that slows down
+	autoBatchBestDecay = 1.01
+)
+
+// batchTuner adapts the batch size of a stream with batchSize "auto" to its consumer.
+// The size grows while bigger batches deliver each event at least as fast as the best
+// seen so far, shrinks when they get slower, and halves when a batch fails
+type batchTuner struct {
+	mux          sync.Mutex
+	streamID     string
+	current      uint64
+	bestPerEvent float64 // seconds
+}
+
+func newBatchTuner(streamID string) *batchTuner {
+	return &batchTuner{
+		streamID: streamID,
+		current:  1,
+	}
+}
+
+func (t *batchTuner) size() uint64 {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	return t.current
+}
+
+// record feeds back the outcome of delivering a batch of events
+func (t *batchTuner) record(events int, elapsed time.Duration, err error) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	previous := t.current
+	switch {
+	case err != nil:
+		t.current /= 2
+	case uint64(events) < t.current:
+		// The batch timed out before filling, which says nothing about the consumer
+		return
+	default:
+		perEvent := elapsed.Seconds() / float64(events)
+		if t.bestPerEvent == 0 || perEvent < t.bestPerEvent {
+			t.bestPerEvent = perEvent
+		}
+		if perEvent <= t.bestPerEvent*autoBatchTolerance {
+			t.current = uint64(float64(t.current)*autoBatchGrowth + 0.5)
+		} else {
+			t.current = uint64(float64(t.current) * autoBatchShrink)
+		}
+		t.bestPerEvent *= autoBatchBestDecay
+	}
+	if t.current < 1 {
+		t.current = 1
+	} else if t.current > MaxBatchSize {
+		t.current = MaxBatchSize
+	}
+	if t.current != previous {
+		log.Debugf("%s: Batch size tuned from %d to %d", t.streamID, previous, t.current)
+	}
+}
+
+// streamInfoJSON has the fields of StreamInfo, without its JSON methods
+type streamInfoJSON StreamInfo
+
+// MarshalJSON writes a batchSize of "auto" when the batch size is tuned, and of "stream" when
+// each event is delivered on its own
+func (spec StreamInfo) MarshalJSON() ([]byte, error) {
+	var batchSize interface{}
+	if spec.BatchSizeAuto {
+		batchSize = BatchSizeAuto
+	} else if spec.BatchSizeStream {
+		batchSize = BatchSizeStream
+	} else if spec.BatchSize != 0 {
+		batchSize = spec.BatchSize
+	}
+	return json.Marshal(&struct {
+		*streamInfoJSON
+		BatchSize interface{} `json:"batchSize,omitempty"`
+	}{
+		streamInfoJSON: (*streamInfoJSON)(&spec),
+		BatchSize:      batchSize,
+	})
+}
+
+// UnmarshalJSON accepts a batchSize that is a number, "auto" or "stream". A batchSize of 0, like
+// omitting it, gives the default
+func (spec *StreamInfo) UnmarshalJSON(b []byte) error {
+	aux := &struct {
+		*streamInfoJSON
+		BatchSize json.RawMessage `json:"batchSize,omitempty"`
+	}{
+		streamInfoJSON: (*streamInfoJSON)(spec),
+	}
+	if err := json.Unmarshal(b, aux); err != nil {
+		return err
+	}
+	switch string(aux.BatchSize) {
+	case "", "null":
+		return nil
+	case `"` + BatchSizeAuto + `"`:
+		spec.BatchSizeAuto = true
+		spec.BatchSizeStream = false
+		spec.BatchSize = 0
+		return nil
+	case `"` + BatchSizeStream + `"`:
+		spec.BatchSizeStream = true
+		spec.BatchSizeAuto = false
+		spec.BatchSize = 0
+		return nil
+	default:
+		spec.BatchSizeAuto = false
+		spec.BatchSizeStream = false
+		return json.Unmarshal(aux.BatchSize, &spec.BatchSize)
+	}
+}
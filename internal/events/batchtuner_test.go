@@ -0,0 +1,168 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/kvstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchTunerGrowsWhileKeepingUp(t *testing.T) {
+	assert := assert.New(t)
+	tuner := newBatchTuner("es1")
+	assert.Equal(uint64(1), tuner.size())
+	for i := 0; i < 30; i++ {
+		size := tuner.size()
+		tuner.record(int(size), time.Duration(size)*time.Millisecond, nil)
+	}
+	assert.Equal(uint64(MaxBatchSize), tuner.size())
+}
+
+func TestBatchTunerShrinksWhenSlower(t *testing.T) {
+	assert := assert.New(t)
+	tuner := newBatchTuner("es1")
+	tuner.current = 100
+	tuner.record(100, 100*time.Millisecond, nil)
+	grown := tuner.size()
+	assert.Greater(grown, uint64(100))
+	// each event now takes twice as long to deliver
+	tuner.record(int(grown), time.Duration(grown)*2*time.Millisecond, nil)
+	assert.Less(tuner.size(), grown)
+}
+
+func TestBatchTunerHalvesOnError(t *testing.T) {
+	assert := assert.New(t)
+	tuner := newBatchTuner("es1")
+	tuner.current = 10
+	tuner.record(10, time.Millisecond, fmt.Errorf("pop"))
+	assert.Equal(uint64(5), tuner.size())
+	tuner.current = 1
+	tuner.record(1, time.Millisecond, fmt.Errorf("pop"))
+	assert.Equal(uint64(1), tuner.size())
+}
+
+func TestBatchTunerIgnoresPartialBatches(t *testing.T) {
+	assert := assert.New(t)
+	tuner := newBatchTuner("es1")
+	tuner.current = 10
+	tuner.record(3, time.Millisecond, nil)
+	assert.Equal(uint64(10), tuner.size())
+}
+
+func TestStreamInfoBatchSizeJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	var spec StreamInfo
+	err := json.Unmarshal([]byte(`{"name":"s1","batchSize":"auto"}`), &spec)
+	assert.NoError(err)
+	assert.True(spec.BatchSizeAuto)
+	assert.Equal("s1", spec.Name)
+	b, _ := json.Marshal(&spec)
+	assert.Contains(string(b), `"batchSize":"auto"`)
+
+	spec = StreamInfo{}
+	err = json.Unmarshal([]byte(`{"batchSize":5}`), &spec)
+	assert.NoError(err)
+	assert.False(spec.BatchSizeAuto)
+	assert.Equal(uint64(5), spec.BatchSize)
+	b, _ = json.Marshal(spec)
+	assert.Contains(string(b), `"batchSize":5`)
+
+	spec = StreamInfo{}
+	b, _ = json.Marshal(&spec)
+	assert.NotContains(string(b), "batchSize")
+
+	// a batchSize of 0 gives the default, rather than delivering each event on its own
+	err = json.Unmarshal([]byte(`{"batchSize":0}`), &spec)
+	assert.NoError(err)
+	assert.False(spec.BatchSizeStream)
+	setStreamDefaults(&spec)
+	assert.Equal(uint64(DefaultBatchSize), spec.BatchSize)
+	b, _ = json.Marshal(&spec)
+	assert.Contains(string(b), `"batchSize":1`)
+
+	spec = StreamInfo{}
+	err = json.Unmarshal([]byte(`{"batchSize":"stream"}`), &spec)
+	assert.NoError(err)
+	assert.True(spec.BatchSizeStream)
+	assert.False(spec.BatchSizeAuto)
+	setStreamDefaults(&spec)
+	assert.Equal(uint64(1), spec.BatchSize)
+	b, _ = json.Marshal(&spec)
+	assert.Contains(string(b), `"batchSize":"stream"`)
+	err = json.Unmarshal([]byte(`{"batchSize":5}`), &spec)
+	assert.NoError(err)
+	assert.False(spec.BatchSizeStream)
+
+	err = json.Unmarshal([]byte(`{"batchSize":"big"}`), &spec)
+	assert.Error(err)
+}
+
+func TestAutoBatchSizeStream(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	db := kvstore.NewLDBKeyValueStore(dir)
+	_ = db.Init()
+	sm, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			BatchSizeAuto: true,
+			Webhook: &webhookActionInfo{
+				TLSkipHostVerify: &falseValue,
+			},
+		}, db, 200)
+	defer svr.Close()
+	defer close(eventStream)
+	defer stream.stop()
+	assert.NotNil(stream.batchTuner)
+	assert.Equal(uint64(0), stream.spec.BatchSize)
+	assert.Equal(uint64(1), stream.batchSize())
+
+	updatedStream, err := sm.updateStream(stream, &StreamInfo{BatchSize: 10})
+	assert.NoError(err)
+	assert.False(updatedStream.BatchSizeAuto)
+	assert.Nil(stream.batchTuner)
+	assert.Equal(uint64(10), stream.batchSize())
+
+	updatedStream, err = sm.updateStream(stream, &StreamInfo{BatchSizeAuto: true})
+	assert.NoError(err)
+	assert.True(updatedStream.BatchSizeAuto)
+	assert.NotNil(stream.batchTuner)
+
+	updatedStream, err = sm.updateStream(stream, &StreamInfo{BatchSizeStream: true})
+	assert.NoError(err)
+	assert.True(updatedStream.BatchSizeStream)
+	assert.False(updatedStream.BatchSizeAuto)
+	assert.Nil(stream.batchTuner)
+	assert.Equal(uint64(1), stream.batchSize())
+
+	// an update without a batch size keeps delivering each event on its own
+	updatedStream, err = sm.updateStream(stream, &StreamInfo{})
+	assert.NoError(err)
+	assert.True(updatedStream.BatchSizeStream)
+
+	updatedStream, err = sm.updateStream(stream, &StreamInfo{BatchSize: 1})
+	assert.NoError(err)
+	assert.False(updatedStream.BatchSizeStream)
+	assert.Equal(uint64(1), stream.batchSize())
+}
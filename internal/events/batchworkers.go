@@ -0,0 +1,101 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+)
+
+// validateStreamConcurrency checks that only webhook streams deliver batches in parallel, as each
+// batch is an independent request, where the other actions share a connection or topic ordering
+func validateStreamConcurrency(concurrency uint32, streamType string) error {
+	if concurrency > MaxConcurrency {
+		return errors.Errorf(errors.EventStreamsConcurrencyTooHigh, concurrency, MaxConcurrency)
+	}
+	if concurrency > 1 && streamType != EventStreamTypeWebhook {
+		return errors.Errorf(errors.EventStreamsConcurrencyNotSupported, streamType)
+	}
+	return nil
+}
+
+// concurrency is the number of batches the stream delivers in parallel
+func (a *eventStream) concurrency() int {
+	if a.spec.Concurrency > 1 {
+		return int(a.spec.Concurrency)
+	}
+	return 1
+}
+
+// splitBySubscription divides a batch into a batch for each subscription with events in it,
+// keeping the order of the events of each
+func splitBySubscription(events []*eventData) [][]*eventData {
+	var batches [][]*eventData
+	bySub := make(map[string]int)
+	for _, event := range events {
+		i, ok := bySub[event.event.SubID]
+		if !ok {
+			i = len(batches)
+			bySub[event.event.SubID] = i
+			batches = append(batches, nil)
+		}
+		batches[i] = append(batches[i], event)
+	}
+	return batches
+}
+
+// nextBatch takes the first queued batch with no subscription that has a batch being processed,
+// or queued ahead of it, so the events of each subscription are delivered in order. Returns the
+// batch and its subscriptions, or nil if there is no such batch. Must be called with the batchCond
+// lock held
+func (a *eventStream) nextBatch() ([]*eventData, []string) {
+	held := make(map[string]bool)
+	for elem := a.batchQueue.Front(); elem != nil; elem = elem.Next() {
+		batch := elem.Value.([]*eventData)
+		ready := true
+		for _, event := range batch {
+			if a.busySubs[event.event.SubID] || held[event.event.SubID] {
+				ready = false
+				break
+			}
+		}
+		if ready {
+			a.batchQueue.Remove(elem)
+			var subs []string
+			for _, event := range batch {
+				if !a.busySubs[event.event.SubID] {
+					a.busySubs[event.event.SubID] = true
+					subs = append(subs, event.event.SubID)
+				}
+			}
+			return batch, subs
+		}
+		for _, event := range batch {
+			held[event.event.SubID] = true
+		}
+	}
+	return nil, nil
+}
+
+// releaseBatch lets the next batches of the subscriptions of a processed batch be taken, and
+// must be called with the batchCond lock held. The events of the batch have been released by
+// then, so it is given the subscriptions nextBatch returned
+func (a *eventStream) releaseBatch(subs []string) {
+	for _, subID := range subs {
+		delete(a.busySubs, subID)
+	}
+	a.batchCond.Broadcast()
+}
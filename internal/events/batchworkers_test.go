@@ -0,0 +1,126 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"container/list"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateStreamConcurrency(t *testing.T) {
+	assert := assert.New(t)
+	assert.NoError(validateStreamConcurrency(0, EventStreamTypeKafka))
+	assert.NoError(validateStreamConcurrency(1, EventStreamTypeWebsocket))
+	assert.NoError(validateStreamConcurrency(MaxConcurrency, EventStreamTypeWebhook))
+	assert.EqualError(validateStreamConcurrency(MaxConcurrency+1, EventStreamTypeWebhook), "Invalid concurrency 33. Must not exceed 32")
+	assert.EqualError(validateStreamConcurrency(2, EventStreamTypeKafka), "Batches can only be delivered concurrently by webhook streams, not kafka streams")
+}
+
+func TestSplitBySubscription(t *testing.T) {
+	assert := assert.New(t)
+	e1, e2, e3 := testEvent("sub1"), testEvent("sub2"), testEvent("sub1")
+	batches := splitBySubscription([]*eventData{e1, e2, e3})
+	assert.Equal([][]*eventData{{e1, e3}, {e2}}, batches)
+}
+
+func TestNextBatchKeepsSubscriptionOrder(t *testing.T) {
+	assert := assert.New(t)
+	a := &eventStream{
+		batchCond:  sync.NewCond(&sync.Mutex{}),
+		batchQueue: list.New(),
+		busySubs:   make(map[string]bool),
+	}
+	b1 := []*eventData{testEvent("sub1"), testEvent("sub2")}
+	b2 := []*eventData{testEvent("sub2")}
+	b3 := []*eventData{testEvent("sub3")}
+	b4 := []*eventData{testEvent("sub1")}
+	for _, b := range [][]*eventData{b1, b2, b3, b4} {
+		a.batchQueue.PushBack(b)
+	}
+
+	batch, subs := a.nextBatch()
+	assert.Equal(b1, batch)
+	assert.Equal([]string{"sub1", "sub2"}, subs)
+	// sub1 and sub2 are busy, so only the batch of sub3 can be taken
+	batch, subs = a.nextBatch()
+	assert.Equal(b3, batch)
+	batch, _ = a.nextBatch()
+	assert.Nil(batch)
+
+	a.releaseBatch([]string{"sub1", "sub2"})
+	batch, _ = a.nextBatch()
+	assert.Equal(b2, batch)
+	batch, _ = a.nextBatch()
+	assert.Equal(b4, batch)
+	assert.Equal(0, a.batchQueue.Len())
+	a.releaseBatch(subs)
+	assert.Equal(map[string]bool{"sub1": true, "sub2": true}, a.busySubs)
+}
+
+func TestConcurrentBatches(t *testing.T) {
+	assert := assert.New(t)
+	// holds the first batch of sub1 until released, and reports the subscription of each batch
+	arrived := make(chan string, 3)
+	release := make(chan struct{})
+	var held sync.Once
+	webhook := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var events []*eventsapi.EventEntry
+		_ = json.NewDecoder(req.Body).Decode(&events)
+		arrived <- events[0].SubID
+		if events[0].SubID == "sub1" {
+			held.Do(func() { <-release })
+		}
+		res.WriteHeader(200)
+	}))
+	defer webhook.Close()
+	_, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			Type:           EventStreamTypeWebhook,
+			BatchSize:      1,
+			BatchTimeoutMS: 10,
+			Concurrency:    2,
+			Webhook: &webhookActionInfo{
+				URL:              webhook.URL,
+				TLSkipHostVerify: &falseValue,
+			},
+		}, nil, 200)
+	defer close(eventStream)
+	defer svr.Close()
+	defer stream.stop()
+
+	// the second batch of sub1 waits for its first, while the batch of sub2 is delivered alongside it
+	stream.handleEvent(testEvent("sub1"))
+	stream.handleEvent(testEvent("sub1"))
+	stream.handleEvent(testEvent("sub2"))
+	assert.ElementsMatch([]string{"sub1", "sub2"}, []string{<-arrived, <-arrived})
+	close(release)
+	assert.Equal("sub1", <-arrived)
+
+	_, err := stream.update(&StreamInfo{Concurrency: MaxConcurrency + 1})
+	assert.Regexp("Invalid concurrency", err)
+	_, err = stream.update(&StreamInfo{Concurrency: 4})
+	assert.NoError(err)
+	assert.Equal(uint32(4), stream.spec.Concurrency)
+	assert.Equal(4, stream.concurrency())
+}
@@ -0,0 +1,108 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"fmt"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/hyperledger/fabric-protos-go/common"
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/hyperledger/firefly-fabconnect/internal/fabric/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultDecodedBlockCacheSize is the number of recently decoded blocks kept for
+	// the other subscriptions on the same channel, which receive the same blocks
+	DefaultDecodedBlockCacheSize = 100
+)
+
+type decodedBlock struct {
+	once      sync.Once
+	events    []*eventsapi.EventEntry
+	blockOnce sync.Once
+	block     *eventsapi.EventEntry // the whole block, for the subscriptions to full blocks
+}
+
+// blockDecoder decodes each block delivered on a channel once, sharing the resulting
+// events across all the subscriptions listening on that channel. The shared events
+// must be treated as read-only, and copied by each subscription before processing
+type blockDecoder struct {
+	mux    sync.Mutex
+	blocks *lru.Cache
+}
+
+func newBlockDecoder(size int) *blockDecoder {
+	if size <= 0 {
+		size = DefaultDecodedBlockCacheSize
+	}
+	blocks, _ := lru.New(size)
+	return &blockDecoder{
+		blocks: blocks,
+	}
+}
+
+func (d *blockDecoder) decodedBlock(channelID string, block *common.Block) *decodedBlock {
+	key := fmt.Sprintf("%s/%d", channelID, block.Header.Number)
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	if cached, ok := d.blocks.Get(key); ok {
+		return cached.(*decodedBlock)
+	}
+	decoded := &decodedBlock{}
+	d.blocks.Add(key, decoded)
+	return decoded
+}
+
+func (d *blockDecoder) getEvents(channelID string, block *common.Block) []*eventsapi.EventEntry {
+	decoded := d.decodedBlock(channelID, block)
+	// concurrent subscriptions receiving the same block wait for the first to decode it
+	decoded.once.Do(func() {
+		decoded.events = utils.GetEvents(block)
+	})
+	return decoded.events
+}
+
+// getBlock returns an entry with the whole decoded block as its payload, in the same form as the
+// blocks returned by the API. Returns nil for blocks that cannot be decoded
+func (d *blockDecoder) getBlock(channelID string, block *common.Block) *eventsapi.EventEntry {
+	decoded := d.decodedBlock(channelID, block)
+	decoded.blockOnce.Do(func() {
+		rawBlock, decodedBlock, err := utils.DecodeBlock(block)
+		if err != nil {
+			log.Errorf("Failed to decode block %d on channel %s: %s", block.Header.Number, channelID, err)
+			return
+		}
+		entry := &eventsapi.EventEntry{
+			BlockNumber: decodedBlock.Number,
+			Payload: map[string]interface{}{
+				"raw":   rawBlock,
+				"block": decodedBlock,
+			},
+		}
+		// blocks do not have a timestamp, so they have the one of their first transaction
+		if len(decodedBlock.Transactions) > 0 && decodedBlock.Transactions[0] != nil {
+			entry.Timestamp = decodedBlock.Transactions[0].Timestamp
+		} else if decodedBlock.Config != nil {
+			entry.Timestamp = decodedBlock.Config.Timestamp
+		}
+		decoded.block = entry
+	})
+	return decoded.block
+}
@@ -0,0 +1,115 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go/peer"
+	eventmocks "github.com/hyperledger/fabric-sdk-go/pkg/fab/events/service/mocks"
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/hyperledger/firefly-fabconnect/internal/fabric/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockDecoderSharesDecodedEvents(t *testing.T) {
+	assert := assert.New(t)
+	tx := eventmocks.NewTransactionWithCCEvent("testTxID", peer.TxValidationCode_VALID, "testChaincodeID", "testCCEventName", []byte("testPayload"))
+	block := eventmocks.NewBlock("channel1", tx)
+	block.Header.Number = 5
+
+	d := newBlockDecoder(0)
+	results := make([][]*eventsapi.EventEntry, 5)
+	wg := &sync.WaitGroup{}
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			results[i] = d.getEvents("channel1", block)
+			wg.Done()
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(1, len(results[0]))
+	assert.Equal("testCCEventName", results[0][0].EventName)
+	assert.Equal(uint64(5), results[0][0].BlockNumber)
+	for _, events := range results {
+		assert.Same(results[0][0], events[0])
+	}
+
+	// the same block number on another channel is a different block
+	other := d.getEvents("channel2", block)
+	assert.NotSame(results[0][0], other[0])
+}
+
+func TestBlockDecoderEviction(t *testing.T) {
+	assert := assert.New(t)
+	tx := eventmocks.NewTransactionWithCCEvent("testTxID", peer.TxValidationCode_VALID, "testChaincodeID", "testCCEventName", []byte("testPayload"))
+	block1 := eventmocks.NewBlock("channel1", tx)
+	block1.Header.Number = 1
+	block2 := eventmocks.NewBlock("channel1", tx)
+	block2.Header.Number = 2
+
+	d := newBlockDecoder(1)
+	first := d.getEvents("channel1", block1)
+	d.getEvents("channel1", block2)
+	assert.NotSame(first[0], d.getEvents("channel1", block1)[0])
+}
+
+func TestBlockDecoderFullBlocks(t *testing.T) {
+	assert := assert.New(t)
+	tx := eventmocks.NewTransactionWithCCEvent("testTxID", peer.TxValidationCode_VALID, "testChaincodeID", "testCCEventName", []byte("testPayload"))
+	block := eventmocks.NewBlock("channel1", tx)
+	block.Header.Number = 7
+
+	d := newBlockDecoder(0)
+	entry := d.getBlock("channel1", block)
+	assert.Equal(uint64(7), entry.BlockNumber)
+	assert.Empty(entry.EventName)
+	payload := entry.Payload.(map[string]interface{})
+	decoded := payload["block"].(*utils.Block)
+	assert.Equal(uint64(7), decoded.Number)
+	assert.Equal(1, len(decoded.Transactions))
+	assert.Equal("testTxID", decoded.Transactions[0].TxID)
+	assert.Equal(decoded.Transactions[0].Timestamp, entry.Timestamp)
+	raw := payload["raw"].(*utils.RawBlock)
+	assert.NotNil(raw.Metadata)
+	assert.Same(entry, d.getBlock("channel1", block))
+
+	// the events of the block are decoded separately
+	events := d.getEvents("channel1", block)
+	assert.Equal("testCCEventName", events[0].EventName)
+}
+
+func TestEventDataPool(t *testing.T) {
+	assert := assert.New(t)
+	entry := &eventsapi.EventEntry{SubID: "sub1"}
+	e := newEventData(entry, func(*eventsapi.EventEntry) {})
+	assert.Same(entry, e.event)
+	assert.NotNil(e.batchComplete)
+	b, _ := json.Marshal(entry)
+	assert.Equal(len(b), e.jsonSize())
+	// the size is measured once
+	entry.SubID = "sub10"
+	assert.Equal(len(b), e.jsonSize())
+	e.release()
+	assert.Nil(e.event)
+	assert.Nil(e.batchComplete)
+	assert.Zero(e.size)
+}
@@ -0,0 +1,182 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// brokerType is an action type that publishes to a broker, with its settings in a field of the
+// stream of its own. The settings of the types are validated, defaulted, merged and applied to
+// a stream the same way
+type brokerType interface {
+	validate(spec *StreamInfo) error
+	setDefaults(spec *StreamInfo)
+	// merge sets the settings of the merged spec to the existing settings, overridden by those
+	// set in the update
+	merge(merged, existing, update *StreamInfo)
+	// apply updates the settings of the stream in place, as its action holds on to them, and
+	// returns whether they changed
+	apply(spec, newSpec *StreamInfo) bool
+	newAction(es *eventStream, spec *StreamInfo) (eventStreamAction, error)
+}
+
+type brokerSettings[T any] struct {
+	field               func(spec *StreamInfo) **T
+	validateSettings    func(settings *T) error
+	setSettingsDefaults func(settings *T)
+	mergeSettings       func(existing, update *T) *T
+	newBrokerAction     func(es *eventStream, settings *T) (eventStreamAction, error)
+}
+
+var brokerTypes = map[string]brokerType{
+	EventStreamTypeKafka: &brokerSettings[kafkaActionInfo]{
+		field:               func(spec *StreamInfo) **kafkaActionInfo { return &spec.Kafka },
+		validateSettings:    validateKafkaConfig,
+		setSettingsDefaults: setKafkaDefaults,
+		mergeSettings:       mergeKafkaConfig,
+		newBrokerAction: func(es *eventStream, settings *kafkaActionInfo) (eventStreamAction, error) {
+			return newKafkaAction(es, settings)
+		},
+	},
+	EventStreamTypeMQTT: &brokerSettings[mqttActionInfo]{
+		field:               func(spec *StreamInfo) **mqttActionInfo { return &spec.MQTT },
+		validateSettings:    validateMQTTConfig,
+		setSettingsDefaults: setMQTTDefaults,
+		mergeSettings:       mergeMQTTConfig,
+		newBrokerAction: func(es *eventStream, settings *mqttActionInfo) (eventStreamAction, error) {
+			return newMQTTAction(es, settings)
+		},
+	},
+	EventStreamTypeAMQP: &brokerSettings[amqpActionInfo]{
+		field:               func(spec *StreamInfo) **amqpActionInfo { return &spec.AMQP },
+		validateSettings:    validateAMQPConfig,
+		setSettingsDefaults: setAMQPDefaults,
+		mergeSettings:       mergeAMQPConfig,
+		newBrokerAction: func(es *eventStream, settings *amqpActionInfo) (eventStreamAction, error) {
+			return newAMQPAction(es, settings)
+		},
+	},
+	EventStreamTypeNATS: &brokerSettings[natsActionInfo]{
+		field:               func(spec *StreamInfo) **natsActionInfo { return &spec.NATS },
+		validateSettings:    validateNATSConfig,
+		setSettingsDefaults: setNATSDefaults,
+		mergeSettings:       mergeNATSConfig,
+		newBrokerAction: func(es *eventStream, settings *natsActionInfo) (eventStreamAction, error) {
+			return newNATSAction(es, settings)
+		},
+	},
+	EventStreamTypeGRPC: &brokerSettings[grpcActionInfo]{
+		field:               func(spec *StreamInfo) **grpcActionInfo { return &spec.GRPC },
+		validateSettings:    validateGRPCConfig,
+		setSettingsDefaults: setGRPCDefaults,
+		mergeSettings:       mergeGRPCConfig,
+		newBrokerAction: func(es *eventStream, settings *grpcActionInfo) (eventStreamAction, error) {
+			return newGRPCAction(es, settings)
+		},
+	},
+}
+
+func (b *brokerSettings[T]) validate(spec *StreamInfo) error {
+	return b.validateSettings(*b.field(spec))
+}
+
+func (b *brokerSettings[T]) setDefaults(spec *StreamInfo) {
+	if settings := *b.field(spec); settings != nil {
+		b.setSettingsDefaults(settings)
+	}
+}
+
+func (b *brokerSettings[T]) merge(merged, existing, update *StreamInfo) {
+	if settings := *b.field(update); settings != nil {
+		*b.field(merged) = b.mergeSettings(*b.field(existing), settings)
+	}
+}
+
+func (b *brokerSettings[T]) apply(spec, newSpec *StreamInfo) bool {
+	settings, newSettings := *b.field(spec), *b.field(newSpec)
+	b.setSettingsDefaults(newSettings)
+	if reflect.DeepEqual(*newSettings, *settings) {
+		return false
+	}
+	*settings = *newSettings
+	return true
+}
+
+func (b *brokerSettings[T]) newAction(es *eventStream, spec *StreamInfo) (eventStreamAction, error) {
+	return b.newBrokerAction(es, *b.field(spec))
+}
+
+// brokerClient is the connection of an action to its broker
+type brokerClient interface {
+	Close() error
+}
+
+// brokerConnection holds the connection of an action to its broker between batches. The
+// connection is opened by the first batch, and again by the batch after one that failed, or
+// after the connection was lost. It must only be used by one batch at a time
+type brokerConnection[C brokerClient] struct {
+	es *eventStream
+	// describes the broker in the logs, such as "MQTT broker"
+	broker string
+	// the error of a failed connection, with the ID of the stream and the cause
+	connectFailed errors.ErrorID
+	dial          func(ctx context.Context) (C, error)
+	// lost returns whether the connection was lost, for the clients that can tell
+	lost   func(client C) bool
+	client C
+	open   bool
+}
+
+// connection returns the open connection, or opens a new one
+func (b *brokerConnection[C]) connection(ctx context.Context, attempt uint64, target string) (C, error) {
+	esID := b.es.spec.ID
+	if b.open && b.lost != nil && b.lost(b.client) {
+		log.Debugf("%s: Reconnecting to %s after the connection was lost", esID, b.broker)
+		b.close()
+	}
+	if !b.open {
+		client, err := b.dial(ctx)
+		if err != nil {
+			log.Errorf("%s: Failed to connect to %s %s (attempt=%d): %s", esID, b.broker, target, attempt, err)
+			return client, errors.Errorf(b.connectFailed, esID, err)
+		}
+		b.client, b.open = client, true
+	}
+	return b.client, nil
+}
+
+func (b *brokerConnection[C]) connected() bool {
+	return b.open
+}
+
+// close disconnects from the broker, if connected. After a batch fails the connection is
+// closed, so the next attempt does not use a connection that might not be recoverable
+func (b *brokerConnection[C]) close() {
+	if !b.open {
+		return
+	}
+	if err := b.client.Close(); err != nil {
+		log.Debugf("%s: Failed to disconnect from %s: %s", b.es.spec.ID, b.broker, err)
+	}
+	var closed C
+	b.client, b.open = closed, false
+}
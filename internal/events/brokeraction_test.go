@@ -0,0 +1,388 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-amqp"
+	"github.com/Shopify/sarama"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+)
+
+type mqttPublished struct {
+	topic   string
+	qos     byte
+	payload []byte
+}
+
+// mockBrokerClient is the client of any of the broker types connected through a package var.
+// Each batch is recorded as it was passed to the client
+type mockBrokerClient struct {
+	sent    []interface{}
+	sendErr error
+	lost    bool
+	closed  bool
+}
+
+func (m *mockBrokerClient) send(batch interface{}) error {
+	if m.sendErr != nil {
+		return m.sendErr
+	}
+	m.sent = append(m.sent, batch)
+	return nil
+}
+
+func (m *mockBrokerClient) SendMessages(msgs []*sarama.ProducerMessage) error {
+	return m.send(msgs)
+}
+
+func (m *mockBrokerClient) Publish(ctx context.Context, topic string, qos byte, payload []byte) error {
+	return m.send(&mqttPublished{topic: topic, qos: qos, payload: payload})
+}
+
+func (m *mockBrokerClient) SendBatch(ctx context.Context, msgs []*amqp.Message) error {
+	return m.send(msgs)
+}
+
+func (m *mockBrokerClient) PublishBatch(ctx context.Context, msgs []*nats.Msg) ([]*nats.PubAck, error) {
+	if err := m.send(msgs); err != nil {
+		return nil, err
+	}
+	acks := make([]*nats.PubAck, len(msgs))
+	for i := range msgs {
+		acks[i] = &nats.PubAck{Stream: "EVENTS", Sequence: uint64(i + 1)}
+	}
+	return acks, nil
+}
+
+func (m *mockBrokerClient) IsConnectionOpen() bool {
+	return !m.lost
+}
+
+func (m *mockBrokerClient) IsConnected() bool {
+	return !m.lost
+}
+
+func (m *mockBrokerClient) Close() error {
+	m.closed = true
+	return nil
+}
+
+// mockBrokerClients connects the actions to the clients in turn, and then fails to connect.
+// The options the clients were connected with are returned
+func mockBrokerClients(t *testing.T, clients ...*mockBrokerClient) *[]interface{} {
+	var opts []interface{}
+	next := func(o interface{}) (*mockBrokerClient, error) {
+		if len(clients) == 0 {
+			return nil, fmt.Errorf("pop")
+		}
+		opts = append(opts, o)
+		c := clients[0]
+		clients = clients[1:]
+		return c, nil
+	}
+	savedKafka, savedMQTT, savedAMQP, savedNATS := newKafkaProducer, connectMQTT, connectAMQP, connectNATS
+	newKafkaProducer = func(brokers []string, config *sarama.Config) (kafkaProducer, error) {
+		c, err := next(config)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	connectMQTT = func(ctx context.Context, o *paho.ClientOptions) (mqttClient, error) {
+		c, err := next(o)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	connectAMQP = func(ctx context.Context, o *amqpConnectOptions) (amqpSender, error) {
+		c, err := next(o)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	connectNATS = func(ctx context.Context, o *nats.Options) (natsClient, error) {
+		c, err := next(o)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	t.Cleanup(func() {
+		newKafkaProducer, connectMQTT, connectAMQP, connectNATS = savedKafka, savedMQTT, savedAMQP, savedNATS
+	})
+	return &opts
+}
+
+type testBrokerAction interface {
+	eventStreamAction
+	connectedAction
+	connected() bool
+}
+
+func newTestBrokerAction(spec *StreamInfo) (testBrokerAction, error) {
+	if spec.ID == "" {
+		spec.ID = "es-1"
+	}
+	action, err := brokerTypes[spec.Type].newAction(&eventStream{spec: spec}, spec)
+	if err != nil {
+		return nil, err
+	}
+	return action.(testBrokerAction), nil
+}
+
+type testBroker struct {
+	streamType string
+	// settings returns valid settings, to connect to the address for the types not mocked
+	settings func(address string) *StreamInfo
+	// missing is the error of a stream without settings
+	missing string
+	// invalidUpdate fails validation with the invalid error
+	invalidUpdate *StreamInfo
+	invalid       string
+	// update sets the request timeout to 10
+	update         *StreamInfo
+	requestTimeout func(spec *StreamInfo) uint32
+	tls            func(spec *StreamInfo) **actionTLSInfo
+	// the errors of a failed connection, and of a failed batch
+	connectFailed string
+	sendFailed    string
+	mocked        bool
+	detectsLost   bool
+}
+
+func testBrokers() []*testBroker {
+	return []*testBroker{
+		{
+			streamType: EventStreamTypeKafka,
+			settings: func(string) *StreamInfo {
+				return &StreamInfo{Type: EventStreamTypeKafka, Kafka: &kafkaActionInfo{Brokers: []string{"broker:9092"}, Topic: "events"}}
+			},
+			missing:        "Must specify kafka.brokers",
+			invalidUpdate:  &StreamInfo{Kafka: &kafkaActionInfo{PartitionKey: "txid"}},
+			invalid:        "Invalid partition key 'txid'",
+			update:         &StreamInfo{Kafka: &kafkaActionInfo{RequestTimeoutSec: 10}},
+			requestTimeout: func(spec *StreamInfo) uint32 { return spec.Kafka.RequestTimeoutSec },
+			tls:            func(spec *StreamInfo) **actionTLSInfo { return &spec.Kafka.TLS },
+			connectFailed:  "es-1: Failed to connect to Kafka: pop",
+			sendFailed:     "es-1: Failed to publish to Kafka topic 'events': pop",
+			mocked:         true,
+		},
+		{
+			streamType: EventStreamTypeMQTT,
+			settings: func(string) *StreamInfo {
+				return &StreamInfo{Type: EventStreamTypeMQTT, MQTT: &mqttActionInfo{BrokerURL: "tcp://broker:1883", Topic: "events"}}
+			},
+			missing:        "Must specify mqtt.brokerURL",
+			invalidUpdate:  &StreamInfo{MQTT: &mqttActionInfo{Topic: "events/#"}},
+			invalid:        "Invalid MQTT topic 'events/#'",
+			update:         &StreamInfo{MQTT: &mqttActionInfo{RequestTimeoutSec: 10}},
+			requestTimeout: func(spec *StreamInfo) uint32 { return spec.MQTT.RequestTimeoutSec },
+			tls:            func(spec *StreamInfo) **actionTLSInfo { return &spec.MQTT.TLS },
+			connectFailed:  "es-1: Failed to connect to MQTT broker: pop",
+			sendFailed:     "es-1: Failed to publish to MQTT topic 'events': pop",
+			mocked:         true,
+			detectsLost:    true,
+		},
+		{
+			streamType: EventStreamTypeAMQP,
+			settings: func(string) *StreamInfo {
+				return &StreamInfo{Type: EventStreamTypeAMQP, AMQP: &amqpActionInfo{URL: "amqp://broker", Address: "events"}}
+			},
+			missing:        "Must specify amqp.url",
+			invalidUpdate:  &StreamInfo{AMQP: &amqpActionInfo{URL: "http://broker"}},
+			invalid:        "Invalid AMQP broker URL 'http://broker'",
+			update:         &StreamInfo{AMQP: &amqpActionInfo{RequestTimeoutSec: 10}},
+			requestTimeout: func(spec *StreamInfo) uint32 { return spec.AMQP.RequestTimeoutSec },
+			tls:            func(spec *StreamInfo) **actionTLSInfo { return &spec.AMQP.TLS },
+			connectFailed:  "es-1: Failed to connect to AMQP broker: pop",
+			sendFailed:     "es-1: Failed to send to AMQP address 'events': pop",
+			mocked:         true,
+			detectsLost:    true,
+		},
+		{
+			streamType: EventStreamTypeNATS,
+			settings: func(string) *StreamInfo {
+				return &StreamInfo{Type: EventStreamTypeNATS, NATS: &natsActionInfo{URL: "nats://nats", Subject: "events"}}
+			},
+			missing:        "Must specify nats.url",
+			invalidUpdate:  &StreamInfo{NATS: &natsActionInfo{Subject: "events.*"}},
+			invalid:        "Invalid NATS subject 'events.\\*'",
+			update:         &StreamInfo{NATS: &natsActionInfo{RequestTimeoutSec: 10}},
+			requestTimeout: func(spec *StreamInfo) uint32 { return spec.NATS.RequestTimeoutSec },
+			tls:            func(spec *StreamInfo) **actionTLSInfo { return &spec.NATS.TLS },
+			connectFailed:  "es-1: Failed to connect to NATS server: pop",
+			sendFailed:     "es-1: Failed to publish to NATS subject 'events': pop",
+			mocked:         true,
+			detectsLost:    true,
+		},
+		{
+			streamType: EventStreamTypeGRPC,
+			settings: func(address string) *StreamInfo {
+				return &StreamInfo{Type: EventStreamTypeGRPC, GRPC: &grpcActionInfo{Address: address}}
+			},
+			missing:        "Must specify grpc.address",
+			invalidUpdate:  &StreamInfo{GRPC: &grpcActionInfo{TLS: &actionTLSInfo{Enabled: true, ClientCertsFile: "cert.pem"}}},
+			invalid:        "Client private key and certificate must both be provided",
+			update:         &StreamInfo{GRPC: &grpcActionInfo{RequestTimeoutSec: 10}},
+			requestTimeout: func(spec *StreamInfo) uint32 { return spec.GRPC.RequestTimeoutSec },
+			tls:            func(spec *StreamInfo) **actionTLSInfo { return &spec.GRPC.TLS },
+		},
+	}
+}
+
+func TestBrokerValidateConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, bt := range testBrokers() {
+		_, err := newTestBrokerAction(&StreamInfo{Type: bt.streamType})
+		assert.Regexp(bt.missing, err, bt.streamType)
+
+		spec := bt.settings("consumer:9000")
+		*bt.tls(spec) = &actionTLSInfo{Enabled: true, ClientKeyFile: "key.pem"}
+		_, err = newTestBrokerAction(spec)
+		assert.Error(err, bt.streamType)
+
+		spec = bt.settings("consumer:9000")
+		action, err := newTestBrokerAction(spec)
+		assert.NoError(err, bt.streamType)
+		assert.NotZero(bt.requestTimeout(spec), bt.streamType)
+		assert.False(action.connected(), bt.streamType)
+		// closing an action that is not connected does nothing
+		action.close()
+	}
+}
+
+func TestBrokerAttemptBatch(t *testing.T) {
+	assert := assert.New(t)
+	events := []*eventsapi.EventEntry{{SubID: "sb-1", EventName: "Created"}}
+
+	for _, bt := range testBrokers() {
+		if !bt.mocked {
+			continue
+		}
+		first, second, third := &mockBrokerClient{}, &mockBrokerClient{}, &mockBrokerClient{}
+		clients := []*mockBrokerClient{first, second}
+		if bt.detectsLost {
+			clients = append(clients, third)
+		}
+		opts := mockBrokerClients(t, clients...)
+		spec := bt.settings("")
+		action, err := newTestBrokerAction(spec)
+		assert.NoError(err, bt.streamType)
+
+		// the first batch connects, and the connection is kept for the next
+		assert.NoError(action.attemptBatch(context.Background(), 1, 1, events), bt.streamType)
+		assert.NoError(action.attemptBatch(context.Background(), 2, 1, events), bt.streamType)
+		assert.Equal(1, len(*opts), bt.streamType)
+		assert.Equal(2, len(first.sent), bt.streamType)
+		assert.True(action.connected(), bt.streamType)
+
+		// a failed batch disconnects, and the next attempt reconnects
+		first.sendErr = fmt.Errorf("pop")
+		err = action.attemptBatch(context.Background(), 3, 1, events)
+		assert.Regexp(bt.sendFailed, err, bt.streamType)
+		assert.True(first.closed, bt.streamType)
+		assert.False(action.connected(), bt.streamType)
+		assert.NoError(action.attemptBatch(context.Background(), 3, 2, events), bt.streamType)
+		assert.Equal(1, len(second.sent), bt.streamType)
+		assert.Equal(2, len(*opts), bt.streamType)
+
+		// a client that can tell it lost its connection is replaced before it is used
+		if bt.detectsLost {
+			second.lost = true
+			assert.NoError(action.attemptBatch(context.Background(), 4, 1, events), bt.streamType)
+			assert.True(second.closed, bt.streamType)
+			assert.Equal(1, len(third.sent), bt.streamType)
+		}
+
+		action.close()
+		assert.False(action.connected(), bt.streamType)
+		err = action.attemptBatch(context.Background(), 5, 1, events)
+		assert.Regexp(bt.connectFailed, err, bt.streamType)
+
+		*bt.tls(spec) = &actionTLSInfo{Enabled: true, CACertsFile: "/does/not/exist.pem"}
+		err = action.attemptBatch(context.Background(), 5, 2, events)
+		assert.Regexp("Failed to load the TLS certificates", err, bt.streamType)
+	}
+}
+
+func TestBrokerStreamAddAndUpdate(t *testing.T) {
+	assert := assert.New(t)
+	events := []*eventsapi.EventEntry{{SubID: "sb-1"}}
+
+	for _, bt := range testBrokers() {
+		sm := newTestSubscriptionManager()
+		_, restErr := sm.AddStream(nil, httptest.NewRequest("POST", "/eventstreams", strings.NewReader(`{"type":"`+bt.streamType+`"}`)), nil)
+		assert.Equal(400, restErr.StatusCode, bt.streamType)
+		assert.Regexp(bt.missing, restErr.Error, bt.streamType)
+
+		// the type is not case sensitive, and the defaults of the settings are set
+		spec := bt.settings("consumer:9000")
+		spec.Type = strings.ToUpper(spec.Type)
+		body, _ := json.Marshal(spec)
+		spec, restErr = sm.AddStream(nil, httptest.NewRequest("POST", "/eventstreams?validateOnly=true", strings.NewReader(string(body))), nil)
+		assert.Nil(restErr, bt.streamType)
+		assert.Equal(bt.streamType, spec.Type)
+		assert.NotZero(bt.requestTimeout(spec), bt.streamType)
+
+		address := ""
+		if bt.mocked {
+			mockBrokerClients(t, &mockBrokerClient{}, &mockBrokerClient{})
+		} else {
+			address = newTestGRPCConsumer(t, ackBatch).listener.Addr().String()
+		}
+		spec = bt.settings(address)
+		spec.ID = "es-1"
+		stream, err := newEventStream(&mockSubMgr{}, spec, nil)
+		assert.NoError(err, bt.streamType)
+		action := stream.action.(testBrokerAction)
+		assert.NoError(action.attemptBatch(context.Background(), 1, 1, events), bt.streamType)
+
+		_, err = stream.update(bt.invalidUpdate)
+		assert.Regexp(bt.invalid, err, bt.streamType)
+		assert.True(action.connected(), bt.streamType)
+
+		// the settings are merged into those the action holds, and the next batch connects with them
+		_, err = stream.update(bt.update)
+		assert.NoError(err, bt.streamType)
+		assert.Equal(uint32(10), bt.requestTimeout(stream.spec), bt.streamType)
+		assert.NoError(brokerTypes[bt.streamType].validate(stream.spec), bt.streamType)
+		assert.False(action.connected(), bt.streamType)
+		assert.NoError(action.attemptBatch(context.Background(), 2, 1, events), bt.streamType)
+
+		// updates that do not change the settings keep the connection
+		_, err = stream.update(bt.update)
+		assert.NoError(err, bt.streamType)
+		assert.True(action.connected(), bt.streamType)
+
+		// the connection is closed when the stream is stopped
+		stream.stop()
+		assert.False(action.connected(), bt.streamType)
+	}
+}
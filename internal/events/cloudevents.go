@@ -0,0 +1,98 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/events/api"
+)
+
+const (
+	// EventFormatCloudEvents wraps each event in a CloudEvents 1.0 envelope
+	EventFormatCloudEvents = "cloudevents"
+
+	cloudEventsSpecVersion = "1.0"
+	cloudEventType         = "io.hyperledger.fabconnect.event"
+	// content type of a webhook request in the batched mode of the CloudEvents HTTP binding
+	cloudEventsBatchContentType = "application/cloudevents-batch+json"
+	// content type of a webhook request in the structured mode, with a single event
+	cloudEventsContentType = "application/cloudevents+json"
+)
+
+// cloudEvent is the structured JSON form of a CloudEvent, with the event as its data
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            string          `json:"time,omitempty"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            *api.EventEntry `json:"data"`
+}
+
+// validateStreamFormat checks the format is supported for the type of the stream, and returns
+// it normalized to lower case. The avro format needs the URL of the schema registry
+func validateStreamFormat(format, streamType, registryURL string) (string, error) {
+	if format == "" {
+		return "", nil
+	}
+	format = strings.ToLower(format)
+	switch format {
+	case EventFormatCloudEvents:
+		if streamType != EventStreamTypeWebhook && streamType != EventStreamTypeWebsocket {
+			return "", errors.Errorf(errors.EventStreamsFormatNotSupported, format)
+		}
+	case EventFormatAvro:
+		if streamType != EventStreamTypeKafka {
+			return "", errors.Errorf(errors.EventStreamsAvroNotKafka)
+		}
+		if registryURL == "" {
+			return "", errors.Errorf(errors.EventStreamsAvroNoRegistry)
+		}
+	default:
+		return "", errors.Errorf(errors.EventStreamsInvalidFormat, format)
+	}
+	return format, nil
+}
+
+// toCloudEvents wraps the events of a batch in envelopes. The source is the subscription, and
+// the ID is the position of the event on the chain, so an event redelivered by a retry or a
+// restart has the same source and ID and can be detected as a duplicate by the consumer
+func toCloudEvents(events []*api.EventEntry) []*cloudEvent {
+	envelopes := make([]*cloudEvent, len(events))
+	for i, event := range events {
+		ce := &cloudEvent{
+			SpecVersion:     cloudEventsSpecVersion,
+			ID:              fmt.Sprintf("%d-%d-%d", event.BlockNumber, event.TransactionIndex, event.EventIndex),
+			Source:          "/subscriptions/" + event.SubID,
+			Type:            cloudEventType,
+			Subject:         event.EventName,
+			DataContentType: "application/json",
+			Data:            event,
+		}
+		if event.Timestamp > 0 {
+			ce.Time = time.Unix(0, event.Timestamp).UTC().Format(time.RFC3339Nano)
+		}
+		envelopes[i] = ce
+	}
+	return envelopes
+}
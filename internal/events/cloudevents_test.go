@@ -0,0 +1,168 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func testCloudEventsBatch() []*eventsapi.EventEntry {
+	return []*eventsapi.EventEntry{
+		{SubID: "sb-1", ChaincodeID: "asset_transfer", BlockNumber: 10, TransactionID: "tx1", TransactionIndex: 1, EventIndex: 2, EventName: "Created", Payload: map[string]interface{}{"id": "asset1"}, Timestamp: 1690000000123456789},
+		{SubID: "sb-2", BlockNumber: 11},
+	}
+}
+
+func TestValidateStreamFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	format, err := validateStreamFormat("", EventStreamTypeKafka, "")
+	assert.NoError(err)
+	assert.Equal("", format)
+	format, err = validateStreamFormat("CloudEvents", EventStreamTypeWebhook, "")
+	assert.NoError(err)
+	assert.Equal(EventFormatCloudEvents, format)
+	_, err = validateStreamFormat("cloudevents", EventStreamTypeWebsocket, "")
+	assert.NoError(err)
+	_, err = validateStreamFormat("xml", EventStreamTypeWebhook, "")
+	assert.Regexp("Unknown format 'xml'", err)
+	_, err = validateStreamFormat("cloudevents", EventStreamTypeKafka, "")
+	assert.Regexp("only supported for event streams of type 'webhook' or 'websocket'", err)
+	format, err = validateStreamFormat("Avro", EventStreamTypeKafka, "http://registry:8081")
+	assert.NoError(err)
+	assert.Equal(EventFormatAvro, format)
+	_, err = validateStreamFormat("avro", EventStreamTypeWebhook, "http://registry:8081")
+	assert.Regexp("only supported for event streams of type 'kafka'", err)
+	_, err = validateStreamFormat("avro", EventStreamTypeKafka, "")
+	assert.Regexp("requires a schema registry", err)
+}
+
+func TestToCloudEvents(t *testing.T) {
+	assert := assert.New(t)
+	events := testCloudEventsBatch()
+
+	envelopes := toCloudEvents(events)
+	assert.Equal(2, len(envelopes))
+	assert.Equal("1.0", envelopes[0].SpecVersion)
+	assert.Equal("10-1-2", envelopes[0].ID)
+	assert.Equal("/subscriptions/sb-1", envelopes[0].Source)
+	assert.Equal("io.hyperledger.fabconnect.event", envelopes[0].Type)
+	assert.Equal("Created", envelopes[0].Subject)
+	assert.Equal("2023-07-22T04:26:40.123456789Z", envelopes[0].Time)
+	assert.Same(events[0], envelopes[0].Data)
+
+	b, err := json.Marshal(envelopes[1])
+	assert.NoError(err)
+	var ce map[string]interface{}
+	err = json.Unmarshal(b, &ce)
+	assert.NoError(err)
+	assert.Equal("11-0-0", ce["id"])
+	assert.Equal("application/json", ce["datacontenttype"])
+	assert.NotContains(ce, "subject")
+	assert.NotContains(ce, "time")
+	assert.Equal(float64(11), ce["data"].(map[string]interface{})["blockNumber"])
+}
+
+func TestWebhookCloudEvents(t *testing.T) {
+	assert := assert.New(t)
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan []map[string]interface{}, 1)
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var body []map[string]interface{}
+		_ = json.NewDecoder(req.Body).Decode(&body)
+		requests <- req
+		bodies <- body
+	}))
+	defer svr.Close()
+
+	es := &eventStream{
+		sm:              &mockSubMgr{},
+		allowPrivateIPs: true,
+		spec:            &StreamInfo{ID: "es-1", Type: EventStreamTypeWebhook, Format: EventFormatCloudEvents},
+	}
+	action, err := newWebhookAction(es, &webhookActionInfo{URL: svr.URL})
+	assert.NoError(err)
+	err = action.attemptBatch(context.Background(), 1, 1, testCloudEventsBatch())
+	assert.NoError(err)
+
+	req := <-requests
+	assert.Equal("application/cloudevents-batch+json", req.Header.Get("Content-Type"))
+	body := <-bodies
+	assert.Equal(2, len(body))
+	assert.Equal("10-1-2", body[0]["id"])
+	assert.Equal("Created", body[0]["data"].(map[string]interface{})["eventName"])
+}
+
+func TestWebSocketCloudEvents(t *testing.T) {
+	assert := assert.New(t)
+	mws := newMockWebSocket()
+	es := &eventStream{
+		spec:       &StreamInfo{ID: "es-1", Type: EventStreamTypeWebsocket, Format: EventFormatCloudEvents},
+		wsChannels: mws,
+	}
+	action, err := newWebSocketAction(es, &webSocketActionInfo{Topic: "topic1"})
+	assert.NoError(err)
+
+	done := make(chan error)
+	go func() {
+		done <- action.attemptBatch(context.Background(), 1, 1, testCloudEventsBatch())
+	}()
+	envelopes := (<-mws.sender).([]*cloudEvent)
+	mws.receiver <- nil
+	assert.NoError(<-done)
+	assert.Equal(2, len(envelopes))
+	assert.Equal("/subscriptions/sb-2", envelopes[1].Source)
+}
+
+func TestStreamFormatAddAndUpdate(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+
+	_, restErr := sm.AddStream(nil, httptest.NewRequest("POST", "/eventstreams", strings.NewReader(`{"type":"kafka","kafka":{"brokers":["broker:9092"],"topic":"topic1"},"format":"cloudevents"}`)), nil)
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp("only supported for event streams of type 'webhook' or 'websocket'", restErr.Error)
+
+	spec, restErr := sm.AddStream(nil, httptest.NewRequest("POST", "/eventstreams?validateOnly=true", strings.NewReader(`{"type":"websocket","websocket":{"topic":"topic1"},"format":"CloudEvents"}`)), nil)
+	assert.Nil(restErr)
+	assert.Equal(EventFormatCloudEvents, spec.Format)
+
+	stream := newTestStream(&mockSubMgr{})
+	defer stream.stop()
+	_, err := stream.update(&StreamInfo{Format: "xml"})
+	assert.Regexp("Unknown format 'xml'", err)
+	_, err = stream.update(&StreamInfo{Format: "CloudEvents"})
+	assert.NoError(err)
+	assert.Equal(EventFormatCloudEvents, stream.spec.Format)
+
+	// a field missing from a replacement resets the format
+	replacement := *stream.spec
+	replacement.Format = ""
+	_, err = stream.replace(&replacement)
+	assert.NoError(err)
+	assert.Equal("", stream.spec.Format)
+	replacement.Format = "xml"
+	_, err = stream.replace(&replacement)
+	assert.Regexp("Unknown format 'xml'", err)
+}
@@ -0,0 +1,236 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	restutil "github.com/hyperledger/firefly-fabconnect/internal/rest/utils"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const (
+	// DeadLetterTypeWebhook posts abandoned batches to a second webhook
+	DeadLetterTypeWebhook = "webhook"
+	// DeadLetterTypeKVStore stores abandoned batches in the database of the gateway, where they are listed by the REST API
+	DeadLetterTypeKVStore = "kvstore"
+	// DeadLetterTypeKafka publishes each abandoned batch as a message to a Kafka topic
+	DeadLetterTypeKafka = "kafka"
+)
+
+// deadLetterInfo configures where a stream with the "skip" error handling writes the batches
+// it gives up on, instead of dropping them
+type deadLetterInfo struct {
+	Type    string             `json:"type,omitempty"`
+	Webhook *webhookActionInfo `json:"webhook,omitempty"`
+	Kafka   *kafkaActionInfo   `json:"kafka,omitempty"`
+}
+
+// DeadLetter is a batch a stream gave up on, with the failure of its last attempt, so the
+// events can be replayed later
+type DeadLetter struct {
+	ID          string                  `json:"id"`
+	Stream      string                  `json:"stream"`
+	BatchNumber uint64                  `json:"batchNumber"`
+	Attempts    int                     `json:"attempts"`
+	Error       string                  `json:"error"`
+	FailedAt    string                  `json:"failedAt"`
+	Events      []*eventsapi.EventEntry `json:"events"`
+}
+
+func validateDeadLetterConfig(spec *deadLetterInfo) error {
+	switch strings.ToLower(spec.Type) {
+	case DeadLetterTypeWebhook:
+		return validateWebhookConfig(spec.Webhook)
+	case DeadLetterTypeKafka:
+		return validateKafkaConfig(spec.Kafka)
+	case DeadLetterTypeKVStore:
+		return nil
+	default:
+		return errors.Errorf(errors.EventStreamsDeadLetterInvalidType, spec.Type)
+	}
+}
+
+// deadLetterSink writes the abandoned batches of a stream to its dead-letter destination,
+// reusing the webhook and Kafka actions to deliver them
+type deadLetterSink struct {
+	es      *eventStream
+	spec    *deadLetterInfo
+	webhook *webhookAction
+	kafka   *kafkaAction
+}
+
+// newDeadLetterSink returns nil if the stream does not have a dead-letter destination
+func newDeadLetterSink(es *eventStream, spec *deadLetterInfo) (d *deadLetterSink, err error) {
+	if spec == nil {
+		return nil, nil
+	}
+	if err := validateDeadLetterConfig(spec); err != nil {
+		return nil, err
+	}
+	spec.Type = strings.ToLower(spec.Type)
+	d = &deadLetterSink{es: es, spec: spec}
+	switch spec.Type {
+	case DeadLetterTypeWebhook:
+		d.webhook, err = newWebhookAction(es, spec.Webhook)
+	case DeadLetterTypeKafka:
+		d.kafka, err = newKafkaAction(es, spec.Kafka)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *deadLetterSink) write(ctx context.Context, dl *DeadLetter) error {
+	if d.spec.Type == DeadLetterTypeKVStore {
+		return d.es.sm.storeDeadLetter(dl)
+	}
+	b, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	if d.spec.Type == DeadLetterTypeWebhook {
+		return d.webhook.post(ctx, 1, b, "application/json", nil, nil)
+	}
+	var headers []sarama.RecordHeader
+	for h, v := range d.kafka.spec.Headers {
+		headers = append(headers, sarama.RecordHeader{Key: []byte(h), Value: []byte(v)})
+	}
+	return d.kafka.send(ctx, dl.BatchNumber, 1, []*sarama.ProducerMessage{{
+		Topic:   d.kafka.spec.Topic,
+		Key:     sarama.StringEncoder(dl.Stream),
+		Value:   sarama.ByteEncoder(b),
+		Headers: headers,
+	}})
+}
+
+// close disconnects the Kafka producer of the sink, if it has one
+func (d *deadLetterSink) close() {
+	if d != nil && d.kafka != nil {
+		d.kafka.close()
+	}
+}
+
+// writeDeadLetter records a batch that is being skipped after it failed, in the dead-letter
+// destination of the stream. It is only written once, so a batch is lost if that fails too
+func (a *eventStream) writeDeadLetter(ctx context.Context, batchNumber uint64, attempts int, batchErr error, events []*eventsapi.EventEntry) {
+	if a.deadLetter == nil {
+		log.Warnf("%s: Skipping %d events of batch %d, which failed after %d attempts", a.spec.ID, len(events), batchNumber, attempts)
+		return
+	}
+	failedAt := time.Now().UTC()
+	dl := &DeadLetter{
+		ID:          fmt.Sprintf("%020d-%d", failedAt.UnixNano(), batchNumber),
+		Stream:      a.spec.ID,
+		BatchNumber: batchNumber,
+		Attempts:    attempts,
+		Error:       batchErr.Error(),
+		FailedAt:    failedAt.Format(time.RFC3339Nano),
+		Events:      events,
+	}
+	if err := a.deadLetter.write(ctx, dl); err != nil {
+		log.Errorf("%s: Failed to write batch %d to the %s dead-letter destination, %d events are lost: %s", a.spec.ID, batchNumber, a.deadLetter.spec.Type, len(events), err)
+		atomic.AddUint64(&a.counters.deadLetterFailures, 1)
+		return
+	}
+	log.Infof("%s: Wrote batch %d to the %s dead-letter destination. ID=%s", a.spec.ID, batchNumber, a.deadLetter.spec.Type, dl.ID)
+	atomic.AddUint64(&a.counters.deadLetters, 1)
+}
+
+func deadLetterKey(streamID, id string) string {
+	return deadLetterIDPrefix + streamID + "/" + id
+}
+
+func (s *subscriptionMGR) storeDeadLetter(dl *DeadLetter) error {
+	b, _ := json.Marshal(dl)
+	return s.db.Put(deadLetterKey(dl.Stream, dl.ID), b)
+}
+
+// loadDeadLetters returns the dead letters stored for a stream, oldest first
+func (s *subscriptionMGR) loadDeadLetters(streamID string) ([]*DeadLetter, error) {
+	deadLetters := []*DeadLetter{}
+	it := s.db.NewIteratorWithRange(util.BytesPrefix([]byte(deadLetterKey(streamID, ""))))
+	defer it.Release()
+	for it.Next() {
+		var dl DeadLetter
+		if err := json.Unmarshal(it.Value(), &dl); err != nil {
+			return nil, err
+		}
+		deadLetters = append(deadLetters, &dl)
+	}
+	return deadLetters, nil
+}
+
+// deleteDeadLetters removes the dead letters of a stream that is deleted
+func (s *subscriptionMGR) deleteDeadLetters(streamID string) {
+	deadLetters, err := s.loadDeadLetters(streamID)
+	if err != nil {
+		log.Errorf("Failed to load dead letters of stream %s: %s", streamID, err)
+		return
+	}
+	for _, dl := range deadLetters {
+		if err := s.db.Delete(deadLetterKey(streamID, dl.ID)); err != nil {
+			log.Errorf("Failed to delete dead letter %s from database. %s", dl.ID, err)
+		}
+	}
+}
+
+// DeadLetters lists the batches a stream with the "kvstore" dead-letter destination has given up on
+func (s *subscriptionMGR) DeadLetters(_ http.ResponseWriter, _ *http.Request, params httprouter.Params) ([]*DeadLetter, *restutil.RestError) {
+	streamID := params.ByName("streamId")
+	if _, err := s.streamByID(streamID); err != nil {
+		return nil, restutil.NewRestError(err.Error(), 404)
+	}
+	deadLetters, err := s.loadDeadLetters(streamID)
+	if err != nil {
+		return nil, restutil.NewRestError(err.Error(), 500)
+	}
+	return deadLetters, nil
+}
+
+// DeleteDeadLetter removes a dead letter, once its events have been replayed
+func (s *subscriptionMGR) DeleteDeadLetter(_ http.ResponseWriter, _ *http.Request, params httprouter.Params) (*map[string]string, *restutil.RestError) {
+	streamID := params.ByName("streamId")
+	if _, err := s.streamByID(streamID); err != nil {
+		return nil, restutil.NewRestError(err.Error(), 404)
+	}
+	id := params.ByName("deadLetterId")
+	key := deadLetterKey(streamID, id)
+	if _, err := s.db.Get(key); err != nil {
+		return nil, restutil.NewRestError(errors.Errorf(errors.EventStreamsDeadLetterNotFound, id, streamID).Error(), 404)
+	}
+	if err := s.db.Delete(key); err != nil {
+		return nil, restutil.NewRestError(err.Error(), 500)
+	}
+	result := map[string]string{}
+	result["id"] = id
+	result["deleted"] = strconv.FormatBool(true)
+	return &result, nil
+}
@@ -0,0 +1,186 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/hyperledger/firefly-fabconnect/internal/kvstore"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDeadLetterStream(t *testing.T, sm *mockSubMgr, deadLetter *deadLetterInfo) *eventStream {
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(500)
+	}))
+	t.Cleanup(svr.Close)
+	stream, err := newEventStream(sm, &StreamInfo{
+		ID:            "es-1",
+		Type:          EventStreamTypeWebhook,
+		ErrorHandling: ErrorHandlingSkip,
+		Webhook:       &webhookActionInfo{URL: svr.URL},
+		DeadLetter:    deadLetter,
+	}, nil)
+	assert.NoError(t, err)
+	stream.allowPrivateIPs = true
+	t.Cleanup(stream.stop)
+	return stream
+}
+
+func TestDeadLetterValidation(t *testing.T) {
+	assert := assert.New(t)
+	assert.NoError(validateDeadLetterConfig(&deadLetterInfo{Type: "KVStore"}))
+	assert.Regexp("Invalid deadLetter.type 'file'", validateDeadLetterConfig(&deadLetterInfo{Type: "file"}))
+	assert.Regexp("Must specify webhook.url", validateDeadLetterConfig(&deadLetterInfo{Type: "webhook"}))
+	assert.Regexp("Must specify kafka.brokers", validateDeadLetterConfig(&deadLetterInfo{Type: "kafka"}))
+
+	sm := newTestSubscriptionManager()
+	_, restErr := sm.AddStream(nil, httptest.NewRequest("POST", "/eventstreams", strings.NewReader(`{"type":"websocket","websocket":{"topic":"t1"},"deadLetter":{"type":"file"}}`)), nil)
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp("Invalid deadLetter.type", restErr.Error)
+
+	stream := newTestStream(&mockSubMgr{})
+	defer stream.stop()
+	_, err := stream.update(&StreamInfo{DeadLetter: &deadLetterInfo{Type: "file"}})
+	assert.Regexp("Invalid deadLetter.type", err)
+	_, err = stream.update(&StreamInfo{DeadLetter: &deadLetterInfo{Type: "KVStore"}})
+	assert.NoError(err)
+	assert.Equal(DeadLetterTypeKVStore, stream.spec.DeadLetter.Type)
+	assert.NotNil(stream.deadLetter)
+
+	// a replacement with an invalid dead letter fails, and keeps the sink of the stream
+	sink := stream.deadLetter
+	newSpec := *stream.spec
+	newSpec.DeadLetter = &deadLetterInfo{Type: "webhook"}
+	_, err = stream.replace(&newSpec)
+	assert.Regexp("Must specify webhook.url", err)
+	assert.Equal(sink, stream.deadLetter)
+	assert.Equal(DeadLetterTypeKVStore, stream.spec.DeadLetter.Type)
+}
+
+func TestDeadLetterKVStore(t *testing.T) {
+	assert := assert.New(t)
+	sm := &mockSubMgr{}
+	stream := newTestDeadLetterStream(t, sm, &deadLetterInfo{Type: DeadLetterTypeKVStore})
+
+	stream.processBatch(context.Background(), 3, []*eventData{testEvent("sb-1"), testEvent("sb-2")})
+	assert.Equal(1, len(sm.deadLetters))
+	dl := sm.deadLetters[0]
+	assert.Equal("es-1", dl.Stream)
+	assert.Equal(uint64(3), dl.BatchNumber)
+	assert.Equal(1, dl.Attempts)
+	assert.Regexp("Failed with status=500", dl.Error)
+	assert.Equal(2, len(dl.Events))
+	assert.Regexp("-3$", dl.ID)
+	assert.Equal(uint64(1), stream.counters.deadLetters)
+
+	// a batch is still skipped when it cannot be written
+	sm.err = fmt.Errorf("pop")
+	stream.processBatch(context.Background(), 4, []*eventData{testEvent("sb-1")})
+	assert.Equal(uint64(1), stream.counters.deadLetters)
+	assert.Equal(uint64(1), stream.counters.deadLetterFailures)
+}
+
+func TestDeadLetterWebhook(t *testing.T) {
+	assert := assert.New(t)
+	deadLetters := make(chan *DeadLetter, 1)
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var dl DeadLetter
+		_ = json.NewDecoder(req.Body).Decode(&dl)
+		assert.Equal("dlq", req.Header.Get("X-Queue"))
+		deadLetters <- &dl
+	}))
+	defer svr.Close()
+
+	stream := newTestDeadLetterStream(t, &mockSubMgr{}, &deadLetterInfo{
+		Type:    "Webhook",
+		Webhook: &webhookActionInfo{URL: svr.URL, Headers: map[string]string{"X-Queue": "dlq"}},
+	})
+	stream.processBatch(context.Background(), 1, []*eventData{testEvent("sb-1")})
+	dl := <-deadLetters
+	assert.Equal("es-1", dl.Stream)
+	assert.Equal("sb-1", dl.Events[0].SubID)
+	assert.Equal(uint64(1), stream.counters.deadLetters)
+}
+
+func TestDeadLetterKafka(t *testing.T) {
+	assert := assert.New(t)
+	producer := &mockBrokerClient{}
+	mockBrokerClients(t, producer)
+
+	stream := newTestDeadLetterStream(t, &mockSubMgr{}, &deadLetterInfo{
+		Type:  DeadLetterTypeKafka,
+		Kafka: &kafkaActionInfo{Brokers: []string{"broker:9092"}, Topic: "dlq"},
+	})
+	stream.processBatch(context.Background(), 1, []*eventData{testEvent("sb-1")})
+	assert.Equal(1, len(producer.sent))
+	msg := producer.sent[0].([]*sarama.ProducerMessage)[0]
+	assert.Equal("dlq", msg.Topic)
+	key, _ := msg.Key.Encode()
+	assert.Equal("es-1", string(key))
+	value, _ := msg.Value.Encode()
+	var dl DeadLetter
+	assert.NoError(json.Unmarshal(value, &dl))
+	assert.Equal("sb-1", dl.Events[0].SubID)
+
+	stream.deadLetter.close()
+	assert.True(producer.closed)
+}
+
+func TestDeadLetterAPI(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	db := kvstore.NewLDBKeyValueStore(dir)
+	_ = db.Init()
+	defer db.Close()
+
+	sm := newTestSubscriptionManager()
+	sm.db = db
+	sm.streams["es-1"] = &eventStream{spec: &StreamInfo{ID: "es-1"}}
+	assert.NoError(sm.storeDeadLetter(&DeadLetter{ID: "00000000000000000002-1", Stream: "es-1"}))
+	assert.NoError(sm.storeDeadLetter(&DeadLetter{ID: "00000000000000000001-1", Stream: "es-1"}))
+	assert.NoError(sm.storeDeadLetter(&DeadLetter{ID: "00000000000000000001-1", Stream: "es-10"}))
+
+	params := httprouter.Params{{Key: "streamId", Value: "es-1"}}
+	deadLetters, restErr := sm.DeadLetters(nil, nil, params)
+	assert.Nil(restErr)
+	assert.Equal(2, len(deadLetters))
+	assert.Equal("00000000000000000001-1", deadLetters[0].ID)
+
+	result, restErr := sm.DeleteDeadLetter(nil, nil, append(params, httprouter.Param{Key: "deadLetterId", Value: "00000000000000000001-1"}))
+	assert.Nil(restErr)
+	assert.Equal("true", (*result)["deleted"])
+	_, restErr = sm.DeleteDeadLetter(nil, nil, append(params, httprouter.Param{Key: "deadLetterId", Value: "00000000000000000001-1"}))
+	assert.Equal(404, restErr.StatusCode)
+	_, restErr = sm.DeadLetters(nil, nil, httprouter.Params{{Key: "streamId", Value: "es-2"}})
+	assert.Equal(404, restErr.StatusCode)
+
+	sm.deleteDeadLetters("es-1")
+	deadLetters, _ = sm.loadDeadLetters("es-1")
+	assert.Empty(deadLetters)
+	deadLetters, _ = sm.loadDeadLetters("es-10")
+	assert.Equal(1, len(deadLetters))
+}
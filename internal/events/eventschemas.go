@@ -0,0 +1,221 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	jsonschema "github.com/xeipuuv/gojsonschema"
+)
+
+const (
+	schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+	schemaRegistryTimeout     = 30 * time.Second
+
+	schemaTypeJSON = "JSON"
+	schemaTypeAvro = "AVRO"
+)
+
+type eventSchema struct {
+	info   *api.EventSchemaInfo
+	schema *jsonschema.Schema
+}
+
+// eventSchemas holds the JSON Schemas registered for chaincode events. It is read by
+// the event processors of all subscriptions, while schemas are added and removed over REST
+type eventSchemas struct {
+	mux      sync.RWMutex
+	byID     map[string]*eventSchema
+	byEvent  map[string]*eventSchema
+	registry *schemaRegistryClient
+}
+
+func newEventSchemas(registryConf *conf.SchemaRegistryConf) *eventSchemas {
+	es := &eventSchemas{
+		byID:    make(map[string]*eventSchema),
+		byEvent: make(map[string]*eventSchema),
+	}
+	if registryConf.URL != "" {
+		es.registry = newSchemaRegistryClient(registryConf)
+	}
+	return es
+}
+
+func eventSchemaKey(chaincodeID, eventName string) string {
+	return chaincodeID + "/" + eventName
+}
+
+func defaultSchemaSubject(info *api.EventSchemaInfo) string {
+	return info.ChaincodeID + "-" + info.EventName
+}
+
+func compileEventSchema(info *api.EventSchemaInfo) (*eventSchema, error) {
+	if info.ChaincodeID == "" {
+		return nil, errors.Errorf(errors.EventSchemaInvalid, `missing required parameter "chaincodeId"`)
+	}
+	if info.EventName == "" {
+		return nil, errors.Errorf(errors.EventSchemaInvalid, `missing required parameter "eventName"`)
+	}
+	if len(info.Schema) == 0 {
+		return nil, errors.Errorf(errors.EventSchemaInvalid, `missing required parameter "schema"`)
+	}
+	schema, err := jsonschema.NewSchema(jsonschema.NewBytesLoader(info.Schema))
+	if err != nil {
+		return nil, errors.Errorf(errors.EventSchemaInvalid, err)
+	}
+	return &eventSchema{info: info, schema: schema}, nil
+}
+
+// check fails if a schema is already registered for the same chaincode event
+func (es *eventSchemas) check(info *api.EventSchemaInfo) error {
+	es.mux.RLock()
+	defer es.mux.RUnlock()
+	if existing, exists := es.byEvent[eventSchemaKey(info.ChaincodeID, info.EventName)]; exists {
+		return errors.Errorf(errors.EventSchemaDuplicate, info.EventName, info.ChaincodeID, existing.info.ID)
+	}
+	return nil
+}
+
+func (es *eventSchemas) add(schema *eventSchema) {
+	es.mux.Lock()
+	defer es.mux.Unlock()
+	es.byID[schema.info.ID] = schema
+	es.byEvent[eventSchemaKey(schema.info.ChaincodeID, schema.info.EventName)] = schema
+}
+
+func (es *eventSchemas) remove(id string) {
+	es.mux.Lock()
+	defer es.mux.Unlock()
+	if schema, exists := es.byID[id]; exists {
+		delete(es.byID, id)
+		delete(es.byEvent, eventSchemaKey(schema.info.ChaincodeID, schema.info.EventName))
+	}
+}
+
+func (es *eventSchemas) getByID(id string) (*api.EventSchemaInfo, error) {
+	es.mux.RLock()
+	defer es.mux.RUnlock()
+	schema, exists := es.byID[id]
+	if !exists {
+		return nil, errors.Errorf(errors.EventSchemaNotFound, id)
+	}
+	return schema.info, nil
+}
+
+func (es *eventSchemas) list() []*api.EventSchemaInfo {
+	es.mux.RLock()
+	defer es.mux.RUnlock()
+	l := make([]*api.EventSchemaInfo, 0, len(es.byID))
+	for _, schema := range es.byID {
+		l = append(l, schema.info)
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].ID < l[j].ID })
+	return l
+}
+
+func (es *eventSchemas) forEvent(chaincodeID, eventName string) *eventSchema {
+	if eventName == "" {
+		return nil
+	}
+	es.mux.RLock()
+	defer es.mux.RUnlock()
+	return es.byEvent[eventSchemaKey(chaincodeID, eventName)]
+}
+
+// annotate validates the payload of an event against the schema. Events that do not
+// match are still delivered, with the validation errors, so no events are lost when
+// a chaincode changes ahead of its schema
+func (s *eventSchema) annotate(entry *api.EventEntry, payloadBytes []byte) {
+	entry.SchemaID = s.info.ID
+	entry.RegistrySchemaID = s.info.RegistryID
+	var document jsonschema.JSONLoader
+	if payloadBytes != nil {
+		document = jsonschema.NewBytesLoader(payloadBytes)
+	} else {
+		document = jsonschema.NewGoLoader(entry.Payload)
+	}
+	result, err := s.schema.Validate(document)
+	if err != nil {
+		entry.SchemaErrors = []string{err.Error()}
+		return
+	}
+	for _, desc := range result.Errors() {
+		entry.SchemaErrors = append(entry.SchemaErrors, desc.String())
+	}
+}
+
+// schemaRegistryClient pushes schemas to a Confluent-compatible schema registry, so
+// consumers of the events can fetch them by the registry ID the events are annotated with
+type schemaRegistryClient struct {
+	conf   *conf.SchemaRegistryConf
+	client *http.Client
+}
+
+func newSchemaRegistryClient(registryConf *conf.SchemaRegistryConf) *schemaRegistryClient {
+	return &schemaRegistryClient{
+		conf:   registryConf,
+		client: &http.Client{Timeout: schemaRegistryTimeout},
+	}
+}
+
+// register adds a schema of the type, JSON or AVRO, under the subject. The registry returns
+// the ID of the existing version when the schema is already registered under it
+func (c *schemaRegistryClient) register(ctx context.Context, subject, schemaType string, schema json.RawMessage) (int, error) {
+	body, _ := json.Marshal(map[string]string{
+		"schemaType": schemaType,
+		"schema":     string(schema),
+	})
+	u := fmt.Sprintf("%s/subjects/%s/versions", strings.TrimSuffix(c.conf.URL, "/"), url.PathEscape(subject))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return 0, errors.Errorf(errors.EventSchemaRegistryFailed, subject, err)
+	}
+	req.Header.Set("Content-Type", schemaRegistryContentType)
+	req.Header.Set("Accept", schemaRegistryContentType)
+	if c.conf.Username != "" {
+		req.SetBasicAuth(c.conf.Username, c.conf.Password)
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return 0, errors.Errorf(errors.EventSchemaRegistryFailed, subject, err)
+	}
+	defer res.Body.Close()
+	resBody, _ := io.ReadAll(res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return 0, errors.Errorf(errors.EventSchemaRegistryFailed, subject, fmt.Sprintf("[%d] %s", res.StatusCode, resBody))
+	}
+	var result struct {
+		ID int `json:"id"`
+	}
+	if err := json.Unmarshal(resBody, &result); err != nil {
+		return 0, errors.Errorf(errors.EventSchemaRegistryFailed, subject, err)
+	}
+	return result.ID, nil
+}
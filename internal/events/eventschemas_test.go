@@ -0,0 +1,215 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAssetSchema = `{
+	"type": "object",
+	"properties": {
+		"ID": {"type": "string"},
+		"size": {"type": "integer"}
+	},
+	"required": ["ID"]
+}`
+
+func TestEventSchemaLifecycle(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	sm := newTestSubscriptionManager()
+	sm.config.LevelDB.Path = path.Join(dir, "db")
+	err := sm.Init()
+	assert.NoError(err)
+
+	body := `{"chaincodeId":"asset_transfer","eventName":"CreateAsset","schema":` + testAssetSchema + `}`
+	req := httptest.NewRequest(http.MethodPost, EventSchemaPathPrefix, strings.NewReader(body))
+	schema, restErr := sm.AddEventSchema(nil, req, nil)
+	assert.Nil(restErr)
+	assert.True(strings.HasPrefix(schema.ID, eventSchemaIDPrefix))
+	assert.Equal(EventSchemaPathPrefix+"/"+schema.ID, schema.Path)
+	assert.Empty(schema.Subject)
+	assert.Zero(schema.RegistryID)
+
+	// only one schema per chaincode event
+	req = httptest.NewRequest(http.MethodPost, EventSchemaPathPrefix, strings.NewReader(body))
+	_, restErr = sm.AddEventSchema(nil, req, nil)
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp("already registered", restErr.Error)
+
+	req = httptest.NewRequest(http.MethodPost, EventSchemaPathPrefix, strings.NewReader(`{"chaincodeId":"asset_transfer","eventName":"DeleteAsset","schema":{"type":"wrong"}}`))
+	_, restErr = sm.AddEventSchema(nil, req, nil)
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp("Invalid event schema", restErr.Error)
+
+	req = httptest.NewRequest(http.MethodPost, EventSchemaPathPrefix, strings.NewReader(`{"chaincodeId":"asset_transfer","schema":{}}`))
+	_, restErr = sm.AddEventSchema(nil, req, nil)
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp("eventName", restErr.Error)
+
+	// Reload
+	sm.Close()
+	sm = newTestSubscriptionManager()
+	sm.config.LevelDB.Path = path.Join(dir, "db")
+	err = sm.Init()
+	assert.NoError(err)
+	params := httprouter.Params{{Key: "schemaId", Value: schema.ID}}
+	reloaded, restErr := sm.EventSchemaByID(nil, nil, params)
+	assert.Nil(restErr)
+	assert.Equal("CreateAsset", reloaded.EventName)
+	assert.Equal(1, len(sm.EventSchemas(nil, nil, nil)))
+	assert.NotNil(sm.getEventSchemas().forEvent("asset_transfer", "CreateAsset"))
+
+	result, restErr := sm.DeleteEventSchema(nil, nil, params)
+	assert.Nil(restErr)
+	assert.Equal("true", (*result)["deleted"])
+	assert.Nil(sm.getEventSchemas().forEvent("asset_transfer", "CreateAsset"))
+	_, restErr = sm.EventSchemaByID(nil, nil, params)
+	assert.Equal(404, restErr.StatusCode)
+	_, restErr = sm.DeleteEventSchema(nil, nil, params)
+	assert.Equal(404, restErr.StatusCode)
+
+	sm.Close()
+}
+
+func TestEventSchemaAnnotate(t *testing.T) {
+	assert := assert.New(t)
+	schema, err := compileEventSchema(&api.EventSchemaInfo{
+		ID:          "sc-1",
+		ChaincodeID: "asset_transfer",
+		EventName:   "CreateAsset",
+		Schema:      json.RawMessage(testAssetSchema),
+		RegistryID:  5,
+	})
+	assert.NoError(err)
+	schemas := newEventSchemas(&conf.SchemaRegistryConf{})
+	schemas.add(schema)
+	assert.Nil(schemas.forEvent("asset_transfer", "DeleteAsset"))
+	assert.Nil(schemas.forEvent("asset_transfer", ""))
+
+	entry := &api.EventEntry{Payload: map[string]interface{}{"ID": "asset1", "size": 10}}
+	schemas.forEvent("asset_transfer", "CreateAsset").annotate(entry, nil)
+	assert.Equal("sc-1", entry.SchemaID)
+	assert.Equal(5, entry.RegistrySchemaID)
+	assert.Empty(entry.SchemaErrors)
+
+	entry = &api.EventEntry{}
+	schema.annotate(entry, []byte(`{"size":"large"}`))
+	assert.Equal(2, len(entry.SchemaErrors))
+
+	entry = &api.EventEntry{}
+	schema.annotate(entry, []byte(`not json`))
+	assert.Equal(1, len(entry.SchemaErrors))
+}
+
+func TestEventSchemaValidatedOnDelivery(t *testing.T) {
+	assert := assert.New(t)
+	schema, err := compileEventSchema(&api.EventSchemaInfo{
+		ID:          "sc-1",
+		ChaincodeID: "asset_transfer",
+		EventName:   "CreateAsset",
+		Schema:      json.RawMessage(testAssetSchema),
+	})
+	assert.NoError(err)
+	sm := &mockSubMgr{schemas: newEventSchemas(&conf.SchemaRegistryConf{})}
+	sm.schemas.add(schema)
+	stream := newTestStream(sm)
+	defer stream.stop()
+	var delivered *api.EventEntry
+	stream.eventHandler = func(data *eventData) { delivered = data.event }
+
+	p := newEvtProcessor("abc", stream)
+	subInfo := &api.SubscriptionInfo{ID: "abc", PayloadType: api.EventPayloadTypeJSON}
+	entry := &api.EventEntry{
+		ChaincodeID: "asset_transfer",
+		EventName:   "CreateAsset",
+		Payload:     []byte(`{"size":10}`),
+	}
+	err = p.processEventEntry(subInfo, entry)
+	assert.NoError(err)
+	assert.Equal(entry, delivered)
+	assert.Equal("sc-1", entry.SchemaID)
+	assert.Equal(1, len(entry.SchemaErrors))
+	assert.Regexp("ID", entry.SchemaErrors[0])
+}
+
+func TestEventSchemaRegistry(t *testing.T) {
+	assert := assert.New(t)
+	status := 200
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal("/subjects/asset_transfer-CreateAsset/versions", req.URL.Path)
+		assert.Equal(schemaRegistryContentType, req.Header.Get("Content-Type"))
+		username, password, ok := req.BasicAuth()
+		assert.True(ok)
+		assert.Equal("user", username)
+		assert.Equal("pass", password)
+		var body map[string]string
+		_ = json.NewDecoder(req.Body).Decode(&body)
+		assert.Equal("JSON", body["schemaType"])
+		assert.JSONEq(testAssetSchema, body["schema"])
+		res.WriteHeader(status)
+		if status == 200 {
+			_, _ = res.Write([]byte(`{"id":7}`))
+		} else {
+			_, _ = res.Write([]byte(`{"error_code":42201,"message":"Invalid schema"}`))
+		}
+	}))
+	defer svr.Close()
+
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	sm := newTestSubscriptionManager()
+	sm.config.LevelDB.Path = path.Join(dir, "db")
+	sm.schemas = newEventSchemas(&conf.SchemaRegistryConf{URL: svr.URL + "/", Username: "user", Password: "pass"})
+	err := sm.Init()
+	assert.NoError(err)
+	defer sm.Close()
+
+	spec := &api.EventSchemaInfo{
+		ChaincodeID: "asset_transfer",
+		EventName:   "CreateAsset",
+		Schema:      json.RawMessage(testAssetSchema),
+	}
+	_, err = sm.addEventSchema(context.Background(), spec)
+	assert.NoError(err)
+	assert.Equal("asset_transfer-CreateAsset", spec.Subject)
+	assert.Equal(7, spec.RegistryID)
+
+	status = 422
+	sm.schemas.remove(spec.ID)
+	statusCode, err := sm.addEventSchema(context.Background(), &api.EventSchemaInfo{
+		ChaincodeID: "asset_transfer",
+		EventName:   "CreateAsset",
+		Schema:      json.RawMessage(testAssetSchema),
+	})
+	assert.Equal(502, statusCode)
+	assert.Regexp("422.*Invalid schema", err)
+	assert.Equal(0, len(sm.schemas.list()))
+}
@@ -0,0 +1,97 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"sync"
+	"time"
+
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+)
+
+const (
+	eventStatsBucketDuration = time.Minute
+	// the rolling window is one hour, of one minute buckets
+	eventStatsBuckets = 60
+)
+
+type eventStatsBucket struct {
+	period int64 // the number of bucket durations since the epoch, at the start of the bucket
+	total  uint64
+	names  map[string]uint64
+}
+
+// eventTypeStats counts the events delivered for a subscription by event name. Buckets
+// are reused as the window rolls forwards, so the memory used is bounded by the number of
+// distinct event names
+type eventTypeStats struct {
+	mux     sync.Mutex
+	buckets [eventStatsBuckets]eventStatsBucket
+}
+
+func statsPeriod(t time.Time) int64 {
+	return t.UnixNano() / int64(eventStatsBucketDuration)
+}
+
+func (s *eventTypeStats) record(eventName string, now time.Time) {
+	period := statsPeriod(now)
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	b := &s.buckets[period%eventStatsBuckets]
+	if b.period != period || b.names == nil {
+		b.period = period
+		b.total = 0
+		b.names = make(map[string]uint64)
+	}
+	b.total++
+	if eventName != "" {
+		b.names[eventName]++
+	}
+}
+
+// stats totals the buckets in the window that ends now
+func (s *eventTypeStats) stats(now time.Time) *eventsapi.SubscriptionStats {
+	period := statsPeriod(now)
+	result := &eventsapi.SubscriptionStats{
+		From:       time.Unix(0, (period-eventStatsBuckets+1)*int64(eventStatsBucketDuration)).UTC(),
+		To:         now.UTC(),
+		EventNames: make(map[string]uint64),
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for i := range s.buckets {
+		b := &s.buckets[i]
+		if b.names == nil || b.period <= period-eventStatsBuckets || b.period > period {
+			continue
+		}
+		result.Total += b.total
+		for name, count := range b.names {
+			result.EventNames[name] += count
+		}
+	}
+	return result
+}
+
+// recordEventTypes counts delivered events in the stats of their subscriptions
+func recordEventTypes(events []*eventData) {
+	now := time.Now()
+	for _, event := range events {
+		if event.stats != nil {
+			event.stats.record(event.event.EventName, now)
+		}
+	}
+}
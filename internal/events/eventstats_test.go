@@ -0,0 +1,75 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"testing"
+	"time"
+
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventTypeStatsRollingWindow(t *testing.T) {
+	assert := assert.New(t)
+	s := &eventTypeStats{}
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	s.record("AssetCreated", start)
+	s.record("AssetCreated", start.Add(30*time.Second))
+	s.record("AssetTransferred", start.Add(10*time.Minute))
+	s.record("", start.Add(10*time.Minute))
+
+	stats := s.stats(start.Add(30 * time.Minute))
+	assert.Equal(uint64(4), stats.Total)
+	assert.Equal(map[string]uint64{"AssetCreated": 2, "AssetTransferred": 1}, stats.EventNames)
+	assert.Equal(start.Add(-29*time.Minute), stats.From)
+
+	// the first minute has left the window
+	stats = s.stats(start.Add(time.Hour))
+	assert.Equal(uint64(2), stats.Total)
+	assert.Equal(map[string]uint64{"AssetTransferred": 1}, stats.EventNames)
+
+	// a bucket is reset when it is reused for a later minute
+	s.record("AssetDeleted", start.Add(time.Hour+10*time.Minute))
+	stats = s.stats(start.Add(time.Hour + 10*time.Minute))
+	assert.Equal(uint64(1), stats.Total)
+	assert.Equal(map[string]uint64{"AssetDeleted": 1}, stats.EventNames)
+}
+
+func TestSubscriptionStats(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	ep := newEvtProcessor("sub1", nil)
+	sm.subscriptions["sub1"] = &subscription{info: &eventsapi.SubscriptionInfo{ID: "sub1"}, ep: ep}
+
+	recordEventTypes([]*eventData{
+		{event: &eventsapi.EventEntry{EventName: "AssetCreated"}, stats: ep.stats},
+		{event: &eventsapi.EventEntry{EventName: "AssetCreated"}, stats: ep.stats},
+		{event: &eventsapi.EventEntry{EventName: "AssetCreated"}},
+	})
+
+	stats, restErr := sm.SubscriptionStats(nil, nil, httprouter.Params{{Key: "subscriptionId", Value: "sub1"}})
+	assert.Nil(restErr)
+	assert.Equal("sub1", stats.ID)
+	assert.Equal(uint64(2), stats.Total)
+	assert.Equal(uint64(2), stats.EventNames["AssetCreated"])
+
+	_, restErr = sm.SubscriptionStats(nil, nil, httprouter.Params{{Key: "subscriptionId", Value: "sub2"}})
+	assert.Equal(404, restErr.StatusCode)
+}
@@ -20,6 +20,8 @@ import (
 	"container/list"
 	"context"
 	"net"
+	"net/url"
+	"reflect"
 	"strings"
 	"sync"
 	"time"
@@ -27,6 +29,7 @@ import (
 	"github.com/hyperledger/firefly-fabconnect/internal/auth"
 	"github.com/hyperledger/firefly-fabconnect/internal/errors"
 	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/hyperledger/firefly-fabconnect/internal/utils"
 	"github.com/hyperledger/firefly-fabconnect/internal/ws"
 
 	lru "github.com/hashicorp/golang-lru"
@@ -42,19 +45,38 @@ const (
 	EventStreamTypeWebhook = "webhook"
 	// send events via a websocket connection
 	EventStreamTypeWebsocket = "websocket"
+	// publish events to a Kafka topic
+	EventStreamTypeKafka = "kafka"
+	// publish events to an MQTT topic
+	EventStreamTypeMQTT = "mqtt"
+	// send events to an address on an AMQP 1.0 broker
+	EventStreamTypeAMQP = "amqp"
+	// publish events to a subject of a NATS JetStream stream
+	EventStreamTypeNATS = "nats"
+	// push batches of events on a gRPC stream to the consumer, which acknowledges each batch
+	EventStreamTypeGRPC = "grpc"
 	// FromBlockNewest is the special string that means subscribe from the current block
 	FromBlockNewest = "newest"
 	// ErrorHandlingBlock blocks the event stream until the handler can accept the event
 	ErrorHandlingBlock = "block"
 	// ErrorHandlingSkip processes up to the retry behavior on the stream, then skips to the next event
 	ErrorHandlingSkip = "skip"
+	// DeliveryAtLeastOnce checkpoints a batch after it is delivered, so it is delivered again if the gateway
+	// restarts before then. The default
+	DeliveryAtLeastOnce = "at-least-once"
+	// DeliveryAtMostOnce checkpoints a batch before it is delivered, and delivers it in a single attempt,
+	// so it is never delivered twice but can be lost
+	DeliveryAtMostOnce = "at-most-once"
 	// MaxBatchSize is the maximum that a user can specific for their batch size
 	MaxBatchSize = 1000
+	// MaxConcurrency is the most batches a stream can deliver in parallel
+	MaxConcurrency = 32
 
 	DefaultExponentialBackoffInitial = time.Duration(1) * time.Second
 	DefaultExponentialBackoffFactor  = float64(2.0)
 	DefaultTimestampCacheSize        = 1000
 	DefaultBlockedRetryDelaySec      = 30
+	DefaultBatchSize                 = 1
 	DefaultBatchTimeoutMS            = 5000
 	DefaultErrorHandling             = ErrorHandlingSkip
 )
@@ -69,16 +91,61 @@ type StreamInfo struct {
 	Name                 string               `json:"name,omitempty"`
 	Path                 string               `json:"path,omitempty"`
 	Suspended            *bool                `json:"suspended,omitempty"`
+	SuspendUntil         string               `json:"suspendUntil,omitempty"` // RFC3339 time the suspended stream resumes at
 	Type                 string               `json:"type"`
 	BatchSize            uint64               `json:"batchSize,omitempty"`
+	BatchSizeAuto        bool                 `json:"-"` // batchSize "auto" in JSON
+	BatchSizeStream      bool                 `json:"-"` // batchSize "stream" in JSON, delivering each event on its own
 	BatchTimeoutMS       uint64               `json:"batchTimeoutMS,omitempty"`
 	ErrorHandling        string               `json:"errorHandling,omitempty"`
+	DeliverySemantics    string               `json:"deliverySemantics,omitempty"` // "at-least-once" (default) or "at-most-once"
 	RetryTimeoutSec      uint64               `json:"retryTimeoutSec,omitempty"`
+	RetryInitialDelayMS  uint64               `json:"retryInitialDelayMS,omitempty"` // Delay before the first retry of a failed batch
+	RetryBackoffFactor   float64              `json:"retryBackoffFactor,omitempty"`  // Each retry of a batch waits this many times longer than the last
+	RetryStrategy        string               `json:"retryStrategy,omitempty"`       // "exponential" (default), "linear" or "fixed"
+	RetryJitter          float64              `json:"retryJitter,omitempty"`         // Randomizes each retry delay by up to this fraction of it
 	BlockedRetryDelaySec uint64               `json:"blockedRetryDelaySec,omitempty"`
 	Webhook              *webhookActionInfo   `json:"webhook,omitempty"`
 	WebSocket            *webSocketActionInfo `json:"websocket,omitempty"`
+	Kafka                *kafkaActionInfo     `json:"kafka,omitempty"`
+	MQTT                 *mqttActionInfo      `json:"mqtt,omitempty"`
+	AMQP                 *amqpActionInfo      `json:"amqp,omitempty"`
+	NATS                 *natsActionInfo      `json:"nats,omitempty"`
+	GRPC                 *grpcActionInfo      `json:"grpc,omitempty"`
 	Timestamps           *bool                `json:"timestamps,omitempty"` // Include block timestamps in the events generated
 	TimestampCacheSize   int                  `json:"timestampCacheSize,omitempty"`
+	// A batch is dispatched once its events add up to this many bytes as JSON, even if it has fewer
+	// than batchSize events. The event that crosses the limit is the last in the batch. Zero means
+	// batches are only limited by their number of events
+	BatchMaxBytes uint64 `json:"batchMaxBytes,omitempty"`
+	// Number of batches a webhook stream delivers in parallel. The events of each subscription are
+	// batched separately, and a subscription has at most one batch in flight, so its events are still
+	// delivered in order. Defaults to 1
+	Concurrency uint32 `json:"concurrency,omitempty"`
+	// Max rate at which historical events (before the chain height at the time the subscription
+	// was started) are delivered into the stream. Live events are never throttled. Zero means no limit
+	ReplayMaxEventsPerSec uint64 `json:"replayMaxEventsPerSec,omitempty"`
+	// Streams with a higher priority are given batch delivery slots first, when the gateway
+	// limits the number of batches delivered concurrently across all streams. Defaults to 0
+	Priority int `json:"priority,omitempty"`
+	// The service identity the event poller of this stream runs as, resolved by the security
+	// module if it supports it. Runs with the system context if not set
+	ServiceIdentity string `json:"serviceIdentity,omitempty"`
+	// Where batches skipped by the "skip" error handling are written, after all their retries failed.
+	// Without one, the events of those batches are not delivered
+	DeadLetter *deadLetterInfo `json:"deadLetter,omitempty"`
+	// "cloudevents" wraps the events delivered by webhook and websocket streams in CloudEvents 1.0
+	// envelopes. Events are delivered as they are by default
+	Format string `json:"format,omitempty"`
+	// Incremented on every change that is stored, and returned as the ETag of the stream
+	ResourceVersion uint64 `json:"resourceVersion,omitempty"`
+	// The state of the circuit of a webhook stream with a circuit breaker. Returned by the API, and ignored when set
+	Circuit *CircuitBreakerStatus `json:"circuit,omitempty"`
+	// The delivery statistics of the stream. Returned by the API for a single stream, and ignored when set
+	Stats *StreamStats `json:"stats,omitempty"`
+	// Why the event poller of the stream cannot run, such as its service identity failing to
+	// resolve, while that is the case. Returned by the API, and ignored when set
+	Errored string `json:"errored,omitempty"`
 }
 
 type webhookActionInfo struct {
@@ -86,11 +153,40 @@ type webhookActionInfo struct {
 	Headers           map[string]string `json:"headers,omitempty"`
 	TLSkipHostVerify  *bool             `json:"tlsSkipHostVerify,omitempty"`
 	RequestTimeoutSec uint32            `json:"requestTimeoutSec,omitempty"`
+	// Proxy for this webhook only, overriding the gateway proxy configuration
+	ProxyURL string `json:"proxyURL,omitempty"`
+	// Signs the body of each request with HMAC-SHA256, so the endpoint can verify it came from the gateway
+	Secret string `json:"secret,omitempty"`
+	// The secret replaced by the last rotation, which also signs the requests until its expiry. Set by the rotation API
+	PreviousSecret       string `json:"previousSecret,omitempty"`
+	PreviousSecretExpiry string `json:"previousSecretExpiry,omitempty"`
+	// Header the signature is set in, defaults to X-Fabconnect-Signature
+	SignatureHeader string `json:"signatureHeader,omitempty"`
+	// Client certificate and key presented to the webhook for mutual TLS, each as inline PEM or the path of a PEM file
+	TLSClientCert string `json:"tlsClientCert,omitempty"`
+	TLSClientKey  string `json:"tlsClientKey,omitempty"`
+	// Obtains a bearer token for each batch with the OAuth2 client credentials grant, refreshing it before it expires
+	OAuth2 *webhookOAuth2Info `json:"oauth2,omitempty"`
+	// Batches whose JSON is larger than this are delivered in multiple requests, in order. Zero means no limit
+	MaxRequestBytes uint32 `json:"maxRequestBytes,omitempty"`
+	// "gzip" compresses the body of each request
+	Compression string `json:"compression,omitempty"`
+	// Shorthand for a compression of "gzip" when true, which is how the stream is stored
+	Compressed *bool `json:"compressed,omitempty"`
+	// Bodies smaller than this are sent uncompressed. Zero compresses every body
+	CompressionThresholdBytes uint32 `json:"compressionThresholdBytes,omitempty"`
+	// "retry" or "fail" by status code, such as "503", or class, such as "4xx". Failed requests
+	// with a status that is not in the policy are retried
+	RetryPolicy map[string]string `json:"retryPolicy,omitempty"`
+	// Suspends the stream when batches keep failing, and resumes it when probes find the webhook has recovered
+	CircuitBreaker *webhookCircuitBreakerInfo `json:"circuitBreaker,omitempty"`
 }
 
 type webSocketActionInfo struct {
 	Topic            string `json:"topic,omitempty"`
 	DistributionMode string `json:"distributionMode,omitempty"`
+	// Tracks the offset of the consumers on the server, so events they have acknowledged are not redelivered
+	ConsumerGroup string `json:"consumerGroup,omitempty"`
 }
 
 // defined to allow mocking in tests
@@ -103,9 +199,7 @@ type eventStream struct {
 	eventStream         chan *eventData
 	eventHandler        eventHandler
 	stopped             bool
-	processorDone       bool
 	pollingInterval     time.Duration
-	pollerDone          bool
 	inFlight            uint64
 	batchCond           *sync.Cond
 	batchQueue          *list.List
@@ -113,30 +207,55 @@ type eventStream struct {
 	initialRetryDelay   time.Duration
 	backoffFactor       float64
 	updateInProgress    bool
-	updateInterrupt     chan struct{}   // a zero-sized struct used only for signaling (hand rolled alternative to context)
-	updateWG            *sync.WaitGroup // Wait group for the go routines to reply back after they have stopped
+	poller              *streamRoutine // polls the node for new events on the subscriptions
+	pollerShards        int            // number of shards the subscriptions are polled in, each by its own goroutine
+	dispatcher          *streamRoutine // forms events into batches, kept running while suspended
+	processor           *streamRoutine // delivers the batches
 	action              eventStreamAction
+	deadLetter          *deadLetterSink        // set when the stream has a dead-letter destination
+	errored             bool                   // only accessed by the batch processor, under erroredMux
+	pollerErrored       string                 // why the poller cannot run, under erroredMux
+	erroredMux          sync.Mutex             // batches are processed concurrently when the stream has a concurrency
+	busySubs            map[string]bool        // subscriptions with a batch being processed, under the batchCond lock
+	resumeRetry         map[string]*retryState // retries of the blocked batches recovered on restart, taken by the batch workers
+	batchTuner          *batchTuner            // set when the batch size is "auto"
+	circuit             circuitBreaker         // used when the webhook has a circuit breaker
+	counters            streamCounters
 	wsChannels          ws.WebSocketChannels
 	blockTimestampCache *lru.Cache
+	replayThrottle      *replayThrottle
+	checkpointMux       sync.Mutex      // held while the checkpoint of a shard is stored, as batches delivered at most once store it too
+	resumeTimer         *time.Timer     // resumes the stream at the time it was suspended until, under the batchCond lock
+	ctx                 context.Context // parent of the goroutine contexts, cancelled when the stream is stopped
+	cancelCtx           context.CancelFunc
 }
 
 type eventStreamAction interface {
-	attemptBatch(batchNumber, attempt uint64, events []*eventsapi.EventEntry) error
+	attemptBatch(ctx context.Context, batchNumber, attempt uint64, events []*eventsapi.EventEntry) error
 }
 
-// newEventStream constructor verifies the action is correct, kicks
-// off the event batch processor, and blockHWM will be
-// initialied to that supplied (zero on initial, or the
-// value from the checkpoint)
-func newEventStream(sm subscriptionManager, spec *StreamInfo, wsChannels ws.WebSocketChannels) (a *eventStream, err error) {
+// connectedAction is implemented by the actions that hold a connection between batches, which
+// is closed when the stream is stopped or its settings are updated
+type connectedAction interface {
+	close()
+}
+
+// setStreamDefaults normalizes the type of a stream, and sets defaults for the settings not supplied
+func setStreamDefaults(spec *StreamInfo) {
 	if strings.ToLower(spec.Type) == EventStreamTypeWebhook {
 		spec.Type = EventStreamTypeWebhook
 	} else if strings.ToLower(spec.Type) == EventStreamTypeWebsocket {
 		spec.Type = EventStreamTypeWebsocket
+	} else if _, ok := brokerTypes[strings.ToLower(spec.Type)]; ok {
+		spec.Type = strings.ToLower(spec.Type)
 	}
 
-	if spec.BatchSize == 0 {
+	if spec.BatchSizeAuto {
+		spec.BatchSize = 0
+	} else if spec.BatchSizeStream {
 		spec.BatchSize = 1
+	} else if spec.BatchSize == 0 {
+		spec.BatchSize = DefaultBatchSize
 	} else if spec.BatchSize > MaxBatchSize {
 		spec.BatchSize = MaxBatchSize
 	}
@@ -146,6 +265,12 @@ func newEventStream(sm subscriptionManager, spec *StreamInfo, wsChannels ws.WebS
 	if spec.BlockedRetryDelaySec == 0 {
 		spec.BlockedRetryDelaySec = DefaultBlockedRetryDelaySec
 	}
+	if spec.RetryInitialDelayMS == 0 {
+		spec.RetryInitialDelayMS = uint64(DefaultExponentialBackoffInitial.Milliseconds())
+	}
+	if spec.RetryBackoffFactor == 0 {
+		spec.RetryBackoffFactor = DefaultExponentialBackoffFactor
+	}
 	if spec.Timestamps == nil {
 		spec.Timestamps = &falseValue
 	}
@@ -158,6 +283,14 @@ func newEventStream(sm subscriptionManager, spec *StreamInfo, wsChannels ws.WebS
 	if spec.Suspended == nil {
 		spec.Suspended = &falseValue
 	}
+}
+
+// newEventStream constructor verifies the action is correct, kicks
+// off the event batch processor, and blockHWM will be
+// initialied to that supplied (zero on initial, or the
+// value from the checkpoint)
+func newEventStream(sm subscriptionManager, spec *StreamInfo, wsChannels ws.WebSocketChannels) (a *eventStream, err error) {
+	setStreamDefaults(spec)
 
 	a = &eventStream{
 		sm:                sm,
@@ -166,12 +299,18 @@ func newEventStream(sm subscriptionManager, spec *StreamInfo, wsChannels ws.WebS
 		eventStream:       make(chan *eventData),
 		batchCond:         sync.NewCond(&sync.Mutex{}),
 		batchQueue:        list.New(),
-		initialRetryDelay: DefaultExponentialBackoffInitial,
-		backoffFactor:     DefaultExponentialBackoffFactor,
+		busySubs:          make(map[string]bool),
+		initialRetryDelay: time.Duration(spec.RetryInitialDelayMS) * time.Millisecond,
+		backoffFactor:     spec.RetryBackoffFactor,
 		pollingInterval:   time.Duration(sm.getConfig().PollingIntervalSec) * time.Second,
 		wsChannels:        wsChannels,
+		replayThrottle:    newReplayThrottle(spec.ReplayMaxEventsPerSec),
+		pollerShards:      pollerWorkers(sm.getConfig()),
 	}
 	a.eventHandler = a.handleEvent
+	if spec.BatchSizeAuto {
+		a.batchTuner = newBatchTuner(spec.ID)
+	}
 
 	if a.blockTimestampCache, err = lru.New(spec.TimestampCacheSize); err != nil {
 		return nil, errors.Errorf(errors.EventStreamsCreateStreamResourceErr, err)
@@ -191,34 +330,56 @@ func newEventStream(sm subscriptionManager, spec *StreamInfo, wsChannels ws.WebS
 		if a.action, err = newWebSocketAction(a, spec.WebSocket); err != nil {
 			return nil, err
 		}
+	default:
+		if bt, ok := brokerTypes[spec.Type]; ok {
+			if a.action, err = bt.newAction(a, spec); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if a.deadLetter, err = newDeadLetterSink(a, spec.DeadLetter); err != nil {
+		return nil, err
 	}
 
+	a.ctx, a.cancelCtx = context.WithCancel(context.Background())
 	a.startEventHandlers(false)
 	return a, nil
 }
 
-// helper to kick off go routines and any tracking entities
+// startEventHandlers kicks off the goroutines of the stream, each under its own child of the
+// stream context so they can be interrupted for an update, and waited on until they have exited
 func (a *eventStream) startEventHandlers(resume bool) {
-	// create a context that can be used to indicate an update to the eventstream
-	a.updateInterrupt = make(chan struct{})
-	a.updateWG = &sync.WaitGroup{}
-	a.updateWG.Add(1) // add a channel for eventPoller to inform after it has stopped
-	go a.eventPoller()
-	a.updateWG.Add(1) // add a channel for batchProcessor to inform after it has stopped
-	go a.batchProcessor()
+	a.poller = startStreamRoutine(a.ctx, a.eventPoller)
+	a.processor = startStreamRoutine(a.ctx, a.batchProcessor)
 	// For a pause/resume, the batch dispatcher goroutine is not terminated, hence no need to start it
 	if !resume {
-		a.updateWG.Add(1) // add a channel for batchDispatcher to inform after it has stopped
-		go a.batchDispatcher()
+		a.dispatcher = startStreamRoutine(a.ctx, a.batchDispatcher)
 	}
 }
 
+// cancelEventHandlers interrupts all the goroutines of the stream, and must be called with the
+// batchCond lock held so that a batch processor waiting on the condition sees the cancellation
+func (a *eventStream) cancelEventHandlers() {
+	a.poller.cancel()
+	a.dispatcher.cancel()
+	a.processor.cancel()
+	a.batchCond.Broadcast()
+}
+
+// waitEventHandlers blocks until all the goroutines of the stream have exited
+func (a *eventStream) waitEventHandlers() {
+	a.poller.wait()
+	a.dispatcher.wait()
+	a.processor.wait()
+}
+
 // GetID returns the ID (for sorting)
 func (spec *StreamInfo) GetID() string {
 	return spec.ID
 }
 
-// preUpdateStream sets a flag to indicate updateInProgress and wakes up goroutines waiting on condition variable
+// preUpdateStream sets a flag to indicate updateInProgress, then interrupts the goroutines of the
+// stream and waits for them all to exit, so the spec can be changed without racing with them
 func (a *eventStream) preUpdateStream() error {
 	a.batchCond.L.Lock()
 	if a.updateInProgress {
@@ -226,80 +387,355 @@ func (a *eventStream) preUpdateStream() error {
 		return errors.Errorf(errors.EventStreamsUpdateAlreadyInProgress)
 	}
 	a.updateInProgress = true
-	// close the updateInterrupt channel so that the event handler go routines can be woken up
-	close(a.updateInterrupt)
-	a.batchCond.Broadcast()
+	a.cancelEventHandlers()
 	a.batchCond.L.Unlock()
+	a.waitEventHandlers()
 	return nil
 }
 
 // postUpdateStream resets flags and kicks off a fresh round of handler go routines
 func (a *eventStream) postUpdateStream() {
 	a.batchCond.L.Lock()
-	a.pollerDone = false
-	a.processorDone = false
 	a.startEventHandlers(false)
 	a.updateInProgress = false
 	a.batchCond.L.Unlock()
 }
 
-// update modifies an existing eventStream
+// update modifies an existing eventStream, changing only the fields that are set in the new spec
 func (a *eventStream) update(newSpec *StreamInfo) (spec *StreamInfo, err error) {
 	log.Infof("%s: Update event stream", a.spec.ID)
-	// set a flag to indicate updateInProgress
-	// For any go routines that are Wait() ing on the eventListener, wake them up
-	if err := a.preUpdateStream(); err != nil {
-		return nil, err
-	}
-	// wait for the poked goroutines to finish up
-	a.updateWG.Wait()
-
+	newSpec.restoreRedacted(a.spec)
 	if newSpec.Type != "" && newSpec.Type != a.spec.Type {
 		return nil, errors.Errorf(errors.EventStreamsCannotUpdateType)
 	}
-	if a.spec.Type == "webhook" && newSpec.Webhook != nil {
-		if newSpec.Webhook.RequestTimeoutSec != 0 {
-			a.spec.Webhook.RequestTimeoutSec = 120
+	return a.apply(a.mergeSpec(newSpec))
+}
+
+// mergeSpec returns the spec of the stream, with the fields that are set in the update
+func (a *eventStream) mergeSpec(update *StreamInfo) *StreamInfo {
+	merged := *a.spec
+	if a.spec.Type == EventStreamTypeWebhook && update.Webhook != nil {
+		webhook := webhookActionInfo{}
+		if a.spec.Webhook != nil {
+			webhook = *a.spec.Webhook
+		}
+		if update.Webhook.URL != "" {
+			webhook.URL = update.Webhook.URL
+		}
+		if update.Webhook.RequestTimeoutSec != 0 {
+			webhook.RequestTimeoutSec = update.Webhook.RequestTimeoutSec
+		}
+		if update.Webhook.TLSkipHostVerify != nil {
+			webhook.TLSkipHostVerify = update.Webhook.TLSkipHostVerify
+		}
+		if update.Webhook.Headers != nil {
+			webhook.Headers = update.Webhook.Headers
+		}
+		if update.Webhook.ProxyURL != "" {
+			webhook.ProxyURL = update.Webhook.ProxyURL
+		}
+		if update.Webhook.Secret != "" {
+			webhook.Secret = update.Webhook.Secret
+		}
+		if update.Webhook.SignatureHeader != "" {
+			webhook.SignatureHeader = update.Webhook.SignatureHeader
+		}
+		if update.Webhook.TLSClientCert != "" {
+			webhook.TLSClientCert = update.Webhook.TLSClientCert
+		}
+		if update.Webhook.TLSClientKey != "" {
+			webhook.TLSClientKey = update.Webhook.TLSClientKey
 		}
-		if newSpec.Webhook.URL != "" {
-			a.spec.Webhook.URL = newSpec.Webhook.URL
+		if update.Webhook.OAuth2 != nil {
+			webhook.OAuth2 = update.Webhook.OAuth2
 		}
-		if newSpec.Webhook.RequestTimeoutSec != 0 {
-			a.spec.Webhook.RequestTimeoutSec = newSpec.Webhook.RequestTimeoutSec
+		if update.Webhook.MaxRequestBytes != 0 {
+			webhook.MaxRequestBytes = update.Webhook.MaxRequestBytes
 		}
-		if newSpec.Webhook.TLSkipHostVerify != nil {
-			a.spec.Webhook.TLSkipHostVerify = newSpec.Webhook.TLSkipHostVerify
+		if update.Webhook.Compression != "" || update.Webhook.Compressed != nil {
+			webhook.Compression = resolveWebhookCompression(update.Webhook.Compression, update.Webhook.Compressed)
 		}
-		if newSpec.Webhook.Headers != nil {
-			a.spec.Webhook.Headers = newSpec.Webhook.Headers
+		if update.Webhook.CompressionThresholdBytes != 0 {
+			webhook.CompressionThresholdBytes = update.Webhook.CompressionThresholdBytes
 		}
+		if update.Webhook.RetryPolicy != nil {
+			webhook.RetryPolicy = update.Webhook.RetryPolicy
+		}
+		if update.Webhook.CircuitBreaker != nil {
+			webhook.CircuitBreaker = update.Webhook.CircuitBreaker
+		}
+		merged.Webhook = &webhook
 	}
-	if a.spec.Type == "websocket" && newSpec.WebSocket != nil {
-		if newSpec.WebSocket.Topic != "" {
-			a.spec.WebSocket.Topic = newSpec.WebSocket.Topic
+	if a.spec.Type == EventStreamTypeWebsocket && update.WebSocket != nil {
+		webSocket := webSocketActionInfo{}
+		if a.spec.WebSocket != nil {
+			webSocket = *a.spec.WebSocket
+		}
+		if update.WebSocket.Topic != "" {
+			webSocket.Topic = update.WebSocket.Topic
+		}
+		if update.WebSocket.DistributionMode != "" {
+			webSocket.DistributionMode = update.WebSocket.DistributionMode
 		}
-		if newSpec.WebSocket.DistributionMode != "" {
-			a.spec.WebSocket.DistributionMode = newSpec.WebSocket.DistributionMode
+		if update.WebSocket.ConsumerGroup != "" {
+			webSocket.ConsumerGroup = update.WebSocket.ConsumerGroup
 		}
+		merged.WebSocket = &webSocket
+	}
+	if bt, ok := brokerTypes[a.spec.Type]; ok {
+		bt.merge(&merged, a.spec, update)
+	}
+	if update.DeadLetter != nil {
+		merged.DeadLetter = update.DeadLetter
+	}
+	if update.BatchSizeAuto && !a.spec.BatchSizeAuto {
+		merged.BatchSizeAuto = true
+		merged.BatchSizeStream = false
+		merged.BatchSize = 0
+	} else if update.BatchSizeStream && !a.spec.BatchSizeStream {
+		merged.BatchSizeStream = true
+		merged.BatchSizeAuto = false
+		merged.BatchSize = 1
+	} else if update.BatchSize != 0 && update.BatchSize < MaxBatchSize {
+		// a number replaces a batch size that is tuned, or the delivery of each event on its own
+		merged.BatchSize = update.BatchSize
+		merged.BatchSizeAuto = false
+		merged.BatchSizeStream = false
+	}
+	if update.BatchTimeoutMS != 0 {
+		merged.BatchTimeoutMS = update.BatchTimeoutMS
+	}
+	if update.BatchMaxBytes != 0 {
+		merged.BatchMaxBytes = update.BatchMaxBytes
+	}
+	if update.Concurrency != 0 {
+		merged.Concurrency = update.Concurrency
+	}
+	if update.BlockedRetryDelaySec != 0 {
+		merged.BlockedRetryDelaySec = update.BlockedRetryDelaySec
+	}
+	if update.RetryInitialDelayMS != 0 {
+		merged.RetryInitialDelayMS = update.RetryInitialDelayMS
+	}
+	if update.RetryBackoffFactor != 0 {
+		merged.RetryBackoffFactor = update.RetryBackoffFactor
+	}
+	if update.RetryStrategy != "" {
+		merged.RetryStrategy = update.RetryStrategy
 	}
+	if update.RetryJitter != 0 {
+		merged.RetryJitter = update.RetryJitter
+	}
+	if update.ErrorHandling != "" {
+		merged.ErrorHandling = update.ErrorHandling
+	}
+	if update.Name != "" {
+		merged.Name = update.Name
+	}
+	if update.Timestamps != nil {
+		merged.Timestamps = update.Timestamps
+	}
+	if update.ServiceIdentity != "" {
+		merged.ServiceIdentity = update.ServiceIdentity
+	}
+	if update.Format != "" {
+		merged.Format = update.Format
+	}
+	if update.DeliverySemantics != "" {
+		merged.DeliverySemantics = update.DeliverySemantics
+	}
+	if update.Priority != 0 {
+		merged.Priority = update.Priority
+	}
+	if update.ReplayMaxEventsPerSec != 0 {
+		merged.ReplayMaxEventsPerSec = update.ReplayMaxEventsPerSec
+	}
+	return &merged
+}
+
+// replace sets every field of the stream that can be changed from the new spec, so fields
+// missing from it are unset (back to their defaults). Used for JSON Patch updates, where the
+// new spec is the patched existing one
+func (a *eventStream) replace(newSpec *StreamInfo) (spec *StreamInfo, err error) {
+	log.Infof("%s: Replace event stream", a.spec.ID)
+	newSpec.restoreRedacted(a.spec)
+	immutable := []struct {
+		field     string
+		unchanged bool
+	}{
+		{"id", newSpec.ID == a.spec.ID},
+		{"path", newSpec.Path == a.spec.Path},
+		{"created", newSpec.CreatedISO8601 == a.spec.CreatedISO8601},
+		{"type", strings.EqualFold(newSpec.Type, a.spec.Type)},
+		{"suspended", newSpec.Suspended != nil && *newSpec.Suspended == *a.spec.Suspended},
+		{"suspendUntil", newSpec.SuspendUntil == a.spec.SuspendUntil},
+	}
+	for _, f := range immutable {
+		if !f.unchanged {
+			return nil, errors.Errorf(errors.EventStreamsPatchImmutableField, f.field)
+		}
+	}
+	return a.apply(newSpec)
+}
 
-	if a.spec.BatchSize != newSpec.BatchSize && newSpec.BatchSize != 0 && newSpec.BatchSize < MaxBatchSize {
-		a.spec.BatchSize = newSpec.BatchSize
+// apply validates the complete new spec of the stream, then sets every field that can be
+// changed from it while the goroutines of the stream are stopped. Both updates and replacements
+// of the stream go through here, so they are validated the same
+func (a *eventStream) apply(newSpec *StreamInfo) (spec *StreamInfo, err error) {
+	switch a.spec.Type {
+	case EventStreamTypeWebhook:
+		if err = validateWebhookConfig(newSpec.Webhook); err == nil {
+			// the URL has been parsed by the validation
+			u, _ := url.Parse(newSpec.Webhook.URL)
+			err = a.webhookPolicy().checkHost(u.Hostname())
+		}
+	case EventStreamTypeWebsocket:
+		if newSpec.WebSocket == nil {
+			newSpec.WebSocket = &webSocketActionInfo{}
+		}
+		err = validateWebsocketConfig(newSpec.WebSocket)
+	default:
+		if bt, ok := brokerTypes[a.spec.Type]; ok {
+			err = bt.validate(newSpec)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if newSpec.ErrorHandling == "" {
+		newSpec.ErrorHandling = DefaultErrorHandling
+	}
+	newSpec.ErrorHandling = strings.ToLower(newSpec.ErrorHandling)
+	if newSpec.ErrorHandling != ErrorHandlingBlock && newSpec.ErrorHandling != ErrorHandlingSkip {
+		return nil, errors.Errorf(errors.RESTGatewayEventStreamInvalid, "Unknown errorHandling type. Must be an empty string, 'skip' or 'block'")
+	}
+	format, err := validateStreamFormat(newSpec.Format, a.spec.Type, a.sm.getConfig().SchemaRegistry.URL)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateStreamConcurrency(newSpec.Concurrency, a.spec.Type); err != nil {
+		return nil, err
 	}
-	if a.spec.BatchTimeoutMS != newSpec.BatchTimeoutMS && newSpec.BatchTimeoutMS != 0 {
-		a.spec.BatchTimeoutMS = newSpec.BatchTimeoutMS
+	if err := validateRetryBackoff(newSpec.RetryBackoffFactor); err != nil {
+		return nil, err
+	}
+	retryStrategy, err := utils.ValidateRetryStrategy(newSpec.RetryStrategy, newSpec.RetryJitter)
+	if err != nil {
+		return nil, err
+	}
+	semantics, err := validateDeliverySemantics(newSpec.DeliverySemantics)
+	if err != nil {
+		return nil, err
+	}
+	// the dead-letter sink is only replaced when its config changes, and is created last so
+	// there is nothing to undo when the stream is invalid
+	deadLetter := a.deadLetter
+	if !reflect.DeepEqual(newSpec.DeadLetter, a.spec.DeadLetter) {
+		if deadLetter, err = newDeadLetterSink(a, newSpec.DeadLetter); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := a.preUpdateStream(); err != nil {
+		if deadLetter != a.deadLetter {
+			deadLetter.close()
+		}
+		return nil, err
+	}
+
+	// The actions hold on to the specs of their type, so they are updated in place
+	if a.spec.Type == EventStreamTypeWebhook {
+		if newSpec.Webhook.RequestTimeoutSec == 0 {
+			newSpec.Webhook.RequestTimeoutSec = 120
+		}
+		if newSpec.Webhook.TLSkipHostVerify == nil {
+			newSpec.Webhook.TLSkipHostVerify = &falseValue
+		}
+		newSpec.Webhook.Compression = resolveWebhookCompression(newSpec.Webhook.Compression, newSpec.Webhook.Compressed)
+		newSpec.Webhook.Compressed = nil
+		setCircuitBreakerDefaults(newSpec.Webhook.CircuitBreaker)
+		*a.spec.Webhook = *newSpec.Webhook
+	}
+	if a.spec.Type == EventStreamTypeWebsocket {
+		if a.spec.WebSocket == nil {
+			a.spec.WebSocket = &webSocketActionInfo{}
+		}
+		*a.spec.WebSocket = *newSpec.WebSocket
+	}
+	if bt, ok := brokerTypes[a.spec.Type]; ok && bt.apply(a.spec, newSpec) {
+		// the next batch connects with the new settings
+		a.action.(connectedAction).close()
+	}
+
+	if deadLetter != a.deadLetter {
+		a.deadLetter.close()
+		a.deadLetter = deadLetter
+		a.spec.DeadLetter = newSpec.DeadLetter
+	}
+
+	if newSpec.BatchSizeAuto {
+		if !a.spec.BatchSizeAuto {
+			a.batchTuner = newBatchTuner(a.spec.ID)
+		}
+		a.spec.BatchSize = 0
+	} else {
+		a.batchTuner = nil
+		switch {
+		case newSpec.BatchSizeStream:
+			a.spec.BatchSize = 1
+		case newSpec.BatchSize == 0:
+			a.spec.BatchSize = DefaultBatchSize
+		case newSpec.BatchSize > MaxBatchSize:
+			a.spec.BatchSize = MaxBatchSize
+		default:
+			a.spec.BatchSize = newSpec.BatchSize
+		}
 	}
-	if a.spec.BlockedRetryDelaySec != newSpec.BlockedRetryDelaySec && newSpec.BlockedRetryDelaySec != 0 {
-		a.spec.BlockedRetryDelaySec = newSpec.BlockedRetryDelaySec
+	a.spec.BatchSizeAuto = newSpec.BatchSizeAuto
+	a.spec.BatchSizeStream = newSpec.BatchSizeStream && !newSpec.BatchSizeAuto
+	a.spec.BatchTimeoutMS = newSpec.BatchTimeoutMS
+	if a.spec.BatchTimeoutMS == 0 {
+		a.spec.BatchTimeoutMS = DefaultBatchTimeoutMS
 	}
-	if newSpec.ErrorHandling != "" && a.spec.ErrorHandling != newSpec.ErrorHandling {
-		a.spec.ErrorHandling = newSpec.ErrorHandling
+	a.spec.BatchMaxBytes = newSpec.BatchMaxBytes
+	a.spec.Concurrency = newSpec.Concurrency
+	a.spec.BlockedRetryDelaySec = newSpec.BlockedRetryDelaySec
+	if a.spec.BlockedRetryDelaySec == 0 {
+		a.spec.BlockedRetryDelaySec = DefaultBlockedRetryDelaySec
 	}
-	if newSpec.Name != "" && a.spec.Name != newSpec.Name {
-		a.spec.Name = newSpec.Name
+	a.spec.RetryTimeoutSec = newSpec.RetryTimeoutSec
+	a.spec.RetryInitialDelayMS = newSpec.RetryInitialDelayMS
+	if a.spec.RetryInitialDelayMS == 0 {
+		a.spec.RetryInitialDelayMS = uint64(DefaultExponentialBackoffInitial.Milliseconds())
 	}
-	if newSpec.Timestamps != nil {
-		a.spec.Timestamps = newSpec.Timestamps
+	a.spec.RetryBackoffFactor = newSpec.RetryBackoffFactor
+	if a.spec.RetryBackoffFactor == 0 {
+		a.spec.RetryBackoffFactor = DefaultExponentialBackoffFactor
+	}
+	a.initialRetryDelay = time.Duration(a.spec.RetryInitialDelayMS) * time.Millisecond
+	a.backoffFactor = a.spec.RetryBackoffFactor
+	a.spec.RetryStrategy = retryStrategy
+	a.spec.RetryJitter = newSpec.RetryJitter
+	a.spec.ErrorHandling = newSpec.ErrorHandling
+	a.spec.Name = newSpec.Name
+	a.spec.Timestamps = newSpec.Timestamps
+	if a.spec.Timestamps == nil {
+		a.spec.Timestamps = &falseValue
+	}
+	if newSpec.TimestampCacheSize == 0 {
+		newSpec.TimestampCacheSize = DefaultTimestampCacheSize
+	}
+	if newSpec.TimestampCacheSize != a.spec.TimestampCacheSize {
+		a.spec.TimestampCacheSize = newSpec.TimestampCacheSize
+		a.blockTimestampCache.Resize(newSpec.TimestampCacheSize)
+	}
+	a.spec.ServiceIdentity = newSpec.ServiceIdentity
+	a.spec.Format = format
+	a.spec.DeliverySemantics = semantics
+	a.spec.Priority = newSpec.Priority
+	if a.spec.ReplayMaxEventsPerSec != newSpec.ReplayMaxEventsPerSec {
+		a.spec.ReplayMaxEventsPerSec = newSpec.ReplayMaxEventsPerSec
+		a.replayThrottle.setRate(newSpec.ReplayMaxEventsPerSec)
 	}
 	a.postUpdateStream()
 	return a.spec, nil
@@ -311,18 +747,28 @@ func (a *eventStream) handleEvent(event *eventData) {
 	// by the batchDispatcher
 	if a.stopped {
 		log.Infof("Event stream stopped, skipping event %s for transaction %s", event.event.EventName, event.event.TransactionID)
+		event.release()
 	} else {
 		a.eventStream <- event
 	}
 }
 
-// stop is a lazy stop, that marks a flag for the batch goroutine to pick up
+// stop cancels the stream context, which interrupts all the goroutines of the stream and
+// abandons any in-flight calls to the node, then waits for them to exit
 func (a *eventStream) stop() {
+	a.cancelScheduledResume()
 	a.batchCond.L.Lock()
 	a.stopped = true
 	close(a.eventStream)
+	a.cancelCtx()
 	a.batchCond.Broadcast()
 	a.batchCond.L.Unlock()
+	a.waitEventHandlers()
+	if ca, ok := a.action.(connectedAction); ok {
+		ca.close()
+	}
+	a.deadLetter.close()
+	a.circuit.close()
 }
 
 // suspend only stops the dispatcher, pushing back as if we're in blocking mode
@@ -333,16 +779,33 @@ func (a *eventStream) suspend() {
 	a.batchCond.L.Unlock()
 }
 
+// scheduleResume calls resume after the delay, replacing any resume already scheduled
+func (a *eventStream) scheduleResume(delay time.Duration, resume func()) {
+	a.batchCond.L.Lock()
+	defer a.batchCond.L.Unlock()
+	if a.resumeTimer != nil {
+		a.resumeTimer.Stop()
+	}
+	a.resumeTimer = time.AfterFunc(delay, resume)
+}
+
+func (a *eventStream) cancelScheduledResume() {
+	a.batchCond.L.Lock()
+	defer a.batchCond.L.Unlock()
+	if a.resumeTimer != nil {
+		a.resumeTimer.Stop()
+		a.resumeTimer = nil
+	}
+}
+
 // resume resumes the dispatcher
 func (a *eventStream) resume() error {
 	a.batchCond.L.Lock()
 	defer a.batchCond.L.Unlock()
-	if !a.processorDone || !a.pollerDone {
+	if !a.processor.isDone() || !a.poller.isDone() {
 		return errors.Errorf(errors.EventStreamsResumeActive, *a.spec.Suspended)
 	}
 	a.spec.Suspended = &falseValue
-	a.processorDone = false
-	a.pollerDone = false
 
 	a.startEventHandlers(true)
 	a.batchCond.Broadcast()
@@ -354,16 +817,26 @@ func (a *eventStream) resume() error {
 // block or skip. It's just with skip we eventually move onto new messages
 // after the retries etc. are complete
 func (a *eventStream) isBlocked() bool {
+	batchSize := a.batchSize()
+	concurrency := a.concurrency()
 	a.batchCond.L.Lock()
 	inFlight := a.inFlight
-	v := inFlight >= a.spec.BatchSize
+	v := inFlight >= batchSize*uint64(concurrency)
 	a.batchCond.L.Unlock()
 	if v {
-		log.Warnf("%s: Is currently blocked. InFlight=%d BatchSize=%d", a.spec.ID, inFlight, a.spec.BatchSize)
+		log.Warnf("%s: Is currently blocked. InFlight=%d BatchSize=%d Concurrency=%d", a.spec.ID, inFlight, batchSize, concurrency)
 	}
 	return v
 }
 
+// batchSize is the configured size of batches, or the current tuned size if it is "auto"
+func (a *eventStream) batchSize() uint64 {
+	if a.batchTuner != nil {
+		return a.batchTuner.size()
+	}
+	return a.spec.BatchSize
+}
+
 func (a *eventStream) markAllSubscriptionsStale(_ context.Context) {
 	// Mark all subscriptions stale, so they will re-start from the checkpoint if/when we re-run the poller
 	subs := a.sm.subscriptionsForStream(a.spec.ID)
@@ -372,25 +845,31 @@ func (a *eventStream) markAllSubscriptionsStale(_ context.Context) {
 	}
 }
 
-// eventPoller checks every few seconds against the Fabric node for any
-// new events on the subscriptions that are registered for this stream
-func (a *eventStream) eventPoller() {
-	defer a.updateWG.Done()
-
-	ctx := auth.NewSystemAuthContext()
-
-	defer func() { a.pollerDone = true }()
+// shardPoller checks every few seconds against the Fabric node for any new events on the
+// subscriptions of this stream in a shard, and records the checkpoint of the shard
+func (a *eventStream) shardPoller(pollerCtx context.Context, shard int) {
+	var ctx context.Context
 	var checkpoint map[string]uint64
+	cpID := checkpointShardID(a.spec.ID, shard, a.pollerShards)
 	for !a.suspendOrStop() {
 		var err error
+		// Resolve the identity the poller runs as (should only be first time round)
+		if ctx == nil {
+			if ctx, err = auth.NewServiceAuthContext(pollerCtx, a.spec.ServiceIdentity); err != nil {
+				log.Errorf("%s: Failed to establish auth context: %s", a.spec.ID, err)
+			} else if a.spec.ServiceIdentity != "" {
+				log.Infof("%s: Event poller running as service identity '%s'", a.spec.ID, a.spec.ServiceIdentity)
+			}
+			a.setPollerErrored(err)
+		}
 		// Load the checkpoint (should only be first time round)
-		if len(checkpoint) == 0 {
-			if checkpoint, err = a.sm.loadCheckpoint(a.spec.ID); err != nil {
-				log.Errorf("%s: Failed to load checkpoint: %s", a.spec.ID, err)
+		if err == nil && len(checkpoint) == 0 {
+			if checkpoint, err = a.sm.loadCheckpoint(cpID); err != nil {
+				log.Errorf("%s: Failed to load checkpoint: %s", cpID, err)
 			}
 		}
 		// If we're not blocked, then grab some more events
-		subs := a.sm.subscriptionsForStream(a.spec.ID)
+		subs := a.shardSubscriptions(shard)
 		if err == nil && !a.isBlocked() {
 			for _, sub := range subs {
 				// We do the reset on the event processing thread, to avoid any concurrency issue.
@@ -401,24 +880,27 @@ func (a *eventStream) eventPoller() {
 					delete(checkpoint, sub.info.ID)
 				}
 				if sub.filterStale && !sub.deleting {
-					blockHeight, exists := checkpoint[sub.info.ID]
-					if !exists || blockHeight <= 0 {
-						blockHeight, err = sub.setInitialBlockHeight(ctx)
-					} else {
-						sub.setCheckpointBlockHeight(blockHeight)
-					}
-					if err == nil {
-						err = sub.restartFilter(ctx, blockHeight)
+					// a channel that has not been joined fails clearly here, rather than in each query below
+					if err = sub.checkChannelMembership(ctx); err == nil {
+						blockHeight, exists := checkpoint[sub.info.ID]
+						if !exists || blockHeight <= 0 {
+							blockHeight, err = sub.setInitialBlockHeight(ctx)
+						} else {
+							sub.setCheckpointBlockHeight(blockHeight)
+							blockHeight, err = sub.checkHeightRegression(ctx, blockHeight)
+						}
+						if err == nil {
+							err = sub.restartFilter(ctx, blockHeight)
+						}
 					}
 				}
-				if err != nil {
-					log.Errorf("%s: subscription error: %s", a.spec.ID, err)
-					err = nil
-				}
+				sub.setErrored(a.sm, err)
+				err = nil
 			}
 		}
 		// Record a new checkpoint if needed
 		if checkpoint != nil {
+			a.checkpointMux.Lock()
 			changed := false
 			for _, sub := range subs {
 				i1 := checkpoint[sub.info.ID]
@@ -428,37 +910,34 @@ func (a *eventStream) eventPoller() {
 				checkpoint[sub.info.ID] = i2
 			}
 			if changed {
-				if err = a.sm.storeCheckpoint(a.spec.ID, checkpoint); err != nil {
-					log.Errorf("%s: Failed to store checkpoint: %s", a.spec.ID, err)
+				if err = a.sm.storeCheckpoint(cpID, checkpoint); err != nil {
+					log.Errorf("%s: Failed to store checkpoint: %s", cpID, err)
 				}
 			}
+			a.checkpointMux.Unlock()
 		}
 
 		// the event poller reacts to notification about a stream update, else it starts
 		// another round of polling after completion of the pollingInterval
 		select {
-		case <-a.updateInterrupt:
-			// we were notified by the caller about an ongoing update, no need to continue
-			log.Infof("%s: Notified of an ongoing stream update, exiting event poller", a.spec.ID)
-			a.markAllSubscriptionsStale(ctx)
+		case <-pollerCtx.Done():
+			// we were interrupted for an update, or the stream was stopped, no need to continue
+			log.Infof("%s: Interrupted, exiting event poller", a.spec.ID)
 			return
 		case <-time.After(a.pollingInterval): // fall through and continue to the next iteration
 		}
 	}
-
-	a.markAllSubscriptionsStale(ctx)
-
 }
 
 // batchDispatcher is the goroutine that is always available to read new
 // events and form them into batches. Because we can't be sure how many
 // events we'll be dispatched from blocks before the IsBlocked() feedback
 // loop protects us, this logic has to build a list of batches
-func (a *eventStream) batchDispatcher() {
+func (a *eventStream) batchDispatcher(ctx context.Context) {
 	var currentBatch []*eventData
+	var batchBytes uint64
 	var batchStart time.Time
 	batchTimeout := time.Duration(a.spec.BatchTimeoutMS) * time.Millisecond
-	defer a.updateWG.Done()
 	for {
 		// Wait for the next event - if we're in the middle of a batch, we
 		// need to cope with a timeout
@@ -466,32 +945,31 @@ func (a *eventStream) batchDispatcher() {
 		timeout := false
 		if len(currentBatch) > 0 {
 			// Existing batch
-			timeLeft := time.Until(batchStart.Add(batchTimeout))
-			ctx, cancel := context.WithTimeout(context.Background(), timeLeft)
+			timer := time.NewTimer(time.Until(batchStart.Add(batchTimeout)))
 			select {
-			case <-ctx.Done():
-				cancel()
+			case <-timer.C:
 				timeout = true
 			case event := <-a.eventStream:
-				cancel()
+				timer.Stop()
 				if event == nil {
 					log.Infof("%s: Event stream stopped while waiting for in-flight batch to fill", a.spec.ID)
 					return
 				}
 				currentBatch = append(currentBatch, event)
+				batchBytes += a.eventBytes(event)
 				log.Infof("%s: Updated batch length %d", a.spec.ID, len(currentBatch))
-			case <-a.updateInterrupt:
-				// we were notified by the caller about an ongoing update, cancel the timeout ctx and return
-				log.Infof("%s: Notified of an ongoing stream update, will not dispatch batch", a.spec.ID)
-				cancel() // cancel the ctx which was started to track timeout
+			case <-ctx.Done():
+				// we were interrupted for an update, or the stream was stopped
+				log.Infof("%s: Interrupted, will not dispatch batch", a.spec.ID)
+				timer.Stop()
 				return
 			}
 		} else {
 			// New batch - react to an update notification or process the next set of events from the stream
 			select {
-			case <-a.updateInterrupt:
-				// we were notified by the caller about an ongoing update, return
-				log.Infof("%s: Notified of an ongoing stream update, not waiting for new events", a.spec.ID)
+			case <-ctx.Done():
+				// we were interrupted for an update, or the stream was stopped
+				log.Infof("%s: Interrupted, not waiting for new events", a.spec.ID)
 				return
 			case event := <-a.eventStream:
 				if event == nil {
@@ -499,17 +977,25 @@ func (a *eventStream) batchDispatcher() {
 					return
 				}
 				currentBatch = []*eventData{event}
+				batchBytes = a.eventBytes(event)
 				log.Infof("%s: New batch length %d", a.spec.ID, len(currentBatch))
 				batchStart = time.Now()
 			}
 		}
-		if timeout || uint64(len(currentBatch)) == a.spec.BatchSize {
+		if timeout || uint64(len(currentBatch)) >= a.batchSize() || (a.spec.BatchMaxBytes > 0 && batchBytes >= a.spec.BatchMaxBytes) {
 			// We are ready to dispatch the batch
 			a.batchCond.L.Lock()
 			if !timeout {
 				a.inFlight++
 			}
-			a.batchQueue.PushBack(currentBatch)
+			if a.concurrency() > 1 {
+				// the batches of different subscriptions can then be delivered in parallel
+				for _, batch := range splitBySubscription(currentBatch) {
+					a.batchQueue.PushBack(batch)
+				}
+			} else {
+				a.batchQueue.PushBack(currentBatch)
+			}
 			a.batchCond.Broadcast()
 			a.batchCond.L.Unlock()
 			currentBatch = []*eventData{}
@@ -522,85 +1008,180 @@ func (a *eventStream) batchDispatcher() {
 	}
 }
 
+// eventBytes is the size of an event as JSON, which is only measured when the batches of the
+// stream are limited by bytes
+func (a *eventStream) eventBytes(event *eventData) uint64 {
+	if a.spec.BatchMaxBytes == 0 {
+		return 0
+	}
+	return uint64(event.jsonSize())
+}
+
 func (a *eventStream) suspendOrStop() bool {
 	return *a.spec.Suspended || a.stopped
 }
 
 // batchProcessor picks up batches from the batchDispatcher, and performs the blocking
-// actions required to perform the action itself.
+// actions required to perform the action itself, with a worker for each batch the stream
+// delivers in parallel
+func (a *eventStream) batchProcessor(ctx context.Context) {
+	workers := a.concurrency()
+	if workers == 1 {
+		a.batchWorker(ctx)
+		return
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.batchWorker(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// batchWorker processes batches one at a time until the stream is suspended or stopped.
 // We use a sync.Cond rather than a channel to communicate with this goroutine, as
 // it might be blocked for very large periods of time
-func (a *eventStream) batchProcessor() {
-	defer func() { a.processorDone = true }()
+func (a *eventStream) batchWorker(ctx context.Context) {
 	for {
-		// Wait for the next batch, or to be stopped
+		// Wait for the next batch, or to be stopped. The context is cancelled with the lock
+		// held, so we cannot miss the broadcast that follows
 		a.batchCond.L.Lock()
-		for !a.suspendOrStop() && a.batchQueue.Len() == 0 {
-			if a.updateInProgress {
-				<-a.updateInterrupt
-				// we were notified by the caller about an ongoing update, return
-				log.Infof("%s: Notified of an ongoing stream update, exiting batch processor", a.spec.ID)
-				a.updateWG.Done() // Not moving this to a 'defer' since we need to unlock after calling Done()
-				a.batchCond.L.Unlock()
-				return
+		var batch []*eventData
+		var subs []string
+		for !a.suspendOrStop() && ctx.Err() == nil {
+			if batch, subs = a.nextBatch(); batch != nil {
+				break
 			}
 			a.batchCond.Wait()
 		}
+		if ctx.Err() != nil {
+			log.Infof("%s: Interrupted, exiting batch processor", a.spec.ID)
+			a.batchCond.L.Unlock()
+			return
+		}
 		if a.suspendOrStop() {
 			log.Infof("%s: Suspended, returning exiting batch processor", a.spec.ID)
 			a.batchCond.L.Unlock()
 			return
 		}
-		batchElem := a.batchQueue.Front()
 		a.batchCount++
 		batchNumber := a.batchCount
-		a.batchQueue.Remove(batchElem)
 		a.batchCond.L.Unlock()
 		// Process the batch - could block for a very long time, particularly if
-		// ErrorHandlingBlock is configured.
-		// Track this as an item in the update wait group
-		a.updateWG.Add(1)
-		a.processBatch(batchNumber, batchElem.Value.([]*eventData))
+		// ErrorHandlingBlock is configured, until the context is cancelled
+		a.processBatch(ctx, batchNumber, batch)
+		a.batchCond.L.Lock()
+		a.releaseBatch(subs)
+		a.batchCond.L.Unlock()
 	}
 }
 
 // processBatch is the blocking function to process a batch of events
 // It never returns an error, and uses the chosen block/skip ErrorHandling
 // behaviour combined with the parameters on the event itself
-func (a *eventStream) processBatch(batchNumber uint64, events []*eventData) {
-	defer a.updateWG.Done()
+func (a *eventStream) processBatch(ctx context.Context, batchNumber uint64, events []*eventData) {
 	if len(events) == 0 {
 		return
 	}
+	// however we exit, the batch is finished with. Anything not acknowledged is redelivered from the checkpoint
+	defer func() {
+		for _, event := range events {
+			event.release()
+		}
+	}()
 	processed := false
 	attempt := 0
-	for !a.suspendOrStop() && !processed {
+	atMostOnce := a.spec.DeliverySemantics == DeliveryAtMostOnce
+	checkpointed := false // when delivering at most once, the batch is only attempted once it is checkpointed
+	var nextRetry time.Time
+	firstEvent := retryStateEventKey(events[0].event)
+	// If this is a batch that was blocked when we restarted, resume its backoff schedule
+	retryPersisted := false
+	if resume := a.takeResumeRetry(firstEvent); resume != nil {
+		log.Infof("%s: Resuming retries of blocked batch %d from attempt %d. NextRetry=%s", a.spec.ID, batchNumber, resume.Attempt, resume.NextRetry)
+		attempt = resume.Attempt
+		nextRetry = resume.NextRetry
+		retryPersisted = true
+	}
+	for !a.suspendOrStop() && ctx.Err() == nil && !processed {
 		if attempt > 0 {
 			select {
-			case <-a.updateInterrupt:
-				// we were notified by the caller about an ongoing update, no need to continue
-				log.Infof("%s: Notified of an ongoing stream update, terminating process batch", a.spec.ID)
+			case <-ctx.Done():
+				// we were interrupted for an update, or the stream was stopped, no need to continue
+				log.Infof("%s: Interrupted, terminating process batch", a.spec.ID)
 				return
-			case <-time.After(time.Duration(a.spec.BlockedRetryDelaySec) * time.Second): // fall through and continue
+			case <-time.After(time.Until(nextRetry)): // fall through and continue
 			}
 		}
 		attempt++
 		log.Infof("%s: Batch %d initiated with %d events. FirstBlock=%d LastBlock=%d", a.spec.ID, batchNumber, len(events), events[0].event.BlockNumber, events[len(events)-1].event.BlockNumber)
-		a.updateWG.Add(1)
 		eventEntries := make([]*eventsapi.EventEntry, len(events))
 		for i, entry := range events {
 			eventEntries[i] = entry.event
 		}
-		err := a.performActionWithRetry(batchNumber, eventEntries)
+		attemptStart := time.Now()
+		var err error
+		if atMostOnce {
+			if err = a.checkpointBatch(events); err == nil {
+				checkpointed = true
+				// a single attempt, as the endpoint may have accepted a batch that appeared to fail
+				err = a.attemptBatch(ctx, batchNumber, 1, eventEntries)
+			}
+		} else {
+			err = a.performActionWithRetry(ctx, batchNumber, eventEntries)
+		}
+		if ctx.Err() != nil {
+			// an attempt cut short by an update or stop is not a failure of the action, and the
+			// events are redelivered from the checkpoint
+			log.Infof("%s: Interrupted, terminating process batch", a.spec.ID)
+			return
+		}
+		if !a.suspendOrStop() {
+			a.setErrored(err)
+			a.counters.record(events, time.Since(attemptStart), err)
+			if err == nil {
+				a.recordUsage(events)
+				recordEventTypes(events)
+			}
+			if a.batchTuner != nil {
+				a.batchTuner.record(len(events), time.Since(attemptStart), err)
+			}
+			a.recordCircuit(err)
+		}
 		// If we got an error after all of the internal retries within the event
 		// handler failed, then the ErrorHandling strategy kicks in
 		processed = (err == nil)
 		if !processed {
 			log.Errorf("%s: Batch %d attempt %d failed. ErrorHandling=%s BlockedRetryDelay=%ds",
 				a.spec.ID, batchNumber, attempt, a.spec.ErrorHandling, a.spec.BlockedRetryDelaySec)
-			processed = (a.spec.ErrorHandling == ErrorHandlingSkip)
+			processed = (a.spec.ErrorHandling == ErrorHandlingSkip) || checkpointed
+			if processed && !a.suspendOrStop() {
+				a.writeDeadLetter(ctx, batchNumber, attempt, err, eventEntries)
+			}
+		}
+		if processed {
+			notifyOutboxes(events, err)
+		}
+		if !processed {
+			delay := time.Duration(a.spec.BlockedRetryDelaySec) * time.Second
+			if retryAfter := retryAfterOf(err); retryAfter > delay {
+				delay = retryAfter
+			}
+			nextRetry = time.Now().Add(delay)
+			state := &retryState{FirstEvent: firstEvent, Attempt: attempt, NextRetry: nextRetry}
+			if err := a.sm.storeRetryState(a.spec.ID, state); err != nil {
+				log.Errorf("%s: Failed to store retry state of batch %d: %s", a.spec.ID, batchNumber, err)
+			} else {
+				retryPersisted = true
+			}
 		}
 	}
+	if processed && retryPersisted && !a.suspendOrStop() {
+		a.sm.deleteRetryState(a.spec.ID, firstEvent)
+	}
 
 	// decrement the in-flight count if we've processed (wouldn't have occurred if we were suspended or stopped)
 	a.batchCond.L.Lock()
@@ -626,39 +1207,174 @@ func (a *eventStream) processBatch(batchNumber uint64, events []*eventData) {
 	}
 }
 
-// performActionWithRetry performs an action, with exponential backoff retry up
-// to a given threshold
-func (a *eventStream) performActionWithRetry(batchNumber uint64, events []*eventsapi.EventEntry) (err error) {
+// recordUsage accounts the delivered events to the signers of their subscriptions
+func (a *eventStream) recordUsage(events []*eventData) {
+	counters := a.sm.getUsage()
+	type tenantUsage struct{ events, bytes int }
+	byTenant := make(map[string]*tenantUsage)
+	for _, event := range events {
+		t, ok := byTenant[event.tenant]
+		if !ok {
+			t = &tenantUsage{}
+			byTenant[event.tenant] = t
+		}
+		t.events++
+		t.bytes += event.jsonSize()
+	}
+	for tenant, t := range byTenant {
+		counters.RecordEvents(tenant, t.events, t.bytes)
+	}
+}
+
+// setErrored notifies the transitions of the stream between delivering, and failing
+// to deliver batches after all retries
+func (a *eventStream) setErrored(err error) {
+	a.erroredMux.Lock()
+	defer a.erroredMux.Unlock()
+	if (err != nil) == a.errored {
+		return
+	}
+	a.errored = err != nil
+	if a.errored {
+		a.sm.publishLifecycleEvent(StreamErrored, a.spec.ID, nil, nil, err)
+	} else {
+		a.sm.publishLifecycleEvent(StreamRecovered, a.spec.ID, nil, nil, nil)
+	}
+}
+
+// setPollerErrored records why the poller cannot run, or clears it once it can, to be returned
+// in the status of the stream
+func (a *eventStream) setPollerErrored(err error) {
+	reason := ""
+	if err != nil {
+		reason = err.Error()
+	}
+	a.erroredMux.Lock()
+	a.pollerErrored = reason
+	a.erroredMux.Unlock()
+}
+
+func (a *eventStream) pollerErroredReason() string {
+	a.erroredMux.Lock()
+	defer a.erroredMux.Unlock()
+	return a.pollerErrored
+}
+
+// performActionWithRetry performs an action, with backoff retry up
+// to a given threshold, using the retry strategy of the stream
+func (a *eventStream) performActionWithRetry(ctx context.Context, batchNumber uint64, events []*eventsapi.EventEntry) (err error) {
 	startTime := time.Now()
 	endTime := startTime.Add(time.Duration(a.spec.RetryTimeoutSec) * time.Second)
-	delay := a.initialRetryDelay
+	backoff := &utils.Backoff{
+		Strategy: a.spec.RetryStrategy,
+		Initial:  a.initialRetryDelay,
+		Factor:   a.backoffFactor,
+		Jitter:   a.spec.RetryJitter,
+	}
 	var attempt uint64
 	complete := false
-	defer a.updateWG.Done()
 
 	for !a.suspendOrStop() && !complete {
 		if attempt > 0 {
-			log.Infof("%s: Waiting %.2fs before re-attempting batch %d", a.spec.ID, delay.Seconds(), batchNumber)
+			// the endpoint can ask for longer than the backoff, but not to be retried sooner
+			wait := backoff.Delay(int(attempt))
+			if retryAfter := retryAfterOf(err); retryAfter > wait {
+				wait = retryAfter
+			}
+			log.Infof("%s: Waiting %.2fs before re-attempting batch %d", a.spec.ID, wait.Seconds(), batchNumber)
 			select {
-			case <-a.updateInterrupt:
-				// we were notified by the caller about an ongoing update, no need to continue
-				log.Infof("%s: Notified of an ongoing stream update, terminating perform action for batch number: %d", a.spec.ID, batchNumber)
-				return
-			case <-time.After(delay): // fall through and continue
+			case <-ctx.Done():
+				// we were interrupted for an update, or the stream was stopped, no need to continue
+				log.Infof("%s: Interrupted, terminating perform action for batch number: %d", a.spec.ID, batchNumber)
+				return ctx.Err()
+			case <-time.After(wait): // fall through and continue
 			}
-			delay = time.Duration(float64(delay) * a.backoffFactor)
 		}
 		attempt++
-		err = a.action.attemptBatch(batchNumber, attempt, events)
+		err = a.attemptBatch(ctx, batchNumber, attempt, events)
+		if ctx.Err() != nil {
+			return err
+		}
 		complete = err == nil || time.Until(endTime) < 0
+		if isPermanentDeliveryError(err) {
+			log.Errorf("%s: Batch %d failed with an error that is not retried: %s", a.spec.ID, batchNumber, err)
+			complete = true
+		} else if retryAfter := retryAfterOf(err); retryAfter > 0 && time.Now().Add(retryAfter).After(endTime) {
+			// the endpoint will not accept the batch before the retries run out
+			complete = true
+		}
 	}
 	return err
 }
 
-// isAddressSafe checks for local IPs
-func (a *eventStream) isAddressUnsafe(ip *net.IPAddr) bool {
+// attemptBatch makes one attempt to deliver a batch, holding one of the delivery slots that are
+// shared with the other streams in priority order. The slot is released before any wait to retry,
+// so streams whose consumers are failing do not keep the slots from the others
+func (a *eventStream) attemptBatch(ctx context.Context, batchNumber, attempt uint64, events []*eventsapi.EventEntry) error {
+	scheduler := a.sm.getScheduler()
+	if !scheduler.acquire(a.spec.Priority, ctx.Done()) {
+		log.Infof("%s: Interrupted waiting for a delivery slot for batch %d", a.spec.ID, batchNumber)
+		return ctx.Err()
+	}
+	defer scheduler.release()
+	return a.action.attemptBatch(ctx, batchNumber, attempt, events)
+}
+
+// validateDeliverySemantics checks the delivery semantics of a stream, and returns them normalized
+// to lower case
+func validateDeliverySemantics(semantics string) (string, error) {
+	if semantics == "" {
+		return "", nil
+	}
+	semantics = strings.ToLower(semantics)
+	if semantics != DeliveryAtLeastOnce && semantics != DeliveryAtMostOnce {
+		return "", errors.Errorf(errors.EventStreamsInvalidDeliverySemantics, semantics)
+	}
+	return semantics, nil
+}
+
+// checkpointBatch moves the checkpoints of the subscriptions of a batch past its events, and stores
+// them, before a batch is delivered at most once. A restart then carries on after the batch, even
+// if it was not delivered
+func (a *eventStream) checkpointBatch(events []*eventData) error {
+	shards := make(map[int]bool)
+	for _, event := range events {
+		event.batchComplete(event.event)
+		shards[subscriptionShard(event.event.SubID, a.pollerShards)] = true
+	}
+	a.checkpointMux.Lock()
+	defer a.checkpointMux.Unlock()
+	for shard := range shards {
+		checkpoint := make(map[string]uint64)
+		for _, sub := range a.shardSubscriptions(shard) {
+			checkpoint[sub.info.ID] = sub.blockHWM()
+		}
+		if err := a.sm.storeCheckpoint(checkpointShardID(a.spec.ID, shard, a.pollerShards), checkpoint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateRetryBackoff checks the retries of a batch do not come ever sooner, where zero means the default
+func validateRetryBackoff(factor float64) error {
+	if factor != 0 && factor < 1 {
+		return errors.Errorf(errors.EventStreamsInvalidRetryBackoffFactor, factor)
+	}
+	return nil
+}
+
+// webhookPolicy is the policy for the hosts and addresses the webhook of the stream is sent to
+func (a *eventStream) webhookPolicy() *webhookPolicy {
+	return &webhookPolicy{
+		allowPrivateIPs: a.allowPrivateIPs,
+		allowedHosts:    a.sm.getConfig().Webhooks.AllowedHosts,
+	}
+}
+
+func isAddressUnsafe(ip *net.IPAddr, allowPrivateIPs bool) bool {
 	ip4 := ip.IP.To4()
-	return !a.allowPrivateIPs &&
+	return !allowPrivateIPs &&
 		(ip4[0] == 0 ||
 			ip4[0] >= 224 ||
 			ip4[0] == 127 ||
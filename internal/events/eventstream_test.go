@@ -17,17 +17,32 @@
 package events
 
 import (
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
 	"github.com/hyperledger/firefly-fabconnect/internal/conf"
 	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
 	"github.com/hyperledger/firefly-fabconnect/internal/kvstore"
+	restutil "github.com/hyperledger/firefly-fabconnect/internal/rest/utils"
+	"github.com/hyperledger/firefly-fabconnect/internal/utils"
 	mockfabric "github.com/hyperledger/firefly-fabconnect/mocks/fabric/client"
 	mockkvstore "github.com/hyperledger/firefly-fabconnect/mocks/kvstore"
+	"github.com/julienschmidt/httprouter"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -53,8 +68,12 @@ func TestStopDuringTimeout(t *testing.T) {
 	stream.handleEvent(testEvent("sub1"))
 	time.Sleep(10 * time.Millisecond)
 	stream.stop()
-	time.Sleep(10 * time.Millisecond)
-	assert.True(stream.processorDone)
+	// stop returns once the goroutines of the stream have all exited
+	assert.True(stream.poller.isDone())
+	assert.True(stream.dispatcher.isDone())
+	assert.True(stream.processor.isDone())
+	// any calls still in flight to the node on behalf of the stream are abandoned
+	assert.Equal(context.Canceled, stream.ctx.Err())
 }
 
 func TestBatchSizeCap(t *testing.T) {
@@ -118,6 +137,54 @@ func TestBlockingBehavior(t *testing.T) {
 	assert.False(complete)
 }
 
+func TestBlockedStreamReleasesDeliverySlot(t *testing.T) {
+	assert := assert.New(t)
+	sm, blocked, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			BatchSize: 1,
+			Webhook: &webhookActionInfo{
+				TLSkipHostVerify: &falseValue,
+			},
+			ErrorHandling:        ErrorHandlingBlock,
+			BlockedRetryDelaySec: 30,
+			RetryTimeoutSec:      30,
+		}, nil, 500)
+	defer svr.Close()
+	defer blocked.stop()
+	// a single delivery slot, shared by the two streams
+	sm.scheduler = newPriorityScheduler(1)
+	go func() {
+		for range eventStream {
+		}
+	}()
+	defer close(eventStream)
+
+	delivered := make(chan struct{})
+	healthySvr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		close(delivered)
+	}))
+	defer healthySvr.Close()
+	spec := &StreamInfo{
+		Type:      "webhook",
+		BatchSize: 1,
+		Webhook:   &webhookActionInfo{URL: healthySvr.URL},
+	}
+	err := sm.addStream(spec)
+	assert.NoError(err)
+	healthy := sm.streams[spec.ID]
+	defer healthy.stop()
+
+	blocked.handleEvent(testEvent("sub1"))
+	time.Sleep(100 * time.Millisecond)
+	// the blocked stream is waiting to retry, without holding the slot
+	healthy.handleEvent(testEvent("sub2"))
+	select {
+	case <-delivered:
+	case <-time.After(5 * time.Second):
+		assert.Fail("the healthy stream was stalled by the blocked stream")
+	}
+}
+
 func TestSkippingBehavior(t *testing.T) {
 	_, stream, svr, eventStream := newTestStreamForBatching(
 		&StreamInfo{
@@ -149,6 +216,48 @@ func TestSkippingBehavior(t *testing.T) {
 	// reaching here despite the 404s means we passed
 }
 
+func TestAtMostOnceDelivery(t *testing.T) {
+	assert := assert.New(t)
+	db := &mockkvstore.KVStore{}
+	_, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			BatchSize: 1,
+			Webhook: &webhookActionInfo{
+				TLSkipHostVerify: &falseValue,
+			},
+			ErrorHandling:        ErrorHandlingBlock,
+			DeliverySemantics:    DeliveryAtMostOnce,
+			RetryTimeoutSec:      10,
+			BlockedRetryDelaySec: 1,
+		}, db, 500)
+	defer close(eventStream)
+	defer svr.Close()
+	defer stream.stop()
+	stream.initialRetryDelay = 1 * time.Millisecond
+
+	// the batch is checkpointed before it is delivered, and is not retried when it fails
+	var complete atomic.Bool
+	stream.handleEvent(&eventData{
+		event: &eventsapi.EventEntry{
+			SubID: "sub1",
+		},
+		batchComplete: func(*eventsapi.EventEntry) { complete.Store(true) },
+	})
+	<-eventStream
+	assert.True(complete.Load())
+	db.AssertCalled(t, "Put", checkpointIDPrefix+stream.spec.ID, mock.Anything)
+	select {
+	case <-eventStream:
+		assert.Fail("batch delivered twice")
+	case <-time.After(1500 * time.Millisecond):
+	}
+
+	_, err := validateDeliverySemantics("exactly-once")
+	assert.EqualError(err, "Invalid deliverySemantics 'exactly-once'. Must be 'at-least-once' or 'at-most-once'")
+	_, err = stream.update(&StreamInfo{DeliverySemantics: "exactly-once"})
+	assert.Regexp("Invalid deliverySemantics", err)
+}
+
 func TestBackoffRetry(t *testing.T) {
 	assert := assert.New(t)
 	_, stream, svr, eventStream := newTestStreamForBatching(
@@ -300,6 +409,44 @@ func TestBatchTimeout(t *testing.T) {
 
 }
 
+func TestBatchMaxBytes(t *testing.T) {
+	assert := assert.New(t)
+	eventBytes, _ := json.Marshal(testEvent("sub0").event)
+	_, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			BatchSize:      10,
+			BatchTimeoutMS: 10000,
+			BatchMaxBytes:  uint64(len(eventBytes)*2 + 1),
+			Webhook: &webhookActionInfo{
+				TLSkipHostVerify: &falseValue,
+			},
+		}, nil, 200)
+	defer close(eventStream)
+	defer svr.Close()
+	defer stream.stop()
+
+	// the batch is dispatched with the event that crosses the limit, well before the timeout
+	var e1s, e2s []*eventsapi.EventEntry
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		e1s = <-eventStream
+		e2s = <-eventStream
+		wg.Done()
+	}()
+	for i := 0; i < 6; i++ {
+		stream.handleEvent(testEvent(fmt.Sprintf("sub%d", i)))
+	}
+	wg.Wait()
+	assert.Equal(3, len(e1s))
+	assert.Equal(3, len(e2s))
+
+	_, err := stream.update(&StreamInfo{BatchMaxBytes: 1024})
+	assert.NoError(err)
+	assert.Equal(uint64(1024), stream.spec.BatchMaxBytes)
+	assert.Equal(uint64(10), stream.spec.BatchSize)
+}
+
 func TestBuildup(t *testing.T) {
 	assert := assert.New(t)
 	_, stream, svr, eventStream := newTestStreamForBatching(
@@ -535,19 +682,20 @@ func TestInterruptWebSocketBroadcast(t *testing.T) {
 		receiver: make(chan error),
 	}
 	es := &eventStream{
-		wsChannels:      wsChannels,
-		updateInterrupt: make(chan struct{}),
+		spec:       &StreamInfo{},
+		wsChannels: wsChannels,
 	}
+	ctx, cancel := context.WithCancel(context.Background())
 	sio, _ := newWebSocketAction(es, &webSocketActionInfo{
 		DistributionMode: "broadcast",
 	})
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
-		close(es.updateInterrupt)
+		cancel()
 		wg.Done()
 	}()
-	_ = sio.attemptBatch(0, 1, []*eventsapi.EventEntry{})
+	_ = sio.attemptBatch(ctx, 0, 1, []*eventsapi.EventEntry{})
 	wg.Wait()
 }
 
@@ -557,17 +705,18 @@ func TestInterruptWebSocketSend(t *testing.T) {
 		receiver: make(chan error),
 	}
 	es := &eventStream{
-		wsChannels:      wsChannels,
-		updateInterrupt: make(chan struct{}),
+		spec:       &StreamInfo{},
+		wsChannels: wsChannels,
 	}
+	ctx, cancel := context.WithCancel(context.Background())
 	sio, _ := newWebSocketAction(es, &webSocketActionInfo{})
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
-		close(es.updateInterrupt)
+		cancel()
 		wg.Done()
 	}()
-	_ = sio.attemptBatch(0, 1, []*eventsapi.EventEntry{})
+	_ = sio.attemptBatch(ctx, 0, 1, []*eventsapi.EventEntry{})
 	wg.Wait()
 }
 
@@ -579,18 +728,19 @@ func TestInterruptWebSocketReceive(t *testing.T) {
 		closing:   make(chan struct{}),
 	}
 	es := &eventStream{
-		wsChannels:      wsChannels,
-		updateInterrupt: make(chan struct{}),
+		spec:       &StreamInfo{},
+		wsChannels: wsChannels,
 	}
+	ctx, cancel := context.WithCancel(context.Background())
 	sio, _ := newWebSocketAction(es, &webSocketActionInfo{})
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
 		<-wsChannels.sender
-		close(es.updateInterrupt)
+		cancel()
 		wg.Done()
 	}()
-	_ = sio.attemptBatch(0, 1, []*eventsapi.EventEntry{})
+	_ = sio.attemptBatch(ctx, 0, 1, []*eventsapi.EventEntry{})
 	wg.Wait()
 }
 
@@ -635,11 +785,19 @@ func TestPauseResumeAfterCheckpoint(t *testing.T) {
 		}
 	}
 	stream.suspend()
-	for !stream.pollerDone {
+	for !stream.poller.isDone() {
 		time.Sleep(1 * time.Millisecond)
 	}
 
-	// Restart from the checkpoint that was stored
+	// Restart from the checkpoint that was stored, which the chain has reached
+	rpc := sm.rpc.(*mockfabric.RPCClient)
+	for _, call := range rpc.ExpectedCalls {
+		if call.Method == "QueryChainInfo" {
+			call.Unset()
+			break
+		}
+	}
+	rpc.On("QueryChainInfo", mock.Anything, mock.Anything, mock.Anything).Return(&fab.BlockchainInfoResponse{BCI: &common.BlockchainInfo{Height: 20}}, nil)
 	sub := sm.subscriptions[s.ID]
 	sub.filterStale = true
 	_ = stream.resume()
@@ -648,9 +806,10 @@ func TestPauseResumeAfterCheckpoint(t *testing.T) {
 	}
 	wg.Wait()
 
-	calls := sm.rpc.(*mockfabric.RPCClient).Calls
-	assert.Equal(3, len(calls))
-	since := calls[2].Arguments.Get(1)
+	calls := rpc.Calls
+	assert.Equal(4, len(calls))
+	assert.Equal("QueryChainInfo", calls[2].Method)
+	since := calls[3].Arguments.Get(2)
 	// the "since" would have been based on the stored checkpoint
 	assert.Equal(uint64(12), since.(uint64))
 }
@@ -673,7 +832,7 @@ func TestPauseResumeBeforeCheckpoint(t *testing.T) {
 	defer stream.stop()
 
 	stream.suspend()
-	for !stream.pollerDone {
+	for !stream.poller.isDone() {
 		time.Sleep(1 * time.Millisecond)
 	}
 
@@ -697,7 +856,7 @@ func TestPauseResumeBeforeCheckpoint(t *testing.T) {
 
 	calls := sm.rpc.(*mockfabric.RPCClient).Calls
 	assert.Equal(2, len(calls))
-	since := calls[1].Arguments.Get(1)
+	since := calls[1].Arguments.Get(2)
 	// the "since" would have been based on the block height
 	// because no checkpoint was stored before the pause
 	assert.Equal(uint64(10), since.(uint64))
@@ -735,20 +894,21 @@ func TestMarkStaleOnError(t *testing.T) {
 	wg.Wait()
 
 	stream.suspend()
-	for !stream.pollerDone {
+	for !stream.poller.isDone() {
 		time.Sleep(1 * time.Millisecond)
 	}
 	assert.True(sub.filterStale)
 
 	rpc := &mockfabric.RPCClient{}
-	rpc.On("SubscribeEvent", mock.Anything, mock.Anything).Return(nil, nil, nil, fmt.Errorf("Failed to subscribe"))
+	rpc.On("QueryChainInfo", mock.Anything, mock.Anything, mock.Anything).Return(&fab.BlockchainInfoResponse{BCI: &common.BlockchainInfo{Height: 20}}, nil)
+	rpc.On("SubscribeEvent", mock.Anything, mock.Anything, mock.Anything).Return(nil, nil, nil, fmt.Errorf("Failed to subscribe"))
 	sub.client = rpc
 
 	_ = stream.resume()
-	for stream.pollerDone {
+	for stream.poller.isDone() {
 		time.Sleep(1 * time.Millisecond)
 	}
-	for len(rpc.Calls) < 1 {
+	for len(rpc.Calls) < 2 {
 		time.Sleep(1 * time.Millisecond)
 	}
 	assert.True(sub.filterStale)
@@ -774,11 +934,11 @@ func TestStoreCheckpointLoadError(t *testing.T) {
 	defer stream.stop()
 
 	stream.suspend()
-	for !stream.pollerDone {
+	for !stream.poller.isDone() {
 		time.Sleep(1 * time.Millisecond)
 	}
 	_ = stream.resume()
-	for stream.pollerDone {
+	for stream.poller.isDone() {
 		time.Sleep(1 * time.Millisecond)
 	}
 }
@@ -815,7 +975,7 @@ func TestStoreCheckpointStoreError(t *testing.T) {
 	wg.Wait()
 
 	stream.suspend()
-	for !stream.pollerDone {
+	for !stream.poller.isDone() {
 		time.Sleep(1 * time.Millisecond)
 	}
 }
@@ -839,7 +999,7 @@ func TestProcessBatchEmptyArray(t *testing.T) {
 	defer svr.Close()
 	defer stream.stop()
 
-	stream.processBatch(0, []*eventData{})
+	stream.processBatch(context.Background(), 0, []*eventData{})
 }
 
 func TestUpdateStream(t *testing.T) {
@@ -943,6 +1103,71 @@ func TestUpdateStreamWithDefaults(t *testing.T) {
 	assert.NoError(err)
 }
 
+func TestRetryBackoffSettings(t *testing.T) {
+	assert := assert.New(t)
+	_, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			RetryInitialDelayMS: 10,
+			Webhook: &webhookActionInfo{
+				TLSkipHostVerify: &falseValue,
+			},
+		}, nil, 200)
+	defer svr.Close()
+	defer close(eventStream)
+	defer stream.stop()
+
+	assert.Equal(10*time.Millisecond, stream.initialRetryDelay)
+	assert.Equal(DefaultExponentialBackoffFactor, stream.spec.RetryBackoffFactor)
+	assert.Equal(DefaultExponentialBackoffFactor, stream.backoffFactor)
+
+	_, err := stream.update(&StreamInfo{RetryBackoffFactor: 0.5})
+	assert.EqualError(err, "Invalid retryBackoffFactor 0.5. Must be at least 1")
+	_, err = stream.update(&StreamInfo{RetryBackoffFactor: 1.5})
+	assert.NoError(err)
+	assert.Equal(1.5, stream.backoffFactor)
+	assert.Equal(uint64(10), stream.spec.RetryInitialDelayMS)
+
+	// replacing the spec without them sets them back to their defaults
+	newSpec := *stream.spec
+	newSpec.RetryInitialDelayMS = 0
+	newSpec.RetryBackoffFactor = 0
+	_, err = stream.replace(&newSpec)
+	assert.NoError(err)
+	assert.Equal(DefaultExponentialBackoffInitial, stream.initialRetryDelay)
+	assert.Equal(DefaultExponentialBackoffFactor, stream.backoffFactor)
+}
+
+func TestRetryStrategySettings(t *testing.T) {
+	assert := assert.New(t)
+	_, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			Webhook: &webhookActionInfo{
+				TLSkipHostVerify: &falseValue,
+			},
+		}, nil, 200)
+	defer svr.Close()
+	defer close(eventStream)
+	defer stream.stop()
+
+	_, err := stream.update(&StreamInfo{RetryStrategy: "random"})
+	assert.EqualError(err, "Invalid retryStrategy 'random'. Must be 'exponential', 'linear' or 'fixed'")
+	_, err = stream.update(&StreamInfo{RetryJitter: 2})
+	assert.EqualError(err, "Invalid retryJitter 2. Must be between 0 and 1")
+	_, err = stream.update(&StreamInfo{RetryStrategy: "Linear", RetryJitter: 0.25})
+	assert.NoError(err)
+	assert.Equal(utils.RetryStrategyLinear, stream.spec.RetryStrategy)
+	assert.Equal(0.25, stream.spec.RetryJitter)
+
+	// replacing the spec without them goes back to exponential backoff, without jitter
+	newSpec := *stream.spec
+	newSpec.RetryStrategy = ""
+	newSpec.RetryJitter = 0
+	_, err = stream.replace(&newSpec)
+	assert.NoError(err)
+	assert.Empty(stream.spec.RetryStrategy)
+	assert.Zero(stream.spec.RetryJitter)
+}
+
 func TestUpdateStreamSwapType(t *testing.T) {
 	assert := assert.New(t)
 	dir := tempdir(t)
@@ -970,6 +1195,11 @@ func TestUpdateStreamSwapType(t *testing.T) {
 	}
 	_, err := sm.updateStream(stream, updateSpec)
 	assert.EqualError(err, "The type of an event stream cannot be changed")
+
+	// the rejected update leaves the stream running, and free to be updated
+	assert.False(stream.poller.isDone())
+	_, err = sm.updateStream(stream, &StreamInfo{BatchSize: 3})
+	assert.NoError(err)
 }
 
 func TestUpdateWebSocket(t *testing.T) {
@@ -993,6 +1223,13 @@ func TestUpdateWebSocket(t *testing.T) {
 	defer close(eventStream)
 	defer stream.stop()
 
+	_, err := sm.updateStream(stream, &StreamInfo{
+		WebSocket: &webSocketActionInfo{
+			Topic: "fabconnect_system",
+		},
+	})
+	assert.EqualError(err, "Topic 'fabconnect_system' is reserved for system events")
+
 	updateSpec := &StreamInfo{
 		WebSocket: &webSocketActionInfo{
 			Topic: "test2",
@@ -1004,6 +1241,132 @@ func TestUpdateWebSocket(t *testing.T) {
 	assert.NoError(err)
 }
 
+func TestPatchStream(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	db := kvstore.NewLDBKeyValueStore(dir)
+	_ = db.Init()
+	sm, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			ErrorHandling: ErrorHandlingBlock,
+			BatchSize:     5,
+			Name:          "stream1",
+			Timestamps:    &trueValue,
+			Webhook: &webhookActionInfo{
+				TLSkipHostVerify: &falseValue,
+			},
+		}, db, 200)
+	defer svr.Close()
+	defer close(eventStream)
+	defer stream.stop()
+
+	patch := func(ops string) (*StreamInfo, *restutil.RestError) {
+		req := httptest.NewRequest(http.MethodPatch, "/eventstreams/"+stream.spec.ID, strings.NewReader(ops))
+		req.Header.Set("Content-Type", "application/json-patch+json")
+		return sm.UpdateStream(nil, req, httprouter.Params{{Key: "streamId", Value: stream.spec.ID}})
+	}
+
+	// false and empty values are applied, rather than treated as not provided
+	updated, restErr := patch(`[
+		{"op": "replace", "path": "/timestamps", "value": false},
+		{"op": "remove", "path": "/webhook/headers"},
+		{"op": "remove", "path": "/name"},
+		{"op": "replace", "path": "/batchSize", "value": 10}
+	]`)
+	assert.Nil(restErr)
+	assert.False(*updated.Timestamps)
+	assert.Nil(updated.Webhook.Headers)
+	assert.Empty(updated.Name)
+	assert.Equal(uint64(10), updated.BatchSize)
+	assert.Equal(ErrorHandlingBlock, updated.ErrorHandling)
+	assert.Same(stream.spec.Webhook, stream.action.(*webhookAction).spec)
+
+	var stored StreamInfo
+	b, _ := db.Get(stream.spec.ID)
+	_ = json.Unmarshal(b, &stored)
+	assert.False(*stored.Timestamps)
+	assert.Nil(stored.Webhook.Headers)
+
+	updated, restErr = patch(`[{"op": "add", "path": "/webhook/headers", "value": {"h1": "v1"}}]`)
+	assert.Nil(restErr)
+	assert.Equal(map[string]string{"h1": "v1"}, updated.Webhook.Headers)
+
+	_, restErr = patch(`[{"op": "replace", "path": "/type", "value": "websocket"}]`)
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp("The 'type' of an event stream cannot be changed", restErr.Error)
+
+	_, restErr = patch(`[{"op": "remove", "path": "/webhook/url"}]`)
+	assert.Equal(400, restErr.StatusCode)
+
+	_, restErr = patch(`[{"op": "test", "path": "/batchSize", "value": 5}]`)
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp("Value does not match", restErr.Error)
+	assert.Equal(uint64(10), stream.spec.BatchSize)
+
+	_, restErr = patch(`{"not": "a patch"}`)
+	assert.Equal(400, restErr.StatusCode)
+}
+
+func TestWebSocketReservedTopic(t *testing.T) {
+	assert := assert.New(t)
+	err := validateWebsocketConfig(&webSocketActionInfo{Topic: "fabconnect_system"})
+	assert.EqualError(err, "Topic 'fabconnect_system' is reserved for system events")
+	assert.NoError(validateWebsocketConfig(&webSocketActionInfo{Topic: "topic1"}))
+}
+
+func TestWebSocketStreamingDelivery(t *testing.T) {
+	assert := assert.New(t)
+	mws := newMockWebSocket()
+	es := &eventStream{
+		spec:       &StreamInfo{ID: "es-1", Type: EventStreamTypeWebsocket, BatchSizeStream: true},
+		wsChannels: mws,
+	}
+	action, err := newWebSocketAction(es, &webSocketActionInfo{Topic: "topic1"})
+	assert.NoError(err)
+
+	// each event is sent on its own, and acked on its own
+	done := make(chan error)
+	event := &eventsapi.EventEntry{BlockNumber: 10, SubID: "sb-1"}
+	go func() {
+		done <- action.attemptBatch(context.Background(), 1, 1, []*eventsapi.EventEntry{event})
+	}()
+	assert.Same(event, <-mws.sender)
+	mws.receiver <- fmt.Errorf("pop")
+	assert.EqualError(<-done, "pop")
+
+	es.spec.Format = EventFormatCloudEvents
+	go func() {
+		done <- action.attemptBatch(context.Background(), 2, 1, []*eventsapi.EventEntry{event})
+	}()
+	envelope := (<-mws.sender).(*cloudEvent)
+	mws.receiver <- nil
+	assert.NoError(<-done)
+	assert.Same(event, envelope.Data)
+}
+
+func TestWebhookStreamingDelivery(t *testing.T) {
+	assert := assert.New(t)
+	bodies := make(chan string, 1)
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		b, _ := io.ReadAll(req.Body)
+		bodies <- req.Header.Get("Content-Type") + " " + string(b)
+	}))
+	defer svr.Close()
+
+	es := &eventStream{
+		sm:              newTestSubscriptionManager(),
+		allowPrivateIPs: true,
+		spec:            &StreamInfo{ID: "es-1", Type: EventStreamTypeWebhook, BatchSizeStream: true, Format: EventFormatCloudEvents},
+	}
+	action, err := newWebhookAction(es, &webhookActionInfo{URL: svr.URL})
+	assert.NoError(err)
+	err = action.attemptBatch(context.Background(), 1, 1, []*eventsapi.EventEntry{{BlockNumber: 10, SubID: "sb-1"}})
+	assert.NoError(err)
+	assert.Regexp(`^application/cloudevents\+json \{"specversion"`, <-bodies)
+}
+
 func TestWebSocketClientClosedOnSend(t *testing.T) {
 
 	dir := tempdir(t)
@@ -1029,7 +1392,7 @@ func TestWebSocketClientClosedOnSend(t *testing.T) {
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
-		_ = wsa.attemptBatch(0, 0, []*eventsapi.EventEntry{})
+		_ = wsa.attemptBatch(context.Background(), 0, 0, []*eventsapi.EventEntry{})
 		wg.Done()
 	}()
 
@@ -1063,7 +1426,7 @@ func TestWebSocketClientClosedOnReceive(t *testing.T) {
 	wg := sync.WaitGroup{}
 	wg.Add(1)
 	go func() {
-		_ = wsa.attemptBatch(0, 0, []*eventsapi.EventEntry{})
+		_ = wsa.attemptBatch(context.Background(), 0, 0, []*eventsapi.EventEntry{})
 		wg.Done()
 	}()
 
@@ -1096,3 +1459,412 @@ func TestUpdateStreamDuplicateCall(t *testing.T) {
 	err = stream.preUpdateStream()
 	assert.Regexp("Update to event stream already in progress", err)
 }
+
+func TestUpdateSuspendedStream(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	db := kvstore.NewLDBKeyValueStore(dir)
+	_ = db.Init()
+	_, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			ErrorHandling: ErrorHandlingBlock,
+			Webhook: &webhookActionInfo{
+				TLSkipHostVerify: &falseValue,
+			},
+		}, db, 200)
+	defer svr.Close()
+	defer close(eventStream)
+	defer stream.stop()
+
+	stream.suspend()
+	for !stream.poller.isDone() || !stream.processor.isDone() {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	// the goroutines that exited on suspend do not hold up the update
+	_, err := stream.update(&StreamInfo{BatchSize: 3})
+	assert.NoError(err)
+	assert.Equal(uint64(3), stream.spec.BatchSize)
+	assert.False(stream.dispatcher.isDone())
+	for !stream.poller.isDone() || !stream.processor.isDone() {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	err = stream.resume()
+	assert.NoError(err)
+	err = stream.resume()
+	assert.Regexp("Event processor is already active", err)
+}
+
+func TestStreamErroredTransitions(t *testing.T) {
+	assert := assert.New(t)
+	m := &mockSubMgr{}
+	stream := newTestStream(m)
+	defer stream.stop()
+
+	stream.setErrored(nil)
+	stream.setErrored(fmt.Errorf("pop"))
+	stream.setErrored(fmt.Errorf("pop"))
+	stream.setErrored(nil)
+	assert.Equal([]string{StreamErrored, StreamRecovered}, m.lifecycleEvents)
+}
+
+func TestBlockedRetryStateResumed(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	db := kvstore.NewLDBKeyValueStore(dir)
+	_ = db.Init()
+	sm, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			BatchSize: 1,
+			Webhook: &webhookActionInfo{
+				TLSkipHostVerify: &falseValue,
+			},
+			ErrorHandling:        ErrorHandlingBlock,
+			BlockedRetryDelaySec: 1,
+		}, db, 404)
+	defer close(eventStream)
+	defer svr.Close()
+	defer stream.stop()
+
+	// As recovered on a restart, part way through retrying the batch
+	stream.setResumeRetry(map[string]*retryState{"sub1/0/0/0": {FirstEvent: "sub1/0/0/0", Attempt: 5, NextRetry: time.Now()}})
+	stream.handleEvent(&eventData{
+		event: &eventsapi.EventEntry{
+			SubID: "sub1",
+		},
+		batchComplete: func(*eventsapi.EventEntry) {},
+	})
+	<-eventStream
+
+	var state *retryState
+	for state == nil {
+		time.Sleep(1 * time.Millisecond)
+		state = sm.loadRetryStates(stream.spec.ID)["sub1/0/0/0"]
+	}
+	assert.Equal("sub1/0/0/0", state.FirstEvent)
+	assert.Equal(6, state.Attempt)
+	assert.True(state.NextRetry.After(time.Now()))
+}
+
+func TestBlockedRetryStateDeletedOnSuccess(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	db := kvstore.NewLDBKeyValueStore(dir)
+	_ = db.Init()
+	sm, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			BatchSize: 1,
+			Webhook: &webhookActionInfo{
+				TLSkipHostVerify: &falseValue,
+			},
+			ErrorHandling:        ErrorHandlingBlock,
+			BlockedRetryDelaySec: 1,
+		}, db, 200)
+	defer close(eventStream)
+	defer svr.Close()
+	defer stream.stop()
+
+	err := sm.storeRetryState(stream.spec.ID, &retryState{FirstEvent: "sub1/0/0/0", Attempt: 5, NextRetry: time.Now()})
+	assert.NoError(err)
+	// another batch blocked at the same time, by a stream with a concurrency
+	err = sm.storeRetryState(stream.spec.ID, &retryState{FirstEvent: "sub2/0/0/0", Attempt: 2, NextRetry: time.Now()})
+	assert.NoError(err)
+	stream.setResumeRetry(sm.loadRetryStates(stream.spec.ID))
+
+	complete := false
+	stream.handleEvent(&eventData{
+		event: &eventsapi.EventEntry{
+			SubID: "sub1",
+		},
+		batchComplete: func(*eventsapi.EventEntry) { complete = true },
+	})
+	<-eventStream
+	for !complete {
+		time.Sleep(1 * time.Millisecond)
+	}
+	states := sm.loadRetryStates(stream.spec.ID)
+	assert.Equal(1, len(states))
+	assert.Equal(2, states["sub2/0/0/0"].Attempt)
+
+	sm.deleteRetryStates(stream.spec.ID)
+	assert.Empty(sm.loadRetryStates(stream.spec.ID))
+}
+
+func TestAddSubscriptionHeaders(t *testing.T) {
+	assert := assert.New(t)
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("x-my-header", "my-value")
+	addSubscriptionHeaders(header, map[string]string{"x-my-header": "my-value"}, []*eventsapi.EventEntry{
+		{SubID: "sub1", Headers: map[string]string{"x-route": "orders", "x-my-header": "other", "content-type": "text/plain"}},
+		{SubID: "sub1", Headers: map[string]string{"x-route": "orders"}},
+		{SubID: "sub2", Headers: map[string]string{"x-route": "payments"}},
+		{SubID: "sub3"},
+	})
+	assert.Equal([]string{"orders", "payments"}, header.Values("X-Route"))
+	assert.Equal([]string{"my-value"}, header.Values("X-My-Header"))
+	assert.Equal("application/json", header.Get("Content-Type"))
+}
+
+func TestWebhookSignature(t *testing.T) {
+	assert := assert.New(t)
+	requests := make(chan *http.Request, 2)
+	bodies := make(chan []byte, 2)
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		requests <- req
+		bodies <- body
+	}))
+	defer svr.Close()
+
+	es := &eventStream{
+		sm:              &mockSubMgr{},
+		allowPrivateIPs: true,
+		spec:            &StreamInfo{ID: "es-1", Type: EventStreamTypeWebhook},
+	}
+	action, err := newWebhookAction(es, &webhookActionInfo{
+		URL:     svr.URL,
+		Secret:  "secret1",
+		Headers: map[string]string{"X-Fabconnect-Signature": "forged"},
+	})
+	assert.NoError(err)
+	events := []*eventsapi.EventEntry{{SubID: "sb-1", Headers: map[string]string{"X-Fabconnect-Signature": "forged"}}}
+	err = action.attemptBatch(context.Background(), 1, 1, events)
+	assert.NoError(err)
+
+	req := <-requests
+	body := <-bodies
+	mac := hmac.New(sha256.New, []byte("secret1"))
+	mac.Write(body)
+	assert.Equal([]string{"sha256=" + hex.EncodeToString(mac.Sum(nil))}, req.Header.Values("X-Fabconnect-Signature"))
+
+	action.spec.SignatureHeader = "X-Hub-Signature-256"
+	err = action.attemptBatch(context.Background(), 2, 1, events)
+	assert.NoError(err)
+	req = <-requests
+	assert.Equal(signWebhookBody("secret1", <-bodies), req.Header.Get("X-Hub-Signature-256"))
+
+	// unsigned without a secret
+	action.spec.Secret = ""
+	err = action.attemptBatch(context.Background(), 3, 1, events)
+	assert.NoError(err)
+	req = <-requests
+	<-bodies
+	assert.Empty(req.Header.Get("X-Hub-Signature-256"))
+}
+
+func TestUpdateWebhookSecret(t *testing.T) {
+	assert := assert.New(t)
+	stream := newTestStream(&mockSubMgr{})
+	defer stream.stop()
+
+	_, err := stream.update(&StreamInfo{Webhook: &webhookActionInfo{Secret: "secret1", SignatureHeader: "X-Signature"}})
+	assert.NoError(err)
+	assert.Equal("secret1", stream.spec.Webhook.Secret)
+	assert.Equal("X-Signature", stream.spec.Webhook.SignatureHeader)
+
+	_, err = stream.update(&StreamInfo{Webhook: &webhookActionInfo{RequestTimeoutSec: 10}})
+	assert.NoError(err)
+	assert.Equal("secret1", stream.spec.Webhook.Secret)
+}
+
+func TestChunkWebhookItems(t *testing.T) {
+	assert := assert.New(t)
+	items := []json.RawMessage{[]byte(`"aaaa"`), []byte(`"bb"`), []byte(`"cccccccccc"`), []byte(`"d"`)}
+	assert.Equal([][]json.RawMessage{items}, chunkWebhookItems(items, 0))
+	// ["aaaa","bb"] is 15 bytes
+	chunks := chunkWebhookItems(items, 15)
+	assert.Equal(3, len(chunks))
+	assert.Equal(`["aaaa","bb"]`, string(joinWebhookItems(chunks[0])))
+	assert.Equal(`["cccccccccc"]`, string(joinWebhookItems(chunks[1])))
+	assert.Equal(`["d"]`, string(joinWebhookItems(chunks[2])))
+	// an item over the limit is in a chunk of its own
+	chunks = chunkWebhookItems(items, 5)
+	assert.Equal(4, len(chunks))
+}
+
+func TestWebhookChunks(t *testing.T) {
+	assert := assert.New(t)
+	type chunk struct {
+		header string
+		events []*eventsapi.EventEntry
+	}
+	chunks := make(chan chunk, 10)
+	var failChunk atomic.Value
+	failChunk.Store("2/3")
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var events []*eventsapi.EventEntry
+		_ = json.NewDecoder(req.Body).Decode(&events)
+		header := req.Header.Get("X-Fabconnect-Batch-Chunk")
+		fail := header == failChunk.Load()
+		chunks <- chunk{header, events}
+		if fail {
+			res.WriteHeader(503)
+		}
+	}))
+	defer svr.Close()
+
+	es := &eventStream{
+		sm:              &mockSubMgr{},
+		allowPrivateIPs: true,
+		spec:            &StreamInfo{ID: "es-1", Type: EventStreamTypeWebhook},
+	}
+	events := []*eventsapi.EventEntry{{SubID: "sb-1", BlockNumber: 1}, {SubID: "sb-1", BlockNumber: 2}, {SubID: "sb-1", BlockNumber: 3}}
+	b, _ := json.Marshal(events[0])
+	action, err := newWebhookAction(es, &webhookActionInfo{URL: svr.URL, MaxRequestBytes: uint32(len(b) + 2)})
+	assert.NoError(err)
+
+	// the batch fails on the second chunk, and the retry resumes from it
+	err = action.attemptBatch(context.Background(), 5, 1, events)
+	assert.Regexp("status=503", err)
+	c := <-chunks
+	assert.Equal("1/3", c.header)
+	assert.Equal(uint64(1), c.events[0].BlockNumber)
+	assert.Equal("2/3", (<-chunks).header)
+	// another batch delivered in parallel fails on a different chunk
+	failChunk.Store("3/3")
+	err = action.attemptBatch(context.Background(), 7, 1, events)
+	assert.Regexp("status=503", err)
+	assert.Equal("1/3", (<-chunks).header)
+	assert.Equal("2/3", (<-chunks).header)
+	assert.Equal("3/3", (<-chunks).header)
+	failChunk.Store("none")
+	err = action.attemptBatch(context.Background(), 5, 2, events)
+	assert.NoError(err)
+	c = <-chunks
+	assert.Equal("2/3", c.header)
+	assert.Equal(uint64(2), c.events[0].BlockNumber)
+	assert.Equal("3/3", (<-chunks).header)
+	err = action.attemptBatch(context.Background(), 7, 2, events)
+	assert.NoError(err)
+	assert.Equal("3/3", (<-chunks).header)
+	assert.Empty(action.resumeChunks)
+
+	// a batch within the limit is sent in one request, without the header
+	action.spec.MaxRequestBytes = 0
+	err = action.attemptBatch(context.Background(), 6, 1, events)
+	assert.NoError(err)
+	c = <-chunks
+	assert.Empty(c.header)
+	assert.Equal(3, len(c.events))
+}
+
+func TestWebhookBatchHeaders(t *testing.T) {
+	assert := assert.New(t)
+	headers := make(chan http.Header, 10)
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		headers <- req.Header
+	}))
+	defer svr.Close()
+
+	es := &eventStream{
+		sm:              &mockSubMgr{},
+		allowPrivateIPs: true,
+		spec:            &StreamInfo{ID: "es-1", Type: EventStreamTypeWebhook},
+	}
+	events := []*eventsapi.EventEntry{{SubID: "sb-1", BlockNumber: 10}, {SubID: "sb-1", BlockNumber: 11}, {SubID: "sb-1", BlockNumber: 12}}
+	action, err := newWebhookAction(es, &webhookActionInfo{URL: svr.URL})
+	assert.NoError(err)
+
+	err = action.attemptBatch(context.Background(), 7, 2, events)
+	assert.NoError(err)
+	h := <-headers
+	assert.Equal("es-1", h.Get("X-Fabconnect-Stream-Id"))
+	assert.Equal("7", h.Get("X-Fabconnect-Batch-Number"))
+	assert.Equal("2", h.Get("X-Fabconnect-Attempt"))
+	assert.Equal("3", h.Get("X-Fabconnect-Batch-Event-Count"))
+	assert.Equal("10", h.Get("X-Fabconnect-Batch-First-Block"))
+	assert.Equal("12", h.Get("X-Fabconnect-Batch-Last-Block"))
+
+	// each chunk of a batch describes its own events
+	b, _ := json.Marshal(events[0])
+	action.spec.MaxRequestBytes = uint32(2*len(b) + 3)
+	err = action.attemptBatch(context.Background(), 8, 1, events)
+	assert.NoError(err)
+	h = <-headers
+	assert.Equal("8", h.Get("X-Fabconnect-Batch-Number"))
+	assert.Equal("2", h.Get("X-Fabconnect-Batch-Event-Count"))
+	assert.Equal("10", h.Get("X-Fabconnect-Batch-First-Block"))
+	assert.Equal("11", h.Get("X-Fabconnect-Batch-Last-Block"))
+	h = <-headers
+	assert.Equal("8", h.Get("X-Fabconnect-Batch-Number"))
+	assert.Equal("1", h.Get("X-Fabconnect-Batch-Event-Count"))
+	assert.Equal("12", h.Get("X-Fabconnect-Batch-First-Block"))
+	assert.Equal("12", h.Get("X-Fabconnect-Batch-Last-Block"))
+}
+
+func TestWebhookGzip(t *testing.T) {
+	assert := assert.New(t)
+	bodies := make(chan []byte, 1)
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal("gzip", req.Header.Get("Content-Encoding"))
+		compressed, _ := io.ReadAll(req.Body)
+		assert.Equal(signWebhookBody("secret1", compressed), req.Header.Get("X-Fabconnect-Signature"))
+		zr, err := gzip.NewReader(strings.NewReader(string(compressed)))
+		assert.NoError(err)
+		body, _ := io.ReadAll(zr)
+		bodies <- body
+	}))
+	defer svr.Close()
+
+	es := &eventStream{
+		sm:              &mockSubMgr{},
+		allowPrivateIPs: true,
+		spec:            &StreamInfo{ID: "es-1", Type: EventStreamTypeWebhook},
+	}
+	action, err := newWebhookAction(es, &webhookActionInfo{URL: svr.URL, Compression: "GZIP", Secret: "secret1"})
+	assert.NoError(err)
+	events := []*eventsapi.EventEntry{{SubID: "sb-1"}}
+	err = action.attemptBatch(context.Background(), 1, 1, events)
+	assert.NoError(err)
+	expected, _ := json.Marshal(events)
+	assert.Equal(string(expected), string(<-bodies))
+
+	assert.Regexp("Invalid webhook.compression 'br'", validateWebhookConfig(&webhookActionInfo{URL: "http://test", Compression: "br"}))
+}
+
+func TestWebhookGzipThreshold(t *testing.T) {
+	assert := assert.New(t)
+	encodings := make(chan string, 2)
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		encodings <- req.Header.Get("Content-Encoding")
+		_, _ = io.Copy(io.Discard, req.Body)
+	}))
+	defer svr.Close()
+
+	es := &eventStream{
+		sm:              &mockSubMgr{},
+		allowPrivateIPs: true,
+		spec:            &StreamInfo{ID: "es-1", Type: EventStreamTypeWebhook},
+	}
+	spec := &webhookActionInfo{URL: svr.URL, Compressed: &trueValue, CompressionThresholdBytes: 200}
+	setWebhookDefaults(spec)
+	assert.Equal(WebhookCompressionGzip, spec.Compression)
+	assert.Nil(spec.Compressed)
+	action, err := newWebhookAction(es, spec)
+	assert.NoError(err)
+
+	// only bodies of at least the threshold are compressed
+	err = action.attemptBatch(context.Background(), 1, 1, []*eventsapi.EventEntry{{SubID: "sb-1"}})
+	assert.NoError(err)
+	assert.Equal("", <-encodings)
+	err = action.attemptBatch(context.Background(), 2, 1, []*eventsapi.EventEntry{{SubID: "sb-1", Payload: strings.Repeat("a", 200)}})
+	assert.NoError(err)
+	assert.Equal("gzip", <-encodings)
+
+	stream, err := newEventStream(&mockSubMgr{}, &StreamInfo{ID: "es-1", Type: "webhook", Webhook: &webhookActionInfo{URL: "http://test"}}, nil)
+	assert.NoError(err)
+	defer stream.stop()
+	_, err = stream.update(&StreamInfo{Webhook: &webhookActionInfo{Compressed: &trueValue, CompressionThresholdBytes: 1024}})
+	assert.NoError(err)
+	assert.Equal(WebhookCompressionGzip, stream.spec.Webhook.Compression)
+	assert.Equal(uint32(1024), stream.spec.Webhook.CompressionThresholdBytes)
+	_, err = stream.update(&StreamInfo{Webhook: &webhookActionInfo{Compressed: &falseValue}})
+	assert.NoError(err)
+	assert.Equal("", stream.spec.Webhook.Compression)
+}
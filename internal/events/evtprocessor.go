@@ -18,6 +18,7 @@ package events
 
 import (
 	"encoding/json"
+	"regexp"
 	"sync"
 
 	"github.com/hyperledger/firefly-fabconnect/internal/events/api"
@@ -26,20 +27,67 @@ import (
 
 type eventData struct {
 	event         *api.EventEntry
+	tenant        string // signer of the subscription, that deliveries are accounted to
+	stats         *eventTypeStats
+	outbox        *outboxWaiter
 	batchComplete func(*api.EventEntry)
+	size          int // of the event as JSON, once measured by jsonSize
+}
+
+// eventData wrappers are allocated for every event that flows through a stream,
+// so they are pooled and returned once the batch containing them is done with
+var eventDataPool = sync.Pool{
+	New: func() interface{} {
+		return &eventData{}
+	},
+}
+
+func newEventData(entry *api.EventEntry, batchComplete func(*api.EventEntry)) *eventData {
+	e := eventDataPool.Get().(*eventData)
+	e.event = entry
+	e.batchComplete = batchComplete
+	return e
+}
+
+func (e *eventData) release() {
+	e.event = nil
+	e.tenant = ""
+	e.stats = nil
+	e.outbox = nil
+	e.batchComplete = nil
+	e.size = 0
+	eventDataPool.Put(e)
+}
+
+// jsonSize is the size of the event as JSON. It is measured once, for both the byte limit of
+// the batches and the usage of the tenant
+func (e *eventData) jsonSize() int {
+	if e.size == 0 {
+		b, _ := json.Marshal(e.event)
+		e.size = len(b)
+	}
+	return e.size
 }
 
 type evtProcessor struct {
-	subID    string
-	stream   *eventStream
-	blockHWM uint64
-	hwmSync  sync.Mutex
+	subID         string
+	stream        *eventStream
+	blockHWM      uint64
+	replayUntil   uint64 // blocks below this height are historical, and subject to the replay throttle
+	hwmSync       sync.Mutex
+	stats         *eventTypeStats
+	outbox        *outboxWaiter // set for the one-shot subscription of a transaction outbox
+	sequence      *sequenceTracker
+	eventFilter   *regexp.Regexp // matched against the event names in the blocks of a block subscription
+	payloadFilter *payloadFilter
+	privateData   *privateDataReader // set for the subscriptions that can deliver private data
 }
 
 func newEvtProcessor(subID string, stream *eventStream) *evtProcessor {
 	return &evtProcessor{
 		subID:  subID,
 		stream: stream,
+		stats:  &eventTypeStats{},
 	}
 }
 
@@ -66,8 +114,41 @@ func (ep *evtProcessor) initBlockHWM(intVal uint64) {
 	ep.hwmSync.Unlock()
 }
 
+func (ep *evtProcessor) setReplayUntil(height uint64) {
+	ep.hwmSync.Lock()
+	ep.replayUntil = height
+	ep.hwmSync.Unlock()
+}
+
+func (ep *evtProcessor) isReplay(blockNumber uint64) bool {
+	ep.hwmSync.Lock()
+	v := blockNumber < ep.replayUntil
+	ep.hwmSync.Unlock()
+	return v
+}
+
 func (ep *evtProcessor) processEventEntry(subInfo *api.SubscriptionInfo, entry *api.EventEntry) (err error) {
+	if subInfo.TransactionID != "" && entry.TransactionID != subInfo.TransactionID {
+		// the one-shot subscription of an outbox replays a block, but only delivers its own transaction
+		return nil
+	}
+	if ep.eventFilter != nil && !ep.eventFilter.MatchString(entry.EventName) {
+		return nil
+	}
+	if subInfo.Filter.ChaincodeID != "" && entry.ChaincodeID != subInfo.Filter.ChaincodeID {
+		// a subscription to a chaincode that includes invalidated transactions reads all the events of the blocks
+		return nil
+	}
+	if entry.TransactionStatus != "" && !subInfo.OnlyValidTransactions.Includes(entry.TransactionStatus == api.TransactionStatusValid) {
+		return nil
+	}
 	entry.SubID = subInfo.ID
+	entry.Headers = subInfo.Headers
+	if !subInfo.PrivateData {
+		entry.PrivateData = nil
+	} else {
+		entry.PrivateData = ep.privateData.filterWrites(ep.stream.ctx, entry.PrivateData)
+	}
 	payloadType := subInfo.PayloadType
 	if payloadType == "" {
 		payloadType = api.EventPayloadTypeBytes
@@ -89,13 +170,34 @@ func (ep *evtProcessor) processEventEntry(subInfo *api.SubscriptionInfo, entry *
 		}
 	}
 
-	result := eventData{
-		event:         entry,
-		batchComplete: ep.batchComplete,
+	if schema := ep.stream.sm.getEventSchemas().forEvent(entry.ChaincodeID, entry.EventName); schema != nil {
+		schema.annotate(entry, payloadBytes)
+	}
+
+	if ep.sequence != nil {
+		if gap := ep.sequence.check(entry, payloadBytes); gap != nil {
+			gap.Stream = subInfo.Stream
+			log.Warnf("%s: Sequence gap before %s event in block %d. Expected=%d Received=%d Missing=%d", subInfo.ID, entry.EventName, entry.BlockNumber, gap.Expected, gap.Received, gap.Missing)
+			ep.stream.counters.recordSequenceGap(gap.Missing)
+			ep.stream.sm.publishSystemEvent(SubscriptionSequenceGap, gap)
+		}
+	}
+
+	// filtered after the sequence is checked, as the events that do not match were not lost
+	if ep.payloadFilter != nil && !ep.payloadFilter.matches(entry, payloadBytes) {
+		return nil
+	}
+
+	if ep.isReplay(entry.BlockNumber) {
+		ep.stream.replayThrottle.wait(ep.stream.ctx.Done())
 	}
 
 	// Ok, now we have the full event in a friendly map output. Pass it down to the stream
-	log.Infof("%s: Dispatching event. BlockNumber=%d TxId=%s", subInfo.ID, result.event.BlockNumber, result.event.TransactionID)
-	ep.stream.eventHandler(&result)
+	log.Infof("%s: Dispatching event. BlockNumber=%d TxId=%s", subInfo.ID, entry.BlockNumber, entry.TransactionID)
+	data := newEventData(entry, ep.batchComplete)
+	data.tenant = subInfo.Signer
+	data.stats = ep.stats
+	data.outbox = ep.outbox
+	ep.stream.eventHandler(data)
 	return nil
 }
@@ -65,4 +65,61 @@ func TestEventPayloadUnmarshaling(t *testing.T) {
 	_, ok = entry.Payload.([]byte)
 	assert.True(ok)
 	assert.Equal([]byte(jsonstring), entry.Payload)
+
+	privateData := []*api.CollectionWrites{{Namespace: "asset_transfer", Collection: "assetCollection"}}
+	entry = &api.EventEntry{Payload: []byte(jsonstring), PrivateData: privateData}
+	err = p.processEventEntry(subInfo, entry)
+	assert.NoError(err)
+	assert.Nil(entry.PrivateData)
+	subInfo.PrivateData = true
+	entry = &api.EventEntry{Payload: []byte(jsonstring), PrivateData: privateData}
+	err = p.processEventEntry(subInfo, entry)
+	assert.NoError(err)
+	assert.Nil(entry.PrivateData)
+	// only the collections the organization of the signer is a member of are delivered
+	p.privateData = newPrivateDataReader(newTestCollectionQuerier(), subInfo)
+	entry = &api.EventEntry{Payload: []byte(jsonstring), PrivateData: testPrivateData()}
+	err = p.processEventEntry(subInfo, entry)
+	assert.NoError(err)
+	assert.Equal(privateData, entry.PrivateData)
+}
+
+func TestBlockEventFilter(t *testing.T) {
+	assert := assert.New(t)
+	subInfo := &api.SubscriptionInfo{ID: "abc"}
+	assert.Nil(blockEventFilter(subInfo))
+	subInfo.Filter.EventFilter = "("
+	assert.Nil(blockEventFilter(subInfo))
+	subInfo.Filter.EventFilter = "^AssetTransfer.*"
+	subInfo.Filter.ChaincodeID = "asset_transfer"
+	assert.Nil(blockEventFilter(subInfo))
+	subInfo.Filter.ChaincodeID = ""
+	subInfo.Type = api.SubscriptionTypeBlocks
+	assert.Nil(blockEventFilter(subInfo))
+	subInfo.Type = ""
+
+	subInfo.Filter.ChaincodeID = ""
+	p := &evtProcessor{eventFilter: blockEventFilter(subInfo)}
+	assert.True(p.eventFilter.MatchString("AssetTransferred"))
+	entry := &api.EventEntry{EventName: "AssetCreated"}
+	err := p.processEventEntry(subInfo, entry)
+	assert.NoError(err)
+	assert.Empty(entry.SubID)
+}
+
+func TestOnlyValidTransactions(t *testing.T) {
+	assert := assert.New(t)
+	subInfo := &api.SubscriptionInfo{ID: "abc"}
+	subInfo.Filter.ChaincodeID = "asset_transfer"
+	p := &evtProcessor{}
+	entry := &api.EventEntry{ChaincodeID: "asset_transfer", TransactionStatus: "MVCC_READ_CONFLICT"}
+	err := p.processEventEntry(subInfo, entry)
+	assert.NoError(err)
+	assert.Empty(entry.SubID)
+
+	subInfo.OnlyValidTransactions = api.TxValidityBoth
+	entry = &api.EventEntry{ChaincodeID: "other_chaincode", TransactionStatus: "VALID"}
+	err = p.processEventEntry(subInfo, entry)
+	assert.NoError(err)
+	assert.Empty(entry.SubID)
 }
@@ -0,0 +1,284 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/hyperledger/firefly-fabconnect/internal/events/eventspb"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	DefaultGRPCRequestTimeoutSec = 30
+
+	grpcStreamEventsMethod = "/fabconnect.events.v1.EventStream/StreamEvents"
+)
+
+var grpcStreamEventsDesc = &grpc.StreamDesc{
+	StreamName:    "StreamEvents",
+	ClientStreams: true,
+	ServerStreams: true,
+}
+
+type grpcActionInfo struct {
+	// host:port of the consumer, which implements the fabconnect.events.v1.EventStream service
+	Address string `json:"address,omitempty"`
+	// Sent when the stream is opened, such as an authorization header
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Time to wait for the consumer to acknowledge a batch
+	RequestTimeoutSec uint32         `json:"requestTimeoutSec,omitempty"`
+	TLS               *actionTLSInfo `json:"tls,omitempty"`
+}
+
+// grpcStream is an open stream to the consumer, with the routine that receives its acknowledgments
+type grpcStream struct {
+	conn   *grpc.ClientConn
+	stream grpc.ClientStream
+	cancel context.CancelFunc
+	acks   chan *eventspb.BatchAck
+	failed chan error
+}
+
+type grpcAction struct {
+	brokerConnection[*grpcStream]
+	spec *grpcActionInfo
+}
+
+func validateGRPCConfig(spec *grpcActionInfo) error {
+	if spec == nil || spec.Address == "" {
+		return errors.Errorf(errors.EventStreamsGRPCNoAddress)
+	}
+	return spec.TLS.validate()
+}
+
+func setGRPCDefaults(spec *grpcActionInfo) {
+	if spec.RequestTimeoutSec == 0 {
+		spec.RequestTimeoutSec = DefaultGRPCRequestTimeoutSec
+	}
+}
+
+// redactGRPCConfig returns a copy of the settings with the values of the metadata redacted, as they
+// are typically authorization headers
+func redactGRPCConfig(spec *grpcActionInfo) *grpcActionInfo {
+	if spec == nil {
+		return nil
+	}
+	redacted := *spec
+	if spec.Metadata != nil {
+		redacted.Metadata = make(map[string]string, len(spec.Metadata))
+		for k, v := range spec.Metadata {
+			redacted.Metadata[k] = redactSecret(v)
+		}
+	}
+	return &redacted
+}
+
+// restoreGRPCSecrets sets the redacted metadata values of an update back to the existing ones
+func restoreGRPCSecrets(spec, existing *grpcActionInfo) {
+	if spec == nil {
+		return
+	}
+	if existing == nil {
+		existing = &grpcActionInfo{}
+	}
+	for k, v := range spec.Metadata {
+		restoreSecret(&v, existing.Metadata[k])
+		spec.Metadata[k] = v
+	}
+}
+
+// mergeGRPCConfig returns the existing settings, overridden by those set in an update
+func mergeGRPCConfig(existing, update *grpcActionInfo) *grpcActionInfo {
+	merged := *existing
+	if update.Address != "" {
+		merged.Address = update.Address
+	}
+	if update.Metadata != nil {
+		merged.Metadata = update.Metadata
+	}
+	if update.RequestTimeoutSec != 0 {
+		merged.RequestTimeoutSec = update.RequestTimeoutSec
+	}
+	if update.TLS != nil {
+		merged.TLS = update.TLS
+	}
+	return &merged
+}
+
+func newGRPCAction(es *eventStream, spec *grpcActionInfo) (*grpcAction, error) {
+	if err := validateGRPCConfig(spec); err != nil {
+		return nil, err
+	}
+	setGRPCDefaults(spec)
+	g := &grpcAction{
+		brokerConnection: brokerConnection[*grpcStream]{
+			es:            es,
+			broker:        "gRPC consumer",
+			connectFailed: errors.EventStreamsGRPCConnectFailed,
+		},
+		spec: spec,
+	}
+	g.dial = g.connect
+	return g, nil
+}
+
+// connect dials the consumer and opens the stream. The stream is not bound to the context of a
+// batch, as it stays open for the batches that follow
+func (g *grpcAction) connect(ctx context.Context) (*grpcStream, error) {
+	tlsConfig, err := g.spec.TLS.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	dialCtx, dialCancel := context.WithTimeout(ctx, time.Duration(g.spec.RequestTimeoutSec)*time.Second)
+	defer dialCancel()
+	conn, err := grpc.DialContext(dialCtx, g.spec.Address, grpc.WithTransportCredentials(creds), grpc.WithBlock())
+	if err != nil {
+		return nil, err
+	}
+	streamCtx, cancel := context.WithCancel(context.Background())
+	if len(g.spec.Metadata) > 0 {
+		streamCtx = metadata.NewOutgoingContext(streamCtx, metadata.New(g.spec.Metadata))
+	}
+	stream, err := conn.NewStream(streamCtx, grpcStreamEventsDesc, grpcStreamEventsMethod)
+	if err != nil {
+		cancel()
+		_ = conn.Close()
+		return nil, err
+	}
+	s := &grpcStream{
+		conn:   conn,
+		stream: stream,
+		cancel: cancel,
+		acks:   make(chan *eventspb.BatchAck),
+		failed: make(chan error, 1),
+	}
+	go s.receiveAcks(streamCtx)
+	return s, nil
+}
+
+func (s *grpcStream) receiveAcks(ctx context.Context) {
+	for {
+		ack := &eventspb.BatchAck{}
+		if err := s.stream.RecvMsg(ack); err != nil {
+			s.failed <- err
+			return
+		}
+		select {
+		case s.acks <- ack:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// batch returns the protobuf message of a batch, with the JSON of the payload of each event
+func (g *grpcAction) batch(batchNumber, attempt uint64, events []*api.EventEntry) (*eventspb.EventBatch, error) {
+	batch := &eventspb.EventBatch{
+		StreamId:    g.es.spec.ID,
+		BatchNumber: batchNumber,
+		Attempt:     attempt,
+		Events:      make([]*eventspb.Event, 0, len(events)),
+	}
+	for _, event := range events {
+		payload, err := json.Marshal(event.Payload)
+		if err != nil {
+			return nil, err
+		}
+		batch.Events = append(batch.Events, &eventspb.Event{
+			SubId:            event.SubID,
+			ChaincodeId:      event.ChaincodeID,
+			BlockNumber:      event.BlockNumber,
+			TransactionId:    event.TransactionID,
+			TransactionIndex: int64(event.TransactionIndex),
+			EventIndex:       int64(event.EventIndex),
+			EventName:        event.EventName,
+			Payload:          payload,
+			Timestamp:        event.Timestamp,
+			SchemaId:         event.SchemaID,
+			SchemaErrors:     event.SchemaErrors,
+			Headers:          event.Headers,
+		})
+	}
+	return batch, nil
+}
+
+// attemptBatch sends the batch on the stream, and waits for the consumer to acknowledge it. A
+// batch the consumer fails is retried on the same stream, while a stream that fails or is not
+// acknowledged in time is closed, and opened again by the next attempt
+func (g *grpcAction) attemptBatch(ctx context.Context, batchNumber, attempt uint64, events []*api.EventEntry) error {
+	esID := g.es.spec.ID
+	batch, err := g.batch(batchNumber, attempt, events)
+	if err != nil {
+		return err
+	}
+	s, err := g.connection(ctx, attempt, g.spec.Address)
+	if err != nil {
+		return err
+	}
+	log.Infof("%s: gRPC --> %s batch=%d events=%d (attempt=%d)", esID, g.spec.Address, batchNumber, len(events), attempt)
+	if err := s.stream.SendMsg(batch); err != nil {
+		log.Errorf("%s: gRPC send to %s failed (attempt=%d): %s", esID, g.spec.Address, attempt, err)
+		g.close()
+		return errors.Errorf(errors.EventStreamsGRPCStreamFailed, esID, err)
+	}
+	timer := time.NewTimer(time.Duration(g.spec.RequestTimeoutSec) * time.Second)
+	defer timer.Stop()
+	for {
+		select {
+		case ack := <-s.acks:
+			if ack.BatchNumber != batchNumber {
+				log.Warnf("%s: Ignoring gRPC acknowledgment of batch %d, while waiting for batch %d", esID, ack.BatchNumber, batchNumber)
+				continue
+			}
+			if ack.Error != "" {
+				log.Errorf("%s: gRPC <-- %s batch=%d failed (attempt=%d): %s", esID, g.spec.Address, batchNumber, attempt, ack.Error)
+				return errors.Errorf(errors.EventStreamsGRPCBatchFailed, esID, batchNumber, ack.Error)
+			}
+			log.Infof("%s: gRPC <-- %s batch=%d ok", esID, g.spec.Address, batchNumber)
+			return nil
+		case err := <-s.failed:
+			log.Errorf("%s: gRPC stream to %s failed (attempt=%d): %s", esID, g.spec.Address, attempt, err)
+			g.close()
+			return errors.Errorf(errors.EventStreamsGRPCStreamFailed, esID, err)
+		case <-timer.C:
+			g.close()
+			return errors.Errorf(errors.EventStreamsGRPCAckTimeout, esID, batchNumber)
+		case <-ctx.Done():
+			g.close()
+			return ctx.Err()
+		}
+	}
+}
+
+// Close ends the stream, and closes its connection
+func (s *grpcStream) Close() error {
+	s.cancel()
+	return s.conn.Close()
+}
@@ -0,0 +1,193 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/hyperledger/firefly-fabconnect/internal/events/eventspb"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// testGRPCConsumer implements the EventStream service, replying to each batch with the function
+type testGRPCConsumer struct {
+	listener net.Listener
+	batches  chan *eventspb.EventBatch
+	metadata chan metadata.MD
+}
+
+func newTestGRPCConsumer(t *testing.T, reply func(stream grpc.ServerStream, batch *eventspb.EventBatch) error) *testGRPCConsumer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	tc := &testGRPCConsumer{
+		listener: listener,
+		batches:  make(chan *eventspb.EventBatch, 10),
+		metadata: make(chan metadata.MD, 10),
+	}
+	server := grpc.NewServer()
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "fabconnect.events.v1.EventStream",
+		HandlerType: (*interface{})(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "StreamEvents",
+			ClientStreams: true,
+			ServerStreams: true,
+			Handler: func(_ interface{}, stream grpc.ServerStream) error {
+				md, _ := metadata.FromIncomingContext(stream.Context())
+				tc.metadata <- md
+				for {
+					batch := &eventspb.EventBatch{}
+					if err := stream.RecvMsg(batch); err != nil {
+						return err
+					}
+					tc.batches <- batch
+					if err := reply(stream, batch); err != nil {
+						return err
+					}
+				}
+			},
+		}},
+	}, struct{}{})
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+	return tc
+}
+
+func ackBatch(stream grpc.ServerStream, batch *eventspb.EventBatch) error {
+	return stream.SendMsg(&eventspb.BatchAck{BatchNumber: batch.BatchNumber})
+}
+
+func TestGRPCMergeConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	merged := mergeGRPCConfig(&grpcActionInfo{Address: "consumer:9000", RequestTimeoutSec: 5}, &grpcActionInfo{Metadata: map[string]string{"authorization": "Bearer token1"}})
+	assert.Equal("consumer:9000", merged.Address)
+	assert.Equal(uint32(5), merged.RequestTimeoutSec)
+	assert.Equal("Bearer token1", merged.Metadata["authorization"])
+}
+
+func TestGRPCAttemptBatch(t *testing.T) {
+	assert := assert.New(t)
+	tc := newTestGRPCConsumer(t, ackBatch)
+
+	a, err := newTestBrokerAction(&StreamInfo{Type: EventStreamTypeGRPC, GRPC: &grpcActionInfo{
+		Address:  tc.listener.Addr().String(),
+		Metadata: map[string]string{"authorization": "Bearer token1"},
+	}})
+	assert.NoError(err)
+	action := a.(*grpcAction)
+
+	events := []*eventsapi.EventEntry{
+		{SubID: "sb-1", ChaincodeID: "asset_transfer", BlockNumber: 10, TransactionIndex: 1, EventIndex: 2, EventName: "Created", Payload: map[string]interface{}{"id": "asset1"}, Headers: map[string]string{"x-sub": "sb-1"}},
+		{SubID: "sb-2", BlockNumber: 11, EventName: "Deleted"},
+	}
+	err = action.attemptBatch(context.Background(), 1, 1, events)
+	assert.NoError(err)
+	md := <-tc.metadata
+	assert.Equal([]string{"Bearer token1"}, md.Get("authorization"))
+
+	batch := <-tc.batches
+	assert.Equal("es-1", batch.StreamId)
+	assert.Equal(uint64(1), batch.BatchNumber)
+	assert.Equal(2, len(batch.Events))
+	assert.Equal("sb-1", batch.Events[0].SubId)
+	assert.Equal("asset_transfer", batch.Events[0].ChaincodeId)
+	assert.Equal(int64(2), batch.Events[0].EventIndex)
+	assert.Equal("sb-1", batch.Events[0].Headers["x-sub"])
+	var payload map[string]interface{}
+	err = json.Unmarshal(batch.Events[0].Payload, &payload)
+	assert.NoError(err)
+	assert.Equal("asset1", payload["id"])
+	assert.Equal("null", string(batch.Events[1].Payload))
+
+	// the next batch is sent on the same stream
+	stream := action.client
+	err = action.attemptBatch(context.Background(), 2, 1, events)
+	assert.NoError(err)
+	assert.Same(stream, action.client)
+	assert.Equal(uint64(2), (<-tc.batches).BatchNumber)
+	assert.Empty(tc.metadata)
+}
+
+func TestGRPCAttemptBatchNotAcked(t *testing.T) {
+	assert := assert.New(t)
+	tc := newTestGRPCConsumer(t, func(stream grpc.ServerStream, batch *eventspb.EventBatch) error {
+		switch batch.Attempt {
+		case 1:
+			// an acknowledgment of another batch is ignored
+			_ = stream.SendMsg(&eventspb.BatchAck{BatchNumber: batch.BatchNumber - 1})
+			return stream.SendMsg(&eventspb.BatchAck{BatchNumber: batch.BatchNumber, Error: "database unavailable"})
+		case 2:
+			return status.Errorf(codes.Unavailable, "shutting down")
+		case 3:
+			return nil
+		default:
+			return ackBatch(stream, batch)
+		}
+	})
+	action, err := newTestBrokerAction(&StreamInfo{Type: EventStreamTypeGRPC, GRPC: &grpcActionInfo{Address: tc.listener.Addr().String(), RequestTimeoutSec: 1}})
+	assert.NoError(err)
+	events := []*eventsapi.EventEntry{{SubID: "sb-1"}}
+
+	// a batch the consumer fails is retried on the same stream
+	err = action.attemptBatch(context.Background(), 5, 1, events)
+	assert.Regexp("es-1: gRPC consumer failed to process batch 5: database unavailable", err)
+	assert.True(action.connected())
+
+	// a stream that fails is opened again by the next attempt
+	err = action.attemptBatch(context.Background(), 5, 2, events)
+	assert.Regexp("es-1: gRPC stream failed:.*shutting down", err)
+	assert.False(action.connected())
+
+	err = action.attemptBatch(context.Background(), 5, 3, events)
+	assert.Regexp("es-1: Timed out waiting for the gRPC consumer to acknowledge batch 5", err)
+	assert.False(action.connected())
+
+	err = action.attemptBatch(context.Background(), 5, 4, events)
+	assert.NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = action.attemptBatch(ctx, 6, 3, events)
+	assert.Equal(context.Canceled, err)
+	assert.False(action.connected())
+}
+
+func TestGRPCAttemptBatchConnectFailures(t *testing.T) {
+	assert := assert.New(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	listener.Close()
+
+	action, err := newTestBrokerAction(&StreamInfo{Type: EventStreamTypeGRPC, GRPC: &grpcActionInfo{Address: listener.Addr().String(), RequestTimeoutSec: 1}})
+	assert.NoError(err)
+	events := []*eventsapi.EventEntry{{SubID: "sb-1", Payload: map[bool]bool{}}}
+	err = action.attemptBatch(context.Background(), 1, 1, events)
+	assert.Error(err)
+
+	events = []*eventsapi.EventEntry{{SubID: "sb-1"}}
+	err = action.attemptBatch(context.Background(), 1, 1, events)
+	assert.Regexp("es-1: Failed to open gRPC stream", err)
+}
@@ -0,0 +1,103 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// The policies for subscriptions whose checkpoint is ahead of the chain, which happens when a
+// channel is recreated with the same name, such as in development environments. Otherwise the
+// subscription would wait for blocks the chain might never reach
+const (
+	// HeightRegressionFail errors the subscription until it is reset, or the chain catches up
+	HeightRegressionFail = "fail"
+	// HeightRegressionResetToNewest restarts the subscription from the current height of the chain
+	HeightRegressionResetToNewest = "resetToNewest"
+	// HeightRegressionResetToZero restarts the subscription from the first block of the chain
+	HeightRegressionResetToZero = "resetToZero"
+)
+
+// SubscriptionHeightRegression is broadcast on the system topic when the chain is lower than the
+// checkpoint of a subscription
+const SubscriptionHeightRegression = "subscriptionHeightRegression"
+
+// HeightRegressionEvent describes the checkpoint of a subscription that is ahead of the chain, and
+// the policy that was applied
+type HeightRegressionEvent struct {
+	Subscription string `json:"subscription"`
+	Stream       string `json:"stream"`
+	ChannelID    string `json:"channel"`
+	Checkpoint   uint64 `json:"checkpoint"`
+	BlockHeight  uint64 `json:"blockHeight"`
+	Policy       string `json:"policy"`
+}
+
+func validateHeightRegressionPolicy(policy string) error {
+	switch policy {
+	case "", HeightRegressionFail, HeightRegressionResetToNewest, HeightRegressionResetToZero:
+		return nil
+	default:
+		return errors.Errorf(errors.EventStreamsHeightRegressionPolicyInvalid, policy)
+	}
+}
+
+// checkHeightRegression returns the block the subscription restarts from, which is the checkpoint
+// unless the chain is lower than it and the policy resets the subscription. The checkpoint has
+// been restored, so it is kept when the check fails
+func (s *subscription) checkHeightRegression(ctx context.Context, checkpoint uint64) (uint64, error) {
+	result, err := s.client.QueryChainInfo(ctx, s.info.ChannelID, s.info.Signer)
+	if err != nil {
+		return 0, errors.Errorf(errors.RPCCallReturnedError, "QSCC GetChainInfo()", err)
+	}
+	height := result.BCI.Height
+	if checkpoint <= height {
+		return checkpoint, nil
+	}
+	policy := s.ep.stream.sm.getConfig().HeightRegression
+	if policy == "" {
+		policy = HeightRegressionFail
+	}
+	event := &HeightRegressionEvent{
+		Subscription: s.info.ID,
+		Stream:       s.info.Stream,
+		ChannelID:    s.info.ChannelID,
+		Checkpoint:   checkpoint,
+		BlockHeight:  height,
+		Policy:       policy,
+	}
+	switch policy {
+	case HeightRegressionResetToNewest, HeightRegressionResetToZero:
+		restart := height
+		if policy == HeightRegressionResetToZero {
+			restart = 0
+		}
+		log.Warnf("%s: height %d of channel %s is lower than checkpoint %d. Restarting from block %d", s.info.ID, height, s.info.ChannelID, checkpoint, restart)
+		s.ep.initBlockHWM(restart)
+		s.ep.stream.sm.publishSystemEvent(SubscriptionHeightRegression, event)
+		return restart, nil
+	default:
+		// the check is repeated every polling interval, so the event is only published the first time
+		if !s.errored {
+			s.ep.stream.sm.publishSystemEvent(SubscriptionHeightRegression, event)
+		}
+		return 0, errors.Errorf(errors.EventStreamsSubscribeHeightRegression, height, s.info.ChannelID, checkpoint)
+	}
+}
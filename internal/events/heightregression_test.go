@@ -0,0 +1,119 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	mockfabric "github.com/hyperledger/firefly-fabconnect/mocks/fabric/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newHeightRegressionTestSub(policy string, height uint64, err error) (*mockSubMgr, *subscription) {
+	m := &mockSubMgr{config: &conf.EventstreamConf{HeightRegression: policy}}
+	m.stream = newTestStream(m)
+	rpc := &mockfabric.RPCClient{}
+	var res *fab.BlockchainInfoResponse
+	if err == nil {
+		res = &fab.BlockchainInfoResponse{BCI: &common.BlockchainInfo{Height: height}}
+	}
+	rpc.On("QueryChainInfo", mock.Anything, "channel1", "user1").Return(res, err)
+	i := testSubInfo("glastonbury")
+	i.ChannelID = "channel1"
+	i.Signer = "user1"
+	s, _ := newSubscription(m.stream, rpc, i)
+	return m, s
+}
+
+func TestValidateHeightRegressionPolicy(t *testing.T) {
+	assert := assert.New(t)
+	for _, policy := range []string{"", HeightRegressionFail, HeightRegressionResetToNewest, HeightRegressionResetToZero} {
+		assert.NoError(validateHeightRegressionPolicy(policy))
+	}
+	assert.EqualError(validateHeightRegressionPolicy("rewind"), "Invalid heightRegression policy 'rewind'. Must be one of fail, resetToNewest or resetToZero")
+
+	sm := newTestSubscriptionManager()
+	sm.config.HeightRegression = "rewind"
+	assert.Regexp("Invalid heightRegression policy", sm.Init())
+}
+
+func TestCheckHeightRegressionCheckpointInChain(t *testing.T) {
+	assert := assert.New(t)
+	m, s := newHeightRegressionTestSub("", 10, nil)
+	for _, checkpoint := range []uint64{5, 10} {
+		blockHeight, err := s.checkHeightRegression(context.Background(), checkpoint)
+		assert.NoError(err)
+		assert.Equal(checkpoint, blockHeight)
+	}
+	assert.Empty(m.getSystemEvents())
+}
+
+func TestCheckHeightRegressionFail(t *testing.T) {
+	assert := assert.New(t)
+	m, s := newHeightRegressionTestSub("", 10, nil)
+	s.setCheckpointBlockHeight(25)
+	_, err := s.checkHeightRegression(context.Background(), 25)
+	assert.EqualError(err, "The height 10 of channel 'channel1' is lower than the checkpoint 25 of the subscription. Reset the subscription, or configure a heightRegression policy to reset it automatically")
+	assert.Equal(uint64(25), s.blockHWM())
+	assert.Equal([]interface{}{&HeightRegressionEvent{
+		Subscription: "test",
+		Stream:       "streamID",
+		ChannelID:    "channel1",
+		Checkpoint:   25,
+		BlockHeight:  10,
+		Policy:       HeightRegressionFail,
+	}}, m.getSystemEvents())
+
+	// the event is not published again while the subscription stays errored
+	s.setErrored(m, err)
+	_, err = s.checkHeightRegression(context.Background(), 25)
+	assert.Error(err)
+	assert.Equal(1, len(m.getSystemEvents()))
+}
+
+func TestCheckHeightRegressionReset(t *testing.T) {
+	assert := assert.New(t)
+	m, s := newHeightRegressionTestSub(HeightRegressionResetToNewest, 10, nil)
+	s.setCheckpointBlockHeight(25)
+	blockHeight, err := s.checkHeightRegression(context.Background(), 25)
+	assert.NoError(err)
+	assert.Equal(uint64(10), blockHeight)
+	assert.Equal(uint64(10), s.blockHWM())
+	assert.Equal(HeightRegressionResetToNewest, m.getSystemEvents()[0].(*HeightRegressionEvent).Policy)
+
+	m, s = newHeightRegressionTestSub(HeightRegressionResetToZero, 10, nil)
+	s.setCheckpointBlockHeight(25)
+	blockHeight, err = s.checkHeightRegression(context.Background(), 25)
+	assert.NoError(err)
+	assert.Equal(uint64(0), blockHeight)
+	assert.Equal(uint64(0), s.blockHWM())
+	assert.Equal(HeightRegressionResetToZero, m.getSystemEvents()[0].(*HeightRegressionEvent).Policy)
+}
+
+func TestCheckHeightRegressionQueryFail(t *testing.T) {
+	assert := assert.New(t)
+	m, s := newHeightRegressionTestSub(HeightRegressionResetToNewest, 0, fmt.Errorf("pop"))
+	_, err := s.checkHeightRegression(context.Background(), 25)
+	assert.Regexp("QSCC GetChainInfo.*pop", err)
+	assert.Empty(m.getSystemEvents())
+}
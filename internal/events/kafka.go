@@ -0,0 +1,295 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/hyperledger/firefly-fabconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// KafkaPartitionKeySubscription keys the messages by the subscription of the event, so the events of each subscription are kept in order
+	KafkaPartitionKeySubscription = "subscription"
+	// KafkaPartitionKeyChaincode keys the messages by the chaincode that emitted the event
+	KafkaPartitionKeyChaincode = "chaincode"
+	// KafkaPartitionKeyNone sends the messages without a key, spreading them over all the partitions of the topic
+	KafkaPartitionKeyNone = "none"
+
+	DefaultKafkaRequestTimeoutSec = 30
+)
+
+type kafkaActionInfo struct {
+	Brokers  []string `json:"brokers,omitempty"`
+	Topic    string   `json:"topic,omitempty"`
+	ClientID string   `json:"clientID,omitempty"`
+	// One of "subscription" (the default), "chaincode" or "none"
+	PartitionKey      string            `json:"partitionKey,omitempty"`
+	RequestTimeoutSec uint32            `json:"requestTimeoutSec,omitempty"`
+	SASL              *kafkaSASLInfo    `json:"sasl,omitempty"`
+	TLS               *actionTLSInfo    `json:"tls,omitempty"`
+	Headers           map[string]string `json:"headers,omitempty"`
+}
+
+type kafkaSASLInfo struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// kafkaProducer is the subset of the sarama sync producer used to publish batches
+type kafkaProducer interface {
+	SendMessages(msgs []*sarama.ProducerMessage) error
+	Close() error
+}
+
+// defined to allow mocking in tests
+var newKafkaProducer = func(brokers []string, config *sarama.Config) (kafkaProducer, error) {
+	return sarama.NewSyncProducer(brokers, config)
+}
+
+type kafkaAction struct {
+	brokerConnection[kafkaProducer]
+	spec *kafkaActionInfo
+	avro *avroEncoder // created on the first batch of a stream with the avro format
+}
+
+func validateKafkaConfig(spec *kafkaActionInfo) error {
+	if spec == nil || len(spec.Brokers) == 0 || spec.Brokers[0] == "" {
+		return errors.Errorf(errors.EventStreamsKafkaNoBrokers)
+	}
+	if spec.Topic == "" {
+		return errors.Errorf(errors.EventStreamsKafkaNoTopic)
+	}
+	pk := strings.ToLower(spec.PartitionKey)
+	if pk != "" && pk != KafkaPartitionKeySubscription && pk != KafkaPartitionKeyChaincode && pk != KafkaPartitionKeyNone {
+		return errors.Errorf(errors.EventStreamsKafkaInvalidPartitionKey, spec.PartitionKey)
+	}
+	if spec.SASL != nil && !utils.AllOrNoneReqd(spec.SASL.Username, spec.SASL.Password) {
+		return errors.Errorf(errors.ConfigKafkaMissingBadSASL)
+	}
+	return spec.TLS.validate()
+}
+
+func setKafkaDefaults(spec *kafkaActionInfo) {
+	spec.PartitionKey = strings.ToLower(spec.PartitionKey)
+	if spec.PartitionKey == "" {
+		spec.PartitionKey = KafkaPartitionKeySubscription
+	}
+	if spec.RequestTimeoutSec == 0 {
+		spec.RequestTimeoutSec = DefaultKafkaRequestTimeoutSec
+	}
+}
+
+// redactKafkaConfig returns a copy of the settings with the SASL password redacted
+func redactKafkaConfig(spec *kafkaActionInfo) *kafkaActionInfo {
+	if spec == nil {
+		return nil
+	}
+	redacted := *spec
+	if spec.SASL != nil {
+		sasl := *spec.SASL
+		sasl.Password = redactSecret(sasl.Password)
+		redacted.SASL = &sasl
+	}
+	return &redacted
+}
+
+// restoreKafkaSecrets sets the redacted SASL password of an update back to the existing one
+func restoreKafkaSecrets(spec, existing *kafkaActionInfo) {
+	if spec == nil || spec.SASL == nil {
+		return
+	}
+	if existing == nil || existing.SASL == nil {
+		existing = &kafkaActionInfo{SASL: &kafkaSASLInfo{}}
+	}
+	restoreSecret(&spec.SASL.Password, existing.SASL.Password)
+}
+
+// mergeKafkaConfig returns the existing settings, overridden by those set in an update
+func mergeKafkaConfig(existing, update *kafkaActionInfo) *kafkaActionInfo {
+	merged := *existing
+	if len(update.Brokers) > 0 {
+		merged.Brokers = update.Brokers
+	}
+	if update.Topic != "" {
+		merged.Topic = update.Topic
+	}
+	if update.ClientID != "" {
+		merged.ClientID = update.ClientID
+	}
+	if update.PartitionKey != "" {
+		merged.PartitionKey = update.PartitionKey
+	}
+	if update.RequestTimeoutSec != 0 {
+		merged.RequestTimeoutSec = update.RequestTimeoutSec
+	}
+	if update.SASL != nil {
+		merged.SASL = update.SASL
+	}
+	if update.TLS != nil {
+		merged.TLS = update.TLS
+	}
+	if update.Headers != nil {
+		merged.Headers = update.Headers
+	}
+	return &merged
+}
+
+func newKafkaAction(es *eventStream, spec *kafkaActionInfo) (*kafkaAction, error) {
+	if err := validateKafkaConfig(spec); err != nil {
+		return nil, err
+	}
+	setKafkaDefaults(spec)
+	k := &kafkaAction{
+		brokerConnection: brokerConnection[kafkaProducer]{
+			es:            es,
+			broker:        "Kafka brokers",
+			connectFailed: errors.EventStreamsKafkaConnectFailed,
+		},
+		spec: spec,
+	}
+	k.dial = k.connect
+	return k, nil
+}
+
+func (k *kafkaAction) connect(ctx context.Context) (kafkaProducer, error) {
+	config, err := k.producerConfig()
+	if err != nil {
+		return nil, err
+	}
+	return newKafkaProducer(k.spec.Brokers, config)
+}
+
+// producerConfig builds the sarama configuration of the producer. Retries are left to the
+// event stream, so a batch is retried with the same backoff and error handling as a webhook
+func (k *kafkaAction) producerConfig() (*sarama.Config, error) {
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Retry.Max = 0
+	config.Producer.Timeout = time.Duration(k.spec.RequestTimeoutSec) * time.Second
+	config.Net.DialTimeout = config.Producer.Timeout
+	config.Net.ReadTimeout = config.Producer.Timeout
+	config.Net.WriteTimeout = config.Producer.Timeout
+	config.Version = sarama.V2_0_0_0
+	config.ClientID = k.spec.ClientID
+	if config.ClientID == "" {
+		config.ClientID = k.es.spec.ID
+	}
+	if k.spec.SASL != nil && k.spec.SASL.Username != "" {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User = k.spec.SASL.Username
+		config.Net.SASL.Password = k.spec.SASL.Password
+	}
+	tlsConfig, err := k.spec.TLS.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	config.Net.TLS.Enable = tlsConfig != nil
+	config.Net.TLS.Config = tlsConfig
+	return config, nil
+}
+
+// partitionKey returns the key of the message for an event, which selects its partition
+func (k *kafkaAction) partitionKey(event *api.EventEntry) sarama.Encoder {
+	switch k.spec.PartitionKey {
+	case KafkaPartitionKeyChaincode:
+		return sarama.StringEncoder(event.ChaincodeID)
+	case KafkaPartitionKeyNone:
+		return nil
+	default:
+		return sarama.StringEncoder(event.SubID)
+	}
+}
+
+// value serializes an event as the value of its message, as JSON or in the avro format
+func (k *kafkaAction) value(ctx context.Context, event *api.EventEntry) ([]byte, error) {
+	if k.es.spec.Format != EventFormatAvro {
+		return json.Marshal(event)
+	}
+	if k.avro == nil {
+		avro, err := newAvroEncoder(newSchemaRegistryClient(&k.es.sm.getConfig().SchemaRegistry))
+		if err != nil {
+			return nil, err
+		}
+		k.avro = avro
+	}
+	return k.avro.encode(ctx, k.spec.Topic, event)
+}
+
+// messages builds a message for each event in the batch. The headers of the stream, and the
+// webhook headers of the subscription of each event, are set as record headers
+func (k *kafkaAction) messages(ctx context.Context, events []*api.EventEntry) ([]*sarama.ProducerMessage, error) {
+	msgs := make([]*sarama.ProducerMessage, 0, len(events))
+	for _, event := range events {
+		b, err := k.value(ctx, event)
+		if err != nil {
+			return nil, err
+		}
+		var headers []sarama.RecordHeader
+		for h, v := range k.spec.Headers {
+			headers = append(headers, sarama.RecordHeader{Key: []byte(h), Value: []byte(v)})
+		}
+		for h, v := range event.Headers {
+			if _, exists := k.spec.Headers[h]; !exists {
+				headers = append(headers, sarama.RecordHeader{Key: []byte(h), Value: []byte(v)})
+			}
+		}
+		msgs = append(msgs, &sarama.ProducerMessage{
+			Topic:   k.spec.Topic,
+			Key:     k.partitionKey(event),
+			Value:   sarama.ByteEncoder(b),
+			Headers: headers,
+		})
+	}
+	return msgs, nil
+}
+
+// attemptBatch publishes all the events of a batch to the topic. The batch only succeeds
+// when every message has been acknowledged by the brokers
+func (k *kafkaAction) attemptBatch(ctx context.Context, batchNumber, attempt uint64, events []*api.EventEntry) error {
+	msgs, err := k.messages(ctx, events)
+	if err != nil {
+		return err
+	}
+	return k.send(ctx, batchNumber, attempt, msgs)
+}
+
+// send publishes the messages, connecting the producer first if it is not connected
+func (k *kafkaAction) send(ctx context.Context, batchNumber, attempt uint64, msgs []*sarama.ProducerMessage) error {
+	esID := k.es.spec.ID
+	producer, err := k.connection(ctx, attempt, strings.Join(k.spec.Brokers, ","))
+	if err != nil {
+		return err
+	}
+	log.Infof("%s: Kafka --> %s batch=%d events=%d (attempt=%d)", esID, k.spec.Topic, batchNumber, len(msgs), attempt)
+	if err := producer.SendMessages(msgs); err != nil {
+		log.Errorf("%s: Kafka publish to %s failed (attempt=%d): %s", esID, k.spec.Topic, attempt, err)
+		k.close()
+		return errors.Errorf(errors.EventStreamsKafkaPublishFailed, esID, k.spec.Topic, err)
+	}
+	log.Infof("%s: Kafka <-- %s batch=%d ok", esID, k.spec.Topic, batchNumber)
+	return nil
+}
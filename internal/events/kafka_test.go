@@ -0,0 +1,109 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func testKafkaEvents() []*eventsapi.EventEntry {
+	return []*eventsapi.EventEntry{
+		{SubID: "sb-1", ChaincodeID: "asset_transfer", EventName: "Created", Headers: map[string]string{"x-sub": "a", "x-event": "b"}},
+		{SubID: "sb-2", ChaincodeID: "asset_transfer", EventName: "Deleted"},
+	}
+}
+
+func TestKafkaValidateConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Regexp("Must specify kafka.brokers", validateKafkaConfig(nil))
+	assert.Regexp("Must specify kafka.brokers", validateKafkaConfig(&kafkaActionInfo{Brokers: []string{""}}))
+	assert.Regexp("Must specify kafka.topic", validateKafkaConfig(&kafkaActionInfo{Brokers: []string{"broker:9092"}}))
+	spec := &kafkaActionInfo{Brokers: []string{"broker:9092"}, Topic: "events", PartitionKey: "Chaincode"}
+	assert.NoError(validateKafkaConfig(spec))
+	spec.PartitionKey = "txid"
+	assert.Regexp("Invalid partition key 'txid'", validateKafkaConfig(spec))
+	spec.PartitionKey = ""
+	spec.SASL = &kafkaSASLInfo{Username: "user1"}
+	assert.Error(validateKafkaConfig(spec))
+	spec.SASL.Password = "pass1"
+	assert.NoError(validateKafkaConfig(spec))
+	spec.TLS = &actionTLSInfo{Enabled: true, ClientCertsFile: "cert.pem"}
+	assert.Error(validateKafkaConfig(spec))
+
+	spec = &kafkaActionInfo{Brokers: []string{"broker:9092"}, Topic: "events", PartitionKey: "NONE"}
+	setKafkaDefaults(spec)
+	assert.Equal(KafkaPartitionKeyNone, spec.PartitionKey)
+	assert.Equal(uint32(DefaultKafkaRequestTimeoutSec), spec.RequestTimeoutSec)
+
+	merged := mergeKafkaConfig(&kafkaActionInfo{Brokers: []string{"broker:9092"}, Topic: "events"}, &kafkaActionInfo{Topic: "events2", PartitionKey: "Chaincode"})
+	assert.Equal([]string{"broker:9092"}, merged.Brokers)
+	assert.Equal("events2", merged.Topic)
+	assert.Equal("Chaincode", merged.PartitionKey)
+}
+
+func TestKafkaAttemptBatch(t *testing.T) {
+	assert := assert.New(t)
+	producer := &mockBrokerClient{}
+	configs := mockBrokerClients(t, producer)
+
+	spec := &kafkaActionInfo{
+		Brokers: []string{"broker:9092"},
+		Topic:   "events",
+		Headers: map[string]string{"x-stream": "s", "x-sub": "stream-wins"},
+		SASL:    &kafkaSASLInfo{Username: "user1", Password: "pass1"},
+	}
+	action, err := newTestBrokerAction(&StreamInfo{Type: EventStreamTypeKafka, Kafka: spec})
+	assert.NoError(err)
+
+	err = action.attemptBatch(context.Background(), 1, 1, testKafkaEvents())
+	assert.NoError(err)
+	assert.Equal(1, len(*configs))
+	config := (*configs)[0].(*sarama.Config)
+	assert.Equal("es-1", config.ClientID)
+	assert.True(config.Net.SASL.Enable)
+	assert.Equal("user1", config.Net.SASL.User)
+	assert.False(config.Net.TLS.Enable)
+	assert.Equal(0, config.Producer.Retry.Max)
+
+	assert.Equal(1, len(producer.sent))
+	msgs := producer.sent[0].([]*sarama.ProducerMessage)
+	assert.Equal(2, len(msgs))
+	assert.Equal("events", msgs[0].Topic)
+	assert.Equal(sarama.StringEncoder("sb-1"), msgs[0].Key)
+	assert.Equal(sarama.StringEncoder("sb-2"), msgs[1].Key)
+	value, _ := msgs[0].Value.Encode()
+	assert.Contains(string(value), `"eventName":"Created"`)
+	// the headers of the stream take precedence over those of the subscription
+	assert.Equal(3, len(msgs[0].Headers))
+	assert.Equal(2, len(msgs[1].Headers))
+
+	spec.PartitionKey = KafkaPartitionKeyChaincode
+	err = action.attemptBatch(context.Background(), 2, 1, testKafkaEvents())
+	assert.NoError(err)
+	assert.Equal(sarama.StringEncoder("asset_transfer"), producer.sent[1].([]*sarama.ProducerMessage)[0].Key)
+
+	spec.PartitionKey = KafkaPartitionKeyNone
+	err = action.attemptBatch(context.Background(), 3, 1, testKafkaEvents())
+	assert.NoError(err)
+	assert.Nil(producer.sent[2].([]*sarama.ProducerMessage)[0].Key)
+}
@@ -0,0 +1,78 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"encoding/json"
+)
+
+// Lifecycle events of streams and subscriptions, broadcast on the reserved system
+// topic of the WebSocket server so that an admin UI can follow configuration changes
+const (
+	StreamCreated         = "streamCreated"
+	StreamUpdated         = "streamUpdated"
+	StreamSuspended       = "streamSuspended"
+	StreamResumed         = "streamResumed"
+	StreamDeleted         = "streamDeleted"
+	StreamErrored         = "streamErrored"
+	StreamRecovered       = "streamRecovered"
+	SubscriptionCreated   = "subscriptionCreated"
+	SubscriptionUpdated   = "subscriptionUpdated"
+	SubscriptionDeleted   = "subscriptionDeleted"
+	SubscriptionErrored   = "subscriptionErrored"
+	SubscriptionRecovered = "subscriptionRecovered"
+)
+
+// LifecycleEvent carries the full spec of the stream or subscription before and after
+// the change, in the same form as the REST API. Before is omitted on creation, and
+// after on deletion
+type LifecycleEvent struct {
+	ID     string          `json:"id"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// specSnapshot captures a spec as it is now, as specs are updated in place
+func specSnapshot(spec interface{}) json.RawMessage {
+	b, _ := json.Marshal(spec)
+	return b
+}
+
+func (s *subscriptionMGR) publishLifecycleEvent(eventType, id string, before, after json.RawMessage, err error) {
+	if s.systemEvents == nil {
+		return
+	}
+	event := &LifecycleEvent{
+		ID:     id,
+		Before: before,
+		After:  after,
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	s.systemEvents.Publish(eventType, event)
+}
+
+// publishSystemEvent broadcasts an event about the delivery of events, such as a height regression
+// or a sequence gap
+func (s *subscriptionMGR) publishSystemEvent(eventType string, data interface{}) {
+	if s.systemEvents == nil {
+		return
+	}
+	s.systemEvents.Publish(eventType, data)
+}
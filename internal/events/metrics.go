@@ -0,0 +1,152 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/metrics"
+)
+
+// StreamStats reports the delivery of a stream since the gateway started. Returned by the API for a
+// single stream
+type StreamStats struct {
+	BatchesDelivered  uint64            `json:"batchesDelivered"`
+	BatchesFailed     uint64            `json:"batchesFailed"`
+	EventsDelivered   uint64            `json:"eventsDelivered"`
+	InFlight          uint64            `json:"inFlight"`
+	AvgBatchLatencyMS float64           `json:"avgBatchLatencyMS"`
+	LastError         string            `json:"lastError,omitempty"`
+	LastErrorTime     string            `json:"lastErrorTime,omitempty"`
+	HighestBlocks     map[string]uint64 `json:"highestBlocks,omitempty"` // the highest block delivered for each subscription
+}
+
+// streamCounters totals the outcomes of delivering the batches of a stream
+type streamCounters struct {
+	events        uint64
+	batches       uint64
+	failedBatches uint64
+	latency       uint64 // nanoseconds, totalled across the delivered and failed batches
+	sequenceGaps  uint64
+	missingEvents uint64
+	// batches skipped after they failed, that were written to the dead-letter destination, or could not be
+	deadLetters        uint64
+	deadLetterFailures uint64
+	// the last failure, and the highest block delivered for each subscription, under mux
+	mux           sync.Mutex
+	lastError     string
+	lastErrorTime time.Time
+	highestBlocks map[string]uint64
+}
+
+func (c *streamCounters) record(events []*eventData, latency time.Duration, err error) {
+	atomic.AddUint64(&c.latency, uint64(latency))
+	if err != nil {
+		atomic.AddUint64(&c.failedBatches, 1)
+		c.mux.Lock()
+		c.lastError = err.Error()
+		c.lastErrorTime = time.Now()
+		c.mux.Unlock()
+		return
+	}
+	atomic.AddUint64(&c.batches, 1)
+	atomic.AddUint64(&c.events, uint64(len(events)))
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.highestBlocks == nil {
+		c.highestBlocks = make(map[string]uint64)
+	}
+	for _, event := range events {
+		if event.event.BlockNumber >= c.highestBlocks[event.event.SubID] {
+			c.highestBlocks[event.event.SubID] = event.event.BlockNumber
+		}
+	}
+}
+
+// stats returns the statistics of the stream, with the highest blocks of its current subscriptions
+func (a *eventStream) stats() *StreamStats {
+	c := &a.counters
+	stats := &StreamStats{
+		BatchesDelivered: atomic.LoadUint64(&c.batches),
+		BatchesFailed:    atomic.LoadUint64(&c.failedBatches),
+		EventsDelivered:  atomic.LoadUint64(&c.events),
+	}
+	if batches := stats.BatchesDelivered + stats.BatchesFailed; batches > 0 {
+		stats.AvgBatchLatencyMS = float64(atomic.LoadUint64(&c.latency)) / float64(batches) / float64(time.Millisecond)
+	}
+	a.batchCond.L.Lock()
+	stats.InFlight = a.inFlight
+	a.batchCond.L.Unlock()
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.lastError != "" {
+		stats.LastError = c.lastError
+		stats.LastErrorTime = c.lastErrorTime.UTC().Format(time.RFC3339Nano)
+	}
+	for _, sub := range a.sm.subscriptionsForStream(a.spec.ID) {
+		if block, ok := c.highestBlocks[sub.info.ID]; ok {
+			if stats.HighestBlocks == nil {
+				stats.HighestBlocks = make(map[string]uint64)
+			}
+			stats.HighestBlocks[sub.info.ID] = block
+		}
+	}
+	return stats
+}
+
+// recordSequenceGap totals the gaps in the sequences of the subscriptions of a stream
+func (c *streamCounters) recordSequenceGap(missing uint64) {
+	atomic.AddUint64(&c.sequenceGaps, 1)
+	atomic.AddUint64(&c.missingEvents, missing)
+}
+
+// Metrics reports the delivery of each event stream, tagged with the stream ID
+func (s *subscriptionMGR) Metrics() []metrics.Metric {
+	s.streamsMux.RLock()
+	streams := make([]*eventStream, 0, len(s.streams))
+	for _, stream := range s.streams {
+		streams = append(streams, stream)
+	}
+	s.streamsMux.RUnlock()
+
+	var m []metrics.Metric
+	for _, stream := range streams {
+		tags := map[string]string{"stream": stream.spec.ID}
+		stream.batchCond.L.Lock()
+		inFlight := stream.inFlight
+		stream.batchCond.L.Unlock()
+		suspended := 0.0
+		if stream.spec.Suspended != nil && *stream.spec.Suspended {
+			suspended = 1
+		}
+		m = append(m,
+			metrics.Metric{Name: "eventstream.inflight", Kind: metrics.Gauge, Value: float64(inFlight), Tags: tags},
+			metrics.Metric{Name: "eventstream.batchsize", Kind: metrics.Gauge, Value: float64(stream.batchSize()), Tags: tags},
+			metrics.Metric{Name: "eventstream.suspended", Kind: metrics.Gauge, Value: suspended, Tags: tags},
+			metrics.Metric{Name: "eventstream.events.delivered", Kind: metrics.Counter, Value: float64(atomic.LoadUint64(&stream.counters.events)), Tags: tags},
+			metrics.Metric{Name: "eventstream.batches.delivered", Kind: metrics.Counter, Value: float64(atomic.LoadUint64(&stream.counters.batches)), Tags: tags},
+			metrics.Metric{Name: "eventstream.batches.failed", Kind: metrics.Counter, Value: float64(atomic.LoadUint64(&stream.counters.failedBatches)), Tags: tags},
+			metrics.Metric{Name: "eventstream.sequence.gaps", Kind: metrics.Counter, Value: float64(atomic.LoadUint64(&stream.counters.sequenceGaps)), Tags: tags},
+			metrics.Metric{Name: "eventstream.sequence.missing", Kind: metrics.Counter, Value: float64(atomic.LoadUint64(&stream.counters.missingEvents)), Tags: tags},
+			metrics.Metric{Name: "eventstream.deadletters.written", Kind: metrics.Counter, Value: float64(atomic.LoadUint64(&stream.counters.deadLetters)), Tags: tags},
+			metrics.Metric{Name: "eventstream.deadletters.failed", Kind: metrics.Counter, Value: float64(atomic.LoadUint64(&stream.counters.deadLetterFailures)), Tags: tags},
+		)
+	}
+	return m
+}
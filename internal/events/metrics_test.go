@@ -0,0 +1,108 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/hyperledger/firefly-fabconnect/internal/metrics"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamMetrics(t *testing.T) {
+	assert := assert.New(t)
+	sm, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			BatchSize: 5,
+			Webhook:   &webhookActionInfo{},
+		}, nil, 200)
+	defer svr.Close()
+	defer close(eventStream)
+	defer stream.stop()
+
+	stream.counters.record(testEvents("sub1", 1, 2, 3, 4, 5), time.Millisecond, nil)
+	stream.counters.record(testEvents("sub1", 6, 7, 8), time.Millisecond, nil)
+	stream.counters.record(testEvents("sub1", 9, 10, 11, 12, 13), time.Millisecond, fmt.Errorf("pop"))
+	stream.counters.recordSequenceGap(3)
+
+	values := make(map[string]float64)
+	for _, m := range sm.Metrics() {
+		assert.Equal(stream.spec.ID, m.Tags["stream"])
+		values[m.Name] = m.Value
+		if m.Name == "eventstream.events.delivered" {
+			assert.Equal(metrics.Counter, m.Kind)
+		}
+	}
+	assert.Equal(float64(8), values["eventstream.events.delivered"])
+	assert.Equal(float64(2), values["eventstream.batches.delivered"])
+	assert.Equal(float64(1), values["eventstream.batches.failed"])
+	assert.Equal(float64(1), values["eventstream.sequence.gaps"])
+	assert.Equal(float64(3), values["eventstream.sequence.missing"])
+	assert.Equal(float64(5), values["eventstream.batchsize"])
+	assert.Equal(float64(0), values["eventstream.inflight"])
+	assert.Equal(float64(0), values["eventstream.suspended"])
+}
+
+func testEvents(subID string, blocks ...uint64) []*eventData {
+	events := make([]*eventData, len(blocks))
+	for i, block := range blocks {
+		events[i] = testEvent(subID)
+		events[i].event.BlockNumber = block
+	}
+	return events
+}
+
+func TestStreamStats(t *testing.T) {
+	assert := assert.New(t)
+	sm, stream, svr, eventStream := newTestStreamForBatching(
+		&StreamInfo{
+			BatchSize: 5,
+			Webhook:   &webhookActionInfo{},
+		}, nil, 200)
+	defer svr.Close()
+	defer close(eventStream)
+	defer stream.stop()
+	sm.subscriptions["sub1"] = &subscription{info: &eventsapi.SubscriptionInfo{ID: "sub1", Stream: stream.spec.ID}}
+	params := httprouter.Params{{Key: "streamId", Value: stream.spec.ID}}
+
+	info, restErr := sm.StreamByID(nil, nil, params)
+	assert.Nil(restErr)
+	assert.Equal(&StreamStats{}, info.Stats)
+	assert.Nil(stream.spec.Stats)
+
+	stream.counters.record(testEvents("sub1", 10, 12), 10*time.Millisecond, nil)
+	stream.counters.record(testEvents("sub1", 11), 20*time.Millisecond, nil)
+	stream.counters.record(testEvents("sub1", 13), 30*time.Millisecond, fmt.Errorf("pop"))
+	// subscriptions that are no longer on the stream are not reported
+	stream.counters.record(testEvents("sub2", 20), 0, nil)
+
+	info, restErr = sm.StreamByID(nil, nil, params)
+	assert.Nil(restErr)
+	stats := info.Stats
+	assert.Equal(uint64(3), stats.BatchesDelivered)
+	assert.Equal(uint64(1), stats.BatchesFailed)
+	assert.Equal(uint64(4), stats.EventsDelivered)
+	assert.Equal(15.0, stats.AvgBatchLatencyMS)
+	assert.Equal("pop", stats.LastError)
+	assert.NotEmpty(stats.LastErrorTime)
+	assert.Equal(map[string]uint64{"sub1": 12}, stats.HighestBlocks)
+	assert.Nil(stream.spec.Stats)
+}
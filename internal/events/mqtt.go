@@ -0,0 +1,286 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultMQTTQoS               = 1
+	DefaultMQTTKeepAliveSec      = 60
+	DefaultMQTTRequestTimeoutSec = 30
+)
+
+type mqttActionInfo struct {
+	BrokerURL string `json:"brokerURL,omitempty"`
+	Topic     string `json:"topic,omitempty"`
+	// 0 (at most once), 1 (at least once, the default) or 2 (exactly once)
+	QoS               *int           `json:"qos,omitempty"`
+	ClientID          string         `json:"clientID,omitempty"`
+	Username          string         `json:"username,omitempty"`
+	Password          string         `json:"password,omitempty"`
+	KeepAliveSec      uint32         `json:"keepAliveSec,omitempty"`
+	RequestTimeoutSec uint32         `json:"requestTimeoutSec,omitempty"`
+	TLS               *actionTLSInfo `json:"tls,omitempty"`
+}
+
+// mqttClient is the subset of the MQTT client used to publish batches
+type mqttClient interface {
+	Publish(ctx context.Context, topic string, qos byte, payload []byte) error
+	IsConnectionOpen() bool
+	Close() error
+}
+
+// pahoMQTTClient waits for the tokens of the Paho client, bounded by the request timeout and the
+// context of the batch
+type pahoMQTTClient struct {
+	client  paho.Client
+	timeout time.Duration
+}
+
+// defined to allow mocking in tests
+var connectMQTT = func(ctx context.Context, opts *paho.ClientOptions) (mqttClient, error) {
+	c := &pahoMQTTClient{client: paho.NewClient(opts), timeout: opts.ConnectTimeout}
+	if err := c.wait(ctx, c.client.Connect()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Publish sends a message to a topic, and waits for it to be acknowledged at its QoS
+func (c *pahoMQTTClient) Publish(ctx context.Context, topic string, qos byte, payload []byte) error {
+	return c.wait(ctx, c.client.Publish(topic, qos, false, payload))
+}
+
+func (c *pahoMQTTClient) IsConnectionOpen() bool {
+	return c.client.IsConnectionOpen()
+}
+
+func (c *pahoMQTTClient) Close() error {
+	c.client.Disconnect(250)
+	return nil
+}
+
+func (c *pahoMQTTClient) wait(ctx context.Context, token paho.Token) error {
+	timeout := time.NewTimer(c.timeout)
+	defer timeout.Stop()
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-timeout.C:
+		return errors.Errorf(errors.MQTTRequestTimeout, c.timeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type mqttAction struct {
+	brokerConnection[mqttClient]
+	spec *mqttActionInfo
+}
+
+// mqttBrokerURL returns the URL of the broker with the default port of its scheme, 1883 for a
+// plain connection and 8883 for TLS, when it does not have one
+func mqttBrokerURL(brokerURL string) (string, error) {
+	u, err := url.Parse(brokerURL)
+	if err != nil || u.Host == "" {
+		return "", errors.Errorf(errors.MQTTInvalidBrokerURL, brokerURL)
+	}
+	port := "1883"
+	switch strings.ToLower(u.Scheme) {
+	case "tcp", "mqtt":
+	case "ssl", "tls", "mqtts":
+		port = "8883"
+	default:
+		return "", errors.Errorf(errors.MQTTInvalidBrokerURL, brokerURL)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+	return u.String(), nil
+}
+
+func validateMQTTConfig(spec *mqttActionInfo) error {
+	if spec == nil || spec.BrokerURL == "" {
+		return errors.Errorf(errors.EventStreamsMQTTNoBroker)
+	}
+	if _, err := mqttBrokerURL(spec.BrokerURL); err != nil {
+		return err
+	}
+	if spec.Topic == "" {
+		return errors.Errorf(errors.EventStreamsMQTTNoTopic)
+	}
+	if strings.ContainsAny(spec.Topic, "+#") {
+		return errors.Errorf(errors.EventStreamsMQTTInvalidTopic, spec.Topic)
+	}
+	if spec.QoS != nil && (*spec.QoS < 0 || *spec.QoS > 2) {
+		return errors.Errorf(errors.EventStreamsMQTTInvalidQoS, *spec.QoS)
+	}
+	return spec.TLS.validate()
+}
+
+func setMQTTDefaults(spec *mqttActionInfo) {
+	if spec.QoS == nil {
+		qos := DefaultMQTTQoS
+		spec.QoS = &qos
+	}
+	if spec.KeepAliveSec == 0 {
+		spec.KeepAliveSec = DefaultMQTTKeepAliveSec
+	}
+	if spec.RequestTimeoutSec == 0 {
+		spec.RequestTimeoutSec = DefaultMQTTRequestTimeoutSec
+	}
+}
+
+// redactMQTTConfig returns a copy of the settings with the credentials redacted
+func redactMQTTConfig(spec *mqttActionInfo) *mqttActionInfo {
+	if spec == nil {
+		return nil
+	}
+	redacted := *spec
+	redacted.BrokerURL = redactURLCredentials(spec.BrokerURL)
+	redacted.Password = redactSecret(spec.Password)
+	return &redacted
+}
+
+// restoreMQTTSecrets sets the redacted credentials of an update back to the existing ones
+func restoreMQTTSecrets(spec, existing *mqttActionInfo) {
+	if spec == nil {
+		return
+	}
+	if existing == nil {
+		existing = &mqttActionInfo{}
+	}
+	restoreURLCredentials(&spec.BrokerURL, existing.BrokerURL)
+	restoreSecret(&spec.Password, existing.Password)
+}
+
+// mergeMQTTConfig returns the existing settings, overridden by those set in an update
+func mergeMQTTConfig(existing, update *mqttActionInfo) *mqttActionInfo {
+	merged := *existing
+	if update.BrokerURL != "" {
+		merged.BrokerURL = update.BrokerURL
+	}
+	if update.Topic != "" {
+		merged.Topic = update.Topic
+	}
+	if update.QoS != nil {
+		merged.QoS = update.QoS
+	}
+	if update.ClientID != "" {
+		merged.ClientID = update.ClientID
+	}
+	if update.Username != "" {
+		merged.Username = update.Username
+	}
+	if update.Password != "" {
+		merged.Password = update.Password
+	}
+	if update.KeepAliveSec != 0 {
+		merged.KeepAliveSec = update.KeepAliveSec
+	}
+	if update.RequestTimeoutSec != 0 {
+		merged.RequestTimeoutSec = update.RequestTimeoutSec
+	}
+	if update.TLS != nil {
+		merged.TLS = update.TLS
+	}
+	return &merged
+}
+
+func newMQTTAction(es *eventStream, spec *mqttActionInfo) (*mqttAction, error) {
+	if err := validateMQTTConfig(spec); err != nil {
+		return nil, err
+	}
+	setMQTTDefaults(spec)
+	m := &mqttAction{
+		brokerConnection: brokerConnection[mqttClient]{
+			es:            es,
+			broker:        "MQTT broker",
+			connectFailed: errors.EventStreamsMQTTConnectFailed,
+			lost:          func(c mqttClient) bool { return !c.IsConnectionOpen() },
+		},
+		spec: spec,
+	}
+	m.dial = m.connect
+	return m, nil
+}
+
+// connect uses MQTT 3.1.1, and a clean session without automatic reconnection, so the messages that are not
+// acknowledged when the connection is lost are published again by the retry of the batch
+func (m *mqttAction) connect(ctx context.Context) (mqttClient, error) {
+	tlsConfig, err := m.spec.TLS.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	brokerURL, err := mqttBrokerURL(m.spec.BrokerURL)
+	if err != nil {
+		return nil, err
+	}
+	clientID := m.spec.ClientID
+	if clientID == "" {
+		clientID = m.es.spec.ID
+	}
+	timeout := time.Duration(m.spec.RequestTimeoutSec) * time.Second
+	return connectMQTT(ctx, paho.NewClientOptions().
+		AddBroker(brokerURL).
+		SetProtocolVersion(4).
+		SetClientID(clientID).
+		SetUsername(m.spec.Username).
+		SetPassword(m.spec.Password).
+		SetKeepAlive(time.Duration(m.spec.KeepAliveSec)*time.Second).
+		SetConnectTimeout(timeout).
+		SetWriteTimeout(timeout).
+		SetTLSConfig(tlsConfig).
+		SetCleanSession(true).
+		SetAutoReconnect(false))
+}
+
+// attemptBatch publishes the batch to the topic as a single message, with the same JSON array
+// of events as the body of a webhook. The batch succeeds when it is acknowledged at the QoS of
+// the stream, otherwise it is retried by the stream with a new connection
+func (m *mqttAction) attemptBatch(ctx context.Context, batchNumber, attempt uint64, events []*api.EventEntry) error {
+	esID := m.es.spec.ID
+	payload, err := json.Marshal(&events)
+	if err != nil {
+		return err
+	}
+	client, err := m.connection(ctx, attempt, redactURLCredentials(m.spec.BrokerURL))
+	if err != nil {
+		return err
+	}
+	qos := *m.spec.QoS
+	log.Infof("%s: MQTT --> %s batch=%d events=%d qos=%d (attempt=%d)", esID, m.spec.Topic, batchNumber, len(events), qos, attempt)
+	if err := client.Publish(ctx, m.spec.Topic, byte(qos), payload); err != nil {
+		log.Errorf("%s: MQTT publish to %s failed (attempt=%d): %s", esID, m.spec.Topic, attempt, err)
+		m.close()
+		return errors.Errorf(errors.EventStreamsMQTTPublishFailed, esID, m.spec.Topic, err)
+	}
+	log.Infof("%s: MQTT <-- %s batch=%d ok", esID, m.spec.Topic, batchNumber)
+	return nil
+}
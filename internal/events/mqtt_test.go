@@ -0,0 +1,222 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMQTTValidateConfig(t *testing.T) {
+	assert := assert.New(t)
+	qos := 3
+
+	assert.Regexp("Must specify mqtt.brokerURL", validateMQTTConfig(nil))
+	assert.Regexp("Invalid MQTT broker URL 'ws://broker'", validateMQTTConfig(&mqttActionInfo{BrokerURL: "ws://broker"}))
+	spec := &mqttActionInfo{BrokerURL: "tcp://broker:1883"}
+	assert.Regexp("Must specify mqtt.topic", validateMQTTConfig(spec))
+	spec.Topic = "fabric/+/events"
+	assert.Regexp("Invalid MQTT topic 'fabric/\\+/events'", validateMQTTConfig(spec))
+	spec.Topic = "fabric/events"
+	spec.QoS = &qos
+	assert.Regexp("Invalid MQTT QoS 3", validateMQTTConfig(spec))
+	qos = 0
+	assert.NoError(validateMQTTConfig(spec))
+	spec.TLS = &actionTLSInfo{Enabled: true, ClientKeyFile: "key.pem"}
+	assert.Error(validateMQTTConfig(spec))
+
+	spec = &mqttActionInfo{BrokerURL: "tcp://broker:1883", Topic: "fabric/events"}
+	setMQTTDefaults(spec)
+	assert.Equal(DefaultMQTTQoS, *spec.QoS)
+	assert.Equal(uint32(DefaultMQTTKeepAliveSec), spec.KeepAliveSec)
+	assert.Equal(uint32(DefaultMQTTRequestTimeoutSec), spec.RequestTimeoutSec)
+}
+
+func TestMQTTBrokerURL(t *testing.T) {
+	assert := assert.New(t)
+
+	brokerURL, err := mqttBrokerURL("tcp://broker.example.com")
+	assert.NoError(err)
+	assert.Equal("tcp://broker.example.com:1883", brokerURL)
+	brokerURL, err = mqttBrokerURL("MQTTS://broker.example.com")
+	assert.NoError(err)
+	assert.Equal("mqtts://broker.example.com:8883", brokerURL)
+	brokerURL, err = mqttBrokerURL("ssl://broker.example.com:9883")
+	assert.NoError(err)
+	assert.Equal("ssl://broker.example.com:9883", brokerURL)
+
+	_, err = mqttBrokerURL("ws://broker.example.com")
+	assert.Regexp("Invalid MQTT broker URL 'ws://broker.example.com'", err)
+	_, err = mqttBrokerURL("broker.example.com")
+	assert.Regexp("Invalid MQTT broker URL", err)
+}
+
+func TestActionTLSInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	var info *actionTLSInfo
+	tlsConfig, err := info.tlsConfig()
+	assert.NoError(err)
+	assert.Nil(tlsConfig)
+	tlsConfig, err = (&actionTLSInfo{}).tlsConfig()
+	assert.NoError(err)
+	assert.Nil(tlsConfig)
+
+	tlsConfig, err = (&actionTLSInfo{Enabled: true, InsecureSkipVerify: true}).tlsConfig()
+	assert.NoError(err)
+	assert.True(tlsConfig.InsecureSkipVerify)
+
+	_, err = (&actionTLSInfo{Enabled: true, CACertsFile: "/does/not/exist.pem"}).tlsConfig()
+	assert.Regexp("Failed to load the TLS certificates of the stream", err)
+}
+
+func TestMQTTAttemptBatch(t *testing.T) {
+	assert := assert.New(t)
+	client := &mockBrokerClient{}
+	opts := mockBrokerClients(t, client, &mockBrokerClient{})
+	qos := 2
+
+	action, err := newTestBrokerAction(&StreamInfo{Type: EventStreamTypeMQTT, MQTT: &mqttActionInfo{
+		BrokerURL: "tcp://broker:1883",
+		Topic:     "fabric/events",
+		QoS:       &qos,
+		Username:  "user1",
+		Password:  "pass1",
+	}})
+	assert.NoError(err)
+
+	events := []*eventsapi.EventEntry{{SubID: "sb-1", EventName: "Created"}, {SubID: "sb-2", EventName: "Deleted"}}
+	err = action.attemptBatch(context.Background(), 1, 1, events)
+	assert.NoError(err)
+	assert.Equal(1, len(*opts))
+	o := (*opts)[0].(*paho.ClientOptions)
+	assert.Equal("tcp://broker:1883", o.Servers[0].String())
+	assert.Equal("es-1", o.ClientID)
+	assert.Equal("user1", o.Username)
+	assert.Equal(int64(60), o.KeepAlive)
+	assert.Equal(30*time.Second, o.ConnectTimeout)
+	assert.Equal(uint(4), o.ProtocolVersion)
+	assert.True(o.CleanSession)
+	assert.False(o.AutoReconnect)
+	assert.Nil(o.TLSConfig)
+
+	// the whole batch is published as one message
+	assert.Equal(1, len(client.sent))
+	published := client.sent[0].(*mqttPublished)
+	assert.Equal("fabric/events", published.topic)
+	assert.Equal(byte(2), published.qos)
+	var sent []*eventsapi.EventEntry
+	err = json.Unmarshal(published.payload, &sent)
+	assert.NoError(err)
+	assert.Equal(2, len(sent))
+	assert.Equal("Deleted", sent[1].EventName)
+
+	// the client ID of the settings replaces that of the stream
+	action, err = newTestBrokerAction(&StreamInfo{Type: EventStreamTypeMQTT, MQTT: &mqttActionInfo{BrokerURL: "tcp://broker", Topic: "fabric/events", ClientID: "fabconnect1"}})
+	assert.NoError(err)
+	err = action.attemptBatch(context.Background(), 1, 1, events)
+	assert.NoError(err)
+	o = (*opts)[1].(*paho.ClientOptions)
+	assert.Equal("tcp://broker:1883", o.Servers[0].String())
+	assert.Equal("fabconnect1", o.ClientID)
+}
+
+func newTestMQTTBroker(t *testing.T, reply func(conn net.Conn, p packets.ControlPacket)) (string, chan packets.ControlPacket) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	received := make(chan packets.ControlPacket, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			p, err := packets.ReadPacket(conn)
+			if err != nil {
+				return
+			}
+			received <- p
+			reply(conn, p)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return "tcp://" + listener.Addr().String(), received
+}
+
+func TestMQTTConnectAndPublish(t *testing.T) {
+	assert := assert.New(t)
+	brokerURL, received := newTestMQTTBroker(t, func(conn net.Conn, p packets.ControlPacket) {
+		switch p := p.(type) {
+		case *packets.ConnectPacket:
+			_ = packets.NewControlPacket(packets.Connack).Write(conn)
+		case *packets.PublishPacket:
+			// a QoS 2 publish is never acknowledged
+			if p.Qos == 1 {
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				_ = ack.Write(conn)
+			}
+		}
+	})
+
+	action, err := newTestBrokerAction(&StreamInfo{Type: EventStreamTypeMQTT, MQTT: &mqttActionInfo{BrokerURL: brokerURL, Topic: "fabric/events", Username: "user1", Password: "pass1", RequestTimeoutSec: 1}})
+	assert.NoError(err)
+	events := []*eventsapi.EventEntry{{SubID: "sb-1", EventName: "Created"}}
+	err = action.attemptBatch(context.Background(), 1, 1, events)
+	assert.NoError(err)
+	connect := (<-received).(*packets.ConnectPacket)
+	assert.Equal("es-1", connect.ClientIdentifier)
+	assert.Equal("user1", connect.Username)
+	assert.Equal("pass1", string(connect.Password))
+	assert.True(connect.CleanSession)
+	publish := (<-received).(*packets.PublishPacket)
+	assert.Equal("fabric/events", publish.TopicName)
+	assert.Equal(byte(1), publish.Qos)
+	assert.Regexp(`"eventName":"Created"`, string(publish.Payload))
+
+	qos := 2
+	action.(*mqttAction).spec.QoS = &qos
+	err = action.attemptBatch(context.Background(), 2, 1, events)
+	assert.Regexp("es-1: Failed to publish to MQTT topic 'fabric/events': MQTT request timed out after 1s", err)
+	assert.False(action.connected())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = connectMQTT(ctx, paho.NewClientOptions().AddBroker(brokerURL).SetConnectTimeout(time.Second))
+	assert.Equal(context.Canceled, err)
+}
+
+func TestMQTTConnectRefused(t *testing.T) {
+	brokerURL, _ := newTestMQTTBroker(t, func(conn net.Conn, p packets.ControlPacket) {
+		ack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+		ack.ReturnCode = packets.ErrRefusedNotAuthorised
+		_ = ack.Write(conn)
+	})
+	action, err := newTestBrokerAction(&StreamInfo{Type: EventStreamTypeMQTT, MQTT: &mqttActionInfo{BrokerURL: brokerURL, Topic: "fabric/events", RequestTimeoutSec: 1}})
+	assert.NoError(t, err)
+	err = action.attemptBatch(context.Background(), 1, 1, []*eventsapi.EventEntry{{SubID: "sb-1"}})
+	assert.Regexp(t, "es-1: Failed to connect to MQTT broker: .*not Authorized", err)
+}
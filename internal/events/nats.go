@@ -0,0 +1,299 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultNATSRequestTimeoutSec = 30
+)
+
+type natsActionInfo struct {
+	// nats:// or tls://, optionally with the credentials or a token as the user info
+	URL string `json:"url,omitempty"`
+	// The subject each event is published to, which must be bound to a JetStream stream
+	Subject           string         `json:"subject,omitempty"`
+	Name              string         `json:"name,omitempty"`
+	Username          string         `json:"username,omitempty"`
+	Password          string         `json:"password,omitempty"`
+	Token             string         `json:"token,omitempty"`
+	RequestTimeoutSec uint32         `json:"requestTimeoutSec,omitempty"`
+	TLS               *actionTLSInfo `json:"tls,omitempty"`
+}
+
+// natsClient is the subset of the NATS client used to publish batches
+type natsClient interface {
+	PublishBatch(ctx context.Context, msgs []*nats.Msg) ([]*nats.PubAck, error)
+	IsConnected() bool
+	Close() error
+}
+
+// jetStreamClient publishes the messages of a batch to JetStream together, and the batch is
+// complete when JetStream has acknowledged every one of them
+type jetStreamClient struct {
+	conn    *nats.Conn
+	js      nats.JetStreamContext
+	timeout time.Duration
+}
+
+// defined to allow mocking in tests. Connecting is bounded by the timeout of the options
+var connectNATS = func(ctx context.Context, opts *nats.Options) (natsClient, error) {
+	conn, err := opts.Connect()
+	if err != nil {
+		return nil, err
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &jetStreamClient{conn: conn, js: js, timeout: opts.Timeout}, nil
+}
+
+// PublishBatch publishes the messages, and waits for JetStream to acknowledge all of them
+func (c *jetStreamClient) PublishBatch(ctx context.Context, msgs []*nats.Msg) ([]*nats.PubAck, error) {
+	futures := make([]nats.PubAckFuture, len(msgs))
+	for i, msg := range msgs {
+		f, err := c.js.PublishMsgAsync(msg)
+		if err != nil {
+			return nil, err
+		}
+		futures[i] = f
+	}
+	timeout := time.NewTimer(c.timeout)
+	defer timeout.Stop()
+	acks := make([]*nats.PubAck, len(futures))
+	for i, f := range futures {
+		select {
+		case acks[i] = <-f.Ok():
+		case err := <-f.Err():
+			return nil, err
+		case <-timeout.C:
+			return nil, errors.Errorf(errors.NATSRequestTimeout, c.timeout)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return acks, nil
+}
+
+func (c *jetStreamClient) IsConnected() bool {
+	return c.conn.IsConnected()
+}
+
+func (c *jetStreamClient) Close() error {
+	c.conn.Close()
+	return nil
+}
+
+type natsAction struct {
+	brokerConnection[natsClient]
+	spec *natsActionInfo
+}
+
+// validateNATSURL checks the scheme of the URL of the server. nats:// upgrades the connection to
+// TLS only if the server requires it, and tls:// requires TLS. The port is 4222 by default
+func validateNATSURL(serverURL string) error {
+	u, err := url.Parse(serverURL)
+	if err != nil || u.Host == "" {
+		return errors.Errorf(errors.NATSInvalidURL, serverURL)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "nats", "tls":
+		return nil
+	default:
+		return errors.Errorf(errors.NATSInvalidURL, serverURL)
+	}
+}
+
+func validateNATSConfig(spec *natsActionInfo) error {
+	if spec == nil || spec.URL == "" {
+		return errors.Errorf(errors.EventStreamsNATSNoURL)
+	}
+	if err := validateNATSURL(spec.URL); err != nil {
+		return err
+	}
+	if spec.Subject == "" {
+		return errors.Errorf(errors.EventStreamsNATSNoSubject)
+	}
+	for _, token := range strings.Split(spec.Subject, ".") {
+		if token == "" || token == "*" || token == ">" || strings.ContainsAny(token, " \t\r\n") {
+			return errors.Errorf(errors.EventStreamsNATSInvalidSubject, spec.Subject)
+		}
+	}
+	return spec.TLS.validate()
+}
+
+func setNATSDefaults(spec *natsActionInfo) {
+	if spec.RequestTimeoutSec == 0 {
+		spec.RequestTimeoutSec = DefaultNATSRequestTimeoutSec
+	}
+}
+
+// redactNATSConfig returns a copy of the settings with the credentials and token redacted
+func redactNATSConfig(spec *natsActionInfo) *natsActionInfo {
+	if spec == nil {
+		return nil
+	}
+	redacted := *spec
+	redacted.URL = redactURLCredentials(spec.URL)
+	redacted.Password = redactSecret(spec.Password)
+	redacted.Token = redactSecret(spec.Token)
+	return &redacted
+}
+
+// restoreNATSSecrets sets the redacted credentials and token of an update back to the existing ones
+func restoreNATSSecrets(spec, existing *natsActionInfo) {
+	if spec == nil {
+		return
+	}
+	if existing == nil {
+		existing = &natsActionInfo{}
+	}
+	restoreURLCredentials(&spec.URL, existing.URL)
+	restoreSecret(&spec.Password, existing.Password)
+	restoreSecret(&spec.Token, existing.Token)
+}
+
+// mergeNATSConfig returns the existing settings, overridden by those set in an update
+func mergeNATSConfig(existing, update *natsActionInfo) *natsActionInfo {
+	merged := *existing
+	if update.URL != "" {
+		merged.URL = update.URL
+	}
+	if update.Subject != "" {
+		merged.Subject = update.Subject
+	}
+	if update.Name != "" {
+		merged.Name = update.Name
+	}
+	if update.Username != "" {
+		merged.Username = update.Username
+	}
+	if update.Password != "" {
+		merged.Password = update.Password
+	}
+	if update.Token != "" {
+		merged.Token = update.Token
+	}
+	if update.RequestTimeoutSec != 0 {
+		merged.RequestTimeoutSec = update.RequestTimeoutSec
+	}
+	if update.TLS != nil {
+		merged.TLS = update.TLS
+	}
+	return &merged
+}
+
+func newNATSAction(es *eventStream, spec *natsActionInfo) (*natsAction, error) {
+	if err := validateNATSConfig(spec); err != nil {
+		return nil, err
+	}
+	setNATSDefaults(spec)
+	n := &natsAction{
+		brokerConnection: brokerConnection[natsClient]{
+			es:            es,
+			broker:        "NATS server",
+			connectFailed: errors.EventStreamsNATSConnectFailed,
+			lost:          func(c natsClient) bool { return !c.IsConnected() },
+		},
+		spec: spec,
+	}
+	n.dial = n.connect
+	return n, nil
+}
+
+// connect does not reconnect automatically, so the batch that is in flight when the connection
+// is lost is published again by the retry of the batch with a new connection
+func (n *natsAction) connect(ctx context.Context) (natsClient, error) {
+	tlsConfig, err := n.spec.TLS.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	name := n.spec.Name
+	if name == "" {
+		name = n.es.spec.ID
+	}
+	opts := nats.GetDefaultOptions()
+	opts.Url = n.spec.URL
+	opts.Name = name
+	opts.User = n.spec.Username
+	opts.Password = n.spec.Password
+	opts.Token = n.spec.Token
+	opts.Timeout = time.Duration(n.spec.RequestTimeoutSec) * time.Second
+	opts.TLSConfig = tlsConfig
+	opts.AllowReconnect = false
+	return connectNATS(ctx, &opts)
+}
+
+// messages returns a message for each event, with the same JSON as an event in the body of a
+// webhook. JetStream discards the messages of a retried batch it has already stored, by their IDs
+func (n *natsAction) messages(events []*api.EventEntry) ([]*nats.Msg, error) {
+	msgs := make([]*nats.Msg, 0, len(events))
+	for _, event := range events {
+		b, err := json.Marshal(event)
+		if err != nil {
+			return nil, err
+		}
+		msg := nats.NewMsg(n.spec.Subject)
+		for k, v := range event.Headers {
+			msg.Header.Set(k, v)
+		}
+		msg.Header.Set(nats.MsgIdHdr, eventMessageID(event))
+		msg.Data = b
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// attemptBatch publishes a message for each event in the batch to the subject. The batch
+// succeeds when JetStream has acknowledged every message, otherwise it is retried by the
+// stream with a new connection
+func (n *natsAction) attemptBatch(ctx context.Context, batchNumber, attempt uint64, events []*api.EventEntry) error {
+	esID := n.es.spec.ID
+	msgs, err := n.messages(events)
+	if err != nil {
+		return err
+	}
+	client, err := n.connection(ctx, attempt, redactURLCredentials(n.spec.URL))
+	if err != nil {
+		return err
+	}
+	log.Infof("%s: NATS --> %s batch=%d events=%d (attempt=%d)", esID, n.spec.Subject, batchNumber, len(events), attempt)
+	acks, err := client.PublishBatch(ctx, msgs)
+	if err != nil {
+		log.Errorf("%s: NATS publish to %s failed (attempt=%d): %s", esID, n.spec.Subject, attempt, err)
+		n.close()
+		return errors.Errorf(errors.EventStreamsNATSPublishFailed, esID, n.spec.Subject, err)
+	}
+	if len(acks) > 0 {
+		last := acks[len(acks)-1]
+		log.Infof("%s: NATS <-- %s batch=%d ok stream=%s seq=%d", esID, n.spec.Subject, batchNumber, last.Stream, last.Sequence)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	restutil "github.com/hyperledger/firefly-fabconnect/internal/rest/utils"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const consumerOffsetIDPrefix = "co-"
+
+// EventPosition is the position of an event in the ledger, down to the event within a transaction
+type EventPosition struct {
+	BlockNumber      uint64 `json:"blockNumber"`
+	TransactionIndex int    `json:"transactionIndex"`
+	EventIndex       int    `json:"eventIndex"`
+}
+
+// ConsumerOffset is the position of the last event a consumer group of a WebSocket topic has
+// committed, for each subscription delivering to the topic. The checkpoint of a stream only
+// restarts it from a block, so after a restart the events up to the offset are not redelivered
+type ConsumerOffset struct {
+	Topic          string                    `json:"topic"`
+	ConsumerGroup  string                    `json:"consumerGroup"`
+	Offsets        map[string]*EventPosition `json:"offsets"` // by subscription ID
+	UpdatedISO8601 string                    `json:"updated,omitempty"`
+}
+
+// ConsumerOffsetCommit sets the offset of a consumer group for one subscription
+type ConsumerOffsetCommit struct {
+	SubID string `json:"subId"`
+	EventPosition
+}
+
+func positionOf(event *eventsapi.EventEntry) *EventPosition {
+	return &EventPosition{
+		BlockNumber:      event.BlockNumber,
+		TransactionIndex: event.TransactionIndex,
+		EventIndex:       event.EventIndex,
+	}
+}
+
+// after reports whether the position is later in the ledger than the other
+func (p *EventPosition) after(other *EventPosition) bool {
+	if p.BlockNumber != other.BlockNumber {
+		return p.BlockNumber > other.BlockNumber
+	}
+	if p.TransactionIndex != other.TransactionIndex {
+		return p.TransactionIndex > other.TransactionIndex
+	}
+	return p.EventIndex > other.EventIndex
+}
+
+// committed reports whether the event is at or before the offset committed for its subscription
+func (o *ConsumerOffset) committed(event *eventsapi.EventEntry) bool {
+	offset, ok := o.Offsets[event.SubID]
+	return ok && !positionOf(event).after(offset)
+}
+
+func consumerOffsetKey(topic, consumerGroup string) string {
+	return fmt.Sprintf("%s%s/%s", consumerOffsetIDPrefix, topic, consumerGroup)
+}
+
+// ConsumerOffset returns the offsets committed by a consumer group of a WebSocket topic
+func (s *subscriptionMGR) ConsumerOffset(_ http.ResponseWriter, _ *http.Request, params httprouter.Params) (*ConsumerOffset, *restutil.RestError) {
+	offset, err := s.loadConsumerOffset(params.ByName("topic"), params.ByName("consumerGroup"))
+	if err != nil {
+		return nil, restutil.NewRestError(err.Error(), 500)
+	}
+	return offset, nil
+}
+
+// CommitConsumerOffset sets the offset of a consumer group for a subscription. Unlike the
+// commits made when the consumer acknowledges a batch, this can also move the offset back
+func (s *subscriptionMGR) CommitConsumerOffset(_ http.ResponseWriter, req *http.Request, params httprouter.Params) (*ConsumerOffset, *restutil.RestError) {
+	topic := params.ByName("topic")
+	var commit ConsumerOffsetCommit
+	if err := json.NewDecoder(req.Body).Decode(&commit); err != nil {
+		return nil, restutil.NewRestError(errors.Errorf(errors.EventStreamsConsumerOffsetInvalid, err).Error(), 400)
+	}
+	if commit.SubID == "" {
+		return nil, restutil.NewRestError(errors.Errorf(errors.EventStreamsConsumerOffsetInvalid, `missing required parameter "subId"`).Error(), 400)
+	}
+	sub, err := s.subscriptionByID(commit.SubID)
+	if err != nil {
+		return nil, restutil.NewRestError(err.Error(), 404)
+	}
+	stream, err := s.streamByID(sub.info.Stream)
+	if err != nil || stream.spec.WebSocket == nil || stream.spec.WebSocket.Topic != topic {
+		return nil, restutil.NewRestError(errors.Errorf(errors.EventStreamsConsumerOffsetWrongTopic, commit.SubID, topic).Error(), 400)
+	}
+	offset, err := s.updateConsumerOffset(topic, params.ByName("consumerGroup"), func(offset *ConsumerOffset) {
+		position := commit.EventPosition
+		offset.Offsets[commit.SubID] = &position
+	})
+	if err != nil {
+		return nil, restutil.NewRestError(err.Error(), 500)
+	}
+	return offset, nil
+}
+
+// DeleteConsumerOffset discards the offsets of a consumer group, so it is delivered every event
+// from the checkpoint of the stream again
+func (s *subscriptionMGR) DeleteConsumerOffset(_ http.ResponseWriter, _ *http.Request, params httprouter.Params) (*map[string]string, *restutil.RestError) {
+	key := consumerOffsetKey(params.ByName("topic"), params.ByName("consumerGroup"))
+	s.offsetsMux.Lock()
+	defer s.offsetsMux.Unlock()
+	if err := s.db.Delete(key); err != nil {
+		return nil, restutil.NewRestError(err.Error(), 500)
+	}
+	result := map[string]string{}
+	result["topic"] = params.ByName("topic")
+	result["consumerGroup"] = params.ByName("consumerGroup")
+	result["deleted"] = "true"
+	return &result, nil
+}
+
+func (s *subscriptionMGR) loadConsumerOffset(topic, consumerGroup string) (*ConsumerOffset, error) {
+	key := consumerOffsetKey(topic, consumerGroup)
+	offset := &ConsumerOffset{
+		Topic:         topic,
+		ConsumerGroup: consumerGroup,
+		Offsets:       make(map[string]*EventPosition),
+	}
+	b, err := s.db.Get(key)
+	if err == leveldb.ErrNotFound {
+		return offset, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, offset); err != nil {
+		return nil, err
+	}
+	if offset.Offsets == nil {
+		offset.Offsets = make(map[string]*EventPosition)
+	}
+	return offset, nil
+}
+
+// updateConsumerOffset applies a change to the stored offsets of a consumer group
+func (s *subscriptionMGR) updateConsumerOffset(topic, consumerGroup string, change func(offset *ConsumerOffset)) (*ConsumerOffset, error) {
+	s.offsetsMux.Lock()
+	defer s.offsetsMux.Unlock()
+	offset, err := s.loadConsumerOffset(topic, consumerGroup)
+	if err != nil {
+		return nil, err
+	}
+	change(offset)
+	offset.UpdatedISO8601 = time.Now().UTC().Format(time.RFC3339)
+	b, _ := json.Marshal(offset)
+	key := consumerOffsetKey(topic, consumerGroup)
+	log.Debugf("Storing consumer offset %s: %s", key, string(b))
+	if err := s.db.Put(key, b); err != nil {
+		return nil, err
+	}
+	return offset, nil
+}
+
+// advanceConsumerOffset commits the last event of each subscription in a batch the consumer
+// group has acknowledged, unless the offset is already later
+func (s *subscriptionMGR) advanceConsumerOffset(topic, consumerGroup string, events []*eventsapi.EventEntry) error {
+	_, err := s.updateConsumerOffset(topic, consumerGroup, func(offset *ConsumerOffset) {
+		for _, event := range events {
+			position := positionOf(event)
+			if current, ok := offset.Offsets[event.SubID]; !ok || position.after(current) {
+				offset.Offsets[event.SubID] = position
+			}
+		}
+	})
+	return err
+}
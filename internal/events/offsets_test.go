@@ -0,0 +1,216 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	mockkvstore "github.com/hyperledger/firefly-fabconnect/mocks/kvstore"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTestOffsetsManager(t *testing.T, dir string) (*subscriptionMGR, *StreamInfo, *eventsapi.SubscriptionInfo) {
+	sm := newTestSubscriptionManager()
+	sm.config.LevelDB.Path = path.Join(dir, "db")
+	err := sm.Init()
+	assert.NoError(t, err)
+	stream := &StreamInfo{Type: "websocket", WebSocket: &webSocketActionInfo{Topic: "topic1", ConsumerGroup: "group1"}}
+	err = sm.addStream(stream)
+	assert.NoError(t, err)
+	sub := &eventsapi.SubscriptionInfo{Name: "sub1", Stream: stream.ID, ChannelID: "channel1"}
+	_, err = sm.addSubscription(sub)
+	assert.NoError(t, err)
+	return sm, stream, sub
+}
+
+func offsetParams(topic, consumerGroup string) httprouter.Params {
+	return httprouter.Params{{Key: "topic", Value: topic}, {Key: "consumerGroup", Value: consumerGroup}}
+}
+
+func TestEventPositionAfter(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &EventPosition{BlockNumber: 10, TransactionIndex: 2, EventIndex: 1}
+	assert.True(p.after(&EventPosition{BlockNumber: 9, TransactionIndex: 5, EventIndex: 5}))
+	assert.True(p.after(&EventPosition{BlockNumber: 10, TransactionIndex: 1, EventIndex: 5}))
+	assert.True(p.after(&EventPosition{BlockNumber: 10, TransactionIndex: 2, EventIndex: 0}))
+	assert.False(p.after(&EventPosition{BlockNumber: 10, TransactionIndex: 2, EventIndex: 1}))
+	assert.False(p.after(&EventPosition{BlockNumber: 11}))
+
+	offset := &ConsumerOffset{Offsets: map[string]*EventPosition{"sub1": p}}
+	assert.True(offset.committed(&eventsapi.EventEntry{SubID: "sub1", BlockNumber: 10, TransactionIndex: 2, EventIndex: 1}))
+	assert.False(offset.committed(&eventsapi.EventEntry{SubID: "sub1", BlockNumber: 10, TransactionIndex: 2, EventIndex: 2}))
+	assert.False(offset.committed(&eventsapi.EventEntry{SubID: "sub2", BlockNumber: 1}))
+}
+
+func TestConsumerOffsetCommitAPI(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	sm, _, sub := newTestOffsetsManager(t, dir)
+	defer sm.Close()
+
+	offset, restErr := sm.ConsumerOffset(nil, nil, offsetParams("topic1", "group1"))
+	assert.Nil(restErr)
+	assert.Empty(offset.Offsets)
+
+	commit := func(topic, body string) (*ConsumerOffset, int) {
+		req := httptest.NewRequest("PUT", "/consumeroffsets/"+topic+"/group1", strings.NewReader(body))
+		offset, restErr := sm.CommitConsumerOffset(nil, req, offsetParams(topic, "group1"))
+		if restErr != nil {
+			return nil, restErr.StatusCode
+		}
+		return offset, 200
+	}
+
+	offset, status := commit("topic1", fmt.Sprintf(`{"subId":"%s","blockNumber":10,"transactionIndex":1,"eventIndex":2}`, sub.ID))
+	assert.Equal(200, status)
+	assert.Equal(&EventPosition{BlockNumber: 10, TransactionIndex: 1, EventIndex: 2}, offset.Offsets[sub.ID])
+	assert.NotEmpty(offset.UpdatedISO8601)
+
+	// an explicit commit can move the offset back, to consume events again
+	offset, status = commit("topic1", fmt.Sprintf(`{"subId":"%s","blockNumber":5}`, sub.ID))
+	assert.Equal(200, status)
+	assert.Equal(uint64(5), offset.Offsets[sub.ID].BlockNumber)
+
+	_, status = commit("topic1", `{"blockNumber":5}`)
+	assert.Equal(400, status)
+	_, status = commit("topic1", `!json`)
+	assert.Equal(400, status)
+	_, status = commit("topic1", `{"subId":"sb-unknown"}`)
+	assert.Equal(404, status)
+	_, status = commit("topic2", fmt.Sprintf(`{"subId":"%s"}`, sub.ID))
+	assert.Equal(400, status)
+
+	offset, restErr = sm.ConsumerOffset(nil, nil, offsetParams("topic1", "group1"))
+	assert.Nil(restErr)
+	assert.Equal(uint64(5), offset.Offsets[sub.ID].BlockNumber)
+	offset, restErr = sm.ConsumerOffset(nil, nil, offsetParams("topic1", "group2"))
+	assert.Nil(restErr)
+	assert.Empty(offset.Offsets)
+
+	result, restErr := sm.DeleteConsumerOffset(nil, nil, offsetParams("topic1", "group1"))
+	assert.Nil(restErr)
+	assert.Equal("true", (*result)["deleted"])
+	offset, restErr = sm.ConsumerOffset(nil, nil, offsetParams("topic1", "group1"))
+	assert.Nil(restErr)
+	assert.Empty(offset.Offsets)
+}
+
+func TestConsumerOffsetDBErrors(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	mockKV := sm.db.(*mockkvstore.KVStore)
+	var emptyBytes []byte
+	mockKV.On("Get", mock.Anything).Return(emptyBytes, fmt.Errorf("pop"))
+	mockKV.On("Delete", mock.Anything).Return(fmt.Errorf("pop"))
+
+	_, restErr := sm.ConsumerOffset(nil, nil, offsetParams("topic1", "group1"))
+	assert.Equal(500, restErr.StatusCode)
+	_, restErr = sm.DeleteConsumerOffset(nil, nil, offsetParams("topic1", "group1"))
+	assert.Equal(500, restErr.StatusCode)
+	err := sm.advanceConsumerOffset("topic1", "group1", []*eventsapi.EventEntry{{SubID: "sub1"}})
+	assert.Regexp("pop", err)
+}
+
+func TestAdvanceConsumerOffset(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	sm, _, _ := newTestOffsetsManager(t, dir)
+	defer sm.Close()
+
+	err := sm.advanceConsumerOffset("topic1", "group1", []*eventsapi.EventEntry{
+		{SubID: "sub1", BlockNumber: 10, TransactionIndex: 0, EventIndex: 0},
+		{SubID: "sub1", BlockNumber: 10, TransactionIndex: 1, EventIndex: 0},
+		{SubID: "sub2", BlockNumber: 3},
+	})
+	assert.NoError(err)
+	// an older batch, delivered again, does not move the offset back
+	err = sm.advanceConsumerOffset("topic1", "group1", []*eventsapi.EventEntry{
+		{SubID: "sub1", BlockNumber: 9},
+		{SubID: "sub2", BlockNumber: 4},
+	})
+	assert.NoError(err)
+
+	offset, err := sm.loadConsumerOffset("topic1", "group1")
+	assert.NoError(err)
+	assert.Equal(&EventPosition{BlockNumber: 10, TransactionIndex: 1}, offset.Offsets["sub1"])
+	assert.Equal(&EventPosition{BlockNumber: 4}, offset.Offsets["sub2"])
+}
+
+func TestWebSocketConsumerGroupSkipsCommitted(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	sm, stream, _ := newTestOffsetsManager(t, dir)
+	defer sm.Close()
+
+	err := sm.advanceConsumerOffset("topic1", "group1", []*eventsapi.EventEntry{
+		{SubID: "sub1", BlockNumber: 10, TransactionIndex: 0, EventIndex: 1},
+	})
+	assert.NoError(err)
+
+	mws := newMockWebSocket()
+	es := &eventStream{sm: sm, spec: stream, wsChannels: mws}
+	wsa, _ := newWebSocketAction(es, stream.WebSocket)
+	batch := []*eventsapi.EventEntry{
+		{SubID: "sub1", BlockNumber: 10, TransactionIndex: 0, EventIndex: 0},
+		{SubID: "sub1", BlockNumber: 10, TransactionIndex: 0, EventIndex: 1},
+		{SubID: "sub1", BlockNumber: 10, TransactionIndex: 0, EventIndex: 2},
+		{SubID: "sub1", BlockNumber: 11, TransactionIndex: 0, EventIndex: 0},
+	}
+	done := make(chan error)
+	go func() {
+		done <- wsa.attemptBatch(context.Background(), 1, 1, batch)
+	}()
+	sent := (<-mws.sender).([]*eventsapi.EventEntry)
+	assert.Equal(batch[2:], sent)
+	mws.receiver <- nil
+	assert.NoError(<-done)
+
+	offset, err := sm.loadConsumerOffset("topic1", "group1")
+	assert.NoError(err)
+	assert.Equal(&EventPosition{BlockNumber: 11}, offset.Offsets["sub1"])
+
+	// the whole batch is now committed, so nothing is sent
+	err = wsa.attemptBatch(context.Background(), 2, 1, batch)
+	assert.NoError(err)
+}
+
+func TestWebSocketConsumerGroupLoadFailure(t *testing.T) {
+	mws := newMockWebSocket()
+	es := &eventStream{sm: &mockSubMgr{err: fmt.Errorf("pop")}, spec: &StreamInfo{}, wsChannels: mws}
+	wsa, _ := newWebSocketAction(es, &webSocketActionInfo{Topic: "topic1", ConsumerGroup: "group1"})
+	err := wsa.attemptBatch(context.Background(), 1, 1, []*eventsapi.EventEntry{{SubID: "sub1"}})
+	assert.Regexp(t, "Failed to load offsets of consumer group 'group1': pop", err)
+}
+
+func TestValidateWebsocketConsumerGroup(t *testing.T) {
+	err := validateWebsocketConfig(&webSocketActionInfo{Topic: "topic1", ConsumerGroup: "group1", DistributionMode: DistributionModeBroadcast})
+	assert.Regexp(t, "A consumer group cannot be set with the 'broadcast' distribution mode", err)
+	err = validateWebsocketConfig(&webSocketActionInfo{Topic: "topic1", ConsumerGroup: "group1"})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,118 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/hyperledger/firefly-fabconnect/internal/messages"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultOutboxTimeout = 2 * time.Minute
+
+// outboxWaiter is completed when the batch holding the event of an outbox transaction
+// is delivered, or skipped after failing to deliver
+type outboxWaiter struct {
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+func newOutboxWaiter() *outboxWaiter {
+	return &outboxWaiter{done: make(chan struct{})}
+}
+
+func (o *outboxWaiter) complete(err error) {
+	o.once.Do(func() {
+		o.err = err
+		close(o.done)
+	})
+}
+
+// notifyOutboxes completes the outboxes waiting for the events of a batch, which was
+// either delivered, or skipped after failing with err
+func notifyOutboxes(events []*eventData, err error) {
+	for _, event := range events {
+		if event.outbox != nil {
+			event.outbox.complete(err)
+		}
+	}
+}
+
+// CheckOutbox confirms the event stream of an outbox exists, before its transaction is submitted
+func (s *subscriptionMGR) CheckOutbox(outbox *messages.Outbox) error {
+	_, err := s.streamByID(outbox.Stream)
+	return err
+}
+
+// DeliverTransactionEvents holds the receipt of a committed transaction until its chaincode event
+// is delivered to the event stream of the outbox. A one-shot subscription replays the block of the
+// transaction, passing on only the event of the transaction, and is removed once it is delivered
+func (s *subscriptionMGR) DeliverTransactionEvents(ctx context.Context, outbox *messages.Outbox, channelID, chaincodeID, signer, txID string, blockNumber uint64) error {
+	spec := &eventsapi.SubscriptionInfo{
+		Name:          "outbox-" + txID,
+		Stream:        outbox.Stream,
+		ChannelID:     channelID,
+		Signer:        signer,
+		FromBlock:     strconv.FormatUint(blockNumber, 10),
+		TransactionID: txID,
+	}
+	spec.Filter.BlockType = eventsapi.BlockTypeTX
+	spec.Filter.ChaincodeID = chaincodeID
+	spec.Filter.EventFilter = outbox.EventFilter
+	s.changeMux.Lock()
+	_, err := s.addSubscription(spec)
+	var sub *subscription
+	if err == nil {
+		sub, err = s.subscriptionByID(spec.ID)
+	}
+	s.changeMux.Unlock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		s.changeMux.Lock()
+		defer s.changeMux.Unlock()
+		if err := s.deleteSubscription(sub); err != nil {
+			log.Errorf("Failed to delete subscription %s of the outbox of transaction %s: %s", spec.ID, txID, err)
+		}
+	}()
+
+	timeout := defaultOutboxTimeout
+	if outbox.TimeoutSec > 0 {
+		timeout = time.Duration(outbox.TimeoutSec) * time.Second
+	}
+	select {
+	case <-sub.ep.outbox.done:
+		if sub.ep.outbox.err != nil {
+			log.Errorf("%s: Outbox event of transaction %s skipped: %s", spec.ID, txID, sub.ep.outbox.err)
+			return errors.Errorf(errors.EventStreamsOutboxSkipped, txID, outbox.Stream)
+		}
+		log.Infof("%s: Outbox event of transaction %s delivered to stream %s", spec.ID, txID, outbox.Stream)
+		return nil
+	case <-time.After(timeout):
+		return errors.Errorf(errors.EventStreamsOutboxTimeout, txID, outbox.Stream, timeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/hyperledger/firefly-fabconnect/internal/fabric/test"
+	"github.com/hyperledger/firefly-fabconnect/internal/kvstore"
+	"github.com/hyperledger/firefly-fabconnect/internal/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestOutboxManager(t *testing.T, dir string) (*subscriptionMGR, *StreamInfo) {
+	sm := newTestSubscriptionManager()
+	sm.config.LevelDB.Path = path.Join(dir, "db")
+	err := sm.Init()
+	assert.NoError(t, err)
+	stream := &StreamInfo{
+		Type:    "webhook",
+		Webhook: &webhookActionInfo{URL: "http://test.invalid"},
+	}
+	err = sm.addStream(stream)
+	assert.NoError(t, err)
+	return sm, stream
+}
+
+// startOutbox delivers the events of a transaction in the background, returning the one-shot subscription
+func startOutbox(sm *subscriptionMGR, outbox *messages.Outbox, txID string) (*subscription, chan error) {
+	done := make(chan error, 1)
+	go func() {
+		done <- sm.DeliverTransactionEvents(context.Background(), outbox, "testChannel", "asset_transfer", "user1", txID, 10)
+	}()
+	for {
+		sm.changeMux.Lock()
+		for _, sub := range sm.subscriptions {
+			if sub.info.TransactionID == txID {
+				sm.changeMux.Unlock()
+				return sub, done
+			}
+		}
+		sm.changeMux.Unlock()
+		time.Sleep(1 * time.Millisecond)
+	}
+}
+
+func TestOutboxDelivered(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	sm, stream := newTestOutboxManager(t, dir)
+	defer sm.Close()
+
+	outbox := &messages.Outbox{Stream: stream.ID, EventFilter: "AssetCreated"}
+	assert.NoError(sm.CheckOutbox(outbox))
+	assert.EqualError(sm.CheckOutbox(&messages.Outbox{Stream: "es-unknown"}), "Stream with ID 'es-unknown' not found")
+
+	sub, done := startOutbox(sm, outbox, "tx1")
+	assert.Equal("10", sub.info.FromBlock)
+	assert.Equal("asset_transfer", sub.info.Filter.ChaincodeID)
+	assert.Equal("AssetCreated", sub.info.Filter.EventFilter)
+	assert.Equal("user1", sub.info.Signer)
+
+	notifyOutboxes([]*eventData{{outbox: sub.ep.outbox}}, nil)
+	assert.NoError(<-done)
+	assert.Empty(sm.getSubscriptions())
+}
+
+func TestOutboxSkipped(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	sm, stream := newTestOutboxManager(t, dir)
+	defer sm.Close()
+
+	sub, done := startOutbox(sm, &messages.Outbox{Stream: stream.ID}, "tx1")
+	notifyOutboxes([]*eventData{{outbox: sub.ep.outbox}}, fmt.Errorf("pop"))
+	assert.EqualError(<-done, "Chaincode event of transaction tx1 could not be delivered to event stream "+stream.ID+", and was skipped")
+	assert.Empty(sm.getSubscriptions())
+}
+
+func TestOutboxTimeout(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	sm, stream := newTestOutboxManager(t, dir)
+	defer sm.Close()
+
+	_, done := startOutbox(sm, &messages.Outbox{Stream: stream.ID, TimeoutSec: 1}, "tx1")
+	assert.Regexp("was not delivered to event stream .* within 1s", <-done)
+	assert.Empty(sm.getSubscriptions())
+}
+
+func TestOutboxUnknownStream(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	sm, _ := newTestOutboxManager(t, dir)
+	defer sm.Close()
+
+	err := sm.DeliverTransactionEvents(context.Background(), &messages.Outbox{Stream: "es-unknown"}, "testChannel", "asset_transfer", "user1", "tx1", 10)
+	assert.EqualError(err, "Stream with ID 'es-unknown' not found")
+}
+
+func TestOutboxSubscriptionsNotStored(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	sm, stream := newTestOutboxManager(t, dir)
+
+	// outboxes of transactions on the same chaincode do not conflict with each other
+	for _, txID := range []string{"tx1", "tx2"} {
+		sub := &api.SubscriptionInfo{Stream: stream.ID, ChannelID: "testChannel", TransactionID: txID}
+		sub.Filter.ChaincodeID = "asset_transfer"
+		_, err := sm.addSubscription(sub)
+		assert.NoError(err)
+		_, err = sm.db.Get(sub.ID)
+		assert.Equal(kvstore.ErrorNotFound, err)
+	}
+	assert.Equal(2, len(sm.getSubscriptions()))
+
+	sm.Close()
+	sm = newTestSubscriptionManager()
+	sm.config.LevelDB.Path = path.Join(dir, "db")
+	err := sm.Init()
+	assert.NoError(err)
+	defer sm.Close()
+	assert.Empty(sm.getSubscriptions())
+
+	// nor is there a lookup key left behind that blocks another outbox of the transaction
+	sub := &api.SubscriptionInfo{Stream: stream.ID, ChannelID: "testChannel", TransactionID: "tx1"}
+	sub.Filter.ChaincodeID = "asset_transfer"
+	_, err = sm.addSubscription(sub)
+	assert.NoError(err)
+}
+
+func TestOutboxOnlyDeliversItsTransaction(t *testing.T) {
+	assert := assert.New(t)
+	stream := newTestStream(&mockSubMgr{})
+	defer stream.stop()
+	var delivered []*eventData
+	stream.eventHandler = func(data *eventData) { delivered = append(delivered, data) }
+
+	info := &api.SubscriptionInfo{ID: "sb-1", Stream: stream.spec.ID, TransactionID: "tx1"}
+	sub, err := newSubscription(stream, test.MockRPCClient(""), info)
+	assert.NoError(err)
+
+	err = sub.ep.processEventEntry(info, &api.EventEntry{TransactionID: "tx0", BlockNumber: 10})
+	assert.NoError(err)
+	assert.Empty(delivered)
+	err = sub.ep.processEventEntry(info, &api.EventEntry{TransactionID: "tx1", BlockNumber: 10})
+	assert.NoError(err)
+	assert.Equal(1, len(delivered))
+	assert.Equal(sub.ep.outbox, delivered[0].outbox)
+}
@@ -0,0 +1,91 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/interpreter"
+	"github.com/hyperledger/firefly-fabconnect/internal/events/api"
+)
+
+// payloadFilterEnv is the CEL environment of payload filters. The fields of the payload are not
+// known until each event is delivered, so the expressions are only parsed, and not type-checked
+var payloadFilterEnv, _ = cel.NewEnv()
+
+// payloadFilter is a CEL expression over the JSON payloads of events, such as
+// `amount > 1000 && (owner == "Tom" || !approved)`. The fields of the payload are variables of the
+// expression, and the whole payload is the variable "payload", so `payload.amount > 1000` is the
+// same filter. Events only match when the expression evaluates to true, so an expression that
+// fails, such as one reading a field the payload does not have, does not match. Use
+// `has(payload.x)` to test whether a field is set
+type payloadFilter struct {
+	program cel.Program
+}
+
+// payloadActivation resolves the variables of a filter from the fields of the payload
+type payloadActivation struct {
+	payload map[string]interface{}
+}
+
+func (a *payloadActivation) ResolveName(name string) (interface{}, bool) {
+	if name == "payload" {
+		return a.payload, true
+	}
+	v, ok := a.payload[name]
+	return v, ok
+}
+
+func (a *payloadActivation) Parent() interpreter.Activation {
+	return nil
+}
+
+// newPayloadFilter parses the expression, returning nil for subscriptions without a filter
+func newPayloadFilter(expression string) (*payloadFilter, error) {
+	if strings.TrimSpace(expression) == "" {
+		return nil, nil
+	}
+	ast, issues := payloadFilterEnv.Parse(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	program, err := payloadFilterEnv.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+	return &payloadFilter{program: program}, nil
+}
+
+// matches evaluates the filter against the payload, which is parsed again from the bytes if there
+// are any. Payloads that are not JSON objects do not match
+func (f *payloadFilter) matches(entry *api.EventEntry, payloadBytes []byte) bool {
+	var payload interface{} = entry.Payload
+	if payloadBytes != nil {
+		if err := json.Unmarshal(payloadBytes, &payload); err != nil {
+			return false
+		}
+	}
+	fields, ok := payload.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	result, _, err := f.program.Eval(&payloadActivation{payload: fields})
+	return err == nil && result == types.True
+}
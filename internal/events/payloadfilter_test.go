@@ -0,0 +1,79 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"testing"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPayloadFilterMatches(t *testing.T) {
+	assert := assert.New(t)
+	payload := []byte(`{"amount":1500,"price":"12.5","owner":"Tom","approved":false,"meta":{"region":"eu"},"note":null,"tags":["a","b"]}`)
+	for expression, expected := range map[string]bool{
+		`amount > 1000`:         true,
+		`payload.amount > 1000`: true,
+		`amount <= 1000`:        false,
+		`amount == 1500`:        true,
+		`double(price) >= 12.5 && double(price) < 13`:  true,
+		`owner == "Tom" && meta.region == 'eu'`:        true,
+		`owner != "Tom" || meta.region == "us"`:        false,
+		`!approved && (amount == 1500 || owner > "Z")`: true,
+		`approved`:              false,
+		`approved == false`:     true,
+		`note == null`:          true,
+		`owner.startsWith("T")`: true,
+		`"b" in tags`:           true,
+		`has(payload.meta) && !has(payload.missing)`: true,
+		// expressions that fail to evaluate, or are not true, do not match
+		`owner > 10`:      false,
+		`missing == null`: false,
+		`missing != 1`:    false,
+		`!(missing == 1)`: false,
+		`amount`:          false,
+	} {
+		filter, err := newPayloadFilter(expression)
+		assert.NoError(err, expression)
+		assert.Equal(expected, filter.matches(&api.EventEntry{}, payload), expression)
+	}
+
+	filter, _ := newPayloadFilter(`amount > 1000`)
+	assert.True(filter.matches(&api.EventEntry{Payload: map[string]interface{}{"amount": float64(1001)}}, nil))
+	assert.False(filter.matches(&api.EventEntry{}, []byte(`not json`)))
+	assert.False(filter.matches(&api.EventEntry{}, []byte(`[1001]`)))
+}
+
+func TestPayloadFilterInvalid(t *testing.T) {
+	assert := assert.New(t)
+	filter, err := newPayloadFilter("  ")
+	assert.NoError(err)
+	assert.Nil(filter)
+
+	for _, expression := range []string{
+		`amount >`,
+		`amount > 1000 )`,
+		`(amount > 1000`,
+		`owner == "Tom`,
+		`amount # 1`,
+		`amount > && owner`,
+	} {
+		_, err := newPayloadFilter(expression)
+		assert.Regexp("Syntax error", err, expression)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	restutil "github.com/hyperledger/firefly-fabconnect/internal/rest/utils"
+	"github.com/hyperledger/firefly-fabconnect/internal/utils"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// PingEventName is the name of the sample events delivered to test the action of a stream
+	PingEventName = "fabconnect:ping"
+	// streamPingTimeout bounds how long a ping waits for the action, such as a websocket ack
+	streamPingTimeout = 30 * time.Second
+)
+
+// PingResult is the outcome of delivering a sample event through the action of a stream
+type PingResult struct {
+	Delivered bool                  `json:"delivered"`
+	LatencyMS int64                 `json:"latencyMS"`
+	Error     string                `json:"error,omitempty"`
+	Event     *eventsapi.EventEntry `json:"event"`
+}
+
+// PingStream delivers a sample event through the action of a stream, in a batch of its own, to
+// check the settings of the action before waiting for events from the chain. The event is not
+// retried, and is delivered whether or not the stream is suspended
+func (s *subscriptionMGR) PingStream(_ http.ResponseWriter, req *http.Request, params httprouter.Params) (*PingResult, *restutil.RestError) {
+	streamID := params.ByName("streamId")
+	stream, err := s.streamByID(streamID)
+	if err != nil {
+		return nil, restutil.NewRestError(err.Error(), 404)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), streamPingTimeout)
+	defer cancel()
+	return stream.ping(ctx), nil
+}
+
+func (a *eventStream) ping(ctx context.Context) *PingResult {
+	event := &eventsapi.EventEntry{
+		TransactionID: "ping-" + utils.UUIDv4(),
+		EventName:     PingEventName,
+		Payload: map[string]interface{}{
+			"streamId": a.spec.ID,
+		},
+		Timestamp: time.Now().UnixNano(),
+	}
+	result := &PingResult{Event: event}
+	start := time.Now()
+	err := a.action.attemptBatch(ctx, 0, 1, []*eventsapi.EventEntry{event})
+	result.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		log.Warnf("%s: Ping failed: %s", a.spec.ID, err)
+		result.Error = err.Error()
+	} else {
+		result.Delivered = true
+	}
+	return result
+}
@@ -0,0 +1,70 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPingStream(t *testing.T) {
+	assert := assert.New(t)
+	status := 200
+	var received []*eventsapi.EventEntry
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		_ = json.NewDecoder(req.Body).Decode(&received)
+		res.WriteHeader(status)
+	}))
+	defer svr.Close()
+
+	sm := newTestSubscriptionManager()
+	es := &eventStream{
+		sm:              sm,
+		allowPrivateIPs: true,
+		spec:            &StreamInfo{ID: "es-1", Type: EventStreamTypeWebhook},
+	}
+	action, err := newWebhookAction(es, &webhookActionInfo{URL: svr.URL})
+	assert.NoError(err)
+	es.action = action
+	sm.streams[es.spec.ID] = es
+	params := httprouter.Params{{Key: "streamId", Value: "es-1"}}
+
+	result, restErr := sm.PingStream(nil, httptest.NewRequest("POST", "/eventstreams/es-1/ping", nil), params)
+	assert.Nil(restErr)
+	assert.True(result.Delivered)
+	assert.Empty(result.Error)
+	assert.Equal(1, len(received))
+	assert.Equal(PingEventName, received[0].EventName)
+	assert.Equal(result.Event.TransactionID, received[0].TransactionID)
+	assert.Regexp("^ping-", received[0].TransactionID)
+
+	status = 500
+	result, restErr = sm.PingStream(nil, httptest.NewRequest("POST", "/eventstreams/es-1/ping", nil), params)
+	assert.Nil(restErr)
+	assert.False(result.Delivered)
+	assert.Regexp("status=500", result.Error)
+	assert.Equal(2, len(action.deliveries.list()))
+
+	_, restErr = sm.PingStream(nil, httptest.NewRequest("POST", "/eventstreams/es-2/ping", nil), httprouter.Params{{Key: "streamId", Value: "es-2"}})
+	assert.Equal(404, restErr.StatusCode)
+}
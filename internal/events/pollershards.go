@@ -0,0 +1,148 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	log "github.com/sirupsen/logrus"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// pollerWorkers is the number of shards the subscriptions of each stream are polled in
+func pollerWorkers(config *conf.EventstreamConf) int {
+	if config.PollerWorkers < 1 {
+		return 1
+	}
+	return config.PollerWorkers
+}
+
+// subscriptionShard assigns a subscription to one of the poller shards of its stream. The
+// assignment only depends on the ID, so a subscription stays in the same shard across restarts
+func subscriptionShard(subID string, shards int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(subID))
+	return int(h.Sum32() % uint32(shards))
+}
+
+// checkpointShardID is the ID the checkpoint of a shard is stored under. A stream polled by a
+// single worker stores one checkpoint under the stream ID, as it always has
+func checkpointShardID(streamID string, shard, shards int) string {
+	if shards <= 1 {
+		return streamID
+	}
+	return fmt.Sprintf("%s/%d", streamID, shard)
+}
+
+// shardSubscriptions returns the subscriptions of the stream that a poller shard is responsible for
+func (a *eventStream) shardSubscriptions(shard int) []*subscription {
+	subs := a.sm.subscriptionsForStream(a.spec.ID)
+	if a.pollerShards <= 1 {
+		return subs
+	}
+	shardSubs := make([]*subscription, 0, len(subs)/a.pollerShards+1)
+	for _, sub := range subs {
+		if subscriptionShard(sub.info.ID, a.pollerShards) == shard {
+			shardSubs = append(shardSubs, sub)
+		}
+	}
+	return shardSubs
+}
+
+// eventPoller polls the subscriptions of the stream, sharded across the configured number of
+// workers so that a stream with thousands of subscriptions is not limited by a single loop
+func (a *eventStream) eventPoller(ctx context.Context) {
+	defer a.markAllSubscriptionsStale(ctx)
+	if a.pollerShards <= 1 {
+		a.shardPoller(ctx, 0)
+		return
+	}
+	shards := make([]*streamRoutine, a.pollerShards)
+	for i := range shards {
+		shard := i
+		shards[i] = startStreamRoutine(ctx, func(ctx context.Context) {
+			a.shardPoller(ctx, shard)
+		})
+	}
+	for _, r := range shards {
+		r.wait()
+	}
+}
+
+// reshardCheckpoints moves the stored checkpoints of a stream into the shards of the configured
+// number of poller workers, when it has changed since they were stored. It must be called
+// before the poller of the stream is started
+func (s *subscriptionMGR) reshardCheckpoints(streamID string) error {
+	shards := pollerWorkers(s.config)
+	cpID := checkpointIDPrefix + streamID
+	stored := make(map[string]map[string]uint64)
+	it := s.db.NewIteratorWithRange(util.BytesPrefix([]byte(cpID)))
+	for it.Next() {
+		k := it.Key()
+		if k != cpID && !strings.HasPrefix(k, cpID+"/") {
+			continue
+		}
+		var checkpoint map[string]uint64
+		if err := json.Unmarshal(it.Value(), &checkpoint); err != nil {
+			it.Release()
+			return err
+		}
+		stored[strings.TrimPrefix(k, checkpointIDPrefix)] = checkpoint
+	}
+	it.Release()
+
+	resharded := make(map[string]map[string]uint64)
+	moved := false
+	for id, checkpoint := range stored {
+		for subID, blockHeight := range checkpoint {
+			shardID := checkpointShardID(streamID, subscriptionShard(subID, shards), shards)
+			if shardID != id {
+				moved = true
+			}
+			if resharded[shardID] == nil {
+				resharded[shardID] = make(map[string]uint64)
+			}
+			// a subscription is only in two checkpoints if a previous reshard was interrupted
+			if blockHeight > resharded[shardID][subID] {
+				resharded[shardID][subID] = blockHeight
+			}
+		}
+	}
+	if !moved {
+		return nil
+	}
+
+	log.Infof("%s: Resharding checkpoints of %d shards into %d", streamID, len(stored), len(resharded))
+	for shardID, checkpoint := range resharded {
+		if err := s.storeCheckpoint(shardID, checkpoint); err != nil {
+			return err
+		}
+	}
+	for id := range stored {
+		if _, ok := resharded[id]; !ok {
+			if err := s.db.Delete(checkpointIDPrefix + id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
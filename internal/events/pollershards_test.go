@@ -0,0 +1,189 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/hyperledger/firefly-fabconnect/internal/fabric/test"
+	"github.com/hyperledger/firefly-fabconnect/internal/kvstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func TestPollerWorkers(t *testing.T) {
+	assert.Equal(t, 1, pollerWorkers(&conf.EventstreamConf{}))
+	assert.Equal(t, 1, pollerWorkers(&conf.EventstreamConf{PollerWorkers: -1}))
+	assert.Equal(t, 8, pollerWorkers(&conf.EventstreamConf{PollerWorkers: 8}))
+}
+
+func TestSubscriptionShard(t *testing.T) {
+	assert := assert.New(t)
+
+	counts := make([]int, 4)
+	for i := 0; i < 400; i++ {
+		subID := fmt.Sprintf("sb-%d", i)
+		shard := subscriptionShard(subID, 4)
+		assert.Equal(shard, subscriptionShard(subID, 4))
+		assert.Equal(0, subscriptionShard(subID, 1))
+		counts[shard]++
+	}
+	for _, count := range counts {
+		assert.Greater(count, 50)
+	}
+
+	assert.Equal("es-1", checkpointShardID("es-1", 0, 1))
+	assert.Equal("es-1/3", checkpointShardID("es-1", 3, 4))
+}
+
+func TestReshardCheckpoints(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	sm := newTestSubscriptionManager()
+	sm.db = kvstore.NewLDBKeyValueStore(dir)
+	err := sm.db.Init()
+	assert.NoError(err)
+	defer sm.db.Close()
+
+	checkpoint := make(map[string]uint64)
+	for i := 0; i < 20; i++ {
+		checkpoint[fmt.Sprintf("sb-%d", i)] = uint64(i + 1)
+	}
+	err = sm.storeCheckpoint("es-1", checkpoint)
+	assert.NoError(err)
+	// the checkpoint of another stream, that shares the prefix, is left alone
+	err = sm.storeCheckpoint("es-10", map[string]uint64{"sb-x": 5})
+	assert.NoError(err)
+
+	sm.config.PollerWorkers = 3
+	err = sm.reshardCheckpoints("es-1")
+	assert.NoError(err)
+	_, err = sm.db.Get(checkpointIDPrefix + "es-1")
+	assert.Equal(leveldb.ErrNotFound, err)
+	total := 0
+	for shard := 0; shard < 3; shard++ {
+		shardCheckpoint, err := sm.loadCheckpoint(checkpointShardID("es-1", shard, 3))
+		assert.NoError(err)
+		for subID, blockHeight := range shardCheckpoint {
+			assert.Equal(shard, subscriptionShard(subID, 3))
+			assert.Equal(checkpoint[subID], blockHeight)
+			total++
+		}
+	}
+	assert.Equal(len(checkpoint), total)
+
+	// nothing to move when the number of workers has not changed
+	err = sm.reshardCheckpoints("es-1")
+	assert.NoError(err)
+
+	sm.config.PollerWorkers = 1
+	err = sm.reshardCheckpoints("es-1")
+	assert.NoError(err)
+	merged, err := sm.loadCheckpoint("es-1")
+	assert.NoError(err)
+	assert.Equal(checkpoint, merged)
+	for shard := 0; shard < 3; shard++ {
+		_, err = sm.db.Get(checkpointIDPrefix + checkpointShardID("es-1", shard, 3))
+		assert.Equal(leveldb.ErrNotFound, err)
+	}
+	other, err := sm.loadCheckpoint("es-10")
+	assert.NoError(err)
+	assert.Equal(map[string]uint64{"sb-x": 5}, other)
+}
+
+func TestReshardCheckpointsBadData(t *testing.T) {
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	sm := newTestSubscriptionManager()
+	sm.db = kvstore.NewLDBKeyValueStore(dir)
+	_ = sm.db.Init()
+	defer sm.db.Close()
+
+	_ = sm.db.Put(checkpointIDPrefix+"es-1", []byte("!json"))
+	err := sm.reshardCheckpoints("es-1")
+	assert.Error(t, err)
+}
+
+func TestShardedEventPoller(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	sm := newTestSubscriptionManager()
+	sm.config.PollerWorkers = 3
+	sm.db = kvstore.NewLDBKeyValueStore(dir)
+	_ = sm.db.Init()
+	defer sm.db.Close()
+
+	spec := &StreamInfo{Type: "websocket", WebSocket: &webSocketActionInfo{Topic: "topic1"}}
+	err := sm.addStream(spec)
+	assert.NoError(err)
+	stream := sm.streams[spec.ID]
+	defer stream.stop()
+	assert.Equal(3, stream.pollerShards)
+
+	// acknowledge every batch, so the shards can checkpoint
+	mws := sm.wsChannels.(*mockWebSocket)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-mws.sender:
+				mws.receiver <- nil
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var subIDs []string
+	sm.rpc = test.MockRPCClient("")
+	for i := 0; i < 6; i++ {
+		// subscriptions to different channels, as they must not conflict
+		sub := &eventsapi.SubscriptionInfo{Name: fmt.Sprintf("sub%d", i), Stream: spec.ID, ChannelID: fmt.Sprintf("channel%d", i)}
+		_, err = sm.addSubscription(sub)
+		assert.NoError(err)
+		subIDs = append(subIDs, sub.ID)
+	}
+
+	// each subscription is checkpointed by the shard it belongs to, from the chain height
+	for _, subID := range subIDs {
+		cpID := checkpointShardID(spec.ID, subscriptionShard(subID, 3), 3)
+		for {
+			cp, err := sm.loadCheckpoint(cpID)
+			if err == nil && cp[subID] >= uint64(10) {
+				break
+			}
+			time.Sleep(1 * time.Millisecond)
+		}
+		sub := sm.subscriptions[subID]
+		assert.Contains(stream.shardSubscriptions(subscriptionShard(subID, 3)), sub)
+	}
+
+	stream.suspend()
+	for !stream.poller.isDone() {
+		time.Sleep(1 * time.Millisecond)
+	}
+	for _, subID := range subIDs {
+		assert.True(sm.subscriptions[subID].filterStale)
+	}
+}
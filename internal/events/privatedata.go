@@ -0,0 +1,168 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/hyperledger/firefly-fabconnect/internal/fabric/client"
+	"github.com/hyperledger/firefly-fabconnect/internal/fabric/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// collectionsRefreshInterval is how long the collections of a chaincode are cached, before a
+	// write to a collection that is not in them triggers another query, to catch upgrades
+	collectionsRefreshInterval = 1 * time.Minute
+)
+
+// privateDataReader withholds the private data in the events of a subscription from the
+// organization of its signer, unless it is a member of the collection in the committed chaincode
+// definition. Transient data, the plaintext of private data that can remain in the blocks, is only
+// delivered to the organization that submitted the transaction. Nothing is delivered when the
+// organization or the collections cannot be looked up
+type privateDataReader struct {
+	client      client.RPCClient
+	channelID   string
+	signer      string
+	mux         sync.Mutex
+	mspID       string
+	collections map[string]*chaincodeCollections // by chaincode
+}
+
+type chaincodeCollections struct {
+	members map[string][]string
+	queried time.Time
+}
+
+func newPrivateDataReader(rpc client.RPCClient, i *eventsapi.SubscriptionInfo) *privateDataReader {
+	if !i.PrivateData && i.Type != eventsapi.SubscriptionTypeBlocks {
+		return nil
+	}
+	return &privateDataReader{
+		client:      rpc,
+		channelID:   i.ChannelID,
+		signer:      i.Signer,
+		collections: make(map[string]*chaincodeCollections),
+	}
+}
+
+// orgMSPID returns the MSP ID of the organization of the signer, or an empty string if it
+// cannot be resolved
+func (r *privateDataReader) orgMSPID() string {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if r.mspID != "" {
+		return r.mspID
+	}
+	querier, ok := r.client.(client.CollectionConfigQuerier)
+	if !ok {
+		return ""
+	}
+	mspID, err := querier.GetSignerMSPID(r.signer)
+	if err != nil {
+		log.Warnf("Withholding private data: failed to resolve the organization of signer %s: %s", r.signer, err)
+		return ""
+	}
+	r.mspID = mspID
+	return mspID
+}
+
+// readable returns whether the organization of the signer is a member of a collection. The lock is
+// not held while querying the peer, so a slow query does not hold up the lookups of other chaincodes
+func (r *privateDataReader) readable(ctx context.Context, mspID, chaincodeID, collection string) bool {
+	r.mux.Lock()
+	cached := r.collections[chaincodeID]
+	r.mux.Unlock()
+	if _, known := cached.lookup(collection); !known && (cached == nil || time.Since(cached.queried) > collectionsRefreshInterval) {
+		cached = r.queryCollections(ctx, chaincodeID)
+		r.mux.Lock()
+		r.collections[chaincodeID] = cached
+		r.mux.Unlock()
+	}
+	members, _ := cached.lookup(collection)
+	for _, member := range members {
+		if member == mspID {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *privateDataReader) queryCollections(ctx context.Context, chaincodeID string) *chaincodeCollections {
+	// failures are cached as well, so they are only retried after the refresh interval
+	cached := &chaincodeCollections{queried: time.Now()}
+	querier, ok := r.client.(client.CollectionConfigQuerier)
+	if !ok {
+		return cached
+	}
+	configs, err := querier.QueryCollectionsConfig(ctx, r.channelID, r.signer, chaincodeID)
+	if err != nil {
+		log.Warnf("Withholding private data: failed to query the collections of chaincode %s on channel %s: %s", chaincodeID, r.channelID, err)
+		return cached
+	}
+	cached.members = utils.CollectionMembers(configs)
+	return cached
+}
+
+func (c *chaincodeCollections) lookup(collection string) ([]string, bool) {
+	if c == nil {
+		return nil, false
+	}
+	members, ok := c.members[collection]
+	return members, ok
+}
+
+// filterWrites returns the writes to the collections the organization of the signer is a member of
+func (r *privateDataReader) filterWrites(ctx context.Context, writes []*eventsapi.CollectionWrites) []*eventsapi.CollectionWrites {
+	if r == nil || len(writes) == 0 {
+		return nil
+	}
+	mspID := r.orgMSPID()
+	if mspID == "" {
+		return nil
+	}
+	return utils.FilterCollectionWrites(writes, func(namespace, collection string) bool {
+		return r.readable(ctx, mspID, namespace, collection)
+	})
+}
+
+// filterBlock returns the payload of a block event, with the private data the organization of
+// the signer cannot read removed from copies of the decoded blocks, which are shared with the
+// other subscriptions on the channel
+func (r *privateDataReader) filterBlock(ctx context.Context, payload interface{}) interface{} {
+	decoded, ok := payload.(map[string]interface{})
+	if !ok {
+		return payload
+	}
+	rawBlock, _ := decoded["raw"].(*utils.RawBlock)
+	block, _ := decoded["block"].(*utils.Block)
+	mspID := ""
+	if r != nil {
+		mspID = r.orgMSPID()
+	}
+	filteredRaw, filteredBlock := utils.FilterPrivateData(rawBlock, block, mspID, func(namespace, collection string) bool {
+		return mspID != "" && r.readable(ctx, mspID, namespace, collection)
+	})
+	return map[string]interface{}{
+		"raw":   filteredRaw,
+		"block": filteredBlock,
+	}
+}
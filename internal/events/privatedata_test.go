@@ -0,0 +1,212 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto" //nolint
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/hyperledger/firefly-fabconnect/internal/fabric/utils"
+	mockfabric "github.com/hyperledger/firefly-fabconnect/mocks/fabric/client"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockCollectionQuerier struct {
+	*mockfabric.RPCClient
+	mspID       string
+	mspErr      error
+	collections map[string][]string // member MSP IDs, by collection
+	queryErr    error
+	queries     int
+	blocked     chan struct{} // holds up the queries of the chaincode "slow", until closed
+	started     chan struct{}
+}
+
+func (m *mockCollectionQuerier) QueryCollectionsConfig(ctx context.Context, channelID, signer, chaincodeName string) ([]*peer.CollectionConfig, error) {
+	if chaincodeName == "slow" && m.blocked != nil {
+		close(m.started)
+		<-m.blocked
+	}
+	m.queries++
+	if m.queryErr != nil {
+		return nil, m.queryErr
+	}
+	var configs []*peer.CollectionConfig
+	for name, members := range m.collections {
+		var principals []*msp.MSPPrincipal
+		for _, member := range members {
+			role, _ := proto.Marshal(&msp.MSPRole{MspIdentifier: member, Role: msp.MSPRole_MEMBER})
+			principals = append(principals, &msp.MSPPrincipal{PrincipalClassification: msp.MSPPrincipal_ROLE, Principal: role})
+		}
+		configs = append(configs, &peer.CollectionConfig{
+			Payload: &peer.CollectionConfig_StaticCollectionConfig{
+				StaticCollectionConfig: &peer.StaticCollectionConfig{
+					Name: name,
+					MemberOrgsPolicy: &peer.CollectionPolicyConfig{
+						Payload: &peer.CollectionPolicyConfig_SignaturePolicy{
+							SignaturePolicy: &common.SignaturePolicyEnvelope{Identities: principals},
+						},
+					},
+				},
+			},
+		})
+	}
+	return configs, nil
+}
+
+func (m *mockCollectionQuerier) GetSignerMSPID(signer string) (string, error) {
+	return m.mspID, m.mspErr
+}
+
+func newTestCollectionQuerier() *mockCollectionQuerier {
+	return &mockCollectionQuerier{
+		mspID: "Org1MSP",
+		collections: map[string][]string{
+			"assetCollection":          {"Org1MSP", "Org2MSP"},
+			"Org2MSPPrivateCollection": {"Org2MSP"},
+		},
+	}
+}
+
+func testPrivateData() []*eventsapi.CollectionWrites {
+	return []*eventsapi.CollectionWrites{
+		{Namespace: "asset_transfer", Collection: "assetCollection"},
+		{Namespace: "asset_transfer", Collection: "Org2MSPPrivateCollection"},
+	}
+}
+
+func TestPrivateDataReaderFiltersByMembership(t *testing.T) {
+	assert := assert.New(t)
+	querier := newTestCollectionQuerier()
+	r := newPrivateDataReader(querier, &eventsapi.SubscriptionInfo{ChannelID: "channel1", Signer: "user1", PrivateData: true})
+
+	writes := r.filterWrites(context.Background(), testPrivateData())
+	assert.Equal(1, len(writes))
+	assert.Equal("assetCollection", writes[0].Collection)
+	// the collections are cached
+	r.filterWrites(context.Background(), testPrivateData())
+	assert.Equal(1, querier.queries)
+
+	// a collection that is not in the cached definition is only looked up again after the interval
+	newCollection := []*eventsapi.CollectionWrites{{Namespace: "asset_transfer", Collection: "newCollection"}}
+	querier.collections["newCollection"] = []string{"Org1MSP"}
+	assert.Nil(r.filterWrites(context.Background(), newCollection))
+	assert.Equal(1, querier.queries)
+	r.collections["asset_transfer"].queried = time.Now().Add(-collectionsRefreshInterval)
+	assert.Equal(newCollection, r.filterWrites(context.Background(), newCollection))
+	assert.Equal(2, querier.queries)
+}
+
+func TestPrivateDataReaderDoesNotLockDuringQuery(t *testing.T) {
+	assert := assert.New(t)
+	querier := newTestCollectionQuerier()
+	r := newPrivateDataReader(querier, &eventsapi.SubscriptionInfo{ChannelID: "channel1", Signer: "user1", PrivateData: true})
+	assert.True(r.readable(context.Background(), "Org1MSP", "asset_transfer", "assetCollection"))
+
+	querier.blocked = make(chan struct{})
+	querier.started = make(chan struct{})
+	done := make(chan bool)
+	go func() {
+		done <- r.readable(context.Background(), "Org1MSP", "slow", "assetCollection")
+	}()
+	<-querier.started
+	// the cached chaincode is still readable while the query of the other is held up
+	readable := make(chan bool)
+	go func() {
+		readable <- r.readable(context.Background(), "Org1MSP", "asset_transfer", "assetCollection")
+	}()
+	select {
+	case ok := <-readable:
+		assert.True(ok)
+	case <-time.After(5 * time.Second):
+		assert.Fail("the lookup was held up by the query of another chaincode")
+	}
+	close(querier.blocked)
+	assert.True(<-done)
+}
+
+func TestPrivateDataReaderWithholdsOnFailure(t *testing.T) {
+	assert := assert.New(t)
+	i := &eventsapi.SubscriptionInfo{ChannelID: "channel1", Signer: "user1", PrivateData: true}
+
+	var r *privateDataReader
+	assert.Nil(r.filterWrites(context.Background(), testPrivateData()))
+	assert.Nil(newPrivateDataReader(newTestCollectionQuerier(), &eventsapi.SubscriptionInfo{}))
+
+	// clients that cannot look up the collections do not deliver private data
+	r = newPrivateDataReader(&mockfabric.RPCClient{}, i)
+	assert.Nil(r.filterWrites(context.Background(), testPrivateData()))
+
+	querier := newTestCollectionQuerier()
+	querier.mspErr = fmt.Errorf("pop")
+	r = newPrivateDataReader(querier, i)
+	assert.Nil(r.filterWrites(context.Background(), testPrivateData()))
+
+	querier = newTestCollectionQuerier()
+	querier.queryErr = fmt.Errorf("pop")
+	r = newPrivateDataReader(querier, i)
+	assert.Nil(r.filterWrites(context.Background(), testPrivateData()))
+	assert.Nil(r.filterWrites(context.Background(), testPrivateData()))
+	assert.Equal(1, querier.queries)
+}
+
+func TestPrivateDataReaderFilterBlock(t *testing.T) {
+	assert := assert.New(t)
+	transient := map[string][]byte{"asset_properties": []byte("secret")}
+	rawBlock := &utils.RawBlock{
+		Data: &utils.BlockData{Data: []*utils.BlockDataEnvelope{{
+			Payload: &utils.Payload{
+				Header: &utils.PayloadHeader{SignatureHeader: &utils.SignatureHeader{Creator: &msp.SerializedIdentity{Mspid: "Org2MSP"}}},
+				Data: &utils.PayloadData{Actions: []*utils.Action{{
+					Payload: &utils.ActionPayload{
+						ChaincodeProposalPayload: &utils.ChaincodeProposalPayload{TransientMap: &transient},
+						Action: &utils.ActionPayloadAction{ProposalResponsePayload: &utils.ProposalResponsePayload{
+							Extension: &utils.Extension{PrivateData: testPrivateData()},
+						}},
+					},
+				}}},
+			},
+		}}},
+	}
+	block := &utils.Block{Transactions: []*utils.Transaction{{
+		Creator: &utils.Creator{MspID: "Org2MSP"},
+		Actions: []*utils.TransactionAction{{TransientMap: &transient}},
+	}}}
+	payload := map[string]interface{}{"raw": rawBlock, "block": block}
+
+	r := newPrivateDataReader(newTestCollectionQuerier(), &eventsapi.SubscriptionInfo{ChannelID: "channel1", Signer: "user1", Type: eventsapi.SubscriptionTypeBlocks})
+	filtered := r.filterBlock(context.Background(), payload).(map[string]interface{})
+	action := filtered["raw"].(*utils.RawBlock).Data.Data[0].Payload.Data.Actions[0].Payload
+	assert.Nil(action.ChaincodeProposalPayload.TransientMap)
+	assert.Equal(1, len(action.Action.ProposalResponsePayload.Extension.PrivateData))
+	assert.Nil(filtered["block"].(*utils.Block).Transactions[0].Actions[0].TransientMap)
+	// the decoded block shared with the other subscriptions is unchanged
+	assert.NotNil(block.Transactions[0].Actions[0].TransientMap)
+
+	r = nil
+	filtered = r.filterBlock(context.Background(), payload).(map[string]interface{})
+	action = filtered["raw"].(*utils.RawBlock).Data.Data[0].Payload.Data.Actions[0].Payload
+	assert.Nil(action.Action.ProposalResponsePayload.Extension.PrivateData)
+	assert.Equal("not a block", r.filterBlock(context.Background(), "not a block"))
+}
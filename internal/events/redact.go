@@ -0,0 +1,139 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/utils"
+)
+
+// redactedValue replaces the secrets of the streams returned by the API, and of the streams in
+// the lifecycle events. A stream that is read, changed and sent back in an update keeps the
+// secrets that are still redacted
+const redactedValue = "********"
+
+func redactSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redactedValue
+}
+
+func restoreSecret(secret *string, existing string) {
+	if *secret == redactedValue {
+		*secret = existing
+	}
+}
+
+// redactURLCredentials redacts the password in the user info of a URL
+func redactURLCredentials(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	if _, hasPassword := u.User.Password(); !hasPassword {
+		return rawURL
+	}
+	u.User = url.UserPassword(u.User.Username(), redactedValue)
+	return u.String()
+}
+
+// restoreURLCredentials sets the user info of a URL with a redacted password back to the
+// user info of the existing URL
+func restoreURLCredentials(rawURL *string, existing string) {
+	u, err := url.Parse(*rawURL)
+	if err != nil || u.User == nil {
+		return
+	}
+	if password, _ := u.User.Password(); password != redactedValue {
+		return
+	}
+	u.User = nil
+	if e, err := url.Parse(existing); err == nil {
+		u.User = e.User
+	}
+	*rawURL = u.String()
+}
+
+// redacted returns a copy of the spec of a stream with its secrets redacted, to be returned by
+// the API and published in lifecycle events
+func (spec *StreamInfo) redacted() *StreamInfo {
+	redacted := *spec
+	redacted.Webhook = redactWebhookConfig(spec.Webhook)
+	redacted.Kafka = redactKafkaConfig(spec.Kafka)
+	redacted.MQTT = redactMQTTConfig(spec.MQTT)
+	redacted.AMQP = redactAMQPConfig(spec.AMQP)
+	redacted.NATS = redactNATSConfig(spec.NATS)
+	redacted.GRPC = redactGRPCConfig(spec.GRPC)
+	if spec.DeadLetter != nil {
+		deadLetter := *spec.DeadLetter
+		deadLetter.Webhook = redactWebhookConfig(deadLetter.Webhook)
+		deadLetter.Kafka = redactKafkaConfig(deadLetter.Kafka)
+		redacted.DeadLetter = &deadLetter
+	}
+	return &redacted
+}
+
+// restoreRedacted sets the secrets of an update that are still redacted back to those of the
+// existing spec of the stream
+func (spec *StreamInfo) restoreRedacted(existing *StreamInfo) {
+	restoreWebhookSecrets(spec.Webhook, existing.Webhook)
+	restoreKafkaSecrets(spec.Kafka, existing.Kafka)
+	restoreMQTTSecrets(spec.MQTT, existing.MQTT)
+	restoreAMQPSecrets(spec.AMQP, existing.AMQP)
+	restoreNATSSecrets(spec.NATS, existing.NATS)
+	restoreGRPCSecrets(spec.GRPC, existing.GRPC)
+	if spec.DeadLetter != nil {
+		existingDeadLetter := existing.DeadLetter
+		if existingDeadLetter == nil {
+			existingDeadLetter = &deadLetterInfo{}
+		}
+		restoreWebhookSecrets(spec.DeadLetter.Webhook, existingDeadLetter.Webhook)
+		restoreKafkaSecrets(spec.DeadLetter.Kafka, existingDeadLetter.Kafka)
+	}
+}
+
+// checkPatchReads rejects a JSON Patch that tests, copies or moves a value holding a secret. The
+// patch applies to the redacted spec, so the values it reads are those that differ between the
+// redacted spec and the spec with its secrets
+func checkPatchReads(ops []utils.JSONPatchOperation, redacted, spec []byte) error {
+	var redactedDoc, specDoc interface{}
+	_ = json.Unmarshal(redacted, &redactedDoc)
+	_ = json.Unmarshal(spec, &specDoc)
+	for i, op := range ops {
+		var read string
+		switch op.Op {
+		case "test":
+			read = op.Path
+		case "copy", "move":
+			read = op.From
+		default:
+			continue
+		}
+		// paths that do not exist are left to fail when the patch is applied
+		redactedValue, _ := utils.JSONPointerGet(redactedDoc, read)
+		value, _ := utils.JSONPointerGet(specDoc, read)
+		if !reflect.DeepEqual(redactedValue, value) {
+			return errors.Errorf(errors.EventStreamsPatchReadsSecret, i, op.Op, read)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	log "github.com/sirupsen/logrus"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// retryState records how far the retries of a batch blocked by ErrorHandlingBlock have got,
+// so a restart during a long outage resumes the backoff schedule instead of starting again. A
+// stream with a concurrency can have several batches blocked, so each is stored on its own
+type retryState struct {
+	// Identifies the batch, which is redelivered from the checkpoint after a restart
+	FirstEvent string    `json:"firstEvent"`
+	Attempt    int       `json:"attempt"`
+	NextRetry  time.Time `json:"nextRetry"`
+}
+
+func retryStateEventKey(event *eventsapi.EventEntry) string {
+	return fmt.Sprintf("%s/%d/%d/%d", event.SubID, event.BlockNumber, event.TransactionIndex, event.EventIndex)
+}
+
+// retryStateID is the key of the retry state of a batch, by the key of its first event
+func retryStateID(streamID, firstEvent string) string {
+	return retryStateIDPrefix + streamID + "/" + firstEvent
+}
+
+// setResumeRetry sets the retry states recovered on restart, by the key of the first event of
+// each blocked batch
+func (a *eventStream) setResumeRetry(states map[string]*retryState) {
+	a.batchCond.L.Lock()
+	a.resumeRetry = states
+	a.batchCond.L.Unlock()
+}
+
+// takeResumeRetry returns the recovered retry state of the batch starting with the event once,
+// as a batch after the one that was blocked can start with the same event
+func (a *eventStream) takeResumeRetry(firstEvent string) *retryState {
+	a.batchCond.L.Lock()
+	defer a.batchCond.L.Unlock()
+	state := a.resumeRetry[firstEvent]
+	delete(a.resumeRetry, firstEvent)
+	return state
+}
+
+func (s *subscriptionMGR) loadRetryStates(streamID string) map[string]*retryState {
+	states := make(map[string]*retryState)
+	it := s.db.NewIteratorWithRange(util.BytesPrefix([]byte(retryStateID(streamID, ""))))
+	defer it.Release()
+	for it.Next() {
+		var state retryState
+		if err := json.Unmarshal(it.Value(), &state); err != nil {
+			log.Errorf("Failed to load retry state %s: %s", it.Key(), err)
+			continue
+		}
+		log.Debugf("Loaded retry state %s: %s", it.Key(), string(it.Value()))
+		states[state.FirstEvent] = &state
+	}
+	return states
+}
+
+func (s *subscriptionMGR) storeRetryState(streamID string, state *retryState) error {
+	rsID := retryStateID(streamID, state.FirstEvent)
+	b, _ := json.Marshal(state)
+	log.Debugf("Storing retry state %s: %s", rsID, string(b))
+	return s.db.Put(rsID, b)
+}
+
+func (s *subscriptionMGR) deleteRetryState(streamID, firstEvent string) {
+	if err := s.db.Delete(retryStateID(streamID, firstEvent)); err != nil {
+		log.Errorf("Failed to delete retry state from database. %s", err)
+	}
+}
+
+// deleteRetryStates deletes the retry states of every blocked batch of a stream
+func (s *subscriptionMGR) deleteRetryStates(streamID string) {
+	for firstEvent := range s.loadRetryStates(streamID) {
+		s.deleteRetryState(streamID, firstEvent)
+	}
+}
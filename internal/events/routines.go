@@ -0,0 +1,72 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+)
+
+// streamRoutine is one of the goroutines of an event stream, running under a child of the
+// stream context. Cancelling it interrupts any wait or call to the node the goroutine is
+// blocked in, and done is closed once it has returned, whether cancelled or not
+type streamRoutine struct {
+	cancelCtx context.CancelFunc
+	done      chan struct{}
+}
+
+// startStreamRoutine runs the function in a new goroutine, with a context that is cancelled
+// when the parent is, or when the routine is cancelled
+func startStreamRoutine(parent context.Context, run func(ctx context.Context)) *streamRoutine {
+	ctx, cancel := context.WithCancel(parent)
+	r := &streamRoutine{
+		cancelCtx: cancel,
+		done:      make(chan struct{}),
+	}
+	go func() {
+		defer close(r.done)
+		defer cancel()
+		run(ctx)
+	}()
+	return r
+}
+
+// cancel asks the goroutine to return, without waiting for it to do so
+func (r *streamRoutine) cancel() {
+	if r != nil {
+		r.cancelCtx()
+	}
+}
+
+// wait blocks until the goroutine has returned
+func (r *streamRoutine) wait() {
+	if r != nil {
+		<-r.done
+	}
+}
+
+// isDone reports whether the goroutine has returned
+func (r *streamRoutine) isDone() bool {
+	if r == nil {
+		return true
+	}
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamRoutineCancel(t *testing.T) {
+	assert := assert.New(t)
+
+	r := startStreamRoutine(context.Background(), func(ctx context.Context) {
+		<-ctx.Done()
+	})
+	assert.False(r.isDone())
+	r.cancel()
+	r.wait()
+	assert.True(r.isDone())
+}
+
+func TestStreamRoutineParentCancelled(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	r1 := startStreamRoutine(parent, func(ctx context.Context) { <-ctx.Done() })
+	r2 := startStreamRoutine(parent, func(ctx context.Context) { <-ctx.Done() })
+	cancel()
+	r1.wait()
+	r2.wait()
+}
+
+func TestStreamRoutineReturns(t *testing.T) {
+	assert := assert.New(t)
+
+	var routineCtx context.Context
+	r := startStreamRoutine(context.Background(), func(ctx context.Context) {
+		routineCtx = ctx
+	})
+	r.wait()
+	assert.True(r.isDone())
+	// the context is released once the routine returns on its own
+	assert.Equal(context.Canceled, routineCtx.Err())
+	r.cancel()
+}
+
+func TestStreamRoutineNil(t *testing.T) {
+	var r *streamRoutine
+	r.cancel()
+	r.wait()
+	assert.True(t, r.isDone())
+}
@@ -0,0 +1,109 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"sort"
+	"sync"
+)
+
+// priorityScheduler hands out a limited number of batch delivery slots across all
+// the streams of the gateway. When streams are competing for slots, the waiting
+// stream with the highest priority goes first, and streams of equal priority are
+// served in the order they asked. With zero slots configured, there is no limit
+type priorityScheduler struct {
+	mux     sync.Mutex
+	slots   int
+	inUse   int
+	seq     uint64
+	waiters []*schedulerWaiter
+}
+
+type schedulerWaiter struct {
+	priority int
+	seq      uint64
+	ready    chan struct{}
+}
+
+func newPriorityScheduler(slots int) *priorityScheduler {
+	return &priorityScheduler{
+		slots: slots,
+	}
+}
+
+// acquire blocks until a slot is available for the given priority. Returns false
+// without a slot if the interrupt channel is closed while waiting
+func (s *priorityScheduler) acquire(priority int, interrupt <-chan struct{}) bool {
+	s.mux.Lock()
+	if s.slots <= 0 {
+		s.mux.Unlock()
+		return true
+	}
+	if s.inUse < s.slots && len(s.waiters) == 0 {
+		s.inUse++
+		s.mux.Unlock()
+		return true
+	}
+	s.seq++
+	w := &schedulerWaiter{
+		priority: priority,
+		seq:      s.seq,
+		ready:    make(chan struct{}),
+	}
+	s.waiters = append(s.waiters, w)
+	sort.SliceStable(s.waiters, func(i, j int) bool {
+		if s.waiters[i].priority != s.waiters[j].priority {
+			return s.waiters[i].priority > s.waiters[j].priority
+		}
+		return s.waiters[i].seq < s.waiters[j].seq
+	})
+	s.mux.Unlock()
+
+	select {
+	case <-w.ready:
+		return true
+	case <-interrupt:
+		s.mux.Lock()
+		for i, waiter := range s.waiters {
+			if waiter == w {
+				s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+				s.mux.Unlock()
+				return false
+			}
+		}
+		s.mux.Unlock()
+		// we were handed the slot just as we were interrupted, so pass it on
+		s.release()
+		return false
+	}
+}
+
+// release returns a slot, handing it directly to the next waiter if there is one
+func (s *priorityScheduler) release() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.slots <= 0 {
+		return
+	}
+	if len(s.waiters) > 0 {
+		next := s.waiters[0]
+		s.waiters = s.waiters[1:]
+		close(next.ready)
+		return
+	}
+	s.inUse--
+}
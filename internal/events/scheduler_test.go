@@ -0,0 +1,87 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrioritySchedulerUnlimited(t *testing.T) {
+	assert := assert.New(t)
+	s := newPriorityScheduler(0)
+	for i := 0; i < 10; i++ {
+		assert.True(s.acquire(0, nil))
+	}
+	s.release()
+}
+
+func TestPrioritySchedulerOrdersWaiters(t *testing.T) {
+	assert := assert.New(t)
+	s := newPriorityScheduler(1)
+	assert.True(s.acquire(0, nil))
+
+	order := make(chan int, 3)
+	waitFor := func(priority, queued int) {
+		go func() {
+			s.acquire(priority, nil)
+			order <- priority
+			s.release()
+		}()
+		// make sure the waiter has queued up before adding the next
+		for {
+			s.mux.Lock()
+			n := len(s.waiters)
+			s.mux.Unlock()
+			if n == queued {
+				break
+			}
+			time.Sleep(1 * time.Millisecond)
+		}
+	}
+	waitFor(1, 1)
+	waitFor(10, 2)
+	waitFor(5, 3)
+
+	s.release()
+	assert.Equal(10, <-order)
+	assert.Equal(5, <-order)
+	assert.Equal(1, <-order)
+	// the last waiter returns its slot after reporting in
+	for inUse := 1; inUse != 0; {
+		time.Sleep(1 * time.Millisecond)
+		s.mux.Lock()
+		inUse = s.inUse
+		s.mux.Unlock()
+	}
+}
+
+func TestPrioritySchedulerInterrupted(t *testing.T) {
+	assert := assert.New(t)
+	s := newPriorityScheduler(1)
+	assert.True(s.acquire(0, nil))
+
+	interrupt := make(chan struct{})
+	close(interrupt)
+	assert.False(s.acquire(0, interrupt))
+	assert.Empty(s.waiters)
+
+	s.release()
+	assert.Equal(0, s.inUse)
+}
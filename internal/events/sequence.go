@@ -0,0 +1,137 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/events/api"
+)
+
+// SubscriptionSequenceGap is broadcast on the system topic when the sequence field in the payloads
+// of the events of a subscription skips values, meaning events were lost before they were emitted
+// to the chain, or were filtered out of the subscription
+const SubscriptionSequenceGap = "subscriptionSequenceGap"
+
+// SequenceGapEvent describes the values of the sequence that were skipped, before the event
+// that was received
+type SequenceGapEvent struct {
+	Subscription  string `json:"subscription"`
+	Stream        string `json:"stream"`
+	ChaincodeID   string `json:"chaincodeId"`
+	EventName     string `json:"eventName"`
+	BlockNumber   uint64 `json:"blockNumber"`
+	TransactionID string `json:"transactionId"`
+	Expected      uint64 `json:"expected"`
+	Received      uint64 `json:"received"`
+	Missing       uint64 `json:"missing"`
+}
+
+// sequenceTracker follows the sequence field in the payloads of the events of a subscription,
+// separately for each event name, as chaincodes keep a sequence per type of event. The last
+// value is not persisted, so the first event after a restart starts the sequence again
+type sequenceTracker struct {
+	mux  sync.Mutex
+	path []string
+	last map[string]uint64
+}
+
+// validateSequencePath checks a path is dot-separated field names, such as "sequence" or "header.seq"
+func validateSequencePath(path string) bool {
+	for _, field := range strings.Split(path, ".") {
+		if field == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// newSequenceTracker returns nil when the subscription does not have a sequence field
+func newSequenceTracker(path string) *sequenceTracker {
+	if path == "" {
+		return nil
+	}
+	return &sequenceTracker{
+		path: strings.Split(path, "."),
+		last: make(map[string]uint64),
+	}
+}
+
+// sequenceOf reads the sequence field from the payload, which is parsed again from the bytes if
+// there are any, so large sequence numbers keep their precision
+func (t *sequenceTracker) sequenceOf(entry *api.EventEntry, payloadBytes []byte) (uint64, bool) {
+	var value interface{} = entry.Payload
+	if payloadBytes != nil {
+		decoder := json.NewDecoder(bytes.NewReader(payloadBytes))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			return 0, false
+		}
+	}
+	for _, field := range t.path {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return 0, false
+		}
+		if value, ok = fields[field]; !ok {
+			return 0, false
+		}
+	}
+	switch v := value.(type) {
+	case json.Number:
+		seq, err := strconv.ParseUint(v.String(), 10, 64)
+		return seq, err == nil
+	case string:
+		seq, err := strconv.ParseUint(v, 10, 64)
+		return seq, err == nil
+	case float64:
+		return uint64(v), v >= 0 && v == float64(uint64(v))
+	default:
+		return 0, false
+	}
+}
+
+// check returns the gap before an event, if its sequence is not the one after the last event of
+// the same name. A sequence that goes backwards, as when a subscription is reset, is followed
+// from the event onwards
+func (t *sequenceTracker) check(entry *api.EventEntry, payloadBytes []byte) *SequenceGapEvent {
+	seq, ok := t.sequenceOf(entry, payloadBytes)
+	if !ok {
+		return nil
+	}
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	last, seen := t.last[entry.EventName]
+	t.last[entry.EventName] = seq
+	if !seen || seq <= last+1 {
+		return nil
+	}
+	return &SequenceGapEvent{
+		Subscription:  entry.SubID,
+		ChaincodeID:   entry.ChaincodeID,
+		EventName:     entry.EventName,
+		BlockNumber:   entry.BlockNumber,
+		TransactionID: entry.TransactionID,
+		Expected:      last + 1,
+		Received:      seq,
+		Missing:       seq - last - 1,
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSequenceOf(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(newSequenceTracker(""))
+	tracker := newSequenceTracker("header.seq")
+
+	seq := func(payload string) (uint64, bool) {
+		return tracker.sequenceOf(&api.EventEntry{}, []byte(payload))
+	}
+	v, ok := seq(`{"header":{"seq":18446744073709551615}}`)
+	assert.True(ok)
+	assert.Equal(uint64(18446744073709551615), v)
+	v, ok = seq(`{"header":{"seq":"42"}}`)
+	assert.True(ok)
+	assert.Equal(uint64(42), v)
+	for _, payload := range []string{`{"header":{"seq":-1}}`, `{"header":{"seq":1.5}}`, `{"header":{}}`, `{"header":"seq"}`, `{"header":{"seq":true}}`, `not json`} {
+		_, ok = seq(payload)
+		assert.False(ok, payload)
+	}
+
+	// a payload already parsed has no bytes left to parse
+	v, ok = tracker.sequenceOf(&api.EventEntry{Payload: map[string]interface{}{"header": map[string]interface{}{"seq": float64(7)}}}, nil)
+	assert.True(ok)
+	assert.Equal(uint64(7), v)
+}
+
+func TestSequenceGaps(t *testing.T) {
+	assert := assert.New(t)
+	tracker := newSequenceTracker("seq")
+
+	check := func(eventName, payload string) *SequenceGapEvent {
+		return tracker.check(&api.EventEntry{SubID: "sb-1", EventName: eventName, BlockNumber: 10}, []byte(payload))
+	}
+	assert.Nil(check("Created", `{"seq":5}`))
+	assert.Nil(check("Created", `{"seq":6}`))
+	assert.Nil(check("Updated", `{"seq":1}`))
+	assert.Nil(check("Created", `{"noseq":true}`))
+	gap := check("Created", `{"seq":9}`)
+	assert.Equal(&SequenceGapEvent{Subscription: "sb-1", EventName: "Created", BlockNumber: 10, Expected: 7, Received: 9, Missing: 2}, gap)
+	// redelivered events, and a sequence that restarts, are followed without a gap
+	assert.Nil(check("Created", `{"seq":9}`))
+	assert.Nil(check("Created", `{"seq":1}`))
+	assert.Nil(check("Created", `{"seq":2}`))
+	assert.Nil(check("Updated", `{"seq":2}`))
+}
+
+func TestSequenceGapEvents(t *testing.T) {
+	assert := assert.New(t)
+	sm := &mockSubMgr{}
+	stream := newTestStream(sm)
+	defer stream.stop()
+	stream.eventHandler = func(*eventData) {}
+
+	subInfo := &api.SubscriptionInfo{ID: "sb-1", Stream: stream.spec.ID, PayloadType: api.EventPayloadTypeJSON, SequencePath: "seq"}
+	p := newEvtProcessor("sb-1", stream)
+	p.sequence = newSequenceTracker(subInfo.SequencePath)
+	for _, payload := range []string{`{"seq":1}`, `{"seq":2}`, `{"seq":5}`} {
+		err := p.processEventEntry(subInfo, &api.EventEntry{ChaincodeID: "cc1", EventName: "Created", Payload: []byte(payload)})
+		assert.NoError(err)
+	}
+	assert.Equal(1, len(sm.systemEvents))
+	gap := sm.systemEvents[0].(*SequenceGapEvent)
+	assert.Equal(stream.spec.ID, gap.Stream)
+	assert.Equal("cc1", gap.ChaincodeID)
+	assert.Equal(uint64(2), gap.Missing)
+	assert.Equal(uint64(1), stream.counters.sequenceGaps)
+	assert.Equal(uint64(2), stream.counters.missingEvents)
+}
+
+func TestSequencePathValidation(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(validateSequencePath("seq"))
+	assert.True(validateSequencePath("header.seq"))
+	assert.False(validateSequencePath("header..seq"))
+	assert.False(validateSequencePath(".seq"))
+
+	sm := newTestSubscriptionManager()
+	_, restErr := sm.AddSubscription(nil, httptest.NewRequest("POST", "/subscriptions", strings.NewReader(`{"stream":"es-1","channel":"ch1","signer":"user1","sequencePath":"seq."}`)), nil)
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp(`Parameter "sequencePath" must be a dot-separated path`, restErr.Error)
+
+	group := &api.SubscriptionGroupInfo{ID: "sg-1", SequencePath: "seq"}
+	assert.Equal("seq", group.SubscriptionFor("ch1").SequencePath)
+}
@@ -17,40 +17,60 @@
 package events
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"path"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/hyperledger/firefly-fabconnect/internal/auth"
 	"github.com/hyperledger/firefly-fabconnect/internal/conf"
 	"github.com/hyperledger/firefly-fabconnect/internal/errors"
 	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
 	"github.com/hyperledger/firefly-fabconnect/internal/fabric/client"
 	"github.com/hyperledger/firefly-fabconnect/internal/kvstore"
 	restutil "github.com/hyperledger/firefly-fabconnect/internal/rest/utils"
+	"github.com/hyperledger/firefly-fabconnect/internal/usage"
 	"github.com/hyperledger/firefly-fabconnect/internal/utils"
 	"github.com/hyperledger/firefly-fabconnect/internal/ws"
 	"github.com/julienschmidt/httprouter"
 	log "github.com/sirupsen/logrus"
 	"github.com/syndtr/goleveldb/leveldb"
+	"golang.org/x/net/http/httpguts"
 )
 
 const (
 	// SubPathPrefix is the path prefix for subscriptions
 	SubPathPrefix = "/subscriptions"
 	// StreamPathPrefix is the path prefix for event streams
-	StreamPathPrefix   = "/eventstreams"
-	subIDPrefix        = "sb-"
-	streamIDPrefix     = "es-"
-	checkpointIDPrefix = "cp-"
+	StreamPathPrefix = "/eventstreams"
+	// SubGroupPathPrefix is the path prefix for subscription groups
+	SubGroupPathPrefix = "/subscriptiongroups"
+	// EventSchemaPathPrefix is the path prefix for event schemas
+	EventSchemaPathPrefix = "/eventschemas"
+	subIDPrefix           = "sb-"
+	subGroupIDPrefix      = "sg-"
+	streamIDPrefix        = "es-"
+	checkpointIDPrefix    = "cp-"
+	retryStateIDPrefix    = "rs-"
+	eventSchemaIDPrefix   = "sc-"
+	deadLetterIDPrefix    = "dl-"
 )
 
 type ResetRequest struct {
 	InitialBlock string `json:"initialBlock"`
+	// FromBlock is the name of the block to reset a listener to in the FireFly connector toolkit,
+	// used when initialBlock is not set
+	FromBlock string `json:"fromBlock,omitempty"`
 }
 
 // SubscriptionManager provides REST APIs for managing events
@@ -67,17 +87,48 @@ type SubscriptionManager interface {
 	Subscriptions(res http.ResponseWriter, req *http.Request, params httprouter.Params) []*eventsapi.SubscriptionInfo
 	SubscriptionByID(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*eventsapi.SubscriptionInfo, *restutil.RestError)
 	ResetSubscription(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*map[string]string, *restutil.RestError)
+	SubscriptionStats(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*eventsapi.SubscriptionStats, *restutil.RestError)
 	DeleteSubscription(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*map[string]string, *restutil.RestError)
+	DeleteSubscriptions(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*eventsapi.SubscriptionsDeleted, *restutil.RestError)
+	AddSubscriptionGroup(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*eventsapi.SubscriptionGroupInfo, *restutil.RestError)
+	SubscriptionGroups(res http.ResponseWriter, req *http.Request, params httprouter.Params) []*eventsapi.SubscriptionGroupInfo
+	SubscriptionGroupByID(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*eventsapi.SubscriptionGroupInfo, *restutil.RestError)
+	DeleteSubscriptionGroup(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*map[string]string, *restutil.RestError)
+	AddEventSchema(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*eventsapi.EventSchemaInfo, *restutil.RestError)
+	EventSchemas(res http.ResponseWriter, req *http.Request, params httprouter.Params) []*eventsapi.EventSchemaInfo
+	EventSchemaByID(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*eventsapi.EventSchemaInfo, *restutil.RestError)
+	DeleteEventSchema(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*map[string]string, *restutil.RestError)
+	ConsumerOffset(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*ConsumerOffset, *restutil.RestError)
+	CommitConsumerOffset(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*ConsumerOffset, *restutil.RestError)
+	DeleteConsumerOffset(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*map[string]string, *restutil.RestError)
+	DeadLetters(res http.ResponseWriter, req *http.Request, params httprouter.Params) ([]*DeadLetter, *restutil.RestError)
+	DeleteDeadLetter(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*map[string]string, *restutil.RestError)
+	Deliveries(res http.ResponseWriter, req *http.Request, params httprouter.Params) ([]*WebhookDelivery, *restutil.RestError)
+	PingStream(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*PingResult, *restutil.RestError)
+	RotateStreamSecret(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*SecretRotation, *restutil.RestError)
 	Close()
 }
 
 type subscriptionManager interface {
 	getConfig() *conf.EventstreamConf
+	getScheduler() *priorityScheduler
+	getBlockDecoder() *blockDecoder
+	getWebhookClients() *webhookClients
+	getUsage() *usage.Counters
+	getEventSchemas() *eventSchemas
 	streamByID(string) (*eventStream, error)
 	subscriptionByID(string) (*subscription, error)
 	subscriptionsForStream(string) []*subscription
 	loadCheckpoint(string) (map[string]uint64, error)
 	storeCheckpoint(string, map[string]uint64) error
+	storeRetryState(string, *retryState) error
+	deleteRetryState(string, string)
+	storeDeadLetter(*DeadLetter) error
+	loadConsumerOffset(topic, consumerGroup string) (*ConsumerOffset, error)
+	advanceConsumerOffset(topic, consumerGroup string, events []*eventsapi.EventEntry) error
+	publishLifecycleEvent(eventType, id string, before, after json.RawMessage, err error)
+	publishSystemEvent(eventType string, data interface{})
+	setStreamSuspended(stream *eventStream, suspended bool) error
 }
 
 type subscriptionMGR struct {
@@ -86,8 +137,18 @@ type subscriptionMGR struct {
 	rpc           client.RPCClient
 	subscriptions map[string]*subscription
 	streams       map[string]*eventStream
+	streamsMux    sync.RWMutex // held while changing streams, so the metrics pusher can read them
+	changeMux     sync.Mutex   // held from checking the If-Match of a change, until it is stored
+	offsetsMux    sync.Mutex   // held while reading and writing the offsets of a consumer group
+	groups        map[string]*eventsapi.SubscriptionGroupInfo
+	schemas       *eventSchemas
+	scheduler     *priorityScheduler
+	blockDecoder  *blockDecoder
+	webhooks      *webhookClients
+	usage         *usage.Counters
 	closed        bool
 	wsChannels    ws.WebSocketChannels
+	systemEvents  *ws.SystemEventPublisher
 }
 
 // NewSubscriptionManager constructor
@@ -97,6 +158,12 @@ func NewSubscriptionManager(config *conf.EventstreamConf, rpc client.RPCClient,
 		rpc:           rpc,
 		subscriptions: make(map[string]*subscription),
 		streams:       make(map[string]*eventStream),
+		groups:        make(map[string]*eventsapi.SubscriptionGroupInfo),
+		schemas:       newEventSchemas(&config.SchemaRegistry),
+		scheduler:     newPriorityScheduler(config.MaxConcurrentBatches),
+		blockDecoder:  newBlockDecoder(DefaultDecodedBlockCacheSize),
+		webhooks:      newWebhookClients(&config.Webhooks),
+		usage:         usage.NewCounters(),
 		wsChannels:    wsChannels,
 	}
 	if config.PollingIntervalSec <= 0 {
@@ -105,7 +172,24 @@ func NewSubscriptionManager(config *conf.EventstreamConf, rpc client.RPCClient,
 	return sm
 }
 
+// Init opens the store and recovers the streams, subscriptions and schemas in it. It can be
+// called again after Close, to restart the manager
 func (s *subscriptionMGR) Init(mocked ...kvstore.KVStore) error {
+	if err := s.webhooks.validate(); err != nil {
+		return err
+	}
+	if err := validateHeightRegressionPolicy(s.config.HeightRegression); err != nil {
+		return err
+	}
+	s.streamsMux.Lock()
+	if s.closed {
+		// the streams of a closed manager have been stopped, and are recovered again from the store
+		s.streams = make(map[string]*eventStream)
+		s.subscriptions = make(map[string]*subscription)
+		s.groups = make(map[string]*eventsapi.SubscriptionGroupInfo)
+		s.closed = false
+	}
+	s.streamsMux.Unlock()
 	if mocked != nil {
 		// only used in tests to pass in a mocked impl
 		s.db = mocked[0]
@@ -116,8 +200,12 @@ func (s *subscriptionMGR) Init(mocked ...kvstore.KVStore) error {
 			return errors.Errorf(errors.EventStreamsDBLoad, s.config.LevelDB.Path, err)
 		}
 	}
+	if s.wsChannels != nil {
+		s.systemEvents = ws.NewSystemEventPublisher(s.wsChannels)
+	}
 	s.recoverStreams()
 	s.recoverSubscriptions()
+	s.recoverEventSchemas()
 	return nil
 }
 
@@ -128,7 +216,10 @@ func (s *subscriptionMGR) StreamByID(_ http.ResponseWriter, _ *http.Request, par
 	if err != nil {
 		return nil, restutil.NewRestError(err.Error(), 404)
 	}
-	return stream.spec, nil
+	info := *stream.withCircuitStatus().redacted()
+	info.Errored = stream.pollerErroredReason()
+	info.Stats = stream.stats()
+	return &info, nil
 }
 
 // Streams used externally to get list streams
@@ -142,8 +233,13 @@ func (s *subscriptionMGR) AddStream(_ http.ResponseWriter, req *http.Request, _
 	if err := json.NewDecoder(req.Body).Decode(&spec); err != nil {
 		return nil, restutil.NewRestError(fmt.Sprintf(errors.RESTGatewayEventStreamInvalid, err), 400)
 	}
+	spec.Circuit = nil
+	spec.Stats = nil
+	spec.Errored = ""
+	spec.SuspendUntil = ""
 	st := strings.ToLower(spec.Type)
-	if st != EventStreamTypeWebhook && st != EventStreamTypeWebsocket {
+	bt, isBroker := brokerTypes[st]
+	if st != EventStreamTypeWebhook && st != EventStreamTypeWebsocket && !isBroker {
 		return nil, restutil.NewRestError(fmt.Sprintf(errors.EventStreamsInvalidActionType, spec.Type), 400)
 	}
 	if st == EventStreamTypeWebhook {
@@ -151,6 +247,15 @@ func (s *subscriptionMGR) AddStream(_ http.ResponseWriter, req *http.Request, _
 		if err := validateWebhookConfig(spec.Webhook); err != nil {
 			return nil, restutil.NewRestError(err.Error(), 400)
 		}
+		u, _ := url.Parse(spec.Webhook.URL)
+		if err := s.webhookPolicy().checkHost(u.Hostname()); err != nil {
+			return nil, restutil.NewRestError(err.Error(), 400)
+		}
+	} else if isBroker {
+		spec.Type = st
+		if err := bt.validate(&spec); err != nil {
+			return nil, restutil.NewRestError(err.Error(), 400)
+		}
 	} else {
 		spec.Type = EventStreamTypeWebsocket
 		if err := validateWebsocketConfig(spec.WebSocket); err != nil {
@@ -167,11 +272,42 @@ func (s *subscriptionMGR) AddStream(_ http.ResponseWriter, req *http.Request, _
 	if spec.Suspended != nil {
 		return nil, restutil.NewRestError("Can not set 'suspended'")
 	}
+	if spec.DeadLetter != nil {
+		if err := validateDeadLetterConfig(spec.DeadLetter); err != nil {
+			return nil, restutil.NewRestError(err.Error(), 400)
+		}
+	}
+	format, err := validateStreamFormat(spec.Format, spec.Type, s.config.SchemaRegistry.URL)
+	if err != nil {
+		return nil, restutil.NewRestError(err.Error(), 400)
+	}
+	spec.Format = format
+	if err := validateStreamConcurrency(spec.Concurrency, spec.Type); err != nil {
+		return nil, restutil.NewRestError(err.Error(), 400)
+	}
+	if err := validateRetryBackoff(spec.RetryBackoffFactor); err != nil {
+		return nil, restutil.NewRestError(err.Error(), 400)
+	}
+	if spec.RetryStrategy, err = utils.ValidateRetryStrategy(spec.RetryStrategy, spec.RetryJitter); err != nil {
+		return nil, restutil.NewRestError(err.Error(), 400)
+	}
+	if spec.DeliverySemantics, err = validateDeliverySemantics(spec.DeliverySemantics); err != nil {
+		return nil, restutil.NewRestError(err.Error(), 400)
+	}
+	if restErr := checkServiceIdentity(req.Context(), spec.ServiceIdentity, ""); restErr != nil {
+		return nil, restErr
+	}
+	if isValidateOnly(req) {
+		if err := s.validateStream(req.Context(), &spec); err != nil {
+			return nil, restutil.NewRestError(err.Error(), 400)
+		}
+		return spec.redacted(), nil
+	}
 
 	if err := s.addStream(&spec); err != nil {
 		return nil, restutil.NewRestError(err.Error(), 500)
 	}
-	return &spec, nil
+	return spec.redacted(), nil
 }
 
 // UpdateStream updates an existing stream
@@ -181,6 +317,14 @@ func (s *subscriptionMGR) UpdateStream(_ http.ResponseWriter, req *http.Request,
 	if err != nil {
 		return nil, restutil.NewRestError(err.Error(), 404)
 	}
+	s.changeMux.Lock()
+	defer s.changeMux.Unlock()
+	if restErr := s.checkIfMatch(req, stream.spec.ResourceVersion); restErr != nil {
+		return nil, restErr
+	}
+	if strings.HasPrefix(req.Header.Get("Content-Type"), utils.JSONPatchContentType) {
+		return s.patchStream(req, stream)
+	}
 	var spec StreamInfo
 	if err := json.NewDecoder(req.Body).Decode(&spec); err != nil {
 		return nil, restutil.NewRestError(fmt.Sprintf(errors.RESTGatewayEventStreamInvalid, err), 400)
@@ -193,6 +337,8 @@ func (s *subscriptionMGR) UpdateStream(_ http.ResponseWriter, req *http.Request,
 		}
 	} else if et == EventStreamTypeWebsocket {
 		spec.Type = EventStreamTypeWebsocket
+	} else if _, ok := brokerTypes[et]; ok {
+		spec.Type = et
 	}
 	if spec.ErrorHandling != "" {
 		eh := strings.ToLower(spec.ErrorHandling)
@@ -204,20 +350,84 @@ func (s *subscriptionMGR) UpdateStream(_ http.ResponseWriter, req *http.Request,
 	if spec.Suspended != nil {
 		return nil, restutil.NewRestError("Can not set 'suspended'")
 	}
+	if restErr := checkServiceIdentity(req.Context(), spec.ServiceIdentity, stream.spec.ServiceIdentity); restErr != nil {
+		return nil, restErr
+	}
 	updatedSpec, err := s.updateStream(stream, &spec)
 	if err != nil {
 		return nil, restutil.NewRestError(err.Error(), 500)
 	}
-	return updatedSpec, nil
+	return updatedSpec.redacted(), nil
+}
+
+// checkServiceIdentity checks the caller is authorized to have the stream run as the service
+// identity it assigns, and that the identity can be resolved. The identity the stream already
+// has is not checked again, so the other settings of the stream can be updated without it
+func checkServiceIdentity(ctx context.Context, identity, existing string) *restutil.RestError {
+	if identity == "" || identity == existing {
+		return nil
+	}
+	if err := auth.AssignServiceIdentity(ctx, identity); err != nil {
+		return restutil.NewRestError(err.Error(), 403)
+	}
+	if _, err := auth.NewServiceAuthContext(ctx, identity); err != nil {
+		return restutil.NewRestError(err.Error(), 400)
+	}
+	return nil
+}
+
+// patchStream applies an RFC 6902 JSON Patch to the stream. Unlike the merge of other updates,
+// fields can be explicitly unset or set to false
+func (s *subscriptionMGR) patchStream(req *http.Request, stream *eventStream) (*StreamInfo, *restutil.RestError) {
+	patch, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, restutil.NewRestError(err.Error(), 400)
+	}
+	// the patch applies to the spec as it is returned by the API, with its secrets redacted, and
+	// the secrets that are left redacted are then restored like those of any other update
+	before := specSnapshot(stream.spec.redacted())
+	ops, err := utils.ParseJSONPatch(patch)
+	if err != nil {
+		return nil, restutil.NewRestError(fmt.Sprintf(errors.RESTGatewayEventStreamInvalid, err), 400)
+	}
+	if err := checkPatchReads(ops, before, specSnapshot(stream.spec)); err != nil {
+		return nil, restutil.NewRestError(fmt.Sprintf(errors.RESTGatewayEventStreamInvalid, err), 400)
+	}
+	patched, err := utils.ApplyJSONPatch(before, patch)
+	if err != nil {
+		return nil, restutil.NewRestError(fmt.Sprintf(errors.RESTGatewayEventStreamInvalid, err), 400)
+	}
+	var spec StreamInfo
+	if err := json.Unmarshal(patched, &spec); err != nil {
+		return nil, restutil.NewRestError(fmt.Sprintf(errors.RESTGatewayEventStreamInvalid, err), 400)
+	}
+	spec.restoreRedacted(stream.spec)
+	if restErr := checkServiceIdentity(req.Context(), spec.ServiceIdentity, stream.spec.ServiceIdentity); restErr != nil {
+		return nil, restErr
+	}
+	updatedSpec, err := stream.replace(&spec)
+	if err != nil {
+		return nil, restutil.NewRestError(err.Error(), 400)
+	}
+	if err := s.storeStream(updatedSpec); err != nil {
+		return nil, restutil.NewRestError(err.Error(), 500)
+	}
+	s.publishLifecycleEvent(StreamUpdated, updatedSpec.ID, before, specSnapshot(updatedSpec.redacted()), nil)
+	return updatedSpec.redacted(), nil
 }
 
 // DeleteStream deletes a streamm
-func (s *subscriptionMGR) DeleteStream(_ http.ResponseWriter, _ *http.Request, params httprouter.Params) (*map[string]string, *restutil.RestError) {
+func (s *subscriptionMGR) DeleteStream(_ http.ResponseWriter, req *http.Request, params httprouter.Params) (*map[string]string, *restutil.RestError) {
 	streamID := params.ByName("streamId")
 	stream, err := s.streamByID(streamID)
 	if err != nil {
 		return nil, restutil.NewRestError(err.Error(), 404)
 	}
+	s.changeMux.Lock()
+	defer s.changeMux.Unlock()
+	if restErr := s.checkIfMatch(req, stream.spec.ResourceVersion); restErr != nil {
+		return nil, restErr
+	}
 	if err = s.deleteStream(stream); err != nil {
 		return nil, restutil.NewRestError(err.Error(), 500)
 	}
@@ -228,30 +438,72 @@ func (s *subscriptionMGR) DeleteStream(_ http.ResponseWriter, _ *http.Request, p
 	return &result, nil
 }
 
-// SuspendStream suspends a stream from firing
-func (s *subscriptionMGR) SuspendStream(_ http.ResponseWriter, _ *http.Request, params httprouter.Params) (*map[string]string, *restutil.RestError) {
+// suspendRequest is the optional body of the suspend API
+type suspendRequest struct {
+	SuspendUntil string `json:"suspendUntil,omitempty"`
+}
+
+// SuspendStream suspends a stream from firing, until it is resumed or until the time in the
+// suspendUntil of the body
+func (s *subscriptionMGR) SuspendStream(_ http.ResponseWriter, req *http.Request, params httprouter.Params) (*map[string]string, *restutil.RestError) {
 	streamID := params.ByName("streamId")
 	stream, err := s.streamByID(streamID)
 	if err != nil {
 		return nil, restutil.NewRestError(err.Error(), 404)
 	}
-	if err = s.suspendStream(stream); err != nil {
+	var body suspendRequest
+	if req.Body != nil {
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil && err != io.EOF {
+			return nil, restutil.NewRestError(fmt.Sprintf(errors.RESTGatewayEventStreamInvalid, err), 400)
+		}
+	}
+	var until time.Time
+	if body.SuspendUntil != "" {
+		if until, err = parseSuspendUntil(body.SuspendUntil); err != nil {
+			return nil, restutil.NewRestError(err.Error(), 400)
+		}
+	}
+	s.changeMux.Lock()
+	defer s.changeMux.Unlock()
+	if restErr := s.checkIfMatch(req, stream.spec.ResourceVersion); restErr != nil {
+		return nil, restErr
+	}
+	if err = s.suspendStream(stream, until); err != nil {
 		return nil, restutil.NewRestError(err.Error(), 500)
 	}
 
 	result := map[string]string{}
 	result["id"] = streamID
 	result["suspended"] = strconv.FormatBool(true)
+	if stream.spec.SuspendUntil != "" {
+		result["suspendUntil"] = stream.spec.SuspendUntil
+	}
 	return &result, nil
 }
 
+func parseSuspendUntil(value string) (time.Time, error) {
+	until, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return until, errors.Errorf(errors.EventStreamsSuspendUntilInvalid, value)
+	}
+	if !until.After(time.Now()) {
+		return until, errors.Errorf(errors.EventStreamsSuspendUntilPast, value)
+	}
+	return until, nil
+}
+
 // ResumeStream restarts a suspended stream
-func (s *subscriptionMGR) ResumeStream(_ http.ResponseWriter, _ *http.Request, params httprouter.Params) (*map[string]string, *restutil.RestError) {
+func (s *subscriptionMGR) ResumeStream(_ http.ResponseWriter, req *http.Request, params httprouter.Params) (*map[string]string, *restutil.RestError) {
 	streamID := params.ByName("streamId")
 	stream, err := s.streamByID(streamID)
 	if err != nil {
 		return nil, restutil.NewRestError(err.Error(), 404)
 	}
+	s.changeMux.Lock()
+	defer s.changeMux.Unlock()
+	if restErr := s.checkIfMatch(req, stream.spec.ResourceVersion); restErr != nil {
+		return nil, restErr
+	}
 	if err = s.resumeStream(stream); err != nil {
 		return nil, restutil.NewRestError(err.Error(), 500)
 	}
@@ -264,44 +516,48 @@ func (s *subscriptionMGR) ResumeStream(_ http.ResponseWriter, _ *http.Request, p
 
 // SubscriptionByID used externally to get serializable details
 func (s *subscriptionMGR) SubscriptionByID(_ http.ResponseWriter, _ *http.Request, params httprouter.Params) (*eventsapi.SubscriptionInfo, *restutil.RestError) {
-	id := params.ByName("subscriptionId")
-	sub, err := s.subscriptionByID(id)
-	if err != nil {
-		return nil, restutil.NewRestError(err.Error(), 404)
+	sub, restErr := s.subscriptionForRequest(params)
+	if restErr != nil {
+		return nil, restErr
 	}
-	return sub.info, nil
+	return sub.infoWithStatus(), nil
 }
 
-// Subscriptions used externally to get list subscriptions
-func (s *subscriptionMGR) Subscriptions(_ http.ResponseWriter, _ *http.Request, _ httprouter.Params) []*eventsapi.SubscriptionInfo {
-	return s.getSubscriptions()
+// Subscriptions used externally to get list subscriptions, or the listeners of the stream in the path
+func (s *subscriptionMGR) Subscriptions(_ http.ResponseWriter, _ *http.Request, params httprouter.Params) []*eventsapi.SubscriptionInfo {
+	streamID := params.ByName("streamId")
+	l := make([]*eventsapi.SubscriptionInfo, 0, len(s.subscriptions))
+	for _, sub := range s.subscriptions {
+		if streamID == "" || sub.info.Stream == streamID {
+			l = append(l, sub.infoWithStatus())
+		}
+	}
+	return l
 }
 
-// AddSubscription adds a new subscription
-func (s *subscriptionMGR) AddSubscription(_ http.ResponseWriter, req *http.Request, _ httprouter.Params) (*eventsapi.SubscriptionInfo, *restutil.RestError) {
+// AddSubscription adds a new subscription, or a listener to the stream in the path
+func (s *subscriptionMGR) AddSubscription(_ http.ResponseWriter, req *http.Request, params httprouter.Params) (*eventsapi.SubscriptionInfo, *restutil.RestError) {
 	var spec eventsapi.SubscriptionInfo
 	if err := json.NewDecoder(req.Body).Decode(&spec); err != nil {
 		return nil, restutil.NewRestError(fmt.Sprintf(errors.RESTGatewaySubscriptionInvalid, err), 400)
 	}
+	if streamID := params.ByName("streamId"); streamID != "" {
+		if spec.Stream != "" && spec.Stream != streamID {
+			return nil, restutil.NewRestError(errors.Errorf(errors.EventStreamsListenerStreamMismatch, spec.Stream, streamID).Error(), 400)
+		}
+		spec.Stream = streamID
+	}
 	if spec.ChannelID == "" {
 		return nil, restutil.NewRestError(`Missing required parameter "channel"`, 400)
 	}
-	if spec.Stream == "" {
-		return nil, restutil.NewRestError(`Missing required parameter "stream"`, 400)
-	}
-	if spec.Signer == "" {
-		return nil, restutil.NewRestError(`Missing required parameter "signer"`, 400)
-	}
-	pt := spec.PayloadType
-	if pt != "" && pt != eventsapi.EventPayloadTypeString && pt != eventsapi.EventPayloadTypeJSON {
-		return nil, restutil.NewRestError(`Parameter "payloadType" must be an empty string, "string" or "json"`, 400)
+	if restErr := validateSubscription(&spec); restErr != nil {
+		return nil, restErr
 	}
-	bt := spec.Filter.BlockType
-	if bt != "" && bt != eventsapi.BlockTypeTX && bt != eventsapi.BlockTypeConfig {
-		return nil, restutil.NewRestError(`Parameter "filter.blockType" must be an empty string, "tx" or "config"`, 400)
-	}
-	if err := validateFromBlock(spec.FromBlock); err != nil {
-		return nil, restutil.NewRestError(err.Error(), 400)
+	if isValidateOnly(req) {
+		if statusCode, err := s.validateNewSubscription(req.Context(), &spec); err != nil {
+			return nil, restutil.NewRestError(err.Error(), statusCode)
+		}
+		return &spec, nil
 	}
 
 	if statusCode, err := s.addSubscription(&spec); err != nil {
@@ -310,22 +566,39 @@ func (s *subscriptionMGR) AddSubscription(_ http.ResponseWriter, req *http.Reque
 	return &spec, nil
 }
 
+// SubscriptionStats returns the events delivered for a subscription over the last hour, by event name
+func (s *subscriptionMGR) SubscriptionStats(_ http.ResponseWriter, _ *http.Request, params httprouter.Params) (*eventsapi.SubscriptionStats, *restutil.RestError) {
+	sub, restErr := s.subscriptionForRequest(params)
+	if restErr != nil {
+		return nil, restErr
+	}
+	stats := sub.ep.stats.stats(time.Now())
+	stats.ID = sub.info.ID
+	return stats, nil
+}
+
 // ResetSubscription restarts the steam from the specified block
 func (s *subscriptionMGR) ResetSubscription(_ http.ResponseWriter, req *http.Request, params httprouter.Params) (*map[string]string, *restutil.RestError) {
-	id := params.ByName("subscriptionId")
-	sub, err := s.subscriptionByID(id)
-	if err != nil {
-		return nil, restutil.NewRestError(err.Error(), 404)
+	sub, restErr := s.subscriptionForRequest(params)
+	if restErr != nil {
+		return nil, restErr
+	}
+	s.changeMux.Lock()
+	defer s.changeMux.Unlock()
+	if restErr := s.checkIfMatch(req, sub.info.ResourceVersion); restErr != nil {
+		return nil, restErr
 	}
 	var request ResetRequest
 	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
 		return nil, restutil.NewRestError(fmt.Sprintf("Failed to parse request body. %s", err), 400)
 	}
+	if request.InitialBlock == "" {
+		request.InitialBlock = request.FromBlock
+	}
 	if err := validateFromBlock(request.InitialBlock); err != nil {
 		return nil, restutil.NewRestError(err.Error(), 400)
 	}
-	err = s.resetSubscription(sub, request.InitialBlock)
-	if err != nil {
+	if err := s.resetSubscription(sub, request.InitialBlock); err != nil {
 		return nil, restutil.NewRestError(err.Error(), 500)
 	}
 	result := map[string]string{}
@@ -335,30 +608,239 @@ func (s *subscriptionMGR) ResetSubscription(_ http.ResponseWriter, req *http.Req
 }
 
 // DeleteSubscription deletes a subscription
-func (s *subscriptionMGR) DeleteSubscription(_ http.ResponseWriter, _ *http.Request, params httprouter.Params) (*map[string]string, *restutil.RestError) {
-	id := params.ByName("subscriptionId")
-	sub, err := s.subscriptionByID(id)
+func (s *subscriptionMGR) DeleteSubscription(_ http.ResponseWriter, req *http.Request, params httprouter.Params) (*map[string]string, *restutil.RestError) {
+	sub, restErr := s.subscriptionForRequest(params)
+	if restErr != nil {
+		return nil, restErr
+	}
+	s.changeMux.Lock()
+	defer s.changeMux.Unlock()
+	if restErr := s.checkIfMatch(req, sub.info.ResourceVersion); restErr != nil {
+		return nil, restErr
+	}
+	if err := s.deleteSubscription(sub); err != nil {
+		return nil, restutil.NewRestError(err.Error(), 500)
+	}
+	result := map[string]string{}
+	result["id"] = sub.info.ID
+	result["deleted"] = strconv.FormatBool(true)
+	return &result, nil
+}
+
+// DeleteSubscriptions deletes the subscriptions matching the stream, channel and name-prefix query
+// parameters. They are deleted from the store in a single write, so either all of them are deleted
+// or none are
+func (s *subscriptionMGR) DeleteSubscriptions(_ http.ResponseWriter, req *http.Request, _ httprouter.Params) (*eventsapi.SubscriptionsDeleted, *restutil.RestError) {
+	query := req.URL.Query()
+	streamID, channelID, namePrefix := query.Get("stream"), query.Get("channel"), query.Get("name-prefix")
+	if streamID == "" && channelID == "" && namePrefix == "" {
+		return nil, restutil.NewRestError(errors.Errorf(errors.EventStreamsSubscriptionsDeleteNoFilter).Error(), 400)
+	}
+	s.changeMux.Lock()
+	defer s.changeMux.Unlock()
+	var matched []*subscription
+	var keys []string
+	for _, sub := range s.subscriptions {
+		if (streamID == "" || sub.info.Stream == streamID) && (channelID == "" || sub.info.ChannelID == channelID) && strings.HasPrefix(sub.info.Name, namePrefix) {
+			matched = append(matched, sub)
+			keys = append(keys, sub.info.ID, calculateLookupKey(sub.info))
+		}
+	}
+	result := &eventsapi.SubscriptionsDeleted{
+		Subscriptions: []string{},
+		Streams:       map[string]int{},
+	}
+	if len(matched) == 0 {
+		return result, nil
+	}
+	if err := s.db.DeleteBatch(keys); err != nil {
+		return nil, restutil.NewRestError(errors.Errorf(errors.EventStreamsSubscriptionsDeleteFailed, err).Error(), 500)
+	}
+	groups := make(map[string]*eventsapi.SubscriptionGroupInfo)
+	for _, sub := range matched {
+		delete(s.subscriptions, sub.info.ID)
+		sub.unsubscribe(true)
+		s.publishLifecycleEvent(SubscriptionDeleted, sub.info.ID, specSnapshot(sub.info), nil, nil)
+		if group, exists := s.groups[sub.info.Group]; exists {
+			for i, id := range group.Subscriptions {
+				if id == sub.info.ID {
+					group.Subscriptions = append(group.Subscriptions[:i], group.Subscriptions[i+1:]...)
+					break
+				}
+			}
+			groups[group.ID] = group
+		}
+		result.Subscriptions = append(result.Subscriptions, sub.info.ID)
+		result.Streams[sub.info.Stream]++
+	}
+	for _, group := range groups {
+		// the group only lists a deleted subscription until it is stored, which deleting the group tolerates
+		if err := s.storeSubscriptionGroup(group); err != nil {
+			log.Errorf("Failed to update subscription group %s after deleting its subscriptions: %s", group.ID, err)
+		}
+	}
+	sort.Strings(result.Subscriptions)
+	result.Deleted = len(result.Subscriptions)
+	log.Infof("Deleted %d subscriptions matching stream=%s channel=%s name-prefix=%s", result.Deleted, streamID, channelID, namePrefix)
+	return result, nil
+}
+
+// SubscriptionGroupByID used externally to get serializable details
+func (s *subscriptionMGR) SubscriptionGroupByID(_ http.ResponseWriter, _ *http.Request, params httprouter.Params) (*eventsapi.SubscriptionGroupInfo, *restutil.RestError) {
+	id := params.ByName("groupId")
+	group, err := s.subscriptionGroupByID(id)
 	if err != nil {
 		return nil, restutil.NewRestError(err.Error(), 404)
 	}
-	err = s.deleteSubscription(sub)
+	return group, nil
+}
+
+// SubscriptionGroups used externally to get list subscription groups
+func (s *subscriptionMGR) SubscriptionGroups(_ http.ResponseWriter, _ *http.Request, _ httprouter.Params) []*eventsapi.SubscriptionGroupInfo {
+	return s.getSubscriptionGroups()
+}
+
+// AddSubscriptionGroup expands a subscription template into one subscription per channel
+func (s *subscriptionMGR) AddSubscriptionGroup(_ http.ResponseWriter, req *http.Request, _ httprouter.Params) (*eventsapi.SubscriptionGroupInfo, *restutil.RestError) {
+	var spec eventsapi.SubscriptionGroupInfo
+	if err := json.NewDecoder(req.Body).Decode(&spec); err != nil {
+		return nil, restutil.NewRestError(fmt.Sprintf(errors.RESTGatewaySubscriptionInvalid, err), 400)
+	}
+	if len(spec.Channels) == 0 {
+		return nil, restutil.NewRestError(`Missing required parameter "channels"`, 400)
+	}
+	if restErr := validateSubscription(spec.SubscriptionFor("")); restErr != nil {
+		return nil, restErr
+	}
+
+	if statusCode, err := s.addSubscriptionGroup(&spec); err != nil {
+		return nil, restutil.NewRestError(err.Error(), statusCode)
+	}
+	return &spec, nil
+}
+
+// DeleteSubscriptionGroup deletes a subscription group, and all the subscriptions it manages
+func (s *subscriptionMGR) DeleteSubscriptionGroup(_ http.ResponseWriter, _ *http.Request, params httprouter.Params) (*map[string]string, *restutil.RestError) {
+	id := params.ByName("groupId")
+	group, err := s.subscriptionGroupByID(id)
 	if err != nil {
+		return nil, restutil.NewRestError(err.Error(), 404)
+	}
+	if err = s.deleteSubscriptionGroup(group); err != nil {
 		return nil, restutil.NewRestError(err.Error(), 500)
 	}
 	result := map[string]string{}
-	result["id"] = sub.info.ID
+	result["id"] = group.ID
 	result["deleted"] = strconv.FormatBool(true)
 	return &result, nil
 }
 
+// EventSchemaByID used externally to get serializable details
+func (s *subscriptionMGR) EventSchemaByID(_ http.ResponseWriter, _ *http.Request, params httprouter.Params) (*eventsapi.EventSchemaInfo, *restutil.RestError) {
+	info, err := s.schemas.getByID(params.ByName("schemaId"))
+	if err != nil {
+		return nil, restutil.NewRestError(err.Error(), 404)
+	}
+	return info, nil
+}
+
+// EventSchemas used externally to get list event schemas
+func (s *subscriptionMGR) EventSchemas(_ http.ResponseWriter, _ *http.Request, _ httprouter.Params) []*eventsapi.EventSchemaInfo {
+	return s.schemas.list()
+}
+
+// AddEventSchema registers a JSON Schema for the payloads of a chaincode event, pushing
+// it to the schema registry first when one is configured
+func (s *subscriptionMGR) AddEventSchema(_ http.ResponseWriter, req *http.Request, _ httprouter.Params) (*eventsapi.EventSchemaInfo, *restutil.RestError) {
+	var spec eventsapi.EventSchemaInfo
+	if err := json.NewDecoder(req.Body).Decode(&spec); err != nil {
+		return nil, restutil.NewRestError(errors.Errorf(errors.EventSchemaInvalid, err).Error(), 400)
+	}
+	if statusCode, err := s.addEventSchema(req.Context(), &spec); err != nil {
+		return nil, restutil.NewRestError(err.Error(), statusCode)
+	}
+	return &spec, nil
+}
+
+// DeleteEventSchema stops validating events against a schema. Schemas pushed to the
+// schema registry are left there, as consumers might still need them to read older events
+func (s *subscriptionMGR) DeleteEventSchema(_ http.ResponseWriter, _ *http.Request, params httprouter.Params) (*map[string]string, *restutil.RestError) {
+	info, err := s.schemas.getByID(params.ByName("schemaId"))
+	if err != nil {
+		return nil, restutil.NewRestError(err.Error(), 404)
+	}
+	if err = s.db.Delete(info.ID); err != nil {
+		return nil, restutil.NewRestError(err.Error(), 500)
+	}
+	s.schemas.remove(info.ID)
+	result := map[string]string{}
+	result["id"] = info.ID
+	result["deleted"] = strconv.FormatBool(true)
+	return &result, nil
+}
+
+// ETag returns the entity tag for a resource version of a stream or subscription
+func ETag(version uint64) string {
+	return fmt.Sprintf("\"%d\"", version)
+}
+
+// checkIfMatch rejects a change to a resource that has changed since the client read it.
+// Changes without an If-Match header are allowed, unless the configuration requires one
+func (s *subscriptionMGR) checkIfMatch(req *http.Request, version uint64) *restutil.RestError {
+	ifMatch := strings.TrimSpace(req.Header.Get("If-Match"))
+	if ifMatch == "" {
+		if s.config.RequireIfMatch {
+			return restutil.NewRestError(errors.EventStreamsIfMatchRequired, 428)
+		}
+		return nil
+	}
+	if ifMatch == "*" {
+		return nil
+	}
+	current := ETag(version)
+	for _, tag := range strings.Split(ifMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == current {
+			return nil
+		}
+	}
+	return restutil.NewRestError(fmt.Sprintf(errors.EventStreamsIfMatchConflict, current, ifMatch), 409)
+}
+
 func (s *subscriptionMGR) getConfig() *conf.EventstreamConf {
 	return s.config
 }
 
+func (s *subscriptionMGR) getScheduler() *priorityScheduler {
+	return s.scheduler
+}
+
+func (s *subscriptionMGR) getBlockDecoder() *blockDecoder {
+	return s.blockDecoder
+}
+
+func (s *subscriptionMGR) getWebhookClients() *webhookClients {
+	return s.webhooks
+}
+
+func (s *subscriptionMGR) getEventSchemas() *eventSchemas {
+	return s.schemas
+}
+
+func (s *subscriptionMGR) getUsage() *usage.Counters {
+	return s.usage
+}
+
+// Usage returns the events delivered for the subscriptions of each signer
+func (s *subscriptionMGR) Usage() []usage.Usage {
+	return s.usage.Usage()
+}
+
 func (s *subscriptionMGR) getStreams() []*StreamInfo {
 	l := make([]*StreamInfo, 0, len(s.subscriptions))
 	for _, stream := range s.streams {
-		l = append(l, stream.spec)
+		info := stream.withCircuitStatus().redacted()
+		info.Errored = stream.pollerErroredReason()
+		l = append(l, info)
 	}
 	return l
 }
@@ -373,17 +855,59 @@ func (s *subscriptionMGR) streamByID(id string) (*eventStream, error) {
 }
 
 func (s *subscriptionMGR) addStream(spec *StreamInfo) error {
-	spec.ID = streamIDPrefix + utils.UUIDv4()
+	spec.ID = streamIDPrefix + utils.NewID()
 	spec.Path = StreamPathPrefix + "/" + spec.ID
+	spec.ResourceVersion = 0
 	stream, err := newEventStream(s, spec, s.wsChannels)
 	if err != nil {
 		return err
 	}
+	s.streamsMux.Lock()
 	s.streams[stream.spec.ID] = stream
-	return s.storeStream(stream.spec)
+	s.streamsMux.Unlock()
+	if err := s.storeStream(stream.spec); err != nil {
+		return err
+	}
+	s.publishLifecycleEvent(StreamCreated, spec.ID, nil, specSnapshot(spec.redacted()), nil)
+	return nil
+}
+
+// webhookPolicy is the policy for the hosts and addresses webhooks are sent to
+func (s *subscriptionMGR) webhookPolicy() *webhookPolicy {
+	return &webhookPolicy{
+		allowPrivateIPs: s.config.WebhooksAllowPrivateIPs,
+		allowedHosts:    s.config.Webhooks.AllowedHosts,
+	}
+}
+
+// validateStream is a dry run of adding a stream, which sets the defaults of the stream.
+// The host of a webhook must resolve to permitted addresses, and be reachable
+func (s *subscriptionMGR) validateStream(ctx context.Context, spec *StreamInfo) error {
+	setStreamDefaults(spec)
+	if bt, ok := brokerTypes[spec.Type]; ok {
+		bt.setDefaults(spec)
+	}
+	if spec.Type != EventStreamTypeWebhook {
+		return nil
+	}
+	setWebhookDefaults(spec.Webhook)
+	u, _ := url.Parse(spec.Webhook.URL)
+	clients := s.getWebhookClients()
+	ips, err := clients.lookupIPv4(ctx, u.Hostname())
+	if err != nil {
+		return errors.Errorf(errors.EventStreamsWebhookUnreachable, u.Hostname(), err)
+	}
+	if err := s.webhookPolicy().check(u.Hostname(), ips); err != nil {
+		return err
+	}
+	if err := clients.probe(ctx, u, *spec.Webhook.TLSkipHostVerify, spec.Webhook.ProxyURL, spec.Webhook.clientCert()); err != nil {
+		return errors.Errorf(errors.EventStreamsWebhookUnreachable, u.Hostname(), err)
+	}
+	return nil
 }
 
 func (s *subscriptionMGR) updateStream(stream *eventStream, spec *StreamInfo) (*StreamInfo, error) {
+	before := specSnapshot(stream.spec.redacted())
 	updatedSpec, err := stream.update(spec)
 	if err != nil {
 		return nil, err
@@ -391,10 +915,20 @@ func (s *subscriptionMGR) updateStream(stream *eventStream, spec *StreamInfo) (*
 	if err := s.storeStream(updatedSpec); err != nil {
 		return nil, err
 	}
+	s.publishLifecycleEvent(StreamUpdated, updatedSpec.ID, before, specSnapshot(updatedSpec.redacted()), nil)
 	return updatedSpec, nil
 }
 
 func (s *subscriptionMGR) deleteStream(stream *eventStream) error {
+	// Groups targeting this stream go away along with their subs
+	for _, group := range s.groups {
+		if group.Stream == stream.spec.ID {
+			err := s.deleteSubscriptionGroup(group)
+			if err != nil {
+				log.Errorf("Failed to delete subscription group from database. %s", err)
+			}
+		}
+	}
 	// We have to clean up all the associated subs
 	for _, sub := range s.subscriptions {
 		if sub.info.Stream == stream.spec.ID {
@@ -404,30 +938,88 @@ func (s *subscriptionMGR) deleteStream(stream *eventStream) error {
 			}
 		}
 	}
+	s.streamsMux.Lock()
 	delete(s.streams, stream.spec.ID)
+	s.streamsMux.Unlock()
 	stream.stop()
 	if err := s.db.Delete(stream.spec.ID); err != nil {
 		return err
 	}
 	s.deleteCheckpoint(stream.spec.ID)
+	s.deleteRetryStates(stream.spec.ID)
+	s.deleteDeadLetters(stream.spec.ID)
+	s.publishLifecycleEvent(StreamDeleted, stream.spec.ID, specSnapshot(stream.spec.redacted()), nil, nil)
 	return nil
 }
 
-func (s *subscriptionMGR) suspendStream(stream *eventStream) error {
+// suspendStream suspends the stream until it is resumed, or until the time given when it is not zero
+func (s *subscriptionMGR) suspendStream(stream *eventStream, until time.Time) error {
+	before := specSnapshot(stream.spec.redacted())
+	stream.cancelScheduledResume()
+	stream.spec.SuspendUntil = ""
+	if !until.IsZero() {
+		stream.spec.SuspendUntil = until.UTC().Format(time.RFC3339)
+	}
 	stream.suspend()
 	// Persist the state change
-	return s.storeStream(stream.spec)
+	if err := s.storeStream(stream.spec); err != nil {
+		return err
+	}
+	if !until.IsZero() {
+		s.scheduleResume(stream, until)
+	}
+	s.publishLifecycleEvent(StreamSuspended, stream.spec.ID, before, specSnapshot(stream.spec.redacted()), nil)
+	return nil
+}
+
+// scheduleResume resumes the stream once the time it is suspended until is reached
+func (s *subscriptionMGR) scheduleResume(stream *eventStream, until time.Time) {
+	log.Infof("%s: Suspended until %s", stream.spec.ID, until.UTC().Format(time.RFC3339))
+	stream.scheduleResume(time.Until(until), func() { s.resumeSuspended(stream) })
+}
+
+func (s *subscriptionMGR) resumeSuspended(stream *eventStream) {
+	s.changeMux.Lock()
+	defer s.changeMux.Unlock()
+	if current, err := s.streamByID(stream.spec.ID); err != nil || current != stream || !*stream.spec.Suspended || stream.spec.SuspendUntil == "" {
+		return
+	}
+	log.Infof("%s: Resuming stream suspended until %s", stream.spec.ID, stream.spec.SuspendUntil)
+	if err := s.resumeStream(stream); err != nil {
+		// the handlers of the stream may still be exiting from the suspend
+		log.Errorf("%s: Failed to resume stream, retrying: %s", stream.spec.ID, err)
+		stream.scheduleResume(time.Second, func() { s.resumeSuspended(stream) })
+	}
 }
 
 func (s *subscriptionMGR) resumeStream(stream *eventStream) error {
+	before := specSnapshot(stream.spec.redacted())
 	if err := stream.resume(); err != nil {
 		return err
 	}
+	stream.cancelScheduledResume()
+	stream.spec.SuspendUntil = ""
 	// Persist the state change
-	return s.storeStream(stream.spec)
+	if err := s.storeStream(stream.spec); err != nil {
+		return err
+	}
+	s.publishLifecycleEvent(StreamResumed, stream.spec.ID, before, specSnapshot(stream.spec.redacted()), nil)
+	return nil
+}
+
+// setStreamSuspended suspends or resumes a stream on behalf of the gateway, such as when the
+// circuit breaker of its webhook opens and closes
+func (s *subscriptionMGR) setStreamSuspended(stream *eventStream, suspended bool) error {
+	s.changeMux.Lock()
+	defer s.changeMux.Unlock()
+	if suspended {
+		return s.suspendStream(stream, time.Time{})
+	}
+	return s.resumeStream(stream)
 }
 
 func (s *subscriptionMGR) storeStream(spec *StreamInfo) error {
+	spec.ResourceVersion++
 	infoBytes, _ := json.MarshalIndent(spec, "", "  ")
 	if err := s.db.Put(spec.ID, infoBytes); err != nil {
 		return errors.Errorf(errors.EventStreamsCreateStreamStoreFailed, err)
@@ -447,8 +1039,31 @@ func (s *subscriptionMGR) addSubscription(spec *eventsapi.SubscriptionInfo) (int
 	spec.TimeSorted = eventsapi.TimeSorted{
 		CreatedISO8601: time.Now().UTC().Format(time.RFC3339),
 	}
-	spec.ID = subIDPrefix + utils.UUIDv4()
+	spec.ID = subIDPrefix + utils.NewID()
 	spec.Path = SubPathPrefix + "/" + spec.ID
+	spec.ResourceVersion = 0
+	spec.Errored = ""
+	subscriptionKey, stream, statusCode, err := s.checkNewSubscription(spec)
+	if err != nil {
+		return statusCode, err
+	}
+
+	// Create it
+	sub, err := newSubscription(stream, s.rpc, spec)
+	if err != nil {
+		return 500, err
+	}
+	s.subscriptions[sub.info.ID] = sub
+	if err := s.storeSubscription(spec, subscriptionKey); err != nil {
+		return 500, err
+	}
+	s.publishLifecycleEvent(SubscriptionCreated, spec.ID, nil, specSnapshot(spec), nil)
+	return 200, nil
+}
+
+// checkNewSubscription sets the defaults of a new subscription, and checks it does not conflict
+// with an existing subscription. It returns the lookup key of the subscription, and its stream
+func (s *subscriptionMGR) checkNewSubscription(spec *eventsapi.SubscriptionInfo) (string, *eventStream, int, error) {
 	// Check initial block number to subscribe from
 	if spec.FromBlock == "" {
 		// user did not set an initial block, default to newest
@@ -457,9 +1072,15 @@ func (s *subscriptionMGR) addSubscription(spec *eventsapi.SubscriptionInfo) (int
 	if spec.Filter.BlockType == "" {
 		spec.Filter.BlockType = eventsapi.BlockTypeTX
 	}
+	if spec.Deliver == "" {
+		spec.Deliver = eventsapi.DeliverFull
+	}
 	if spec.Filter.EventFilter == "" && spec.Filter.ChaincodeID != "" {
 		spec.Filter.EventFilter = ".*"
 	}
+	if _, err := regexp.Compile(spec.Filter.EventFilter); err != nil {
+		return "", nil, 400, errors.Errorf(errors.EventStreamsSubscribeBadEventFilter, spec.Filter.EventFilter, err)
+	}
 
 	// A subscription is based on an event client and a registration. We must ensure that
 	// on restart all subscriptions can be restored. We must avoid allowing different subscriptions
@@ -482,23 +1103,34 @@ func (s *subscriptionMGR) addSubscription(spec *eventsapi.SubscriptionInfo) (int
 	_, err := s.db.Get(subscriptionKey)
 	if err == nil {
 		// a conflicting subscription already exists, return 400
-		return 400, errors.Error("A subscription with the same channel ID, chaincode ID, block type and event filter already exists")
+		return "", nil, 400, errors.Error("A subscription with the same channel ID, chaincode ID, block type and event filter already exists")
 	}
 
-	// Create it
 	stream, err := s.streamByID(spec.Stream)
 	if err != nil {
-		return 500, err
+		return "", nil, 500, err
 	}
-	sub, err := newSubscription(stream, s.rpc, spec)
-	if err != nil {
-		return 500, err
+	return subscriptionKey, stream, 200, nil
+}
+
+// validateNewSubscription is a dry run of adding a subscription. In addition to the checks made
+// when adding it, the channel must be queryable by the signer of the subscription
+func (s *subscriptionMGR) validateNewSubscription(ctx context.Context, spec *eventsapi.SubscriptionInfo) (int, error) {
+	if _, _, statusCode, err := s.checkNewSubscription(spec); err != nil {
+		return statusCode, err
 	}
-	s.subscriptions[sub.info.ID] = sub
-	return 200, s.storeSubscription(spec, subscriptionKey)
+	sub := &subscription{info: spec, client: s.rpc}
+	if err := sub.checkChannelMembership(ctx); err != nil {
+		return 400, err
+	}
+	if _, err := s.rpc.QueryChainInfo(ctx, spec.ChannelID, spec.Signer); err != nil {
+		return 400, errors.Errorf(errors.EventStreamsSubscribeChannelUnavailable, spec.ChannelID, spec.Signer, err)
+	}
+	return 200, nil
 }
 
 func (s *subscriptionMGR) resetSubscription(sub *subscription, initialBlock string) error {
+	before := specSnapshot(sub.info)
 	// Re-set the initial block on the subscription and save it
 	if initialBlock == "" || initialBlock == FromBlockNewest {
 		sub.info.FromBlock = FromBlockNewest
@@ -515,21 +1147,45 @@ func (s *subscriptionMGR) resetSubscription(sub *subscription, initialBlock stri
 	}
 	// Request a reset on the next poling cycle
 	sub.requestReset()
+	s.publishLifecycleEvent(SubscriptionUpdated, sub.info.ID, before, specSnapshot(sub.info), nil)
 	return nil
 }
 
 func (s *subscriptionMGR) deleteSubscription(sub *subscription) error {
 	delete(s.subscriptions, sub.info.ID)
 	sub.unsubscribe(true)
-	if err := s.db.Delete(sub.info.ID); err != nil {
-		return err
+	// the subscriptions of outboxes are not stored
+	if sub.info.TransactionID == "" {
+		if err := s.db.Delete(sub.info.ID); err != nil {
+			return err
+		}
+		// also delete the lookup key entry
+		subscriptionKey := calculateLookupKey(sub.info)
+		if err := s.db.Delete(subscriptionKey); err != nil {
+			return err
+		}
 	}
-	// also delete the lookup key entry
-	subscriptionKey := calculateLookupKey(sub.info)
-	return s.db.Delete(subscriptionKey)
+	s.publishLifecycleEvent(SubscriptionDeleted, sub.info.ID, specSnapshot(sub.info), nil, nil)
+	// a sub deleted individually is no longer managed by its group
+	if group, exists := s.groups[sub.info.Group]; exists {
+		for i, id := range group.Subscriptions {
+			if id == sub.info.ID {
+				group.Subscriptions = append(group.Subscriptions[:i], group.Subscriptions[i+1:]...)
+				break
+			}
+		}
+		return s.storeSubscriptionGroup(group)
+	}
+	return nil
 }
 
+// storeSubscription stores a subscription, apart from the one-shot subscriptions of outboxes.
+// The receipts those hold back do not survive a restart, so nothing would be waiting on them
 func (s *subscriptionMGR) storeSubscription(info *eventsapi.SubscriptionInfo, lookupKey string) error {
+	info.ResourceVersion++
+	if info.TransactionID != "" {
+		return nil
+	}
 	infoBytes, _ := json.MarshalIndent(info, "", "  ")
 	if err := s.db.Put(info.ID, infoBytes); err != nil {
 		return errors.Errorf(errors.EventStreamsSubscribeStoreFailed, err)
@@ -540,6 +1196,154 @@ func (s *subscriptionMGR) storeSubscription(info *eventsapi.SubscriptionInfo, lo
 	return nil
 }
 
+func (s *subscriptionMGR) getSubscriptionGroups() []*eventsapi.SubscriptionGroupInfo {
+	l := make([]*eventsapi.SubscriptionGroupInfo, 0, len(s.groups))
+	for _, group := range s.groups {
+		l = append(l, group)
+	}
+	return l
+}
+
+func (s *subscriptionMGR) addSubscriptionGroup(spec *eventsapi.SubscriptionGroupInfo) (int, error) {
+	channels, err := s.expandChannels(spec.Channels)
+	if err != nil {
+		return 400, err
+	}
+	spec.TimeSorted = eventsapi.TimeSorted{
+		CreatedISO8601: time.Now().UTC().Format(time.RFC3339),
+	}
+	spec.ID = subGroupIDPrefix + utils.NewID()
+	spec.Path = SubGroupPathPrefix + "/" + spec.ID
+	spec.Subscriptions = make([]string, 0, len(channels))
+
+	// Expand the template into a subscription per channel. If any one of them fails we
+	// remove the ones already created, so a group is either created in full or not at all
+	for _, channelID := range channels {
+		sub := spec.SubscriptionFor(channelID)
+		statusCode, err := s.addSubscription(sub)
+		if err != nil {
+			s.rollbackSubscriptionGroup(spec)
+			return statusCode, err
+		}
+		spec.Subscriptions = append(spec.Subscriptions, sub.ID)
+	}
+	if err := s.storeSubscriptionGroup(spec); err != nil {
+		s.rollbackSubscriptionGroup(spec)
+		return 500, err
+	}
+	s.groups[spec.ID] = spec
+	return 200, nil
+}
+
+func (s *subscriptionMGR) rollbackSubscriptionGroup(group *eventsapi.SubscriptionGroupInfo) {
+	for _, id := range group.Subscriptions {
+		if sub, exists := s.subscriptions[id]; exists {
+			if err := s.deleteSubscription(sub); err != nil {
+				log.Errorf("Failed to clean up subscription %s of group %s. %s", id, group.ID, err)
+			}
+		}
+	}
+}
+
+func (s *subscriptionMGR) deleteSubscriptionGroup(group *eventsapi.SubscriptionGroupInfo) error {
+	// remove the group first, so deleting the subs does not update it
+	delete(s.groups, group.ID)
+	for _, id := range group.Subscriptions {
+		if sub, exists := s.subscriptions[id]; exists {
+			if err := s.deleteSubscription(sub); err != nil {
+				log.Errorf("Failed to delete subscription %s of group %s. %s", id, group.ID, err)
+			}
+		}
+	}
+	return s.db.Delete(group.ID)
+}
+
+func (s *subscriptionMGR) addEventSchema(ctx context.Context, spec *eventsapi.EventSchemaInfo) (int, error) {
+	// held until the schema is added, so two requests cannot register the same event
+	s.changeMux.Lock()
+	defer s.changeMux.Unlock()
+	schema, err := compileEventSchema(spec)
+	if err != nil {
+		return 400, err
+	}
+	if err := s.schemas.check(spec); err != nil {
+		return 400, err
+	}
+	spec.TimeSorted = eventsapi.TimeSorted{
+		CreatedISO8601: time.Now().UTC().Format(time.RFC3339),
+	}
+	spec.ID = eventSchemaIDPrefix + utils.NewID()
+	spec.Path = EventSchemaPathPrefix + "/" + spec.ID
+	spec.RegistryID = 0
+	if s.schemas.registry != nil {
+		if spec.Subject == "" {
+			spec.Subject = defaultSchemaSubject(spec)
+		}
+		if spec.RegistryID, err = s.schemas.registry.register(ctx, spec.Subject, schemaTypeJSON, spec.Schema); err != nil {
+			return 502, err
+		}
+	}
+	infoBytes, _ := json.MarshalIndent(spec, "", "  ")
+	if err := s.db.Put(spec.ID, infoBytes); err != nil {
+		return 500, errors.Errorf(errors.EventSchemaStoreFailed, err)
+	}
+	s.schemas.add(schema)
+	return 200, nil
+}
+
+func (s *subscriptionMGR) storeSubscriptionGroup(group *eventsapi.SubscriptionGroupInfo) error {
+	infoBytes, _ := json.MarshalIndent(group, "", "  ")
+	if err := s.db.Put(group.ID, infoBytes); err != nil {
+		return errors.Errorf(errors.EventStreamsSubscriptionGroupStoreFailed, err)
+	}
+	return nil
+}
+
+// subscriptionGroupByID used internally to lookup groups
+func (s *subscriptionMGR) subscriptionGroupByID(id string) (*eventsapi.SubscriptionGroupInfo, error) {
+	group, exists := s.groups[id]
+	if !exists {
+		return nil, errors.Errorf(errors.EventStreamsSubscriptionGroupNotFound, id)
+	}
+	return group, nil
+}
+
+// expandChannels resolves the channel list of a group into a de-duplicated list of channel
+// names. Glob patterns are matched against the channels configured for the gateway, as
+// Fabric does not give a client the list of channels a peer has joined
+func (s *subscriptionMGR) expandChannels(patterns []string) ([]string, error) {
+	channels := make([]string, 0, len(patterns))
+	seen := make(map[string]bool)
+	for _, pattern := range patterns {
+		matches := []string{pattern}
+		if strings.ContainsAny(pattern, "*?[") {
+			matches = matches[:0]
+			for _, channelID := range s.config.Channels {
+				matched, err := path.Match(pattern, channelID)
+				if err != nil {
+					return nil, errors.Errorf(errors.RESTGatewaySubscriptionInvalid, err)
+				}
+				if matched {
+					matches = append(matches, channelID)
+				}
+			}
+			if len(matches) == 0 {
+				return nil, errors.Errorf(errors.EventStreamsSubscriptionGroupNoChannels, pattern)
+			}
+		}
+		for _, channelID := range matches {
+			if channelID != "" && !seen[channelID] {
+				seen[channelID] = true
+				channels = append(channels, channelID)
+			}
+		}
+	}
+	if len(channels) == 0 {
+		return nil, errors.Errorf(errors.RESTGatewaySubscriptionInvalid, `no channels in "channels"`)
+	}
+	return channels, nil
+}
+
 func (s *subscriptionMGR) subscriptionsForStream(id string) []*subscription {
 	subIDs := make([]*subscription, 0)
 	for _, sub := range s.subscriptions {
@@ -559,6 +1363,20 @@ func (s *subscriptionMGR) subscriptionByID(id string) (*subscription, error) {
 	return sub, nil
 }
 
+// subscriptionForRequest looks up the subscription in the path. Addressed as a listener of an
+// event stream, as in the FireFly connector toolkit, it must also belong to that stream
+func (s *subscriptionMGR) subscriptionForRequest(params httprouter.Params) (*subscription, *restutil.RestError) {
+	id := params.ByName("subscriptionId")
+	sub, err := s.subscriptionByID(id)
+	if err != nil {
+		return nil, restutil.NewRestError(err.Error(), 404)
+	}
+	if streamID := params.ByName("streamId"); streamID != "" && sub.info.Stream != streamID {
+		return nil, restutil.NewRestError(errors.Errorf(errors.EventStreamsSubscriptionNotFound, id).Error(), 404)
+	}
+	return sub, nil
+}
+
 func (s *subscriptionMGR) loadCheckpoint(streamID string) (map[string]uint64, error) {
 	cpID := checkpointIDPrefix + streamID
 	b, err := s.db.Get(cpID)
@@ -584,10 +1402,13 @@ func (s *subscriptionMGR) storeCheckpoint(streamID string, checkpoint map[string
 }
 
 func (s *subscriptionMGR) deleteCheckpoint(streamID string) {
-	cpID := checkpointIDPrefix + streamID
-	err := s.db.Delete(cpID)
-	if err != nil {
-		log.Errorf("Failed to delete checkpoint from database. %s", err)
+	shards := pollerWorkers(s.config)
+	for shard := 0; shard < shards; shard++ {
+		cpID := checkpointIDPrefix + checkpointShardID(streamID, shard, shards)
+		err := s.db.Delete(cpID)
+		if err != nil {
+			log.Errorf("Failed to delete checkpoint from database. %s", err)
+		}
 	}
 }
 
@@ -613,23 +1434,44 @@ func (s *subscriptionMGR) recoverStreams() {
 			if streamInfo.Webhook != nil && streamInfo.Webhook.TLSkipHostVerify == nil {
 				streamInfo.Webhook.TLSkipHostVerify = &falseValue
 			}
+			// the number of poller workers might have changed since the checkpoints were stored
+			if err := s.reshardCheckpoints(streamInfo.ID); err != nil {
+				log.Errorf("Failed to reshard the checkpoints of stream '%s': %s", streamInfo.ID, err)
+			}
 			stream, err := newEventStream(s, &streamInfo, s.wsChannels)
 			if err != nil {
 				log.Errorf("Failed to recover stream '%s': %s", streamInfo.ID, err)
 			} else {
+				stream.setResumeRetry(s.loadRetryStates(streamInfo.ID))
 				s.streams[streamInfo.ID] = stream
+				if *streamInfo.Suspended && streamInfo.SuspendUntil != "" {
+					// resumes straight away if the time passed while the gateway was down
+					if until, err := time.Parse(time.RFC3339, streamInfo.SuspendUntil); err == nil {
+						s.scheduleResume(stream, until)
+					} else {
+						log.Errorf("Failed to recover the time stream '%s' is suspended until: %s", streamInfo.ID, err)
+					}
+				}
 			}
 		}
 	}
 }
 
 func (s *subscriptionMGR) recoverSubscriptions() {
-	// Recover all the subscriptions
+	// Recover all the subscriptions, and the groups managing them
 	iSub := s.db.NewIterator()
 	defer iSub.Release()
 	for iSub.Next() {
 		k := iSub.Key()
-		if strings.HasPrefix(k, subIDPrefix) {
+		if strings.HasPrefix(k, subGroupIDPrefix) {
+			var groupInfo eventsapi.SubscriptionGroupInfo
+			err := json.Unmarshal(iSub.Value(), &groupInfo)
+			if err != nil {
+				log.Errorf("Failed to recover subscription group '%s': %s", string(iSub.Value()), err)
+				continue
+			}
+			s.groups[groupInfo.ID] = &groupInfo
+		} else if strings.HasPrefix(k, subIDPrefix) {
 			var subInfo eventsapi.SubscriptionInfo
 			err := json.Unmarshal(iSub.Value(), &subInfo)
 			if err != nil {
@@ -649,7 +1491,32 @@ func (s *subscriptionMGR) recoverSubscriptions() {
 	}
 }
 
+func (s *subscriptionMGR) recoverEventSchemas() {
+	iSchema := s.db.NewIterator()
+	defer iSchema.Release()
+	for iSchema.Next() {
+		if !strings.HasPrefix(iSchema.Key(), eventSchemaIDPrefix) {
+			continue
+		}
+		var schemaInfo eventsapi.EventSchemaInfo
+		err := json.Unmarshal(iSchema.Value(), &schemaInfo)
+		if err != nil {
+			log.Errorf("Failed to recover event schema '%s': %s", string(iSchema.Value()), err)
+			continue
+		}
+		schema, err := compileEventSchema(&schemaInfo)
+		if err != nil {
+			log.Errorf("Failed to recover event schema '%s': %s", schemaInfo.ID, err)
+			continue
+		}
+		s.schemas.add(schema)
+	}
+}
+
 func (s *subscriptionMGR) Close() {
+	if s.closed {
+		return
+	}
 	log.Infof("Event stream subscription manager shutting down")
 	for _, stream := range s.streams {
 		stream.stop()
@@ -657,12 +1524,91 @@ func (s *subscriptionMGR) Close() {
 	for _, sub := range s.subscriptions {
 		sub.close()
 	}
-	if !s.closed && s.db != nil {
+	if s.db != nil {
 		s.db.Close()
 	}
+	if s.systemEvents != nil {
+		s.systemEvents.Close()
+	}
 	s.closed = true
 }
 
+// validateSubscription checks the parameters common to subscriptions and subscription groups
+func validateSubscription(spec *eventsapi.SubscriptionInfo) *restutil.RestError {
+	if spec.Stream == "" {
+		return restutil.NewRestError(`Missing required parameter "stream"`, 400)
+	}
+	if spec.Signer == "" {
+		return restutil.NewRestError(`Missing required parameter "signer"`, 400)
+	}
+	pt := spec.PayloadType
+	if pt != "" && pt != eventsapi.EventPayloadTypeString && pt != eventsapi.EventPayloadTypeJSON {
+		return restutil.NewRestError(`Parameter "payloadType" must be an empty string, "string" or "json"`, 400)
+	}
+	bt := spec.Filter.BlockType
+	if bt != "" && bt != eventsapi.BlockTypeTX && bt != eventsapi.BlockTypeConfig && bt != eventsapi.BlockTypeAll {
+		return restutil.NewRestError(`Parameter "filter.blockType" must be an empty string, "tx", "config" or "all"`, 400)
+	}
+	switch spec.Type {
+	case "", eventsapi.SubscriptionTypeEvents:
+	case eventsapi.SubscriptionTypeBlocks:
+		if spec.Filter.ChaincodeID != "" {
+			return restutil.NewRestError(`Parameter "filter.chaincodeId" cannot be set for a subscription of type "blocks"`, 400)
+		}
+		// the decoded blocks always include the hashed writes to private data collections
+		if spec.PrivateData {
+			return restutil.NewRestError(`Parameter "privateData" cannot be set for a subscription of type "blocks"`, 400)
+		}
+	default:
+		return restutil.NewRestError(`Parameter "type" must be an empty string, "events" or "blocks"`, 400)
+	}
+	switch spec.Deliver {
+	case "", eventsapi.DeliverFull:
+	case eventsapi.DeliverFiltered:
+		// block subscriptions decode full blocks, and the filtered blocks have no payloads to check
+		if spec.Filter.ChaincodeID == "" {
+			return restutil.NewRestError(`Parameter "filter.chaincodeId" is required for a subscription to the "filtered" deliver service`, 400)
+		}
+		if spec.PayloadFilter != "" || spec.SequencePath != "" {
+			return restutil.NewRestError(`Parameters "payloadFilter" and "sequencePath" cannot be set for a subscription to the "filtered" deliver service, which omits the payloads`, 400)
+		}
+		if spec.PrivateData {
+			return restutil.NewRestError(`Parameter "privateData" cannot be set for a subscription to the "filtered" deliver service, whose blocks omit the read/write sets`, 400)
+		}
+		if !spec.RegistersChaincodeEvents() {
+			return restutil.NewRestError(`A subscription to the "filtered" deliver service can only deliver the events of valid transactions`, 400)
+		}
+	default:
+		return restutil.NewRestError(`Parameter "deliver" must be an empty string, "full" or "filtered"`, 400)
+	}
+	switch spec.OnlyValidTransactions {
+	case "", eventsapi.TxValidityValid, eventsapi.TxValidityInvalid, eventsapi.TxValidityBoth:
+	default:
+		return restutil.NewRestError(`Parameter "onlyValidTransactions" must be true, false or "both"`, 400)
+	}
+	if err := validateFromBlock(spec.FromBlock); err != nil {
+		return restutil.NewRestError(err.Error(), 400)
+	}
+	for h, v := range spec.Headers {
+		if !httpguts.ValidHeaderFieldName(h) || !httpguts.ValidHeaderFieldValue(v) {
+			return restutil.NewRestError(fmt.Sprintf(`Invalid header '%s' in "headers"`, h), 400)
+		}
+	}
+	if spec.SequencePath != "" && !validateSequencePath(spec.SequencePath) {
+		return restutil.NewRestError(`Parameter "sequencePath" must be a dot-separated path to a field of the payload`, 400)
+	}
+	if _, err := newPayloadFilter(spec.PayloadFilter); err != nil {
+		return restutil.NewRestError(fmt.Sprintf(`Invalid expression in "payloadFilter": %s`, err), 400)
+	}
+	return nil
+}
+
+// isValidateOnly is true when the validateOnly query parameter asks for a dry run of a create
+func isValidateOnly(req *http.Request) bool {
+	validateOnly, _ := strconv.ParseBool(req.URL.Query().Get("validateOnly"))
+	return validateOnly
+}
+
 func validateFromBlock(fromBlock string) error {
 	// from block property must be one of:
 	// - empty string (newest)
@@ -678,6 +1624,26 @@ func validateFromBlock(fromBlock string) error {
 
 func calculateLookupKey(spec *eventsapi.SubscriptionInfo) string {
 	compositeKey := fmt.Sprintf("%s-%s-%s-%s", spec.ChannelID, spec.Filter.ChaincodeID, spec.Filter.BlockType, spec.Filter.EventFilter)
+	if spec.TransactionID != "" {
+		// the one-shot subscriptions of outboxes only see their own transaction, so do not conflict
+		compositeKey += "-" + spec.TransactionID
+	}
+	if spec.Type == eventsapi.SubscriptionTypeBlocks {
+		// a subscription to the full blocks of a channel does not conflict with one to their events
+		compositeKey += "-" + spec.Type
+	}
+	if spec.Deliver == eventsapi.DeliverFiltered {
+		// nor does a subscription to the filtered deliver service, which has an event client of its own
+		compositeKey += "-" + spec.Deliver
+	}
+	if spec.OnlyValidTransactions == eventsapi.TxValidityInvalid || spec.OnlyValidTransactions == eventsapi.TxValidityBoth {
+		// nor one to the events of invalidated transactions, which reads them from the blocks
+		compositeKey += "-" + string(spec.OnlyValidTransactions)
+	}
+	if spec.PrivateData {
+		// nor one to private data, whose events carry the writes of their transactions to collections
+		compositeKey += "-privatedata"
+	}
 	hashKey := sha256.Sum256([]byte(compositeKey))
 	subscriptionKey := fmt.Sprintf("sub-idx-%x", hashKey)
 	return subscriptionKey
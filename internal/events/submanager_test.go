@@ -15,18 +15,29 @@
 package events
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"os"
 	"path"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/hyperledger/firefly-fabconnect/internal/auth"
+	"github.com/hyperledger/firefly-fabconnect/internal/auth/authtest"
 	"github.com/hyperledger/firefly-fabconnect/internal/events/api"
 	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
 	"github.com/hyperledger/firefly-fabconnect/internal/fabric/test"
 	"github.com/hyperledger/firefly-fabconnect/internal/kvstore"
+	restutil "github.com/hyperledger/firefly-fabconnect/internal/rest/utils"
+	"github.com/hyperledger/firefly-fabconnect/internal/ws"
+	mockfabric "github.com/hyperledger/firefly-fabconnect/mocks/fabric/client"
 	"github.com/julienschmidt/httprouter"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/syndtr/goleveldb/leveldb"
 )
 
@@ -46,6 +57,29 @@ func TestInitLevelDBSuccess(t *testing.T) {
 	sm.Close()
 }
 
+func TestRestartSubscriptionManager(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+
+	sm := newTestSubscriptionManager()
+	sm.config.LevelDB.Path = path.Join(dir, "db")
+	assert.NoError(sm.Init())
+	stream := &StreamInfo{
+		Type:    "webhook",
+		Webhook: &webhookActionInfo{URL: "http://test.invalid"},
+	}
+	assert.NoError(sm.addStream(stream))
+	sm.Close()
+	// closing again does not stop the streams twice
+	sm.Close()
+
+	assert.NoError(sm.Init())
+	assert.Len(sm.getStreams(), 1)
+	assert.Equal(stream.ID, sm.getStreams()[0].ID)
+	sm.Close()
+}
+
 func TestInitLevelDBFail(t *testing.T) {
 	assert := assert.New(t)
 	dir := tempdir(t)
@@ -104,10 +138,10 @@ func TestActionAndSubscriptionLifecyle(t *testing.T) {
 	assert.Nil(sm.subscriptionByID(stream.ID))
 	assert.Nil(sm.streamByID(sub.ID))
 
-	err = sm.suspendStream(retStream)
+	err = sm.suspendStream(retStream, time.Time{})
 	assert.NoError(err)
 
-	err = sm.suspendStream(retStream)
+	err = sm.suspendStream(retStream, time.Time{})
 	assert.NoError(err)
 
 	for {
@@ -256,3 +290,587 @@ func TestStreamAndSubscriptionDuplicateErrors(t *testing.T) {
 	sm.db.Close()
 	sm.Close()
 }
+
+func TestLifecycleEvents(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	sm := newTestSubscriptionManager()
+	wsChannels := sm.wsChannels.(*mockWebSocket)
+	wsChannels.broadcast = make(chan interface{}, 10)
+	sm.config.LevelDB.Path = path.Join(dir, "db")
+	err := sm.Init()
+	assert.NoError(err)
+	defer sm.Close()
+	assert.Equal(ws.SystemTopic, wsChannels.capturedNamespace)
+
+	nextEvent := func(eventType string) *LifecycleEvent {
+		event := (<-wsChannels.broadcast).(*ws.SystemEvent)
+		assert.Equal(eventType, event.Type)
+		return event.Data.(*LifecycleEvent)
+	}
+	suspended := func(spec json.RawMessage) bool {
+		var info StreamInfo
+		_ = json.Unmarshal(spec, &info)
+		return *info.Suspended
+	}
+
+	stream := &StreamInfo{
+		Type:    "webhook",
+		Webhook: &webhookActionInfo{URL: "http://test.invalid", Secret: "secret1"},
+	}
+	err = sm.addStream(stream)
+	assert.NoError(err)
+	event := nextEvent(StreamCreated)
+	assert.Equal(stream.ID, event.ID)
+	assert.Nil(event.Before)
+	assert.NotNil(event.After)
+	assert.NotContains(string(event.After), "secret1")
+
+	retStream, _ := sm.streamByID(stream.ID)
+	err = sm.suspendStream(retStream, time.Time{})
+	assert.NoError(err)
+	event = nextEvent(StreamSuspended)
+	assert.False(suspended(event.Before))
+	assert.True(suspended(event.After))
+	assert.NotContains(string(event.Before), "secret1")
+	assert.NotContains(string(event.After), "secret1")
+
+	sub := &api.SubscriptionInfo{
+		Name:      "testSub",
+		Stream:    stream.ID,
+		ChannelID: "testChannel",
+	}
+	_, err = sm.addSubscription(sub)
+	assert.NoError(err)
+	event = nextEvent(SubscriptionCreated)
+	assert.Equal(sub.ID, event.ID)
+
+	retSub, _ := sm.subscriptionByID(sub.ID)
+	err = sm.resetSubscription(retSub, "10")
+	assert.NoError(err)
+	event = nextEvent(SubscriptionUpdated)
+	var before, after api.SubscriptionInfo
+	_ = json.Unmarshal(event.Before, &before)
+	_ = json.Unmarshal(event.After, &after)
+	assert.Equal(FromBlockNewest, before.FromBlock)
+	assert.Equal("10", after.FromBlock)
+
+	err = sm.deleteStream(retStream)
+	assert.NoError(err)
+	event = nextEvent(SubscriptionDeleted)
+	assert.Equal(sub.ID, event.ID)
+	assert.Nil(event.After)
+	event = nextEvent(StreamDeleted)
+	assert.Equal(stream.ID, event.ID)
+	assert.NotNil(event.Before)
+}
+
+func TestSuspendStreamUntil(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	sm := newTestSubscriptionManager()
+	sm.config.LevelDB.Path = path.Join(dir, "db")
+	assert.NoError(sm.Init())
+
+	stream := &StreamInfo{
+		Type:    "webhook",
+		Webhook: &webhookActionInfo{URL: "http://test.invalid"},
+	}
+	assert.NoError(sm.addStream(stream))
+	streamParams := httprouter.Params{{Key: "streamId", Value: stream.ID}}
+	suspend := func(body string) (*map[string]string, *restutil.RestError) {
+		return sm.SuspendStream(nil, httptest.NewRequest("POST", "/", strings.NewReader(body)), streamParams)
+	}
+
+	_, restErr := suspend(`{"suspendUntil":"tomorrow"}`)
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp("Invalid suspendUntil 'tomorrow'. Must be an RFC3339 timestamp", restErr.Error)
+	_, restErr = suspend(`{"suspendUntil":"2020-01-01T00:00:00Z"}`)
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp("Must be in the future", restErr.Error)
+	assert.False(*stream.Suspended)
+
+	// the stream stays suspended after a restart, until the time is reached
+	until := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	result, restErr := suspend(`{"suspendUntil":"` + until + `"}`)
+	assert.Nil(restErr)
+	assert.Equal(until, (*result)["suspendUntil"])
+	sm.Close()
+	assert.NoError(sm.Init())
+	retStream, _ := sm.streamByID(stream.ID)
+	assert.True(*retStream.spec.Suspended)
+	assert.Equal(until, retStream.spec.SuspendUntil)
+	assert.NotNil(retStream.resumeTimer)
+
+	// suspending again without a time cancels the scheduled resume
+	_, restErr = suspend("")
+	assert.Nil(restErr)
+	assert.Empty(retStream.spec.SuspendUntil)
+	assert.Nil(retStream.resumeTimer)
+
+	until = time.Now().Add(2 * time.Second).UTC().Format(time.RFC3339)
+	_, restErr = suspend(`{"suspendUntil":"` + until + `"}`)
+	assert.Nil(restErr)
+	assert.Eventually(func() bool {
+		sm.changeMux.Lock()
+		defer sm.changeMux.Unlock()
+		return !*retStream.spec.Suspended
+	}, 10*time.Second, 50*time.Millisecond)
+	assert.Empty(retStream.spec.SuspendUntil)
+	sm.Close()
+}
+
+func TestIfMatch(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	sm := newTestSubscriptionManager()
+	sm.config.LevelDB.Path = path.Join(dir, "db")
+	err := sm.Init()
+	assert.NoError(err)
+
+	stream := &StreamInfo{
+		Type:    "webhook",
+		Webhook: &webhookActionInfo{URL: "http://test.invalid"},
+	}
+	err = sm.addStream(stream)
+	assert.NoError(err)
+	assert.Equal(uint64(1), stream.ResourceVersion)
+	sub := &api.SubscriptionInfo{
+		Name:      "testSub",
+		Stream:    stream.ID,
+		ChannelID: "testChannel",
+	}
+	_, err = sm.addSubscription(sub)
+	assert.NoError(err)
+	assert.Equal(uint64(1), sub.ResourceVersion)
+
+	streamParams := httprouter.Params{{Key: "streamId", Value: stream.ID}}
+	request := func(ifMatch, body string) *http.Request {
+		req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		return req
+	}
+
+	_, restErr := sm.SuspendStream(nil, request(`"1"`, ""), streamParams)
+	assert.Nil(restErr)
+	assert.Equal(uint64(2), stream.ResourceVersion)
+
+	// a client holding the previous version is rejected
+	_, restErr = sm.SuspendStream(nil, request(`"1"`, ""), streamParams)
+	assert.Equal(409, restErr.StatusCode)
+	assert.Regexp(`Current ETag is "2", If-Match is "1"`, restErr.Error)
+
+	_, restErr = sm.SuspendStream(nil, request(`W/"2", "5"`, ""), streamParams)
+	assert.Nil(restErr)
+	assert.Equal(uint64(3), stream.ResourceVersion)
+
+	subParams := httprouter.Params{{Key: "subscriptionId", Value: sub.ID}}
+	_, restErr = sm.ResetSubscription(nil, request("*", `{"initialBlock":"0"}`), subParams)
+	assert.Nil(restErr)
+	assert.Equal(uint64(2), sub.ResourceVersion)
+
+	// the version survives a restart
+	sm.Close()
+	sm = newTestSubscriptionManager()
+	sm.config.LevelDB.Path = path.Join(dir, "db")
+	sm.config.RequireIfMatch = true
+	err = sm.Init()
+	assert.NoError(err)
+	reloaded, err := sm.streamByID(stream.ID)
+	assert.NoError(err)
+	assert.Equal(uint64(3), reloaded.spec.ResourceVersion)
+
+	_, restErr = sm.DeleteSubscription(nil, request("", ""), subParams)
+	assert.Equal(428, restErr.StatusCode)
+	assert.Regexp("If-Match header", restErr.Error)
+	_, restErr = sm.DeleteSubscription(nil, request(`"2"`, ""), subParams)
+	assert.Nil(restErr)
+	sm.Close()
+}
+
+func TestValidateOnly(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	sm := newTestSubscriptionManager()
+	sm.config.LevelDB.Path = path.Join(dir, "db")
+	err := sm.Init()
+	assert.NoError(err)
+	defer sm.Close()
+
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		t.Errorf("Unexpected request %s", req.URL)
+	}))
+	defer svr.Close()
+	validate := func(body string) *http.Request {
+		return httptest.NewRequest("POST", "/eventstreams?validateOnly=true", strings.NewReader(body))
+	}
+
+	spec, restErr := sm.AddStream(nil, validate(`{"type":"webhook","webhook":{"url":"`+svr.URL+`"}}`), nil)
+	assert.Nil(restErr)
+	assert.Empty(spec.ID)
+	assert.Equal(uint64(1), spec.BatchSize)
+	assert.Equal(uint32(120), spec.Webhook.RequestTimeoutSec)
+	assert.Empty(sm.getStreams())
+
+	sm.config.WebhooksAllowPrivateIPs = false
+	_, restErr = sm.AddStream(nil, validate(`{"type":"webhook","webhook":{"url":"`+svr.URL+`"}}`), nil)
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp("Cannot send Webhook POST to address", restErr.Error)
+	sm.config.WebhooksAllowPrivateIPs = true
+
+	svr.Close()
+	_, restErr = sm.AddStream(nil, validate(`{"type":"webhook","webhook":{"url":"`+svr.URL+`"}}`), nil)
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp("Webhook host '127.0.0.1' is not reachable", restErr.Error)
+
+	stream := &StreamInfo{
+		Type:      "websocket",
+		WebSocket: &webSocketActionInfo{Topic: "topic1"},
+	}
+	err = sm.addStream(stream)
+	assert.NoError(err)
+
+	sub, restErr := sm.AddSubscription(nil, validate(`{"stream":"`+stream.ID+`","channel":"channel1","signer":"user1","filter":{"chaincodeId":"cc1"}}`), nil)
+	assert.Nil(restErr)
+	assert.Empty(sub.ID)
+	assert.Equal(".*", sub.Filter.EventFilter)
+	assert.Equal(api.DeliverFull, sub.Deliver)
+	assert.Empty(sm.getSubscriptions())
+
+	sub, restErr = sm.AddSubscription(nil, validate(`{"stream":"`+stream.ID+`","channel":"channel1","signer":"user1","deliver":"filtered","filter":{"chaincodeId":"cc1"}}`), nil)
+	assert.Nil(restErr)
+	assert.Equal(api.DeliverFiltered, sub.Deliver)
+	_, restErr = sm.AddSubscription(nil, validate(`{"stream":"`+stream.ID+`","channel":"channel1","signer":"user1","deliver":"filtered"}`), nil)
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp(`Parameter "filter.chaincodeId" is required`, restErr.Error)
+	_, restErr = sm.AddSubscription(nil, validate(`{"stream":"`+stream.ID+`","channel":"channel1","signer":"user1","deliver":"filtered","payloadFilter":"amount > 1000","filter":{"chaincodeId":"cc1"}}`), nil)
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp("which omits the payloads", restErr.Error)
+	_, restErr = sm.AddSubscription(nil, validate(`{"stream":"`+stream.ID+`","channel":"channel1","signer":"user1","deliver":"partial"}`), nil)
+	assert.Equal(400, restErr.StatusCode)
+	assert.EqualError(restErr.Error, `Parameter "deliver" must be an empty string, "full" or "filtered"`)
+	_, restErr = sm.AddSubscription(nil, validate(`{"stream":"`+stream.ID+`","channel":"channel1","signer":"user1","deliver":"filtered","onlyValidTransactions":"both","filter":{"chaincodeId":"cc1"}}`), nil)
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp("can only deliver the events of valid transactions", restErr.Error)
+	_, restErr = sm.AddSubscription(nil, validate(`{"stream":"`+stream.ID+`","channel":"channel1","signer":"user1","onlyValidTransactions":"maybe"}`), nil)
+	assert.Equal(400, restErr.StatusCode)
+	assert.EqualError(restErr.Error, `Parameter "onlyValidTransactions" must be true, false or "both"`)
+	sub, restErr = sm.AddSubscription(nil, validate(`{"stream":"`+stream.ID+`","channel":"channel1","signer":"user1","onlyValidTransactions":false,"filter":{"chaincodeId":"cc1"}}`), nil)
+	assert.Nil(restErr)
+	assert.Equal(eventsapi.TxValidityInvalid, sub.OnlyValidTransactions)
+	_, restErr = sm.AddSubscription(nil, validate(`{"stream":"`+stream.ID+`","channel":"channel1","signer":"user1","deliver":"filtered","privateData":true,"filter":{"chaincodeId":"cc1"}}`), nil)
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp("whose blocks omit the read/write sets", restErr.Error)
+	_, restErr = sm.AddSubscription(nil, validate(`{"stream":"`+stream.ID+`","channel":"channel1","signer":"user1","type":"blocks","privateData":true}`), nil)
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp(`Parameter "privateData" cannot be set for a subscription of type "blocks"`, restErr.Error)
+	sub, restErr = sm.AddSubscription(nil, validate(`{"stream":"`+stream.ID+`","channel":"channel1","signer":"user1","privateData":true,"filter":{"chaincodeId":"cc1"}}`), nil)
+	assert.Nil(restErr)
+	assert.True(sub.PrivateData)
+	assert.False(sub.RegistersChaincodeEvents())
+
+	_, restErr = sm.AddSubscription(nil, validate(`{"stream":"`+stream.ID+`","channel":"channel1","signer":"user1","filter":{"eventFilter":"Asset("}}`), nil)
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp("Invalid eventFilter 'Asset\\('", restErr.Error)
+
+	sub, restErr = sm.AddSubscription(nil, validate(`{"stream":"`+stream.ID+`","channel":"channel1","signer":"user1","type":"blocks","filter":{"blockType":"all"}}`), nil)
+	assert.Nil(restErr)
+	assert.Equal(api.SubscriptionTypeBlocks, sub.Type)
+	_, restErr = sm.AddSubscription(nil, validate(`{"stream":"`+stream.ID+`","channel":"channel1","signer":"user1","type":"blocks","filter":{"chaincodeId":"cc1"}}`), nil)
+	assert.Equal(400, restErr.StatusCode)
+	assert.EqualError(restErr.Error, `Parameter "filter.chaincodeId" cannot be set for a subscription of type "blocks"`)
+	_, restErr = sm.AddSubscription(nil, validate(`{"stream":"`+stream.ID+`","channel":"channel1","signer":"user1","type":"transactions"}`), nil)
+	assert.Equal(400, restErr.StatusCode)
+	assert.EqualError(restErr.Error, `Parameter "type" must be an empty string, "events" or "blocks"`)
+
+	_, restErr = sm.AddSubscription(nil, validate(`{"stream":"`+stream.ID+`","channel":"channel1","signer":"user1","payloadFilter":"amount >"}`), nil)
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp(`Invalid expression in "payloadFilter": .*Syntax error`, restErr.Error)
+
+	_, restErr = sm.AddSubscription(nil, validate(`{"stream":"`+stream.ID+`","channel":"channel1","signer":"user1","headers":{"bad header":"value"}}`), nil)
+	assert.Equal(400, restErr.StatusCode)
+	assert.EqualError(restErr.Error, `Invalid header 'bad header' in "headers"`)
+
+	rpc := &mockfabric.RPCClient{}
+	rpc.On("QueryChainInfo", mock.Anything, "channel2", "user1").Return(nil, fmt.Errorf("channel not found"))
+	sm.rpc = rpc
+	_, restErr = sm.AddSubscription(nil, validate(`{"stream":"`+stream.ID+`","channel":"channel2","signer":"user1"}`), nil)
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp("Channel 'channel2' cannot be queried by signer 'user1': channel not found", restErr.Error)
+}
+
+func TestStreamListeners(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	sm := newTestSubscriptionManager()
+	sm.config.LevelDB.Path = path.Join(dir, "db")
+	err := sm.Init()
+	assert.NoError(err)
+	defer sm.Close()
+
+	stream1 := &StreamInfo{Type: "websocket", WebSocket: &webSocketActionInfo{Topic: "topic1"}}
+	err = sm.addStream(stream1)
+	assert.NoError(err)
+	stream2 := &StreamInfo{Type: "websocket", WebSocket: &webSocketActionInfo{Topic: "topic2"}}
+	err = sm.addStream(stream2)
+	assert.NoError(err)
+	listenerParams := func(streamID string, subID ...string) httprouter.Params {
+		params := httprouter.Params{{Key: "streamId", Value: streamID}}
+		if len(subID) > 0 {
+			params = append(params, httprouter.Param{Key: "subscriptionId", Value: subID[0]})
+		}
+		return params
+	}
+	post := func(body string) *http.Request {
+		return httptest.NewRequest("POST", "/eventstreams/"+stream1.ID+"/listeners", strings.NewReader(body))
+	}
+
+	sub, restErr := sm.AddSubscription(nil, post(`{"name":"listener1","channel":"channel1","signer":"user1","filter":{"chaincodeId":"cc1"}}`), listenerParams(stream1.ID))
+	assert.Nil(restErr)
+	assert.Equal(stream1.ID, sub.Stream)
+	_, restErr = sm.AddSubscription(nil, post(`{"stream":"`+stream2.ID+`","channel":"channel1","signer":"user1"}`), listenerParams(stream1.ID))
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp("does not match the event stream", restErr.Error)
+	other := &api.SubscriptionInfo{Name: "sub2", Stream: stream2.ID, ChannelID: "channel1"}
+	_, err = sm.addSubscription(other)
+	assert.NoError(err)
+
+	assert.Len(sm.Subscriptions(nil, nil, nil), 2)
+	listeners := sm.Subscriptions(nil, nil, listenerParams(stream1.ID))
+	assert.Len(listeners, 1)
+	assert.Equal(sub.ID, listeners[0].ID)
+
+	found, restErr := sm.SubscriptionByID(nil, nil, listenerParams(stream1.ID, sub.ID))
+	assert.Nil(restErr)
+	assert.Equal("listener1", found.Name)
+	_, restErr = sm.SubscriptionByID(nil, nil, listenerParams(stream1.ID, other.ID))
+	assert.Equal(404, restErr.StatusCode)
+	_, restErr = sm.DeleteSubscription(nil, httptest.NewRequest("DELETE", "/", nil), listenerParams(stream1.ID, other.ID))
+	assert.Equal(404, restErr.StatusCode)
+
+	// listeners are reset from the fromBlock of the toolkit, when initialBlock is not set
+	_, restErr = sm.ResetSubscription(nil, post(`{"fromBlock":"10"}`), listenerParams(stream1.ID, sub.ID))
+	assert.Nil(restErr)
+	assert.Equal("10", sm.subscriptions[sub.ID].info.FromBlock)
+	_, restErr = sm.ResetSubscription(nil, post(`{"initialBlock":"newest","fromBlock":"10"}`), listenerParams(stream1.ID, sub.ID))
+	assert.Nil(restErr)
+	assert.Equal(FromBlockNewest, sm.subscriptions[sub.ID].info.FromBlock)
+	_, restErr = sm.ResetSubscription(nil, post(`{"fromBlock":"10"}`), listenerParams(stream1.ID, other.ID))
+	assert.Equal(404, restErr.StatusCode)
+
+	_, restErr = sm.DeleteSubscription(nil, httptest.NewRequest("DELETE", "/", nil), listenerParams(stream1.ID, sub.ID))
+	assert.Nil(restErr)
+	assert.Empty(sm.Subscriptions(nil, nil, listenerParams(stream1.ID)))
+}
+
+func TestDeleteSubscriptions(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	sm := newTestSubscriptionManager()
+	sm.config.LevelDB.Path = path.Join(dir, "db")
+	err := sm.Init()
+	assert.NoError(err)
+	defer sm.Close()
+
+	stream1 := &StreamInfo{Type: "websocket", WebSocket: &webSocketActionInfo{Topic: "topic1"}}
+	err = sm.addStream(stream1)
+	assert.NoError(err)
+	stream2 := &StreamInfo{Type: "websocket", WebSocket: &webSocketActionInfo{Topic: "topic2"}}
+	err = sm.addStream(stream2)
+	assert.NoError(err)
+	add := func(name, streamID, channelID, chaincodeID string) *api.SubscriptionInfo {
+		sub := &api.SubscriptionInfo{Name: name, Stream: streamID, ChannelID: channelID}
+		sub.Filter.ChaincodeID = chaincodeID
+		_, err := sm.addSubscription(sub)
+		assert.NoError(err)
+		return sub
+	}
+	load1 := add("loadtest-1", stream1.ID, "channel1", "cc1")
+	load2 := add("loadtest-2", stream2.ID, "channel1", "cc2")
+	load3 := add("loadtest-3", stream2.ID, "channel2", "cc3")
+	keep := add("keep", stream1.ID, "channel1", "cc4")
+	del := func(query string) (*api.SubscriptionsDeleted, *restutil.RestError) {
+		return sm.DeleteSubscriptions(nil, httptest.NewRequest("DELETE", "/subscriptions?"+query, nil), nil)
+	}
+
+	_, restErr := del("")
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp("At least one of the 'stream', 'channel' or 'name-prefix' query parameters is required", restErr.Error)
+
+	result, restErr := del("name-prefix=none")
+	assert.Nil(restErr)
+	assert.Equal(0, result.Deleted)
+	assert.Empty(result.Subscriptions)
+
+	result, restErr = del("channel=channel1&name-prefix=loadtest-")
+	assert.Nil(restErr)
+	assert.Equal(2, result.Deleted)
+	assert.ElementsMatch([]string{load1.ID, load2.ID}, result.Subscriptions)
+	assert.Equal(map[string]int{stream1.ID: 1, stream2.ID: 1}, result.Streams)
+	assert.Len(sm.getSubscriptions(), 2)
+
+	// the deleted subscriptions can be created again, as their lookup keys were deleted too
+	add("loadtest-1", stream1.ID, "channel1", "cc1")
+
+	sm.db.Close()
+	_, restErr = del("stream=" + stream2.ID)
+	assert.Equal(500, restErr.StatusCode)
+	assert.Regexp("Failed to delete subscriptions: leveldb: closed", restErr.Error)
+	_, err = sm.subscriptionByID(load3.ID)
+	assert.NoError(err)
+	_, err = sm.subscriptionByID(keep.ID)
+	assert.NoError(err)
+}
+
+func TestSubscriptionGroupLifecycle(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	sm := newTestSubscriptionManager()
+	sm.config.LevelDB.Path = path.Join(dir, "db")
+	sm.config.Channels = []string{"trade-eu", "trade-us", "settlement"}
+	err := sm.Init()
+	assert.NoError(err)
+
+	stream := &StreamInfo{
+		Type:    "webhook",
+		Webhook: &webhookActionInfo{URL: "http://test.invalid"},
+	}
+	err = sm.addStream(stream)
+	assert.NoError(err)
+
+	group := &api.SubscriptionGroupInfo{
+		Name:     "trades",
+		Stream:   stream.ID,
+		Channels: []string{"trade-*", "settlement", "trade-eu"},
+	}
+	group.Filter.ChaincodeID = "testChaincode"
+	_, err = sm.addSubscriptionGroup(group)
+	assert.NoError(err)
+	assert.Equal(3, len(group.Subscriptions))
+	assert.Equal(3, len(sm.getSubscriptions()))
+	first, err := sm.subscriptionByID(group.Subscriptions[0])
+	assert.NoError(err)
+	assert.Equal("trade-eu", first.info.ChannelID)
+	assert.Equal("trades-trade-eu", first.info.Name)
+	assert.Equal(group.ID, first.info.Group)
+
+	// Reload
+	sm.Close()
+	sm = newTestSubscriptionManager()
+	sm.config.LevelDB.Path = path.Join(dir, "db")
+	err = sm.Init()
+	assert.NoError(err)
+	reloaded, err := sm.subscriptionGroupByID(group.ID)
+	assert.NoError(err)
+	assert.Equal(group.Subscriptions, reloaded.Subscriptions)
+
+	// deleting a single member detaches it from the group
+	err = sm.deleteSubscription(sm.subscriptions[group.Subscriptions[0]])
+	assert.NoError(err)
+	assert.Equal(2, len(reloaded.Subscriptions))
+
+	err = sm.deleteSubscriptionGroup(reloaded)
+	assert.NoError(err)
+	assert.Equal([]*api.SubscriptionInfo{}, sm.getSubscriptions())
+	assert.Equal([]*api.SubscriptionGroupInfo{}, sm.getSubscriptionGroups())
+
+	sm.Close()
+}
+
+func TestSubscriptionGroupErrors(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	sm := newTestSubscriptionManager()
+	sm.rpc = test.MockRPCClient("")
+	sm.config.Channels = []string{"trade-eu"}
+	sm.db = kvstore.NewLDBKeyValueStore(path.Join(dir, "db"))
+	_ = sm.db.Init()
+	defer sm.db.Close()
+
+	stream := &StreamInfo{
+		Type:    "webhook",
+		Webhook: &webhookActionInfo{URL: "http://test.invalid"},
+	}
+	err := sm.addStream(stream)
+	assert.NoError(err)
+
+	status, err := sm.addSubscriptionGroup(&api.SubscriptionGroupInfo{Stream: stream.ID, Channels: []string{"settlement-*"}})
+	assert.Equal(400, status)
+	assert.EqualError(err, "Channel pattern 'settlement-*' does not match any configured channel")
+
+	status, err = sm.addSubscriptionGroup(&api.SubscriptionGroupInfo{Stream: stream.ID, Channels: []string{"[bad"}})
+	assert.Equal(400, status)
+	assert.Regexp("syntax error in pattern", err)
+
+	// a clash on the second channel rolls back the first
+	sub := &api.SubscriptionInfo{Stream: stream.ID, ChannelID: "trade-us"}
+	_, err = sm.addSubscription(sub)
+	assert.NoError(err)
+	status, err = sm.addSubscriptionGroup(&api.SubscriptionGroupInfo{Stream: stream.ID, Channels: []string{"trade-eu", "trade-us"}})
+	assert.Equal(400, status)
+	assert.Regexp("already exists", err)
+	assert.Equal([]*api.SubscriptionInfo{sub}, sm.getSubscriptions())
+	assert.Equal([]*api.SubscriptionGroupInfo{}, sm.getSubscriptionGroups())
+
+	sm.Close()
+}
+
+func TestStreamServiceIdentity(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	sm := newTestSubscriptionManager()
+	sm.config.LevelDB.Path = path.Join(dir, "db")
+	assert.NoError(sm.Init())
+	defer sm.Close()
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+	callerCtx, _ := auth.WithAuthContext(context.Background(), "testat")
+	newRequest := func(ctx context.Context, method, path, body string) *http.Request {
+		return httptest.NewRequest(method, path, strings.NewReader(body)).WithContext(ctx)
+	}
+
+	// callers can only assign the service identities they are authorized to
+	_, restErr := sm.AddStream(nil, newRequest(callerCtx, "POST", "/eventstreams", `{"type":"webhook","webhook":{"url":"http://test.invalid"},"serviceIdentity":"anyservice"}`), nil)
+	assert.Equal(403, restErr.StatusCode)
+	assert.EqualError(restErr.Error, "badness")
+	spec, restErr := sm.AddStream(nil, newRequest(callerCtx, "POST", "/eventstreams", `{"type":"webhook","webhook":{"url":"http://test.invalid"},"serviceIdentity":"testservice"}`), nil)
+	assert.Nil(restErr)
+	assert.Equal("testservice", spec.ServiceIdentity)
+	params := httprouter.Params{{Key: "streamId", Value: spec.ID}}
+
+	// the identity the stream has is not authorized again on an update of its other settings
+	_, restErr = sm.UpdateStream(nil, newRequest(context.Background(), "PATCH", "/eventstreams/"+spec.ID, `{"name":"stream2","serviceIdentity":"testservice"}`), params)
+	assert.Nil(restErr)
+	_, restErr = sm.UpdateStream(nil, newRequest(context.Background(), "PATCH", "/eventstreams/"+spec.ID, `{"serviceIdentity":"otherservice"}`), params)
+	assert.Equal(403, restErr.StatusCode)
+	assert.EqualError(restErr.Error, "No auth context")
+
+	// an identity that cannot be resolved when the poller starts is returned in the status of the stream
+	stream := &StreamInfo{
+		Type:            "webhook",
+		Webhook:         &webhookActionInfo{URL: "http://test.invalid"},
+		ServiceIdentity: "anyservice",
+	}
+	assert.NoError(sm.addStream(stream))
+	params = httprouter.Params{{Key: "streamId", Value: stream.ID}}
+	for {
+		spec, restErr = sm.StreamByID(nil, nil, params)
+		assert.Nil(restErr)
+		if spec.Errored != "" {
+			break
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+	assert.Equal("Failed to resolve service identity 'anyservice': badness", spec.Errored)
+}
@@ -19,13 +19,15 @@ package events
 import (
 	"context"
 	"fmt"
+	"regexp"
 	"strconv"
+	"sync"
 
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/firefly-fabconnect/internal/auth"
 	"github.com/hyperledger/firefly-fabconnect/internal/errors"
 	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
 	"github.com/hyperledger/firefly-fabconnect/internal/fabric/client"
-	"github.com/hyperledger/firefly-fabconnect/internal/fabric/utils"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -40,6 +42,9 @@ type subscription struct {
 	filterStale        bool
 	deleting           bool
 	resetRequested     bool
+	errored            bool // only accessed by the event poller of the stream
+	erroredMux         sync.Mutex
+	erroredReason      string
 }
 
 func newSubscription(stream *eventStream, rpc client.RPCClient, i *eventsapi.SubscriptionInfo) (*subscription, error) {
@@ -49,6 +54,13 @@ func newSubscription(stream *eventStream, rpc client.RPCClient, i *eventsapi.Sub
 		ep:          newEvtProcessor(i.ID, stream),
 		filterStale: true,
 	}
+	s.ep.sequence = newSequenceTracker(i.SequencePath)
+	s.ep.eventFilter = blockEventFilter(i)
+	s.ep.payloadFilter = subscriptionPayloadFilter(i)
+	s.ep.privateData = newPrivateDataReader(rpc, i)
+	if i.TransactionID != "" {
+		s.ep.outbox = newOutboxWaiter()
+	}
 	i.Summary = fmt.Sprintf(`FromBlock=%s,Chaincode=%s,Filter=%s`, i.FromBlock, i.Filter.ChaincodeID, i.Filter.EventFilter)
 	// If a name was not provided by the end user, set it to the system generated summary
 	if i.Name == "" {
@@ -66,10 +78,40 @@ func restoreSubscription(stream *eventStream, rpc client.RPCClient, i *eventsapi
 		ep:          newEvtProcessor(i.ID, stream),
 		filterStale: true,
 	}
+	s.ep.sequence = newSequenceTracker(i.SequencePath)
+	s.ep.eventFilter = blockEventFilter(i)
+	s.ep.payloadFilter = subscriptionPayloadFilter(i)
+	s.ep.privateData = newPrivateDataReader(rpc, i)
 	return s, nil
 }
 
-func (s *subscription) setInitialBlockHeight(_ context.Context) (uint64, error) {
+// subscriptionPayloadFilter parses the payload filter of a subscription. Filters were validated
+// when the subscription was created, so one that no longer parses is logged and ignored
+func subscriptionPayloadFilter(i *eventsapi.SubscriptionInfo) *payloadFilter {
+	filter, err := newPayloadFilter(i.PayloadFilter)
+	if err != nil {
+		log.Errorf("%s: Ignoring invalid payload filter '%s': %s", i.ID, i.PayloadFilter, err)
+	}
+	return filter
+}
+
+// blockEventFilter compiles the event filter of a subscription to blocks, which is matched against
+// the names of the chaincode events decoded from them. The events of subscriptions registered for
+// the events of a chaincode are filtered by the SDK, so nil is returned for those, for subscriptions
+// to full blocks, and for subscriptions without a filter
+func blockEventFilter(i *eventsapi.SubscriptionInfo) *regexp.Regexp {
+	if i.RegistersChaincodeEvents() || i.Filter.EventFilter == "" || i.Type == eventsapi.SubscriptionTypeBlocks {
+		return nil
+	}
+	filter, err := regexp.Compile(i.Filter.EventFilter)
+	if err != nil {
+		log.Errorf("%s: Ignoring invalid event filter '%s': %s", i.ID, i.Filter.EventFilter, err)
+		return nil
+	}
+	return filter
+}
+
+func (s *subscription) setInitialBlockHeight(ctx context.Context) (uint64, error) {
 	log.Debugf(`%s: Setting initial block height. "fromBlock" value in the subscription is %s`, s.info.ID, s.info.FromBlock)
 	if s.info.FromBlock != "" && s.info.FromBlock != FromBlockNewest {
 		fromBlock, err := strconv.ParseUint(s.info.FromBlock, 10, 64)
@@ -79,7 +121,7 @@ func (s *subscription) setInitialBlockHeight(_ context.Context) (uint64, error)
 		log.Infof("%s: initial block height for subscription: %d", s.info.ID, fromBlock)
 		return fromBlock, nil
 	}
-	result, err := s.client.QueryChainInfo(s.info.ChannelID, s.info.Signer)
+	result, err := s.client.QueryChainInfo(ctx, s.info.ChannelID, s.info.Signer)
 	if err != nil {
 		return 0, errors.Errorf(errors.RPCCallReturnedError, "QSCC GetChainInfo()", err)
 	}
@@ -94,8 +136,82 @@ func (s *subscription) setCheckpointBlockHeight(i uint64) {
 	log.Infof("%s: checkpoint restored block height for subscription: %d", s.info.ID, i)
 }
 
-func (s *subscription) restartFilter(_ context.Context, since uint64) error {
-	reg, blockEventNotifier, ccEventNotifier, err := s.client.SubscribeEvent(s.info, since)
+// setErrored notifies the transitions of the subscription between listening, and
+// failing to (re)start its event filter
+func (s *subscription) setErrored(sm subscriptionManager, err error) {
+	reason := ""
+	if err != nil {
+		reason = err.Error()
+	}
+	s.erroredMux.Lock()
+	changed := reason != s.erroredReason
+	s.erroredReason = reason
+	s.erroredMux.Unlock()
+	// the same error is retried every polling interval, so it is only logged when it changes
+	if changed && err != nil {
+		log.Errorf("%s: subscription error: %s", s.info.ID, err)
+	}
+	if (err != nil) == s.errored {
+		return
+	}
+	s.errored = err != nil
+	if s.errored {
+		sm.publishLifecycleEvent(SubscriptionErrored, s.info.ID, nil, nil, err)
+	} else {
+		sm.publishLifecycleEvent(SubscriptionRecovered, s.info.ID, nil, nil, nil)
+	}
+}
+
+// infoWithStatus returns a copy of the subscription, with the reason it is errored
+func (s *subscription) infoWithStatus() *eventsapi.SubscriptionInfo {
+	info := *s.info
+	s.erroredMux.Lock()
+	info.Errored = s.erroredReason
+	s.erroredMux.Unlock()
+	if info.Deliver == "" {
+		// subscriptions created before the deliver service could be chosen read full blocks
+		info.Deliver = eventsapi.DeliverFull
+	}
+	return &info
+}
+
+// checkChannelMembership fails if the peer of the organization has not joined the channel,
+// when the RPC client can list the joined channels
+func (s *subscription) checkChannelMembership(ctx context.Context) error {
+	lister, ok := s.client.(client.ChannelLister)
+	if !ok {
+		return nil
+	}
+	channels, err := lister.QueryChannels(ctx, s.info.Signer)
+	if err != nil {
+		return errors.Errorf(errors.RPCCallReturnedError, "CSCC GetChannels()", err)
+	}
+	for _, channel := range channels {
+		if channel == s.info.ChannelID {
+			return nil
+		}
+	}
+	return errors.Errorf(errors.EventStreamsSubscribeNotChannelMember, s.info.ChannelID, s.info.Signer)
+}
+
+func (s *subscription) restartFilter(ctx context.Context, since uint64) error {
+	// a no-op for the system context, but a stream running as a service identity
+	// must be permitted to listen on the channel
+	if err := auth.RPCSubscribe(ctx, s.info.ChannelID, s.info); err != nil {
+		return err
+	}
+	if s.ep.stream.replayThrottle.enabled() {
+		// only the historical part of the range is throttled, so find out where the chain is now
+		result, err := s.client.QueryChainInfo(ctx, s.info.ChannelID, s.info.Signer)
+		if err != nil {
+			return errors.Errorf(errors.RPCCallReturnedError, "QSCC GetChainInfo()", err)
+		}
+		s.ep.setReplayUntil(result.BCI.Height)
+		if since < result.BCI.Height {
+			log.Infof("%s: replaying blocks %d to %d at up to %d events/sec", s.info.ID, since, result.BCI.Height-1, s.ep.stream.spec.ReplayMaxEventsPerSec)
+		}
+	}
+	reg, blockEventNotifier, ccEventNotifier, err := s.client.SubscribeEvent(ctx, s.info, since)
 	if err != nil {
 		return errors.Errorf(errors.RPCCallReturnedError, "SubscribeEvent", err)
 	}
@@ -105,13 +221,13 @@ func (s *subscription) restartFilter(_ context.Context, since uint64) error {
 	s.markFilterStale(false)
 
 	// launch the events relay from the events pipe coming from the node to the batch queue
-	go s.processNewEvents()
+	go s.processNewEvents(ctx)
 
 	log.Infof("%s: created filter from block %d: %+v", s.info.ID, since, s.info.Filter)
 	return err
 }
 
-func (s *subscription) processNewEvents() {
+func (s *subscription) processNewEvents(ctx context.Context) {
 	for {
 		select {
 		case blockEvent, ok := <-s.blockEventNotifier:
@@ -119,9 +235,15 @@ func (s *subscription) processNewEvents() {
 				log.Infof("%s: Block event notifier channel closed", s.info.ID)
 				return
 			}
-			events := utils.GetEvents(blockEvent.Block)
+			if s.info.Type == eventsapi.SubscriptionTypeBlocks {
+				s.processBlock(ctx, blockEvent)
+				continue
+			}
+			// the decoded events are shared with the other subscriptions on the channel, so we work on a copy
+			events := s.ep.stream.sm.getBlockDecoder().getEvents(s.info.ChannelID, blockEvent.Block)
 			for _, event := range events {
-				if err := s.ep.processEventEntry(s.info, event); err != nil {
+				entry := *event
+				if err := s.ep.processEventEntry(s.info, &entry); err != nil {
 					log.Errorf("Failed to process event: %s", err)
 				}
 			}
@@ -130,15 +252,17 @@ func (s *subscription) processNewEvents() {
 				log.Infof("%s: Chaincode event notifier channel closed", s.info.ID)
 				return
 			}
+			// the SDK only delivers the chaincode events of valid transactions
 			event := &eventsapi.EventEntry{
-				ChaincodeID:   ccEvent.ChaincodeID,
-				BlockNumber:   ccEvent.BlockNumber,
-				TransactionID: ccEvent.TxID,
-				EventName:     ccEvent.EventName,
-				Payload:       ccEvent.Payload,
+				ChaincodeID:       ccEvent.ChaincodeID,
+				BlockNumber:       ccEvent.BlockNumber,
+				TransactionID:     ccEvent.TxID,
+				TransactionStatus: eventsapi.TransactionStatusValid,
+				EventName:         ccEvent.EventName,
+				Payload:           ccEvent.Payload,
 			}
 			if *s.ep.stream.spec.Timestamps {
-				s.getEventTimestamp(event)
+				s.getEventTimestamp(ctx, event)
 			}
 			if err := s.ep.processEventEntry(s.info, event); err != nil {
 				log.Errorf("Failed to process event: %s", err)
@@ -147,7 +271,20 @@ func (s *subscription) processNewEvents() {
 	}
 }
 
-func (s *subscription) getEventTimestamp(evt *eventsapi.EventEntry) {
+// processBlock delivers the whole decoded block, for subscriptions to full blocks
+func (s *subscription) processBlock(ctx context.Context, blockEvent *fab.BlockEvent) {
+	block := s.ep.stream.sm.getBlockDecoder().getBlock(s.info.ChannelID, blockEvent.Block)
+	if block == nil {
+		return
+	}
+	entry := *block
+	entry.Payload = s.ep.privateData.filterBlock(ctx, block.Payload)
+	if err := s.ep.processEventEntry(s.info, &entry); err != nil {
+		log.Errorf("Failed to process block: %s", err)
+	}
+}
+
+func (s *subscription) getEventTimestamp(ctx context.Context, evt *eventsapi.EventEntry) {
 	// the key in the cache is the block number represented as a string
 	blockNumber := strconv.FormatUint(evt.BlockNumber, 10)
 	if ts, ok := s.ep.stream.blockTimestampCache.Get(blockNumber); ok {
@@ -157,7 +294,7 @@ func (s *subscription) getEventTimestamp(evt *eventsapi.EventEntry) {
 		return
 	}
 	// we didn't find the timestamp in our cache, query the node for the block header where we can find the timestamp
-	_, block, err := s.client.QueryBlock(s.info.ChannelID, s.info.Signer, evt.BlockNumber, nil)
+	_, block, err := s.client.QueryBlock(ctx, s.info.ChannelID, s.info.Signer, evt.BlockNumber, nil)
 	if err != nil {
 		log.Errorf("Unable to retrieve block[%s] timestamp: %s", blockNumber, err)
 		evt.Timestamp = 0 // set to 0, we were not able to retrieve the timestamp.
@@ -15,10 +15,12 @@
 package events
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
 	"github.com/hyperledger/firefly-fabconnect/internal/fabric/test"
+	mockfabric "github.com/hyperledger/firefly-fabconnect/mocks/fabric/client"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -52,3 +54,51 @@ func TestRestoreSubscriptionMissingID(t *testing.T) {
 	_, err := restoreSubscription(m.stream, nil, testInfo)
 	assert.NoError(err)
 }
+
+func TestSubscriptionErroredTransitions(t *testing.T) {
+	assert := assert.New(t)
+	m := &mockSubMgr{}
+	m.stream = newTestStream(m)
+	s, err := newSubscription(m.stream, nil, testSubInfo("glastonbury"))
+	assert.NoError(err)
+
+	s.setErrored(m, nil)
+	s.setErrored(m, fmt.Errorf("pop"))
+	s.setErrored(m, fmt.Errorf("pop"))
+	assert.Equal("pop", s.infoWithStatus().Errored)
+	assert.Empty(s.info.Errored)
+	s.setErrored(m, nil)
+	s.setErrored(m, nil)
+	assert.Equal([]string{SubscriptionErrored, SubscriptionRecovered}, m.lifecycleEvents)
+	assert.Empty(s.infoWithStatus().Errored)
+}
+
+type mockChannelLister struct {
+	*mockfabric.RPCClient
+	channels []string
+	err      error
+}
+
+func (m *mockChannelLister) QueryChannels(ctx context.Context, signer string) ([]string, error) {
+	return m.channels, m.err
+}
+
+func TestCheckChannelMembership(t *testing.T) {
+	assert := assert.New(t)
+	i := testSubInfo("glastonbury")
+	i.ChannelID = "channel1"
+	i.Signer = "user1"
+
+	// clients that cannot list the channels are not checked
+	s := &subscription{info: i, client: &mockfabric.RPCClient{}}
+	assert.NoError(s.checkChannelMembership(context.Background()))
+
+	s.client = &mockChannelLister{channels: []string{"channel0", "channel1"}}
+	assert.NoError(s.checkChannelMembership(context.Background()))
+
+	s.client = &mockChannelLister{channels: []string{"channel0"}}
+	assert.EqualError(s.checkChannelMembership(context.Background()), "Channel 'channel1' has not been joined by the peer of the organization of signer 'user1'")
+
+	s.client = &mockChannelLister{err: fmt.Errorf("pop")}
+	assert.Regexp("CSCC GetChannels.*pop", s.checkChannelMembership(context.Background()))
+}
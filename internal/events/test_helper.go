@@ -21,12 +21,14 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync"
 	"testing"
 
 	"github.com/hyperledger/firefly-fabconnect/internal/conf"
 	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
 	"github.com/hyperledger/firefly-fabconnect/internal/fabric/test"
 	"github.com/hyperledger/firefly-fabconnect/internal/kvstore"
+	"github.com/hyperledger/firefly-fabconnect/internal/usage"
 	mockkvstore "github.com/hyperledger/firefly-fabconnect/mocks/kvstore"
 	"github.com/stretchr/testify/mock"
 	"github.com/syndtr/goleveldb/leveldb"
@@ -68,14 +70,47 @@ func newMockWebSocket() *mockWebSocket {
 }
 
 type mockSubMgr struct {
-	stream        *eventStream
-	subscription  *subscription
-	err           error
-	subscriptions []*subscription
+	config          *conf.EventstreamConf
+	stream          *eventStream
+	subscription    *subscription
+	err             error
+	subscriptions   []*subscription
+	lifecycleEvents []string
+	systemEvents    []interface{}
+	deadLetters     []*DeadLetter
+	schemas         *eventSchemas
+	suspensions     chan bool
+	mux             sync.Mutex
 }
 
 func (m *mockSubMgr) getConfig() *conf.EventstreamConf {
-	return &conf.EventstreamConf{}
+	if m.config == nil {
+		return &conf.EventstreamConf{}
+	}
+	return m.config
+}
+
+func (m *mockSubMgr) getScheduler() *priorityScheduler {
+	return newPriorityScheduler(0)
+}
+
+func (m *mockSubMgr) getBlockDecoder() *blockDecoder {
+	return newBlockDecoder(0)
+}
+
+func (m *mockSubMgr) getWebhookClients() *webhookClients {
+	return newWebhookClients(&conf.WebhooksConf{})
+}
+
+func (m *mockSubMgr) getUsage() *usage.Counters {
+	return usage.NewCounters()
+}
+
+func (m *mockSubMgr) getEventSchemas() *eventSchemas {
+	if m.schemas == nil {
+		return newEventSchemas(&conf.SchemaRegistryConf{})
+	}
+	return m.schemas
 }
 
 func (m *mockSubMgr) streamByID(string) (*eventStream, error) {
@@ -94,6 +129,52 @@ func (m *mockSubMgr) loadCheckpoint(string) (map[string]uint64, error) { return
 
 func (m *mockSubMgr) storeCheckpoint(string, map[string]uint64) error { return nil }
 
+func (m *mockSubMgr) storeRetryState(string, *retryState) error { return nil }
+
+func (m *mockSubMgr) deleteRetryState(string, string) {}
+
+func (m *mockSubMgr) storeDeadLetter(dl *DeadLetter) error {
+	m.deadLetters = append(m.deadLetters, dl)
+	return m.err
+}
+
+func (m *mockSubMgr) loadConsumerOffset(topic, consumerGroup string) (*ConsumerOffset, error) {
+	return &ConsumerOffset{Topic: topic, ConsumerGroup: consumerGroup, Offsets: map[string]*EventPosition{}}, m.err
+}
+
+func (m *mockSubMgr) advanceConsumerOffset(string, string, []*eventsapi.EventEntry) error {
+	return m.err
+}
+
+func (m *mockSubMgr) publishLifecycleEvent(eventType, id string, before, after json.RawMessage, err error) {
+	m.lifecycleEvents = append(m.lifecycleEvents, eventType)
+}
+
+func (m *mockSubMgr) publishSystemEvent(eventType string, data interface{}) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.systemEvents = append(m.systemEvents, data)
+}
+
+func (m *mockSubMgr) getSystemEvents() []interface{} {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return append([]interface{}{}, m.systemEvents...)
+}
+
+func (m *mockSubMgr) setStreamSuspended(stream *eventStream, suspended bool) error {
+	var err error
+	if suspended {
+		stream.suspend()
+	} else {
+		err = stream.resume()
+	}
+	if m.suspensions != nil {
+		m.suspensions <- suspended
+	}
+	return err
+}
+
 func testSubInfo(name string) *eventsapi.SubscriptionInfo {
 	return &eventsapi.SubscriptionInfo{ID: "test", Stream: "streamID", Name: name}
 }
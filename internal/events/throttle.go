@@ -0,0 +1,77 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// replayThrottle paces the delivery of historical events into a stream, so that
+// a large backfill does not starve live streams or overwhelm the consumer.
+// It is shared by all the subscriptions of a stream
+type replayThrottle struct {
+	mux      sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newReplayThrottle(maxEventsPerSec uint64) *replayThrottle {
+	t := &replayThrottle{}
+	t.setRate(maxEventsPerSec)
+	return t
+}
+
+func (t *replayThrottle) setRate(maxEventsPerSec uint64) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if maxEventsPerSec == 0 {
+		t.interval = 0
+	} else {
+		t.interval = time.Second / time.Duration(maxEventsPerSec)
+	}
+}
+
+func (t *replayThrottle) enabled() bool {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	return t.interval > 0
+}
+
+// wait blocks until the next event is allowed through, returning early
+// if the interrupt channel is closed
+func (t *replayThrottle) wait(interrupt <-chan struct{}) {
+	t.mux.Lock()
+	if t.interval == 0 {
+		t.mux.Unlock()
+		return
+	}
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	delay := t.next.Sub(now)
+	t.next = t.next.Add(t.interval)
+	t.mux.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-interrupt:
+		case <-time.After(delay):
+		}
+	}
+}
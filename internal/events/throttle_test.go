@@ -0,0 +1,66 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayThrottleDisabled(t *testing.T) {
+	assert := assert.New(t)
+	throttle := newReplayThrottle(0)
+	assert.False(throttle.enabled())
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		throttle.wait(nil)
+	}
+	assert.Less(time.Since(start), 50*time.Millisecond)
+}
+
+func TestReplayThrottlePaces(t *testing.T) {
+	assert := assert.New(t)
+	throttle := newReplayThrottle(100)
+	assert.True(throttle.enabled())
+	start := time.Now()
+	for i := 0; i < 11; i++ {
+		throttle.wait(nil)
+	}
+	// the first event goes straight through, the next 10 are 10ms apart
+	assert.GreaterOrEqual(time.Since(start), 100*time.Millisecond)
+}
+
+func TestReplayThrottleInterrupted(t *testing.T) {
+	assert := assert.New(t)
+	throttle := newReplayThrottle(1)
+	interrupt := make(chan struct{})
+	close(interrupt)
+	start := time.Now()
+	throttle.wait(interrupt)
+	throttle.wait(interrupt)
+	assert.Less(time.Since(start), 500*time.Millisecond)
+}
+
+func TestReplayOnlyThrottlesHistoricalBlocks(t *testing.T) {
+	assert := assert.New(t)
+	ep := newEvtProcessor("abc", nil)
+	ep.setReplayUntil(10)
+	assert.True(ep.isReplay(9))
+	assert.False(ep.isReplay(10))
+}
@@ -0,0 +1,327 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultCircuitBreakerProbeIntervalSec is how often a webhook is probed while its circuit is open
+	DefaultCircuitBreakerProbeIntervalSec = 30
+	// DefaultCircuitBreakerProbeMethod is the method of the requests that probe a webhook
+	DefaultCircuitBreakerProbeMethod = http.MethodHead
+)
+
+// System events about the circuit breaker of a webhook stream, broadcast on the system topic.
+// The stream is suspended when its circuit opens. When a probe finds the webhook has recovered
+// the circuit is half-open, and the stream is resumed to try a batch: the circuit closes if it is
+// delivered, and opens again if not. When the probes are exhausted the stream stays suspended,
+// until it is resumed through the API
+const (
+	StreamCircuitOpened          = "streamCircuitOpened"
+	StreamCircuitHalfOpen        = "streamCircuitHalfOpen"
+	StreamCircuitClosed          = "streamCircuitClosed"
+	StreamCircuitProbesExhausted = "streamCircuitProbesExhausted"
+)
+
+// States of the circuit of a webhook stream
+const (
+	CircuitStateClosed   = "closed"
+	CircuitStateOpen     = "open"
+	CircuitStateHalfOpen = "half-open"
+)
+
+// webhookCircuitBreakerInfo suspends a stream after consecutive batches fail, then probes the
+// webhook and resumes the stream when it recovers
+type webhookCircuitBreakerInfo struct {
+	FailureThreshold uint32 `json:"failureThreshold,omitempty"`
+	ProbeURL         string `json:"probeURL,omitempty"`
+	ProbeMethod      string `json:"probeMethod,omitempty"`
+	ProbeIntervalSec uint32 `json:"probeIntervalSec,omitempty"`
+	MaxProbes        uint32 `json:"maxProbes,omitempty"`
+}
+
+// CircuitBreakerEvent describes a change of the circuit of a stream
+type CircuitBreakerEvent struct {
+	Stream   string `json:"stream"`
+	Failures uint32 `json:"failures,omitempty"`
+	Probes   uint32 `json:"probes,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// CircuitBreakerStatus is the state of the circuit of a webhook stream, returned with the stream
+type CircuitBreakerStatus struct {
+	State    string     `json:"state"`
+	Failures uint32     `json:"failures,omitempty"`
+	Probes   uint32     `json:"probes,omitempty"`
+	OpenedAt *time.Time `json:"openedAt,omitempty"`
+}
+
+// circuitBreaker counts the batches of a stream that failed in a row, and while the circuit is
+// open, holds the cancel of the goroutine probing the webhook
+type circuitBreaker struct {
+	mux      sync.Mutex
+	failures uint32
+	state    string // closed when empty
+	probes   uint32
+	openedAt time.Time
+	cancel   context.CancelFunc
+}
+
+func validateWebhookCircuitBreaker(spec *webhookCircuitBreakerInfo) error {
+	if spec == nil {
+		return nil
+	}
+	if spec.FailureThreshold == 0 {
+		return errors.Errorf(errors.EventStreamsWebhookCircuitBreakerNoThreshold)
+	}
+	if spec.ProbeURL != "" {
+		if u, err := url.Parse(spec.ProbeURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return errors.Errorf(errors.EventStreamsWebhookCircuitBreakerInvalidProbeURL)
+		}
+	}
+	switch strings.ToUpper(spec.ProbeMethod) {
+	case "", http.MethodHead, http.MethodGet, http.MethodOptions:
+		return nil
+	default:
+		return errors.Errorf(errors.EventStreamsWebhookCircuitBreakerInvalidMethod, spec.ProbeMethod)
+	}
+}
+
+func setCircuitBreakerDefaults(spec *webhookCircuitBreakerInfo) {
+	if spec == nil {
+		return
+	}
+	spec.ProbeMethod = strings.ToUpper(spec.ProbeMethod)
+	if spec.ProbeMethod == "" {
+		spec.ProbeMethod = DefaultCircuitBreakerProbeMethod
+	}
+	if spec.ProbeIntervalSec == 0 {
+		spec.ProbeIntervalSec = DefaultCircuitBreakerProbeIntervalSec
+	}
+}
+
+// recordCircuit counts a batch that failed after all its retries, or resets the count when a
+// batch is delivered, and opens the circuit when the threshold of the webhook is reached. The
+// first batch after the circuit is half-open decides whether it closes or opens again
+func (a *eventStream) recordCircuit(err error) {
+	w, ok := a.action.(*webhookAction)
+	if !ok || w.spec.CircuitBreaker == nil {
+		return
+	}
+	cb := &a.circuit
+	cb.mux.Lock()
+	if err == nil {
+		cb.failures = 0
+		closed := cb.state == CircuitStateHalfOpen
+		probes := cb.probes
+		if closed {
+			cb.state = ""
+			cb.probes = 0
+			cb.cancel()
+			cb.cancel = nil
+		}
+		cb.mux.Unlock()
+		if closed {
+			log.Infof("%s: Delivered a batch after the webhook recovered. Circuit closed", a.spec.ID)
+			a.sm.publishSystemEvent(StreamCircuitClosed, &CircuitBreakerEvent{Stream: a.spec.ID, Probes: probes})
+		}
+		return
+	}
+	defer cb.mux.Unlock()
+	cb.failures++
+	if cb.state == CircuitStateOpen || (cb.state != CircuitStateHalfOpen && cb.failures < w.spec.CircuitBreaker.FailureThreshold) {
+		return
+	}
+	// a batch that fails while the circuit is half-open opens it again, without waiting for the threshold
+	cb.state = CircuitStateOpen
+	cb.probes = 0
+	cb.openedAt = time.Now().UTC()
+	if cb.cancel != nil {
+		cb.cancel()
+	}
+	var ctx context.Context
+	ctx, cb.cancel = context.WithCancel(context.Background())
+	go a.openCircuit(ctx, w, cb.failures, err)
+}
+
+func (cb *circuitBreaker) reset() {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	cb.state = ""
+	cb.failures = 0
+	cb.probes = 0
+	if cb.cancel != nil {
+		cb.cancel()
+		cb.cancel = nil
+	}
+}
+
+// setProbes records the probes made while the circuit is open
+func (cb *circuitBreaker) setProbes(probes uint32) {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	cb.probes = probes
+}
+
+// setHalfOpen is set before the stream is resumed, so the batch it delivers first closes the
+// circuit, or opens it again. Returns false if the circuit was reset in the meantime
+func (cb *circuitBreaker) setHalfOpen(halfOpen bool) bool {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	if cb.cancel == nil {
+		return false
+	}
+	if halfOpen {
+		cb.state = CircuitStateHalfOpen
+	} else {
+		cb.state = CircuitStateOpen
+	}
+	return true
+}
+
+// status returns the state of the circuit, for a stream with a circuit breaker
+func (cb *circuitBreaker) status() *CircuitBreakerStatus {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	status := &CircuitBreakerStatus{
+		State:    cb.state,
+		Failures: cb.failures,
+		Probes:   cb.probes,
+	}
+	if status.State == "" {
+		status.State = CircuitStateClosed
+	} else {
+		openedAt := cb.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
+
+// withCircuitStatus returns the spec of the stream with the state of its circuit, if its webhook
+// has a circuit breaker. The state is only returned, never stored
+func (a *eventStream) withCircuitStatus() *StreamInfo {
+	if a.spec.Webhook == nil || a.spec.Webhook.CircuitBreaker == nil {
+		return a.spec
+	}
+	spec := *a.spec
+	spec.Circuit = a.circuit.status()
+	return &spec
+}
+
+// close stops probing, when the stream is stopped
+func (cb *circuitBreaker) close() {
+	cb.reset()
+}
+
+// openCircuit suspends the stream, then probes the webhook until it is healthy again, the stream
+// is resumed through the API, or the probes are exhausted
+func (a *eventStream) openCircuit(ctx context.Context, w *webhookAction, failures uint32, err error) {
+	log.Warnf("%s: Suspending stream after %d batches failed in a row: %s", a.spec.ID, failures, err)
+	if err := a.sm.setStreamSuspended(a, true); err != nil {
+		log.Errorf("%s: Failed to suspend stream: %s", a.spec.ID, err)
+		a.circuit.reset()
+		return
+	}
+	a.sm.publishSystemEvent(StreamCircuitOpened, &CircuitBreakerEvent{Stream: a.spec.ID, Failures: failures, Error: err.Error()})
+
+	spec := w.spec.CircuitBreaker
+	interval := time.Duration(spec.ProbeIntervalSec) * time.Second
+	for probes := uint32(1); ; probes++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		if !*a.spec.Suspended {
+			log.Infof("%s: Stream was resumed while its circuit was open. Stopping probes", a.spec.ID)
+			a.circuit.reset()
+			return
+		}
+		err = w.probe(ctx)
+		a.circuit.setProbes(probes)
+		if err == nil {
+			if !a.circuit.setHalfOpen(true) {
+				return
+			}
+			if err = a.sm.setStreamSuspended(a, false); err == nil {
+				log.Infof("%s: Webhook recovered after %d probes. Resumed stream to try a batch", a.spec.ID, probes)
+				a.sm.publishSystemEvent(StreamCircuitHalfOpen, &CircuitBreakerEvent{Stream: a.spec.ID, Probes: probes})
+				return
+			}
+			a.circuit.setHalfOpen(false)
+		}
+		log.Warnf("%s: Webhook probe %d failed: %s", a.spec.ID, probes, err)
+		if spec.MaxProbes > 0 && probes >= spec.MaxProbes {
+			log.Errorf("%s: Webhook did not recover after %d probes. Stream stays suspended", a.spec.ID, probes)
+			a.sm.publishSystemEvent(StreamCircuitProbesExhausted, &CircuitBreakerEvent{Stream: a.spec.ID, Probes: probes, Error: err.Error()})
+			a.circuit.reset()
+			return
+		}
+	}
+}
+
+// probe makes a lightweight request to the webhook, or to its health endpoint, through the same
+// address policy, proxy and TLS configuration as deliveries. The webhook is healthy when it
+// answers with any status below 500, other than 429
+func (w *webhookAction) probe(ctx context.Context) error {
+	spec := w.spec.CircuitBreaker
+	probeURL := spec.ProbeURL
+	if probeURL == "" {
+		probeURL = w.spec.URL
+	}
+	u, _ := url.Parse(probeURL)
+	ctx, netClient, _, err := w.deliveryClient(ctx, u)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, spec.ProbeMethod, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	for h, v := range w.spec.Headers {
+		req.Header.Set(h, v)
+	}
+	if w.spec.OAuth2 != nil {
+		accessToken, err := w.tokens.get(ctx, netClient, w.spec.OAuth2)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	res, err := netClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+	if res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests {
+		return errors.Errorf(errors.EventStreamsWebhookProbeFailedHTTPStatus, w.es.spec.ID, res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookCircuitBreakerValidation(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(validateWebhookCircuitBreaker(nil))
+	assert.Regexp("Must specify webhook.circuitBreaker.failureThreshold", validateWebhookCircuitBreaker(&webhookCircuitBreakerInfo{}))
+	assert.Regexp("Invalid webhook.circuitBreaker.probeURL", validateWebhookCircuitBreaker(&webhookCircuitBreakerInfo{FailureThreshold: 3, ProbeURL: "ftp://test/health"}))
+	assert.Regexp("Invalid webhook.circuitBreaker.probeMethod 'POST'", validateWebhookCircuitBreaker(&webhookCircuitBreakerInfo{FailureThreshold: 3, ProbeMethod: "POST"}))
+	assert.Regexp("Must specify webhook.circuitBreaker.failureThreshold", validateWebhookConfig(&webhookActionInfo{URL: "http://test", CircuitBreaker: &webhookCircuitBreakerInfo{}}))
+
+	spec := &webhookActionInfo{URL: "http://test", CircuitBreaker: &webhookCircuitBreakerInfo{FailureThreshold: 3, ProbeMethod: "get"}}
+	assert.NoError(validateWebhookConfig(spec))
+	setWebhookDefaults(spec)
+	assert.Equal(http.MethodGet, spec.CircuitBreaker.ProbeMethod)
+	assert.Equal(uint32(DefaultCircuitBreakerProbeIntervalSec), spec.CircuitBreaker.ProbeIntervalSec)
+
+	stream, err := newEventStream(&mockSubMgr{}, &StreamInfo{ID: "es-1", Type: "webhook", Webhook: &webhookActionInfo{URL: "http://test"}}, nil)
+	assert.NoError(err)
+	defer stream.stop()
+	_, err = stream.update(&StreamInfo{Webhook: &webhookActionInfo{CircuitBreaker: &webhookCircuitBreakerInfo{ProbeMethod: "HEAD"}}})
+	assert.Regexp("Must specify webhook.circuitBreaker.failureThreshold", err)
+	_, err = stream.update(&StreamInfo{Webhook: &webhookActionInfo{CircuitBreaker: &webhookCircuitBreakerInfo{FailureThreshold: 5}}})
+	assert.NoError(err)
+	assert.Equal(DefaultCircuitBreakerProbeMethod, stream.spec.Webhook.CircuitBreaker.ProbeMethod)
+}
+
+func TestWebhookProbe(t *testing.T) {
+	assert := assert.New(t)
+	status := int32(404)
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal(http.MethodHead, req.Method)
+		assert.Equal("/health", req.URL.Path)
+		assert.Equal("v1", req.Header.Get("x-stream"))
+		res.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer svr.Close()
+
+	es := &eventStream{
+		sm:              &mockSubMgr{},
+		allowPrivateIPs: true,
+		spec:            &StreamInfo{ID: "es-1", Type: EventStreamTypeWebhook},
+	}
+	spec := &webhookActionInfo{URL: svr.URL + "/events", Headers: map[string]string{"x-stream": "v1"}, CircuitBreaker: &webhookCircuitBreakerInfo{FailureThreshold: 1, ProbeURL: svr.URL + "/health"}}
+	setWebhookDefaults(spec)
+	action, err := newWebhookAction(es, spec)
+	assert.NoError(err)
+
+	// any answer from the webhook that is not an error of the server means it is up
+	assert.NoError(action.probe(context.Background()))
+	atomic.StoreInt32(&status, 429)
+	assert.Regexp("es-1: Webhook probe failed with status 429", action.probe(context.Background()))
+	atomic.StoreInt32(&status, 502)
+	assert.Regexp("es-1: Webhook probe failed with status 502", action.probe(context.Background()))
+}
+
+func newTestCircuitStream(t *testing.T, svr *httptest.Server, breaker *webhookCircuitBreakerInfo) (*eventStream, *mockSubMgr) {
+	sm := &mockSubMgr{suspensions: make(chan bool, 2)}
+	stream, err := newEventStream(sm, &StreamInfo{
+		ID:   "es-1",
+		Type: "webhook",
+		Webhook: &webhookActionInfo{
+			URL:            svr.URL + "/events",
+			CircuitBreaker: breaker,
+		},
+	}, nil)
+	assert.NoError(t, err)
+	stream.allowPrivateIPs = true
+	t.Cleanup(stream.stop)
+	return stream, sm
+}
+
+func TestWebhookCircuitBreaker(t *testing.T) {
+	assert := assert.New(t)
+	var probes int32
+	healthy := int32(0)
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if atomic.LoadInt32(&healthy) == 0 {
+			res.WriteHeader(503)
+		}
+		atomic.AddInt32(&probes, 1)
+	}))
+	defer svr.Close()
+	stream, sm := newTestCircuitStream(t, svr, &webhookCircuitBreakerInfo{FailureThreshold: 2, ProbeIntervalSec: 1})
+
+	// only failures in a row open the circuit
+	stream.recordCircuit(fmt.Errorf("pop"))
+	stream.recordCircuit(nil)
+	stream.recordCircuit(fmt.Errorf("pop"))
+	assert.Empty(sm.getSystemEvents())
+	stream.recordCircuit(fmt.Errorf("pop"))
+	assert.True(<-sm.suspensions)
+	assert.True(*stream.spec.Suspended)
+	status := stream.withCircuitStatus().Circuit
+	assert.Equal(CircuitStateOpen, status.State)
+	assert.Equal(uint32(2), status.Failures)
+	assert.NotNil(status.OpenedAt)
+	assert.Nil(stream.spec.Circuit)
+
+	// the stream is resumed once a probe finds the webhook has recovered, with the circuit half-open
+	assert.Eventually(func() bool { return atomic.LoadInt32(&probes) > 0 }, 5*time.Second, 10*time.Millisecond)
+	atomic.StoreInt32(&healthy, 1)
+	assert.False(<-sm.suspensions)
+	assert.False(*stream.spec.Suspended)
+	assert.Equal(CircuitStateHalfOpen, stream.withCircuitStatus().Circuit.State)
+	assert.Eventually(func() bool { return len(sm.getSystemEvents()) == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	// and the circuit closes once a batch is delivered
+	stream.recordCircuit(nil)
+	assert.Equal(&CircuitBreakerStatus{State: CircuitStateClosed}, stream.withCircuitStatus().Circuit)
+
+	events := sm.getSystemEvents()
+	assert.Equal(3, len(events))
+	opened := events[0].(*CircuitBreakerEvent)
+	assert.Equal("es-1", opened.Stream)
+	assert.Equal(uint32(2), opened.Failures)
+	assert.Equal("pop", opened.Error)
+	halfOpen := events[1].(*CircuitBreakerEvent)
+	assert.GreaterOrEqual(halfOpen.Probes, uint32(2))
+	closed := events[2].(*CircuitBreakerEvent)
+	assert.Equal(halfOpen.Probes, closed.Probes)
+}
+
+func TestWebhookCircuitBreakerHalfOpenFailure(t *testing.T) {
+	assert := assert.New(t)
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {}))
+	defer svr.Close()
+	stream, sm := newTestCircuitStream(t, svr, &webhookCircuitBreakerInfo{FailureThreshold: 3, ProbeIntervalSec: 1})
+
+	for i := 0; i < 3; i++ {
+		stream.recordCircuit(fmt.Errorf("pop"))
+	}
+	assert.True(<-sm.suspensions)
+	assert.False(<-sm.suspensions)
+	assert.Equal(CircuitStateHalfOpen, stream.withCircuitStatus().Circuit.State)
+	assert.Eventually(func() bool { return len(sm.getSystemEvents()) == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	// a batch that fails while the circuit is half-open opens it again straight away
+	stream.recordCircuit(fmt.Errorf("pop again"))
+	assert.True(<-sm.suspensions)
+	assert.Equal(CircuitStateOpen, stream.withCircuitStatus().Circuit.State)
+	assert.Eventually(func() bool { return len(sm.getSystemEvents()) == 3 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal("pop again", sm.getSystemEvents()[2].(*CircuitBreakerEvent).Error)
+}
+
+func TestWebhookCircuitBreakerProbesExhausted(t *testing.T) {
+	assert := assert.New(t)
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(503)
+	}))
+	defer svr.Close()
+	stream, sm := newTestCircuitStream(t, svr, &webhookCircuitBreakerInfo{FailureThreshold: 1, ProbeIntervalSec: 1, MaxProbes: 1})
+
+	stream.recordCircuit(fmt.Errorf("pop"))
+	assert.True(<-sm.suspensions)
+	assert.Eventually(func() bool { return len(sm.getSystemEvents()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	exhausted := sm.getSystemEvents()[1].(*CircuitBreakerEvent)
+	assert.Equal(uint32(1), exhausted.Probes)
+	assert.Regexp("503", exhausted.Error)
+
+	// the stream stays suspended, until it is resumed through the API
+	assert.True(*stream.spec.Suspended)
+	assert.Equal(CircuitStateClosed, stream.withCircuitStatus().Circuit.State)
+}
@@ -0,0 +1,376 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+)
+
+const (
+	defaultWebhookMaxIdleConns        = 100
+	defaultWebhookMaxIdleConnsPerHost = 10
+	defaultWebhookIdleConnTimeout     = 90 * time.Second
+	defaultWebhookDNSCacheTTL         = 30 * time.Second
+	webhookProbeTimeout               = 10 * time.Second
+)
+
+// webhookClients holds the HTTP transports shared by all webhook streams, so that
+// connections to the same hosts are pooled and reused across batches and streams.
+// There is one transport for each combination of TLS verification setting, proxy and client
+// certificate, as those are the only parts of the transport configured per stream
+type webhookClients struct {
+	conf       *conf.WebhooksConf
+	dns        *dnsCache
+	dialer     *net.Dialer
+	proxy      func(*http.Request) (*url.URL, error)
+	proxyErr   error
+	mux        sync.Mutex
+	transports map[transportKey]*http.Transport
+}
+
+type transportKey struct {
+	tlsSkipHostVerify bool
+	proxyURL          string
+	clientCert        webhookClientCert
+}
+
+// webhookClientCert is the certificate and key a webhook client presents for mutual TLS, each
+// as inline PEM or the path of a PEM file
+type webhookClientCert struct {
+	cert string
+	key  string
+}
+
+// load reads and parses the certificate and key, returning nil if there is no client certificate
+func (c webhookClientCert) load() (*tls.Certificate, error) {
+	if c.cert == "" && c.key == "" {
+		return nil, nil
+	}
+	if c.cert == "" || c.key == "" {
+		return nil, errors.Errorf(errors.EventStreamsWebhookClientCertIncomplete)
+	}
+	certPEM, err := readPEM(c.cert)
+	if err != nil {
+		return nil, errors.Errorf(errors.EventStreamsWebhookInvalidClientCert, err)
+	}
+	keyPEM, err := readPEM(c.key)
+	if err != nil {
+		return nil, errors.Errorf(errors.EventStreamsWebhookInvalidClientCert, err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, errors.Errorf(errors.EventStreamsWebhookInvalidClientCert, err)
+	}
+	return &cert, nil
+}
+
+// readPEM returns inline PEM as is, and otherwise reads the file at the path
+func readPEM(value string) ([]byte, error) {
+	if strings.HasPrefix(strings.TrimSpace(value), "-----BEGIN") {
+		return []byte(value), nil
+	}
+	return os.ReadFile(value)
+}
+
+// tlsConfig returns the client TLS configuration of a stream
+func tlsConfig(tlsSkipHostVerify bool, clientCert webhookClientCert) (*tls.Config, error) {
+	cert, err := clientCert.load()
+	if err != nil {
+		return nil, err
+	}
+	// #nosec G402
+	config := &tls.Config{
+		InsecureSkipVerify: tlsSkipHostVerify,
+	}
+	if cert != nil {
+		config.Certificates = []tls.Certificate{*cert}
+	}
+	return config, nil
+}
+
+// newWebhookClients creates the shared transports. An invalid proxy URL is reported by
+// validate(), and fails every request rather than silently bypassing the proxy
+func newWebhookClients(whConf *conf.WebhooksConf) *webhookClients {
+	wc := &webhookClients{
+		conf: whConf,
+		dns:  newDNSCache(time.Duration(whConf.DNSCacheTTLSec) * time.Second),
+		dialer: &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		},
+		proxy:      http.ProxyFromEnvironment,
+		transports: make(map[transportKey]*http.Transport),
+	}
+	if whConf.ProxyURL != "" {
+		proxyURL, err := parseProxyURL(whConf.ProxyURL)
+		if err != nil {
+			wc.proxyErr = err
+			wc.proxy = func(*http.Request) (*url.URL, error) { return nil, wc.proxyErr }
+		} else {
+			wc.proxy = http.ProxyURL(proxyURL)
+		}
+	}
+	return wc
+}
+
+func (wc *webhookClients) validate() error {
+	return wc.proxyErr
+}
+
+// parseProxyURL accepts http, https and socks5 proxies. Credentials for an authenticated
+// proxy are passed in the user info of the URL
+func parseProxyURL(proxyURL string) (*url.URL, error) {
+	u, err := url.Parse(proxyURL)
+	if urlErr, ok := err.(*url.Error); ok {
+		// the url.Error includes the full URL, with any password
+		err = urlErr.Err
+	}
+	if err == nil && u.Host == "" {
+		err = fmt.Errorf("missing host")
+	}
+	if err == nil && u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5" {
+		err = fmt.Errorf("unsupported scheme '%s'", u.Scheme)
+	}
+	if err != nil {
+		return nil, errors.Errorf(errors.EventStreamsWebhookInvalidProxy, redactProxyURL(proxyURL), err)
+	}
+	return u, nil
+}
+
+// redactProxyURL removes any password before a proxy URL is logged or returned in an error
+func redactProxyURL(proxyURL string) string {
+	if u, err := url.Parse(proxyURL); err == nil {
+		return u.Redacted()
+	}
+	return "***"
+}
+
+// transport returns the shared transport for the TLS settings and proxy of a stream.
+// A stream without its own proxy uses the gateway proxy, or the proxy environment
+// variables (HTTP_PROXY, HTTPS_PROXY and NO_PROXY) when that is not configured either
+func (wc *webhookClients) transport(tlsSkipHostVerify bool, proxyURL string, clientCert webhookClientCert) (*http.Transport, error) {
+	wc.mux.Lock()
+	defer wc.mux.Unlock()
+	key := transportKey{tlsSkipHostVerify, proxyURL, clientCert}
+	if t, ok := wc.transports[key]; ok {
+		return t, nil
+	}
+	proxy := wc.proxy
+	if proxyURL != "" {
+		u, err := parseProxyURL(proxyURL)
+		if err != nil {
+			return nil, err
+		}
+		proxy = http.ProxyURL(u)
+	}
+	tlsClientConfig, err := tlsConfig(tlsSkipHostVerify, clientCert)
+	if err != nil {
+		return nil, err
+	}
+	t := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           wc.dialContext,
+		ForceAttemptHTTP2:     !wc.conf.DisableHTTP2,
+		MaxIdleConns:          defaultWebhookMaxIdleConns,
+		MaxIdleConnsPerHost:   defaultWebhookMaxIdleConnsPerHost,
+		MaxConnsPerHost:       wc.conf.MaxConnsPerHost,
+		IdleConnTimeout:       defaultWebhookIdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       tlsClientConfig,
+	}
+	if wc.conf.MaxIdleConns > 0 {
+		t.MaxIdleConns = wc.conf.MaxIdleConns
+	}
+	if wc.conf.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = wc.conf.MaxIdleConnsPerHost
+	}
+	if wc.conf.IdleConnTimeoutSec > 0 {
+		t.IdleConnTimeout = time.Duration(wc.conf.IdleConnTimeoutSec) * time.Second
+	}
+	wc.transports[key] = t
+	return t, nil
+}
+
+// client returns a lightweight client with its own timeout, over the shared transport
+func (wc *webhookClients) client(tlsSkipHostVerify bool, proxyURL string, clientCert webhookClientCert, timeout time.Duration) (*http.Client, error) {
+	t, err := wc.transport(tlsSkipHostVerify, proxyURL, clientCert)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Timeout:       timeout,
+		Transport:     t,
+		CheckRedirect: checkWebhookRedirect,
+	}, nil
+}
+
+// checkWebhookRedirect applies the host allow-list of a delivery to the hosts it is redirected
+// to. The addresses they resolve to are checked when dialing, unless sent through a proxy
+func checkWebhookRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return fmt.Errorf("stopped after 10 redirects")
+	}
+	if d := getWebhookDelivery(req.Context()); d != nil {
+		return d.policy.checkHost(req.URL.Hostname())
+	}
+	return nil
+}
+
+// proxyFor returns the proxy that requests to the URL are sent through, if any
+func (wc *webhookClients) proxyFor(u *url.URL, proxyURL string) (*url.URL, error) {
+	if proxyURL != "" {
+		return parseProxyURL(proxyURL)
+	}
+	return wc.proxy(&http.Request{URL: u})
+}
+
+// lookupIPv4 resolves a host through the same cache used when dialing, so the addresses
+// checked before a request are the addresses the request connects to
+func (wc *webhookClients) lookupIPv4(ctx context.Context, host string) ([]net.IP, error) {
+	return wc.dns.lookupIPv4(ctx, host)
+}
+
+// probe checks that a webhook host accepts connections, without sending it a request. For
+// HTTPS the TLS handshake must also succeed, presenting any client certificate. Webhooks sent
+// through a proxy are not probed, as only the proxy would be reached
+func (wc *webhookClients) probe(ctx context.Context, u *url.URL, tlsSkipHostVerify bool, proxyURL string, clientCert webhookClientCert) error {
+	if proxy, err := wc.proxyFor(u, proxyURL); err != nil || proxy != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhookProbeTimeout)
+	defer cancel()
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	conn, err := wc.dialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if u.Scheme == "https" {
+		config, err := tlsConfig(tlsSkipHostVerify, clientCert)
+		if err != nil {
+			return err
+		}
+		config.ServerName = u.Hostname()
+		return tls.Client(conn, config).HandshakeContext(ctx)
+	}
+	return nil
+}
+
+func (wc *webhookClients) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := wc.dns.lookupIPv4(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	// the addresses are checked as they are dialed, so a change to the records of the host
+	// since it was checked cannot direct the delivery, or a redirect, to a prohibited address
+	if d := getWebhookDelivery(ctx); d != nil && host != d.proxyHost {
+		if err := d.policy.check(host, ips); err != nil {
+			return nil, err
+		}
+	}
+	var conn net.Conn
+	for _, ip := range ips {
+		if conn, err = wc.dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port)); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+type dnsCacheEntry struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+// dnsCache avoids a DNS round trip for every webhook delivery, while still picking
+// up changes to the records within the TTL
+type dnsCache struct {
+	ttl      time.Duration
+	mux      sync.Mutex
+	entries  map[string]*dnsCacheEntry
+	resolver func(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+func newDNSCache(ttl time.Duration) *dnsCache {
+	if ttl <= 0 {
+		ttl = defaultWebhookDNSCacheTTL
+	}
+	return &dnsCache{
+		ttl:      ttl,
+		entries:  make(map[string]*dnsCacheEntry),
+		resolver: net.DefaultResolver.LookupIPAddr,
+	}
+}
+
+func (d *dnsCache) lookupIPv4(ctx context.Context, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() == nil {
+			return nil, errors.Errorf(errors.EventStreamsWebhookNoIPv4Address, host)
+		}
+		return []net.IP{ip}, nil
+	}
+	d.mux.Lock()
+	entry, ok := d.entries[host]
+	d.mux.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.ips, nil
+	}
+
+	addrs, err := d.resolver(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		if ip4 := addr.IP.To4(); ip4 != nil {
+			ips = append(ips, ip4)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, errors.Errorf(errors.EventStreamsWebhookNoIPv4Address, host)
+	}
+	d.mux.Lock()
+	d.entries[host] = &dnsCacheEntry{
+		ips:     ips,
+		expires: time.Now().Add(d.ttl),
+	}
+	d.mux.Unlock()
+	return ips, nil
+}
@@ -0,0 +1,113 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	restutil "github.com/hyperledger/firefly-fabconnect/internal/rest/utils"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// DefaultWebhookDeliveryHistory is the number of responses kept for each webhook stream
+	DefaultWebhookDeliveryHistory = 20
+	// webhookDeliveryBodyLimit is the number of bytes of each response body that are kept
+	webhookDeliveryBodyLimit = 1024
+)
+
+// WebhookDelivery is the outcome of a request of a webhook stream, as the webhook responded to it
+type WebhookDelivery struct {
+	Time      string `json:"time"`
+	Attempt   uint64 `json:"attempt"`
+	Status    int    `json:"status,omitempty"`
+	Body      string `json:"body,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+	LatencyMS int64  `json:"latencyMS"`
+	Error     string `json:"error,omitempty"` // set when there was no response
+}
+
+// webhookDeliveries keeps the most recent deliveries of a webhook stream, in a ring
+type webhookDeliveries struct {
+	mux        sync.Mutex
+	deliveries []*WebhookDelivery
+	next       int
+}
+
+func newWebhookDeliveries(size int) *webhookDeliveries {
+	if size <= 0 {
+		size = DefaultWebhookDeliveryHistory
+	}
+	return &webhookDeliveries{
+		deliveries: make([]*WebhookDelivery, 0, size),
+	}
+}
+
+// record keeps the outcome of a request, replacing the oldest once the ring is full. The body
+// is truncated to its first bytes
+func (d *webhookDeliveries) record(attempt uint64, status int, body []byte, latency time.Duration, err error) {
+	delivery := &WebhookDelivery{
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		Attempt:   attempt,
+		Status:    status,
+		LatencyMS: latency.Milliseconds(),
+	}
+	if len(body) > webhookDeliveryBodyLimit {
+		body = body[:webhookDeliveryBodyLimit]
+		delivery.Truncated = true
+	}
+	delivery.Body = string(body)
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	if len(d.deliveries) < cap(d.deliveries) {
+		d.deliveries = append(d.deliveries, delivery)
+	} else {
+		d.deliveries[d.next] = delivery
+	}
+	d.next = (d.next + 1) % cap(d.deliveries)
+}
+
+// list returns the deliveries, the most recent first
+func (d *webhookDeliveries) list() []*WebhookDelivery {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	l := make([]*WebhookDelivery, 0, len(d.deliveries))
+	for i := 1; i <= len(d.deliveries); i++ {
+		l = append(l, d.deliveries[(d.next-i+len(d.deliveries))%len(d.deliveries)])
+	}
+	return l
+}
+
+// Deliveries lists the most recent responses of the webhook of a stream
+func (s *subscriptionMGR) Deliveries(_ http.ResponseWriter, _ *http.Request, params httprouter.Params) ([]*WebhookDelivery, *restutil.RestError) {
+	streamID := params.ByName("streamId")
+	stream, err := s.streamByID(streamID)
+	if err != nil {
+		return nil, restutil.NewRestError(err.Error(), 404)
+	}
+	webhook, ok := stream.action.(*webhookAction)
+	if !ok {
+		return nil, restutil.NewRestError(errors.Errorf(errors.EventStreamsDeliveriesNotWebhook, streamID).Error(), 400)
+	}
+	return webhook.deliveries.list(), nil
+}
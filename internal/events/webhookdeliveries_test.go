@@ -0,0 +1,99 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookDeliveriesRing(t *testing.T) {
+	assert := assert.New(t)
+	d := newWebhookDeliveries(0)
+	assert.Equal(DefaultWebhookDeliveryHistory, cap(d.deliveries))
+	assert.Empty(d.list())
+
+	d = newWebhookDeliveries(3)
+	for i := 1; i <= 5; i++ {
+		d.record(uint64(i), 200, nil, time.Millisecond, nil)
+	}
+	l := d.list()
+	assert.Equal(3, len(l))
+	assert.Equal(uint64(5), l[0].Attempt)
+	assert.Equal(uint64(4), l[1].Attempt)
+	assert.Equal(uint64(3), l[2].Attempt)
+
+	d.record(6, 0, nil, 2*time.Second, fmt.Errorf("pop"))
+	l = d.list()
+	assert.Equal("pop", l[0].Error)
+	assert.Equal(int64(2000), l[0].LatencyMS)
+	assert.Zero(l[0].Status)
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	assert := assert.New(t)
+	status := 400
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(status)
+		_, _ = res.Write([]byte(strings.Repeat("a", webhookDeliveryBodyLimit+10)))
+	}))
+	defer svr.Close()
+
+	sm := newTestSubscriptionManager()
+	es := &eventStream{
+		sm:              sm,
+		allowPrivateIPs: true,
+		spec:            &StreamInfo{ID: "es-1", Type: EventStreamTypeWebhook},
+	}
+	action, err := newWebhookAction(es, &webhookActionInfo{URL: svr.URL})
+	assert.NoError(err)
+	es.action = action
+	sm.streams[es.spec.ID] = es
+	events := []*eventsapi.EventEntry{{SubID: "sb-1"}}
+
+	err = action.attemptBatch(context.Background(), 1, 1, events)
+	assert.Regexp("status=400", err)
+	status = 200
+	err = action.attemptBatch(context.Background(), 1, 2, events)
+	assert.NoError(err)
+
+	deliveries, restErr := sm.Deliveries(nil, nil, httprouter.Params{{Key: "streamId", Value: "es-1"}})
+	assert.Nil(restErr)
+	assert.Equal(2, len(deliveries))
+	assert.Equal(200, deliveries[0].Status)
+	assert.Equal(uint64(2), deliveries[0].Attempt)
+	assert.Equal(400, deliveries[1].Status)
+	assert.Equal(webhookDeliveryBodyLimit, len(deliveries[1].Body))
+	assert.True(deliveries[1].Truncated)
+	assert.True(deliveries[0].Truncated)
+
+	_, restErr = sm.Deliveries(nil, nil, httprouter.Params{{Key: "streamId", Value: "es-2"}})
+	assert.Equal(404, restErr.StatusCode)
+	sm.streams["es-2"] = &eventStream{spec: &StreamInfo{ID: "es-2", Type: EventStreamTypeKafka}, action: &kafkaAction{}}
+	_, restErr = sm.Deliveries(nil, nil, httprouter.Params{{Key: "streamId", Value: "es-2"}})
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp("Event stream es-2 is not a webhook stream", restErr.Error)
+}
@@ -0,0 +1,145 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+)
+
+// oauth2TokenExpiryMargin is how long before it expires a token is replaced, so it does not
+// expire while a batch is in flight
+const oauth2TokenExpiryMargin = 30 * time.Second
+
+// webhookOAuth2Info configures the OAuth2 client credentials grant a webhook stream uses to
+// obtain the bearer token it sends with each batch
+type webhookOAuth2Info struct {
+	TokenURL     string   `json:"tokenURL,omitempty"`
+	ClientID     string   `json:"clientId,omitempty"`
+	ClientSecret string   `json:"clientSecret,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+}
+
+func validateWebhookOAuth2(spec *webhookOAuth2Info) error {
+	if spec.ClientID == "" {
+		return errors.Errorf(errors.EventStreamsWebhookOAuth2NoClientID)
+	}
+	u, err := url.Parse(spec.TokenURL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return errors.Errorf(errors.EventStreamsWebhookOAuth2InvalidTokenURL)
+	}
+	return nil
+}
+
+// oauth2Token is the bearer token last issued to a stream, for the configuration it was issued for
+type oauth2Token struct {
+	config      webhookOAuth2Info
+	accessToken string
+	expires     time.Time
+}
+
+// oauth2TokenCache holds the token of a webhook stream, which is reused for each batch until
+// it is about to expire, or the webhook rejects it
+type oauth2TokenCache struct {
+	mux   sync.Mutex
+	token *oauth2Token
+}
+
+type oauth2TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// get returns the cached token if it is still valid for the configuration, and otherwise
+// requests a new one from the token endpoint with the client credentials grant
+func (c *oauth2TokenCache) get(ctx context.Context, client *http.Client, spec *webhookOAuth2Info) (string, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if t := c.token; t != nil && sameOAuth2Config(&t.config, spec) && (t.expires.IsZero() || time.Now().Add(oauth2TokenExpiryMargin).Before(t.expires)) {
+		return t.accessToken, nil
+	}
+	c.token = nil
+
+	form := url.Values{"grant_type": []string{"client_credentials"}}
+	if len(spec.Scopes) > 0 {
+		form.Set("scope", strings.Join(spec.Scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", spec.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errors.Errorf(errors.EventStreamsWebhookOAuth2TokenFailed, spec.TokenURL, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(spec.ClientID), url.QueryEscape(spec.ClientSecret))
+	res, err := client.Do(req)
+	if err != nil {
+		return "", errors.Errorf(errors.EventStreamsWebhookOAuth2TokenFailed, spec.TokenURL, err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return "", errors.Errorf(errors.EventStreamsWebhookOAuth2TokenFailed, spec.TokenURL, fmt.Sprintf("status=%d %s", res.StatusCode, body))
+	}
+	var tokenRes oauth2TokenResponse
+	if err := json.Unmarshal(body, &tokenRes); err != nil {
+		return "", errors.Errorf(errors.EventStreamsWebhookOAuth2TokenFailed, spec.TokenURL, err)
+	}
+	if tokenRes.AccessToken == "" || (tokenRes.TokenType != "" && !strings.EqualFold(tokenRes.TokenType, "bearer")) {
+		return "", errors.Errorf(errors.EventStreamsWebhookOAuth2TokenFailed, spec.TokenURL, fmt.Sprintf("no bearer token in the response (token_type=%s)", tokenRes.TokenType))
+	}
+	t := &oauth2Token{
+		config:      *spec,
+		accessToken: tokenRes.AccessToken,
+	}
+	// a token without an expiry is used until the webhook rejects it
+	if tokenRes.ExpiresIn > 0 {
+		t.expires = time.Now().Add(time.Duration(tokenRes.ExpiresIn) * time.Second)
+	}
+	c.token = t
+	return t.accessToken, nil
+}
+
+// invalidate drops the token, if it is the one the webhook rejected, so the next attempt requests a new one
+func (c *oauth2TokenCache) invalidate(accessToken string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.token != nil && c.token.accessToken == accessToken {
+		c.token = nil
+	}
+}
+
+func sameOAuth2Config(a, b *webhookOAuth2Info) bool {
+	if a.TokenURL != b.TokenURL || a.ClientID != b.ClientID || a.ClientSecret != b.ClientSecret || len(a.Scopes) != len(b.Scopes) {
+		return false
+	}
+	for i := range a.Scopes {
+		if a.Scopes[i] != b.Scopes[i] {
+			return false
+		}
+	}
+	return true
+}
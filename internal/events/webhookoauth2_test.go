@@ -0,0 +1,147 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookOAuth2(t *testing.T) {
+	assert := assert.New(t)
+	var issued int32
+	authorizations := make(chan string, 5)
+	webhookStatus := int32(200)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(res http.ResponseWriter, req *http.Request) {
+		_ = req.ParseForm()
+		id, secret, _ := req.BasicAuth()
+		if id != "client1" || secret != "secret1" || req.Form.Get("grant_type") != "client_credentials" || req.Form.Get("scope") != "events write" {
+			res.WriteHeader(401)
+			return
+		}
+		n := atomic.AddInt32(&issued, 1)
+		res.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(res, `{"access_token":"token%d","token_type":"Bearer","expires_in":3600}`, n)
+	})
+	mux.HandleFunc("/webhook", func(res http.ResponseWriter, req *http.Request) {
+		authorizations <- req.Header.Get("Authorization")
+		res.WriteHeader(int(atomic.LoadInt32(&webhookStatus)))
+	})
+	svr := httptest.NewServer(mux)
+	defer svr.Close()
+
+	es := &eventStream{
+		sm:              &mockSubMgr{},
+		allowPrivateIPs: true,
+		spec:            &StreamInfo{ID: "es-1", Type: EventStreamTypeWebhook},
+	}
+	action, err := newWebhookAction(es, &webhookActionInfo{
+		URL: svr.URL + "/webhook",
+		OAuth2: &webhookOAuth2Info{
+			TokenURL:     svr.URL + "/token",
+			ClientID:     "client1",
+			ClientSecret: "secret1",
+			Scopes:       []string{"events", "write"},
+		},
+	})
+	assert.NoError(err)
+	events := []*eventsapi.EventEntry{{SubID: "sb-1"}}
+
+	// the token is reused while it is valid
+	assert.NoError(action.attemptBatch(context.Background(), 1, 1, events))
+	assert.NoError(action.attemptBatch(context.Background(), 2, 1, events))
+	assert.Equal("Bearer token1", <-authorizations)
+	assert.Equal("Bearer token1", <-authorizations)
+
+	// a rejected token is replaced on the next attempt
+	atomic.StoreInt32(&webhookStatus, 401)
+	assert.Error(action.attemptBatch(context.Background(), 3, 1, events))
+	assert.Equal("Bearer token1", <-authorizations)
+	atomic.StoreInt32(&webhookStatus, 200)
+	assert.NoError(action.attemptBatch(context.Background(), 3, 2, events))
+	assert.Equal("Bearer token2", <-authorizations)
+
+	// changing the credentials requests a new token, and the webhook is not called without one
+	action.spec.OAuth2 = &webhookOAuth2Info{TokenURL: svr.URL + "/token", ClientID: "client1", ClientSecret: "wrong"}
+	err = action.attemptBatch(context.Background(), 4, 1, events)
+	assert.Regexp("Failed to obtain an OAuth2 token for the webhook.*status=401", err)
+	assert.Empty(authorizations)
+	assert.Equal(int32(2), atomic.LoadInt32(&issued))
+}
+
+func TestWebhookOAuth2Expiry(t *testing.T) {
+	assert := assert.New(t)
+	var issued int32
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&issued, 1)
+		fmt.Fprintf(res, `{"access_token":"token%d","token_type":"bearer","expires_in":10}`, n)
+	}))
+	defer svr.Close()
+
+	// a token that expires within the margin is replaced before it is used
+	cache := &oauth2TokenCache{}
+	spec := &webhookOAuth2Info{TokenURL: svr.URL, ClientID: "client1"}
+	token, err := cache.get(context.Background(), http.DefaultClient, spec)
+	assert.NoError(err)
+	assert.Equal("token1", token)
+	token, err = cache.get(context.Background(), http.DefaultClient, spec)
+	assert.NoError(err)
+	assert.Equal("token2", token)
+}
+
+func TestWebhookOAuth2BadToken(t *testing.T) {
+	assert := assert.New(t)
+	body := `{"access_token":"token1","token_type":"mac"}`
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(res, body)
+	}))
+	defer svr.Close()
+
+	cache := &oauth2TokenCache{}
+	spec := &webhookOAuth2Info{TokenURL: svr.URL, ClientID: "client1"}
+	_, err := cache.get(context.Background(), http.DefaultClient, spec)
+	assert.Regexp("no bearer token in the response", err)
+	body = `not json`
+	_, err = cache.get(context.Background(), http.DefaultClient, spec)
+	assert.Regexp("Failed to obtain an OAuth2 token", err)
+}
+
+func TestWebhookOAuth2Validation(t *testing.T) {
+	assert := assert.New(t)
+	err := validateWebhookConfig(&webhookActionInfo{URL: "http://test", OAuth2: &webhookOAuth2Info{TokenURL: "http://idp/token"}})
+	assert.Regexp("Must specify webhook.oauth2.clientId", err)
+	err = validateWebhookConfig(&webhookActionInfo{URL: "http://test", OAuth2: &webhookOAuth2Info{TokenURL: "idp/token", ClientID: "client1"}})
+	assert.Regexp("Invalid webhook.oauth2.tokenURL", err)
+	err = validateWebhookConfig(&webhookActionInfo{URL: "http://test", OAuth2: &webhookOAuth2Info{TokenURL: "https://idp/token", ClientID: "client1"}})
+	assert.NoError(err)
+
+	stream := newTestStream(&mockSubMgr{})
+	defer stream.stop()
+	_, err = stream.update(&StreamInfo{Webhook: &webhookActionInfo{OAuth2: &webhookOAuth2Info{TokenURL: "ftp://idp", ClientID: "client1"}}})
+	assert.Regexp("Invalid webhook.oauth2.tokenURL", err)
+	_, err = stream.update(&StreamInfo{Webhook: &webhookActionInfo{OAuth2: &webhookOAuth2Info{TokenURL: "https://idp/token", ClientID: "client1"}}})
+	assert.NoError(err)
+	assert.Equal("client1", stream.spec.Webhook.OAuth2.ClientID)
+}
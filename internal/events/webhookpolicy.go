@@ -0,0 +1,86 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+)
+
+// webhookPolicy restricts the hosts webhooks are sent to, and the addresses they resolve to. It
+// is checked when a stream is created, and again whenever a connection is dialed to deliver a
+// batch or follow a redirect, as DNS rebinding can point a host that was safe when the stream
+// was created at an internal address
+type webhookPolicy struct {
+	allowPrivateIPs bool
+	// host names, or "*." followed by a domain for any host in the domain. Empty allows any host
+	allowedHosts []string
+}
+
+type webhookDeliveryKey struct{}
+
+// webhookDelivery is carried in the context of a webhook request, so the policy is applied to
+// each connection dialed for it. The proxy the request is sent through, if any, is not checked
+type webhookDelivery struct {
+	policy    *webhookPolicy
+	proxyHost string
+}
+
+func withWebhookDelivery(ctx context.Context, policy *webhookPolicy, proxyHost string) context.Context {
+	return context.WithValue(ctx, webhookDeliveryKey{}, &webhookDelivery{policy: policy, proxyHost: proxyHost})
+}
+
+func getWebhookDelivery(ctx context.Context) *webhookDelivery {
+	d, _ := ctx.Value(webhookDeliveryKey{}).(*webhookDelivery)
+	return d
+}
+
+// checkHost checks the host is in the allow-list, when there is one
+func (p *webhookPolicy) checkHost(host string) error {
+	if len(p.allowedHosts) == 0 {
+		return nil
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, allowed := range p.allowedHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || (strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:])) {
+			return nil
+		}
+	}
+	return errors.Errorf(errors.EventStreamsWebhookHostNotAllowed, host)
+}
+
+// checkAddresses checks none of the addresses a host resolved to are prohibited
+func (p *webhookPolicy) checkAddresses(host string, ips []net.IP) error {
+	for _, ip := range ips {
+		if isAddressUnsafe(&net.IPAddr{IP: ip}, p.allowPrivateIPs) {
+			return errors.Errorf(errors.EventStreamsWebhookProhibitedAddress, host)
+		}
+	}
+	return nil
+}
+
+// check applies the whole policy to a host, and the addresses it resolved to
+func (p *webhookPolicy) check(host string, ips []net.IP) error {
+	if err := p.checkHost(host); err != nil {
+		return err
+	}
+	return p.checkAddresses(host, ips)
+}
@@ -0,0 +1,161 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookPolicyCheckHost(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &webhookPolicy{}
+	assert.NoError(p.checkHost("anything.example.com"))
+
+	p.allowedHosts = []string{"hooks.example.com", "*.Example.org"}
+	assert.NoError(p.checkHost("hooks.example.com"))
+	assert.NoError(p.checkHost("HOOKS.example.com."))
+	assert.NoError(p.checkHost("a.example.org"))
+	assert.NoError(p.checkHost("a.b.example.org"))
+	assert.Regexp("Cannot send Webhook POST to host 'example.org', which is not in the allowed hosts", p.checkHost("example.org"))
+	assert.Regexp("not in the allowed hosts", p.checkHost("evilexample.org"))
+	assert.Regexp("not in the allowed hosts", p.checkHost("other.example.com"))
+	assert.Regexp("not in the allowed hosts", p.checkHost("127.0.0.1"))
+}
+
+func TestWebhookPolicyCheckAddresses(t *testing.T) {
+	assert := assert.New(t)
+
+	p := &webhookPolicy{}
+	assert.NoError(p.check("hooks.example.com", []net.IP{net.ParseIP("8.8.8.8")}))
+	err := p.check("hooks.example.com", []net.IP{net.ParseIP("8.8.8.8"), net.ParseIP("10.0.0.1")})
+	assert.Regexp("Cannot send Webhook POST to address: hooks.example.com", err)
+
+	p.allowPrivateIPs = true
+	assert.NoError(p.check("hooks.example.com", []net.IP{net.ParseIP("10.0.0.1")}))
+	p.allowedHosts = []string{"other.example.com"}
+	assert.Regexp("not in the allowed hosts", p.check("hooks.example.com", []net.IP{net.ParseIP("8.8.8.8")}))
+}
+
+func TestWebhookDialRebinding(t *testing.T) {
+	assert := assert.New(t)
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(200)
+	}))
+	defer svr.Close()
+	_, port, _ := net.SplitHostPort(svr.Listener.Addr().String())
+
+	// the host was safe when it was checked, but has since been rebound to a loopback address
+	wc := newWebhookClients(&conf.WebhooksConf{})
+	wc.dns.resolver = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		return []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}}, nil
+	}
+	c, _ := wc.client(false, "", webhookClientCert{}, 5*time.Second)
+	post := func(ctx context.Context) error {
+		req, _ := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("http://webhook.example.com:%s/", port), nil)
+		res, err := c.Do(req)
+		if err == nil {
+			res.Body.Close()
+		}
+		return err
+	}
+
+	strict := &webhookPolicy{}
+	err := post(withWebhookDelivery(context.Background(), strict, ""))
+	assert.Regexp("Cannot send Webhook POST to address: webhook.example.com", err)
+
+	// the proxy a delivery is sent through is not subject to the policy
+	err = post(withWebhookDelivery(context.Background(), strict, "webhook.example.com"))
+	assert.NoError(err)
+
+	err = post(withWebhookDelivery(context.Background(), &webhookPolicy{allowPrivateIPs: true}, ""))
+	assert.NoError(err)
+}
+
+func TestWebhookRedirectChecked(t *testing.T) {
+	assert := assert.New(t)
+	target := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(200)
+	}))
+	defer target.Close()
+	_, targetPort, _ := net.SplitHostPort(target.Listener.Addr().String())
+	redirector := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		http.Redirect(res, req, fmt.Sprintf("http://internal.example.com:%s/", targetPort), http.StatusTemporaryRedirect)
+	}))
+	defer redirector.Close()
+	_, redirectorPort, _ := net.SplitHostPort(redirector.Listener.Addr().String())
+
+	wc := newWebhookClients(&conf.WebhooksConf{})
+	wc.dns.resolver = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		return []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}}, nil
+	}
+	c, _ := wc.client(false, "", webhookClientCert{}, 5*time.Second)
+	post := func(policy *webhookPolicy) error {
+		ctx := withWebhookDelivery(context.Background(), policy, "")
+		req, _ := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("http://hooks.example.com:%s/", redirectorPort), nil)
+		res, err := c.Do(req)
+		if err == nil {
+			res.Body.Close()
+		}
+		return err
+	}
+
+	err := post(&webhookPolicy{allowPrivateIPs: true, allowedHosts: []string{"hooks.example.com"}})
+	assert.Regexp("Cannot send Webhook POST to host 'internal.example.com'", err)
+	err = post(&webhookPolicy{allowPrivateIPs: true, allowedHosts: []string{"*.example.com"}})
+	assert.NoError(err)
+
+	// without a policy in the context, redirects are still limited
+	via := make([]*http.Request, 10)
+	req := httptest.NewRequest("GET", "http://hooks.example.com/", nil)
+	assert.Regexp("stopped after 10 redirects", checkWebhookRedirect(req, via))
+	assert.NoError(checkWebhookRedirect(req, nil))
+}
+
+func TestWebhookPolicyFromConfig(t *testing.T) {
+	assert := assert.New(t)
+	sm := newTestSubscriptionManager()
+	sm.config.Webhooks.AllowedHosts = []string{"hooks.example.com"}
+
+	p := sm.webhookPolicy()
+	assert.True(p.allowPrivateIPs)
+	assert.Equal([]string{"hooks.example.com"}, p.allowedHosts)
+
+	stream := &eventStream{sm: sm, spec: &StreamInfo{Type: EventStreamTypeWebhook, Suspended: &falseValue}}
+	assert.Equal([]string{"hooks.example.com"}, stream.webhookPolicy().allowedHosts)
+
+	_, restErr := sm.AddStream(nil, httptest.NewRequest("POST", "/eventstreams", strings.NewReader(`{"type":"webhook","webhook":{"url":"http://other.example.com"}}`)), nil)
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp("not in the allowed hosts", restErr.Error)
+
+	_, err := stream.update(&StreamInfo{Webhook: &webhookActionInfo{URL: "http://other.example.com"}})
+	assert.Regexp("not in the allowed hosts", err)
+
+	// replacing the whole spec checks the host the same way
+	_, err = stream.replace(&StreamInfo{Type: EventStreamTypeWebhook, Suspended: &falseValue, Webhook: &webhookActionInfo{URL: "http://other.example.com"}})
+	assert.Regexp("not in the allowed hosts", err)
+}
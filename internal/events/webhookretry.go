@@ -0,0 +1,122 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+)
+
+const (
+	// WebhookRetryPolicyRetry retries a batch that failed with the status, honoring any Retry-After header
+	WebhookRetryPolicyRetry = "retry"
+	// WebhookRetryPolicyFail fails a batch that failed with the status straight to the error handling of the stream
+	WebhookRetryPolicyFail = "fail"
+)
+
+// deliveryError is returned by an action for a failed batch when it knows more about the failure
+// than that it failed, such as that retrying cannot succeed, or that the endpoint asked to be
+// retried no sooner than a given time
+type deliveryError struct {
+	err        error
+	permanent  bool
+	retryAfter time.Duration
+}
+
+func (e *deliveryError) Error() string {
+	return e.err.Error()
+}
+
+// retryAfterOf returns how long the endpoint asked to wait before a batch is retried, if it did
+func retryAfterOf(err error) time.Duration {
+	if de, ok := err.(*deliveryError); ok {
+		return de.retryAfter
+	}
+	return 0
+}
+
+func isPermanentDeliveryError(err error) bool {
+	de, ok := err.(*deliveryError)
+	return ok && de.permanent
+}
+
+// validateWebhookRetryPolicy checks each key is a status code such as "503", or a class of
+// codes such as "5xx", and each value is "retry" or "fail"
+func validateWebhookRetryPolicy(policy map[string]string) error {
+	for status, action := range policy {
+		if !validRetryPolicyStatus(status) || (strings.ToLower(action) != WebhookRetryPolicyRetry && strings.ToLower(action) != WebhookRetryPolicyFail) {
+			return errors.Errorf(errors.EventStreamsWebhookInvalidRetryPolicy, status, action)
+		}
+	}
+	return nil
+}
+
+func validRetryPolicyStatus(status string) bool {
+	if len(status) != 3 || status[0] < '1' || status[0] > '5' {
+		return false
+	}
+	if strings.EqualFold(status[1:], "xx") {
+		return true
+	}
+	_, err := strconv.Atoi(status)
+	return err == nil
+}
+
+// retryPolicyAction returns what the policy says to do for a status. An exact code takes
+// precedence over its class, and statuses that are in neither are retried
+func retryPolicyAction(policy map[string]string, status int) string {
+	code := strconv.Itoa(status)
+	if action, ok := policy[code]; ok {
+		return strings.ToLower(action)
+	}
+	for key, action := range policy {
+		if strings.EqualFold(key, code[:1]+"xx") {
+			return strings.ToLower(action)
+		}
+	}
+	return WebhookRetryPolicyRetry
+}
+
+// parseRetryAfter reads a Retry-After header, in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseUint(strings.TrimSpace(value), 10, 32); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// statusError classifies the failure of a webhook request with a non-2xx status by the retry
+// policy of the webhook
+func (w *webhookAction) statusError(err error, res *http.Response) error {
+	if retryPolicyAction(w.spec.RetryPolicy, res.StatusCode) == WebhookRetryPolicyFail {
+		return &deliveryError{err: err, permanent: true}
+	}
+	if retryAfter := parseRetryAfter(res.Header.Get("Retry-After"), time.Now()); retryAfter > 0 {
+		return &deliveryError{err: err, retryAfter: retryAfter}
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	eventsapi "github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookRetryPolicyValidation(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(validateWebhookRetryPolicy(nil))
+	assert.NoError(validateWebhookRetryPolicy(map[string]string{"429": "retry", "503": "RETRY", "4xx": "fail", "5XX": "retry"}))
+	assert.Regexp("Invalid webhook.retryPolicy entry '42': 'fail'", validateWebhookRetryPolicy(map[string]string{"42": "fail"}))
+	assert.Regexp("Invalid webhook.retryPolicy entry '6xx'", validateWebhookRetryPolicy(map[string]string{"6xx": "fail"}))
+	assert.Regexp("Invalid webhook.retryPolicy entry '4x1'", validateWebhookRetryPolicy(map[string]string{"4x1": "fail"}))
+	assert.Regexp("Invalid webhook.retryPolicy entry '400': 'skip'", validateWebhookRetryPolicy(map[string]string{"400": "skip"}))
+	assert.Regexp("Invalid webhook.retryPolicy", validateWebhookConfig(&webhookActionInfo{URL: "http://test", RetryPolicy: map[string]string{"abc": "fail"}}))
+
+	policy := map[string]string{"4xx": "fail", "429": "retry"}
+	assert.Equal(WebhookRetryPolicyFail, retryPolicyAction(policy, 400))
+	assert.Equal(WebhookRetryPolicyRetry, retryPolicyAction(policy, 429))
+	assert.Equal(WebhookRetryPolicyRetry, retryPolicyAction(policy, 503))
+	assert.Equal(WebhookRetryPolicyRetry, retryPolicyAction(nil, 400))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now()
+
+	assert.Equal(time.Duration(0), parseRetryAfter("", now))
+	assert.Equal(120*time.Second, parseRetryAfter("120", now))
+	assert.Equal(time.Duration(0), parseRetryAfter("soon", now))
+	assert.Equal(30*time.Second, parseRetryAfter(now.Add(30*time.Second).UTC().Format(http.TimeFormat), now.Truncate(time.Second)))
+	assert.Equal(time.Duration(0), parseRetryAfter(now.Add(-time.Minute).UTC().Format(http.TimeFormat), now))
+}
+
+func TestWebhookRetryPolicy(t *testing.T) {
+	assert := assert.New(t)
+	var attempts int32
+	status := int32(422)
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		res.Header().Set("Retry-After", "60")
+		res.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer svr.Close()
+
+	suspended := false
+	es := &eventStream{
+		sm:                &mockSubMgr{},
+		allowPrivateIPs:   true,
+		initialRetryDelay: time.Millisecond,
+		backoffFactor:     1,
+		spec:              &StreamInfo{ID: "es-1", Type: EventStreamTypeWebhook, RetryTimeoutSec: 1, Suspended: &suspended},
+	}
+	action, err := newWebhookAction(es, &webhookActionInfo{URL: svr.URL, RetryPolicy: map[string]string{"4xx": "fail", "429": "retry"}})
+	assert.NoError(err)
+	es.action = action
+	events := []*eventsapi.EventEntry{{SubID: "sb-1"}}
+
+	// a status that fails is not retried, and its Retry-After is ignored
+	err = es.performActionWithRetry(context.Background(), 1, events)
+	assert.Regexp("422", err)
+	assert.True(isPermanentDeliveryError(err))
+	assert.Equal(time.Duration(0), retryAfterOf(err))
+	assert.Equal(int32(1), atomic.LoadInt32(&attempts))
+
+	// a status that is retried honors Retry-After, so the batch fails when that is past the retry timeout
+	atomic.StoreInt32(&status, 429)
+	err = es.performActionWithRetry(context.Background(), 2, events)
+	assert.Regexp("429", err)
+	assert.False(isPermanentDeliveryError(err))
+	assert.Equal(60*time.Second, retryAfterOf(err))
+	assert.Equal(int32(2), atomic.LoadInt32(&attempts))
+}
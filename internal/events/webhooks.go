@@ -18,12 +18,20 @@ package events
 
 import (
 	"bytes"
-	"crypto/tls"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/hyperledger/firefly-fabconnect/internal/errors"
@@ -32,9 +40,42 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	// DefaultWebhookSignatureHeader is the header the HMAC signature of the body of a webhook request is set in
+	DefaultWebhookSignatureHeader = "X-Fabconnect-Signature"
+	// WebhookChunkHeader is set to "<chunk>/<chunks>" on each request of a batch split into chunks
+	WebhookChunkHeader = "X-Fabconnect-Batch-Chunk"
+	// WebhookStreamHeader is set to the ID of the stream on each webhook request of a batch
+	WebhookStreamHeader = "X-Fabconnect-Stream-Id"
+	// WebhookBatchNumberHeader is set to the number of the batch, which is the same on each attempt to deliver it
+	WebhookBatchNumberHeader = "X-Fabconnect-Batch-Number"
+	// WebhookFirstBlockHeader and WebhookLastBlockHeader are set to the block numbers of the first and last events in the request
+	WebhookFirstBlockHeader = "X-Fabconnect-Batch-First-Block"
+	WebhookLastBlockHeader  = "X-Fabconnect-Batch-Last-Block"
+	// WebhookEventCountHeader is set to the number of events in the request
+	WebhookEventCountHeader = "X-Fabconnect-Batch-Event-Count"
+	// WebhookAttemptHeader is set to the attempt number of the delivery of the batch, starting at 1
+	WebhookAttemptHeader = "X-Fabconnect-Attempt"
+	// WebhookCompressionGzip compresses the body of each webhook request with gzip
+	WebhookCompressionGzip = "gzip"
+)
+
 type webhookAction struct {
-	es   *eventStream
-	spec *webhookActionInfo
+	es     *eventStream
+	spec   *webhookActionInfo
+	tokens oauth2TokenCache
+	// the most recent responses of the webhook
+	deliveries *webhookDeliveries
+	// the chunks of the batches delivered before one failed, which are not sent again when the
+	// batch is retried, by batch number as a stream with a concurrency retries several at once
+	resumeMux    sync.Mutex
+	resumeChunks map[uint64]webhookResumePoint
+}
+
+// webhookResumePoint is the first chunk of a batch that has not been delivered, of its chunks
+type webhookResumePoint struct {
+	from int
+	of   int
 }
 
 func validateWebhookConfig(spec *webhookActionInfo) error {
@@ -44,79 +85,414 @@ func validateWebhookConfig(spec *webhookActionInfo) error {
 	if _, err := url.Parse(spec.URL); err != nil {
 		return errors.Errorf(errors.EventStreamsWebhookInvalidURL)
 	}
+	if spec.ProxyURL != "" {
+		if _, err := parseProxyURL(spec.ProxyURL); err != nil {
+			return err
+		}
+	}
+	if _, err := spec.clientCert().load(); err != nil {
+		return err
+	}
+	if spec.OAuth2 != nil {
+		if err := validateWebhookOAuth2(spec.OAuth2); err != nil {
+			return err
+		}
+	}
+	if err := validateWebhookRetryPolicy(spec.RetryPolicy); err != nil {
+		return err
+	}
+	if err := validateWebhookCircuitBreaker(spec.CircuitBreaker); err != nil {
+		return err
+	}
+	return validateWebhookCompression(spec.Compression)
+}
+
+func validateWebhookCompression(compression string) error {
+	if compression != "" && strings.ToLower(compression) != WebhookCompressionGzip {
+		return errors.Errorf(errors.EventStreamsWebhookInvalidCompression, compression)
+	}
 	return nil
 }
 
-func newWebhookAction(es *eventStream, spec *webhookActionInfo) (*webhookAction, error) {
+// resolveWebhookCompression applies the compressed shorthand, when the compression is not set
+func resolveWebhookCompression(compression string, compressed *bool) string {
+	if compression == "" && compressed != nil && *compressed {
+		return WebhookCompressionGzip
+	}
+	return strings.ToLower(compression)
+}
+
+// compresses checks whether a body is compressed before it is sent
+func (spec *webhookActionInfo) compresses(body []byte) bool {
+	return spec.Compression == WebhookCompressionGzip && len(body) >= int(spec.CompressionThresholdBytes)
+}
+
+func (spec *webhookActionInfo) clientCert() webhookClientCert {
+	return webhookClientCert{cert: spec.TLSClientCert, key: spec.TLSClientKey}
+}
+
+// redactWebhookConfig returns a copy of the settings with the signing secrets, the client key
+// and the OAuth2 client secret redacted
+func redactWebhookConfig(spec *webhookActionInfo) *webhookActionInfo {
+	if spec == nil {
+		return nil
+	}
+	redacted := *spec
+	redacted.Secret = redactSecret(spec.Secret)
+	redacted.PreviousSecret = redactSecret(spec.PreviousSecret)
+	redacted.TLSClientKey = redactSecret(spec.TLSClientKey)
+	if spec.OAuth2 != nil {
+		oauth2 := *spec.OAuth2
+		oauth2.ClientSecret = redactSecret(oauth2.ClientSecret)
+		redacted.OAuth2 = &oauth2
+	}
+	return &redacted
+}
+
+// restoreWebhookSecrets sets the redacted secrets of an update back to the existing ones
+func restoreWebhookSecrets(spec, existing *webhookActionInfo) {
+	if spec == nil {
+		return
+	}
+	if existing == nil {
+		existing = &webhookActionInfo{}
+	}
+	restoreSecret(&spec.Secret, existing.Secret)
+	restoreSecret(&spec.PreviousSecret, existing.PreviousSecret)
+	restoreSecret(&spec.TLSClientKey, existing.TLSClientKey)
+	if spec.OAuth2 != nil {
+		existingSecret := ""
+		if existing.OAuth2 != nil {
+			existingSecret = existing.OAuth2.ClientSecret
+		}
+		restoreSecret(&spec.OAuth2.ClientSecret, existingSecret)
+	}
+}
+
+func setWebhookDefaults(spec *webhookActionInfo) {
 	if spec.RequestTimeoutSec == 0 {
 		spec.RequestTimeoutSec = 120
 	}
 	if spec.TLSkipHostVerify == nil {
 		spec.TLSkipHostVerify = &falseValue
 	}
+	spec.Compression = resolveWebhookCompression(spec.Compression, spec.Compressed)
+	spec.Compressed = nil
+	setCircuitBreakerDefaults(spec.CircuitBreaker)
+}
+
+// addSubscriptionHeaders merges the headers of the subscriptions with events in a batch into
+// the request. They do not override the headers of the stream, and when the subscriptions in
+// the batch have different values for a header, each of the values is added
+func addSubscriptionHeaders(header http.Header, streamHeaders map[string]string, events []*api.EventEntry) {
+	reserved := map[string]bool{"Content-Type": true}
+	for h := range streamHeaders {
+		reserved[http.CanonicalHeaderKey(h)] = true
+	}
+	for _, event := range events {
+		for h, v := range event.Headers {
+			h = http.CanonicalHeaderKey(h)
+			if !reserved[h] && !containsString(header.Values(h), v) {
+				header.Add(h, v)
+			}
+		}
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// signWebhookBody returns the HMAC-SHA256 signature of the body, as "sha256=<hex>"
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// signature signs the body with the secret and, for the overlap after a rotation, with the previous
+// secret too. The signatures are comma separated, the one of the current secret first
+func (w *webhookAction) signature(body []byte) string {
+	signature := signWebhookBody(w.spec.Secret, body)
+	if w.spec.PreviousSecret != "" {
+		if expiry, err := time.Parse(time.RFC3339, w.spec.PreviousSecretExpiry); err == nil && time.Now().Before(expiry) {
+			signature += "," + signWebhookBody(w.spec.PreviousSecret, body)
+		}
+	}
+	return signature
+}
+
+func (w *webhookAction) signatureHeader() string {
+	if w.spec.SignatureHeader != "" {
+		return w.spec.SignatureHeader
+	}
+	return DefaultWebhookSignatureHeader
+}
+
+func newWebhookAction(es *eventStream, spec *webhookActionInfo) (*webhookAction, error) {
+	setWebhookDefaults(spec)
 	return &webhookAction{
-		es:   es,
-		spec: spec,
+		es:         es,
+		spec:       spec,
+		deliveries: newWebhookDeliveries(es.sm.getConfig().Webhooks.DeliveryHistory),
 	}, nil
 }
 
-// attemptWebhookAction performs a single attempt of a webhook action
-func (w *webhookAction) attemptBatch(_, attempt uint64, events []*api.EventEntry) error {
-	// We perform DNS resolution before each attempt, to exclude private IP address ranges from the target
+// attemptWebhookAction performs a single attempt of a webhook action. A batch larger than the
+// request limit of the webhook is sent in chunks, in order, and only succeeds when every chunk
+// has been delivered
+func (w *webhookAction) attemptBatch(ctx context.Context, batchNumber, attempt uint64, events []*api.EventEntry) error {
+	contentType := "application/json"
+	var envelopes []*cloudEvent
+	if w.es.spec.Format == EventFormatCloudEvents {
+		envelopes = toCloudEvents(events)
+		contentType = cloudEventsBatchContentType
+	}
+	items := make([]json.RawMessage, len(events))
+	for i, event := range events {
+		var item interface{} = event
+		if envelopes != nil {
+			item = envelopes[i]
+		}
+		b, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		items[i] = b
+	}
+	if w.es.spec.BatchSizeStream && len(items) == 1 {
+		// streams delivering each event on its own send the event, rather than an array of them
+		if envelopes != nil {
+			contentType = cloudEventsContentType
+		}
+		return w.post(ctx, attempt, items[0], contentType, events, w.batchHeader(batchNumber, attempt, events))
+	}
+	chunks := chunkWebhookItems(items, int(w.spec.MaxRequestBytes))
+	if len(chunks) == 1 {
+		return w.post(ctx, attempt, joinWebhookItems(items), contentType, events, w.batchHeader(batchNumber, attempt, events))
+	}
+
+	from := w.resumeChunk(batchNumber, len(chunks))
+	offset := 0
+	for i, chunk := range chunks {
+		chunkEvents := events[offset : offset+len(chunk)]
+		offset += len(chunk)
+		if i < from {
+			continue
+		}
+		if len(chunk) == 1 && len(chunk[0])+2 > int(w.spec.MaxRequestBytes) {
+			log.Warnf("%s: Event in block %d of batch %d is larger than the request limit of %d bytes, and is sent on its own", w.es.spec.ID, chunkEvents[0].BlockNumber, batchNumber, w.spec.MaxRequestBytes)
+		}
+		header := w.batchHeader(batchNumber, attempt, chunkEvents)
+		header.Set(WebhookChunkHeader, fmt.Sprintf("%d/%d", i+1, len(chunks)))
+		if err := w.post(ctx, attempt, joinWebhookItems(chunk), contentType, chunkEvents, header); err != nil {
+			w.setResumeChunk(batchNumber, i, len(chunks))
+			return err
+		}
+	}
+	return nil
+}
+
+// batchHeader returns the headers describing the events of a request of a batch, so the
+// endpoint can detect redelivered batches and monitor the stream without parsing the body
+func (w *webhookAction) batchHeader(batchNumber, attempt uint64, events []*api.EventEntry) http.Header {
+	header := http.Header{}
+	header.Set(WebhookStreamHeader, w.es.spec.ID)
+	header.Set(WebhookBatchNumberHeader, strconv.FormatUint(batchNumber, 10))
+	header.Set(WebhookAttemptHeader, strconv.FormatUint(attempt, 10))
+	header.Set(WebhookEventCountHeader, strconv.Itoa(len(events)))
+	if len(events) > 0 {
+		header.Set(WebhookFirstBlockHeader, strconv.FormatUint(events[0].BlockNumber, 10))
+		header.Set(WebhookLastBlockHeader, strconv.FormatUint(events[len(events)-1].BlockNumber, 10))
+	}
+	return header
+}
+
+// chunkWebhookItems splits the JSON items of a batch into consecutive chunks, each as large as
+// it can be while its JSON array is within the limit. There is one chunk when there is no limit
+func chunkWebhookItems(items []json.RawMessage, maxBytes int) [][]json.RawMessage {
+	if maxBytes <= 0 {
+		return [][]json.RawMessage{items}
+	}
+	var chunks [][]json.RawMessage
+	start, size := 0, 2 // the brackets of the array
+	for i, item := range items {
+		if i > start && size+1+len(item) > maxBytes {
+			chunks = append(chunks, items[start:i])
+			start, size = i, 2
+		}
+		if i > start {
+			size++ // the comma
+		}
+		size += len(item)
+	}
+	return append(chunks, items[start:])
+}
+
+func joinWebhookItems(items []json.RawMessage) []byte {
+	b := []byte{'['}
+	for i, item := range items {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, item...)
+	}
+	return append(b, ']')
+}
+
+// resumeChunk returns the first chunk of a batch that has not been delivered, which is only
+// returned once, as the attempt sets it again if it fails. Chunks are only skipped when the
+// batch is retried with the same chunks as the attempt that failed
+func (w *webhookAction) resumeChunk(batchNumber uint64, chunks int) int {
+	w.resumeMux.Lock()
+	defer w.resumeMux.Unlock()
+	resume, ok := w.resumeChunks[batchNumber]
+	delete(w.resumeChunks, batchNumber)
+	if ok && resume.of == chunks {
+		return resume.from
+	}
+	return 0
+}
+
+func (w *webhookAction) setResumeChunk(batchNumber uint64, from, chunks int) {
+	w.resumeMux.Lock()
+	defer w.resumeMux.Unlock()
+	if w.resumeChunks == nil {
+		w.resumeChunks = make(map[uint64]webhookResumePoint)
+	}
+	w.resumeChunks[batchNumber] = webhookResumePoint{from: from, of: chunks}
+	// batches that were skipped after they failed are not retried, and no more batches than the
+	// stream delivers in parallel can be retried at once, so the oldest are forgotten
+	for len(w.resumeChunks) > MaxConcurrency {
+		oldest := batchNumber
+		for n := range w.resumeChunks {
+			if n < oldest {
+				oldest = n
+			}
+		}
+		delete(w.resumeChunks, oldest)
+	}
+}
+
+// compressWebhookBody returns the body compressed with gzip
+func compressWebhookBody(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// deliveryClient returns the client for a request to the webhook, with a context that applies the
+// address policy of the stream to every connection it dials
+func (w *webhookAction) deliveryClient(ctx context.Context, u *url.URL) (context.Context, *http.Client, []net.IP, error) {
+	// We perform DNS resolution before each attempt, to exclude private IP address ranges from the target.
+	// The resolution is cached for a short time, and shared with the dialer of the transport, which
+	// checks the policy again for every connection it dials for the request
+	clients := w.es.sm.getWebhookClients()
+	policy := w.es.webhookPolicy()
+	ips, err := clients.lookupIPv4(ctx, u.Hostname())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := policy.check(u.Hostname(), ips); err != nil {
+		log.Errorf(err.Error())
+		return nil, nil, nil, err
+	}
+	proxy, err := clients.proxyFor(u, w.spec.ProxyURL)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	proxyHost := ""
+	if proxy != nil {
+		proxyHost = proxy.Hostname()
+	}
+	ctx = withWebhookDelivery(ctx, policy, proxyHost)
+	netClient, err := clients.client(*w.spec.TLSkipHostVerify, w.spec.ProxyURL, w.spec.clientCert(), time.Duration(w.spec.RequestTimeoutSec)*time.Second)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return ctx, netClient, ips, nil
+}
+
+// post sends a body to the webhook, with the headers of the stream and of the subscriptions of the events.
+// The body is compressed first when the webhook is configured for it, so the signature is of the compressed body
+func (w *webhookAction) post(ctx context.Context, attempt uint64, reqBytes []byte, contentType string, events []*api.EventEntry, header http.Header) error {
 	esID := w.es.spec.ID
 	u, _ := url.Parse(w.spec.URL)
-	addr, err := net.ResolveIPAddr("ip4", u.Hostname())
+	ctx, netClient, ips, err := w.deliveryClient(ctx, u)
 	if err != nil {
 		return err
 	}
-	if w.es.isAddressUnsafe(addr) {
-		err := errors.Errorf(errors.EventStreamsWebhookProhibitedAddress, u.Hostname())
-		log.Errorf(err.Error())
-		return err
+	compressed := w.spec.compresses(reqBytes)
+	if compressed {
+		if reqBytes, err = compressWebhookBody(reqBytes); err != nil {
+			return err
+		}
 	}
-	// Set the timeout
-	var transport = &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-			DualStack: true,
-		}).DialContext,
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
-	}
-	// #nosec G402
-	transport.TLSClientConfig = &tls.Config{
-		InsecureSkipVerify: *w.spec.TLSkipHostVerify,
-	}
-	netClient := &http.Client{
-		Timeout:   time.Duration(w.spec.RequestTimeoutSec) * time.Second,
-		Transport: transport,
-	}
-	log.Infof("%s: POST --> %s [%s] (attempt=%d)", esID, u.String(), addr.String(), attempt)
-	reqBytes, err := json.Marshal(&events)
+	log.Infof("%s: POST --> %s [%s] bytes=%d (attempt=%d)", esID, u.String(), ips[0].String(), len(reqBytes), attempt)
 	var req *http.Request
+	accessToken := ""
+	if w.spec.OAuth2 != nil {
+		// the token endpoint is reached through the same transport and policy as the webhook
+		accessToken, err = w.tokens.get(ctx, netClient, w.spec.OAuth2)
+	}
 	if err == nil {
-		req, err = http.NewRequest("POST", u.String(), bytes.NewReader(reqBytes))
+		req, err = http.NewRequestWithContext(ctx, "POST", u.String(), bytes.NewReader(reqBytes))
 	}
 	if err == nil {
 		var res *http.Response
-		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Type", contentType)
 		for h, v := range w.spec.Headers {
 			req.Header.Set(h, v)
 		}
+		addSubscriptionHeaders(req.Header, w.spec.Headers, events)
+		for h, v := range header {
+			req.Header[h] = v
+		}
+		if compressed {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		if accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+		if w.spec.Secret != "" {
+			req.Header.Set(w.signatureHeader(), w.signature(reqBytes))
+		}
+		startTime := time.Now()
 		res, err = netClient.Do(req)
-		if err == nil {
+		latency := time.Since(startTime)
+		if err != nil {
+			w.deliveries.record(attempt, 0, nil, latency, err)
+		} else {
+			defer res.Body.Close()
 			ok := (res.StatusCode >= 200 && res.StatusCode < 300)
 			log.Infof("%s: POST <-- %s [%d] ok=%t", esID, u.String(), res.StatusCode, ok)
+			var bodyBytes []byte
 			if !ok || log.IsLevelEnabled(log.DebugLevel) {
-				bodyBytes, _ := io.ReadAll(res.Body)
+				bodyBytes, _ = io.ReadAll(res.Body)
 				log.Infof("%s: Response body: %s", esID, string(bodyBytes))
+			} else {
+				// keep the start of the body for the deliveries, and drain the rest so the connection can be reused
+				bodyBytes, _ = io.ReadAll(io.LimitReader(res.Body, webhookDeliveryBodyLimit+1))
+				_, _ = io.Copy(io.Discard, res.Body)
 			}
+			w.deliveries.record(attempt, res.StatusCode, bodyBytes, latency, nil)
 			if !ok {
-				err = errors.Errorf(errors.EventStreamsWebhookFailedHTTPStatus, esID, res.StatusCode)
+				err = w.statusError(errors.Errorf(errors.EventStreamsWebhookFailedHTTPStatus, esID, res.StatusCode), res)
+			}
+			if res.StatusCode == http.StatusUnauthorized && accessToken != "" {
+				// the token may have been revoked before it expired, so the retry requests a new one
+				w.tokens.invalidate(accessToken)
 			}
 		}
 	}
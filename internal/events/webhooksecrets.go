@@ -0,0 +1,128 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	restutil "github.com/hyperledger/firefly-fabconnect/internal/rest/utils"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultSecretOverlapSec is how long the previous secret of a webhook stream keeps signing
+	// requests after a rotation, by default
+	DefaultSecretOverlapSec = 3600
+	// generatedSecretBytes is the number of random bytes of the secrets generated by a rotation
+	generatedSecretBytes = 32
+)
+
+// secretRotationRequest is the optional body of the rotation API
+type secretRotationRequest struct {
+	Secret     string  `json:"secret,omitempty"` // generated when not set
+	OverlapSec *uint32 `json:"overlapSec,omitempty"`
+}
+
+// SecretRotation is the outcome of rotating the signing secret of a webhook stream. The secret
+// is only returned when it was generated, as it cannot be read back from the stream
+type SecretRotation struct {
+	ID                   string `json:"id"`
+	Secret               string `json:"secret,omitempty"`
+	PreviousSecretExpiry string `json:"previousSecretExpiry,omitempty"`
+}
+
+// RotateStreamSecret replaces the secret the requests of a webhook stream are signed with. Until the
+// overlap has passed, the requests are signed with both the new and the previous secret, so that the
+// endpoint can roll over to the new secret without failing to verify any delivery
+func (s *subscriptionMGR) RotateStreamSecret(_ http.ResponseWriter, req *http.Request, params httprouter.Params) (*SecretRotation, *restutil.RestError) {
+	streamID := params.ByName("streamId")
+	stream, err := s.streamByID(streamID)
+	if err != nil {
+		return nil, restutil.NewRestError(err.Error(), 404)
+	}
+	var body secretRotationRequest
+	if req.Body != nil {
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil && err != io.EOF {
+			return nil, restutil.NewRestError(fmt.Sprintf(errors.RESTGatewayEventStreamInvalid, err), 400)
+		}
+	}
+	if _, ok := stream.action.(*webhookAction); !ok {
+		return nil, restutil.NewRestError(errors.Errorf(errors.EventStreamsSecretNotWebhook, streamID).Error(), 400)
+	}
+	generated := body.Secret == ""
+	if generated {
+		b := make([]byte, generatedSecretBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, restutil.NewRestError(err.Error(), 500)
+		}
+		body.Secret = hex.EncodeToString(b)
+	}
+	overlap := time.Duration(DefaultSecretOverlapSec) * time.Second
+	if body.OverlapSec != nil {
+		overlap = time.Duration(*body.OverlapSec) * time.Second
+	}
+
+	s.changeMux.Lock()
+	defer s.changeMux.Unlock()
+	if restErr := s.checkIfMatch(req, stream.spec.ResourceVersion); restErr != nil {
+		return nil, restErr
+	}
+	before := specSnapshot(stream.spec.redacted())
+	if err := stream.rotateSecret(body.Secret, overlap); err != nil {
+		return nil, restutil.NewRestError(err.Error(), 500)
+	}
+	if err := s.storeStream(stream.spec); err != nil {
+		return nil, restutil.NewRestError(err.Error(), 500)
+	}
+	s.publishLifecycleEvent(StreamUpdated, streamID, before, specSnapshot(stream.spec.redacted()), nil)
+	rotation := &SecretRotation{
+		ID:                   streamID,
+		PreviousSecretExpiry: stream.spec.Webhook.PreviousSecretExpiry,
+	}
+	if generated {
+		rotation.Secret = body.Secret
+	}
+	return rotation, nil
+}
+
+// rotateSecret sets the new secret of the webhook while no batch is in flight. The previous secret is
+// kept for the overlap, unless there was none or the overlap is zero
+func (a *eventStream) rotateSecret(secret string, overlap time.Duration) error {
+	if err := a.preUpdateStream(); err != nil {
+		return err
+	}
+	defer a.postUpdateStream()
+	webhook := a.spec.Webhook
+	if webhook.Secret != "" && overlap > 0 {
+		webhook.PreviousSecret = webhook.Secret
+		webhook.PreviousSecretExpiry = time.Now().Add(overlap).UTC().Format(time.RFC3339)
+	} else {
+		webhook.PreviousSecret = ""
+		webhook.PreviousSecretExpiry = ""
+	}
+	webhook.Secret = secret
+	log.Infof("%s: Rotated the webhook secret, with the previous secret valid until '%s'", a.spec.ID, webhook.PreviousSecretExpiry)
+	return nil
+}
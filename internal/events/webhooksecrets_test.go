@@ -0,0 +1,88 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package events
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotateStreamSecret(t *testing.T) {
+	assert := assert.New(t)
+	sm, stream, svr, batches := newTestStreamForBatching(
+		&StreamInfo{
+			Webhook: &webhookActionInfo{Secret: "secret1"},
+		}, nil, 200)
+	defer svr.Close()
+	defer close(batches)
+	defer stream.stop()
+	params := httprouter.Params{{Key: "streamId", Value: stream.spec.ID}}
+	rotate := func(body string) (*SecretRotation, int) {
+		req := httptest.NewRequest("POST", "/eventstreams/"+stream.spec.ID+"/rotatesecret", strings.NewReader(body))
+		result, restErr := sm.RotateStreamSecret(nil, req, params)
+		if restErr != nil {
+			return nil, restErr.StatusCode
+		}
+		return result, 200
+	}
+	action := stream.action.(*webhookAction)
+	body := []byte(`[{"eventName":"AssetCreated"}]`)
+
+	result, status := rotate(`{"secret":"secret2","overlapSec":60}`)
+	assert.Equal(200, status)
+	// a secret given by the caller is not echoed back
+	assert.Empty(result.Secret)
+	assert.Equal("secret2", stream.spec.Webhook.Secret)
+	assert.Equal("secret1", stream.spec.Webhook.PreviousSecret)
+	expiry, err := time.Parse(time.RFC3339, result.PreviousSecretExpiry)
+	assert.NoError(err)
+	assert.WithinDuration(time.Now().Add(60*time.Second), expiry, 5*time.Second)
+	assert.Equal(signWebhookBody("secret2", body)+","+signWebhookBody("secret1", body), action.signature(body))
+
+	// the previous secret stops signing once it expires
+	stream.spec.Webhook.PreviousSecretExpiry = time.Now().Add(-time.Second).UTC().Format(time.RFC3339)
+	assert.Equal(signWebhookBody("secret2", body), action.signature(body))
+
+	// a secret is generated when none is given
+	result, status = rotate("")
+	assert.Equal(200, status)
+	assert.Regexp("^[0-9a-f]{64}$", result.Secret)
+	assert.Equal("secret2", stream.spec.Webhook.PreviousSecret)
+	assert.NotEmpty(result.PreviousSecretExpiry)
+
+	// without an overlap, the previous secret stops signing immediately
+	result, status = rotate(`{"secret":"secret3","overlapSec":0}`)
+	assert.Equal(200, status)
+	assert.Empty(result.PreviousSecretExpiry)
+	assert.Empty(stream.spec.Webhook.PreviousSecret)
+	assert.Equal(signWebhookBody("secret3", body), action.signature(body))
+
+	_, status = rotate(`{"secret":`)
+	assert.Equal(400, status)
+
+	_, restErr := sm.RotateStreamSecret(nil, httptest.NewRequest("POST", "/eventstreams/es-2/rotatesecret", nil), httprouter.Params{{Key: "streamId", Value: "es-2"}})
+	assert.Equal(404, restErr.StatusCode)
+	sm.streams["es-2"] = &eventStream{spec: &StreamInfo{ID: "es-2", Type: EventStreamTypeKafka}, action: &kafkaAction{}}
+	_, restErr = sm.RotateStreamSecret(nil, httptest.NewRequest("POST", "/eventstreams/es-2/rotatesecret", nil), httprouter.Params{{Key: "streamId", Value: "es-2"}})
+	assert.Equal(400, restErr.StatusCode)
+	assert.Regexp("Event stream es-2 is not a webhook stream", restErr.Error)
+}
@@ -17,10 +17,12 @@
 package events
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/hyperledger/firefly-fabconnect/internal/errors"
 	"github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/hyperledger/firefly-fabconnect/internal/ws"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -48,17 +50,36 @@ func validateWebsocketConfig(spec *webSocketActionInfo) error {
 	if spec.Topic == "" {
 		return fmt.Errorf("missing required parameter 'websocket.topic'")
 	}
+	if spec.Topic == ws.SystemTopic {
+		return errors.Errorf(errors.EventStreamsWebSocketReservedTopic, spec.Topic)
+	}
 	sd := spec.DistributionMode
 	if sd != "" && sd != DistributionModeBroadcast && sd != DistributionModeWLD {
 		return errors.Errorf(errors.EventStreamsInvalidDistributionMode, sd)
 	}
+	if spec.ConsumerGroup != "" && sd == DistributionModeBroadcast {
+		return errors.Errorf(errors.EventStreamsConsumerGroupBroadcast)
+	}
 	return nil
 }
 
 // attemptBatch attempts to deliver a batch over socket IO
-func (w *webSocketAction) attemptBatch(batchNumber, _ uint64, events []*api.EventEntry) error {
+func (w *webSocketAction) attemptBatch(ctx context.Context, batchNumber, _ uint64, events []*api.EventEntry) error {
 	var err error
 
+	consumerGroup := w.spec.ConsumerGroup
+	if consumerGroup != "" && w.spec.DistributionMode != DistributionModeBroadcast {
+		// Events the consumer group has already committed are redelivered when the stream restarts
+		// from the block of its checkpoint, and are not sent again
+		if events, err = w.uncommittedEvents(consumerGroup, events); err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			log.Debugf("batch %d already committed by consumer group '%s'", batchNumber, consumerGroup)
+			return nil
+		}
+	}
+
 	// Get a blocking channel to send and receive on our chosen namespace
 	sender, broadcaster, receiver, closing := w.es.wsChannels.GetChannels(w.spec.Topic)
 
@@ -72,11 +93,23 @@ func (w *webSocketAction) attemptBatch(batchNumber, _ uint64, events []*api.Even
 		channel = sender
 	}
 
+	var batch interface{} = events
+	if w.es.spec.Format == EventFormatCloudEvents {
+		envelopes := toCloudEvents(events)
+		batch = envelopes
+		if w.es.spec.BatchSizeStream && len(envelopes) == 1 {
+			batch = envelopes[0]
+		}
+	} else if w.es.spec.BatchSizeStream && len(events) == 1 {
+		// streams delivering each event on its own send the event, which the client acks on its own
+		batch = events[0]
+	}
+
 	// Sent the batch of events
 	select {
-	case channel <- events:
+	case channel <- batch:
 		break
-	case <-w.es.updateInterrupt:
+	case <-ctx.Done():
 		return errors.Errorf(errors.EventStreamsWebSocketInterruptedSend)
 	case <-closing:
 		return errors.Errorf(errors.EventStreamsWebSocketInterruptedSend)
@@ -88,12 +121,35 @@ func (w *webSocketAction) attemptBatch(batchNumber, _ uint64, events []*api.Even
 		select {
 		case err = <-receiver:
 			break
-		case <-w.es.updateInterrupt:
+		case <-ctx.Done():
 			return errors.Errorf(errors.EventStreamsWebSocketInterruptedReceive)
 		case <-closing:
 			return errors.Errorf(errors.EventStreamsWebSocketInterruptedReceive)
 		}
+		if err == nil && consumerGroup != "" {
+			if err := w.es.sm.advanceConsumerOffset(w.spec.Topic, consumerGroup, events); err != nil {
+				log.Errorf("Failed to commit offset of consumer group '%s' on topic '%s': %s", consumerGroup, w.spec.Topic, err)
+			}
+		}
 		// Pass back any exception from the client
 	}
 	return err
 }
+
+// uncommittedEvents filters out the events at or before the offsets of the consumer group
+func (w *webSocketAction) uncommittedEvents(consumerGroup string, events []*api.EventEntry) ([]*api.EventEntry, error) {
+	offset, err := w.es.sm.loadConsumerOffset(w.spec.Topic, consumerGroup)
+	if err != nil {
+		return nil, errors.Errorf(errors.EventStreamsConsumerOffsetLoadFailed, consumerGroup, err)
+	}
+	if len(offset.Offsets) == 0 {
+		return events, nil
+	}
+	uncommitted := make([]*api.EventEntry, 0, len(events))
+	for _, event := range events {
+		if !offset.committed(event) {
+			uncommitted = append(uncommitted, event)
+		}
+	}
+	return uncommitted, nil
+}
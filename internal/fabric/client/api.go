@@ -17,6 +17,9 @@
 package client
 
 import (
+	"context"
+
+	"github.com/hyperledger/fabric-protos-go/common"
 	pb "github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/event"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
@@ -46,19 +49,34 @@ func (r *TxReceipt) IsSuccess() bool {
 	return r.Status == pb.TxValidationCode_VALID
 }
 
+// IsConflict returns true if the transaction was invalidated by contention with
+// other transactions, rather than by a problem with the transaction itself
+func (r *TxReceipt) IsConflict() bool {
+	switch r.Status {
+	case pb.TxValidationCode_MVCC_READ_CONFLICT,
+		pb.TxValidationCode_PHANTOM_READ_CONFLICT,
+		pb.TxValidationCode_ENDORSEMENT_POLICY_FAILURE:
+		return true
+	default:
+		return false
+	}
+}
+
 type RegistrationWrapper struct {
 	registration fab.Registration
 	eventClient  *event.Client
 }
 
+// RPCClient is the interface to the Fabric network. All calls honor the cancellation of the
+// supplied context, so that work on behalf of a caller that has gone away is abandoned promptly
 type RPCClient interface {
-	Invoke(channelID, signer, chaincodeName, method string, args []string, transientMap map[string]string, isInit bool) (*TxReceipt, error)
-	Query(channelID, signer, chaincodeName, method string, args []string, strongread bool) ([]byte, error)
-	QueryChainInfo(channelID, signer string) (*fab.BlockchainInfoResponse, error)
-	QueryBlock(channelID string, signer string, blocknumber uint64, blockhash []byte) (*utils.RawBlock, *utils.Block, error)
-	QueryBlockByTxID(channelID string, signer string, txID string) (*utils.RawBlock, *utils.Block, error)
-	QueryTransaction(channelID, signer, txID string) (map[string]interface{}, error)
-	SubscribeEvent(subInfo *eventsapi.SubscriptionInfo, since uint64) (*RegistrationWrapper, <-chan *fab.BlockEvent, <-chan *fab.CCEvent, error)
+	Invoke(ctx context.Context, channelID, signer, chaincodeName, method string, args []string, transientMap map[string]string, isInit bool) (*TxReceipt, error)
+	Query(ctx context.Context, channelID, signer, chaincodeName, method string, args []string, strongread bool) ([]byte, error)
+	QueryChainInfo(ctx context.Context, channelID, signer string) (*fab.BlockchainInfoResponse, error)
+	QueryBlock(ctx context.Context, channelID string, signer string, blocknumber uint64, blockhash []byte) (*utils.RawBlock, *utils.Block, error)
+	QueryBlockByTxID(ctx context.Context, channelID string, signer string, txID string) (*utils.RawBlock, *utils.Block, error)
+	QueryTransaction(ctx context.Context, channelID, signer, txID string) (map[string]interface{}, error)
+	SubscribeEvent(ctx context.Context, subInfo *eventsapi.SubscriptionInfo, since uint64) (*RegistrationWrapper, <-chan *fab.BlockEvent, <-chan *fab.CCEvent, error)
 	Unregister(*RegistrationWrapper)
 	Close() error
 }
@@ -72,3 +90,55 @@ type IdentityClient interface {
 type SignerUpdateListener interface {
 	SignerUpdated(signer string)
 }
+
+// ChannelConfigUpdate is emitted when a channel config block changes the orderers of a channel,
+// or migrates the channel to another consensus type
+type ChannelConfigUpdate struct {
+	ChannelID        string   `json:"channel"`
+	BlockNumber      uint64   `json:"blockNumber"`
+	Orderers         []string `json:"orderers"`
+	PreviousOrderers []string `json:"previousOrderers"`
+	TLSCAsChanged    bool     `json:"tlsCAsChanged"`
+	ConsensusType    string   `json:"consensusType,omitempty"`
+}
+
+type ChannelConfigListener interface {
+	ChannelConfigUpdated(update *ChannelConfigUpdate)
+}
+
+// ChannelLister is implemented by RPC clients that can list the channels joined by the peer
+// of the organization, with the cscc GetChannels query
+type ChannelLister interface {
+	QueryChannels(ctx context.Context, signer string) ([]string, error)
+}
+
+// ChannelConfigNotifier is implemented by RPC clients that follow the orderers published
+// in the channel config blocks
+type ChannelConfigNotifier interface {
+	AddChannelConfigListener(ChannelConfigListener)
+}
+
+// ChannelConfigUpdateResult is the outcome of a guided update to the config of a channel
+type ChannelConfigUpdateResult struct {
+	ChannelID string `json:"channel"`
+	// false if the config already had the requested values, so there was nothing to update
+	Updated       bool   `json:"updated"`
+	TransactionID string `json:"transactionID,omitempty"`
+	// the unsigned config update envelope, as computed by "configtxlator compute_update",
+	// returned when it is not submitted so the signatures of other organizations can be collected
+	ConfigUpdate []byte `json:"configUpdate,omitempty"`
+}
+
+// ChannelConfigUpdater is implemented by RPC clients that can compute the delta of a change to
+// the config of a channel, and sign and submit it to the orderer as the signer, who must be
+// an admin of the organizations whose approval the change requires
+type ChannelConfigUpdater interface {
+	UpdateChannelConfig(ctx context.Context, channelID, signer string, modify func(config *common.Config) error, submit bool) (*ChannelConfigUpdateResult, error)
+}
+
+// CollectionConfigQuerier is implemented by RPC clients that can look up the private data
+// collections in the committed definition of a chaincode, and the organization of a signer
+type CollectionConfigQuerier interface {
+	QueryCollectionsConfig(ctx context.Context, channelID, signer, chaincodeName string) ([]*pb.CollectionConfig, error)
+	GetSignerMSPID(signer string) (string, error)
+}
@@ -0,0 +1,160 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/fabric/utils"
+)
+
+// BlockCacheStats reports how effective the block cache is
+type BlockCacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Blocks    int    `json:"blocks"`
+	SizeBytes int64  `json:"sizeBytes"`
+	MaxBytes  int64  `json:"maxBytes"`
+}
+
+// BlockCacheStatsProvider is implemented by RPC clients that cache the blocks they fetch
+type BlockCacheStatsProvider interface {
+	BlockCacheStats() *BlockCacheStats
+}
+
+type cachedBlock struct {
+	number   uint64
+	rawblock *utils.RawBlock
+	block    *utils.Block
+	size     int64
+}
+
+type channelBlocks struct {
+	entries map[uint64]*list.Element
+	order   *list.List // most recently used at the front
+	size    int64
+}
+
+// blockCache keeps an LRU list of decoded blocks per channel, so that subscriptions
+// and streams working over overlapping ranges of blocks do not each fetch them from
+// the peer. Committed blocks never change, and are the same for every signer in the
+// org, so they are shared by all callers and must be treated as read-only.
+// The memory budget is shared by all channels, and when it is exceeded the least
+// recently used block of the largest channel is evicted
+type blockCache struct {
+	mux       sync.Mutex
+	maxBytes  int64
+	size      int64
+	channels  map[string]*channelBlocks
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+func newBlockCache(maxBytes int64) *blockCache {
+	return &blockCache{
+		maxBytes: maxBytes,
+		channels: make(map[string]*channelBlocks),
+	}
+}
+
+func (c *blockCache) enabled() bool {
+	return c.maxBytes > 0
+}
+
+func (c *blockCache) get(channelID string, number uint64) (*utils.RawBlock, *utils.Block, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if cb, ok := c.channels[channelID]; ok {
+		if elem, ok := cb.entries[number]; ok {
+			cb.order.MoveToFront(elem)
+			c.hits++
+			entry := elem.Value.(*cachedBlock)
+			return entry.rawblock, entry.block, true
+		}
+	}
+	c.misses++
+	return nil, nil, false
+}
+
+func (c *blockCache) add(channelID string, number uint64, size int64, rawblock *utils.RawBlock, block *utils.Block) {
+	if size > c.maxBytes {
+		return
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	cb, ok := c.channels[channelID]
+	if !ok {
+		cb = &channelBlocks{
+			entries: make(map[uint64]*list.Element),
+			order:   list.New(),
+		}
+		c.channels[channelID] = cb
+	}
+	if _, exists := cb.entries[number]; exists {
+		// another caller fetched the same block concurrently
+		return
+	}
+	cb.entries[number] = cb.order.PushFront(&cachedBlock{
+		number:   number,
+		rawblock: rawblock,
+		block:    block,
+		size:     size,
+	})
+	cb.size += size
+	c.size += size
+	for c.size > c.maxBytes {
+		c.evict()
+	}
+}
+
+func (c *blockCache) evict() {
+	var largestID string
+	var largest *channelBlocks
+	for channelID, cb := range c.channels {
+		if largest == nil || cb.size > largest.size {
+			largestID, largest = channelID, cb
+		}
+	}
+	entry := largest.order.Remove(largest.order.Back()).(*cachedBlock)
+	delete(largest.entries, entry.number)
+	largest.size -= entry.size
+	c.size -= entry.size
+	c.evictions++
+	if largest.order.Len() == 0 {
+		delete(c.channels, largestID)
+	}
+}
+
+func (c *blockCache) stats() *BlockCacheStats {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	blocks := 0
+	for _, cb := range c.channels {
+		blocks += cb.order.Len()
+	}
+	return &BlockCacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Blocks:    blocks,
+		SizeBytes: c.size,
+		MaxBytes:  c.maxBytes,
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"testing"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/fabric/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockCacheHitsAndMisses(t *testing.T) {
+	assert := assert.New(t)
+	c := newBlockCache(1000)
+	assert.True(c.enabled())
+
+	_, _, ok := c.get("channel1", 1)
+	assert.False(ok)
+
+	block := &utils.Block{Number: 1}
+	c.add("channel1", 1, 100, &utils.RawBlock{}, block)
+	_, cached, ok := c.get("channel1", 1)
+	assert.True(ok)
+	assert.Same(block, cached)
+
+	// blocks are cached per channel
+	_, _, ok = c.get("channel2", 1)
+	assert.False(ok)
+
+	stats := c.stats()
+	assert.Equal(uint64(1), stats.Hits)
+	assert.Equal(uint64(2), stats.Misses)
+	assert.Equal(1, stats.Blocks)
+	assert.Equal(int64(100), stats.SizeBytes)
+	assert.Equal(int64(1000), stats.MaxBytes)
+}
+
+func TestBlockCacheEvictsLeastRecentlyUsedOfLargestChannel(t *testing.T) {
+	assert := assert.New(t)
+	c := newBlockCache(1000)
+
+	c.add("channel1", 1, 300, nil, &utils.Block{Number: 1})
+	c.add("channel1", 2, 300, nil, &utils.Block{Number: 2})
+	c.add("channel2", 1, 200, nil, &utils.Block{Number: 1})
+	// touch block 1, so block 2 becomes the least recently used on channel1
+	_, _, ok := c.get("channel1", 1)
+	assert.True(ok)
+
+	c.add("channel2", 2, 300, nil, &utils.Block{Number: 2})
+	_, _, ok = c.get("channel1", 2)
+	assert.False(ok)
+	_, _, ok = c.get("channel1", 1)
+	assert.True(ok)
+	_, _, ok = c.get("channel2", 1)
+	assert.True(ok)
+
+	stats := c.stats()
+	assert.Equal(uint64(1), stats.Evictions)
+	assert.Equal(3, stats.Blocks)
+	assert.Equal(int64(800), stats.SizeBytes)
+}
+
+func TestBlockCacheSkipsOversizeAndDuplicates(t *testing.T) {
+	assert := assert.New(t)
+	c := newBlockCache(100)
+
+	c.add("channel1", 1, 101, nil, &utils.Block{Number: 1})
+	_, _, ok := c.get("channel1", 1)
+	assert.False(ok)
+
+	first := &utils.Block{Number: 2}
+	c.add("channel1", 2, 50, nil, first)
+	c.add("channel1", 2, 50, nil, &utils.Block{Number: 2})
+	_, cached, _ := c.get("channel1", 2)
+	assert.Same(first, cached)
+	assert.Equal(int64(50), c.stats().SizeBytes)
+}
+
+func TestBlockCacheDisabled(t *testing.T) {
+	assert := assert.New(t)
+	c := newBlockCache(0)
+	assert.False(c.enabled())
+}
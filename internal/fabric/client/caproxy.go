@@ -0,0 +1,278 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/msp"
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const caProxyConnectTimeout = 30 * time.Second
+
+// caProxyConfig wraps the identity config of the SDK, to send the requests to each CA
+// through a proxy. The Fabric CA client in the SDK builds its own HTTP transport that
+// ignores proxies, so the URL of a proxied CA is replaced with a local listener that
+// tunnels each connection through the proxy with HTTP CONNECT. TLS remains end to end
+// with the CA, and is verified against the original host name of the CA.
+// CAs without a proxy configured use the proxy environment variables (HTTP_PROXY,
+// HTTPS_PROXY and NO_PROXY)
+type caProxyConfig struct {
+	msp.IdentityConfig
+	proxies  map[string]*url.URL
+	envProxy func(*http.Request) (*url.URL, error)
+	mux      sync.Mutex
+	tunnels  map[string]*caTunnel
+}
+
+func newCAProxyConfig(identityConfig msp.IdentityConfig, caProxies map[string]string) (*caProxyConfig, error) {
+	c := &caProxyConfig{
+		IdentityConfig: identityConfig,
+		proxies:        make(map[string]*url.URL),
+		envProxy:       http.ProxyFromEnvironment,
+		tunnels:        make(map[string]*caTunnel),
+	}
+	for caID, proxyURL := range caProxies {
+		u, err := url.Parse(proxyURL)
+		if urlErr, ok := err.(*url.Error); ok {
+			// the url.Error includes the full URL, with any password
+			err = urlErr.Err
+		}
+		if err == nil && (u.Host == "" || (u.Scheme != "http" && u.Scheme != "https")) {
+			err = fmt.Errorf("must be an http or https URL")
+		}
+		if err != nil {
+			return nil, errors.Errorf("Invalid proxy URL for CA %s. %s", caID, err)
+		}
+		c.proxies[caID] = u
+	}
+	return c, nil
+}
+
+// CAConfig returns the config of the CA, with the URL of the local tunnel if the CA
+// is accessed through a proxy
+func (c *caProxyConfig) CAConfig(caID string) (*msp.CAConfig, bool) {
+	caConfig, ok := c.IdentityConfig.CAConfig(caID)
+	if !ok {
+		return caConfig, ok
+	}
+	caURL, err := url.Parse(caConfig.URL)
+	if err != nil || caURL.Host == "" {
+		// left for the SDK to report
+		return caConfig, ok
+	}
+	tunnel, err := c.tunnel(caID, caURL)
+	if err != nil {
+		log.Errorf("Failed to route requests to CA %s through the proxy: %s", caID, err)
+		return nil, false
+	}
+	if tunnel == nil {
+		return caConfig, ok
+	}
+
+	proxied := *caConfig
+	proxied.URL = fmt.Sprintf("%s://%s", caURL.Scheme, tunnel.addr())
+	proxied.GRPCOptions = make(map[string]interface{}, len(caConfig.GRPCOptions)+1)
+	for k, v := range caConfig.GRPCOptions {
+		proxied.GRPCOptions[k] = v
+	}
+	if serverName, _ := proxied.GRPCOptions["ssl-target-name-override"].(string); serverName == "" {
+		proxied.GRPCOptions["ssl-target-name-override"] = caURL.Hostname()
+	}
+	return &proxied, true
+}
+
+// tunnel returns the tunnel for the CA, starting it on first use. Returns nil if the
+// CA is accessed directly
+func (c *caProxyConfig) tunnel(caID string, caURL *url.URL) (*caTunnel, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if t, ok := c.tunnels[caID]; ok {
+		return t, nil
+	}
+	proxyURL, ok := c.proxies[caID]
+	if !ok {
+		var err error
+		if proxyURL, err = c.envProxy(&http.Request{URL: caURL}); err != nil {
+			return nil, err
+		}
+	}
+	var t *caTunnel
+	if proxyURL != nil {
+		target := caURL.Host
+		if caURL.Port() == "" {
+			port := "80"
+			if caURL.Scheme == "https" {
+				port = "443"
+			}
+			target = net.JoinHostPort(caURL.Hostname(), port)
+		}
+		var err error
+		if t, err = newCATunnel(proxyURL, target); err != nil {
+			return nil, err
+		}
+		log.Infof("Requests to CA %s are routed through proxy %s", caID, proxyURL.Redacted())
+	}
+	c.tunnels[caID] = t
+	return t, nil
+}
+
+func (c *caProxyConfig) close() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for _, t := range c.tunnels {
+		if t != nil {
+			t.close()
+		}
+	}
+}
+
+// caTunnel is a local listener, forwarding each connection to the CA through the proxy
+type caTunnel struct {
+	listener net.Listener
+	proxy    *url.URL
+	target   string
+	dialer   *net.Dialer
+}
+
+func newCATunnel(proxyURL *url.URL, target string) (*caTunnel, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	t := &caTunnel{
+		listener: listener,
+		proxy:    proxyURL,
+		target:   target,
+		dialer:   &net.Dialer{Timeout: caProxyConnectTimeout},
+	}
+	go t.serve()
+	return t, nil
+}
+
+func (t *caTunnel) addr() string {
+	return t.listener.Addr().String()
+}
+
+func (t *caTunnel) close() {
+	_ = t.listener.Close()
+}
+
+func (t *caTunnel) serve() {
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		go t.forward(conn)
+	}
+}
+
+func (t *caTunnel) forward(conn net.Conn) {
+	defer conn.Close()
+	upstream, err := t.connect()
+	if err != nil {
+		log.Errorf("Failed to connect to %s through proxy %s: %s", t.target, t.proxy.Redacted(), err)
+		return
+	}
+	defer upstream.Close()
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(upstream, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(conn, upstream)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// connect opens a connection to the proxy, and asks it to tunnel to the CA
+func (t *caTunnel) connect() (net.Conn, error) {
+	proxyAddr := t.proxy.Host
+	if t.proxy.Port() == "" {
+		port := "80"
+		if t.proxy.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddr = net.JoinHostPort(t.proxy.Hostname(), port)
+	}
+	conn, err := t.dialer.Dial("tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	if t.proxy.Scheme == "https" {
+		conn = tls.Client(conn, &tls.Config{
+			ServerName: t.proxy.Hostname(),
+			MinVersion: tls.VersionTLS12,
+		})
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: t.target},
+		Host:   t.target,
+		Header: make(http.Header),
+	}
+	if t.proxy.User != nil {
+		password, _ := t.proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(t.proxy.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	_ = conn.SetDeadline(time.Now().Add(caProxyConnectTimeout))
+	reader := bufio.NewReader(conn)
+	err = req.Write(conn)
+	var res *http.Response
+	if err == nil {
+		res, err = http.ReadResponse(reader, req)
+	}
+	if err == nil {
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			err = fmt.Errorf("proxy returned %s", res.Status)
+		}
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return &bufferedConn{Conn: conn, reader: reader}, nil
+}
+
+// bufferedConn reads through the reader used for the CONNECT response, in case it
+// has already buffered data sent by the CA
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
@@ -0,0 +1,346 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	reqContext "context"
+	"crypto/x509"
+	"encoding/pem"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/core"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	commtls "github.com/hyperledger/fabric-sdk-go/pkg/core/config/comm/tls"
+	fabImpl "github.com/hyperledger/fabric-sdk-go/pkg/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+	"github.com/hyperledger/firefly-fabconnect/internal/fabric/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// channelOrderers are the orderers of a channel as published in its latest config block
+type channelOrderers struct {
+	config   *utils.ChannelOrdererConfig
+	orderers []fab.OrdererConfig
+	caCerts  []*x509.Certificate
+}
+
+// channelConfigWatcher periodically reads the latest config block of each channel the
+// client transacts on, and takes the orderer endpoints and orderer TLS CAs from there in
+// place of the connection profile. This way a config update that adds, moves or removes
+// orderers, or rotates their TLS CAs, does not fail submissions until the connection
+// profile is edited by hand
+type channelConfigWatcher struct {
+	interval         time.Duration
+	queryConfigBlock func(ctx reqContext.Context, channelID, signer string) (*common.Block, error)
+	mux              sync.Mutex
+	// the signer used to read the config block of each channel
+	channels  map[string]string
+	orderers  map[string]*channelOrderers
+	listeners []ChannelConfigListener
+	poke      chan struct{}
+	done      chan struct{}
+	stopped   chan struct{}
+}
+
+// the watcher is created ahead of the SDK, as the SDK is created with its endpoint config.
+// The config blocks are read with the ledger client set by start()
+func newChannelConfigWatcher(interval time.Duration) *channelConfigWatcher {
+	return &channelConfigWatcher{
+		interval: interval,
+		channels: make(map[string]string),
+		orderers: make(map[string]*channelOrderers),
+		poke:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+func (w *channelConfigWatcher) AddChannelConfigListener(listener ChannelConfigListener) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.listeners = append(w.listeners, listener)
+}
+
+// track starts watching the config of a channel, the first time a client is created for it
+func (w *channelConfigWatcher) track(channelID, signer string) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if _, ok := w.channels[channelID]; ok {
+		return
+	}
+	w.channels[channelID] = signer
+	select {
+	case w.poke <- struct{}{}:
+	default:
+	}
+}
+
+func (w *channelConfigWatcher) start(ledgerClientWrapper *ledgerClientWrapper) {
+	w.queryConfigBlock = ledgerClientWrapper.queryConfigBlock
+	go w.run()
+}
+
+func (w *channelConfigWatcher) run() {
+	defer close(w.stopped)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.refresh()
+		case <-w.poke:
+			w.refresh()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *channelConfigWatcher) stop() {
+	close(w.done)
+	<-w.stopped
+}
+
+// refresh reads the config block of every tracked channel, and returns the updates
+func (w *channelConfigWatcher) refresh() []*ChannelConfigUpdate {
+	w.mux.Lock()
+	channels := make(map[string]string, len(w.channels))
+	for channelID, signer := range w.channels {
+		channels[channelID] = signer
+	}
+	w.mux.Unlock()
+
+	var updates []*ChannelConfigUpdate
+	for channelID, signer := range channels {
+		if update := w.refreshChannel(channelID, signer); update != nil {
+			updates = append(updates, update)
+		}
+	}
+	return updates
+}
+
+func (w *channelConfigWatcher) refreshChannel(channelID, signer string) *ChannelConfigUpdate {
+	ctx, cancel := reqContext.WithTimeout(reqContext.Background(), w.interval)
+	defer cancel()
+	block, err := w.queryConfigBlock(ctx, channelID, signer)
+	if err != nil {
+		// the orderers from the previous config block remain in use
+		log.Warnf("Failed to query the config block of channel %s. %s", channelID, err)
+		return nil
+	}
+	config, err := utils.GetChannelOrdererConfig(block)
+	if err != nil {
+		log.Errorf("Failed to read the orderers from config block %d of channel %s. %s", block.Header.GetNumber(), channelID, err)
+		return nil
+	}
+	if len(config.Orderers) == 0 {
+		log.Warnf("No orderers in config block %d of channel %s, using the connection profile", config.BlockNumber, channelID)
+		return nil
+	}
+
+	w.mux.Lock()
+	previous := w.orderers[channelID]
+	if previous != nil && previous.config.Equal(config) {
+		w.mux.Unlock()
+		return nil
+	}
+	current := newChannelOrderers(config)
+	w.orderers[channelID] = current
+	listeners := w.listeners
+	w.mux.Unlock()
+
+	if previous == nil {
+		log.Infof("Using orderers %v of channel %s, from config block %d", config.Addresses(), channelID, config.BlockNumber)
+		return nil
+	}
+	if config.ConsensusType != previous.config.ConsensusType {
+		log.Infof("Config block %d of channel %s changed the consensus type from %s to %s", config.BlockNumber, channelID, previous.config.ConsensusType, config.ConsensusType)
+	}
+	update := &ChannelConfigUpdate{
+		ChannelID:        channelID,
+		BlockNumber:      config.BlockNumber,
+		Orderers:         config.Addresses(),
+		PreviousOrderers: previous.config.Addresses(),
+		TLSCAsChanged:    !sameCertificates(current.caCerts, previous.caCerts),
+		ConsensusType:    config.ConsensusType,
+	}
+	log.Infof("Config block %d of channel %s changed the orderers from %v to %v", config.BlockNumber, channelID, update.PreviousOrderers, update.Orderers)
+	for _, listener := range listeners {
+		listener.ChannelConfigUpdated(update)
+	}
+	return update
+}
+
+func newChannelOrderers(config *utils.ChannelOrdererConfig) *channelOrderers {
+	c := &channelOrderers{config: config}
+	for _, o := range config.Orderers {
+		ordererConfig := fab.OrdererConfig{
+			URL: o.Address,
+			GRPCOptions: map[string]interface{}{
+				"ssl-target-name-override": endpointHost(o.Address),
+			},
+		}
+		for _, pemBytes := range o.TLSCACerts {
+			cert, err := parsePEMCertificate(pemBytes)
+			if err != nil {
+				log.Warnf("Failed to parse a TLS CA certificate of orderer %s. %s", o.Address, err)
+				continue
+			}
+			if ordererConfig.TLSCACert == nil {
+				ordererConfig.TLSCACert = cert
+			}
+			c.caCerts = append(c.caCerts, cert)
+		}
+		c.orderers = append(c.orderers, ordererConfig)
+	}
+	return c
+}
+
+func sameCertificates(certs, others []*x509.Certificate) bool {
+	if len(certs) != len(others) {
+		return false
+	}
+	for i, cert := range certs {
+		if !cert.Equal(others[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func parsePEMCertificate(pemBytes []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return x509.ParseCertificate(pemBytes)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// channelOrderers returns the orderers of the channel, or nil if the config block of
+// the channel has not been read
+func (w *channelConfigWatcher) channelOrderers(channelID string) *channelOrderers {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	return w.orderers[channelID]
+}
+
+// consensusType returns the consensus type of the channel, or "" if the config block of the
+// channel has not been read
+func (w *channelConfigWatcher) consensusType(channelID string) string {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if c := w.orderers[channelID]; c != nil {
+		return c.config.ConsensusType
+	}
+	return ""
+}
+
+func (w *channelConfigWatcher) ordererConfig(address string) (*fab.OrdererConfig, bool) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	for _, c := range w.orderers {
+		for i := range c.orderers {
+			if c.orderers[i].URL == address {
+				ordererConfig := c.orderers[i]
+				return &ordererConfig, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func (w *channelConfigWatcher) caCerts() []*x509.Certificate {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	var certs []*x509.Certificate
+	for _, c := range w.orderers {
+		certs = append(certs, c.caCerts...)
+	}
+	return certs
+}
+
+// sdkCreator returns the function to create SDK instances that use the orderers from
+// the channel config blocks
+func (w *channelConfigWatcher) sdkCreator() sdkCreator {
+	return func(configProvider core.ConfigProvider) (*fabsdk.FabricSDK, error) {
+		backends, err := configProvider()
+		if err != nil {
+			return nil, err
+		}
+		endpointConfig, err := fabImpl.ConfigFromBackend(backends...)
+		if err != nil {
+			return nil, err
+		}
+		return fabsdk.New(configProvider, fabsdk.WithEndpointConfig(&channelEndpointConfig{EndpointConfig: endpointConfig, watcher: w}))
+	}
+}
+
+// channelEndpointConfig overrides the orderers in the endpoint config of the SDK with
+// the ones read from the channel config blocks
+type channelEndpointConfig struct {
+	fab.EndpointConfig
+	watcher *channelConfigWatcher
+}
+
+// ChannelConfig lists the orderers of the channel, so that the SDK looks them up with
+// OrdererConfig rather than using the orderers in the connection profile
+func (c *channelEndpointConfig) ChannelConfig(name string) *fab.ChannelEndpointConfig {
+	channelConfig := c.EndpointConfig.ChannelConfig(name)
+	orderers := c.watcher.channelOrderers(name)
+	if orderers == nil {
+		return channelConfig
+	}
+	result := *channelConfig
+	result.Orderers = orderers.config.Addresses()
+	return &result
+}
+
+func (c *channelEndpointConfig) ChannelOrderers(name string) []fab.OrdererConfig {
+	orderers := c.watcher.channelOrderers(name)
+	if orderers == nil {
+		return c.EndpointConfig.ChannelOrderers(name)
+	}
+	result := make([]fab.OrdererConfig, 0, len(orderers.orderers))
+	for _, o := range orderers.orderers {
+		if ordererConfig, found, ignore := c.OrdererConfig(o.URL); found && !ignore {
+			result = append(result, *ordererConfig)
+		}
+	}
+	return result
+}
+
+// OrdererConfig returns the config of an orderer in the connection profile, matched by
+// name, URL or entity matchers, falling back to the address and TLS CA published in the
+// channel config
+func (c *channelEndpointConfig) OrdererConfig(nameOrURL string) (*fab.OrdererConfig, bool, bool) {
+	ordererConfig, found, ignore := c.EndpointConfig.OrdererConfig(nameOrURL)
+	if found || ignore {
+		return ordererConfig, found, ignore
+	}
+	if ordererConfig, ok := c.watcher.ordererConfig(nameOrURL); ok {
+		return ordererConfig, true, false
+	}
+	return ordererConfig, found, ignore
+}
+
+func (c *channelEndpointConfig) TLSCACertPool() commtls.CertPool {
+	pool := c.EndpointConfig.TLSCACertPool()
+	pool.Add(c.watcher.caCerts()...)
+	return pool
+}
@@ -0,0 +1,183 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	reqContext "context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto" //nolint
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	commtls "github.com/hyperledger/fabric-sdk-go/pkg/core/config/comm/tls"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testOrderer0 = "u0bdh1ndoq.u0wrhhqt5w.kaleido.network:40020"
+	testOrderer1 = "u0u52tiobg.u0wrhhqt5w.kaleido.network:40040"
+)
+
+func readConfigBlock(name string) *common.Block {
+	content, _ := os.ReadFile("../../../test/resources/" + name)
+	block := &common.Block{}
+	_ = proto.Unmarshal(content, block)
+	return block
+}
+
+type recordingChannelConfigListener struct {
+	updates []*ChannelConfigUpdate
+}
+
+func (l *recordingChannelConfigListener) ChannelConfigUpdated(update *ChannelConfigUpdate) {
+	l.updates = append(l.updates, update)
+}
+
+type stubEndpointConfig struct {
+	fab.EndpointConfig
+	pool commtls.CertPool
+}
+
+func (s *stubEndpointConfig) ChannelConfig(name string) *fab.ChannelEndpointConfig {
+	return &fab.ChannelEndpointConfig{Orderers: []string{"orderer.example.com"}}
+}
+
+func (s *stubEndpointConfig) ChannelOrderers(name string) []fab.OrdererConfig {
+	return []fab.OrdererConfig{{URL: "grpcs://orderer.example.com:7050"}}
+}
+
+func (s *stubEndpointConfig) OrdererConfig(nameOrURL string) (*fab.OrdererConfig, bool, bool) {
+	switch nameOrURL {
+	case "orderer.example.com":
+		return &fab.OrdererConfig{URL: "grpcs://orderer.example.com:7050"}, true, false
+	case testOrderer1:
+		// matched by an entity matcher in the connection profile
+		return &fab.OrdererConfig{URL: "grpcs://" + testOrderer1, GRPCOptions: map[string]interface{}{"keep-alive-time": "10s"}}, true, false
+	}
+	return nil, false, false
+}
+
+func (s *stubEndpointConfig) TLSCACertPool() commtls.CertPool {
+	return s.pool
+}
+
+func newTestChannelConfigWatcher(blocks ...string) (*channelConfigWatcher, *int) {
+	w := newChannelConfigWatcher(time.Hour)
+	queries := 0
+	w.queryConfigBlock = func(ctx reqContext.Context, channelID, signer string) (*common.Block, error) {
+		if queries >= len(blocks) {
+			return nil, fmt.Errorf("pop")
+		}
+		block := readConfigBlock(blocks[queries])
+		queries++
+		return block, nil
+	}
+	return w, &queries
+}
+
+func TestChannelConfigWatcherRefresh(t *testing.T) {
+	assert := assert.New(t)
+	w, queries := newTestChannelConfigWatcher("config-0.block", "config-0.block", "config-1.block")
+	listener := &recordingChannelConfigListener{}
+	w.AddChannelConfigListener(listener)
+
+	// nothing to do until a channel is used
+	assert.Empty(w.refresh())
+	assert.Equal(0, *queries)
+	assert.Nil(w.channelOrderers("default-channel"))
+
+	w.track("default-channel", "user1")
+	w.track("default-channel", "user2")
+	assert.Equal(map[string]string{"default-channel": "user1"}, w.channels)
+
+	// the first config block read is not a change
+	assert.Empty(w.refresh())
+	orderers := w.channelOrderers("default-channel")
+	assert.Equal([]string{testOrderer0}, orderers.config.Addresses())
+	assert.Equal(1, len(orderers.caCerts))
+	assert.Same(orderers.caCerts[0], orderers.orderers[0].TLSCACert)
+	assert.Equal("u0bdh1ndoq.u0wrhhqt5w.kaleido.network", orderers.orderers[0].GRPCOptions["ssl-target-name-override"])
+
+	assert.Empty(w.refresh())
+	assert.Same(orderers, w.channelOrderers("default-channel"))
+
+	updates := w.refresh()
+	assert.Equal(1, len(updates))
+	assert.Equal(updates, listener.updates)
+	assert.Equal("default-channel", updates[0].ChannelID)
+	assert.Equal([]string{testOrderer0}, updates[0].PreviousOrderers)
+	assert.Equal([]string{testOrderer0, testOrderer1}, updates[0].Orderers)
+	assert.True(updates[0].TLSCAsChanged)
+
+	// a failed query keeps the orderers of the last config block
+	assert.Empty(w.refresh())
+	assert.Equal([]string{testOrderer0, testOrderer1}, w.channelOrderers("default-channel").config.Addresses())
+}
+
+func TestChannelConfigWatcherBadBlock(t *testing.T) {
+	assert := assert.New(t)
+	w, _ := newTestChannelConfigWatcher("tx-event.block")
+	w.track("default-channel", "user1")
+	assert.Empty(w.refresh())
+	assert.Nil(w.channelOrderers("default-channel"))
+}
+
+func TestChannelConfigWatcherStartStop(t *testing.T) {
+	w := newChannelConfigWatcher(time.Hour)
+	w.start(&ledgerClientWrapper{})
+	w.stop()
+}
+
+func TestChannelEndpointConfig(t *testing.T) {
+	assert := assert.New(t)
+	pool, _ := commtls.NewCertPool(false)
+	w, _ := newTestChannelConfigWatcher("config-1.block")
+	c := &channelEndpointConfig{EndpointConfig: &stubEndpointConfig{pool: pool}, watcher: w}
+
+	// the connection profile is used until the config block of the channel is read
+	assert.Equal([]string{"orderer.example.com"}, c.ChannelConfig("default-channel").Orderers)
+	assert.Equal("grpcs://orderer.example.com:7050", c.ChannelOrderers("default-channel")[0].URL)
+	_, found, _ := c.OrdererConfig(testOrderer0)
+	assert.False(found)
+
+	w.track("default-channel", "user1")
+	w.refresh()
+	assert.Equal([]string{testOrderer0, testOrderer1}, c.ChannelConfig("default-channel").Orderers)
+	assert.Equal([]string{"orderer.example.com"}, c.ChannelConfig("other-channel").Orderers)
+
+	ordererConfig, found, ignore := c.OrdererConfig(testOrderer0)
+	assert.True(found)
+	assert.False(ignore)
+	assert.Equal(testOrderer0, ordererConfig.URL)
+	assert.NotNil(ordererConfig.TLSCACert)
+
+	// orderers in the connection profile keep their settings
+	ordererConfig, _, _ = c.OrdererConfig(testOrderer1)
+	assert.Equal("10s", ordererConfig.GRPCOptions["keep-alive-time"])
+
+	orderers := c.ChannelOrderers("default-channel")
+	assert.Equal(2, len(orderers))
+	assert.Equal(testOrderer0, orderers[0].URL)
+
+	c.TLSCACertPool()
+	certPool, err := pool.Get()
+	assert.NoError(err)
+	assert.Equal(2, len(certPool.Subjects())) //nolint
+}
@@ -17,6 +17,7 @@
 package client
 
 import (
+	reqContext "context"
 	"sync"
 
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
@@ -30,6 +31,7 @@ import (
 	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
 	mspImpl "github.com/hyperledger/fabric-sdk-go/pkg/msp"
 	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/fabric/utils"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -48,6 +50,9 @@ type ccpRPCWrapper struct {
 	// one channel client per channel ID, per signer ID
 	channelClients map[string](map[string]*ccpClientWrapper)
 	mu             sync.Mutex
+	// all channels are ordered by SmartBFT, rather than only those with BFT in their config block
+	smartBFT       bool
+	broadcastRetry broadcastRetry
 }
 
 func newRPCClientFromCCP(configProvider core.ConfigProvider, txTimeout int, userStore msp.UserStore, idClient IdentityClient, ledgerClientWrapper *ledgerClientWrapper, eventClientWrapper *eventClientWrapper) (RPCClient, error) {
@@ -82,10 +87,10 @@ func newRPCClientFromCCP(configProvider core.ConfigProvider, txTimeout int, user
 	return w, nil
 }
 
-func (w *ccpRPCWrapper) Invoke(channelID, signer, chaincodeName, method string, args []string, transientMap map[string]string, isInit bool) (*TxReceipt, error) {
+func (w *ccpRPCWrapper) Invoke(ctx reqContext.Context, channelID, signer, chaincodeName, method string, args []string, transientMap map[string]string, isInit bool) (*TxReceipt, error) {
 	log.Tracef("RPC [%s:%s:%s:isInit=%t] --> %+v", channelID, chaincodeName, method, isInit, args)
 
-	signerID, result, txStatus, err := w.sendTransaction(channelID, signer, chaincodeName, method, args, transientMap, isInit)
+	signerID, result, txStatus, err := w.sendTransaction(ctx, channelID, signer, chaincodeName, method, args, transientMap, isInit)
 	if err != nil {
 		log.Errorf("Failed to send transaction [%s:%s:%s:isInit=%t]. %s", channelID, chaincodeName, method, isInit, err)
 		return nil, err
@@ -95,7 +100,7 @@ func (w *ccpRPCWrapper) Invoke(channelID, signer, chaincodeName, method string,
 	return newReceipt(result, txStatus, signerID), err
 }
 
-func (w *ccpRPCWrapper) Query(channelID, signer, chaincodeName, method string, args []string, strongread bool) ([]byte, error) {
+func (w *ccpRPCWrapper) Query(ctx reqContext.Context, channelID, signer, chaincodeName, method string, args []string, strongread bool) ([]byte, error) {
 	log.Tracef("RPC [%s:%s:%s] --> %+v", channelID, chaincodeName, method, args)
 
 	client, err := w.getChannelClient(channelID, signer)
@@ -115,13 +120,13 @@ func (w *ccpRPCWrapper) Query(channelID, signer, chaincodeName, method string, a
 	if strongread {
 		// strongread means querying a set of peers that would have fulfilled the
 		// endorsement policies and make sure they all have the same results
-		result, err1 = client.channelClient.Query(req, channel.WithRetry(retry.DefaultChannelOpts))
+		result, err1 = client.channelClient.Query(req, channel.WithParentContext(ctx), channel.WithRetry(retry.DefaultChannelOpts))
 	} else {
 		peerEndpoint, err := getFirstPeerEndpointFromConfig(w.configProvider)
 		if err != nil {
 			return nil, err
 		}
-		result, err1 = client.channelClient.Query(req, channel.WithRetry(retry.DefaultChannelOpts), channel.WithTargetEndpoints(peerEndpoint))
+		result, err1 = client.channelClient.Query(req, channel.WithParentContext(ctx), channel.WithRetry(retry.DefaultChannelOpts), channel.WithTargetEndpoints(peerEndpoint))
 	}
 	if err1 != nil {
 		log.Errorf("Failed to send query [%s:%s:%s]. %s", channelID, chaincodeName, method, err)
@@ -140,6 +145,13 @@ func (w *ccpRPCWrapper) SignerUpdated(signer string) {
 	w.mu.Unlock()
 }
 
+func (w *ccpRPCWrapper) sdkUpdated(sdk *fabsdk.FabricSDK) {
+	w.mu.Lock()
+	w.sdk = sdk
+	w.channelClients = make(map[string]map[string]*ccpClientWrapper)
+	w.mu.Unlock()
+}
+
 func (w *ccpRPCWrapper) getChannelClient(channelID string, signer string) (*ccpClientWrapper, error) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
@@ -169,16 +181,33 @@ func (w *ccpRPCWrapper) getChannelClient(channelID string, signer string) (*ccpC
 		}
 		w.channelClients[channelID][id.Identifier().ID] = newWrapper
 		clientOfUser = newWrapper
+		w.trackChannel(channelID, id.Identifier().ID)
 	}
 	return clientOfUser, nil
 }
 
 func (w *ccpRPCWrapper) Close() error {
+	w.stopEndpointWatcher()
+	w.stopChannelConfigWatcher()
 	w.sdk.Close()
 	return nil
 }
 
-func (w *ccpRPCWrapper) sendTransaction(channelID, signer, chaincodeName, method string, args []string, transientMap map[string]string, isInit bool) (*msp.IdentityIdentifier, []byte, *fab.TxStatusEvent, error) {
+func (w *ccpRPCWrapper) setSmartBFT(smartBFT bool, broadcast broadcastRetry) {
+	w.smartBFT = smartBFT
+	w.broadcastRetry = broadcast
+}
+
+// isSmartBFT returns true if the channel is configured, or has been detected from its config block,
+// to be ordered by SmartBFT
+func (w *ccpRPCWrapper) isSmartBFT(channelID string) bool {
+	if w.smartBFT {
+		return true
+	}
+	return w.chConfigWatcher != nil && w.chConfigWatcher.consensusType(channelID) == utils.ConsensusTypeBFT
+}
+
+func (w *ccpRPCWrapper) sendTransaction(ctx reqContext.Context, channelID, signer, chaincodeName, method string, args []string, transientMap map[string]string, isInit bool) (*msp.IdentityIdentifier, []byte, *fab.TxStatusEvent, error) {
 	client, err := w.getChannelClient(channelID, signer)
 	if err != nil {
 		return nil, nil, nil, errors.Errorf("Failed to get channel client. %s", err)
@@ -187,10 +216,14 @@ func (w *ccpRPCWrapper) sendTransaction(channelID, signer, chaincodeName, method
 	// by the transaction ID before the transaction is sent to the orderer. Thus we can't use
 	// the Execute() method of the client that consumes the event notification
 	txStatus := fab.TxStatusEvent{}
+	submitHandler := NewTxSubmitAndListenHandler(&txStatus)
+	if w.isSmartBFT(channelID) {
+		submitHandler.broadcastRetry = w.broadcastRetry
+	}
 	handlerChain := invoke.NewSelectAndEndorseHandler(
 		invoke.NewEndorsementValidationHandler(
 			invoke.NewSignatureValidationHandler(
-				NewTxSubmitAndListenHandler(&txStatus),
+				submitHandler,
 			),
 		),
 	)
@@ -203,6 +236,7 @@ func (w *ccpRPCWrapper) sendTransaction(channelID, signer, chaincodeName, method
 			TransientMap: convertStringMap(transientMap),
 			IsInit:       isInit,
 		},
+		channel.WithParentContext(ctx),
 		channel.WithRetry(retry.DefaultChannelOpts),
 	)
 	if err != nil {
@@ -17,9 +17,15 @@
 package client
 
 import (
+	"bytes"
+	reqContext "context"
 	"fmt"
 
+	"github.com/golang/protobuf/proto" //nolint
+	"github.com/hyperledger/fabric-protos-go/common"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/resmgmt"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/context"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/core"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
@@ -39,6 +45,43 @@ type commonRPCWrapper struct {
 	ledgerClientWrapper *ledgerClientWrapper
 	eventClientWrapper  *eventClientWrapper
 	channelCreator      channelCreator
+	endpointWatcher     *endpointWatcher
+	chConfigWatcher     *channelConfigWatcher
+}
+
+func (w *commonRPCWrapper) setEndpointWatcher(ew *endpointWatcher) {
+	w.endpointWatcher = ew
+}
+
+func (w *commonRPCWrapper) stopEndpointWatcher() {
+	if w.endpointWatcher != nil {
+		w.endpointWatcher.stop()
+		w.endpointWatcher = nil
+	}
+}
+
+func (w *commonRPCWrapper) setChannelConfigWatcher(cw *channelConfigWatcher) {
+	w.chConfigWatcher = cw
+}
+
+func (w *commonRPCWrapper) stopChannelConfigWatcher() {
+	if w.chConfigWatcher != nil {
+		w.chConfigWatcher.stop()
+		w.chConfigWatcher = nil
+	}
+}
+
+// trackChannel has the orderers of the channel followed from its config blocks, if enabled
+func (w *commonRPCWrapper) trackChannel(channelID, signer string) {
+	if w.chConfigWatcher != nil {
+		w.chConfigWatcher.track(channelID, signer)
+	}
+}
+
+func (w *commonRPCWrapper) AddChannelConfigListener(listener ChannelConfigListener) {
+	if w.chConfigWatcher != nil {
+		w.chConfigWatcher.AddChannelConfigListener(listener)
+	}
 }
 
 func getOrgFromConfig(config core.ConfigProvider) (string, error) {
@@ -84,14 +127,15 @@ func createChannelClient(channelProvider context.ChannelProvider) (*channel.Clie
 	return channel.New(channelProvider)
 }
 
-func newReceipt(_ []byte, status *fab.TxStatusEvent, signerID *msp.IdentityIdentifier) *TxReceipt {
+func newReceipt(responsePayload []byte, status *fab.TxStatusEvent, signerID *msp.IdentityIdentifier) *TxReceipt {
 	return &TxReceipt{
-		SignerMSP:     signerID.MSPID,
-		Signer:        signerID.ID,
-		TransactionID: status.TxID,
-		Status:        status.TxValidationCode,
-		BlockNumber:   status.BlockNumber,
-		SourcePeer:    status.SourceURL,
+		SignerMSP:       signerID.MSPID,
+		Signer:          signerID.ID,
+		TransactionID:   status.TxID,
+		Status:          status.TxValidationCode,
+		BlockNumber:     status.BlockNumber,
+		SourcePeer:      status.SourceURL,
+		ResponsePayload: responsePayload,
 	}
 }
 
@@ -111,10 +155,10 @@ func convertStringMap(_map map[string]string) map[string][]byte {
 	return result
 }
 
-func (w *commonRPCWrapper) QueryChainInfo(channelID, signer string) (*fab.BlockchainInfoResponse, error) {
+func (w *commonRPCWrapper) QueryChainInfo(ctx reqContext.Context, channelID, signer string) (*fab.BlockchainInfoResponse, error) {
 	log.Tracef("RPC [%s] --> QueryChainInfo", channelID)
 
-	result, err := w.ledgerClientWrapper.queryChainInfo(channelID, signer)
+	result, err := w.ledgerClientWrapper.queryChainInfo(ctx, channelID, signer)
 	if err != nil {
 		log.Errorf("Failed to query chain info on channel %s. %s", channelID, err)
 		return nil, err
@@ -124,10 +168,129 @@ func (w *commonRPCWrapper) QueryChainInfo(channelID, signer string) (*fab.Blockc
 	return result, nil
 }
 
-func (w *commonRPCWrapper) QueryBlock(channelID string, signer string, blockNumber uint64, blockhash []byte) (*utils.RawBlock, *utils.Block, error) {
+// QueryChannels lists the channels joined by the first peer of the organization
+func (w *commonRPCWrapper) QueryChannels(ctx reqContext.Context, signer string) ([]string, error) {
+	log.Tracef("RPC --> QueryChannels")
+
+	peerEndpoint, err := getFirstPeerEndpointFromConfig(w.configProvider)
+	if err != nil {
+		return nil, err
+	}
+	sdk := w.ledgerClientWrapper.currentSDK()
+	client, err := resmgmt.New(sdk.Context(fabsdk.WithOrg(w.idClient.GetClientOrg()), fabsdk.WithUser(signer)))
+	if err != nil {
+		return nil, errors.Errorf("Failed to get resource management client. %s", err)
+	}
+	result, err := client.QueryChannels(resmgmt.WithParentContext(ctx), resmgmt.WithTargetEndpoints(peerEndpoint))
+	if err != nil {
+		log.Errorf("Failed to query the channels of peer %s. %s", peerEndpoint, err)
+		return nil, err
+	}
+	channels := make([]string, len(result.Channels))
+	for i, ch := range result.Channels {
+		channels[i] = ch.ChannelId
+	}
+
+	log.Tracef("RPC <-- %+v", channels)
+	return channels, nil
+}
+
+// QueryCollectionsConfig returns the private data collections in the definition of a chaincode
+// committed to a channel, as queried from the first peer of the organization
+func (w *commonRPCWrapper) QueryCollectionsConfig(ctx reqContext.Context, channelID, signer, chaincodeName string) ([]*pb.CollectionConfig, error) {
+	log.Tracef("RPC [%s:%s] --> QueryCollectionsConfig", channelID, chaincodeName)
+
+	peerEndpoint, err := getFirstPeerEndpointFromConfig(w.configProvider)
+	if err != nil {
+		return nil, err
+	}
+	sdk := w.ledgerClientWrapper.currentSDK()
+	client, err := resmgmt.New(sdk.Context(fabsdk.WithOrg(w.idClient.GetClientOrg()), fabsdk.WithUser(signer)))
+	if err != nil {
+		return nil, errors.Errorf("Failed to get resource management client. %s", err)
+	}
+	definitions, err := client.LifecycleQueryCommittedCC(channelID, resmgmt.LifecycleQueryCommittedCCRequest{Name: chaincodeName}, resmgmt.WithParentContext(ctx), resmgmt.WithTargetEndpoints(peerEndpoint))
+	if err != nil {
+		log.Errorf("Failed to query the definition of chaincode %s on channel %s. %s", chaincodeName, channelID, err)
+		return nil, err
+	}
+	var collections []*pb.CollectionConfig
+	for _, definition := range definitions {
+		collections = append(collections, definition.CollectionConfig...)
+	}
+
+	log.Tracef("RPC [%s:%s] <-- %d collections", channelID, chaincodeName, len(collections))
+	return collections, nil
+}
+
+// GetSignerMSPID returns the MSP ID of the organization of a signer
+func (w *commonRPCWrapper) GetSignerMSPID(signer string) (string, error) {
+	id, err := w.idClient.GetSigningIdentity(signer)
+	if err != nil {
+		return "", err
+	}
+	return id.Identifier().MSPID, nil
+}
+
+// UpdateChannelConfig applies a change to the latest config of a channel, and computes the
+// config update from the difference. The update is signed and submitted by the signer, unless
+// submit is false, in which case it is returned for the signatures of other organizations
+func (w *commonRPCWrapper) UpdateChannelConfig(ctx reqContext.Context, channelID, signer string, modify func(config *common.Config) error, submit bool) (*ChannelConfigUpdateResult, error) {
+	log.Tracef("RPC [%s] --> UpdateChannelConfig", channelID)
+
+	block, err := w.ledgerClientWrapper.queryConfigBlock(ctx, channelID, signer)
+	if err != nil {
+		log.Errorf("Failed to query the config block of channel %s. %s", channelID, err)
+		return nil, err
+	}
+	original, err := utils.GetChannelConfig(block)
+	if err != nil {
+		return nil, err
+	}
+	updated := proto.Clone(original).(*common.Config)
+	if err := modify(updated); err != nil {
+		return nil, err
+	}
+	result := &ChannelConfigUpdateResult{ChannelID: channelID}
+	if proto.Equal(original, updated) {
+		log.Tracef("RPC [%s] <-- %+v", channelID, result)
+		return result, nil
+	}
+	configUpdate, err := resmgmt.CalculateConfigUpdate(channelID, original, updated)
+	if err != nil {
+		return nil, err
+	}
+	envelope, err := utils.NewConfigUpdateEnvelope(channelID, configUpdate)
+	if err != nil {
+		return nil, err
+	}
+	result.Updated = true
+	if !submit {
+		result.ConfigUpdate = envelope
+		log.Tracef("RPC [%s] <-- %+v", channelID, result)
+		return result, nil
+	}
+
+	sdk := w.ledgerClientWrapper.currentSDK()
+	client, err := resmgmt.New(sdk.Context(fabsdk.WithOrg(w.idClient.GetClientOrg()), fabsdk.WithUser(signer)))
+	if err != nil {
+		return nil, errors.Errorf("Failed to get resource management client. %s", err)
+	}
+	resp, err := client.SaveChannel(resmgmt.SaveChannelRequest{ChannelID: channelID, ChannelConfig: bytes.NewReader(envelope)}, resmgmt.WithParentContext(ctx))
+	if err != nil {
+		log.Errorf("Failed to submit the config update of channel %s. %s", channelID, err)
+		return nil, err
+	}
+	result.TransactionID = string(resp.TransactionID)
+
+	log.Tracef("RPC [%s] <-- %+v", channelID, result)
+	return result, nil
+}
+
+func (w *commonRPCWrapper) QueryBlock(ctx reqContext.Context, channelID string, signer string, blockNumber uint64, blockhash []byte) (*utils.RawBlock, *utils.Block, error) {
 	log.Tracef("RPC [%s] --> QueryBlock %v", channelID, blockNumber)
 
-	rawblock, block, err := w.ledgerClientWrapper.queryBlock(channelID, signer, blockNumber, blockhash)
+	rawblock, block, err := w.ledgerClientWrapper.queryBlock(ctx, channelID, signer, blockNumber, blockhash)
 	if err != nil {
 		log.Errorf("Failed to query block %v on channel %s. %s", blockNumber, channelID, err)
 		return nil, nil, err
@@ -137,10 +300,10 @@ func (w *commonRPCWrapper) QueryBlock(channelID string, signer string, blockNumb
 	return rawblock, block, nil
 }
 
-func (w *commonRPCWrapper) QueryBlockByTxID(channelID string, signer string, txID string) (*utils.RawBlock, *utils.Block, error) {
+func (w *commonRPCWrapper) QueryBlockByTxID(ctx reqContext.Context, channelID string, signer string, txID string) (*utils.RawBlock, *utils.Block, error) {
 	log.Tracef("RPC [%s] --> QueryBlockByTxID %s", channelID, txID)
 
-	rawblock, block, err := w.ledgerClientWrapper.queryBlockByTxID(channelID, signer, txID)
+	rawblock, block, err := w.ledgerClientWrapper.queryBlockByTxID(ctx, channelID, signer, txID)
 	if err != nil {
 		log.Errorf("Failed to query block by transaction Id %s on channel %s. %s", txID, channelID, err)
 		return nil, nil, err
@@ -150,10 +313,10 @@ func (w *commonRPCWrapper) QueryBlockByTxID(channelID string, signer string, txI
 	return rawblock, block, nil
 }
 
-func (w *commonRPCWrapper) QueryTransaction(channelID, signer, txID string) (map[string]interface{}, error) {
+func (w *commonRPCWrapper) QueryTransaction(ctx reqContext.Context, channelID, signer, txID string) (map[string]interface{}, error) {
 	log.Tracef("RPC [%s] --> QueryTransaction %s", channelID, txID)
 
-	result, err := w.ledgerClientWrapper.queryTransaction(channelID, signer, txID)
+	result, err := w.ledgerClientWrapper.queryTransaction(ctx, channelID, signer, txID)
 	if err != nil {
 		log.Errorf("Failed to query transaction on channel %s. %s", channelID, err)
 		return nil, err
@@ -164,8 +327,8 @@ func (w *commonRPCWrapper) QueryTransaction(channelID, signer, txID string) (map
 }
 
 // The returned registration must be closed when done
-func (w *commonRPCWrapper) SubscribeEvent(subInfo *eventsapi.SubscriptionInfo, since uint64) (*RegistrationWrapper, <-chan *fab.BlockEvent, <-chan *fab.CCEvent, error) {
-	reg, blockEventCh, ccEventCh, err := w.eventClientWrapper.subscribeEvent(subInfo, since)
+func (w *commonRPCWrapper) SubscribeEvent(ctx reqContext.Context, subInfo *eventsapi.SubscriptionInfo, since uint64) (*RegistrationWrapper, <-chan *fab.BlockEvent, <-chan *fab.CCEvent, error) {
+	reg, blockEventCh, ccEventCh, err := w.eventClientWrapper.subscribeEvent(ctx, subInfo, since)
 	if err != nil {
 		log.Errorf("Failed to subscribe to event [%s:%s:%s]. %s", subInfo.Stream, subInfo.ChannelID, subInfo.Filter.ChaincodeID, err)
 		return nil, nil, nil, err
@@ -173,6 +336,10 @@ func (w *commonRPCWrapper) SubscribeEvent(subInfo *eventsapi.SubscriptionInfo, s
 	return reg, blockEventCh, ccEventCh, nil
 }
 
+func (w *commonRPCWrapper) BlockCacheStats() *BlockCacheStats {
+	return w.ledgerClientWrapper.blockCache.stats()
+}
+
 func (w *commonRPCWrapper) Unregister(regWrapper *RegistrationWrapper) {
 	regWrapper.eventClient.Unregister(regWrapper.registration)
 }
@@ -76,10 +76,10 @@ func newRPCClientWithClientSideGateway(configProvider core.ConfigProvider, txTim
 	return w, nil
 }
 
-func (w *gwRPCWrapper) Invoke(channelID, signer, chaincodeName, method string, args []string, transientMap map[string]string, isInit bool) (*TxReceipt, error) {
+func (w *gwRPCWrapper) Invoke(ctx context.Context, channelID, signer, chaincodeName, method string, args []string, transientMap map[string]string, isInit bool) (*TxReceipt, error) {
 	log.Tracef("RPC [%s:%s:%s:isInit=%t] --> %+v", channelID, chaincodeName, method, isInit, args)
 
-	result, txStatus, err := w.sendTransaction(channelID, signer, chaincodeName, method, args, transientMap, isInit)
+	result, txStatus, err := w.sendTransaction(ctx, channelID, signer, chaincodeName, method, args, transientMap, isInit)
 	if err != nil {
 		log.Errorf("Failed to send transaction [%s:%s:%s:isInit=%t]. %s", channelID, chaincodeName, method, isInit, err)
 		return nil, err
@@ -93,7 +93,7 @@ func (w *gwRPCWrapper) Invoke(channelID, signer, chaincodeName, method string, a
 	return newReceipt(result, txStatus, signingID.Identifier()), err
 }
 
-func (w *gwRPCWrapper) Query(channelID, signer, chaincodeName, method string, args []string, strongread bool) ([]byte, error) {
+func (w *gwRPCWrapper) Query(ctx context.Context, channelID, signer, chaincodeName, method string, args []string, strongread bool) ([]byte, error) {
 	log.Tracef("RPC [%s:%s:%s] --> %+v", channelID, chaincodeName, method, args)
 
 	client, err := w.getChannelClient(channelID, signer)
@@ -106,6 +106,10 @@ func (w *gwRPCWrapper) Query(channelID, signer, chaincodeName, method string, ar
 		if err != nil {
 			return nil, errors.Errorf("Failed to get gateway client. %s", err)
 		}
+		// the gateway API does not take a context, so the best we can do is not to start
+		if err := ctx.Err(); err != nil {
+			return nil, errors.Errorf("Query [%s:%s:%s] cancelled. %s", channelID, chaincodeName, method, err)
+		}
 		contractClient := client.GetContract(chaincodeName)
 		result, err := contractClient.EvaluateTransaction(method, args...)
 		if err != nil {
@@ -127,7 +131,7 @@ func (w *gwRPCWrapper) Query(channelID, signer, chaincodeName, method string, ar
 		Fcn:         method,
 		Args:        bytes,
 	}
-	result, err := client.Query(req, channel.WithRetry(retry.DefaultChannelOpts), channel.WithTargetEndpoints(peerEndpoint))
+	result, err := client.Query(req, channel.WithParentContext(ctx), channel.WithRetry(retry.DefaultChannelOpts), channel.WithTargetEndpoints(peerEndpoint))
 	if err != nil {
 		log.Errorf("Failed to send query [%s:%s:%s]. %s", channelID, chaincodeName, method, err)
 		return nil, err
@@ -145,33 +149,47 @@ func (w *gwRPCWrapper) SignerUpdated(signer string) {
 	w.mu.Unlock()
 }
 
+func (w *gwRPCWrapper) sdkUpdated(_ *fabsdk.FabricSDK) {
+	// the channel clients are created with the SDK of the ledgerClientWrapper, which is
+	// updated separately, and each gateway loads the connection profile again when created
+	w.mu.Lock()
+	w.gwClients = make(map[string]*gateway.Gateway)
+	w.gwGatewayClients = make(map[string]map[string]*gateway.Network)
+	w.gwChannelClients = make(map[string]map[string]*channel.Client)
+	w.mu.Unlock()
+}
+
 func (w *gwRPCWrapper) Close() error {
+	w.stopEndpointWatcher()
 	// the ledgerClientWrapper and the eventClientWrapper share the same sdk instance
 	// only need to close it from one of them
 	w.ledgerClientWrapper.sdk.Close()
 	return nil
 }
 
-func (w *gwRPCWrapper) sendTransaction(signer, channelID, chaincodeName, method string, args []string, transientMap map[string]string, isInit bool) ([]byte, *fab.TxStatusEvent, error) {
+func (w *gwRPCWrapper) sendTransaction(ctx context.Context, signer, channelID, chaincodeName, method string, args []string, transientMap map[string]string, isInit bool) ([]byte, *fab.TxStatusEvent, error) {
 	convertedMap := convertStringMap(transientMap)
 	tx, notifier, err := w.txPreparer(w, signer, channelID, chaincodeName, method, isInit, convertedMap)
 	if err != nil {
 		return nil, nil, err
 	}
+	// the gateway API does not take a context, so check we still have a caller before submitting
+	if err = ctx.Err(); err != nil {
+		return nil, nil, errors.Errorf("Transaction cancelled before submission (channel=%s, chaincode=%s, func=%s). %s", channelID, chaincodeName, method, err)
+	}
 	var result []byte
 	result, err = w.txSubmitter(tx, args...)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(w.txTimeout)*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(w.txTimeout)*time.Second)
+	defer cancel()
 	select {
 	case txStatus := <-notifier:
-		cancel()
 		return result, txStatus, nil
 	case <-ctx.Done():
-		cancel()
-		return nil, nil, errors.Errorf("Failed to get status event for transaction (channel=%s, chaincode=%s, func=%s)", channelID, chaincodeName, method)
+		return nil, nil, errors.Errorf("Failed to get status event for transaction (channel=%s, chaincode=%s, func=%s). %s", channelID, chaincodeName, method, ctx.Err())
 	}
 }
 
@@ -219,7 +237,7 @@ func (w *gwRPCWrapper) getChannelClient(channelID, signer string) (channelClient
 
 	channelClient = channelClientsForSigner[channelID]
 	if channelClient == nil {
-		sdk := w.ledgerClientWrapper.sdk
+		sdk := w.ledgerClientWrapper.currentSDK()
 		org, err := getOrgFromConfig(w.configProvider)
 		if err != nil {
 			return nil, err
@@ -0,0 +1,309 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	reqContext "context"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/core"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+	log "github.com/sirupsen/logrus"
+)
+
+// defined to allow mocking in tests
+type sdkCreator func(core.ConfigProvider) (*fabsdk.FabricSDK, error)
+
+func createSDK(configProvider core.ConfigProvider) (*fabsdk.FabricSDK, error) {
+	return fabsdk.New(configProvider)
+}
+
+// sdkUpdateListener is implemented by the wrappers that create SDK clients, to switch
+// to a new SDK instance after the network endpoints have changed
+type sdkUpdateListener interface {
+	sdkUpdated(sdk *fabsdk.FabricSDK)
+}
+
+// endpointResolver resolves the peer and orderer endpoints of the connection profile,
+// optionally from SRV records. SRV records are keyed by the name of the peer or orderer
+// in the connection profile, and the target with the highest preference replaces the
+// host and port of the URL of that node
+type endpointResolver struct {
+	srvRecords map[string]string
+	lookupHost func(ctx reqContext.Context, host string) ([]string, error)
+	lookupSRV  func(ctx reqContext.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+func newEndpointResolver(srvRecords map[string]string) *endpointResolver {
+	r := &endpointResolver{
+		srvRecords: make(map[string]string, len(srvRecords)),
+		lookupHost: net.DefaultResolver.LookupHost,
+		lookupSRV:  net.DefaultResolver.LookupSRV,
+	}
+	for name, record := range srvRecords {
+		// the keys of the connection profile are case insensitive
+		r.srvRecords[strings.ToLower(name)] = record
+	}
+	return r
+}
+
+// wrap returns a config provider that substitutes the SRV targets into the URLs of the
+// peers and orderers every time the SDK loads the connection profile
+func (r *endpointResolver) wrap(configProvider core.ConfigProvider) core.ConfigProvider {
+	if len(r.srvRecords) == 0 {
+		return configProvider
+	}
+	return func() ([]core.ConfigBackend, error) {
+		backends, err := configProvider()
+		if err != nil {
+			return nil, err
+		}
+		wrapped := make([]core.ConfigBackend, len(backends))
+		for i, backend := range backends {
+			wrapped[i] = &srvConfigBackend{ConfigBackend: backend, resolver: r}
+		}
+		return wrapped, nil
+	}
+}
+
+func (r *endpointResolver) srvAddress(ctx reqContext.Context, record string) (string, error) {
+	_, targets, err := r.lookupSRV(ctx, "", "", record)
+	if err != nil {
+		return "", err
+	}
+	if len(targets) == 0 {
+		return "", fmt.Errorf("no targets in SRV record %s", record)
+	}
+	// the targets are sorted by priority, and randomized by weight within a priority
+	return net.JoinHostPort(strings.TrimSuffix(targets[0].Target, "."), strconv.Itoa(int(targets[0].Port))), nil
+}
+
+// resolve returns the addresses a node currently resolves to, sorted so that the results
+// of two resolutions can be compared
+func (r *endpointResolver) resolve(ctx reqContext.Context, name, url string) ([]string, error) {
+	var addrs []string
+	if record, ok := r.srvRecords[strings.ToLower(name)]; ok {
+		_, targets, err := r.lookupSRV(ctx, "", "", record)
+		if err != nil {
+			return nil, err
+		}
+		for _, target := range targets {
+			addrs = append(addrs, net.JoinHostPort(strings.TrimSuffix(target.Target, "."), strconv.Itoa(int(target.Port))))
+		}
+	} else {
+		host := endpointHost(url)
+		if net.ParseIP(host) != nil {
+			return []string{host}, nil
+		}
+		var err error
+		if addrs, err = r.lookupHost(ctx, host); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+func endpointHost(url string) string {
+	addr := url
+	if i := strings.Index(addr, "://"); i >= 0 {
+		addr = addr[i+3:]
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+type srvConfigBackend struct {
+	core.ConfigBackend
+	resolver *endpointResolver
+}
+
+func (b *srvConfigBackend) Lookup(key string) (interface{}, bool) {
+	value, ok := b.ConfigBackend.Lookup(key)
+	if !ok || (key != "peers" && key != "orderers") {
+		return value, ok
+	}
+	nodes, isMap := value.(map[string]interface{})
+	if !isMap {
+		return value, ok
+	}
+	result := make(map[string]interface{}, len(nodes))
+	for name, node := range nodes {
+		result[name] = node
+		record, hasRecord := b.resolver.srvRecords[strings.ToLower(name)]
+		nodeConf, isMap := node.(map[string]interface{})
+		if !hasRecord || !isMap {
+			continue
+		}
+		addr, err := b.resolver.srvAddress(reqContext.Background(), record)
+		if err != nil {
+			log.Errorf("Failed to look up SRV record %s for %s, using the URL in the connection profile. %s", record, name, err)
+			continue
+		}
+		scheme := "grpcs://"
+		if url, _ := nodeConf["url"].(string); strings.HasPrefix(url, "grpc://") {
+			scheme = "grpc://"
+		}
+		resolved := make(map[string]interface{}, len(nodeConf))
+		for k, v := range nodeConf {
+			resolved[k] = v
+		}
+		resolved["url"] = scheme + addr
+		result[name] = resolved
+	}
+	return result, true
+}
+
+// endpointWatcher periodically re-resolves the peer and orderer endpoints. When any of
+// them changes, for example because a Kubernetes service was re-created with a new IP,
+// a new SDK instance is created and handed to the listeners, which drop the clients they
+// have cached so that new clients connect to the new addresses.
+// Event registrations made with the previous SDK instance are left to reconnect on their
+// own, so the previous instances are only closed when the watcher is stopped
+type endpointWatcher struct {
+	profile        core.ConfigProvider
+	configProvider core.ConfigProvider
+	resolver       *endpointResolver
+	interval       time.Duration
+	sdkCreator     sdkCreator
+	current        *fabsdk.FabricSDK
+	retired        []*fabsdk.FabricSDK
+	listeners      []sdkUpdateListener
+	resolved       map[string][]string
+	done           chan struct{}
+	stopped        chan struct{}
+}
+
+func newEndpointWatcher(profile, configProvider core.ConfigProvider, resolver *endpointResolver, sdk *fabsdk.FabricSDK, interval time.Duration) *endpointWatcher {
+	return &endpointWatcher{
+		profile:        profile,
+		configProvider: configProvider,
+		resolver:       resolver,
+		interval:       interval,
+		sdkCreator:     createSDK,
+		current:        sdk,
+		done:           make(chan struct{}),
+		stopped:        make(chan struct{}),
+	}
+}
+
+func (w *endpointWatcher) addListener(listener sdkUpdateListener) {
+	w.listeners = append(w.listeners, listener)
+}
+
+func (w *endpointWatcher) start() {
+	w.resolved = w.resolveAll()
+	go w.run()
+}
+
+func (w *endpointWatcher) run() {
+	defer close(w.stopped)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.refresh()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *endpointWatcher) stop() {
+	close(w.done)
+	<-w.stopped
+	for _, sdk := range w.retired {
+		sdk.Close()
+	}
+	w.retired = nil
+}
+
+// refresh re-resolves the endpoints, and switches to a new SDK instance if they changed.
+// Returns true if the switch was made
+func (w *endpointWatcher) refresh() bool {
+	resolved := w.resolveAll()
+	if reflect.DeepEqual(resolved, w.resolved) {
+		return false
+	}
+	for name, addrs := range resolved {
+		if !reflect.DeepEqual(addrs, w.resolved[name]) {
+			log.Infof("Endpoint %s changed from %v to %v", name, w.resolved[name], addrs)
+		}
+	}
+	sdk, err := w.sdkCreator(w.configProvider)
+	if err != nil {
+		// the endpoints are compared again on the next refresh, so this is retried
+		log.Errorf("Failed to re-initialize the SDK after an endpoint change. %s", err)
+		return false
+	}
+	for _, listener := range w.listeners {
+		listener.sdkUpdated(sdk)
+	}
+	w.retired = append(w.retired, w.current)
+	w.current = sdk
+	w.resolved = resolved
+	return true
+}
+
+// resolveAll resolves all peers and orderers in the connection profile. A node that cannot
+// be resolved keeps its previous addresses, so a failed lookup is not treated as a change
+func (w *endpointWatcher) resolveAll() map[string][]string {
+	ctx, cancel := reqContext.WithTimeout(reqContext.Background(), w.interval)
+	defer cancel()
+	resolved := make(map[string][]string)
+	for name, url := range w.endpoints() {
+		addrs, err := w.resolver.resolve(ctx, name, url)
+		if err != nil {
+			log.Warnf("Failed to resolve endpoint %s. %s", name, err)
+			addrs = w.resolved[name]
+		}
+		resolved[name] = addrs
+	}
+	return resolved
+}
+
+func (w *endpointWatcher) endpoints() map[string]string {
+	endpoints := make(map[string]string)
+	backends, err := w.profile()
+	if err != nil {
+		log.Errorf("Failed to read the connection profile. %s", err)
+		return endpoints
+	}
+	for _, key := range []string{"peers", "orderers"} {
+		for _, backend := range backends {
+			value, _ := backend.Lookup(key)
+			nodes, _ := value.(map[string]interface{})
+			for name, node := range nodes {
+				nodeConf, _ := node.(map[string]interface{})
+				if url, ok := nodeConf["url"].(string); ok {
+					endpoints[name] = url
+				}
+			}
+		}
+	}
+	return endpoints
+}
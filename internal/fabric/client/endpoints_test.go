@@ -0,0 +1,210 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	reqContext "context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/event"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/ledger"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/core"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+	"github.com/stretchr/testify/assert"
+)
+
+type mapConfigBackend map[string]interface{}
+
+func (b mapConfigBackend) Lookup(key string) (interface{}, bool) {
+	v, ok := b[key]
+	return v, ok
+}
+
+func testProfile() core.ConfigProvider {
+	return func() ([]core.ConfigBackend, error) {
+		return []core.ConfigBackend{mapConfigBackend{
+			"client.organization": "org1",
+			"peers": map[string]interface{}{
+				"peer0.org1.example.com": map[string]interface{}{
+					"url":         "grpcs://peer0.org1.example.com:7051",
+					"grpcOptions": map[string]interface{}{"ssl-target-name-override": "peer0.org1.example.com"},
+				},
+				"peer1.org1.example.com": map[string]interface{}{
+					"url": "grpc://10.0.0.1:7051",
+				},
+			},
+			"orderers": map[string]interface{}{
+				"orderer.example.com": map[string]interface{}{
+					"url": "orderer.example.com:7050",
+				},
+			},
+		}}, nil
+	}
+}
+
+type recordingSDKListener struct {
+	sdks []*fabsdk.FabricSDK
+}
+
+func (l *recordingSDKListener) sdkUpdated(sdk *fabsdk.FabricSDK) {
+	l.sdks = append(l.sdks, sdk)
+}
+
+func TestEndpointResolverSRV(t *testing.T) {
+	assert := assert.New(t)
+	r := newEndpointResolver(map[string]string{"Peer0.org1.example.com": "_grpcs._tcp.peer0.org1.svc"})
+	r.lookupSRV = func(ctx reqContext.Context, service, proto, name string) (string, []*net.SRV, error) {
+		assert.Equal("_grpcs._tcp.peer0.org1.svc", name)
+		return "", []*net.SRV{
+			{Target: "peer0-1.peer0.org1.svc.", Port: 7051},
+			{Target: "peer0-0.peer0.org1.svc.", Port: 7051},
+		}, nil
+	}
+
+	backends, err := r.wrap(testProfile())()
+	assert.NoError(err)
+	value, ok := backends[0].Lookup("peers")
+	assert.True(ok)
+	peers := value.(map[string]interface{})
+	peer0 := peers["peer0.org1.example.com"].(map[string]interface{})
+	assert.Equal("grpcs://peer0-1.peer0.org1.svc:7051", peer0["url"])
+	assert.NotNil(peer0["grpcOptions"])
+	peer1 := peers["peer1.org1.example.com"].(map[string]interface{})
+	assert.Equal("grpc://10.0.0.1:7051", peer1["url"])
+
+	// the connection profile itself is not modified
+	original, _ := testProfile()()
+	value, _ = original[0].Lookup("peers")
+	assert.Equal("grpcs://peer0.org1.example.com:7051", value.(map[string]interface{})["peer0.org1.example.com"].(map[string]interface{})["url"])
+
+	value, _ = backends[0].Lookup("client.organization")
+	assert.Equal("org1", value)
+
+	addrs, err := r.resolve(reqContext.Background(), "peer0.org1.example.com", "grpcs://peer0.org1.example.com:7051")
+	assert.NoError(err)
+	assert.Equal([]string{"peer0-0.peer0.org1.svc:7051", "peer0-1.peer0.org1.svc:7051"}, addrs)
+}
+
+func TestEndpointResolverSRVFailure(t *testing.T) {
+	assert := assert.New(t)
+	r := newEndpointResolver(map[string]string{"peer0.org1.example.com": "_grpcs._tcp.peer0.org1.svc"})
+	r.lookupSRV = func(ctx reqContext.Context, service, proto, name string) (string, []*net.SRV, error) {
+		return "", nil, nil
+	}
+	_, err := r.srvAddress(reqContext.Background(), "_grpcs._tcp.peer0.org1.svc")
+	assert.Regexp("no targets in SRV record", err)
+
+	// the URL in the connection profile is used instead
+	backends, _ := r.wrap(testProfile())()
+	value, _ := backends[0].Lookup("peers")
+	assert.Equal("grpcs://peer0.org1.example.com:7051", value.(map[string]interface{})["peer0.org1.example.com"].(map[string]interface{})["url"])
+}
+
+func TestEndpointResolverNoSRV(t *testing.T) {
+	assert := assert.New(t)
+	r := newEndpointResolver(nil)
+	profile := testProfile()
+	assert.Equal(fmt.Sprintf("%p", profile), fmt.Sprintf("%p", r.wrap(profile)))
+
+	r.lookupHost = func(ctx reqContext.Context, host string) ([]string, error) {
+		assert.Equal("orderer.example.com", host)
+		return []string{"10.0.0.3", "10.0.0.2"}, nil
+	}
+	addrs, err := r.resolve(reqContext.Background(), "orderer.example.com", "orderer.example.com:7050")
+	assert.NoError(err)
+	assert.Equal([]string{"10.0.0.2", "10.0.0.3"}, addrs)
+
+	addrs, err = r.resolve(reqContext.Background(), "peer1.org1.example.com", "grpc://10.0.0.1:7051")
+	assert.NoError(err)
+	assert.Equal([]string{"10.0.0.1"}, addrs)
+}
+
+func TestEndpointWatcherRefresh(t *testing.T) {
+	assert := assert.New(t)
+	ips := map[string][]string{
+		"peer0.org1.example.com": {"10.0.0.10"},
+		"orderer.example.com":    {"10.0.0.20"},
+	}
+	var lookupErr error
+	r := newEndpointResolver(nil)
+	r.lookupHost = func(ctx reqContext.Context, host string) ([]string, error) {
+		return ips[host], lookupErr
+	}
+	initial := &fabsdk.FabricSDK{}
+	w := newEndpointWatcher(testProfile(), testProfile(), r, initial, time.Hour)
+	var created []*fabsdk.FabricSDK
+	var createErr error
+	w.sdkCreator = func(core.ConfigProvider) (*fabsdk.FabricSDK, error) {
+		if createErr != nil {
+			return nil, createErr
+		}
+		sdk := &fabsdk.FabricSDK{}
+		created = append(created, sdk)
+		return sdk, nil
+	}
+	listener := &recordingSDKListener{}
+	w.addListener(listener)
+	w.resolved = w.resolveAll()
+	assert.Equal([]string{"10.0.0.10"}, w.resolved["peer0.org1.example.com"])
+	assert.Equal([]string{"10.0.0.1"}, w.resolved["peer1.org1.example.com"])
+
+	assert.False(w.refresh())
+
+	// a failed lookup keeps the previous addresses
+	lookupErr = fmt.Errorf("pop")
+	assert.False(w.refresh())
+	lookupErr = nil
+
+	// the SDK is re-created when an address changes, and retried if that fails
+	ips["peer0.org1.example.com"] = []string{"10.0.0.11"}
+	createErr = fmt.Errorf("pop")
+	assert.False(w.refresh())
+	assert.Empty(listener.sdks)
+	createErr = nil
+	assert.True(w.refresh())
+	assert.Equal(1, len(created))
+	assert.Equal(created, listener.sdks)
+	assert.Same(created[0], w.current)
+	assert.Equal([]*fabsdk.FabricSDK{initial}, w.retired)
+	assert.False(w.refresh())
+}
+
+func TestEndpointWatcherStartStop(t *testing.T) {
+	w := newEndpointWatcher(testProfile(), testProfile(), newEndpointResolver(nil), &fabsdk.FabricSDK{}, time.Millisecond)
+	w.resolver.lookupHost = func(ctx reqContext.Context, host string) ([]string, error) {
+		return []string{"10.0.0.10"}, nil
+	}
+	w.start()
+	time.Sleep(5 * time.Millisecond)
+	w.stop()
+}
+
+func TestSDKUpdatedDropsCachedClients(t *testing.T) {
+	assert := assert.New(t)
+	l := &ledgerClientWrapper{ledgerClients: map[string]map[string]*ledger.Client{"user1": {"channel1": {}}}}
+	e := &eventClientWrapper{eventClients: map[string]map[string]*event.Client{"user1": {"channel1": {}}}}
+	sdk := &fabsdk.FabricSDK{}
+	l.sdkUpdated(sdk)
+	e.sdkUpdated(sdk)
+	assert.Same(sdk, l.currentSDK())
+	assert.Empty(l.ledgerClients)
+	assert.Same(sdk, e.sdk)
+	assert.Empty(e.eventClients)
+}
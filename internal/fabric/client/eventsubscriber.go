@@ -17,6 +17,7 @@
 package client
 
 import (
+	reqContext "context"
 	"sync"
 
 	"github.com/hyperledger/fabric-protos-go/common"
@@ -56,13 +57,17 @@ func newEventClient(_ core.ConfigProvider, sdk *fabsdk.FabricSDK, idClient Ident
 	return w
 }
 
-func (e *eventClientWrapper) subscribeEvent(subInfo *eventsapi.SubscriptionInfo, since uint64) (*RegistrationWrapper, <-chan *fab.BlockEvent, <-chan *fab.CCEvent, error) {
-	eventClient, err := e.getEventClient(subInfo.ChannelID, subInfo.Signer, since, subInfo.Filter.ChaincodeID)
+func (e *eventClientWrapper) subscribeEvent(ctx reqContext.Context, subInfo *eventsapi.SubscriptionInfo, since uint64) (*RegistrationWrapper, <-chan *fab.BlockEvent, <-chan *fab.CCEvent, error) {
+	// the owner of the subscription may have gone away (e.g. the stream was deleted) while we were waiting
+	if err := ctx.Err(); err != nil {
+		return nil, nil, nil, errors.Errorf("Subscription to channel %s cancelled. %s", subInfo.ChannelID, err)
+	}
+	eventClient, err := e.getEventClient(subInfo.ChannelID, subInfo.Signer, since, subInfo.Filter.ChaincodeID, subInfo.Deliver == eventsapi.DeliverFiltered)
 	if err != nil {
 		log.Errorf("Failed to get event client. %s", err)
 		return nil, nil, nil, errors.Errorf("Failed to get event client. %s", err)
 	}
-	if subInfo.Filter.ChaincodeID != "" {
+	if subInfo.RegistersChaincodeEvents() {
 		reg, notifier, err := eventClient.RegisterChaincodeEvent(subInfo.Filter.ChaincodeID, subInfo.Filter.EventFilter)
 		if err != nil {
 			return nil, nil, nil, errors.Errorf("Failed to subscribe to chaincode %s events. %s", subInfo.Filter.ChaincodeID, err)
@@ -81,6 +86,7 @@ func (e *eventClientWrapper) subscribeEvent(subInfo *eventsapi.SubscriptionInfo,
 	} else if blockType == eventsapi.BlockTypeConfig {
 		blockfilter = headertypefilter.New(common.HeaderType_CONFIG, common.HeaderType_CONFIG_UPDATE)
 	}
+	// with no filter, as for the "all" block type, every block is received
 
 	reg, notifier, err := eventClient.RegisterBlockEvent(blockfilter)
 	if err != nil {
@@ -94,7 +100,9 @@ func (e *eventClientWrapper) subscribeEvent(subInfo *eventsapi.SubscriptionInfo,
 	return regWrapper, notifier, nil, nil
 }
 
-func (e *eventClientWrapper) getEventClient(channelID, signer string, since uint64, chaincodeID string) (eventClient *event.Client, err error) {
+// getEventClient returns the event client of the full deliver service of the peers, or of the
+// filtered deliver service, whose blocks omit the payloads of the chaincode events
+func (e *eventClientWrapper) getEventClient(channelID, signer string, since uint64, chaincodeID string, filtered bool) (eventClient *event.Client, err error) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	eventClientsForSigner := e.eventClients[signer]
@@ -102,14 +110,16 @@ func (e *eventClientWrapper) getEventClient(channelID, signer string, since uint
 		eventClientsForSigner = make(map[string]*event.Client)
 		e.eventClients[signer] = eventClientsForSigner
 	}
-	key := eventsapi.GetKeyForEventClient(channelID, chaincodeID)
+	key := eventsapi.GetKeyForEventClient(channelID, chaincodeID, filtered)
 	eventClient = eventClientsForSigner[key]
 	if eventClient == nil {
 		eventOpts := []event.ClientOption{
-			event.WithBlockEvents(),
 			event.WithSeekType(seek.FromBlock),
 			event.WithBlockNum(since),
 		}
+		if !filtered {
+			eventOpts = append(eventOpts, event.WithBlockEvents())
+		}
 		if chaincodeID != "" {
 			eventOpts = append(eventOpts, event.WithChaincodeID(chaincodeID))
 		}
@@ -129,6 +139,13 @@ func (e *eventClientWrapper) SignerUpdated(signer string) {
 	e.mu.Unlock()
 }
 
+func (e *eventClientWrapper) sdkUpdated(sdk *fabsdk.FabricSDK) {
+	e.mu.Lock()
+	e.sdk = sdk
+	e.eventClients = make(map[string]map[string]*event.Client)
+	e.mu.Unlock()
+}
+
 func createEventClient(channelProvider context.ChannelProvider, eventOpts ...event.ClientOption) (*event.Client, error) {
 	return event.New(channelProvider, eventOpts...)
 }
@@ -55,7 +55,7 @@ type idClientWrapper struct {
 	cache          *lru.Cache[string, msp.SigningIdentity]
 }
 
-func newIdentityClient(configProvider core.ConfigProvider, userStore msp.UserStore) (*idClientWrapper, error) {
+func newIdentityClient(configProvider core.ConfigProvider, userStore msp.UserStore, caProxies map[string]string) (*idClientWrapper, error) {
 	configBackend, _ := configProvider()
 	cryptoConfig := cryptosuite.ConfigFromBackend(configBackend...)
 	cs, err := sw.GetSuiteByConfig(cryptoConfig)
@@ -79,6 +79,11 @@ func newIdentityClient(configProvider core.ConfigProvider, userStore msp.UserSto
 		return nil, errors.Errorf("Identity manager creation failed. %s", err)
 	}
 
+	caIdentityConfig, err := newCAProxyConfig(identityConfig, caProxies)
+	if err != nil {
+		return nil, err
+	}
+
 	identityManagerProvider := &identityManagerProvider{
 		identityManager: mgr,
 	}
@@ -88,7 +93,7 @@ func newIdentityClient(configProvider core.ConfigProvider, userStore msp.UserSto
 		fabcontext.WithCryptoSuite(cs),
 		fabcontext.WithCryptoSuiteConfig(cryptoConfig),
 		fabcontext.WithEndpointConfig(endpointConfig),
-		fabcontext.WithIdentityConfig(identityConfig),
+		fabcontext.WithIdentityConfig(caIdentityConfig),
 	)
 	ctx := &fabcontext.Client{
 		Providers: ctxProvider,
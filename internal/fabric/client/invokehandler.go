@@ -17,17 +17,48 @@
 package client
 
 import (
+	reqContext "context"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/common"
 	pb "github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel/invoke"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
 	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	broadcastRetryInitialDelay = 250 * time.Millisecond
+	broadcastRetryMaxDelay     = 5 * time.Second
 )
 
+// broadcastRetry is how the broadcast of a transaction is retried while the orderers are unavailable
+type broadcastRetry struct {
+	timeout  time.Duration // 0 disables the retries
+	strategy string        // "exponential" (default), "linear" or "fixed"
+	jitter   float64
+}
+
+func (r *broadcastRetry) backoff() *utils.Backoff {
+	return &utils.Backoff{
+		Strategy: r.strategy,
+		Initial:  broadcastRetryInitialDelay,
+		Factor:   2,
+		Max:      broadcastRetryMaxDelay,
+		Jitter:   r.jitter,
+	}
+}
+
 // adapted from the CommitHandler in https://github.com/hyperledger/fabric-sdk-go
 // in order to custom process the transaction status event
 type TxSubmitAndListenHandler struct {
 	txStatusEvent *fab.TxStatusEvent
+	// how to retry the broadcast while the orderers are unavailable, set for SmartBFT channels
+	broadcastRetry broadcastRetry
 }
 
 func NewTxSubmitAndListenHandler(txStatus *fab.TxStatusEvent) *TxSubmitAndListenHandler {
@@ -47,7 +78,7 @@ func (h *TxSubmitAndListenHandler) Handle(requestContext *invoke.RequestContext,
 	}
 	defer clientContext.EventService.Unregister(reg)
 
-	_, err = createAndSendTransaction(clientContext.Transactor, requestContext.Response.Proposal, requestContext.Response.Responses)
+	_, err = createAndSendTransaction(requestContext.Ctx, clientContext.Transactor, requestContext.Response.Proposal, requestContext.Response.Responses, h.broadcastRetry)
 	if err != nil {
 		requestContext.Error = errors.Errorf("CreateAndSendTransaction failed. %s", err)
 		return
@@ -78,7 +109,10 @@ func (h *TxSubmitAndListenHandler) Handle(requestContext *invoke.RequestContext,
 	}
 }
 
-func createAndSendTransaction(sender fab.Sender, proposal *fab.TransactionProposal, resps []*fab.TransactionProposalResponse) (*fab.TransactionResponse, error) {
+// createAndSendTransaction broadcasts the transaction to the orderers, which the SDK tries in turn
+// until one accepts it. While SmartBFT orderers change leader, all of them reject transactions as
+// unavailable, so the broadcast is retried until the retry timeout, rather than failing the transaction
+func createAndSendTransaction(ctx reqContext.Context, sender fab.Sender, proposal *fab.TransactionProposal, resps []*fab.TransactionProposalResponse, retry broadcastRetry) (*fab.TransactionResponse, error) {
 
 	txnRequest := fab.TransactionRequest{
 		Proposal:          proposal,
@@ -90,11 +124,48 @@ func createAndSendTransaction(sender fab.Sender, proposal *fab.TransactionPropos
 		return nil, errors.Errorf("Create Transaction failed: %s", err)
 	}
 
-	transactionResponse, err := sender.SendTransaction(tx)
-	if err != nil {
-		return nil, errors.Errorf("Send Transaction failed: %s", err)
-
+	deadline := time.Now().Add(retry.timeout)
+	backoff := retry.backoff()
+	for attempt := 1; ; attempt++ {
+		transactionResponse, err := sender.SendTransaction(tx)
+		if err == nil {
+			return transactionResponse, nil
+		}
+		delay := backoff.Delay(attempt)
+		if !isOrdererUnavailable(err) || time.Now().Add(delay).After(deadline) {
+			return nil, errors.Errorf("Send Transaction failed: %s", err)
+		}
+		log.Warnf("Orderers unavailable to order transaction %s, retrying in %s (attempt %d). %s", proposal.TxnID, delay, attempt, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, errors.Errorf("Send Transaction failed: %s", err)
+		}
 	}
+}
 
-	return transactionResponse, nil
+// isOrdererUnavailable returns true for broadcasts rejected because the orderers have no leader
+// to order them, or could not be reached. The SDK returns the error of the last orderer tried
+func isOrdererUnavailable(err error) bool {
+	s, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+	switch s.Group {
+	case status.OrdererServerStatus:
+		return s.Code == int32(common.Status_SERVICE_UNAVAILABLE)
+	case status.GRPCTransportStatus:
+		return s.Code == int32(codes.Unavailable)
+	case status.OrdererClientStatus:
+		return s.Code == status.ConnectionFailed.ToInt32()
+	case status.ClientStatus:
+		if s.Code == status.MultipleErrors.ToInt32() {
+			for _, detail := range s.Details {
+				if detailErr, ok := detail.(error); ok && isOrdererUnavailable(detailErr) {
+					return true
+				}
+			}
+		}
+	}
+	return false
 }
@@ -0,0 +1,117 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	reqContext "context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/multi"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/firefly-fabconnect/internal/utils"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+)
+
+// testSender fails the broadcast of the transaction with the queued errors, then accepts it
+type testSender struct {
+	errs  []error
+	sends int
+}
+
+func (s *testSender) CreateTransaction(request fab.TransactionRequest) (*fab.Transaction, error) {
+	return &fab.Transaction{Proposal: request.Proposal}, nil
+}
+
+func (s *testSender) SendTransaction(tx *fab.Transaction) (*fab.TransactionResponse, error) {
+	s.sends++
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return nil, err
+	}
+	return &fab.TransactionResponse{Orderer: "orderer0:7050"}, nil
+}
+
+func unavailableErr() error {
+	err := status.New(status.OrdererServerStatus, int32(common.Status_SERVICE_UNAVAILABLE), "no leader", nil)
+	return errors.Wrapf(multi.New(errors.Wrap(err, "broadcast recv failed")), "calling orderer '%s' failed", "orderer0:7050")
+}
+
+func TestIsOrdererUnavailable(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(isOrdererUnavailable(unavailableErr()))
+	assert.True(isOrdererUnavailable(status.New(status.GRPCTransportStatus, int32(codes.Unavailable), "connection refused", nil)))
+	assert.True(isOrdererUnavailable(status.New(status.OrdererClientStatus, status.ConnectionFailed.ToInt32(), "dial failed", nil)))
+	assert.True(isOrdererUnavailable(multi.Errors{fmt.Errorf("pop"), unavailableErr()}))
+	assert.False(isOrdererUnavailable(status.New(status.OrdererServerStatus, int32(common.Status_BAD_REQUEST), "bad signature", nil)))
+	assert.False(isOrdererUnavailable(status.New(status.GRPCTransportStatus, int32(codes.PermissionDenied), "denied", nil)))
+	assert.False(isOrdererUnavailable(fmt.Errorf("pop")))
+}
+
+func TestSendTransactionRetriesUnavailableOrderers(t *testing.T) {
+	assert := assert.New(t)
+	proposal := &fab.TransactionProposal{TxnID: "tx1"}
+
+	sender := &testSender{errs: []error{unavailableErr(), unavailableErr()}}
+	res, err := createAndSendTransaction(reqContext.Background(), sender, proposal, nil, broadcastRetry{timeout: 10 * time.Second})
+	assert.NoError(err)
+	assert.Equal("orderer0:7050", res.Orderer)
+	assert.Equal(3, sender.sends)
+
+	// not retried without a timeout, as for channels that are not ordered by SmartBFT
+	sender = &testSender{errs: []error{unavailableErr()}}
+	_, err = createAndSendTransaction(reqContext.Background(), sender, proposal, nil, broadcastRetry{})
+	assert.Regexp("Send Transaction failed.*SERVICE_UNAVAILABLE", err)
+	assert.Equal(1, sender.sends)
+
+	// nor are errors other than the orderers being unavailable
+	sender = &testSender{errs: []error{status.New(status.OrdererServerStatus, int32(common.Status_BAD_REQUEST), "bad signature", nil)}}
+	_, err = createAndSendTransaction(reqContext.Background(), sender, proposal, nil, broadcastRetry{timeout: 10 * time.Second})
+	assert.Regexp("bad signature", err)
+	assert.Equal(1, sender.sends)
+
+	ctx, cancel := reqContext.WithCancel(reqContext.Background())
+	cancel()
+	sender = &testSender{errs: []error{unavailableErr(), unavailableErr()}}
+	_, err = createAndSendTransaction(ctx, sender, proposal, nil, broadcastRetry{timeout: 10 * time.Second})
+	assert.Regexp("SERVICE_UNAVAILABLE", err)
+	assert.Equal(1, sender.sends)
+}
+
+func TestSendTransactionRetryStrategy(t *testing.T) {
+	assert := assert.New(t)
+	retry := broadcastRetry{strategy: utils.RetryStrategyFixed, jitter: 0.5}
+	backoff := retry.backoff()
+	for attempt := 1; attempt <= 5; attempt++ {
+		delay := backoff.Delay(attempt)
+		assert.GreaterOrEqual(delay, broadcastRetryInitialDelay/2)
+		assert.LessOrEqual(delay, broadcastRetryInitialDelay*3/2)
+	}
+	retry = broadcastRetry{}
+	assert.Equal(broadcastRetryMaxDelay, retry.backoff().Delay(10))
+
+	sender := &testSender{errs: []error{unavailableErr()}}
+	_, err := createAndSendTransaction(reqContext.Background(), sender, &fab.TransactionProposal{TxnID: "tx1"}, nil, broadcastRetry{timeout: 10 * time.Second, strategy: utils.RetryStrategyLinear})
+	assert.NoError(err)
+	assert.Equal(2, sender.sends)
+}
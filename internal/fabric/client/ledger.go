@@ -17,8 +17,10 @@
 package client
 
 import (
+	reqContext "context"
 	"sync"
 
+	"github.com/golang/protobuf/proto" //nolint
 	"github.com/hyperledger/fabric-protos-go/common"
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/ledger"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/context"
@@ -38,33 +40,41 @@ type ledgerClientWrapper struct {
 	sdk                 *fabsdk.FabricSDK
 	idClient            IdentityClient
 	ledgerClientCreator ledgerClientCreator
+	blockCache          *blockCache
 	mu                  sync.Mutex
 }
 
-func newLedgerClient(_ core.ConfigProvider, sdk *fabsdk.FabricSDK, idClient IdentityClient) *ledgerClientWrapper {
+func newLedgerClient(_ core.ConfigProvider, sdk *fabsdk.FabricSDK, idClient IdentityClient, blockCacheSizeMB int) *ledgerClientWrapper {
 	w := &ledgerClientWrapper{
 		sdk:                 sdk,
 		idClient:            idClient,
 		ledgerClients:       make(map[string]map[string]*ledger.Client),
 		ledgerClientCreator: createLedgerClient,
+		blockCache:          newBlockCache(int64(blockCacheSizeMB) * 1024 * 1024),
 	}
 	idClient.AddSignerUpdateListener(w)
 	return w
 }
 
-func (l *ledgerClientWrapper) queryChainInfo(channelID, signer string) (*fab.BlockchainInfoResponse, error) {
+func (l *ledgerClientWrapper) queryChainInfo(ctx reqContext.Context, channelID, signer string) (*fab.BlockchainInfoResponse, error) {
 	client, err := l.getLedgerClient(channelID, signer)
 	if err != nil {
 		return nil, errors.Errorf("Failed to get channel client. %s", err)
 	}
-	result, err := client.QueryInfo()
+	result, err := client.QueryInfo(ledger.WithParentContext(ctx))
 	if err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
-func (l *ledgerClientWrapper) queryBlock(channelID string, signer string, blockNumber uint64, blockhash []byte) (*utils.RawBlock, *utils.Block, error) {
+func (l *ledgerClientWrapper) queryBlock(ctx reqContext.Context, channelID string, signer string, blockNumber uint64, blockhash []byte) (*utils.RawBlock, *utils.Block, error) {
+	cacheable := blockhash == nil && l.blockCache.enabled()
+	if cacheable {
+		if rawblock, block, ok := l.blockCache.get(channelID, blockNumber); ok {
+			return rawblock, block, nil
+		}
+	}
 	client, err := l.getLedgerClient(channelID, signer)
 	if err != nil {
 		return nil, nil, errors.Errorf("Failed to get channel client. %s", err)
@@ -72,23 +82,27 @@ func (l *ledgerClientWrapper) queryBlock(channelID string, signer string, blockN
 	var result *common.Block
 	var err1 error
 	if blockhash == nil {
-		result, err1 = client.QueryBlock(blockNumber)
+		result, err1 = client.QueryBlock(blockNumber, ledger.WithParentContext(ctx))
 	} else {
-		result, err1 = client.QueryBlockByHash(blockhash)
+		result, err1 = client.QueryBlockByHash(blockhash, ledger.WithParentContext(ctx))
 	}
 	if err1 != nil {
 		return nil, nil, err1
 	}
 	rawblock, block, err := utils.DecodeBlock(result)
+	if err == nil && cacheable {
+		// the encoded size is a reasonable proxy for the memory held by the decoded block
+		l.blockCache.add(channelID, blockNumber, int64(proto.Size(result)), rawblock, block)
+	}
 	return rawblock, block, err
 }
 
-func (l *ledgerClientWrapper) queryBlockByTxID(channelID string, signer string, txID string) (*utils.RawBlock, *utils.Block, error) {
+func (l *ledgerClientWrapper) queryBlockByTxID(ctx reqContext.Context, channelID string, signer string, txID string) (*utils.RawBlock, *utils.Block, error) {
 	client, err := l.getLedgerClient(channelID, signer)
 	if err != nil {
 		return nil, nil, errors.Errorf("Failed to get channel client. %s", err)
 	}
-	result, err := client.QueryBlockByTxID(fab.TransactionID(txID))
+	result, err := client.QueryBlockByTxID(fab.TransactionID(txID), ledger.WithParentContext(ctx))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -96,13 +110,13 @@ func (l *ledgerClientWrapper) queryBlockByTxID(channelID string, signer string,
 	return rawblock, block, err
 }
 
-func (l *ledgerClientWrapper) queryTransaction(channelID, signer, txID string) (map[string]interface{}, error) {
+func (l *ledgerClientWrapper) queryTransaction(ctx reqContext.Context, channelID, signer, txID string) (map[string]interface{}, error) {
 	client, err := l.getLedgerClient(channelID, signer)
 	if err != nil {
 		return nil, errors.Errorf("Failed to get channel client. %s", err)
 	}
 	fabTxID := fab.TransactionID(txID)
-	result, err := client.QueryTransaction(fabTxID)
+	result, err := client.QueryTransaction(fabTxID, ledger.WithParentContext(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -118,6 +132,14 @@ func (l *ledgerClientWrapper) queryTransaction(channelID, signer, txID string) (
 	return ret, nil
 }
 
+func (l *ledgerClientWrapper) queryConfigBlock(ctx reqContext.Context, channelID, signer string) (*common.Block, error) {
+	client, err := l.getLedgerClient(channelID, signer)
+	if err != nil {
+		return nil, errors.Errorf("Failed to get channel client. %s", err)
+	}
+	return client.QueryConfigBlock(ledger.WithParentContext(ctx))
+}
+
 func (l *ledgerClientWrapper) getLedgerClient(channelID, signer string) (ledgerClient *ledger.Client, err error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
@@ -144,6 +166,20 @@ func (l *ledgerClientWrapper) SignerUpdated(signer string) {
 	l.mu.Unlock()
 }
 
+func (l *ledgerClientWrapper) sdkUpdated(sdk *fabsdk.FabricSDK) {
+	l.mu.Lock()
+	l.sdk = sdk
+	// committed blocks do not change, so the block cache is still valid
+	l.ledgerClients = make(map[string]map[string]*ledger.Client)
+	l.mu.Unlock()
+}
+
+func (l *ledgerClientWrapper) currentSDK() *fabsdk.FabricSDK {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sdk
+}
+
 func createLedgerClient(channelProvider context.ChannelProvider, opts ...ledger.ClientOption) (*ledger.Client, error) {
 	return ledger.New(channelProvider, opts...)
 }
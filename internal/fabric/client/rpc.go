@@ -17,11 +17,13 @@
 package client
 
 import (
+	"time"
+
 	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
-	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
 	"github.com/hyperledger/firefly-fabconnect/internal/conf"
 	"github.com/hyperledger/firefly-fabconnect/internal/errors"
 	"github.com/hyperledger/firefly-fabconnect/internal/rest/identity"
+	"github.com/hyperledger/firefly-fabconnect/internal/utils"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -31,20 +33,39 @@ import (
 // - "useGatewayClient: false": returned RPCClient uses a static network map described by the Connection Profile
 // - "useGatewayServer: true": for Fabric 2.4 node only, the returned RPCClient utilizes the server-side gateway service
 func RPCConnect(c conf.RPCConf, txTimeout int) (RPCClient, identity.Client, error) {
-	configProvider := config.FromFile(c.ConfigPath)
+	profile := config.FromFile(c.ConfigPath)
+	resolver := newEndpointResolver(c.SRVRecords)
+	configProvider := resolver.wrap(profile)
 	userStore, err := newUserstore(configProvider)
 	if err != nil {
 		return nil, nil, errors.Errorf("User credentials store creation failed. %s", err)
 	}
-	identityClient, err := newIdentityClient(configProvider, userStore)
+	identityClient, err := newIdentityClient(configProvider, userStore, c.CAProxies)
 	if err != nil {
 		return nil, nil, err
 	}
-	sdk, err := fabsdk.New(configProvider)
+	retryStrategy, err := utils.ValidateRetryStrategy(c.BroadcastRetryStrategy, c.BroadcastRetryJitter)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.SmartBFT && (c.UseGatewayClient || c.UseGatewayServer) {
+		log.Warn("Retrying transactions rejected by SmartBFT orderers during a leader change is only supported in the static connection profile mode")
+	}
+	newSDK := createSDK
+	var chConfigWatcher *channelConfigWatcher
+	if c.ChannelConfigRefreshIntervalSec > 0 {
+		if c.UseGatewayClient || c.UseGatewayServer {
+			log.Warn("Reading the orderers from the channel config blocks is only supported in the static connection profile mode")
+		} else {
+			chConfigWatcher = newChannelConfigWatcher(time.Duration(c.ChannelConfigRefreshIntervalSec) * time.Second)
+			newSDK = chConfigWatcher.sdkCreator()
+		}
+	}
+	sdk, err := newSDK(configProvider)
 	if err != nil {
 		return nil, nil, errors.Errorf("Failed to initialize a new SDK instance. %s", err)
 	}
-	ledgerClient := newLedgerClient(configProvider, sdk, identityClient)
+	ledgerClient := newLedgerClient(configProvider, sdk, identityClient, c.BlockCacheSizeMB)
 	eventClient := newEventClient(configProvider, sdk, identityClient)
 	var rpcClient RPCClient
 	if !c.UseGatewayClient && !c.UseGatewayServer {
@@ -53,6 +74,16 @@ func RPCConnect(c conf.RPCConf, txTimeout int) (RPCClient, identity.Client, erro
 			return nil, nil, err
 		}
 		log.Info("Using static connection profile mode of the RPC client")
+		rpcClient.(*ccpRPCWrapper).setSmartBFT(c.SmartBFT, broadcastRetry{
+			timeout:  time.Duration(c.BroadcastRetryTimeoutSec) * time.Second,
+			strategy: retryStrategy,
+			jitter:   c.BroadcastRetryJitter,
+		})
+		if chConfigWatcher != nil {
+			rpcClient.(*ccpRPCWrapper).setChannelConfigWatcher(chConfigWatcher)
+			chConfigWatcher.start(ledgerClient)
+			log.Infof("Reading the orderers from the channel config blocks every %d seconds", c.ChannelConfigRefreshIntervalSec)
+		}
 	} else if c.UseGatewayClient {
 		rpcClient, err = newRPCClientWithClientSideGateway(configProvider, txTimeout, identityClient, ledgerClient, eventClient)
 		if err != nil {
@@ -60,5 +91,20 @@ func RPCConnect(c conf.RPCConf, txTimeout int) (RPCClient, identity.Client, erro
 		}
 		log.Info("Using client-side gateway mode of the RPC client")
 	}
+	if c.EndpointRefreshIntervalSec > 0 && rpcClient != nil {
+		watcher := newEndpointWatcher(profile, configProvider, resolver, sdk, time.Duration(c.EndpointRefreshIntervalSec)*time.Second)
+		watcher.sdkCreator = newSDK
+		// the ledger client goes first, as the gateway client creates its channel clients with its SDK
+		watcher.addListener(ledgerClient)
+		watcher.addListener(eventClient)
+		if listener, ok := rpcClient.(sdkUpdateListener); ok {
+			watcher.addListener(listener)
+		}
+		if owner, ok := rpcClient.(interface{ setEndpointWatcher(*endpointWatcher) }); ok {
+			owner.setEndpointWatcher(watcher)
+		}
+		watcher.start()
+		log.Infof("Re-resolving peer and orderer endpoints every %d seconds", c.EndpointRefreshIntervalSec)
+	}
 	return rpcClient, identityClient, nil
 }
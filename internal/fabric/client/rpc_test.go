@@ -17,6 +17,7 @@
 package client
 
 import (
+	reqContext "context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -25,6 +26,7 @@ import (
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/event"
@@ -248,7 +250,7 @@ func TestGatewayClientSendTx(t *testing.T) {
 
 	testmap := make(map[string]string)
 	testmap["entry-1"] = "value-1"
-	_, _, err = wrapper.sendTransaction("signer1", "channel-1", "chaincode-1", "method-1", []string{"args-1"}, testmap, false)
+	_, _, err = wrapper.sendTransaction(reqContext.Background(), "signer1", "channel-1", "chaincode-1", "method-1", []string{"args-1"}, testmap, false)
 	assert.NoError(err)
 }
 
@@ -284,10 +286,49 @@ func TestGatewayClientSendInitTx(t *testing.T) {
 
 	testmap := make(map[string]string)
 	testmap["entry-1"] = "value-1"
-	_, _, err = wrapper.sendTransaction("signer1", "channel-1", "chaincode-1", "method-1", []string{"args-1"}, testmap, true)
+	_, _, err = wrapper.sendTransaction(reqContext.Background(), "signer1", "channel-1", "chaincode-1", "method-1", []string{"args-1"}, testmap, true)
 	assert.NoError(err)
 }
 
+func TestGatewayClientSendTxCancelled(t *testing.T) {
+	assert := assert.New(t)
+
+	config := conf.RPCConf{
+		UseGatewayClient: true,
+		ConfigPath:       tmpShortCCPFile,
+	}
+	rpc, _, err := RPCConnect(config, 5)
+	assert.NoError(err)
+
+	wrapper, ok := rpc.(*gwRPCWrapper)
+	assert.True(ok)
+	submitted := false
+	wrapper.txPreparer = func(w *gwRPCWrapper, signer, channelId, chaincodeName, method string, isInit bool, transientMap map[string][]byte) (*gateway.Transaction, <-chan *fab.TxStatusEvent, error) {
+		return nil, make(chan *fab.TxStatusEvent), nil
+	}
+	wrapper.txSubmitter = func(tx *gateway.Transaction, args ...string) ([]byte, error) {
+		submitted = true
+		return []byte(""), nil
+	}
+
+	// a caller that has already gone away does not get the transaction submitted
+	ctx, cancel := reqContext.WithCancel(reqContext.Background())
+	cancel()
+	_, _, err = wrapper.sendTransaction(ctx, "signer1", "channel-1", "chaincode-1", "method-1", []string{"args-1"}, nil, false)
+	assert.Regexp("Transaction cancelled before submission", err)
+	assert.False(submitted)
+
+	// a caller that goes away while waiting stops the wait for the commit event
+	ctx, cancel = reqContext.WithCancel(reqContext.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, _, err = wrapper.sendTransaction(ctx, "signer1", "channel-1", "chaincode-1", "method-1", []string{"args-1"}, nil, false)
+	assert.Regexp("Failed to get status event for transaction.*context canceled", err)
+	assert.True(submitted)
+}
+
 func TestChannelClientInstantiation(t *testing.T) {
 	assert := assert.New(t)
 
@@ -336,14 +377,14 @@ func TestEventClientInstantiation(t *testing.T) {
 	assert.True(ok)
 
 	wrapper.eventClientWrapper.eventClientCreator = createMockEventClient
-	client1, err := wrapper.eventClientWrapper.getEventClient("default-channel", "user1", uint64(0), "chaincode-1")
+	client1, err := wrapper.eventClientWrapper.getEventClient("default-channel", "user1", uint64(0), "chaincode-1", false)
 	assert.NoError(err)
 	assert.NotNil(client1)
 	assert.Equal(1, len(wrapper.eventClientWrapper.eventClients))
 	assert.Equal(1, len(wrapper.eventClientWrapper.eventClients["user1"]))
 	assert.Equal(client1, wrapper.eventClientWrapper.eventClients["user1"]["default-channel-chaincode-1"])
 
-	client2, err := wrapper.eventClientWrapper.getEventClient("default-channel", "user1", uint64(0), "chaincode-2")
+	client2, err := wrapper.eventClientWrapper.getEventClient("default-channel", "user1", uint64(0), "chaincode-2", false)
 	assert.NoError(err)
 	assert.NotNil(client2)
 	assert.Equal(1, len(wrapper.eventClientWrapper.eventClients))
@@ -352,6 +393,13 @@ func TestEventClientInstantiation(t *testing.T) {
 
 	assert.NotEqual(fmt.Sprintf("%p", client1), fmt.Sprintf("%p", client2))
 
+	// the filtered deliver service needs a client of its own
+	client3, err := wrapper.eventClientWrapper.getEventClient("default-channel", "user1", uint64(0), "chaincode-1", true)
+	assert.NoError(err)
+	assert.Equal(3, len(wrapper.eventClientWrapper.eventClients["user1"]))
+	assert.Equal(client3, wrapper.eventClientWrapper.eventClients["user1"]["default-channel-chaincode-1-filtered"])
+	assert.NotEqual(fmt.Sprintf("%p", client1), fmt.Sprintf("%p", client3))
+
 	idcWrapper := wrapper.eventClientWrapper.idClient.(*idClientWrapper)
 	assert.Equal(3, len(idcWrapper.listeners))
 
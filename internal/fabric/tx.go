@@ -63,12 +63,12 @@ func (tx *Tx) GetTXReceipt(_ context.Context, _ fabricClient.RPCClient) (bool, e
 }
 
 // Send sends an individual transaction
-func (tx *Tx) Send(_ context.Context, rpc fabricClient.RPCClient) error {
+func (tx *Tx) Send(ctx context.Context, rpc fabricClient.RPCClient) error {
 	start := time.Now().UTC()
 
 	var receipt *fabricClient.TxReceipt
 	var err error
-	receipt, err = rpc.Invoke(tx.ChannelID, tx.Signer, tx.ChaincodeName, tx.Function, tx.Args, tx.TransientMap, tx.IsInit)
+	receipt, err = rpc.Invoke(ctx, tx.ChannelID, tx.Signer, tx.ChaincodeName, tx.Function, tx.Args, tx.TransientMap, tx.IsInit)
 	tx.lock.Lock()
 	tx.Receipt = receipt
 	tx.lock.Unlock()
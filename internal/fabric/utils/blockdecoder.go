@@ -24,11 +24,14 @@ import (
 
 	"github.com/golang/protobuf/proto" //nolint
 	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
 	"github.com/hyperledger/fabric-protos-go/msp"
 	"github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/hyperledger/fabric-protos-go/peer/lifecycle"
 	"github.com/hyperledger/firefly-fabconnect/internal/events/api"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 )
 
 func GetEvents(block *common.Block) []*api.EventEntry {
@@ -37,9 +40,32 @@ func GetEvents(block *common.Block) []*api.EventEntry {
 	if err != nil {
 		return events
 	}
+	// the events of invalidated transactions are included, with their validation code
+	txFilter := block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
 	for idx, entry := range rawBlock.Data.Data {
 		timestamp := entry.Payload.Header.ChannelHeader.Timestamp
 		txID := entry.Payload.Header.ChannelHeader.TxID
+		if entry.Payload.Header.ChannelHeader.Type == common.HeaderType_CONFIG.String() {
+			// config blocks have a single event, with the changes to the config of the channel
+			delta, err := GetConfigDelta(block)
+			if err != nil {
+				log.Errorf("Failed to decode the config update in block %d: %s", rawBlock.Header.Number, err)
+				continue
+			}
+			eventEntry := api.EventEntry{
+				BlockNumber:      rawBlock.Header.Number,
+				TransactionID:    txID,
+				TransactionIndex: idx,
+				EventName:        api.ConfigUpdateEventName,
+				Payload:          delta,
+				Timestamp:        timestamp,
+			}
+			if idx < len(txFilter) {
+				eventEntry.TransactionStatus = peer.TxValidationCode(txFilter[idx]).String()
+			}
+			events = append(events, &eventEntry)
+			continue
+		}
 		actions := entry.Payload.Data.Actions
 		for actionIdx, action := range actions {
 			event := action.Payload.Action.ProposalResponsePayload.Extension.Events
@@ -58,6 +84,10 @@ func GetEvents(block *common.Block) []*api.EventEntry {
 				EventName:        event.EventName,
 				Payload:          event.Payload,
 				Timestamp:        timestamp,
+				PrivateData:      action.Payload.Action.ProposalResponsePayload.Extension.PrivateData,
+			}
+			if idx < len(txFilter) {
+				eventEntry.TransactionStatus = peer.TxValidationCode(txFilter[idx]).String()
 			}
 			events = append(events, &eventEntry)
 		}
@@ -387,8 +417,15 @@ func (block *RawBlock) decodeProposalResponsePayloadExtension(_extension *Extens
 
 	_extension.ChaincodeID = cca.ChaincodeId
 
-	// skipping read/write sets in the action
-	// decode events
+	// skipping the public read/write sets in the action. The writes to private data collections are
+	// decoded as the hashes they are, and not delivered as if they were the data
+	privateData, err := decodePrivateDataWrites(cca.Results)
+	if err != nil {
+		return err
+	}
+	_extension.PrivateData = privateData
+
+	// decode events. Chaincode events are always public
 	ccevt := &peer.ChaincodeEvent{}
 	if err := proto.Unmarshal(cca.Events, ccevt); err != nil {
 		return errors.Wrap(err, "error decoding chaincode event")
@@ -403,6 +440,44 @@ func (block *RawBlock) decodeProposalResponsePayloadExtension(_extension *Extens
 	return nil
 }
 
+// decodePrivateDataWrites returns the hashed writes to private data collections in the results of a
+// chaincode action, with the collections in the order of the read/write set
+func decodePrivateDataWrites(results []byte) ([]*api.CollectionWrites, error) {
+	txRWSet := &rwset.TxReadWriteSet{}
+	if err := proto.Unmarshal(results, txRWSet); err != nil {
+		return nil, errors.Wrap(err, "error decoding read/write set")
+	}
+	var privateData []*api.CollectionWrites
+	for _, nsRWSet := range txRWSet.NsRwset {
+		for _, collRWSet := range nsRWSet.CollectionHashedRwset {
+			hashedRWSet := &kvrwset.HashedRWSet{}
+			if err := proto.Unmarshal(collRWSet.HashedRwset, hashedRWSet); err != nil {
+				return nil, errors.Wrapf(err, "error decoding hashed read/write set of collection %s", collRWSet.CollectionName)
+			}
+			// collections that were only read are not included
+			if len(hashedRWSet.HashedWrites) == 0 {
+				continue
+			}
+			collWrites := &api.CollectionWrites{
+				Namespace:    nsRWSet.Namespace,
+				Collection:   collRWSet.CollectionName,
+				PvtRwsetHash: hex.EncodeToString(collRWSet.PvtRwsetHash),
+				Writes:       make([]*api.PrivateWrite, len(hashedRWSet.HashedWrites)),
+			}
+			for i, write := range hashedRWSet.HashedWrites {
+				collWrites.Writes[i] = &api.PrivateWrite{
+					KeyHash:   hex.EncodeToString(write.KeyHash),
+					ValueHash: hex.EncodeToString(write.ValueHash),
+					IsDelete:  write.IsDelete,
+					IsPurge:   write.IsPurge,
+				}
+			}
+			privateData = append(privateData, collWrites)
+		}
+	}
+	return privateData, nil
+}
+
 func (block *RawBlock) decodeConfigPayloadData(payloadData []byte, _payloadData *PayloadData, _configRec *ConfigRecord) error {
 	configEnv := &common.ConfigEnvelope{}
 	if err := proto.Unmarshal(payloadData, configEnv); err != nil {
@@ -22,7 +22,11 @@ import (
 
 	"github.com/golang/protobuf/proto" //nolint
 	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/hyperledger/fabric-protos-go/peer/lifecycle"
+	"github.com/hyperledger/firefly-fabconnect/internal/events/api"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -60,6 +64,68 @@ func TestDecodeEndorserBlockWithEvents(t *testing.T) {
 	assert.Equal("CreateAsset", cpp.Input.ChaincodeSpec.Input.Args[0])
 }
 
+func TestDecodeChaincodeProposalPayloadTransientData(t *testing.T) {
+	assert := assert.New(t)
+	input, _ := proto.Marshal(&peer.ChaincodeInvocationSpec{
+		ChaincodeSpec: &peer.ChaincodeSpec{
+			ChaincodeId: &peer.ChaincodeID{Name: "asset_transfer"},
+			Input:       &peer.ChaincodeInput{Args: [][]byte{[]byte("CreateAsset")}},
+		},
+	})
+	cppBytes, _ := proto.Marshal(&peer.ChaincodeProposalPayload{
+		Input:        input,
+		TransientMap: map[string][]byte{"asset_properties": []byte("secret")},
+	})
+	block := &RawBlock{}
+	cpp := &ChaincodeProposalPayload{}
+	err := block.decodeActionPayloadChaincodeProposalPayload(cpp, cppBytes)
+	assert.NoError(err)
+	assert.Equal([]byte("secret"), (*cpp.TransientMap)["asset_properties"])
+	assert.Equal("CreateAsset", cpp.Input.ChaincodeSpec.Input.Args[0])
+}
+
+func TestDecodePrivateDataWrites(t *testing.T) {
+	assert := assert.New(t)
+	writes, _ := proto.Marshal(&kvrwset.HashedRWSet{
+		HashedWrites: []*kvrwset.KVWriteHash{
+			{KeyHash: []byte{0x01, 0x02}, ValueHash: []byte{0xab}},
+			{KeyHash: []byte{0x03}, IsDelete: true},
+		},
+	})
+	reads, _ := proto.Marshal(&kvrwset.HashedRWSet{
+		HashedReads: []*kvrwset.KVReadHash{{KeyHash: []byte{0x04}}},
+	})
+	results, _ := proto.Marshal(&rwset.TxReadWriteSet{
+		NsRwset: []*rwset.NsReadWriteSet{
+			{Namespace: "_lifecycle"},
+			{
+				Namespace: "asset_transfer",
+				CollectionHashedRwset: []*rwset.CollectionHashedReadWriteSet{
+					{CollectionName: "assetCollection", HashedRwset: writes, PvtRwsetHash: []byte{0xff}},
+					{CollectionName: "Org1MSPPrivateCollection", HashedRwset: reads},
+				},
+			},
+		},
+	})
+	privateData, err := decodePrivateDataWrites(results)
+	assert.NoError(err)
+	assert.Equal(1, len(privateData))
+	assert.Equal("asset_transfer", privateData[0].Namespace)
+	assert.Equal("assetCollection", privateData[0].Collection)
+	assert.Equal("ff", privateData[0].PvtRwsetHash)
+	assert.Equal(2, len(privateData[0].Writes))
+	assert.Equal("0102", privateData[0].Writes[0].KeyHash)
+	assert.Equal("ab", privateData[0].Writes[0].ValueHash)
+	assert.True(privateData[0].Writes[1].IsDelete)
+	assert.Empty(privateData[0].Writes[1].ValueHash)
+
+	privateData, err = decodePrivateDataWrites(nil)
+	assert.NoError(err)
+	assert.Nil(privateData)
+	_, err = decodePrivateDataWrites([]byte("!not a read/write set"))
+	assert.Regexp("error decoding read/write set", err)
+}
+
 func TestDecodeEndorserBlockLifecycleTxs(t *testing.T) {
 	assert := assert.New(t)
 	content, _ := os.ReadFile("../../../test/resources/chaincode-deploy.block")
@@ -120,5 +186,17 @@ func TestGetEvents(t *testing.T) {
 	assert.Equal("AssetCreated", entry.EventName)
 	assert.Regexp("[0-9a-f]{64}", entry.TransactionID)
 	assert.Equal(0, entry.TransactionIndex)
+	assert.Equal("VALID", entry.TransactionStatus)
+	assert.Nil(entry.PrivateData)
 	assert.Equal(int64(1641861241312746000), entry.Timestamp)
+
+	events = GetEvents(readTestBlock("config-1.block"))
+	assert.Equal(1, len(events))
+	entry = events[0]
+	assert.Equal(api.ConfigUpdateEventName, entry.EventName)
+	assert.Equal(uint64(1), entry.BlockNumber)
+	assert.Empty(entry.ChaincodeID)
+	delta := entry.Payload.(*ConfigDelta)
+	assert.Equal("u0o4mkkzs6", delta.AddedOrgs[0].MSPID)
+	assert.Equal(int64(1641309074000000000), entry.Timestamp)
 }
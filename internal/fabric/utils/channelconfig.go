@@ -0,0 +1,225 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/golang/protobuf/proto" //nolint
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/orderer"
+	"github.com/pkg/errors"
+)
+
+const (
+	ordererGroupKey              = "Orderer"
+	consensusTypeKey             = "ConsensusType"
+	ordererAddressesKey          = "OrdererAddresses"
+	ordererOrgEndpointsKey       = "Endpoints"
+	ordererOrgMSPKey             = "MSP"
+	fabricMSPType          int32 = 0
+
+	// ConsensusTypeBFT is the consensus type of channels ordered by SmartBFT, from Fabric 3.0
+	ConsensusTypeBFT = "BFT"
+)
+
+// OrdererEndpoint is an ordering service node published in the config of a channel
+type OrdererEndpoint struct {
+	Address string `json:"address"`
+	MSPID   string `json:"mspID,omitempty"`
+	// the PEM encoded TLS root and intermediate CA certificates of the orderer organization,
+	// or of all orderer organizations for the global orderer addresses
+	TLSCACerts [][]byte `json:"-"`
+}
+
+// ChannelOrdererConfig is the ordering service part of a channel config block
+type ChannelOrdererConfig struct {
+	ChannelID   string             `json:"channel"`
+	BlockNumber uint64             `json:"blockNumber"`
+	Orderers    []*OrdererEndpoint `json:"orderers"`
+	// "etcdraft" or "BFT" (SmartBFT)
+	ConsensusType string `json:"consensusType,omitempty"`
+}
+
+// Equal returns true if both configs have the same consensus type, orderer endpoints and
+// TLS CAs, regardless of the block they were read from
+func (c *ChannelOrdererConfig) Equal(other *ChannelOrdererConfig) bool {
+	if other == nil || c.ConsensusType != other.ConsensusType || len(c.Orderers) != len(other.Orderers) {
+		return false
+	}
+	for i, o := range c.Orderers {
+		p := other.Orderers[i]
+		if o.Address != p.Address || o.MSPID != p.MSPID || len(o.TLSCACerts) != len(p.TLSCACerts) {
+			return false
+		}
+		for j, cert := range o.TLSCACerts {
+			if !bytes.Equal(cert, p.TLSCACerts[j]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Addresses returns the addresses of the orderers
+func (c *ChannelOrdererConfig) Addresses() []string {
+	addrs := make([]string, len(c.Orderers))
+	for i, o := range c.Orderers {
+		addrs[i] = o.Address
+	}
+	return addrs
+}
+
+// GetChannelOrdererConfig reads the orderer endpoints from a channel config block.
+// As in Fabric 2.x, the endpoints of the orderer organizations take precedence over
+// the deprecated global orderer addresses, which are only used if no organization
+// publishes its endpoints
+func GetChannelOrdererConfig(block *common.Block) (*ChannelOrdererConfig, error) {
+	channelHeader, configEnv, err := getConfigEnvelope(block)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ChannelOrdererConfig{
+		ChannelID:   channelHeader.ChannelId,
+		BlockNumber: block.Header.GetNumber(),
+		Orderers:    []*OrdererEndpoint{},
+	}
+	channelGroup := configEnv.Config.ChannelGroup
+	var allCACerts [][]byte
+	if ordererGroup := channelGroup.Groups[ordererGroupKey]; ordererGroup != nil {
+		if value := ordererGroup.Values[consensusTypeKey]; value != nil {
+			consensusType := &orderer.ConsensusType{}
+			if err := proto.Unmarshal(value.Value, consensusType); err != nil {
+				return nil, errors.Wrap(err, "error decoding orderer consensus type")
+			}
+			result.ConsensusType = consensusType.Type
+		}
+		orgNames := make([]string, 0, len(ordererGroup.Groups))
+		for name := range ordererGroup.Groups {
+			orgNames = append(orgNames, name)
+		}
+		sort.Strings(orgNames)
+		for _, name := range orgNames {
+			org := ordererGroup.Groups[name]
+			mspID, caCerts, err := getOrgTLSCACerts(org)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error decoding MSP of orderer organization %s", name)
+			}
+			allCACerts = append(allCACerts, caCerts...)
+			addresses, err := getOrdererAddresses(org.Values[ordererOrgEndpointsKey])
+			if err != nil {
+				return nil, errors.Wrapf(err, "error decoding endpoints of orderer organization %s", name)
+			}
+			for _, addr := range addresses {
+				result.Orderers = append(result.Orderers, &OrdererEndpoint{Address: addr, MSPID: mspID, TLSCACerts: caCerts})
+			}
+		}
+	}
+	if len(result.Orderers) == 0 {
+		addresses, err := getOrdererAddresses(channelGroup.Values[ordererAddressesKey])
+		if err != nil {
+			return nil, errors.Wrap(err, "error decoding orderer addresses")
+		}
+		for _, addr := range addresses {
+			result.Orderers = append(result.Orderers, &OrdererEndpoint{Address: addr, TLSCACerts: allCACerts})
+		}
+	}
+	sort.SliceStable(result.Orderers, func(i, j int) bool {
+		return result.Orderers[i].Address < result.Orderers[j].Address
+	})
+	return result, nil
+}
+
+// getConfigEnvelope decodes the channel header and config envelope of a config block
+func getConfigEnvelope(block *common.Block) (*common.ChannelHeader, *common.ConfigEnvelope, error) {
+	if block == nil || block.Data == nil || len(block.Data.Data) != 1 {
+		return nil, nil, errors.New("not a config block")
+	}
+	env, err := getEnvelopeFromBlock(block.Data.Data[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(env.Payload, payload); err != nil {
+		return nil, nil, errors.Wrap(err, "error decoding Payload from envelope")
+	}
+	if payload.Header == nil {
+		return nil, nil, errors.New("missing payload header")
+	}
+	channelHeader := &common.ChannelHeader{}
+	if err := proto.Unmarshal(payload.Header.ChannelHeader, channelHeader); err != nil {
+		return nil, nil, errors.Wrap(err, "error decoding ChannelHeader from payload")
+	}
+	if channelHeader.Type != int32(common.HeaderType_CONFIG) {
+		return nil, nil, errors.Errorf("not a config block, header type %s", common.HeaderType_name[channelHeader.Type])
+	}
+	configEnv := &common.ConfigEnvelope{}
+	if err := proto.Unmarshal(payload.Data, configEnv); err != nil {
+		return nil, nil, errors.Wrap(err, "error decoding config envelope")
+	}
+	if configEnv.Config == nil || configEnv.Config.ChannelGroup == nil {
+		return nil, nil, errors.New("missing channel group in config")
+	}
+	return channelHeader, configEnv, nil
+}
+
+func getOrdererAddresses(value *common.ConfigValue) ([]string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	addresses := &common.OrdererAddresses{}
+	if err := proto.Unmarshal(value.Value, addresses); err != nil {
+		return nil, err
+	}
+	return addresses.Addresses, nil
+}
+
+func getOrgTLSCACerts(org *common.ConfigGroup) (string, [][]byte, error) {
+	_, fabricMSPConfig, err := getFabricMSPConfig(org)
+	if err != nil || fabricMSPConfig == nil {
+		return "", nil, err
+	}
+	caCerts := make([][]byte, 0, len(fabricMSPConfig.TlsRootCerts)+len(fabricMSPConfig.TlsIntermediateCerts))
+	caCerts = append(caCerts, fabricMSPConfig.TlsRootCerts...)
+	caCerts = append(caCerts, fabricMSPConfig.TlsIntermediateCerts...)
+	return fabricMSPConfig.Name, caCerts, nil
+}
+
+// getFabricMSPConfig decodes the MSP of an organization. The Fabric MSP config is nil if the
+// organization has no MSP, or an idemix MSP
+func getFabricMSPConfig(org *common.ConfigGroup) (*msp.MSPConfig, *msp.FabricMSPConfig, error) {
+	value := org.Values[ordererOrgMSPKey]
+	if value == nil {
+		return nil, nil, nil
+	}
+	mspConfig := &msp.MSPConfig{}
+	if err := proto.Unmarshal(value.Value, mspConfig); err != nil {
+		return nil, nil, err
+	}
+	if mspConfig.Type != fabricMSPType {
+		// idemix MSPs have no X.509 CAs
+		return mspConfig, nil, nil
+	}
+	fabricMSPConfig := &msp.FabricMSPConfig{}
+	if err := proto.Unmarshal(mspConfig.Config, fabricMSPConfig); err != nil {
+		return nil, nil, err
+	}
+	return mspConfig, fabricMSPConfig, nil
+}
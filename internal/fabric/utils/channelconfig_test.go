@@ -0,0 +1,129 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"os"
+	"testing"
+
+	"github.com/golang/protobuf/proto" //nolint
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/orderer"
+	"github.com/stretchr/testify/assert"
+)
+
+func readTestBlock(name string) *common.Block {
+	content, _ := os.ReadFile("../../../test/resources/" + name)
+	testblock := &common.Block{}
+	_ = proto.Unmarshal(content, testblock)
+	return testblock
+}
+
+func TestGetChannelOrdererConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	config0, err := GetChannelOrdererConfig(readTestBlock("config-0.block"))
+	assert.NoError(err)
+	assert.Equal("default-channel", config0.ChannelID)
+	assert.Equal(uint64(0), config0.BlockNumber)
+	assert.Equal([]string{"u0bdh1ndoq.u0wrhhqt5w.kaleido.network:40020"}, config0.Addresses())
+	assert.Equal("sys--mon", config0.Orderers[0].MSPID)
+	assert.Equal(1, len(config0.Orderers[0].TLSCACerts))
+	assert.Regexp("^-----BEGIN CERTIFICATE-----", string(config0.Orderers[0].TLSCACerts[0]))
+
+	config1, err := GetChannelOrdererConfig(readTestBlock("config-1.block"))
+	assert.NoError(err)
+	assert.Equal([]string{"u0bdh1ndoq.u0wrhhqt5w.kaleido.network:40020", "u0u52tiobg.u0wrhhqt5w.kaleido.network:40040"}, config1.Addresses())
+	assert.Equal("u0o4mkkzs6", config1.Orderers[1].MSPID)
+
+	assert.True(config0.Equal(config0))
+	assert.False(config0.Equal(config1))
+	assert.False(config0.Equal(nil))
+	changedCA := *config0
+	changedCA.Orderers = []*OrdererEndpoint{{Address: config0.Orderers[0].Address, MSPID: "sys--mon", TLSCACerts: [][]byte{[]byte("other")}}}
+	assert.False(config0.Equal(&changedCA))
+}
+
+func TestGetChannelOrdererConfigGlobalAddresses(t *testing.T) {
+	assert := assert.New(t)
+	addresses, _ := proto.Marshal(&common.OrdererAddresses{Addresses: []string{"orderer1:7050", "orderer0:7050"}})
+	block := newConfigBlock(&common.Config{
+		ChannelGroup: &common.ConfigGroup{
+			Values: map[string]*common.ConfigValue{"OrdererAddresses": {Value: addresses}},
+			Groups: map[string]*common.ConfigGroup{"Orderer": {Groups: map[string]*common.ConfigGroup{"OrdererOrg": {}}}},
+		},
+	})
+	config, err := GetChannelOrdererConfig(block)
+	assert.NoError(err)
+	assert.Equal([]string{"orderer0:7050", "orderer1:7050"}, config.Addresses())
+	assert.Equal("", config.Orderers[0].MSPID)
+}
+
+func TestGetChannelOrdererConfigNotConfig(t *testing.T) {
+	assert := assert.New(t)
+	_, err := GetChannelOrdererConfig(readTestBlock("tx-event.block"))
+	assert.Regexp("not a config block, header type ENDORSER_TRANSACTION", err)
+	_, err = GetChannelOrdererConfig(&common.Block{})
+	assert.Regexp("not a config block", err)
+
+	block := newConfigBlock(&common.Config{})
+	_, err = GetChannelOrdererConfig(block)
+	assert.Regexp("missing channel group in config", err)
+}
+
+func newConfigBlock(config *common.Config) *common.Block {
+	configEnv, _ := proto.Marshal(&common.ConfigEnvelope{Config: config})
+	channelHeader, _ := proto.Marshal(&common.ChannelHeader{Type: int32(common.HeaderType_CONFIG), ChannelId: "channel1"})
+	payload, _ := proto.Marshal(&common.Payload{Header: &common.Header{ChannelHeader: channelHeader}, Data: configEnv})
+	env, _ := proto.Marshal(&common.Envelope{Payload: payload})
+	return &common.Block{Header: &common.BlockHeader{Number: 5}, Data: &common.BlockData{Data: [][]byte{env}}}
+}
+
+func TestGetChannelOrdererConfigConsensusType(t *testing.T) {
+	assert := assert.New(t)
+	config0, err := GetChannelOrdererConfig(readTestBlock("config-0.block"))
+	assert.NoError(err)
+	assert.Equal("etcdraft", config0.ConsensusType)
+
+	consensusType, _ := proto.Marshal(&orderer.ConsensusType{Type: ConsensusTypeBFT})
+	addresses, _ := proto.Marshal(&common.OrdererAddresses{Addresses: config0.Addresses()})
+	block := newConfigBlock(&common.Config{
+		ChannelGroup: &common.ConfigGroup{
+			Values: map[string]*common.ConfigValue{"OrdererAddresses": {Value: addresses}},
+			Groups: map[string]*common.ConfigGroup{"Orderer": {
+				Values: map[string]*common.ConfigValue{"ConsensusType": {Value: consensusType}},
+			}},
+		},
+	})
+	config, err := GetChannelOrdererConfig(block)
+	assert.NoError(err)
+	assert.Equal(ConsensusTypeBFT, config.ConsensusType)
+	assert.Equal(config0.Addresses(), config.Addresses())
+	// a consensus type migration is a change of the config, even with the same orderers
+	config.Orderers = config0.Orderers
+	assert.False(config0.Equal(config))
+
+	block = newConfigBlock(&common.Config{
+		ChannelGroup: &common.ConfigGroup{
+			Groups: map[string]*common.ConfigGroup{"Orderer": {
+				Values: map[string]*common.ConfigValue{"ConsensusType": {Value: []byte{0xff}}},
+			}},
+		},
+	})
+	_, err = GetChannelOrdererConfig(block)
+	assert.Regexp("error decoding orderer consensus type", err)
+}
@@ -0,0 +1,209 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"sort"
+
+	"github.com/golang/protobuf/proto" //nolint
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/pkg/errors"
+)
+
+const (
+	ConfigChangeAdded   = "added"
+	ConfigChangeRemoved = "removed"
+	ConfigChangeUpdated = "updated"
+
+	ConfigKindGroup  = "group"
+	ConfigKindValue  = "value"
+	ConfigKindPolicy = "policy"
+
+	channelGroupKey = "Channel"
+)
+
+// ConfigOrg is an organization in the Application or Orderer group of the config of a channel
+type ConfigOrg struct {
+	Group string `json:"group"`
+	Name  string `json:"name"`
+	// decoded from the MSP of the organizations that are added, which is not in the update for those removed
+	MSPID string `json:"mspID,omitempty"`
+}
+
+// ConfigChange is a group, value or policy of the config of a channel that was added, removed or
+// updated, by its path from the channel group, such as Channel/Application/Org1MSP/AnchorPeers
+type ConfigChange struct {
+	Path   string `json:"path"`
+	Kind   string `json:"kind"`
+	Change string `json:"change"`
+}
+
+// ConfigDelta is the change to the config of a channel committed in a config block, computed from
+// the read and write sets of the config update the block was produced from. The genesis block of a
+// channel has no update, and adds all the organizations of its config
+type ConfigDelta struct {
+	ChannelID   string          `json:"channel"`
+	BlockNumber uint64          `json:"blockNumber"`
+	AddedOrgs   []*ConfigOrg    `json:"addedOrgs"`
+	RemovedOrgs []*ConfigOrg    `json:"removedOrgs"`
+	Changes     []*ConfigChange `json:"changes"`
+}
+
+// GetConfigDelta decodes the changes a config block made to the config of the channel
+func GetConfigDelta(block *common.Block) (*ConfigDelta, error) {
+	channelHeader, configEnv, err := getConfigEnvelope(block)
+	if err != nil {
+		return nil, err
+	}
+	delta := &ConfigDelta{
+		ChannelID:   channelHeader.ChannelId,
+		BlockNumber: block.Header.GetNumber(),
+		AddedOrgs:   []*ConfigOrg{},
+		RemovedOrgs: []*ConfigOrg{},
+		Changes:     []*ConfigChange{},
+	}
+	if configEnv.LastUpdate == nil {
+		for _, groupKey := range []string{applicationGroupKey, ordererGroupKey} {
+			group := configEnv.Config.ChannelGroup.Groups[groupKey]
+			if group == nil {
+				continue
+			}
+			for _, name := range sortedKeys(group.Groups) {
+				delta.AddedOrgs = append(delta.AddedOrgs, newConfigOrg(groupKey, name, group.Groups[name]))
+			}
+		}
+		return delta, nil
+	}
+	payload, err := UnmarshalPayload(configEnv.LastUpdate.Payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding config update")
+	}
+	updateEnv := &common.ConfigUpdateEnvelope{}
+	if err := proto.Unmarshal(payload.Data, updateEnv); err != nil {
+		return nil, errors.Wrap(err, "error decoding config update envelope")
+	}
+	update := &common.ConfigUpdate{}
+	if err := proto.Unmarshal(updateEnv.ConfigUpdate, update); err != nil {
+		return nil, errors.Wrap(err, "error decoding config update")
+	}
+	delta.compareGroups(channelGroupKey, update.ReadSet, update.WriteSet)
+	return delta, nil
+}
+
+// compareGroups records the differences between a group in the read set of an update and in its
+// write set. The children of a group are only removed by a write of the group at a higher version,
+// as the write set omits the children that are not changed otherwise
+func (d *ConfigDelta) compareGroups(path string, read, write *common.ConfigGroup) {
+	if write == nil {
+		return
+	}
+	if read == nil {
+		read = &common.ConfigGroup{}
+	}
+	modified := write.Version > read.Version
+	for _, key := range sortedKeys(write.Groups) {
+		w := write.Groups[key]
+		if r, ok := read.Groups[key]; ok || w.GetVersion() > 0 {
+			d.compareGroups(path+"/"+key, r, w)
+			continue
+		}
+		d.record(path+"/"+key, ConfigKindGroup, ConfigChangeAdded)
+		if org := d.orgOf(path, key, w); org != nil {
+			d.AddedOrgs = append(d.AddedOrgs, org)
+		}
+	}
+	for _, key := range sortedKeys(write.Values) {
+		d.compareVersions(path+"/"+key, ConfigKindValue, readVersion(read.Values, key), write.Values[key].GetVersion())
+	}
+	for _, key := range sortedKeys(write.Policies) {
+		d.compareVersions(path+"/"+key, ConfigKindPolicy, readVersion(read.Policies, key), write.Policies[key].GetVersion())
+	}
+	if !modified {
+		return
+	}
+	for _, key := range sortedKeys(read.Groups) {
+		if _, ok := write.Groups[key]; !ok {
+			d.record(path+"/"+key, ConfigKindGroup, ConfigChangeRemoved)
+			if org := d.orgOf(path, key, nil); org != nil {
+				d.RemovedOrgs = append(d.RemovedOrgs, org)
+			}
+		}
+	}
+	for _, key := range sortedKeys(read.Values) {
+		if _, ok := write.Values[key]; !ok {
+			d.record(path+"/"+key, ConfigKindValue, ConfigChangeRemoved)
+		}
+	}
+	for _, key := range sortedKeys(read.Policies) {
+		if _, ok := write.Policies[key]; !ok {
+			d.record(path+"/"+key, ConfigKindPolicy, ConfigChangeRemoved)
+		}
+	}
+}
+
+// compareVersions records a value or policy as added when it was not read, and as updated when it
+// is written at a higher version than it was read
+func (d *ConfigDelta) compareVersions(path, kind string, read *uint64, written uint64) {
+	switch {
+	case read == nil && written == 0:
+		d.record(path, kind, ConfigChangeAdded)
+	case read == nil || written > *read:
+		d.record(path, kind, ConfigChangeUpdated)
+	}
+}
+
+func (d *ConfigDelta) record(path, kind, change string) {
+	d.Changes = append(d.Changes, &ConfigChange{Path: path, Kind: kind, Change: change})
+}
+
+// orgOf returns the organization of a group directly under the Application or Orderer group
+func (d *ConfigDelta) orgOf(parentPath, name string, group *common.ConfigGroup) *ConfigOrg {
+	for _, groupKey := range []string{applicationGroupKey, ordererGroupKey} {
+		if parentPath == channelGroupKey+"/"+groupKey {
+			return newConfigOrg(groupKey, name, group)
+		}
+	}
+	return nil
+}
+
+func newConfigOrg(groupKey, name string, group *common.ConfigGroup) *ConfigOrg {
+	org := &ConfigOrg{Group: groupKey, Name: name}
+	if group != nil {
+		if _, fabricMSPConfig, err := getFabricMSPConfig(group); err == nil && fabricMSPConfig != nil {
+			org.MSPID = fabricMSPConfig.Name
+		}
+	}
+	return org
+}
+
+func readVersion[V interface{ GetVersion() uint64 }](items map[string]V, key string) *uint64 {
+	item, ok := items[key]
+	if !ok {
+		return nil
+	}
+	version := item.GetVersion()
+	return &version
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
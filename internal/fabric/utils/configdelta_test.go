@@ -0,0 +1,129 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto" //nolint
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetConfigDelta(t *testing.T) {
+	assert := assert.New(t)
+	// the genesis block adds the organizations of the config
+	delta, err := GetConfigDelta(readTestBlock("config-0.block"))
+	assert.NoError(err)
+	assert.Equal("default-channel", delta.ChannelID)
+	assert.Equal(uint64(0), delta.BlockNumber)
+	assert.Equal([]*ConfigOrg{
+		{Group: "Application", Name: "sys--mon", MSPID: "sys--mon"},
+		{Group: "Orderer", Name: "sys--mon", MSPID: "sys--mon"},
+	}, delta.AddedOrgs)
+	assert.Empty(delta.RemovedOrgs)
+	assert.Empty(delta.Changes)
+
+	delta, err = GetConfigDelta(readTestBlock("config-1.block"))
+	assert.NoError(err)
+	assert.Equal(uint64(1), delta.BlockNumber)
+	assert.Equal([]*ConfigOrg{{Group: "Orderer", Name: "u0o4mkkzs6", MSPID: "u0o4mkkzs6"}}, delta.AddedOrgs)
+	assert.Equal([]*ConfigChange{
+		{Path: "Channel/Orderer/u0o4mkkzs6", Kind: ConfigKindGroup, Change: ConfigChangeAdded},
+		{Path: "Channel/Orderer/ConsensusType", Kind: ConfigKindValue, Change: ConfigChangeUpdated},
+	}, delta.Changes)
+}
+
+func TestGetConfigDeltaRemovals(t *testing.T) {
+	assert := assert.New(t)
+	block := newConfigUpdateBlock(&common.ConfigUpdate{
+		ReadSet: &common.ConfigGroup{
+			Groups: map[string]*common.ConfigGroup{"Application": {
+				Version: 1,
+				Groups: map[string]*common.ConfigGroup{
+					"Org1MSP": {Values: map[string]*common.ConfigValue{"AnchorPeers": {}}},
+					"Org2MSP": {},
+				},
+				Policies: map[string]*common.ConfigPolicy{"Admins": {}, "Writers": {Version: 2}},
+			}},
+		},
+		WriteSet: &common.ConfigGroup{
+			Groups: map[string]*common.ConfigGroup{"Application": {
+				Version: 2,
+				Groups: map[string]*common.ConfigGroup{
+					"Org1MSP": {Values: map[string]*common.ConfigValue{"AnchorPeers": {Version: 1}}},
+				},
+				Policies: map[string]*common.ConfigPolicy{"Writers": {Version: 3}, "Endorsement": {}},
+			}},
+		},
+	})
+	delta, err := GetConfigDelta(block)
+	assert.NoError(err)
+	assert.Equal("channel1", delta.ChannelID)
+	assert.Empty(delta.AddedOrgs)
+	assert.Equal([]*ConfigOrg{{Group: "Application", Name: "Org2MSP"}}, delta.RemovedOrgs)
+	assert.Equal([]*ConfigChange{
+		{Path: "Channel/Application/Org1MSP/AnchorPeers", Kind: ConfigKindValue, Change: ConfigChangeUpdated},
+		{Path: "Channel/Application/Endorsement", Kind: ConfigKindPolicy, Change: ConfigChangeAdded},
+		{Path: "Channel/Application/Writers", Kind: ConfigKindPolicy, Change: ConfigChangeUpdated},
+		{Path: "Channel/Application/Org2MSP", Kind: ConfigKindGroup, Change: ConfigChangeRemoved},
+		{Path: "Channel/Application/Admins", Kind: ConfigKindPolicy, Change: ConfigChangeRemoved},
+	}, delta.Changes)
+
+	// the children of groups that are not written at a higher version are not removed
+	block = newConfigUpdateBlock(&common.ConfigUpdate{
+		ReadSet:  &common.ConfigGroup{Groups: map[string]*common.ConfigGroup{"Application": {Version: 1, Groups: map[string]*common.ConfigGroup{"Org1MSP": {}}}}},
+		WriteSet: &common.ConfigGroup{Groups: map[string]*common.ConfigGroup{"Application": {Version: 1}}},
+	})
+	delta, err = GetConfigDelta(block)
+	assert.NoError(err)
+	assert.Empty(delta.RemovedOrgs)
+	assert.Empty(delta.Changes)
+}
+
+func TestGetConfigDeltaFail(t *testing.T) {
+	assert := assert.New(t)
+	_, err := GetConfigDelta(readTestBlock("tx-event.block"))
+	assert.Regexp("not a config block", err)
+
+	configEnv, _ := proto.Marshal(&common.ConfigEnvelope{
+		Config:     &common.Config{ChannelGroup: &common.ConfigGroup{}},
+		LastUpdate: &common.Envelope{Payload: []byte{0xff}},
+	})
+	block := newConfigBlock(&common.Config{ChannelGroup: &common.ConfigGroup{}})
+	block.Data.Data[0] = wrapConfigEnvelope(configEnv)
+	_, err = GetConfigDelta(block)
+	assert.Regexp("error decoding config update", err)
+}
+
+func newConfigUpdateBlock(update *common.ConfigUpdate) *common.Block {
+	updateBytes, _ := proto.Marshal(update)
+	updateEnv, _ := proto.Marshal(&common.ConfigUpdateEnvelope{ConfigUpdate: updateBytes})
+	updatePayload, _ := proto.Marshal(&common.Payload{Data: updateEnv})
+	configEnv, _ := proto.Marshal(&common.ConfigEnvelope{
+		Config:     &common.Config{ChannelGroup: &common.ConfigGroup{}},
+		LastUpdate: &common.Envelope{Payload: updatePayload},
+	})
+	return &common.Block{Header: &common.BlockHeader{Number: 5}, Data: &common.BlockData{Data: [][]byte{wrapConfigEnvelope(configEnv)}}}
+}
+
+func wrapConfigEnvelope(configEnv []byte) []byte {
+	channelHeader, _ := proto.Marshal(&common.ChannelHeader{Type: int32(common.HeaderType_CONFIG), ChannelId: "channel1"})
+	payload, _ := proto.Marshal(&common.Payload{Header: &common.Header{ChannelHeader: channelHeader}, Data: configEnv})
+	env, _ := proto.Marshal(&common.Envelope{Payload: payload})
+	return env
+}
@@ -0,0 +1,215 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"sort"
+	"strconv"
+
+	"github.com/golang/protobuf/proto" //nolint
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/pkg/errors"
+)
+
+const (
+	applicationGroupKey = "Application"
+	anchorPeersKey      = "AnchorPeers"
+	adminsPolicyKey     = "Admins"
+)
+
+// MSPCACerts are the PEM encoded CA certificates of an MSP. Each list that is set replaces
+// the certificates of that kind, and a nil list leaves them unchanged
+type MSPCACerts struct {
+	RootCerts            [][]byte
+	IntermediateCerts    [][]byte
+	TLSRootCerts         [][]byte
+	TLSIntermediateCerts [][]byte
+}
+
+// GetChannelConfig reads the config of a channel from its latest config block, as the
+// starting point of a config update
+func GetChannelConfig(block *common.Block) (*common.Config, error) {
+	_, configEnv, err := getConfigEnvelope(block)
+	if err != nil {
+		return nil, err
+	}
+	return configEnv.Config, nil
+}
+
+// SetAnchorPeers replaces the anchor peers of the application organization with the MSP ID.
+// The anchor peers are host:port addresses, and an empty list removes them all
+func SetAnchorPeers(config *common.Config, mspID string, anchorPeers []string) error {
+	orgs, err := findOrgs(config, mspID, applicationGroupKey)
+	if err != nil {
+		return err
+	}
+	value := &peer.AnchorPeers{}
+	for _, address := range anchorPeers {
+		host, portStr, err := net.SplitHostPort(address)
+		if err != nil || host == "" {
+			return errors.Errorf("invalid anchor peer '%s', must be host:port", address)
+		}
+		port, err := strconv.ParseUint(portStr, 10, 16)
+		if err != nil || port == 0 {
+			return errors.Errorf("invalid port in anchor peer '%s'", address)
+		}
+		value.AnchorPeers = append(value.AnchorPeers, &peer.AnchorPeer{Host: host, Port: int32(port)})
+	}
+	for _, org := range orgs {
+		if len(value.AnchorPeers) == 0 {
+			delete(org.Values, anchorPeersKey)
+		} else if err := setValue(org, anchorPeersKey, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetMSPCACerts replaces the CA certificates of the MSP with the ID, in every application
+// and orderer organization that uses it
+func SetMSPCACerts(config *common.Config, mspID string, certs *MSPCACerts) error {
+	if certs.RootCerts != nil && len(certs.RootCerts) == 0 {
+		return errors.New("an MSP must have at least one root CA certificate")
+	}
+	for _, list := range [][][]byte{certs.RootCerts, certs.IntermediateCerts, certs.TLSRootCerts, certs.TLSIntermediateCerts} {
+		for _, cert := range list {
+			if err := validateCertificate(cert); err != nil {
+				return err
+			}
+		}
+	}
+	orgs, err := findOrgs(config, mspID, applicationGroupKey, ordererGroupKey)
+	if err != nil {
+		return err
+	}
+	for _, org := range orgs {
+		mspConfig, fabricMSPConfig, err := getFabricMSPConfig(org)
+		if err != nil {
+			return err
+		}
+		if certs.RootCerts != nil {
+			fabricMSPConfig.RootCerts = certs.RootCerts
+		}
+		if certs.IntermediateCerts != nil {
+			fabricMSPConfig.IntermediateCerts = certs.IntermediateCerts
+		}
+		if certs.TLSRootCerts != nil {
+			fabricMSPConfig.TlsRootCerts = certs.TLSRootCerts
+		}
+		if certs.TLSIntermediateCerts != nil {
+			fabricMSPConfig.TlsIntermediateCerts = certs.TLSIntermediateCerts
+		}
+		if mspConfig.Config, err = proto.Marshal(fabricMSPConfig); err != nil {
+			return err
+		}
+		if err := setValue(org, ordererOrgMSPKey, mspConfig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewConfigUpdateEnvelope wraps a config update in an unsigned envelope, as produced by
+// "configtxlator compute_update", ready to be signed by the admins of each organization
+// whose approval the update requires
+func NewConfigUpdateEnvelope(channelID string, update *common.ConfigUpdate) ([]byte, error) {
+	updateBytes, err := proto.Marshal(update)
+	if err != nil {
+		return nil, err
+	}
+	data, err := proto.Marshal(&common.ConfigUpdateEnvelope{ConfigUpdate: updateBytes})
+	if err != nil {
+		return nil, err
+	}
+	channelHeader, err := proto.Marshal(&common.ChannelHeader{
+		Type:      int32(common.HeaderType_CONFIG_UPDATE),
+		ChannelId: channelID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	payload, err := proto.Marshal(&common.Payload{
+		Header: &common.Header{ChannelHeader: channelHeader},
+		Data:   data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(&common.Envelope{Payload: payload})
+}
+
+// findOrgs returns the organizations in the groups of the channel config with the X.509 MSP
+// of the ID, which is not necessarily the name of the organization in the config
+func findOrgs(config *common.Config, mspID string, groupKeys ...string) ([]*common.ConfigGroup, error) {
+	var orgs []*common.ConfigGroup
+	for _, groupKey := range groupKeys {
+		group := config.ChannelGroup.Groups[groupKey]
+		if group == nil {
+			continue
+		}
+		names := make([]string, 0, len(group.Groups))
+		for name := range group.Groups {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			org := group.Groups[name]
+			_, fabricMSPConfig, err := getFabricMSPConfig(org)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error decoding MSP of organization %s", name)
+			}
+			if fabricMSPConfig != nil && fabricMSPConfig.Name == mspID {
+				orgs = append(orgs, org)
+			}
+		}
+	}
+	if len(orgs) == 0 {
+		return nil, errors.Errorf("no organization with MSP ID %s in the channel", mspID)
+	}
+	return orgs, nil
+}
+
+func setValue(group *common.ConfigGroup, key string, value proto.Message) error {
+	valueBytes, err := proto.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if existing := group.Values[key]; existing != nil {
+		existing.Value = valueBytes
+		return nil
+	}
+	if group.Values == nil {
+		group.Values = make(map[string]*common.ConfigValue)
+	}
+	group.Values[key] = &common.ConfigValue{Value: valueBytes, ModPolicy: adminsPolicyKey}
+	return nil
+}
+
+func validateCertificate(certPEM []byte) error {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return errors.New("certificates must be PEM encoded")
+	}
+	if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+		return errors.Wrap(err, "invalid certificate")
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto" //nolint
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+func testOrgMSP(t *testing.T, config *common.Config, groupKey string) *msp.FabricMSPConfig {
+	_, fabricMSPConfig, err := getFabricMSPConfig(config.ChannelGroup.Groups[groupKey].Groups["sys--mon"])
+	assert.NoError(t, err)
+	return fabricMSPConfig
+}
+
+func TestGetChannelConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	config, err := GetChannelConfig(readTestBlock("config-1.block"))
+	assert.NoError(err)
+	assert.Equal(uint64(1), config.Sequence)
+	assert.Contains(config.ChannelGroup.Groups, "Application")
+
+	_, err = GetChannelConfig(&common.Block{})
+	assert.Regexp("not a config block", err)
+}
+
+func TestSetAnchorPeers(t *testing.T) {
+	assert := assert.New(t)
+
+	config, err := GetChannelConfig(readTestBlock("config-0.block"))
+	assert.NoError(err)
+	org := config.ChannelGroup.Groups["Application"].Groups["sys--mon"]
+	assert.NotContains(org.Values, "AnchorPeers")
+
+	err = SetAnchorPeers(config, "sys--mon", []string{"peer0.example.com:7051", "peer1.example.com:8051"})
+	assert.NoError(err)
+	value := org.Values["AnchorPeers"]
+	assert.Equal("Admins", value.ModPolicy)
+	anchorPeers := &peer.AnchorPeers{}
+	assert.NoError(proto.Unmarshal(value.Value, anchorPeers))
+	assert.Len(anchorPeers.AnchorPeers, 2)
+	assert.Equal("peer0.example.com", anchorPeers.AnchorPeers[0].Host)
+	assert.Equal(int32(7051), anchorPeers.AnchorPeers[0].Port)
+	assert.Equal("peer1.example.com", anchorPeers.AnchorPeers[1].Host)
+
+	err = SetAnchorPeers(config, "sys--mon", []string{"peer0.example.com:9051"})
+	assert.NoError(err)
+	assert.NoError(proto.Unmarshal(org.Values["AnchorPeers"].Value, anchorPeers))
+	assert.Len(anchorPeers.AnchorPeers, 1)
+	assert.Equal(int32(9051), anchorPeers.AnchorPeers[0].Port)
+
+	err = SetAnchorPeers(config, "sys--mon", []string{})
+	assert.NoError(err)
+	assert.NotContains(org.Values, "AnchorPeers")
+}
+
+func TestSetAnchorPeersErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	config, err := GetChannelConfig(readTestBlock("config-0.block"))
+	assert.NoError(err)
+
+	err = SetAnchorPeers(config, "Org2MSP", []string{"peer0.example.com:7051"})
+	assert.Regexp("no organization with MSP ID Org2MSP in the channel", err)
+	err = SetAnchorPeers(config, "sys--mon", []string{"peer0.example.com"})
+	assert.Regexp("invalid anchor peer 'peer0.example.com', must be host:port", err)
+	err = SetAnchorPeers(config, "sys--mon", []string{"peer0.example.com:70510"})
+	assert.Regexp("invalid port in anchor peer 'peer0.example.com:70510'", err)
+}
+
+func TestSetMSPCACerts(t *testing.T) {
+	assert := assert.New(t)
+
+	config, err := GetChannelConfig(readTestBlock("config-0.block"))
+	assert.NoError(err)
+	before := testOrgMSP(t, config, "Application")
+	rootCert := before.RootCerts[0]
+	tlsRootCert := before.TlsRootCerts[0]
+
+	err = SetMSPCACerts(config, "sys--mon", &MSPCACerts{
+		TLSRootCerts: [][]byte{tlsRootCert, rootCert},
+	})
+	assert.NoError(err)
+	for _, groupKey := range []string{"Application", "Orderer"} {
+		after := testOrgMSP(t, config, groupKey)
+		assert.Equal([][]byte{rootCert}, after.RootCerts)
+		assert.Equal([][]byte{tlsRootCert, rootCert}, after.TlsRootCerts)
+		assert.Equal("sys--mon", after.Name)
+	}
+}
+
+func TestSetMSPCACertsErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	config, err := GetChannelConfig(readTestBlock("config-0.block"))
+	assert.NoError(err)
+
+	err = SetMSPCACerts(config, "sys--mon", &MSPCACerts{RootCerts: [][]byte{}})
+	assert.Regexp("an MSP must have at least one root CA certificate", err)
+	err = SetMSPCACerts(config, "sys--mon", &MSPCACerts{IntermediateCerts: [][]byte{[]byte("not a cert")}})
+	assert.Regexp("certificates must be PEM encoded", err)
+	err = SetMSPCACerts(config, "sys--mon", &MSPCACerts{IntermediateCerts: [][]byte{[]byte("-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n")}})
+	assert.Regexp("invalid certificate", err)
+	err = SetMSPCACerts(config, "Org2MSP", &MSPCACerts{})
+	assert.Regexp("no organization with MSP ID Org2MSP in the channel", err)
+}
+
+func TestNewConfigUpdateEnvelope(t *testing.T) {
+	assert := assert.New(t)
+
+	envBytes, err := NewConfigUpdateEnvelope("default-channel", &common.ConfigUpdate{ChannelId: "default-channel"})
+	assert.NoError(err)
+
+	env := &common.Envelope{}
+	assert.NoError(proto.Unmarshal(envBytes, env))
+	payload := &common.Payload{}
+	assert.NoError(proto.Unmarshal(env.Payload, payload))
+	channelHeader := &common.ChannelHeader{}
+	assert.NoError(proto.Unmarshal(payload.Header.ChannelHeader, channelHeader))
+	assert.Equal(int32(common.HeaderType_CONFIG_UPDATE), channelHeader.Type)
+	assert.Equal("default-channel", channelHeader.ChannelId)
+	updateEnv := &common.ConfigUpdateEnvelope{}
+	assert.NoError(proto.Unmarshal(payload.Data, updateEnv))
+	update := &common.ConfigUpdate{}
+	assert.NoError(proto.Unmarshal(updateEnv.ConfigUpdate, update))
+	assert.Equal("default-channel", update.ChannelId)
+}
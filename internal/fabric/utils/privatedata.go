@@ -0,0 +1,168 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"github.com/golang/protobuf/proto" //nolint
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/firefly-fabconnect/internal/events/api"
+)
+
+// CollectionMembers returns the MSP IDs of the member organizations of each static private data
+// collection, by collection name, as named by the principals of its member orgs policy
+func CollectionMembers(configs []*peer.CollectionConfig) map[string][]string {
+	members := make(map[string][]string, len(configs))
+	for _, config := range configs {
+		static := config.GetStaticCollectionConfig()
+		if static == nil {
+			continue
+		}
+		var mspIDs []string
+		for _, principal := range static.GetMemberOrgsPolicy().GetSignaturePolicy().GetIdentities() {
+			if mspID := principalMSPID(principal); mspID != "" {
+				mspIDs = append(mspIDs, mspID)
+			}
+		}
+		members[static.Name] = mspIDs
+	}
+	return members
+}
+
+func principalMSPID(principal *msp.MSPPrincipal) string {
+	switch principal.PrincipalClassification {
+	case msp.MSPPrincipal_ROLE:
+		role := &msp.MSPRole{}
+		if proto.Unmarshal(principal.Principal, role) == nil {
+			return role.MspIdentifier
+		}
+	case msp.MSPPrincipal_ORGANIZATION_UNIT:
+		ou := &msp.OrganizationUnit{}
+		if proto.Unmarshal(principal.Principal, ou) == nil {
+			return ou.MspIdentifier
+		}
+	case msp.MSPPrincipal_IDENTITY:
+		id := &msp.SerializedIdentity{}
+		if proto.Unmarshal(principal.Principal, id) == nil {
+			return id.Mspid
+		}
+	}
+	return ""
+}
+
+// FilterCollectionWrites returns the writes to the collections that readable returns true for,
+// or nil if there are none
+func FilterCollectionWrites(writes []*api.CollectionWrites, readable func(namespace, collection string) bool) []*api.CollectionWrites {
+	var filtered []*api.CollectionWrites
+	for _, w := range writes {
+		if readable(w.Namespace, w.Collection) {
+			filtered = append(filtered, w)
+		}
+	}
+	return filtered
+}
+
+// FilterPrivateData returns a copy of a decoded block for a reader of the organization with the
+// MSP ID. The transient data of a transaction, which carries private data in plaintext, is only
+// kept for the organization that submitted the transaction. The hashed writes to a collection are
+// only kept if readable returns true for it. The parts of the block that are not changed are
+// shared with the original, which the decoders cache for all the subscriptions on the channel
+func FilterPrivateData(rawBlock *RawBlock, block *Block, mspID string, readable func(namespace, collection string) bool) (*RawBlock, *Block) {
+	return filterRawBlock(rawBlock, mspID, readable), filterBlock(block, mspID)
+}
+
+func filterRawBlock(rawBlock *RawBlock, mspID string, readable func(namespace, collection string) bool) *RawBlock {
+	if rawBlock == nil || rawBlock.Data == nil {
+		return rawBlock
+	}
+	filtered := *rawBlock
+	filtered.Data = &BlockData{Data: make([]*BlockDataEnvelope, len(rawBlock.Data.Data))}
+	for i, env := range rawBlock.Data.Data {
+		filtered.Data.Data[i] = filterEnvelope(env, mspID, readable)
+	}
+	return &filtered
+}
+
+func filterEnvelope(env *BlockDataEnvelope, mspID string, readable func(namespace, collection string) bool) *BlockDataEnvelope {
+	if env == nil || env.Payload == nil || env.Payload.Data == nil || len(env.Payload.Data.Actions) == 0 {
+		return env
+	}
+	submitter := false
+	if header := env.Payload.Header; header != nil && header.SignatureHeader != nil && header.SignatureHeader.Creator != nil {
+		submitter = mspID != "" && header.SignatureHeader.Creator.Mspid == mspID
+	}
+	data := *env.Payload.Data
+	data.Actions = make([]*Action, len(env.Payload.Data.Actions))
+	for i, action := range env.Payload.Data.Actions {
+		data.Actions[i] = filterAction(action, submitter, readable)
+	}
+	payload := *env.Payload
+	payload.Data = &data
+	filtered := *env
+	filtered.Payload = &payload
+	return &filtered
+}
+
+func filterAction(action *Action, submitter bool, readable func(namespace, collection string) bool) *Action {
+	if action == nil || action.Payload == nil {
+		return action
+	}
+	actionPayload := *action.Payload
+	if cpp := actionPayload.ChaincodeProposalPayload; cpp != nil && cpp.TransientMap != nil && !submitter {
+		withoutTransient := *cpp
+		withoutTransient.TransientMap = nil
+		actionPayload.ChaincodeProposalPayload = &withoutTransient
+	}
+	if apa := actionPayload.Action; apa != nil && apa.ProposalResponsePayload != nil && apa.ProposalResponsePayload.Extension != nil {
+		extension := *apa.ProposalResponsePayload.Extension
+		extension.PrivateData = FilterCollectionWrites(extension.PrivateData, readable)
+		prp := *apa.ProposalResponsePayload
+		prp.Extension = &extension
+		filteredAction := *apa
+		filteredAction.ProposalResponsePayload = &prp
+		actionPayload.Action = &filteredAction
+	}
+	filtered := *action
+	filtered.Payload = &actionPayload
+	return &filtered
+}
+
+func filterBlock(block *Block, mspID string) *Block {
+	if block == nil || len(block.Transactions) == 0 {
+		return block
+	}
+	filtered := *block
+	filtered.Transactions = make([]*Transaction, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		filtered.Transactions[i] = tx
+		if tx == nil || (mspID != "" && tx.Creator != nil && tx.Creator.MspID == mspID) {
+			continue
+		}
+		filteredTx := *tx
+		filteredTx.Actions = make([]*TransactionAction, len(tx.Actions))
+		for j, action := range tx.Actions {
+			filteredTx.Actions[j] = action
+			if action != nil && action.TransientMap != nil {
+				withoutTransient := *action
+				withoutTransient.TransientMap = nil
+				filteredTx.Actions[j] = &withoutTransient
+			}
+		}
+		filtered.Transactions[i] = &filteredTx
+	}
+	return &filtered
+}
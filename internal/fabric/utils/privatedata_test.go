@@ -0,0 +1,136 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto" //nolint
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/firefly-fabconnect/internal/events/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func testCollectionConfig(name string, principals ...*msp.MSPPrincipal) *peer.CollectionConfig {
+	return &peer.CollectionConfig{
+		Payload: &peer.CollectionConfig_StaticCollectionConfig{
+			StaticCollectionConfig: &peer.StaticCollectionConfig{
+				Name: name,
+				MemberOrgsPolicy: &peer.CollectionPolicyConfig{
+					Payload: &peer.CollectionPolicyConfig_SignaturePolicy{
+						SignaturePolicy: &common.SignaturePolicyEnvelope{Identities: principals},
+					},
+				},
+			},
+		},
+	}
+}
+
+func testPrincipal(classification msp.MSPPrincipal_Classification, principal proto.Message) *msp.MSPPrincipal {
+	b, _ := proto.Marshal(principal)
+	return &msp.MSPPrincipal{PrincipalClassification: classification, Principal: b}
+}
+
+func TestCollectionMembers(t *testing.T) {
+	assert := assert.New(t)
+	members := CollectionMembers([]*peer.CollectionConfig{
+		testCollectionConfig("assetCollection",
+			testPrincipal(msp.MSPPrincipal_ROLE, &msp.MSPRole{MspIdentifier: "Org1MSP", Role: msp.MSPRole_MEMBER}),
+			testPrincipal(msp.MSPPrincipal_ORGANIZATION_UNIT, &msp.OrganizationUnit{MspIdentifier: "Org2MSP"}),
+			testPrincipal(msp.MSPPrincipal_IDENTITY, &msp.SerializedIdentity{Mspid: "Org3MSP"}),
+			&msp.MSPPrincipal{PrincipalClassification: msp.MSPPrincipal_ROLE, Principal: []byte("!not a role")},
+		),
+		testCollectionConfig("Org1MSPPrivateCollection",
+			testPrincipal(msp.MSPPrincipal_ROLE, &msp.MSPRole{MspIdentifier: "Org1MSP", Role: msp.MSPRole_MEMBER}),
+		),
+		{},
+	})
+	assert.Equal(map[string][]string{
+		"assetCollection":          {"Org1MSP", "Org2MSP", "Org3MSP"},
+		"Org1MSPPrivateCollection": {"Org1MSP"},
+	}, members)
+}
+
+func testBlockWithPrivateData(creator string) (*RawBlock, *Block) {
+	transient := map[string][]byte{"asset_properties": []byte("secret")}
+	rawBlock := &RawBlock{
+		Header: &common.BlockHeader{Number: 10},
+		Data: &BlockData{Data: []*BlockDataEnvelope{{
+			Payload: &Payload{
+				Header: &PayloadHeader{SignatureHeader: &SignatureHeader{Creator: &msp.SerializedIdentity{Mspid: creator}}},
+				Data: &PayloadData{Actions: []*Action{{
+					Payload: &ActionPayload{
+						ChaincodeProposalPayload: &ChaincodeProposalPayload{TransientMap: &transient},
+						Action: &ActionPayloadAction{ProposalResponsePayload: &ProposalResponsePayload{
+							Extension: &Extension{PrivateData: []*api.CollectionWrites{
+								{Namespace: "asset_transfer", Collection: "assetCollection"},
+								{Namespace: "asset_transfer", Collection: "Org2MSPPrivateCollection"},
+							}},
+						}},
+					},
+				}}},
+			},
+		}}},
+	}
+	block := &Block{
+		Number: 10,
+		Transactions: []*Transaction{{
+			Creator: &Creator{MspID: creator},
+			Actions: []*TransactionAction{{TransientMap: &transient}},
+		}},
+	}
+	return rawBlock, block
+}
+
+func TestFilterPrivateData(t *testing.T) {
+	assert := assert.New(t)
+	readable := func(namespace, collection string) bool {
+		return namespace == "asset_transfer" && collection == "assetCollection"
+	}
+
+	// the organization that submitted the transaction keeps its transient data
+	rawBlock, block := testBlockWithPrivateData("Org1MSP")
+	filteredRaw, filteredBlock := FilterPrivateData(rawBlock, block, "Org1MSP", readable)
+	action := filteredRaw.Data.Data[0].Payload.Data.Actions[0].Payload
+	assert.NotNil(action.ChaincodeProposalPayload.TransientMap)
+	assert.NotNil(filteredBlock.Transactions[0].Actions[0].TransientMap)
+	privateData := action.Action.ProposalResponsePayload.Extension.PrivateData
+	assert.Equal(1, len(privateData))
+	assert.Equal("assetCollection", privateData[0].Collection)
+
+	// other organizations do not, and the decoded blocks are not modified
+	filteredRaw, filteredBlock = FilterPrivateData(rawBlock, block, "Org2MSP", readable)
+	action = filteredRaw.Data.Data[0].Payload.Data.Actions[0].Payload
+	assert.Nil(action.ChaincodeProposalPayload.TransientMap)
+	assert.Nil(filteredBlock.Transactions[0].Actions[0].TransientMap)
+	assert.NotNil(rawBlock.Data.Data[0].Payload.Data.Actions[0].Payload.ChaincodeProposalPayload.TransientMap)
+	assert.NotNil(block.Transactions[0].Actions[0].TransientMap)
+	assert.Equal(2, len(rawBlock.Data.Data[0].Payload.Data.Actions[0].Payload.Action.ProposalResponsePayload.Extension.PrivateData))
+
+	// nor does a reader whose organization is not known
+	filteredRaw, filteredBlock = FilterPrivateData(rawBlock, block, "", func(string, string) bool { return false })
+	action = filteredRaw.Data.Data[0].Payload.Data.Actions[0].Payload
+	assert.Nil(action.ChaincodeProposalPayload.TransientMap)
+	assert.Nil(action.Action.ProposalResponsePayload.Extension.PrivateData)
+	assert.Nil(filteredBlock.Transactions[0].Actions[0].TransientMap)
+
+	filteredRaw, filteredBlock = FilterPrivateData(nil, nil, "Org1MSP", readable)
+	assert.Nil(filteredRaw)
+	assert.Nil(filteredBlock)
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/hyperledger/fabric-protos-go/common"
 	"github.com/hyperledger/fabric-protos-go/msp"
 	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/firefly-fabconnect/internal/events/api"
 )
 
 type RawBlock struct {
@@ -96,7 +97,8 @@ type Extension struct {
 	ChaincodeID *peer.ChaincodeID `json:"chaincode_id"`
 	Events      *ChaincodeEvent   `json:"events"`
 	// Response
-	// Result
+	// Only the hashed writes to private data collections are decoded from the results
+	PrivateData []*api.CollectionWrites `json:"private_data,omitempty"`
 }
 
 type ChaincodeEvent struct {
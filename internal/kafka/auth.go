@@ -0,0 +1,39 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"context"
+
+	"github.com/Shopify/sarama"
+	"github.com/hyperledger/firefly-fabconnect/internal/auth"
+	"github.com/hyperledger/firefly-fabconnect/internal/messages"
+)
+
+// AuthContext verifies the access token the REST gateway forwarded on a consumed message,
+// with the registered security module, exactly as the REST gateway verifies the bearer token
+// of a request. Messages must not be processed if an error is returned
+func AuthContext(ctx context.Context, msg *sarama.ConsumerMessage) (context.Context, error) {
+	accessToken := ""
+	for _, header := range msg.Headers {
+		if header != nil && string(header.Key) == messages.RecordHeaderAccessToken {
+			accessToken = string(header.Value)
+			break
+		}
+	}
+	return auth.WithAuthContext(ctx, accessToken)
+}
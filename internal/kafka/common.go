@@ -35,6 +35,8 @@ import (
 type Common interface {
 	ValidateConf() error
 	Start() error
+	Stop()
+	Resume() error
 	Conf() conf.KafkaConf
 	Producer() Producer
 }
@@ -62,6 +64,7 @@ type kafkaCommon struct {
 	producerWG      sync.WaitGroup
 	kafkaGoRoutines GoRoutines
 	saramaLogger    saramaLogger
+	mux             sync.Mutex // held while the producer and consumer are opened or closed
 }
 
 func (k *kafkaCommon) Conf() conf.KafkaConf {
@@ -211,19 +214,10 @@ func (k *kafkaCommon) startConsumer() (err error) {
 // Start kicks off the bridge
 func (k *kafkaCommon) Start() (err error) {
 
-	if err = k.connect(); err != nil {
-		return nil
-	}
-	if err = k.createConsumer(); err != nil {
-		return nil
-	}
-	if err = k.createProducer(); err != nil {
-		return nil
-	}
-	if err = k.startConsumer(); err != nil {
-		return nil
-	}
-	if err = k.startProducer(); err != nil {
+	k.mux.Lock()
+	err = k.open()
+	k.mux.Unlock()
+	if err != nil {
 		return nil
 	}
 
@@ -231,13 +225,52 @@ func (k *kafkaCommon) Start() (err error) {
 	k.signals = make(chan os.Signal, 1)
 	signal.Notify(k.signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
 	for range k.signals {
-		k.producer.AsyncClose()
-		k.consumer.Close()
-		k.producerWG.Wait()
-		k.consumerWG.Wait()
+		k.Stop()
 
 		log.Infof("Kafka Bridge complete")
 		return nil
 	}
 	return nil
 }
+
+func (k *kafkaCommon) open() (err error) {
+	if err = k.connect(); err != nil {
+		return err
+	}
+	if err = k.createConsumer(); err != nil {
+		return err
+	}
+	if err = k.createProducer(); err != nil {
+		return err
+	}
+	if err = k.startConsumer(); err != nil {
+		return err
+	}
+	return k.startProducer()
+}
+
+// Stop closes the producer and consumer, without ending the bridge, so it can be resumed
+func (k *kafkaCommon) Stop() {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	if k.producer == nil {
+		return
+	}
+	k.producer.AsyncClose()
+	k.consumer.Close()
+	k.producerWG.Wait()
+	k.consumerWG.Wait()
+	k.producer = nil
+	k.consumer = nil
+	log.Infof("Kafka producer and consumer closed")
+}
+
+// Resume reconnects a stopped bridge, creating a new producer and consumer
+func (k *kafkaCommon) Resume() error {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	if k.producer != nil {
+		return nil
+	}
+	return k.open()
+}
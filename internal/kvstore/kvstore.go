@@ -38,12 +38,20 @@ type KVIterator interface {
 	Release()
 }
 
+// KVPut is a key and value, written with others by PutBatch
+type KVPut struct {
+	Key string
+	Val []byte
+}
+
 // KVStore interface for key value stores
 type KVStore interface {
 	Init() error
 	Put(key string, val []byte) error
+	PutBatch(puts []KVPut) error
 	Get(key string) ([]byte, error)
 	Delete(key string) error
+	DeleteBatch(keys []string) error
 	NewIterator() KVIterator
 	NewIteratorWithRange(keyRange interface{}) KVIterator
 	Close() error
@@ -75,6 +83,19 @@ func (k *levelDBKeyValueStore) Put(key string, val []byte) error {
 	return err
 }
 
+// PutBatch writes all the keys atomically, in a single write to the journal
+func (k *levelDBKeyValueStore) PutBatch(puts []KVPut) error {
+	batch := new(leveldb.Batch)
+	for _, put := range puts {
+		batch.Put([]byte(put.Key), put.Val)
+	}
+	err := k.db.Write(batch, nil)
+	if err != nil && len(puts) > 0 {
+		k.warnIfErr("PutBatch", puts[0].Key, err)
+	}
+	return err
+}
+
 func (k *levelDBKeyValueStore) Get(key string) ([]byte, error) {
 	b, err := k.db.Get([]byte(key), nil)
 	k.warnIfErr("Get", key, err)
@@ -87,6 +108,19 @@ func (k *levelDBKeyValueStore) Delete(key string) error {
 	return err
 }
 
+// DeleteBatch deletes all the keys atomically, in a single write to the journal
+func (k *levelDBKeyValueStore) DeleteBatch(keys []string) error {
+	batch := new(leveldb.Batch)
+	for _, key := range keys {
+		batch.Delete([]byte(key))
+	}
+	err := k.db.Write(batch, nil)
+	if err != nil && len(keys) > 0 {
+		k.warnIfErr("DeleteBatch", keys[0], err)
+	}
+	return err
+}
+
 func (k *levelDBKeyValueStore) NewIterator() KVIterator {
 	return &levelDBKeyIterator{
 		i: k.db.NewIterator(nil, nil),
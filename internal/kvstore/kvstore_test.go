@@ -55,6 +55,44 @@ func TestLevelDBPutGet(t *testing.T) {
 	kv.Close()
 }
 
+func TestLevelDBPutBatch(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	kv := NewLDBKeyValueStore(path.Join(dir, "db"))
+	err := kv.Init()
+	assert.NoError(err)
+	err = kv.PutBatch([]KVPut{{Key: "key1", Val: []byte("val1")}, {Key: "key2", Val: []byte("val2")}})
+	assert.NoError(err)
+	val, err := kv.Get("key2")
+	assert.NoError(err)
+	assert.Equal("val2", string(val))
+	kv.Close()
+	err = kv.PutBatch([]KVPut{{Key: "key3", Val: []byte("val3")}})
+	assert.Error(err)
+}
+
+func TestLevelDBDeleteBatch(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempdir(t)
+	defer cleanup(t, dir)
+	kv := NewLDBKeyValueStore(path.Join(dir, "db"))
+	err := kv.Init()
+	assert.NoError(err)
+	err = kv.PutBatch([]KVPut{{Key: "key1", Val: []byte("val1")}, {Key: "key2", Val: []byte("val2")}, {Key: "key3", Val: []byte("val3")}})
+	assert.NoError(err)
+	err = kv.DeleteBatch([]string{"key1", "key3", "key4"})
+	assert.NoError(err)
+	_, err = kv.Get("key1")
+	assert.Regexp("not found", err)
+	val, err := kv.Get("key2")
+	assert.NoError(err)
+	assert.Equal("val2", string(val))
+	kv.Close()
+	err = kv.DeleteBatch([]string{"key2"})
+	assert.Error(err)
+}
+
 func TestLevelDBIterate(t *testing.T) {
 	assert := assert.New(t)
 	dir := tempdir(t)
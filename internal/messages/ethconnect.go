@@ -0,0 +1,79 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package messages
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// Fabric specific reply headers, that firefly-ethconnect does not have
+var fabricReplyHeaders = []string{"signer", "channel", "chaincode", "payloadSchema"}
+
+// ToEthconnectReply reshapes a reply, in its generic JSON form, into the form
+// firefly-ethconnect uses for the same reply type, so that tooling written
+// against ethconnect can process it unchanged:
+//   - the Fabric specific headers are removed
+//   - "blockNumber" is a decimal string
+//   - "status" is "1" for success and "0" for failure, and the Fabric transaction
+//     validation code moves to "validationCode"
+//   - "signer" is renamed "from"
+func ToEthconnectReply(reply map[string]interface{}) {
+	headers, ok := reply["headers"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, name := range fabricReplyHeaders {
+		delete(headers, name)
+	}
+	msgType, _ := headers["type"].(string)
+	if msgType != MsgTypeTransactionSuccess && msgType != MsgTypeTransactionFailure {
+		return
+	}
+	switch blockNumber := reply["blockNumber"].(type) {
+	case float64:
+		reply["blockNumber"] = strconv.FormatFloat(blockNumber, 'f', -1, 64)
+	case json.Number:
+		reply["blockNumber"] = blockNumber.String()
+	}
+	if status, exists := reply["status"]; exists {
+		reply["validationCode"] = status
+	}
+	if msgType == MsgTypeTransactionSuccess {
+		reply["status"] = "1"
+	} else {
+		reply["status"] = "0"
+	}
+	if signer, exists := reply["signer"]; exists {
+		reply["from"] = signer
+		delete(reply, "signer")
+	}
+}
+
+// MarshalEthconnectReply serializes a reply in the form firefly-ethconnect uses
+func MarshalEthconnectReply(reply interface{}) ([]byte, error) {
+	b, err := json.Marshal(reply)
+	if err != nil {
+		return nil, err
+	}
+	var generic map[string]interface{}
+	if err := json.Unmarshal(b, &generic); err != nil {
+		return nil, err
+	}
+	ToEthconnectReply(generic)
+	return json.MarshalIndent(generic, "", "  ")
+}
@@ -19,6 +19,7 @@ package messages
 import (
 	"encoding/json"
 	"reflect"
+	"time"
 )
 
 // Types of messages that fabconnect internally posts to the message queue (kafka)
@@ -60,6 +61,8 @@ type CommonHeaders struct {
 // RequestHeaders are common to all requests
 type RequestHeaders struct {
 	CommonHeaders
+	// Overrides the receipts.requestEcho.enabled config for the receipt of the request
+	EchoRequest *bool `json:"echoRequest,omitempty"`
 }
 
 // ReplyHeaders are common to all replies
@@ -97,6 +100,14 @@ type QueryChaincode struct {
 	Function   string   `json:"func"`
 	Args       []string `json:"args,omitempty"`
 	StrongRead bool     `json:"strongread"`
+	// Set for paginated queries, and passed to the chaincode after the args, following the
+	// convention of Fabric's GetQueryResultWithPagination and GetStateByRangeWithPagination
+	PageSize int32  `json:"pageSize,omitempty"`
+	Bookmark string `json:"bookmark,omitempty"`
+	// The query is not evaluated until the height of the chain shows this block is committed, waiting
+	// up to the BlockNumberTimeout, so a client reads its own writes. Zero does not wait
+	MinBlockNumber     uint64        `json:"minBlockNumber,omitempty"`
+	BlockNumberTimeout time.Duration `json:"-"`
 }
 
 type GetTxByID struct {
@@ -108,6 +119,39 @@ type GetChainInfo struct {
 	RequestCommon
 }
 
+// GetBlockHeight returns the height of the chain, once it is above WaitAbove or the Timeout expires
+type GetBlockHeight struct {
+	RequestCommon
+	WaitAbove uint64        `json:"waitAbove"`
+	Timeout   time.Duration `json:"-"`
+}
+
+// GetPrivateData reads a key of a private data collection. Fabric only exposes private data to
+// chaincode, so it is read by querying a function of the chaincode with the collection and key
+type GetPrivateData struct {
+	RequestCommon
+	Function   string `json:"func"`
+	Collection string `json:"collection"`
+	Key        string `json:"key"`
+}
+
+// UpdateChannelConfig is a guided update to the config of an organization in a channel, computed
+// against the latest config block rather than crafted by hand with configtxlator
+type UpdateChannelConfig struct {
+	RequestCommon
+	MSPID string `json:"mspId"`
+	// host:port of each anchor peer, when setting the anchor peers of the organization
+	AnchorPeers []string `json:"anchorPeers,omitempty"`
+	// PEM encoded CA certificates, when updating the MSP of the organization. The lists that
+	// are not set are left unchanged
+	RootCerts            []string `json:"rootCerts,omitempty"`
+	IntermediateCerts    []string `json:"intermediateCerts,omitempty"`
+	TLSRootCerts         []string `json:"tlsRootCerts,omitempty"`
+	TLSIntermediateCerts []string `json:"tlsIntermediateCerts,omitempty"`
+	// false to return the config update for the signatures of other organizations, rather than submit it
+	Submit bool `json:"submit"`
+}
+
 type GetBlock struct {
 	RequestCommon
 	BlockNumber uint64
@@ -126,6 +170,15 @@ type SendTransaction struct {
 	Function     string            `json:"func"`
 	Args         []string          `json:"args,omitempty"`
 	TransientMap map[string]string `json:"transientMap,omitempty"`
+	Outbox       *Outbox           `json:"outbox,omitempty"`
+}
+
+// Outbox holds the receipt of a transaction until its chaincode event has been
+// delivered to an event stream, so the write and the event are processed together
+type Outbox struct {
+	Stream      string `json:"stream"`
+	EventFilter string `json:"eventFilter,omitempty"`
+	TimeoutSec  int    `json:"timeoutSec,omitempty"`
 }
 
 // DeployChaincode message instructs the bridge to install a contract
@@ -137,9 +190,19 @@ type DeployChaincode struct {
 
 type QueryResult struct {
 	ReplyCommon
+	Page   *QueryPage  `json:"page,omitempty"`
 	Result interface{} `json:"result"`
 }
 
+// QueryPage is returned with the result of a paginated query. NextBookmark is passed as
+// the bookmark of the query for the next page
+type QueryPage struct {
+	PageSize            int32  `json:"pageSize"`
+	Bookmark            string `json:"bookmark"`
+	NextBookmark        string `json:"nextBookmark"`
+	FetchedRecordsCount int32  `json:"fetchedRecordsCount"`
+}
+
 type LedgerQueryResult struct {
 	ReplyCommon
 	Result interface{} `json:"result"`
@@ -154,6 +217,8 @@ type TransactionReceipt struct {
 	Signer          string `json:"signer"`
 	TransactionHash string `json:"transactionHash"`
 	Status          string `json:"status"`
+	// Decoded result of the chaincode function, when a result decoder is configured for it
+	Result interface{} `json:"result,omitempty"`
 }
 
 type ErrorReply struct {
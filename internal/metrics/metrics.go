@@ -0,0 +1,189 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultInterval = 10 * time.Second
+	defaultPrefix   = "fabconnect"
+)
+
+// Kind of a metric
+type Kind int
+
+const (
+	// Gauge is a value that can go up and down
+	Gauge Kind = iota
+	// Counter is a running total since the connector started, that only goes up
+	Counter
+)
+
+// Metric is a sample of one metric, for one set of tags
+type Metric struct {
+	Name  string
+	Kind  Kind
+	Value float64
+	Tags  map[string]string
+}
+
+// Source is implemented by the components of the connector that report metrics
+type Source interface {
+	Metrics() []Metric
+}
+
+// SourceFunc adapts a function to a Source
+type SourceFunc func() []Metric
+
+func (f SourceFunc) Metrics() []Metric {
+	return f()
+}
+
+type exporter interface {
+	export(metrics []Metric, now time.Time) error
+	close()
+}
+
+// Pusher periodically collects the metrics of its sources, and pushes them to the
+// configured exporters, for environments without a scraper near the connector
+type Pusher struct {
+	interval  time.Duration
+	prefix    string
+	mux       sync.Mutex
+	sources   []Source
+	exporters []exporter
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// Enabled returns true if any exporter is configured
+func Enabled(config *conf.MetricsConf) bool {
+	return config.StatsD.Address != "" || config.OTLP.Endpoint != ""
+}
+
+// NewPusher constructor
+func NewPusher(config *conf.MetricsConf) (*Pusher, error) {
+	p := &Pusher{
+		interval: time.Duration(config.IntervalSec) * time.Second,
+		prefix:   config.Prefix,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if p.interval <= 0 {
+		p.interval = defaultInterval
+	}
+	if p.prefix == "" {
+		p.prefix = defaultPrefix
+	}
+	if config.StatsD.Address != "" {
+		e, err := newStatsDExporter(config.StatsD.Address)
+		if err != nil {
+			return nil, err
+		}
+		p.exporters = append(p.exporters, e)
+	}
+	if config.OTLP.Endpoint != "" {
+		p.exporters = append(p.exporters, newOTLPExporter(&config.OTLP, p.interval))
+	}
+	return p, nil
+}
+
+// AddSource registers a component whose metrics are pushed
+func (p *Pusher) AddSource(source Source) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.sources = append(p.sources, source)
+}
+
+// Start pushes the metrics every interval, until closed
+func (p *Pusher) Start() {
+	log.Infof("Pushing metrics every %s", p.interval)
+	go p.pushLoop()
+}
+
+// Close stops pushing metrics
+func (p *Pusher) Close() {
+	close(p.stop)
+	<-p.done
+	for _, e := range p.exporters {
+		e.close()
+	}
+}
+
+func (p *Pusher) pushLoop() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case now := <-ticker.C:
+			p.push(now)
+		}
+	}
+}
+
+func (p *Pusher) push(now time.Time) {
+	metrics := p.collect()
+	for _, e := range p.exporters {
+		if err := e.export(metrics, now); err != nil {
+			log.Warnf("Failed to push metrics: %s", err)
+		}
+	}
+}
+
+func (p *Pusher) collect() []Metric {
+	p.mux.Lock()
+	sources := p.sources
+	p.mux.Unlock()
+	var metrics []Metric
+	for _, source := range sources {
+		for _, m := range source.Metrics() {
+			m.Name = p.prefix + "." + m.Name
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics
+}
+
+// seriesKey identifies a metric and its tags, for the exporters that track them between pushes
+func seriesKey(m *Metric) string {
+	var b strings.Builder
+	b.WriteString(m.Name)
+	for _, k := range sortedTagKeys(m.Tags) {
+		b.WriteString("," + k + "=" + m.Tags[k])
+	}
+	return b.String()
+}
+
+func sortedTagKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,145 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/stretchr/testify/assert"
+)
+
+var testCount float64
+
+func testSource() Source {
+	return SourceFunc(func() []Metric {
+		return []Metric{
+			{Name: "eventstream.inflight", Kind: Gauge, Value: 3, Tags: map[string]string{"stream": "es1"}},
+			{Name: "eventstream.inflight", Kind: Gauge, Value: 5, Tags: map[string]string{"stream": "es2"}},
+			{Name: "tx.committed", Kind: Counter, Value: testCount},
+		}
+	})
+}
+
+func TestEnabled(t *testing.T) {
+	assert := assert.New(t)
+	assert.False(Enabled(&conf.MetricsConf{}))
+	assert.True(Enabled(&conf.MetricsConf{StatsD: conf.StatsDConf{Address: "localhost:8125"}}))
+	assert.True(Enabled(&conf.MetricsConf{OTLP: conf.OTLPConf{Endpoint: "http://localhost:4318/v1/metrics"}}))
+}
+
+func TestStatsDExport(t *testing.T) {
+	assert := assert.New(t)
+	agent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer agent.Close()
+
+	p, err := NewPusher(&conf.MetricsConf{StatsD: conf.StatsDConf{Address: agent.LocalAddr().String()}})
+	assert.NoError(err)
+	p.AddSource(testSource())
+	p.Start()
+	defer p.Close()
+
+	read := func() string {
+		buf := make([]byte, statsdMaxPacket)
+		_ = agent.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := agent.ReadFrom(buf)
+		assert.NoError(err)
+		return string(buf[:n])
+	}
+
+	testCount = 10
+	p.push(time.Now())
+	assert.Equal(strings.Join([]string{
+		"fabconnect.eventstream.inflight:3|g|#stream:es1",
+		"fabconnect.eventstream.inflight:5|g|#stream:es2",
+		"fabconnect.tx.committed:10|c",
+	}, "\n"), read())
+
+	// counters are sent as the increase since the last push, and skipped when unchanged
+	testCount = 15
+	p.push(time.Now())
+	assert.Contains(read(), "fabconnect.tx.committed:5|c")
+	p.push(time.Now())
+	assert.NotContains(read(), "tx.committed")
+}
+
+func TestStatsDBadAddress(t *testing.T) {
+	_, err := NewPusher(&conf.MetricsConf{StatsD: conf.StatsDConf{Address: "not an address"}})
+	assert.Error(t, err)
+}
+
+func TestOTLPExport(t *testing.T) {
+	assert := assert.New(t)
+	requests := make(chan *otlpRequest, 1)
+	var authHeader string
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		authHeader = req.Header.Get("Authorization")
+		var body otlpRequest
+		assert.NoError(json.NewDecoder(req.Body).Decode(&body))
+		requests <- &body
+	}))
+	defer svr.Close()
+
+	p, err := NewPusher(&conf.MetricsConf{
+		Prefix: "fc",
+		OTLP: conf.OTLPConf{
+			Endpoint: svr.URL,
+			Headers:  map[string]string{"Authorization": "Bearer token1"},
+		},
+	})
+	assert.NoError(err)
+	p.AddSource(testSource())
+	testCount = 10
+	p.push(time.Unix(1000, 0))
+	p.Start()
+	p.Close()
+
+	body := <-requests
+	assert.Equal("Bearer token1", authHeader)
+	metrics := body.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	assert.Len(metrics, 2)
+	assert.Equal("fc.eventstream.inflight", metrics[0].Name)
+	assert.Len(metrics[0].Gauge.DataPoints, 2)
+	assert.Equal("es2", metrics[0].Gauge.DataPoints[1].Attributes[0].Value.StringValue)
+	assert.Equal(float64(5), metrics[0].Gauge.DataPoints[1].AsDouble)
+	assert.Equal("1000000000000", metrics[0].Gauge.DataPoints[1].TimeUnixNano)
+	assert.Equal("fc.tx.committed", metrics[1].Name)
+	assert.True(metrics[1].Sum.IsMonotonic)
+	assert.Equal(otlpCumulative, metrics[1].Sum.AggregationTemporality)
+	assert.Equal(float64(10), metrics[1].Sum.DataPoints[0].AsDouble)
+	assert.NotEmpty(metrics[1].Sum.DataPoints[0].StartTimeUnixNano)
+}
+
+func TestOTLPExportFailure(t *testing.T) {
+	assert := assert.New(t)
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(503)
+	}))
+	defer svr.Close()
+
+	e := newOTLPExporter(&conf.OTLPConf{Endpoint: svr.URL}, time.Second)
+	err := e.export(testSource().Metrics(), time.Now())
+	assert.Regexp("status=503", err)
+	assert.NoError(e.export(nil, time.Now()))
+}
@@ -0,0 +1,187 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+)
+
+const (
+	otlpServiceName = "fabconnect"
+	// AGGREGATION_TEMPORALITY_CUMULATIVE in the OTLP protocol
+	otlpCumulative = 2
+)
+
+// The subset of the OTLP/JSON encoding of ExportMetricsServiceRequest used here.
+// 64-bit integers are encoded as strings, per the protobuf JSON mapping
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name  string     `json:"name"`
+	Gauge *otlpGauge `json:"gauge,omitempty"`
+	Sum   *otlpSum   `json:"sum,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsDouble          float64         `json:"asDouble"`
+}
+
+type otlpAttribute struct {
+	Key   string        `json:"key"`
+	Value otlpAnyString `json:"value"`
+}
+
+type otlpAnyString struct {
+	StringValue string `json:"stringValue"`
+}
+
+// otlpExporter POSTs metrics to an OpenTelemetry collector over OTLP/HTTP, with JSON encoding.
+// Counters are cumulative sums since the connector started
+type otlpExporter struct {
+	endpoint   string
+	headers    map[string]string
+	httpClient *http.Client
+	startTime  time.Time
+}
+
+func newOTLPExporter(config *conf.OTLPConf, interval time.Duration) *otlpExporter {
+	return &otlpExporter{
+		endpoint:   config.Endpoint,
+		headers:    config.Headers,
+		httpClient: &http.Client{Timeout: interval},
+		startTime:  time.Now(),
+	}
+}
+
+func (e *otlpExporter) export(metrics []Metric, now time.Time) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	body, _ := json.Marshal(e.buildRequest(metrics, now))
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	res, err := e.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.Errorf(errors.MetricsOTLPFailedHTTPStatus, e.endpoint, res.StatusCode)
+	}
+	return nil
+}
+
+func (e *otlpExporter) buildRequest(metrics []Metric, now time.Time) *otlpRequest {
+	timestamp := strconv.FormatInt(now.UnixNano(), 10)
+	startTimestamp := strconv.FormatInt(e.startTime.UnixNano(), 10)
+	// Samples of the same metric with different tags are data points of one OTLP metric
+	var otlpMetrics []otlpMetric
+	byName := make(map[string]int)
+	for _, m := range metrics {
+		dp := otlpDataPoint{
+			TimeUnixNano: timestamp,
+			AsDouble:     m.Value,
+		}
+		for _, k := range sortedTagKeys(m.Tags) {
+			dp.Attributes = append(dp.Attributes, otlpAttribute{Key: k, Value: otlpAnyString{StringValue: m.Tags[k]}})
+		}
+		idx, ok := byName[m.Name]
+		if !ok {
+			idx = len(otlpMetrics)
+			byName[m.Name] = idx
+			om := otlpMetric{Name: m.Name}
+			if m.Kind == Counter {
+				om.Sum = &otlpSum{AggregationTemporality: otlpCumulative, IsMonotonic: true}
+			} else {
+				om.Gauge = &otlpGauge{}
+			}
+			otlpMetrics = append(otlpMetrics, om)
+		}
+		om := &otlpMetrics[idx]
+		if om.Sum != nil {
+			dp.StartTimeUnixNano = startTimestamp
+			om.Sum.DataPoints = append(om.Sum.DataPoints, dp)
+		} else {
+			om.Gauge.DataPoints = append(om.Gauge.DataPoints, dp)
+		}
+	}
+	return &otlpRequest{
+		ResourceMetrics: []otlpResourceMetrics{
+			{
+				Resource: otlpResource{
+					Attributes: []otlpAttribute{{Key: "service.name", Value: otlpAnyString{StringValue: otlpServiceName}}},
+				},
+				ScopeMetrics: []otlpScopeMetrics{
+					{
+						Scope:   otlpScope{Name: otlpServiceName},
+						Metrics: otlpMetrics,
+					},
+				},
+			},
+		},
+	}
+}
+
+func (e *otlpExporter) close() {}
@@ -0,0 +1,109 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Keeps each datagram inside the MTU of common networks, so it is not fragmented
+const statsdMaxPacket = 1432
+
+// statsdExporter sends metrics to a StatsD agent over UDP. Counters are sent as the
+// increase since the last push, as StatsD sums counters itself
+type statsdExporter struct {
+	conn         net.Conn
+	lastCounters map[string]float64
+}
+
+func newStatsDExporter(address string) (*statsdExporter, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &statsdExporter{
+		conn:         conn,
+		lastCounters: make(map[string]float64),
+	}, nil
+}
+
+func (e *statsdExporter) export(metrics []Metric, _ time.Time) error {
+	var packet []byte
+	for i := range metrics {
+		m := &metrics[i]
+		line, ok := e.format(m)
+		if !ok {
+			continue
+		}
+		if len(packet) > 0 && len(packet)+1+len(line) > statsdMaxPacket {
+			if _, err := e.conn.Write(packet); err != nil {
+				return err
+			}
+			packet = packet[:0]
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		_, err := e.conn.Write(packet)
+		return err
+	}
+	return nil
+}
+
+func (e *statsdExporter) format(m *Metric) (string, bool) {
+	value := m.Value
+	metricType := "g"
+	if m.Kind == Counter {
+		key := seriesKey(m)
+		value = m.Value - e.lastCounters[key]
+		e.lastCounters[key] = m.Value
+		if value < 0 {
+			// The source was reset, such as a stream being recreated
+			value = m.Value
+		}
+		if value == 0 {
+			return "", false
+		}
+		metricType = "c"
+	}
+	var b strings.Builder
+	b.WriteString(m.Name)
+	b.WriteString(":")
+	b.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	b.WriteString("|")
+	b.WriteString(metricType)
+	if len(m.Tags) > 0 {
+		b.WriteString("|#")
+		for i, k := range sortedTagKeys(m.Tags) {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(k + ":" + m.Tags[k])
+		}
+	}
+	return b.String(), true
+}
+
+func (e *statsdExporter) close() {
+	e.conn.Close()
+}
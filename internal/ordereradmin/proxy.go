@@ -0,0 +1,117 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ordereradmin
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"sort"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// participationPath is the root of the channel participation API of an orderer
+const participationPath = "/participation/v1/channels"
+
+type orderer struct {
+	target *url.URL
+	proxy  *httputil.ReverseProxy
+}
+
+// Proxy forwards requests to the channel participation API of the configured orderers, to list
+// the channels of an orderer, join it to a channel with a config block, or remove it from one
+type Proxy struct {
+	orderers map[string]*orderer
+}
+
+// NewProxy constructor
+func NewProxy(config *conf.OrdererAdminConf) (*Proxy, error) {
+	p := &Proxy{
+		orderers: make(map[string]*orderer),
+	}
+	for name, endpoint := range config.Orderers {
+		target, err := url.Parse(endpoint.URL)
+		if err == nil && (target.Scheme == "" || target.Host == "") {
+			err = fmt.Errorf("must be an absolute URL")
+		}
+		if err != nil {
+			return nil, errors.Errorf(errors.OrdererAdminInvalidURL, endpoint.URL, name, err)
+		}
+		tlsConfig, err := utils.CreateTLSConfiguration(&endpoint.TLS)
+		if err != nil {
+			return nil, err
+		}
+		p.orderers[name] = newOrderer(name, target, tlsConfig)
+	}
+	return p, nil
+}
+
+func newOrderer(name string, target *url.URL, tlsConfig *tls.Config) *orderer {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	o := &orderer{target: target}
+	o.proxy = &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.Host = target.Host
+			// The orderer authenticates the TLS client certificate, not the token of the caller
+			req.Header.Del("Authorization")
+		},
+		Transport: transport,
+		ModifyResponse: func(res *http.Response) error {
+			log.Infof("<-- %s %s [%d] (orderer %s)", res.Request.Method, res.Request.URL, res.StatusCode, name)
+			return nil
+		},
+		ErrorHandler: func(res http.ResponseWriter, req *http.Request, err error) {
+			errors.RestErrReply(res, req, errors.Errorf(errors.OrdererAdminRequestFailed, name, err), 502)
+		},
+	}
+	return o
+}
+
+// Orderers returns the names of the orderers with an admin endpoint, in order
+func (p *Proxy) Orderers() []string {
+	names := make([]string, 0, len(p.orderers))
+	for name := range p.orderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ServeChannels forwards a request for the channels of an orderer, or for a single channel
+// when channelID is set, to the channel participation API of that orderer
+func (p *Proxy) ServeChannels(res http.ResponseWriter, req *http.Request, name, channelID string) {
+	o, ok := p.orderers[name]
+	if !ok {
+		errors.RestErrReply(res, req, errors.Errorf(errors.OrdererAdminUnknownOrderer, name), 404)
+		return
+	}
+	outReq := req.Clone(req.Context())
+	outReq.URL.Path = path.Join(o.target.Path, participationPath, channelID)
+	outReq.URL.RawPath = ""
+	outReq.URL.RawQuery = ""
+	o.proxy.ServeHTTP(res, outReq)
+}
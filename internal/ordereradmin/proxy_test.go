@@ -0,0 +1,122 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ordereradmin
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewProxyInvalidURL(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewProxy(&conf.OrdererAdminConf{
+		Orderers: map[string]conf.OrdererAdminEndpointConf{
+			"orderer0": {URL: "orderer0:9443"},
+		},
+	})
+	assert.Regexp("Invalid admin URL 'orderer0:9443' for orderer orderer0", err)
+
+	_, err = NewProxy(&conf.OrdererAdminConf{
+		Orderers: map[string]conf.OrdererAdminEndpointConf{
+			"orderer0": {URL: "https://orderer0:9443", TLS: conf.TLSConfig{ClientCertsFile: "cert.pem"}},
+		},
+	})
+	assert.Regexp("Client private key and certificate must both be provided", err)
+}
+
+func TestServeChannels(t *testing.T) {
+	assert := assert.New(t)
+
+	var received *http.Request
+	var body string
+	osn := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		received = req
+		b, _ := io.ReadAll(req.Body)
+		body = string(b)
+		res.Header().Set("Content-Type", "application/json")
+		res.WriteHeader(201)
+		_, _ = res.Write([]byte(`{"name":"default"}`))
+	}))
+	defer osn.Close()
+
+	p, err := NewProxy(&conf.OrdererAdminConf{
+		Orderers: map[string]conf.OrdererAdminEndpointConf{
+			"orderer1": {URL: osn.URL},
+			"orderer0": {URL: osn.URL + "/osn0"},
+		},
+	})
+	assert.NoError(err)
+	assert.Equal([]string{"orderer0", "orderer1"}, p.Orderers())
+
+	req := httptest.NewRequest("POST", "/orderers/orderer1/channels?x=y", strings.NewReader("config-block"))
+	req.Header.Set("Authorization", "Bearer token")
+	res := httptest.NewRecorder()
+	p.ServeChannels(res, req, "orderer1", "")
+	assert.Equal(201, res.Code)
+	assert.Equal(`{"name":"default"}`, res.Body.String())
+	assert.Equal("POST", received.Method)
+	assert.Equal("/participation/v1/channels", received.URL.Path)
+	assert.Empty(received.URL.RawQuery)
+	assert.Empty(received.Header.Get("Authorization"))
+	assert.Equal("config-block", body)
+
+	req = httptest.NewRequest("DELETE", "/orderers/orderer0/channels/default", nil)
+	res = httptest.NewRecorder()
+	p.ServeChannels(res, req, "orderer0", "default")
+	assert.Equal(201, res.Code)
+	assert.Equal("DELETE", received.Method)
+	assert.Equal("/osn0/participation/v1/channels/default", received.URL.Path)
+}
+
+func TestServeChannelsUnknownOrderer(t *testing.T) {
+	assert := assert.New(t)
+
+	p, err := NewProxy(&conf.OrdererAdminConf{})
+	assert.NoError(err)
+
+	req := httptest.NewRequest("GET", "/orderers/orderer0/channels", nil)
+	res := httptest.NewRecorder()
+	p.ServeChannels(res, req, "orderer0", "")
+	assert.Equal(404, res.Code)
+	assert.Regexp("No admin endpoint configured for orderer 'orderer0'", res.Body.String())
+}
+
+func TestServeChannelsOrdererDown(t *testing.T) {
+	assert := assert.New(t)
+
+	osn := httptest.NewServer(http.NotFoundHandler())
+	osn.Close()
+	p, err := NewProxy(&conf.OrdererAdminConf{
+		Orderers: map[string]conf.OrdererAdminEndpointConf{
+			"orderer0": {URL: osn.URL},
+		},
+	})
+	assert.NoError(err)
+
+	req := httptest.NewRequest("GET", "/orderers/orderer0/channels", nil)
+	res := httptest.NewRecorder()
+	p.ServeChannels(res, req, "orderer0", "")
+	assert.Equal(502, res.Code)
+	assert.Regexp("Channel participation request to orderer orderer0 failed", res.Body.String())
+}
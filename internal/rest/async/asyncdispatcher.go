@@ -49,6 +49,24 @@ type asyncRequestHandler interface {
 	isInitialized() bool
 }
 
+// StoppableDispatcher is implemented by dispatchers whose connection to the streaming system can
+// be closed and opened again while the gateway runs
+type StoppableDispatcher interface {
+	Stop()
+	Resume() error
+}
+
+// stoppableHandler is implemented by the handlers with a connection to stop
+type stoppableHandler interface {
+	stop()
+	resume() error
+}
+
+// closeableHandler is implemented by the handlers with resources to release on close
+type closeableHandler interface {
+	close()
+}
+
 type asyncDispatcher struct {
 	handler      asyncRequestHandler
 	receiptStore receipt.Store
@@ -93,9 +111,21 @@ func (d *asyncDispatcher) HandleReceipts(res http.ResponseWriter, req *http.Requ
 }
 
 func (d *asyncDispatcher) Close() {
+	if handler, ok := d.handler.(closeableHandler); ok {
+		handler.close()
+	}
 	d.receiptStore.Close()
 }
 
+// QueueStatus returns the depth of the queue of the handler, or nil for handlers that do not queue
+// messages in the gateway, such as the Kafka handler
+func (d *asyncDispatcher) QueueStatus() (*QueueStatus, error) {
+	if handler, ok := d.handler.(queueReporter); ok {
+		return handler.queueStatus()
+	}
+	return nil, nil
+}
+
 func (d *asyncDispatcher) processMsg(ctx context.Context, msg *messages.SendTransaction, ack bool) (*messages.AsyncSentMsg, int, error) {
 	switch msg.Headers.MsgType {
 	case messages.MsgTypeDeployContract, messages.MsgTypeSendTransaction:
@@ -108,7 +138,7 @@ func (d *asyncDispatcher) processMsg(ctx context.Context, msg *messages.SendTran
 
 	// Generate a message ID if not already set
 	if msg.Headers.ID == "" {
-		msgID := utils.UUIDv4()
+		msgID := utils.NewID()
 		msg.Headers.ID = msgID
 	}
 
@@ -125,6 +155,22 @@ func (d *asyncDispatcher) processMsg(ctx context.Context, msg *messages.SendTran
 	}, 200, nil
 }
 
+// Stop closes the connection of the handler, if it has one. Messages must not be dispatched until
+// it is resumed
+func (d *asyncDispatcher) Stop() {
+	if handler, ok := d.handler.(stoppableHandler); ok {
+		handler.stop()
+	}
+}
+
+// Resume opens the connection of a stopped handler again
+func (d *asyncDispatcher) Resume() error {
+	if handler, ok := d.handler.(stoppableHandler); ok {
+		return handler.resume()
+	}
+	return nil
+}
+
 func (d *asyncDispatcher) Run() error {
 	return d.handler.run()
 }
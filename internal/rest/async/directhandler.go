@@ -26,6 +26,7 @@ import (
 
 	"github.com/hyperledger/firefly-fabconnect/internal/conf"
 	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/kvstore"
 	"github.com/hyperledger/firefly-fabconnect/internal/messages"
 	"github.com/hyperledger/firefly-fabconnect/internal/rest/receipt"
 	"github.com/hyperledger/firefly-fabconnect/internal/tx"
@@ -41,16 +42,21 @@ type directHandler struct {
 	inFlightMutex sync.Mutex
 	inFlight      map[string]*msgContext
 	stopChan      chan error
+	queue         kvstore.KVStore // persists the in-flight messages, when configured
 }
 
 func newDirectHandler(conf *conf.RESTGatewayConf, processor tx.Processor, receiptstore receipt.Store) *directHandler {
-	return &directHandler{
+	w := &directHandler{
 		processor: processor,
 		receipts:  receiptstore,
 		conf:      conf,
 		inFlight:  make(map[string]*msgContext),
 		stopChan:  make(chan error),
 	}
+	if conf.AsyncQueue.LevelDB.Path != "" {
+		w.queue = kvstore.NewLDBKeyValueStore(conf.AsyncQueue.LevelDB.Path)
+	}
+	return w
 }
 
 type msgContext struct {
@@ -61,6 +67,7 @@ type msgContext struct {
 	msgID        string
 	msg          *messages.SendTransaction
 	headers      *messages.CommonHeaders
+	queueKey     string // key of the message in the persistent queue
 }
 
 func (t *msgContext) Context() context.Context {
@@ -93,15 +100,35 @@ func (t *msgContext) Reply(replyMessage messages.ReplyWithHeaders) {
 	defer t.w.inFlightMutex.Unlock()
 
 	replyHeaders := replyMessage.ReplyHeaders()
-	replyHeaders.ID = utils.UUIDv4()
+	replyHeaders.ID = utils.NewID()
 	replyHeaders.Context = t.headers.Context
 	replyHeaders.ReqID = t.headers.ID
 	replyHeaders.Received = t.timeReceived.UTC().Format(time.RFC3339Nano)
 	replyTime := time.Now().UTC()
 	replyHeaders.Elapsed = replyTime.Sub(t.timeReceived).Seconds()
 	msgBytes, _ := json.Marshal(&replyMessage)
+	if t.echoRequest() {
+		redact := t.w.conf.Receipts.RequestEcho.Redact
+		if redact == nil {
+			redact = receipt.DefaultRequestEchoRedact
+		}
+		origBytes, _ := json.Marshal(t.msg)
+		msgBytes = receipt.WithRequestEcho(msgBytes, origBytes, redact)
+	}
 	t.w.receipts.ProcessReceipt(msgBytes)
 	delete(t.w.inFlight, t.msgID)
+	if t.queueKey != "" {
+		t.w.deletePersistedMsg(t.queueKey)
+	}
+}
+
+// echoRequest is true if the request is to be stored in its receipt, as the request asks or
+// otherwise as configured
+func (t *msgContext) echoRequest() bool {
+	if t.msg.Headers.EchoRequest != nil {
+		return *t.msg.Headers.EchoRequest
+	}
+	return t.w.conf.Receipts.RequestEcho.Enabled
 }
 
 func (t *msgContext) String() string {
@@ -127,6 +154,13 @@ func (w *directHandler) dispatchMsg(ctx context.Context, key, msgID string, msg
 		msg:          msg,
 		headers:      &msg.Headers.CommonHeaders,
 	}
+	if w.queue != nil {
+		if err := w.persistMsg(msgContext); err != nil {
+			w.inFlightMutex.Unlock()
+			log.Errorf("Failed to dispatch message from '%s': %s", key, err)
+			return "", 500, err
+		}
+	}
 	w.inFlight[msgID] = msgContext
 	w.inFlightMutex.Unlock()
 
@@ -148,6 +182,12 @@ func (w *directHandler) validateHandlerConf() error {
 }
 
 func (w *directHandler) run() error {
+	if w.queue != nil {
+		if err := w.recoverQueue(); err != nil {
+			w.initialized = true
+			return err
+		}
+	}
 	w.initialized = true
 	return <-w.stopChan
 }
@@ -0,0 +1,65 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package async
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/messages"
+	mockreceipt "github.com/hyperledger/firefly-fabconnect/mocks/rest/receipt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDirectHandlerRequestEcho(t *testing.T) {
+	assert := assert.New(t)
+	var receipt map[string]interface{}
+	receipts := &mockreceipt.ReceiptStore{}
+	receipts.On("ProcessReceipt", mock.Anything).Run(func(args mock.Arguments) {
+		receipt = nil
+		_ = json.Unmarshal(args.Get(0).([]byte), &receipt)
+	}).Return()
+	testConf := &conf.RESTGatewayConf{}
+	w := newDirectHandler(testConf, nil, receipts)
+	reply := func(echo *bool) {
+		msg := &messages.SendTransaction{Function: "CreateAsset", Args: []string{"asset1", "blue"}, TransientMap: map[string]string{"price": "MTAw"}}
+		msg.Headers.ID = "req1"
+		msg.Headers.EchoRequest = echo
+		ctx := &msgContext{w: w, msgID: "req1", msg: msg, headers: &msg.Headers.CommonHeaders, timeReceived: time.Now()}
+		ctx.Reply(&messages.TransactionReceipt{})
+	}
+	yes, no := true, false
+
+	// requests are not stored in receipts unless configured or asked for
+	reply(nil)
+	assert.NotContains(receipt, "request")
+	reply(&yes)
+	request := receipt["request"].(map[string]interface{})
+	assert.Equal("CreateAsset", request["func"])
+	assert.Equal("***", request["transientMap"])
+
+	testConf.Receipts.RequestEcho = conf.ReceiptsRequestEchoConf{Enabled: true, Redact: []string{"args.1"}}
+	reply(nil)
+	request = receipt["request"].(map[string]interface{})
+	assert.Equal([]interface{}{"asset1", "***"}, request["args"])
+	assert.Equal(map[string]interface{}{"price": "MTAw"}, request["transientMap"])
+	reply(&no)
+	assert.NotContains(receipt, "request")
+}
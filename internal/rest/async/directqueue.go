@@ -0,0 +1,150 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package async
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/messages"
+	log "github.com/sirupsen/logrus"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const asyncQueueKeyPrefix = "msg/"
+
+// QueueStatus is the depth of the queue of messages the direct handler has accepted, and not
+// yet replied to
+type QueueStatus struct {
+	Persistent  bool `json:"persistent"`
+	InFlight    int  `json:"inFlight"`
+	MaxInFlight int  `json:"maxInFlight"`
+	Persisted   int  `json:"persisted,omitempty"` // messages in the KV store, when the queue is persistent
+}
+
+// QueueReporter is implemented by dispatchers that report the depth of their queue
+type QueueReporter interface {
+	QueueStatus() (*QueueStatus, error)
+}
+
+// queueReporter is implemented by the handlers that queue messages in the gateway
+type queueReporter interface {
+	queueStatus() (*QueueStatus, error)
+}
+
+// queuedMsg is a message accepted by the direct handler, as it is kept in the KV store until the
+// reply to it is processed, so it is processed again if the gateway restarts before then
+type queuedMsg struct {
+	Key      string                    `json:"key"`
+	MsgID    string                    `json:"msgId"`
+	Received time.Time                 `json:"received"`
+	Msg      *messages.SendTransaction `json:"msg"`
+}
+
+// asyncQueueKey orders the messages in the KV store by the time they were accepted
+func asyncQueueKey(received time.Time, msgID string) string {
+	return fmt.Sprintf("%s%020d/%s", asyncQueueKeyPrefix, received.UnixNano(), msgID)
+}
+
+func (w *directHandler) persistMsg(msgContext *msgContext) error {
+	msgContext.queueKey = asyncQueueKey(msgContext.timeReceived, msgContext.msgID)
+	b, err := json.Marshal(&queuedMsg{
+		Key:      msgContext.key,
+		MsgID:    msgContext.msgID,
+		Received: msgContext.timeReceived,
+		Msg:      msgContext.msg,
+	})
+	if err == nil {
+		err = w.queue.Put(msgContext.queueKey, b)
+	}
+	if err != nil {
+		return errors.Errorf(errors.RequestHandlerDirectQueueStore, err)
+	}
+	return nil
+}
+
+func (w *directHandler) deletePersistedMsg(key string) {
+	if err := w.queue.Delete(key); err != nil {
+		log.Errorf("Failed to delete message %s from the async queue: %s", key, err)
+	}
+}
+
+// recoverQueue opens the KV store of the queue, and processes again the messages that were
+// accepted, but not replied to, before the gateway stopped
+func (w *directHandler) recoverQueue() error {
+	if err := w.queue.Init(); err != nil {
+		return errors.Errorf(errors.RequestHandlerDirectQueueLoad, err)
+	}
+	var recovered []*msgContext
+	it := w.queue.NewIteratorWithRange(util.BytesPrefix([]byte(asyncQueueKeyPrefix)))
+	for it.Next() {
+		var queued queuedMsg
+		if err := json.Unmarshal(it.Value(), &queued); err != nil || queued.Msg == nil {
+			log.Errorf("Discarding message %s of the async queue that cannot be parsed: %v", it.Key(), err)
+			w.deletePersistedMsg(it.Key())
+			continue
+		}
+		recovered = append(recovered, &msgContext{
+			ctx:          context.Background(),
+			w:            w,
+			timeReceived: queued.Received,
+			key:          queued.Key,
+			msgID:        queued.MsgID,
+			msg:          queued.Msg,
+			headers:      &queued.Msg.Headers.CommonHeaders,
+			queueKey:     it.Key(),
+		})
+	}
+	it.Release()
+	if len(recovered) > 0 {
+		log.Infof("Processing %d messages recovered from the async queue", len(recovered))
+	}
+	for _, msgContext := range recovered {
+		w.inFlightMutex.Lock()
+		w.inFlight[msgContext.msgID] = msgContext
+		w.inFlightMutex.Unlock()
+		w.processor.OnMessage(msgContext)
+	}
+	return nil
+}
+
+func (w *directHandler) queueStatus() (*QueueStatus, error) {
+	w.inFlightMutex.Lock()
+	status := &QueueStatus{
+		Persistent:  w.queue != nil,
+		InFlight:    len(w.inFlight),
+		MaxInFlight: w.conf.MaxInFlight,
+	}
+	w.inFlightMutex.Unlock()
+	if w.queue != nil && w.initialized {
+		it := w.queue.NewIteratorWithRange(util.BytesPrefix([]byte(asyncQueueKeyPrefix)))
+		defer it.Release()
+		for it.Next() {
+			status.Persisted++
+		}
+	}
+	return status, nil
+}
+
+func (w *directHandler) close() {
+	if w.queue != nil && w.initialized {
+		_ = w.queue.Close()
+	}
+}
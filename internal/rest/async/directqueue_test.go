@@ -0,0 +1,97 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package async
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/messages"
+	"github.com/hyperledger/firefly-fabconnect/internal/tx"
+	mockreceipt "github.com/hyperledger/firefly-fabconnect/mocks/rest/receipt"
+	mocktx "github.com/hyperledger/firefly-fabconnect/mocks/tx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDirectHandlerPersistentQueue(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := os.MkdirTemp("", "asyncqueue")
+	defer os.RemoveAll(dir)
+	testConf := &conf.RESTGatewayConf{MaxInFlight: 10, AsyncQueue: conf.AsyncQueueConf{LevelDB: conf.LevelDBReceiptsConf{Path: dir}}}
+
+	// the message is accepted, but the gateway stops before processing it
+	processor := &mocktx.TxProcessor{}
+	processor.On("OnMessage", mock.Anything).Return()
+	receipts := &mockreceipt.ReceiptStore{}
+	receipts.On("Close").Return()
+	d := NewAsyncDispatcher(testConf, processor, receipts).(*asyncDispatcher)
+	go func() { _ = d.Run() }()
+	assert.Eventually(d.IsInitialized, time.Second, time.Millisecond)
+	msg := &messages.SendTransaction{}
+	msg.Headers.MsgType = messages.MsgTypeSendTransaction
+	msg.Headers.Signer = "user1"
+	msg.Headers.ChannelID = "default-channel"
+	reply, err := d.DispatchMsgAsync(context.Background(), msg, true)
+	assert.NoError(err)
+	status, err := d.QueueStatus()
+	assert.NoError(err)
+	assert.True(status.Persistent)
+	assert.Equal(1, status.InFlight)
+	assert.Equal(1, status.Persisted)
+	d.Close()
+
+	// after the restart it is processed again, and removed from the queue once replied to
+	var recovered tx.Context
+	processor = &mocktx.TxProcessor{}
+	processor.On("OnMessage", mock.Anything).Run(func(args mock.Arguments) {
+		recovered = args.Get(0).(tx.Context)
+	}).Return()
+	receipts = &mockreceipt.ReceiptStore{}
+	receipts.On("ProcessReceipt", mock.Anything).Return()
+	receipts.On("Close").Return()
+	d = NewAsyncDispatcher(testConf, processor, receipts).(*asyncDispatcher)
+	go func() { _ = d.Run() }()
+	assert.Eventually(d.IsInitialized, time.Second, time.Millisecond)
+	assert.NotNil(recovered)
+	assert.Equal(reply.Request, recovered.Headers().ID)
+	assert.Equal("default-channel", recovered.Headers().ChannelID)
+	recovered.Reply(&messages.TransactionReceipt{})
+	receipts.AssertCalled(t, "ProcessReceipt", mock.Anything)
+	status, err = d.QueueStatus()
+	assert.NoError(err)
+	assert.Equal(0, status.InFlight)
+	assert.Equal(0, status.Persisted)
+	d.Close()
+}
+
+func TestDirectHandlerMemoryQueue(t *testing.T) {
+	assert := assert.New(t)
+	d := NewAsyncDispatcher(&conf.RESTGatewayConf{MaxInFlight: 5}, &mocktx.TxProcessor{}, &mockreceipt.ReceiptStore{}).(*asyncDispatcher)
+	status, err := d.QueueStatus()
+	assert.NoError(err)
+	assert.False(status.Persistent)
+	assert.Equal(5, status.MaxInFlight)
+
+	d = NewAsyncDispatcher(&conf.RESTGatewayConf{Kafka: conf.KafkaConf{Brokers: []string{"broker:9092"}}}, &mocktx.TxProcessor{}, &mockreceipt.ReceiptStore{}).(*asyncDispatcher)
+	status, err = d.QueueStatus()
+	assert.NoError(err)
+	assert.Nil(status)
+}
@@ -0,0 +1,182 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package async
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/kafka"
+	"github.com/hyperledger/firefly-fabconnect/internal/messages"
+	"github.com/hyperledger/firefly-fabconnect/internal/tx"
+	"github.com/hyperledger/firefly-fabconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// KafkaBridge processes the requests a gateway with Kafka configured sends, and sends the replies
+// back to it. Requests are only processed once the access token the gateway forwarded with them
+// is verified by the security module, so they are authorized as on the REST path
+type KafkaBridge interface {
+	ValidateConf() error
+	Run() error
+	Stop()
+}
+
+type kafkaBridge struct {
+	kafka     kafka.Common
+	processor tx.Processor
+}
+
+// NewKafkaBridge constructor
+func NewKafkaBridge(kconf conf.KafkaConf, processor tx.Processor) KafkaBridge {
+	b := &kafkaBridge{
+		processor: processor,
+	}
+	kf := &kafka.SaramaKafkaFactory{}
+	b.kafka = kafka.NewKafkaCommon(kf, kconf, b)
+	return b
+}
+
+type kafkaMsgContext struct {
+	ctx          context.Context
+	b            *kafkaBridge
+	producer     kafka.Producer
+	timeReceived time.Time
+	key          []byte
+	msgBytes     []byte
+	headers      *messages.CommonHeaders
+}
+
+func (t *kafkaMsgContext) Context() context.Context {
+	return t.ctx
+}
+
+func (t *kafkaMsgContext) Headers() *messages.CommonHeaders {
+	return t.headers
+}
+
+func (t *kafkaMsgContext) Unmarshal(msg interface{}) error {
+	return json.Unmarshal(t.msgBytes, msg)
+}
+
+func (t *kafkaMsgContext) SendErrorReply(status int, err error) {
+	t.SendErrorReplyWithTX(status, err, "")
+}
+
+func (t *kafkaMsgContext) SendErrorReplyWithTX(_ int, err error, txHash string) {
+	log.Warnf("Failed to process message %s: %s", t, err)
+	errMsg := messages.NewErrorReply(err, t.msgBytes)
+	errMsg.TXHash = txHash
+	t.Reply(errMsg)
+}
+
+func (t *kafkaMsgContext) Reply(replyMessage messages.ReplyWithHeaders) {
+	replyHeaders := replyMessage.ReplyHeaders()
+	replyHeaders.ID = utils.NewID()
+	replyHeaders.Context = t.headers.Context
+	replyHeaders.ReqID = t.headers.ID
+	replyHeaders.Received = t.timeReceived.UTC().Format(time.RFC3339Nano)
+	replyTime := time.Now().UTC()
+	replyHeaders.Elapsed = replyTime.Sub(t.timeReceived).Seconds()
+	msgBytes, _ := json.Marshal(&replyMessage)
+	replyMsg := &sarama.ProducerMessage{
+		Topic:    t.b.kafka.Conf().TopicOut,
+		Value:    sarama.ByteEncoder(msgBytes),
+		Metadata: replyHeaders.ID,
+	}
+	if len(t.key) > 0 {
+		replyMsg.Key = sarama.ByteEncoder(t.key)
+	}
+	t.producer.Input() <- replyMsg
+}
+
+func (t *kafkaMsgContext) String() string {
+	return fmt.Sprintf("KafkaMsgContext[%s/%s]", t.headers.MsgType, t.headers.ID)
+}
+
+// ConsumerMessagesLoop - consume requests
+func (b *kafkaBridge) ConsumerMessagesLoop(consumer kafka.Consumer, producer kafka.Producer, wg *sync.WaitGroup) {
+	for msg := range consumer.Messages() {
+		b.onMessage(msg, producer)
+
+		// Regardless of outcome, we ack
+		consumer.MarkOffset(msg, "")
+	}
+	wg.Done()
+}
+
+func (b *kafkaBridge) onMessage(msg *sarama.ConsumerMessage, producer kafka.Producer) {
+	var request messages.SendTransaction
+	t := &kafkaMsgContext{
+		ctx:          context.Background(),
+		b:            b,
+		producer:     producer,
+		timeReceived: time.Now().UTC(),
+		key:          msg.Key,
+		msgBytes:     msg.Value,
+		headers:      &request.Headers.CommonHeaders,
+	}
+	if err := json.Unmarshal(msg.Value, &request); err != nil {
+		t.SendErrorReply(400, errors.Errorf(errors.KafkaBridgeInvalidMsg, err))
+		return
+	}
+	// The security module verifies the token exactly as the REST gateway verified it on receipt
+	ctx, err := kafka.AuthContext(t.ctx, msg)
+	if err != nil {
+		log.Errorf("Error getting auth context: %s", err)
+		t.SendErrorReply(401, errors.Errorf(errors.Unauthorized))
+		return
+	}
+	t.ctx = ctx
+	b.processor.OnMessage(t)
+}
+
+// ProducerErrorLoop - consume errors
+func (b *kafkaBridge) ProducerErrorLoop(_ kafka.Consumer, producer kafka.Producer, wg *sync.WaitGroup) {
+	log.Debugf("Kafka bridge listening for errors sending to Kafka")
+	for err := range producer.Errors() {
+		log.Errorf("Error sending reply: %s", err)
+	}
+	wg.Done()
+}
+
+// ProducerSuccessLoop - consume successes
+func (b *kafkaBridge) ProducerSuccessLoop(_ kafka.Consumer, producer kafka.Producer, wg *sync.WaitGroup) {
+	log.Debugf("Kafka bridge listening for successful sends to Kafka")
+	for msg := range producer.Successes() {
+		log.Infof("Kafka bridge sent reply ok: %s", msg.Metadata)
+	}
+	wg.Done()
+}
+
+func (b *kafkaBridge) ValidateConf() error {
+	return b.kafka.ValidateConf()
+}
+
+func (b *kafkaBridge) Run() error {
+	return b.kafka.Start()
+}
+
+func (b *kafkaBridge) Stop() {
+	b.kafka.Stop()
+}
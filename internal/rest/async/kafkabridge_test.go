@@ -0,0 +1,137 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package async
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/hyperledger/firefly-fabconnect/internal/auth"
+	"github.com/hyperledger/firefly-fabconnect/internal/auth/authtest"
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/messages"
+	"github.com/hyperledger/firefly-fabconnect/internal/tx"
+	mocktx "github.com/hyperledger/firefly-fabconnect/mocks/tx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type testKafkaConsumer struct {
+	messages chan *sarama.ConsumerMessage
+	marked   []*sarama.ConsumerMessage
+}
+
+func (c *testKafkaConsumer) Close() error                             { return nil }
+func (c *testKafkaConsumer) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+func (c *testKafkaConsumer) Errors() <-chan error                     { return nil }
+func (c *testKafkaConsumer) MarkOffset(msg *sarama.ConsumerMessage, _ string) {
+	c.marked = append(c.marked, msg)
+}
+
+type testKafkaProducer struct {
+	input chan *sarama.ProducerMessage
+}
+
+func (p *testKafkaProducer) AsyncClose()                               {}
+func (p *testKafkaProducer) Input() chan<- *sarama.ProducerMessage     { return p.input }
+func (p *testKafkaProducer) Successes() <-chan *sarama.ProducerMessage { return nil }
+func (p *testKafkaProducer) Errors() <-chan *sarama.ProducerError      { return nil }
+
+func testBridgeRequest(accessToken string) *sarama.ConsumerMessage {
+	msg := &messages.SendTransaction{Function: "CreateAsset", Args: []string{"asset1"}}
+	msg.Headers.ID = "req1"
+	msg.Headers.MsgType = messages.MsgTypeSendTransaction
+	msg.Headers.Signer = "user1"
+	msgBytes, _ := json.Marshal(msg)
+	consumed := &sarama.ConsumerMessage{Key: []byte("key1"), Value: msgBytes}
+	if accessToken != "" {
+		consumed.Headers = []*sarama.RecordHeader{
+			{Key: []byte(messages.RecordHeaderAccessToken), Value: []byte(accessToken)},
+		}
+	}
+	return consumed
+}
+
+func runTestBridge(processor tx.Processor, msgs ...*sarama.ConsumerMessage) (*testKafkaConsumer, []map[string]interface{}) {
+	b := NewKafkaBridge(conf.KafkaConf{TopicIn: "requests", TopicOut: "replies"}, processor).(*kafkaBridge)
+	consumer := &testKafkaConsumer{messages: make(chan *sarama.ConsumerMessage, len(msgs))}
+	producer := &testKafkaProducer{input: make(chan *sarama.ProducerMessage, len(msgs))}
+	for _, msg := range msgs {
+		consumer.messages <- msg
+	}
+	close(consumer.messages)
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	b.ConsumerMessagesLoop(consumer, producer, wg)
+	wg.Wait()
+	close(producer.input)
+	var replies []map[string]interface{}
+	for sent := range producer.input {
+		var reply map[string]interface{}
+		replyBytes, _ := sent.Value.Encode()
+		_ = json.Unmarshal(replyBytes, &reply)
+		reply["topic"] = sent.Topic
+		replies = append(replies, reply)
+	}
+	return consumer, replies
+}
+
+func TestKafkaBridgeVerifiesAccessToken(t *testing.T) {
+	assert := assert.New(t)
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+
+	processor := &mocktx.TxProcessor{}
+	var authCtx interface{}
+	processor.On("OnMessage", mock.Anything).Run(func(args mock.Arguments) {
+		txContext := args.Get(0).(tx.Context)
+		authCtx = auth.GetAuthContext(txContext.Context())
+		var msg messages.SendTransaction
+		_ = txContext.Unmarshal(&msg)
+		assert.Equal("CreateAsset", msg.Function)
+		txContext.Reply(&messages.TransactionReceipt{})
+	}).Return()
+
+	// requests without a token, or with one the security module rejects, are not processed
+	consumer, replies := runTestBridge(processor, testBridgeRequest(""), testBridgeRequest("badtoken"), testBridgeRequest("testat"))
+	assert.Len(consumer.marked, 3)
+	processor.AssertNumberOfCalls(t, "OnMessage", 1)
+	assert.Equal("verified", authCtx)
+	assert.Len(replies, 3)
+	for _, reply := range replies[:2] {
+		headers := reply["headers"].(map[string]interface{})
+		assert.Equal(messages.MsgTypeError, headers["type"])
+		assert.Equal("req1", headers["requestId"])
+		assert.Equal("Unauthorized", reply["errorMessage"])
+		assert.Equal("replies", reply["topic"])
+	}
+	headers := replies[2]["headers"].(map[string]interface{})
+	assert.NotEqual(messages.MsgTypeError, headers["type"])
+	assert.Equal("req1", headers["requestId"])
+}
+
+func TestKafkaBridgeInvalidMsg(t *testing.T) {
+	assert := assert.New(t)
+	processor := &mocktx.TxProcessor{}
+
+	_, replies := runTestBridge(processor, &sarama.ConsumerMessage{Value: []byte("!json")})
+	processor.AssertNotCalled(t, "OnMessage", mock.Anything)
+	assert.Len(replies, 1)
+	assert.Regexp("Unable to parse the message consumed from Kafka as JSON", replies[0]["errorMessage"])
+}
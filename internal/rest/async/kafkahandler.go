@@ -182,6 +182,14 @@ func (w *kafkaHandler) run() error {
 	return err
 }
 
+func (w *kafkaHandler) stop() {
+	w.kafka.Stop()
+}
+
+func (w *kafkaHandler) resume() error {
+	return w.kafka.Resume()
+}
+
 func (w *kafkaHandler) isInitialized() bool {
 	// We mark ourselves as ready once the kafka bridge has constructed its
 	// producer, so it can accept messages.
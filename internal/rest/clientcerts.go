@@ -0,0 +1,107 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"crypto/x509"
+	"net/http"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/auth"
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// validateClientCertSigners checks the signers can only be bound to clients authenticated by a
+// verified client certificate, and that each of them can match a client
+func validateClientCertSigners(config *conf.HTTPConf) error {
+	if len(config.ClientCertSigners) == 0 {
+		return nil
+	}
+	if !config.TLS.Enabled || !config.TLS.ClientAuth {
+		return errors.Errorf(errors.ConfigRESTGatewayClientCertSignersNoMTLS)
+	}
+	for i, mapping := range config.ClientCertSigners {
+		if mapping.Signer == "" || (mapping.Subject == "" && mapping.SAN == "") {
+			return errors.Errorf(errors.ConfigRESTGatewayClientCertSignerInvalid, i)
+		}
+	}
+	return nil
+}
+
+// subjectMatches checks the common name, or the whole distinguished name, of the certificate subject
+func subjectMatches(cert *x509.Certificate, subject string) bool {
+	return cert.Subject.CommonName == subject || cert.Subject.String() == subject
+}
+
+// sanMatches checks all the subject alternative names of the certificate
+func sanMatches(cert *x509.Certificate, san string) bool {
+	for _, name := range cert.DNSNames {
+		if name == san {
+			return true
+		}
+	}
+	for _, email := range cert.EmailAddresses {
+		if email == san {
+			return true
+		}
+	}
+	for _, uri := range cert.URIs {
+		if uri.String() == san {
+			return true
+		}
+	}
+	for _, ip := range cert.IPAddresses {
+		if ip.String() == san {
+			return true
+		}
+	}
+	return false
+}
+
+// clientCertSigner returns the signer of the first mapping that matches the certificate, if any
+func clientCertSigner(mappings []conf.ClientCertSignerConf, cert *x509.Certificate) string {
+	for _, mapping := range mappings {
+		if mapping.Subject != "" && !subjectMatches(cert, mapping.Subject) {
+			continue
+		}
+		if mapping.SAN != "" && !sanMatches(cert, mapping.SAN) {
+			continue
+		}
+		return mapping.Signer
+	}
+	return ""
+}
+
+// newClientCertSignerHandler binds the clients authenticated by a certificate that matches one of
+// the configured mappings to its signer, for the requests that need one
+func newClientCertSignerHandler(mappings []conf.ClientCertSignerConf, handler http.Handler) http.Handler {
+	if len(mappings) == 0 {
+		return handler
+	}
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		// the server only accepts connections with a verified certificate, the first of which is the client's
+		if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+			cert := req.TLS.PeerCertificates[0]
+			if signer := clientCertSigner(mappings, cert); signer != "" {
+				log.Debugf("Client '%s' is bound to signer '%s'", cert.Subject, signer)
+				req = req.WithContext(auth.WithClientCertSigner(req.Context(), signer))
+			}
+		}
+		handler.ServeHTTP(res, req)
+	})
+}
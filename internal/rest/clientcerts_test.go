@@ -0,0 +1,120 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/auth"
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/stretchr/testify/assert"
+)
+
+func testClientCert() *x509.Certificate {
+	spiffe, _ := url.Parse("spiffe://example.com/app1")
+	return &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "app1", Organization: []string{"Org1"}},
+		DNSNames:       []string{"app1.example.com"},
+		EmailAddresses: []string{"app1@example.com"},
+		URIs:           []*url.URL{spiffe},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+	}
+}
+
+func TestValidateClientCertSigners(t *testing.T) {
+	assert := assert.New(t)
+
+	config := &conf.HTTPConf{}
+	assert.NoError(validateClientCertSigners(config))
+
+	config.ClientCertSigners = []conf.ClientCertSignerConf{{Subject: "app1", Signer: "user1"}}
+	err := validateClientCertSigners(config)
+	assert.Regexp("Client certificate signers require mutual TLS", err)
+	config.TLS.Enabled = true
+	err = validateClientCertSigners(config)
+	assert.Regexp("Client certificate signers require mutual TLS", err)
+
+	config.TLS.ClientAuth = true
+	assert.NoError(validateClientCertSigners(config))
+
+	config.ClientCertSigners = append(config.ClientCertSigners, conf.ClientCertSignerConf{Signer: "user2"})
+	err = validateClientCertSigners(config)
+	assert.Regexp("Client certificate signer 1 must have a signer, and a subject or SAN to match", err)
+	config.ClientCertSigners[1] = conf.ClientCertSignerConf{SAN: "app2.example.com"}
+	err = validateClientCertSigners(config)
+	assert.Regexp("Client certificate signer 1 must have a signer", err)
+}
+
+func TestClientCertSignerMatching(t *testing.T) {
+	assert := assert.New(t)
+	cert := testClientCert()
+
+	signer := func(mapping conf.ClientCertSignerConf) string {
+		mapping.Signer = "user1"
+		return clientCertSigner([]conf.ClientCertSignerConf{mapping}, cert)
+	}
+	assert.Equal("user1", signer(conf.ClientCertSignerConf{Subject: "app1"}))
+	assert.Equal("user1", signer(conf.ClientCertSignerConf{Subject: "CN=app1,O=Org1"}))
+	assert.Equal("user1", signer(conf.ClientCertSignerConf{SAN: "app1.example.com"}))
+	assert.Equal("user1", signer(conf.ClientCertSignerConf{SAN: "app1@example.com"}))
+	assert.Equal("user1", signer(conf.ClientCertSignerConf{SAN: "spiffe://example.com/app1"}))
+	assert.Equal("user1", signer(conf.ClientCertSignerConf{SAN: "10.0.0.1"}))
+	assert.Equal("user1", signer(conf.ClientCertSignerConf{Subject: "app1", SAN: "app1.example.com"}))
+	assert.Equal("", signer(conf.ClientCertSignerConf{Subject: "app2"}))
+	assert.Equal("", signer(conf.ClientCertSignerConf{SAN: "app2.example.com"}))
+	assert.Equal("", signer(conf.ClientCertSignerConf{Subject: "app1", SAN: "app2.example.com"}))
+
+	// the first matching mapping wins
+	assert.Equal("user2", clientCertSigner([]conf.ClientCertSignerConf{
+		{Subject: "app2", Signer: "user1"},
+		{Subject: "app1", Signer: "user2"},
+		{SAN: "app1.example.com", Signer: "user3"},
+	}, cert))
+}
+
+func TestClientCertSignerHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	var signer string
+	handler := newClientCertSignerHandler([]conf.ClientCertSignerConf{{Subject: "app1", Signer: "user1"}}, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		signer = auth.GetClientCertSigner(req.Context())
+	}))
+
+	req := httptest.NewRequest("POST", "/transactions", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{testClientCert()}}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal("user1", signer)
+
+	req = httptest.NewRequest("POST", "/transactions", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "app2"}}}}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal("", signer)
+
+	// a request without TLS, such as on the unix socket, is not bound to a signer
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/transactions", nil))
+	assert.Equal("", signer)
+
+	noMappings := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {})
+	assert.NotNil(newClientCertSignerHandler(nil, noMappings))
+}
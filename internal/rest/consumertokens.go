@@ -0,0 +1,205 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/auth"
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/utils"
+)
+
+const (
+	defaultConsumerTokenIssuer = "fabconnect"
+	defaultConsumerTokenTTL    = 3600
+	defaultConsumerTokenMaxTTL = 86400
+	minConsumerTokenKeyLength  = 32
+)
+
+// consumerTokenHeader is the JOSE header of every token, which are only signed with HS256
+var consumerTokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// consumerTokenClaims are the JWT claims of a consumer token
+type consumerTokenClaims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	ID        string   `json:"jti"`
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`
+	Topics    []string `json:"topics,omitempty"`
+	Streams   []string `json:"streams,omitempty"`
+}
+
+type consumerTokenRequest struct {
+	Subject string   `json:"subject"`
+	Topics  []string `json:"topics,omitempty"`
+	Streams []string `json:"streams,omitempty"`
+	TTLSec  int      `json:"ttlSec,omitempty"`
+}
+
+type consumerTokenResponse struct {
+	ID      string    `json:"id"`
+	Token   string    `json:"token"`
+	Subject string    `json:"subject"`
+	Topics  []string  `json:"topics,omitempty"`
+	Streams []string  `json:"streams,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+// consumerTokenIssuer issues the tokens of event consumers, and verifies them on requests
+type consumerTokenIssuer struct {
+	key        []byte
+	issuer     string
+	defaultTTL int
+	maxTTL     int
+}
+
+// newConsumerTokenIssuer reads the signing key, returning nil when consumer tokens are not enabled
+func newConsumerTokenIssuer(config *conf.ConsumerTokensConf) (*consumerTokenIssuer, error) {
+	if config.SigningKeyFile == "" {
+		return nil, nil
+	}
+	key, err := os.ReadFile(config.SigningKeyFile)
+	if err != nil {
+		return nil, errors.Errorf(errors.ConfigRESTGatewayConsumerTokensKey, err)
+	}
+	key = bytes.TrimSpace(key)
+	if len(key) < minConsumerTokenKeyLength {
+		return nil, errors.Errorf(errors.ConfigRESTGatewayConsumerTokensShortKey, minConsumerTokenKeyLength)
+	}
+	i := &consumerTokenIssuer{
+		key:        key,
+		issuer:     config.Issuer,
+		defaultTTL: config.DefaultTTLSec,
+		maxTTL:     config.MaxTTLSec,
+	}
+	if i.issuer == "" {
+		i.issuer = defaultConsumerTokenIssuer
+	}
+	if i.defaultTTL <= 0 {
+		i.defaultTTL = defaultConsumerTokenTTL
+	}
+	if i.maxTTL <= 0 {
+		i.maxTTL = defaultConsumerTokenMaxTTL
+	}
+	return i, nil
+}
+
+func (i *consumerTokenIssuer) signature(signingInput string) []byte {
+	mac := hmac.New(sha256.New, i.key)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
+
+func (i *consumerTokenIssuer) sign(claims *consumerTokenClaims) (string, error) {
+	claimsBytes, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := consumerTokenHeader + "." + base64.RawURLEncoding.EncodeToString(claimsBytes)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(i.signature(signingInput)), nil
+}
+
+// issue signs a token for the subject, scoped to the topics and streams of the request
+func (i *consumerTokenIssuer) issue(req *consumerTokenRequest) (*consumerTokenResponse, error) {
+	if req.Subject == "" {
+		return nil, errors.Errorf(errors.ConsumerTokenNoSubject)
+	}
+	if len(req.Topics) == 0 && len(req.Streams) == 0 {
+		return nil, errors.Errorf(errors.ConsumerTokenNoScope)
+	}
+	ttl := req.TTLSec
+	if ttl <= 0 {
+		ttl = i.defaultTTL
+	}
+	if ttl > i.maxTTL {
+		return nil, errors.Errorf(errors.ConsumerTokenTTLExceeded, i.maxTTL)
+	}
+	now := time.Now()
+	expires := now.Add(time.Duration(ttl) * time.Second)
+	claims := &consumerTokenClaims{
+		Issuer:    i.issuer,
+		Subject:   req.Subject,
+		ID:        utils.UUIDv4(),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expires.Unix(),
+		Topics:    req.Topics,
+		Streams:   req.Streams,
+	}
+	token, err := i.sign(claims)
+	if err != nil {
+		return nil, err
+	}
+	return &consumerTokenResponse{
+		ID:      claims.ID,
+		Token:   token,
+		Subject: claims.Subject,
+		Topics:  claims.Topics,
+		Streams: claims.Streams,
+		Expires: time.Unix(claims.ExpiresAt, 0).UTC(),
+	}, nil
+}
+
+// verify returns the claims of a token this gateway issued, or nil for any other token, which is
+// left to the security module to verify. A token this gateway issued that has expired is an error
+func (i *consumerTokenIssuer) verify(token string) (*consumerTokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != consumerTokenHeader {
+		return nil, nil
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, i.signature(parts[0]+"."+parts[1])) {
+		return nil, nil
+	}
+	claimsBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil
+	}
+	var claims consumerTokenClaims
+	if err := json.Unmarshal(claimsBytes, &claims); err != nil || claims.Issuer != i.issuer {
+		return nil, nil
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, errors.Errorf(errors.ConsumerTokenExpired)
+	}
+	return &claims, nil
+}
+
+// consumerScopeAllows checks a request made with a consumer token is to an API the token grants
+// access to. Those are the websocket, whose topics are checked as the consumer listens on them,
+// and reading the event streams the token is scoped to
+func consumerScopeAllows(req *http.Request, scope *auth.ConsumerScope) bool {
+	path := strings.TrimSuffix(req.URL.Path, "/")
+	if path == "/ws" {
+		return true
+	}
+	if req.Method != http.MethodGet || !strings.HasPrefix(path, "/eventstreams/") {
+		return false
+	}
+	streamID := strings.SplitN(strings.TrimPrefix(path, "/eventstreams/"), "/", 2)[0]
+	return scope.AllowsStream(streamID)
+}
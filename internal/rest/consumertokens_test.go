@@ -0,0 +1,220 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/auth"
+	"github.com/hyperledger/firefly-fabconnect/internal/auth/authtest"
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/stretchr/testify/assert"
+)
+
+const testConsumerTokenKey = "0123456789abcdef0123456789abcdef"
+
+func newTestConsumerTokenIssuer(t *testing.T, key string) (*consumerTokenIssuer, error) {
+	keyFile := filepath.Join(t.TempDir(), "key")
+	err := os.WriteFile(keyFile, []byte(key), 0600)
+	assert.NoError(t, err)
+	return newConsumerTokenIssuer(&conf.ConsumerTokensConf{SigningKeyFile: keyFile})
+}
+
+func TestConsumerTokenIssuerConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	i, err := newConsumerTokenIssuer(&conf.ConsumerTokensConf{})
+	assert.NoError(err)
+	assert.Nil(i)
+
+	_, err = newConsumerTokenIssuer(&conf.ConsumerTokensConf{SigningKeyFile: "/does/not/exist"})
+	assert.Regexp("Failed to read the consumer token signing key", err)
+
+	_, err = newTestConsumerTokenIssuer(t, "tooshort\n")
+	assert.Regexp("must be at least 32 bytes", err)
+
+	i, err = newTestConsumerTokenIssuer(t, testConsumerTokenKey+"\n")
+	assert.NoError(err)
+	assert.Equal([]byte(testConsumerTokenKey), i.key)
+	assert.Equal("fabconnect", i.issuer)
+	assert.Equal(defaultConsumerTokenTTL, i.defaultTTL)
+	assert.Equal(defaultConsumerTokenMaxTTL, i.maxTTL)
+}
+
+func TestConsumerTokenIssueVerify(t *testing.T) {
+	assert := assert.New(t)
+	i, err := newTestConsumerTokenIssuer(t, testConsumerTokenKey)
+	assert.NoError(err)
+
+	_, err = i.issue(&consumerTokenRequest{Topics: []string{"topic1"}})
+	assert.Regexp("Must specify the subject", err)
+	_, err = i.issue(&consumerTokenRequest{Subject: "app1"})
+	assert.Regexp("at least one websocket topic or event stream", err)
+	_, err = i.issue(&consumerTokenRequest{Subject: "app1", Topics: []string{"topic1"}, TTLSec: 86401})
+	assert.Regexp("ttlSec must not exceed 86400", err)
+
+	token, err := i.issue(&consumerTokenRequest{Subject: "app1", Topics: []string{"topic1"}, Streams: []string{"es-1"}})
+	assert.NoError(err)
+	assert.NotEmpty(token.ID)
+	assert.WithinDuration(time.Now().Add(time.Hour), token.Expires, 5*time.Second)
+
+	claims, err := i.verify(token.Token)
+	assert.NoError(err)
+	assert.Equal("app1", claims.Subject)
+	assert.Equal("fabconnect", claims.Issuer)
+	assert.Equal(token.ID, claims.ID)
+	assert.Equal([]string{"topic1"}, claims.Topics)
+	assert.Equal([]string{"es-1"}, claims.Streams)
+
+	// tokens this gateway did not issue are left to the security module, including those with
+	// claims that cannot be parsed, or of another issuer
+	signed := func(claims string) string {
+		signingInput := consumerTokenHeader + "." + claims
+		return signingInput + "." + base64.RawURLEncoding.EncodeToString(i.signature(signingInput))
+	}
+	parts := strings.Split(token.Token, ".")
+	for _, other := range []string{
+		"opaque-token",
+		"a.b.c",
+		parts[0] + "." + parts[1] + ".!!",
+		parts[0] + "." + parts[1] + "." + parts[1],
+		signed("!!"),
+		signed(base64.RawURLEncoding.EncodeToString([]byte("not json"))),
+	} {
+		claims, err = i.verify(other)
+		assert.NoError(err)
+		assert.Nil(claims)
+	}
+	i.issuer = "other"
+	claims, err = i.verify(token.Token)
+	assert.NoError(err)
+	assert.Nil(claims)
+	i.issuer = "fabconnect"
+
+	expired, err := i.sign(&consumerTokenClaims{Issuer: "fabconnect", Subject: "app1", ExpiresAt: time.Now().Add(-time.Second).Unix()})
+	assert.NoError(err)
+	_, err = i.verify(expired)
+	assert.Regexp("Consumer token has expired", err)
+}
+
+func TestConsumerScopeAllows(t *testing.T) {
+	assert := assert.New(t)
+	scope := &auth.ConsumerScope{Subject: "app1", Topics: []string{"topic1"}, Streams: []string{"es-1"}}
+
+	assert.True(consumerScopeAllows(httptest.NewRequest("GET", "/ws", nil), scope))
+	assert.True(consumerScopeAllows(httptest.NewRequest("GET", "/eventstreams/es-1", nil), scope))
+	assert.True(consumerScopeAllows(httptest.NewRequest("GET", "/eventstreams/es-1/listeners", nil), scope))
+	assert.False(consumerScopeAllows(httptest.NewRequest("GET", "/eventstreams/es-2", nil), scope))
+	assert.False(consumerScopeAllows(httptest.NewRequest("GET", "/eventstreams", nil), scope))
+	assert.False(consumerScopeAllows(httptest.NewRequest("DELETE", "/eventstreams/es-1", nil), scope))
+	assert.False(consumerScopeAllows(httptest.NewRequest("POST", "/eventstreams/es-1/suspend", nil), scope))
+	assert.False(consumerScopeAllows(httptest.NewRequest("POST", "/transactions", nil), scope))
+}
+
+func TestConsumerTokenRequests(t *testing.T) {
+	assert := assert.New(t)
+	r := newRouter(nil, nil, nil, nil, nil, nil)
+	r.adminRouter.POST("/consumertokens", r.issueConsumerToken)
+
+	res := httptest.NewRecorder()
+	r.adminRouter.ServeHTTP(res, httptest.NewRequest("POST", "/consumertokens", strings.NewReader(`{}`)))
+	assert.Equal(405, res.Code)
+	assert.Regexp("Consumer tokens are not enabled", res.Body.String())
+
+	var err error
+	r.consumerTokens, err = newTestConsumerTokenIssuer(t, testConsumerTokenKey)
+	assert.NoError(err)
+
+	res = httptest.NewRecorder()
+	r.adminRouter.ServeHTTP(res, httptest.NewRequest("POST", "/consumertokens", strings.NewReader(`!json`)))
+	assert.Equal(400, res.Code)
+	assert.Regexp("Invalid consumer token request", res.Body.String())
+
+	res = httptest.NewRecorder()
+	r.adminRouter.ServeHTTP(res, httptest.NewRequest("POST", "/consumertokens", strings.NewReader(`{"subject":"app1"}`)))
+	assert.Equal(400, res.Code)
+
+	res = httptest.NewRecorder()
+	r.adminRouter.ServeHTTP(res, httptest.NewRequest("POST", "/consumertokens", strings.NewReader(`{"subject":"app1","topics":["topic1"],"streams":["es-1"],"ttlSec":60}`)))
+	assert.Equal(200, res.Code)
+	var token consumerTokenResponse
+	err = json.NewDecoder(res.Body).Decode(&token)
+	assert.NoError(err)
+	assert.WithinDuration(time.Now().Add(time.Minute), token.Expires, 5*time.Second)
+
+	// requests with the token only reach the APIs it is scoped to, as the consumer
+	var scope *auth.ConsumerScope
+	handler := r.newAccessTokenContextHandler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		scope = auth.GetConsumerScope(req.Context())
+		assert.True(auth.IsSystemContext(req.Context()))
+	}))
+	withToken := func(method, path, token string) *http.Request {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req
+	}
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, withToken("GET", "/eventstreams/es-1", token.Token))
+	assert.Equal(200, res.Code)
+	assert.Equal("app1", scope.Subject)
+	assert.Equal([]string{"topic1"}, scope.Topics)
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, withToken("POST", "/transactions", token.Token))
+	assert.Equal(403, res.Code)
+	assert.Regexp("Consumer token does not grant access to POST /transactions", res.Body.String())
+
+	expired, _ := r.consumerTokens.sign(&consumerTokenClaims{Issuer: "fabconnect", Subject: "app1", ExpiresAt: time.Now().Unix() - 1})
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, withToken("GET", "/eventstreams/es-1", expired))
+	assert.Equal(401, res.Code)
+
+	// other tokens are verified by the security module
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+	scope = nil
+	res = httptest.NewRecorder()
+	handler = r.newAccessTokenContextHandler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		scope = auth.GetConsumerScope(req.Context())
+		assert.Equal("verified", auth.GetAuthContext(req.Context()))
+	}))
+	handler.ServeHTTP(res, withToken("POST", "/transactions", "testat"))
+	assert.Equal(200, res.Code)
+	assert.Nil(scope)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, withToken("POST", "/transactions", "badone"))
+	assert.Equal(401, res.Code)
+	// websocket clients re-authenticate with either kind of token, which carries its expiry
+	ctx, err := r.authenticateToken(context.Background(), token.Token)
+	assert.NoError(err)
+	assert.Equal("app1", auth.GetConsumerScope(ctx).Subject)
+	assert.True(token.Expires.Equal(auth.GetTokenExpiry(ctx)))
+	ctx, err = r.authenticateToken(context.Background(), "testat")
+	assert.NoError(err)
+	assert.Equal(authtest.TestTokenExpiry, auth.GetTokenExpiry(ctx))
+	_, err = r.authenticateToken(context.Background(), expired)
+	assert.Regexp("Consumer token has expired", err)
+}
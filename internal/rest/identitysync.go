@@ -0,0 +1,266 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/utils"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	identityRegistered = "registered"
+	identityModified   = "modified"
+	identityEnrolled   = "enrolled"
+	identityReenrolled = "reenrolled"
+	identityRevoked    = "revoked"
+
+	defaultIdentitySyncTimeout     = 30
+	defaultIdentitySyncRetries     = 5
+	defaultIdentitySyncRetryDelay  = 1 * time.Second
+	identitySyncQueueLength        = 1000
+	scimUserSchema                 = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimFabricIdentityExtensionURN = "urn:hyperledger:fabconnect:scim:schemas:extension:fabric:1.0:Identity"
+)
+
+// identitySyncEvent is posted to the sync webhook for each change to an identity. The identity is
+// shaped as a SCIM 2.0 User, so IAM systems can provision their copy of it with the user name as
+// its external ID. Enrollment secrets are never included
+type identitySyncEvent struct {
+	ID           string              `json:"id"`
+	Type         string              `json:"type"`
+	Timestamp    string              `json:"timestamp"`
+	Resource     *scimUser           `json:"resource"`
+	Network      string              `json:"network,omitempty"`
+	Reason       string              `json:"reason,omitempty"`
+	RevokedCerts []map[string]string `json:"revokedCerts,omitempty"`
+}
+
+type scimUser struct {
+	Schemas  []string                 `json:"schemas"`
+	ID       string                   `json:"id"`
+	UserName string                   `json:"userName"`
+	Active   bool                     `json:"active"`
+	Meta     scimMeta                 `json:"meta"`
+	Fabric   *fabricIdentityExtension `json:"urn:hyperledger:fabconnect:scim:schemas:extension:fabric:1.0:Identity,omitempty"`
+}
+
+type scimMeta struct {
+	ResourceType string `json:"resourceType"`
+	LastModified string `json:"lastModified"`
+}
+
+// fabricIdentityExtension holds the attributes of the identity in the CA registry, which are only
+// known for the changes that set them
+type fabricIdentityExtension struct {
+	CAName         string            `json:"caname,omitempty"`
+	Type           string            `json:"type,omitempty"`
+	Affiliation    string            `json:"affiliation,omitempty"`
+	MaxEnrollments int               `json:"maxEnrollments,omitempty"`
+	Attributes     map[string]string `json:"attributes,omitempty"`
+}
+
+// identityChange is the part of the body of an identity request that is synced, which is decoded
+// apart from the identity client so that any secret in the body is never kept
+type identityChange struct {
+	Name           string            `json:"name"`
+	CAName         string            `json:"caname"`
+	Type           string            `json:"type"`
+	Affiliation    string            `json:"affiliation"`
+	MaxEnrollments int               `json:"maxEnrollments"`
+	Attributes     map[string]string `json:"attributes"`
+	Reason         string            `json:"reason"`
+}
+
+// identitySync posts the changes made to identities through the REST API to a webhook, so external
+// IAM systems can keep in sync with the Fabric CA registry. Events are queued and posted in order,
+// so that identity requests never wait for the webhook, and dropped with a warning if the queue
+// is full or the webhook keeps failing
+type identitySync struct {
+	url        string
+	headers    map[string]string
+	client     *http.Client
+	retries    int
+	retryDelay time.Duration
+	queue      chan *identitySyncEvent
+	done       chan struct{}
+	// the network the changes are made on, for the networks served under /networks/:network
+	network string
+}
+
+// newIdentitySync starts the sync, returning nil when no webhook is configured
+func newIdentitySync(config *conf.IdentitySyncConf) (*identitySync, error) {
+	if config.URL == "" {
+		return nil, nil
+	}
+	if u, err := url.Parse(config.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, errors.Errorf(errors.ConfigRESTGatewayIdentitySyncURL, config.URL)
+	}
+	timeout := config.RequestTimeoutSec
+	if timeout <= 0 {
+		timeout = defaultIdentitySyncTimeout
+	}
+	s := &identitySync{
+		url:        config.URL,
+		headers:    config.Headers,
+		client:     &http.Client{Timeout: time.Duration(timeout) * time.Second},
+		retries:    config.Retries,
+		retryDelay: defaultIdentitySyncRetryDelay,
+		queue:      make(chan *identitySyncEvent, identitySyncQueueLength),
+		done:       make(chan struct{}),
+	}
+	if s.retries <= 0 {
+		s.retries = defaultIdentitySyncRetries
+	}
+	go s.run()
+	return s, nil
+}
+
+// forNetwork returns the sync for the changes made on a network, which are queued and posted with
+// those of the gateway, naming the network they were made on
+func (s *identitySync) forNetwork(name string) *identitySync {
+	if s == nil {
+		return nil
+	}
+	n := *s
+	n.network = name
+	return &n
+}
+
+// readIdentityChange decodes the body of an identity request, and restores it to be read again by
+// the identity client. A body that cannot be decoded is left for the identity client to reject
+func readIdentityChange(req *http.Request, params httprouter.Params) *identityChange {
+	change := &identityChange{}
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		if err == nil {
+			_ = json.Unmarshal(body, change)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if username := params.ByName("username"); username != "" {
+		change.Name = username
+	}
+	return change
+}
+
+// publish queues an event for a change that has been made to an identity
+func (s *identitySync) publish(eventType string, change *identityChange, revokedCerts []map[string]string) {
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	event := &identitySyncEvent{
+		ID:        utils.UUIDv4(),
+		Type:      eventType,
+		Timestamp: now,
+		Resource: &scimUser{
+			Schemas:  []string{scimUserSchema},
+			ID:       change.Name,
+			UserName: change.Name,
+			Active:   eventType != identityRevoked,
+			Meta: scimMeta{
+				ResourceType: "User",
+				LastModified: now,
+			},
+		},
+		Network:      s.network,
+		Reason:       change.Reason,
+		RevokedCerts: revokedCerts,
+	}
+	fabric := &fabricIdentityExtension{
+		CAName:         change.CAName,
+		Type:           change.Type,
+		Affiliation:    change.Affiliation,
+		MaxEnrollments: change.MaxEnrollments,
+		Attributes:     change.Attributes,
+	}
+	if fabric.CAName != "" || fabric.Type != "" || fabric.Affiliation != "" || fabric.MaxEnrollments != 0 || len(fabric.Attributes) > 0 {
+		event.Resource.Schemas = append(event.Resource.Schemas, scimFabricIdentityExtensionURN)
+		event.Resource.Fabric = fabric
+	}
+	select {
+	case s.queue <- event:
+	default:
+		log.Warnf("Identity sync queue full, dropping %s event for identity '%s'", eventType, change.Name)
+	}
+}
+
+// Close stops the delivery of queued events
+func (s *identitySync) Close() {
+	close(s.done)
+}
+
+func (s *identitySync) run() {
+	for {
+		select {
+		case event := <-s.queue:
+			s.deliver(event)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// deliver posts an event, retrying until the webhook accepts it or the retries are exhausted
+func (s *identitySync) deliver(event *identitySyncEvent) {
+	body, _ := json.Marshal(event)
+	for attempt := 1; ; attempt++ {
+		err := s.post(body)
+		if err == nil {
+			log.Debugf("Identity sync %s event %s for identity '%s' delivered", event.Type, event.ID, event.Resource.UserName)
+			return
+		}
+		if attempt >= s.retries {
+			log.Errorf("Identity sync %s event %s for identity '%s' dropped after %d attempts: %s", event.Type, event.ID, event.Resource.UserName, attempt, err)
+			return
+		}
+		log.Warnf("Identity sync %s event %s attempt %d failed: %s", event.Type, event.ID, attempt, err)
+		select {
+		case <-time.After(s.retryDelay * time.Duration(attempt)):
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *identitySync) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range s.headers {
+		req.Header.Set(name, value)
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.Errorf(errors.IdentitySyncWebhookFailed, res.StatusCode)
+	}
+	return nil
+}
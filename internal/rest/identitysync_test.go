@@ -0,0 +1,120 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/rest/identity"
+	restutil "github.com/hyperledger/firefly-fabconnect/internal/rest/utils"
+	mockidentity "github.com/hyperledger/firefly-fabconnect/mocks/rest/identity"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestIdentitySyncConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := newIdentitySync(&conf.IdentitySyncConf{})
+	assert.NoError(err)
+	assert.Nil(s)
+
+	_, err = newIdentitySync(&conf.IdentitySyncConf{URL: "ftp://iam.example.com"})
+	assert.Regexp("Invalid identity sync URL 'ftp://iam.example.com'", err)
+
+	s, err = newIdentitySync(&conf.IdentitySyncConf{URL: "https://iam.example.com/scim"})
+	assert.NoError(err)
+	defer s.Close()
+	assert.Equal(defaultIdentitySyncRetries, s.retries)
+	assert.Equal(defaultIdentitySyncTimeout*time.Second, s.client.Timeout)
+}
+
+func TestIdentitySyncRequests(t *testing.T) {
+	assert := assert.New(t)
+	bodies := make(chan map[string]interface{}, 5)
+	failures := 1
+	svr := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		assert.Equal("Bearer iam-token", req.Header.Get("Authorization"))
+		if failures > 0 {
+			failures--
+			res.WriteHeader(503)
+			return
+		}
+		var body map[string]interface{}
+		_ = json.NewDecoder(req.Body).Decode(&body)
+		bodies <- body
+	}))
+	defer svr.Close()
+
+	idClient := &mockidentity.Client{}
+	readBody := func(args mock.Arguments) {
+		// the identity client reads the body after it has been read for the sync
+		b, _ := io.ReadAll(args.Get(1).(*http.Request).Body)
+		assert.Contains(string(b), "user1")
+	}
+	idClient.On("Register", mock.Anything, mock.Anything, mock.Anything).Run(readBody).Return(&identity.RegisterResponse{Name: "user1", Secret: "s3cret"}, nil)
+	idClient.On("Enroll", mock.Anything, mock.Anything, mock.Anything).Return(nil, restutil.NewRestError("enroll failed", 500))
+	idClient.On("Revoke", mock.Anything, mock.Anything, mock.Anything).Return(&identity.RevokeResponse{RevokedCerts: []map[string]string{{"aki": "aki1", "serial": "serial1"}}}, nil)
+	r := newRouter(nil, nil, idClient, nil, nil, nil)
+	var err error
+	r.identitySync, err = newIdentitySync(&conf.IdentitySyncConf{URL: svr.URL, Headers: map[string]string{"Authorization": "Bearer iam-token"}})
+	assert.NoError(err)
+	defer r.identitySync.Close()
+	r.identitySync.retryDelay = time.Millisecond
+
+	res := httptest.NewRecorder()
+	r.registerUser(res, httptest.NewRequest("POST", "/identities", strings.NewReader(`{"name":"user1","secret":"s3cret","type":"client","affiliation":"org1","attributes":{"role":"admin"}}`)), nil)
+	assert.Equal(200, res.Code)
+	body := <-bodies
+	assert.Equal("registered", body["type"])
+	assert.NotContains(body, "secret")
+	user := body["resource"].(map[string]interface{})
+	assert.Equal("user1", user["userName"])
+	assert.Equal(true, user["active"])
+	assert.Equal([]interface{}{scimUserSchema, scimFabricIdentityExtensionURN}, user["schemas"])
+	fabric := user[scimFabricIdentityExtensionURN].(map[string]interface{})
+	assert.Equal("org1", fabric["affiliation"])
+	assert.Equal(map[string]interface{}{"role": "admin"}, fabric["attributes"])
+	assert.NotContains(fabric, "secret")
+
+	// failed changes are not synced
+	params := httprouter.Params{{Key: "username", Value: "user1"}}
+	res = httptest.NewRecorder()
+	r.enrollUser(res, httptest.NewRequest("POST", "/identities/user1/enroll", strings.NewReader(`{"secret":"s3cret"}`)), params)
+	assert.Equal(500, res.Code)
+
+	res = httptest.NewRecorder()
+	r.revokeUser(res, httptest.NewRequest("POST", "/identities/user1/revoke", strings.NewReader(`{"reason":"keycompromise"}`)), params)
+	assert.Equal(200, res.Code)
+	body = <-bodies
+	assert.Equal("revoked", body["type"])
+	assert.Equal("keycompromise", body["reason"])
+	assert.Equal([]interface{}{map[string]interface{}{"aki": "aki1", "serial": "serial1"}}, body["revokedCerts"])
+	user = body["resource"].(map[string]interface{})
+	assert.Equal("user1", user["id"])
+	assert.Equal(false, user["active"])
+	assert.Equal([]interface{}{scimUserSchema}, user["schemas"])
+	assert.Equal(0, len(bodies))
+}
@@ -0,0 +1,57 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"net"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/netutil"
+)
+
+// listen opens the listener of the server, that accepts no more than maxConnections at a time
+func listen(addr string, maxConnections int) (net.Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return limitConnections(l, maxConnections), nil
+}
+
+// listenUnix opens a listener on a Unix domain socket, for sidecars that share the host or pod
+// of the connector and should not need a TCP port. A socket left behind by a previous run is removed
+func listenUnix(path string, maxConnections int) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		log.Infof("Removing stale socket %s", path)
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return limitConnections(l, maxConnections), nil
+}
+
+func limitConnections(l net.Listener, maxConnections int) net.Listener {
+	if maxConnections > 0 {
+		return netutil.LimitListener(l, maxConnections)
+	}
+	return l
+}
@@ -0,0 +1,107 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListenMaxConnections(t *testing.T) {
+	assert := assert.New(t)
+	l, err := listen("127.0.0.1:0", 1)
+	assert.NoError(err)
+	defer l.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+	c1, err := net.Dial("tcp", l.Addr().String())
+	assert.NoError(err)
+	conn1 := <-accepted
+	c2, err := net.Dial("tcp", l.Addr().String())
+	assert.NoError(err)
+	defer c2.Close()
+	select {
+	case <-accepted:
+		assert.Fail("second connection accepted while the first was open")
+	case <-time.After(100 * time.Millisecond):
+	}
+	c1.Close()
+	conn1.Close()
+	conn2 := <-accepted
+	conn2.Close()
+}
+
+func TestListenBadAddress(t *testing.T) {
+	_, err := listen("bad address", 0)
+	assert.Error(t, err)
+}
+
+func TestListenUnix(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := os.MkdirTemp("", "fc")
+	defer os.RemoveAll(dir)
+	socket := path.Join(dir, "fabconnect.sock")
+
+	// a socket left behind by a previous run is replaced
+	stale, err := net.Listen("unix", socket)
+	assert.NoError(err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := listenUnix(socket, 0)
+	assert.NoError(err)
+	svr := &http.Server{
+		Handler: http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.WriteHeader(204)
+		}),
+		ReadHeaderTimeout: time.Second,
+	}
+	go func() { _ = svr.Serve(l) }()
+	defer svr.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	res, err := client.Get("http://fabconnect/status")
+	assert.NoError(err)
+	assert.Equal(204, res.StatusCode)
+}
+
+func TestListenUnixNotASocket(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "fc")
+	defer os.RemoveAll(dir)
+	_, err := listenUnix(dir, 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,84 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/fabric/client"
+	"github.com/hyperledger/firefly-fabconnect/internal/metrics"
+	"github.com/hyperledger/firefly-fabconnect/internal/tx"
+)
+
+// startMetrics pushes the metrics of the components that report them, when an exporter is configured
+func (g *Gateway) startMetrics() error {
+	if !metrics.Enabled(&g.config.Metrics) {
+		return nil
+	}
+	pusher, err := metrics.NewPusher(&g.config.Metrics)
+	if err != nil {
+		return errors.Errorf(errors.RESTGatewayMetricsInitFailed, err)
+	}
+	if provider, ok := g.processor.(tx.CommitLatencyStatsProvider); ok {
+		pusher.AddSource(commitLatencyMetrics(provider))
+	}
+	if provider, ok := g.rpc.(client.BlockCacheStatsProvider); ok {
+		pusher.AddSource(blockCacheMetrics(provider))
+	}
+	if source, ok := g.sm.(metrics.Source); ok {
+		pusher.AddSource(source)
+	}
+	if source, ok := g.receiptStore.(metrics.Source); ok {
+		pusher.AddSource(source)
+	}
+	pusher.Start()
+	g.metrics = pusher
+	return nil
+}
+
+func commitLatencyMetrics(provider tx.CommitLatencyStatsProvider) metrics.Source {
+	return metrics.SourceFunc(func() []metrics.Metric {
+		stats := provider.CommitLatencyStats()
+		breached := 0.0
+		if stats.Breached {
+			breached = 1
+		}
+		return []metrics.Metric{
+			{Name: "tx.committed", Kind: metrics.Counter, Value: float64(stats.Committed)},
+			{Name: "tx.commit.latency.p50", Kind: metrics.Gauge, Value: stats.P50MS},
+			{Name: "tx.commit.latency.p95", Kind: metrics.Gauge, Value: stats.P95MS},
+			{Name: "tx.commit.latency.p99", Kind: metrics.Gauge, Value: stats.P99MS},
+			{Name: "tx.commit.latency.max", Kind: metrics.Gauge, Value: stats.MaxMS},
+			{Name: "tx.commit.slo.breached", Kind: metrics.Gauge, Value: breached},
+		}
+	})
+}
+
+func blockCacheMetrics(provider client.BlockCacheStatsProvider) metrics.Source {
+	return metrics.SourceFunc(func() []metrics.Metric {
+		stats := provider.BlockCacheStats()
+		if stats == nil {
+			return nil
+		}
+		return []metrics.Metric{
+			{Name: "blockcache.hits", Kind: metrics.Counter, Value: float64(stats.Hits)},
+			{Name: "blockcache.misses", Kind: metrics.Counter, Value: float64(stats.Misses)},
+			{Name: "blockcache.evictions", Kind: metrics.Counter, Value: float64(stats.Evictions)},
+			{Name: "blockcache.blocks", Kind: metrics.Gauge, Value: float64(stats.Blocks)},
+			{Name: "blockcache.bytes", Kind: metrics.Gauge, Value: float64(stats.SizeBytes)},
+		}
+	})
+}
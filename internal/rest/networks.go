@@ -0,0 +1,253 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/events"
+	"github.com/hyperledger/firefly-fabconnect/internal/fabric/client"
+	restasync "github.com/hyperledger/firefly-fabconnect/internal/rest/async"
+	"github.com/hyperledger/firefly-fabconnect/internal/rest/receipt"
+	restsync "github.com/hyperledger/firefly-fabconnect/internal/rest/sync"
+	"github.com/hyperledger/firefly-fabconnect/internal/tx"
+	"github.com/hyperledger/firefly-fabconnect/internal/usage"
+	"github.com/hyperledger/firefly-fabconnect/internal/utils"
+	"github.com/hyperledger/firefly-fabconnect/internal/ws"
+	"github.com/julienschmidt/httprouter"
+)
+
+// network is a Fabric network served under /networks/:network, with its own client, stores,
+// event streams and websocket server. Its routes are those of the application APIs of the
+// gateway, while the operational endpoints are only served by the gateway
+type network struct {
+	name            string
+	config          *conf.RESTGatewayConf
+	processor       tx.Processor
+	receiptStore    receipt.Store
+	asyncDispatcher restasync.Dispatcher
+	sm              events.SubscriptionManager
+	ws              ws.WebSocketServer
+	systemEvents    *ws.SystemEventPublisher
+	rpc             client.RPCClient
+	router          *router
+}
+
+// networkConf is the config of the gateway, with the client and stores of the network
+func networkConf(config *conf.RESTGatewayConf, n *conf.NetworkConf) *conf.RESTGatewayConf {
+	c := *config
+	c.RPC = n.RPC
+	c.Receipts.MongoDB = n.Receipts.MongoDB
+	c.Receipts.LevelDB = n.Receipts.LevelDB
+	c.Events.LevelDB = n.Events.LevelDB
+	c.AsyncQueue = n.AsyncQueue
+	c.Networks = nil
+	return &c
+}
+
+// networkStore is a store of a network, with the key that tells whether two networks share it
+type networkStore struct {
+	kind     string
+	location string
+	key      string
+}
+
+func networkStores(receipts *conf.NetworkReceiptsConf, events, asyncQueue *conf.LevelDBReceiptsConf) []networkStore {
+	var stores []networkStore
+	if receipts.MongoDB.URL != "" {
+		// the URL is only part of the key, as it can hold credentials
+		location := receipts.MongoDB.Database + "/" + receipts.MongoDB.Collection
+		stores = append(stores, networkStore{"receipts", location, receipts.MongoDB.URL + "/" + location})
+	}
+	for _, s := range []networkStore{
+		{"receipts", receipts.LevelDB.Path, ""},
+		{"events", events.Path, ""},
+		{"async queue", asyncQueue.Path, ""},
+	} {
+		if s.location != "" {
+			s.key = filepath.Clean(s.location)
+			stores = append(stores, s)
+		}
+	}
+	return stores
+}
+
+func validateNetworks(config *conf.RESTGatewayConf) error {
+	if len(config.Networks) > 0 && len(config.Kafka.Brokers) > 0 {
+		return errors.Errorf(errors.ConfigRESTGatewayNetworksKafka)
+	}
+	names := make([]string, 0, len(config.Networks))
+	for name, n := range config.Networks {
+		if n.RPC.ConfigPath == "" {
+			return errors.Errorf(errors.ConfigRESTGatewayNetworkRequiredRPCPath, name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// the networks are checked in order, so the error is the same each time
+	owners := make(map[string]string)
+	rootReceipts := &conf.NetworkReceiptsConf{MongoDB: config.Receipts.MongoDB, LevelDB: config.Receipts.LevelDB}
+	for _, s := range networkStores(rootReceipts, &config.Events.LevelDB, &config.AsyncQueue.LevelDB) {
+		owners[s.key] = "the root network"
+	}
+	for _, name := range names {
+		n := config.Networks[name]
+		for _, s := range networkStores(&n.Receipts, &n.Events.LevelDB, &n.AsyncQueue.LevelDB) {
+			if owner, ok := owners[s.key]; ok {
+				return errors.Errorf(errors.ConfigRESTGatewayNetworkSharedStore, s.kind, name, s.location, owner)
+			}
+			owners[s.key] = fmt.Sprintf("network '%s'", name)
+		}
+	}
+	return nil
+}
+
+// newNetwork connects to a network, and opens its stores. The consumer tokens, identity sync and
+// usage tracking of the gateway are shared with the network, as they are configured by the root.
+// Whatever was opened is closed again if the network fails to initialize
+func newNetwork(name string, config *conf.RESTGatewayConf, resultDecoders *utils.ResultDecoders, root *router) (_ *network, err error) {
+	n := &network{
+		name:   name,
+		config: config,
+	}
+	defer func() {
+		if err != nil {
+			n.close()
+		}
+	}()
+	n.processor = tx.NewTxProcessor(config)
+	if processor, ok := n.processor.(tx.ResultDecodingProcessor); ok {
+		processor.SetResultDecoders(resultDecoders)
+	}
+	n.receiptStore = receipt.NewReceiptStore(config)
+	syncDispatcher := restsync.NewDispatcher(config, n.processor, resultDecoders)
+	n.asyncDispatcher = restasync.NewAsyncDispatcher(config, n.processor, n.receiptStore)
+	if err = n.asyncDispatcher.ValidateConf(); err != nil {
+		return nil, err
+	}
+
+	rpcClient, identityClient, err := client.RPCConnect(config.RPC, config.MaxTXWaitTime)
+	if err != nil {
+		return nil, err
+	}
+	n.rpc = rpcClient
+	n.processor.Init(rpcClient)
+	if processor, ok := n.processor.(tx.QuotaProcessor); ok {
+		if idClient, ok := identityClient.(client.IdentityClient); ok {
+			processor.SetIdentityClient(idClient)
+		}
+	}
+
+	n.ws = ws.NewWebSocketServer()
+	if notifier, ok := rpcClient.(client.ChannelConfigNotifier); ok {
+		n.systemEvents = ws.NewSystemEventPublisher(n.ws)
+		notifier.AddChannelConfigListener(&systemEvents{publisher: n.systemEvents})
+	}
+	if err = n.receiptStore.Init(n.ws); err != nil {
+		return nil, err
+	}
+
+	if config.Events.LevelDB.Path != "" {
+		n.sm = events.NewSubscriptionManager(&config.Events, rpcClient, n.ws)
+		if err = n.sm.Init(); err != nil {
+			return nil, errors.Errorf(errors.RESTGatewayEventManagerInitFailed, err)
+		}
+		if processor, ok := n.processor.(tx.OutboxProcessor); ok {
+			if deliverer, ok := n.sm.(tx.EventDeliverer); ok {
+				processor.SetEventDeliverer(deliverer)
+			}
+		}
+	}
+
+	n.router = newRouter(syncDispatcher, n.asyncDispatcher, identityClient, rpcClient, n.sm, n.ws)
+	n.router.headerPassthrough = &config.HTTP.HeaderPassthrough
+	if processor, ok := n.processor.(tx.QuotaProcessor); ok {
+		n.router.quotas = processor
+	}
+	n.router.consumerTokens = root.consumerTokens
+	n.ws.SetAuthenticator(n.router.authenticateToken)
+	n.router.identitySync = root.identitySync.forNetwork(name)
+	if root.usage != nil {
+		if source, ok := n.processor.(usage.Source); ok {
+			root.usage.AddSource(source)
+		}
+		if source, ok := n.sm.(usage.Source); ok {
+			root.usage.AddSource(source)
+		}
+	}
+	n.router.subsystems = newSubsystems()
+	// the operational routes are added to a router that is not served
+	n.router.useAdminListener()
+	n.router.addRoutes()
+	return n, nil
+}
+
+func (n *network) close() {
+	if n.sm != nil {
+		n.sm.Close()
+	}
+	if n.asyncDispatcher != nil {
+		n.asyncDispatcher.Close()
+	}
+	if n.rpc != nil {
+		n.rpc.Close()
+	}
+	if n.systemEvents != nil {
+		n.systemEvents.Close()
+	}
+	if n.ws != nil {
+		n.ws.Close()
+	}
+}
+
+// addNetworkRoutes serves the routes of each network under /networks/:network
+func (r *router) addNetworkRoutes(networks map[string]*router) {
+	r.networks = networks
+	r.httpRouter.GET("/networks", r.listNetworks)
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		r.httpRouter.Handle(method, "/networks/:network/*path", r.routeNetwork)
+	}
+}
+
+func (r *router) listNetworks(res http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	names := make([]string, 0, len(r.networks))
+	for name := range r.networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	marshalAndReply(res, req, names)
+}
+
+// routeNetwork passes the request to the router of the network, with the prefix of the network
+// removed from its path
+func (r *router) routeNetwork(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	name := params.ByName("network")
+	nr, ok := r.networks[name]
+	if !ok {
+		errors.RestErrReply(res, req, errors.Errorf(errors.RESTGatewayNetworkUnknown, name), 404)
+		return
+	}
+	req.URL.Path = params.ByName("path")
+	req.URL.RawPath = ""
+	nr.httpRouter.ServeHTTP(res, req)
+}
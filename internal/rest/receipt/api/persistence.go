@@ -25,3 +25,9 @@ type ReceiptStorePersistence interface {
 	AddReceipt(requestID string, receipt *map[string]interface{}) error
 	Close()
 }
+
+// ReceiptStoreBatchPersistence is implemented by persistence layers that can write a batch
+// of receipts in a single commit
+type ReceiptStoreBatchPersistence interface {
+	AddReceipts(requestIDs []string, receipts []*map[string]interface{}) error
+}
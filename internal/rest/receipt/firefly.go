@@ -0,0 +1,194 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package receipt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/messages"
+	"github.com/hyperledger/firefly-fabconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultFireFlyTimeout           = 30 * 1000
+	defaultFireFlyRetryInitialDelay = 250
+	defaultFireFlyRetryMaxDelay     = 30 * 1000
+	defaultFireFlyRetryTimeout      = 10 * 60 * 1000
+
+	fireflyOpStatusSucceeded = "Succeeded"
+	fireflyOpStatusFailed    = "Failed"
+)
+
+// FireFly submits transactions with the ID of the operation, prefixed by its namespace
+var fireflyOperationID = regexp.MustCompile(`^[a-zA-Z0-9_.-]+:[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// fireflyOperationUpdate is the body of the operation update API of FireFly core
+type fireflyOperationUpdate struct {
+	Status string                 `json:"status"`
+	Error  string                 `json:"error,omitempty"`
+	Output map[string]interface{} `json:"output,omitempty"`
+}
+
+// fireflyReceipts pushes the receipts of FireFly operations to FireFly core, each from a background
+// routine that retries it until it is accepted or the retry timeout is reached
+type fireflyReceipts struct {
+	url          string
+	headers      map[string]string
+	client       *http.Client
+	timeout      time.Duration
+	initialDelay time.Duration
+	maxDelay     time.Duration
+	retryTimeout time.Duration
+	ctx          context.Context
+	cancelCtx    context.CancelFunc
+	wg           sync.WaitGroup
+}
+
+func newFireFlyReceipts(ffConf *conf.FireFlyReceiptsConf) (*fireflyReceipts, error) {
+	u, err := url.Parse(ffConf.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.Errorf(errors.ReceiptsFireFlyInvalidURL, ffConf.URL)
+	}
+	tlsConfig, err := utils.CreateTLSConfiguration(&ffConf.TLS)
+	if err != nil {
+		return nil, err
+	}
+	ff := &fireflyReceipts{
+		url:          strings.TrimSuffix(ffConf.URL, "/"),
+		headers:      ffConf.Headers,
+		client:       &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig}},
+		timeout:      time.Duration(ffConf.TimeoutMS) * time.Millisecond,
+		initialDelay: time.Duration(ffConf.RetryInitialDelayMS) * time.Millisecond,
+		maxDelay:     time.Duration(ffConf.RetryMaxDelayMS) * time.Millisecond,
+		retryTimeout: time.Duration(ffConf.RetryTimeoutMS) * time.Millisecond,
+	}
+	if ff.timeout <= 0 {
+		ff.timeout = defaultFireFlyTimeout * time.Millisecond
+	}
+	if ff.initialDelay <= 0 {
+		ff.initialDelay = defaultFireFlyRetryInitialDelay * time.Millisecond
+	}
+	if ff.maxDelay <= 0 {
+		ff.maxDelay = defaultFireFlyRetryMaxDelay * time.Millisecond
+	}
+	if ff.retryTimeout <= 0 {
+		ff.retryTimeout = defaultFireFlyRetryTimeout * time.Millisecond
+	}
+	ff.ctx, ff.cancelCtx = context.WithCancel(context.Background())
+	return ff, nil
+}
+
+// push starts sending the receipt to FireFly, returning false if it is not the receipt of a
+// transaction FireFly submitted
+func (ff *fireflyReceipts) push(requestID string, headers, receipt map[string]interface{}) bool {
+	if !fireflyOperationID.MatchString(requestID) {
+		return false
+	}
+	update := &fireflyOperationUpdate{
+		Status: fireflyOpStatusSucceeded,
+		Output: receipt,
+	}
+	if utils.GetMapString(headers, "type") != messages.MsgTypeTransactionSuccess {
+		update.Status = fireflyOpStatusFailed
+		update.Error = utils.GetMapString(receipt, "errorMessage")
+		if update.Error == "" {
+			update.Error = fmt.Sprintf("Transaction failed with status '%s'", utils.GetMapString(receipt, "status"))
+		}
+	}
+	b, err := json.Marshal(update)
+	if err != nil {
+		log.Errorf("%s: Failed to serialize the receipt for FireFly: %s", requestID, err)
+		return false
+	}
+	ff.wg.Add(1)
+	go func() {
+		defer ff.wg.Done()
+		ff.send(requestID, b)
+	}()
+	return true
+}
+
+func (ff *fireflyReceipts) send(requestID string, body []byte) {
+	startTime := time.Now()
+	delay := ff.initialDelay
+	for attempt := 1; ; attempt++ {
+		retry, err := ff.attempt(requestID, body)
+		if err == nil {
+			log.Infof("%s: Pushed receipt to FireFly", requestID)
+			return
+		}
+		if !retry || time.Since(startTime)+delay > ff.retryTimeout {
+			// the receipt is in the receipt store, for FireFly to query
+			log.Errorf("%s: Failed to push receipt to FireFly after %d attempts: %s", requestID, attempt, err)
+			return
+		}
+		log.Warnf("%s: Attempt %d to push receipt to FireFly failed, retrying in %.2fs: %s", requestID, attempt, delay.Seconds(), err)
+		select {
+		case <-ff.ctx.Done():
+			log.Warnf("%s: Abandoned push of receipt to FireFly on close", requestID)
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > ff.maxDelay {
+			delay = ff.maxDelay
+		}
+	}
+}
+
+// attempt sends the operation update once, returning whether a failure is worth retrying
+func (ff *fireflyReceipts) attempt(requestID string, body []byte) (retry bool, err error) {
+	ctx, cancel := context.WithTimeout(ff.ctx, ff.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, ff.url+"/spi/v1/operations/"+url.PathEscape(requestID), bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range ff.headers {
+		req.Header.Set(name, value)
+	}
+	res, err := ff.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+	// other client errors, such as an operation FireFly does not know, fail the same way every time
+	retry = res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+	return retry, errors.Errorf(errors.ReceiptsFireFlyPushFailed, res.StatusCode, requestID)
+}
+
+// close abandons the retries of the receipts still being pushed, and waits for them to finish
+func (ff *fireflyReceipts) close() {
+	ff.cancelCtx()
+	ff.wg.Wait()
+}
@@ -0,0 +1,161 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package receipt
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/messages"
+	"github.com/hyperledger/firefly-fabconnect/internal/utils"
+	mockws "github.com/hyperledger/firefly-fabconnect/mocks/ws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type fireflyRequest struct {
+	path   string
+	auth   string
+	update fireflyOperationUpdate
+}
+
+func newFireFlyTestStore(t *testing.T, statuses ...int) (*receiptStore, *mockws.WebSocketChannels, chan *fireflyRequest) {
+	requests := make(chan *fireflyRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal(t, http.MethodPatch, req.Method)
+		r := &fireflyRequest{path: req.URL.Path, auth: req.Header.Get("Authorization")}
+		_ = json.NewDecoder(req.Body).Decode(&r.update)
+		status := statuses[0]
+		if len(statuses) > 1 {
+			statuses = statuses[1:]
+		}
+		w.WriteHeader(status)
+		requests <- r
+	}))
+	t.Cleanup(server.Close)
+
+	r, _ := newReceiptsTestStore()
+	r.config.FireFly = conf.FireFlyReceiptsConf{
+		URL:                 server.URL + "/",
+		Headers:             map[string]string{"Authorization": "Bearer token1"},
+		RetryInitialDelayMS: 1,
+		RetryTimeoutMS:      1000,
+	}
+	assert.NoError(t, r.ValidateConf())
+	ws := &mockws.WebSocketChannels{}
+	ws.On("SendReply", mock.Anything).Return()
+	r.ws = ws
+	return r, ws, requests
+}
+
+func testFireFlyReceipt(requestID, msgType string) []byte {
+	replyMsg := &messages.TransactionReceipt{}
+	replyMsg.Headers.MsgType = msgType
+	replyMsg.Headers.ID = utils.UUIDv4()
+	replyMsg.Headers.ReqID = requestID
+	replyMsg.TransactionHash = "9c842ffd430a56a5338f353a7b5b5052b4ac604564d82318af9329b4bf46dd89"
+	replyMsg.Status = "MVCC_READ_CONFLICT"
+	b, _ := json.Marshal(&replyMsg)
+	return b
+}
+
+func TestFireFlyReceiptsValidation(t *testing.T) {
+	assert := assert.New(t)
+	_, err := newFireFlyReceipts(&conf.FireFlyReceiptsConf{URL: "firefly:5101"})
+	assert.EqualError(err, "Invalid receipts.firefly.url 'firefly:5101'")
+	_, err = newFireFlyReceipts(&conf.FireFlyReceiptsConf{URL: "http://firefly:5101", TLS: conf.TLSConfig{ClientKeyFile: "key.pem"}})
+	assert.Regexp("Client private key and certificate must both be provided", err)
+
+	ff, err := newFireFlyReceipts(&conf.FireFlyReceiptsConf{URL: "http://firefly:5101"})
+	assert.NoError(err)
+	assert.Equal(defaultFireFlyTimeout*time.Millisecond, ff.timeout)
+	assert.Equal(defaultFireFlyRetryTimeout*time.Millisecond, ff.retryTimeout)
+
+	r, _ := newReceiptsTestStore()
+	r.config.FireFly.URL = "://bad"
+	assert.Regexp("Invalid receipts.firefly.url", r.ValidateConf())
+}
+
+func TestFireFlyReceiptsPushed(t *testing.T) {
+	assert := assert.New(t)
+	r, ws, requests := newFireFlyTestStore(t, 204)
+	defer r.Close()
+
+	opID := "ns1:" + utils.UUIDv4()
+	r.ProcessReceipt(testFireFlyReceipt(opID, messages.MsgTypeTransactionSuccess))
+	req := <-requests
+	assert.Equal("/spi/v1/operations/"+opID, req.path)
+	assert.Equal("Bearer token1", req.auth)
+	assert.Equal("Succeeded", req.update.Status)
+	assert.Equal("9c842ffd430a56a5338f353a7b5b5052b4ac604564d82318af9329b4bf46dd89", req.update.Output["transactionHash"])
+
+	r.ProcessReceipt(testFireFlyReceipt(opID, messages.MsgTypeTransactionFailure))
+	req = <-requests
+	assert.Equal("Failed", req.update.Status)
+	assert.Equal("Transaction failed with status 'MVCC_READ_CONFLICT'", req.update.Error)
+	ws.AssertNotCalled(t, "SendReply", mock.Anything)
+
+	// receipts of requests that FireFly did not submit are sent to the replies
+	r.ProcessReceipt(testFireFlyReceipt(utils.UUIDv4(), messages.MsgTypeTransactionSuccess))
+	ws.AssertNumberOfCalls(t, "SendReply", 1)
+}
+
+func TestFireFlyReceiptsRetried(t *testing.T) {
+	assert := assert.New(t)
+	r, _, requests := newFireFlyTestStore(t, 503, 429, 200)
+
+	opID := "ns1:" + utils.UUIDv4()
+	r.ProcessReceipt(testFireFlyReceipt(opID, messages.MsgTypeTransactionSuccess))
+	for i := 0; i < 3; i++ {
+		req := <-requests
+		assert.Equal("/spi/v1/operations/"+opID, req.path)
+	}
+	r.Close()
+	assert.Empty(requests)
+}
+
+func TestFireFlyReceiptsNotRetried(t *testing.T) {
+	assert := assert.New(t)
+	r, _, requests := newFireFlyTestStore(t, 404, 200)
+
+	r.ProcessReceipt(testFireFlyReceipt("ns1:"+utils.UUIDv4(), messages.MsgTypeTransactionSuccess))
+	<-requests
+	r.Close()
+	assert.Empty(requests)
+}
+
+func TestFireFlyReceiptsAbandonedOnClose(t *testing.T) {
+	assert := assert.New(t)
+	r, _, requests := newFireFlyTestStore(t, 500)
+	r.firefly.initialDelay = time.Hour
+	r.firefly.retryTimeout = 2 * time.Hour
+
+	r.ProcessReceipt(testFireFlyReceipt("ns1:"+utils.UUIDv4(), messages.MsgTypeTransactionSuccess))
+	<-requests
+	r.Close()
+	assert.Empty(requests)
+
+	// a request that cannot be built is not retried
+	r.firefly.url = "://bad"
+	retry, err := r.firefly.attempt("ns1:op1", nil)
+	assert.False(retry)
+	assert.Error(err)
+}
@@ -70,6 +70,25 @@ func (l *levelDBReceipts) Init() error {
 // AddReceipt processes an individual reply message, and contains all errors
 // To account for any transitory failures writing to mongoDB, it retries adding receipt with a backoff
 func (l *levelDBReceipts) AddReceipt(requestID string, receipt *map[string]interface{}) (err error) {
+	for _, put := range l.receiptPuts(requestID, receipt) {
+		if err = l.store.Put(put.Key, put.Val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddReceipts writes a batch of receipts, and their index entries, in a single commit
+func (l *levelDBReceipts) AddReceipts(requestIDs []string, receipts []*map[string]interface{}) error {
+	var puts []kvstore.KVPut
+	for i, requestID := range requestIDs {
+		puts = append(puts, l.receiptPuts(requestID, receipts[i])...)
+	}
+	return l.store.PutBatch(puts)
+}
+
+// receiptPuts returns the entry of a receipt, followed by its index entries
+func (l *levelDBReceipts) receiptPuts(requestID string, receipt *map[string]interface{}) []kvstore.KVPut {
 	// insert an entry with a composite key to track the insertion order
 	l.entropyLock.Lock()
 	newID := ulid.MustNew(ulid.Timestamp(time.Now()), l.idEntropy)
@@ -79,34 +98,25 @@ func (l *levelDBReceipts) AddReceipt(requestID string, receipt *map[string]inter
 	lookupKey := fmt.Sprintf("z%s", newID)
 
 	b, _ := json.MarshalIndent(receipt, "", "  ")
-	err = l.store.Put(lookupKey, b)
+	puts := []kvstore.KVPut{{Key: lookupKey, Val: b}}
 
-	if err == nil {
-		// build the index for "from"
-		fromKey := fmt.Sprintf("from:%s:%s", (*receipt)["from"], lookupKey)
-		err = l.store.Put(fromKey, []byte(lookupKey))
-	}
+	// build the index for "from"
+	fromKey := fmt.Sprintf("from:%s:%s", (*receipt)["from"], lookupKey)
+	puts = append(puts, kvstore.KVPut{Key: fromKey, Val: []byte(lookupKey)})
 
-	if err == nil {
-		// build the index for "to" if a value is present
-		to, ok := (*receipt)["to"]
-		if ok && to != "" {
-			toKey := fmt.Sprintf("to:%s:%s", to, lookupKey)
-			err = l.store.Put(toKey, []byte(lookupKey))
-		}
+	// build the index for "to" if a value is present
+	to, ok := (*receipt)["to"]
+	if ok && to != "" {
+		toKey := fmt.Sprintf("to:%s:%s", to, lookupKey)
+		puts = append(puts, kvstore.KVPut{Key: toKey, Val: []byte(lookupKey)})
 	}
 
-	if err == nil {
-		// build the index for "receivedAt"
-		receivedAtKey := fmt.Sprintf("receivedAt:%d:%s", (*receipt)["receivedAt"], lookupKey)
-		err = l.store.Put(receivedAtKey, []byte(lookupKey))
-	}
+	// build the index for "receivedAt"
+	receivedAtKey := fmt.Sprintf("receivedAt:%d:%s", (*receipt)["receivedAt"], lookupKey)
+	puts = append(puts, kvstore.KVPut{Key: receivedAtKey, Val: []byte(lookupKey)})
 
-	if err == nil {
-		// insert the lookup entry for GetReceipt()
-		err = l.store.Put(requestID, []byte(lookupKey))
-	}
-	return err
+	// insert the lookup entry for GetReceipt()
+	return append(puts, kvstore.KVPut{Key: requestID, Val: []byte(lookupKey)})
 }
 
 // GetReceipts Returns recent receipts with skip, limit and other query parameters
@@ -23,6 +23,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/hyperledger/firefly-fabconnect/internal/kvstore"
 	"github.com/hyperledger/firefly-fabconnect/internal/rest/test"
 	mockkvstore "github.com/hyperledger/firefly-fabconnect/mocks/kvstore"
 	"github.com/oklog/ulid/v2"
@@ -120,6 +121,49 @@ func TestLevelDBReceiptsAddReceiptFailed(t *testing.T) {
 	assert.Regexp("pop", err)
 }
 
+func TestLevelDBReceiptsAddReceiptsOK(t *testing.T) {
+	assert := assert.New(t)
+
+	_, testConfig := test.Setup()
+	testConfig.Receipts.LevelDB.Path = path.Join(tmpdir, "batch")
+	r := newLevelDBReceipts(&testConfig.Receipts)
+	_ = r.Init()
+	defer r.store.Close()
+
+	receipt1 := map[string]interface{}{"_id": "r1", "from": "user1", "to": "cc1", "receivedAt": 1}
+	receipt2 := map[string]interface{}{"_id": "r2", "from": "user2", "receivedAt": 2}
+	err := r.AddReceipts([]string{"r1", "r2"}, []*map[string]interface{}{&receipt1, &receipt2})
+	assert.NoError(err)
+
+	result, err := r.GetReceipt("r2")
+	assert.NoError(err)
+	assert.Equal("user2", (*result)["from"])
+	results, err := r.GetReceipts(0, 0, nil, 0, "user1", "", "")
+	assert.NoError(err)
+	assert.Equal(1, len(*results))
+	assert.Equal("r1", (*results)[0]["_id"])
+}
+
+func TestLevelDBReceiptsAddReceiptsFailed(t *testing.T) {
+	assert := assert.New(t)
+
+	kvstoreMock := &mockkvstore.KVStore{}
+	kvstoreMock.On("PutBatch", mock.Anything).Return(fmt.Errorf("pop"))
+	_, testConfig := test.Setup()
+	r := &levelDBReceipts{
+		conf:      &testConfig.Receipts,
+		store:     kvstoreMock,
+		idEntropy: ulid.Monotonic(rand.New(rand.NewSource(1)), 0),
+	}
+
+	receipt := make(map[string]interface{})
+	err := r.AddReceipts([]string{"key"}, []*map[string]interface{}{&receipt})
+	assert.Regexp("pop", err)
+	puts := kvstoreMock.Calls[0].Arguments[0].([]kvstore.KVPut)
+	assert.Equal(4, len(puts))
+	assert.Equal("key", puts[3].Key)
+}
+
 func TestLevelDBReceiptsGetReceiptsOK(t *testing.T) {
 	assert := assert.New(t)
 
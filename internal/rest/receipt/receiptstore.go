@@ -53,9 +53,14 @@ type Store interface {
 }
 
 type receiptStore struct {
-	config      *conf.ReceiptsDBConf
-	persistence api.ReceiptStorePersistence
-	ws          ws.WebSocketChannels
+	config           *conf.ReceiptsDBConf
+	persistence      api.ReceiptStorePersistence
+	ws               ws.WebSocketChannels
+	ethconnectCompat bool
+	kafkaConf        *conf.KafkaConf
+	router           *receiptRouter
+	firefly          *fireflyReceipts
+	writer           *receiptWriter
 }
 
 func NewReceiptStore(config *conf.RESTGatewayConf) Store {
@@ -78,24 +83,48 @@ func NewReceiptStore(config *conf.RESTGatewayConf) Store {
 	if config.Receipts.RetryInitialDelayMS <= 0 {
 		config.Receipts.RetryInitialDelayMS = defaultRetryInitialDelay
 	}
+	if config.Receipts.WriteBatch.Enabled {
+		setWriteBatchDefaults(&config.Receipts.WriteBatch)
+	}
 	return &receiptStore{
-		config:      &config.Receipts,
-		persistence: receiptStorePersistence,
+		config:           &config.Receipts,
+		persistence:      receiptStorePersistence,
+		ethconnectCompat: config.EthconnectCompat,
+		kafkaConf:        &config.Kafka,
 	}
 }
-func (r *receiptStore) ValidateConf() error {
-	return r.persistence.ValidateConf()
+func (r *receiptStore) ValidateConf() (err error) {
+	if err = r.persistence.ValidateConf(); err != nil {
+		return err
+	}
+	if len(r.config.Routes) > 0 {
+		if r.router, err = newReceiptRouter(r.config.Routes, r.kafkaConf); err != nil {
+			return err
+		}
+	}
+	if r.config.FireFly.URL != "" {
+		r.firefly, err = newFireFlyReceipts(&r.config.FireFly)
+	}
+	return err
 }
 
 func (r *receiptStore) Init(ws ws.WebSocketChannels, mocked ...api.ReceiptStorePersistence) error {
 	r.ws = ws
+	if r.router != nil {
+		r.router.ws = ws
+	}
 	if mocked != nil {
 		// only used in test code to pass in a mocked impl
 		r.persistence = mocked[0]
-		return nil
+	} else if err := r.persistence.Init(); err != nil {
+		// the regular runtime does this
+		return err
 	}
-	// the regular runtime does this
-	return r.persistence.Init()
+	if r.config.WriteBatch.Enabled {
+		r.writer = newReceiptWriter(&r.config.WriteBatch)
+		go r.writeBatches()
+	}
+	return nil
 }
 
 func (r *receiptStore) extractHeaders(parsedMsg map[string]interface{}) map[string]interface{} {
@@ -139,17 +168,34 @@ func (r *receiptStore) ProcessReceipt(msgBytes []byte) {
 	}
 	log.Infof("Received reply message. requestId='%s' reqOffset='%s' type='%s': %s", requestID, reqOffset, msgType, result)
 
+	if r.ethconnectCompat {
+		// routes match the headers of the reply, including those the ethconnect shape drops
+		original := headers
+		headers = make(map[string]interface{}, len(original))
+		for k, v := range original {
+			headers[k] = v
+		}
+		messages.ToEthconnectReply(parsedMsg)
+	}
 	parsedMsg["receivedAt"] = time.Now().UnixNano() / int64(time.Millisecond)
 	parsedMsg["_id"] = requestID
 
 	// Insert the receipt into persistence - captures errors
 	if requestID != "" && r.persistence != nil {
-		r.writeReceipt(requestID, parsedMsg)
+		if r.writer != nil && r.writer.enqueue(&queuedReceipt{requestID: requestID, headers: headers, receipt: parsedMsg}) {
+			return
+		}
+		r.writeReceipt(requestID, headers, parsedMsg)
 	}
 
 }
 
-func (r *receiptStore) writeReceipt(requestID string, receipt map[string]interface{}) {
+func (r *receiptStore) writeReceipt(requestID string, headers, receipt map[string]interface{}) {
+	r.persistReceipt(requestID, receipt)
+	r.deliverReceipt(requestID, headers, receipt)
+}
+
+func (r *receiptStore) persistReceipt(requestID string, receipt map[string]interface{}) {
 	startTime := time.Now()
 	delay := time.Duration(r.config.RetryInitialDelayMS) * time.Millisecond
 	attempt := 0
@@ -184,6 +230,17 @@ func (r *receiptStore) writeReceipt(requestID string, receipt map[string]interfa
 			log.Panicf("%s: Failed to insert into receipt store after %.2fs: %s", requestID, timeRetrying.Seconds(), err)
 		}
 	}
+}
+
+// deliverReceipt sends a stored receipt to the destination of its route, to FireFly core if it is
+// the receipt of a FireFly operation, or to the websocket replies
+func (r *receiptStore) deliverReceipt(requestID string, headers, receipt map[string]interface{}) {
+	if r.router != nil && r.router.route(requestID, headers, receipt) {
+		return
+	}
+	if r.firefly != nil && r.firefly.push(requestID, headers, receipt) {
+		return
+	}
 	if r.ws != nil {
 		r.ws.SendReply(receipt)
 	}
@@ -305,7 +362,17 @@ func (r *receiptStore) GetReceipt(res http.ResponseWriter, req *http.Request, pa
 }
 
 func (r *receiptStore) Close() {
+	if r.writer != nil {
+		// the queued receipts are written before the store is closed
+		r.writer.close()
+	}
 	r.persistence.Close()
+	if r.router != nil {
+		r.router.close()
+	}
+	if r.firefly != nil {
+		r.firefly.close()
+	}
 }
 
 func (r *receiptStore) marshalAndReply(res http.ResponseWriter, req *http.Request, result interface{}) {
@@ -59,6 +59,53 @@ func TestReplyProcessorWithValidReply(t *testing.T) {
 
 }
 
+func TestReplyProcessorEthconnectCompat(t *testing.T) {
+	assert := assert.New(t)
+
+	r, p := newReceiptsTestStore()
+	r.ethconnectCompat = true
+
+	replyMsg := &messages.TransactionReceipt{}
+	replyMsg.Headers.MsgType = messages.MsgTypeTransactionSuccess
+	replyMsg.Headers.ID = utils.UUIDv4()
+	replyMsg.Headers.ReqID = utils.UUIDv4()
+	replyMsg.Headers.ChannelID = "default-channel"
+	replyMsg.Headers.Signer = "user1"
+	replyMsg.BlockNumber = 12345678
+	replyMsg.Signer = "user1"
+	replyMsg.SignerMSP = "Org1MSP"
+	replyMsg.Status = "VALID"
+	replyMsg.TransactionHash = "9c842ffd430a56a5338f353a7b5b5052b4ac604564d82318af9329b4bf46dd89"
+	replyMsgBytes, _ := json.Marshal(&replyMsg)
+
+	r.ProcessReceipt(replyMsgBytes)
+
+	front := *p.receipts.Front().Value.(*map[string]interface{})
+	assert.Equal(replyMsg.Headers.ReqID, front["_id"])
+	assert.Equal("12345678", front["blockNumber"])
+	assert.Equal("1", front["status"])
+	assert.Equal("VALID", front["validationCode"])
+	assert.Equal("user1", front["from"])
+	assert.Equal("Org1MSP", front["signerMSP"])
+	assert.NotContains(front, "signer")
+	headers := front["headers"].(map[string]interface{})
+	assert.Equal(messages.MsgTypeTransactionSuccess, headers["type"])
+	assert.NotContains(headers, "channel")
+	assert.NotContains(headers, "signer")
+
+	failure := &messages.TransactionReceipt{}
+	failure.Headers.MsgType = messages.MsgTypeTransactionFailure
+	failure.Headers.ReqID = utils.UUIDv4()
+	failure.Status = "MVCC_READ_CONFLICT"
+	failureBytes, _ := json.Marshal(&failure)
+
+	r.ProcessReceipt(failureBytes)
+
+	front = *p.receipts.Front().Value.(*map[string]interface{})
+	assert.Equal("0", front["status"])
+	assert.Equal("MVCC_READ_CONFLICT", front["validationCode"])
+}
+
 func TestReplyProcessorWithInvalidReplySwallowsErr(t *testing.T) {
 	r, _ := newReceiptsTestStore()
 	r.ProcessReceipt([]byte("!json"))
@@ -0,0 +1,82 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package receipt
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RedactedValue replaces the values of the redacted fields of the requests stored in receipts
+const RedactedValue = "***"
+
+// DefaultRequestEchoRedact are the fields redacted when receipts.requestEcho.redact is not set.
+// Transient data is kept off the ledger, so it is typically not safe to store
+var DefaultRequestEchoRedact = []string{"transientMap"}
+
+// WithRequestEcho returns the reply with the request added as its "request" field, after the
+// values at each of the redacted paths are replaced. The reply is returned unchanged if either
+// is not a JSON object
+func WithRequestEcho(reply, request []byte, redact []string) []byte {
+	var parsedReply, parsedRequest map[string]interface{}
+	if err := json.Unmarshal(reply, &parsedReply); err != nil {
+		log.Errorf("Unable to add the request to reply '%s': %s", string(reply), err)
+		return reply
+	}
+	if err := json.Unmarshal(request, &parsedRequest); err != nil {
+		log.Errorf("Unable to add request '%s' to its reply: %s", string(request), err)
+		return reply
+	}
+	for _, path := range redact {
+		if path != "" {
+			redactPath(parsedRequest, strings.Split(path, "."))
+		}
+	}
+	parsedReply["request"] = parsedRequest
+	b, _ := json.Marshal(parsedReply)
+	return b
+}
+
+// redactPath replaces the values at the path, where a number indexes an array and "*" matches
+// every field or element. Paths the value does not have are ignored
+func redactPath(value interface{}, path []string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k := range v {
+			if path[0] == "*" || path[0] == k {
+				if len(path) == 1 {
+					v[k] = RedactedValue
+				} else {
+					redactPath(v[k], path[1:])
+				}
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			if path[0] == "*" || path[0] == strconv.Itoa(i) {
+				if len(path) == 1 {
+					v[i] = RedactedValue
+				} else {
+					redactPath(v[i], path[1:])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package receipt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const echoTestRequest = `{
+	"headers": {"type": "SendTransaction", "signer": "user1", "ctx": {"token": "secret", "app": "a1"}},
+	"func": "CreateAsset",
+	"args": ["asset1", "blue", "{\"owner\":\"Tom\"}"],
+	"transientMap": {"price": "MTAw"}
+}`
+
+func TestWithRequestEcho(t *testing.T) {
+	assert := assert.New(t)
+	reply := []byte(`{"headers":{"requestId":"r1","type":"TransactionSuccess"},"transactionHash":"tx1"}`)
+
+	b := WithRequestEcho(reply, []byte(echoTestRequest), DefaultRequestEchoRedact)
+	assert.JSONEq(`{
+		"headers": {"requestId": "r1", "type": "TransactionSuccess"},
+		"transactionHash": "tx1",
+		"request": {
+			"headers": {"type": "SendTransaction", "signer": "user1", "ctx": {"token": "secret", "app": "a1"}},
+			"func": "CreateAsset",
+			"args": ["asset1", "blue", "{\"owner\":\"Tom\"}"],
+			"transientMap": "***"
+		}
+	}`, string(b))
+
+	b = WithRequestEcho(reply, []byte(echoTestRequest), []string{"transientMap.*", "args.1", "args.5", "headers.ctx.token", "func.name", ""})
+	assert.JSONEq(`{
+		"headers": {"requestId": "r1", "type": "TransactionSuccess"},
+		"transactionHash": "tx1",
+		"request": {
+			"headers": {"type": "SendTransaction", "signer": "user1", "ctx": {"token": "***", "app": "a1"}},
+			"func": "CreateAsset",
+			"args": ["asset1", "***", "{\"owner\":\"Tom\"}"],
+			"transientMap": {"price": "***"}
+		}
+	}`, string(b))
+
+	b = WithRequestEcho(reply, []byte(echoTestRequest), []string{"args.*"})
+	assert.Regexp(`"args":\["\*\*\*","\*\*\*","\*\*\*"\]`, string(b))
+	assert.Regexp(`"transientMap":\{"price":"MTAw"\}`, string(b))
+}
+
+func TestWithRequestEchoNotJSON(t *testing.T) {
+	assert := assert.New(t)
+	reply := []byte(`{"headers":{"requestId":"r1"}}`)
+	assert.Equal(reply, WithRequestEcho(reply, []byte(`!json`), nil))
+	assert.Equal([]byte(`!json`), WithRequestEcho([]byte(`!json`), []byte(echoTestRequest), nil))
+}
@@ -0,0 +1,263 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package receipt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/utils"
+	"github.com/hyperledger/firefly-fabconnect/internal/ws"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	RouteTypeKafka     = "kafka"
+	RouteTypeWebhook   = "webhook"
+	RouteTypeWebsocket = "websocket"
+
+	defaultRouteTimeout = 30 * 1000
+)
+
+// receiptProducer is the subset of the sarama sync producer used to send receipts to Kafka
+type receiptProducer interface {
+	SendMessage(msg *sarama.ProducerMessage) (partition int32, offset int64, err error)
+	Close() error
+}
+
+// defined to allow mocking in tests
+var newReceiptProducer = func(brokers []string, config *sarama.Config) (receiptProducer, error) {
+	return sarama.NewSyncProducer(brokers, config)
+}
+
+type receiptRoute struct {
+	index       int
+	match       map[string]*regexp.Regexp
+	routeType   string
+	destination *template.Template
+	timeout     time.Duration
+}
+
+// receiptRouter sends each receipt to the destination of the first route its headers match
+type receiptRouter struct {
+	routes    []*receiptRoute
+	kafkaConf *conf.KafkaConf
+	ws        ws.WebSocketChannels
+	client    *http.Client
+	mux       sync.Mutex
+	producer  receiptProducer // connected on the first receipt routed to Kafka, and again after a failure
+}
+
+func newReceiptRouter(routes []conf.ReceiptRouteConf, kafkaConf *conf.KafkaConf) (*receiptRouter, error) {
+	rr := &receiptRouter{
+		kafkaConf: kafkaConf,
+		client:    &http.Client{},
+	}
+	for i, routeConf := range routes {
+		route := &receiptRoute{
+			index:     i,
+			match:     make(map[string]*regexp.Regexp, len(routeConf.Match)),
+			routeType: strings.ToLower(routeConf.Type),
+			timeout:   time.Duration(routeConf.TimeoutMS) * time.Millisecond,
+		}
+		switch route.routeType {
+		case RouteTypeKafka:
+			if len(kafkaConf.Brokers) == 0 || kafkaConf.Brokers[0] == "" {
+				return nil, errors.Errorf(errors.ReceiptRouteNoKafkaBrokers, i)
+			}
+		case RouteTypeWebhook, RouteTypeWebsocket:
+		default:
+			return nil, errors.Errorf(errors.ReceiptRouteInvalidType, routeConf.Type, i)
+		}
+		if routeConf.Destination == "" {
+			return nil, errors.Errorf(errors.ReceiptRouteNoDestination, i)
+		}
+		var err error
+		if route.destination, err = template.New(fmt.Sprintf("route%d", i)).Option("missingkey=error").Parse(routeConf.Destination); err != nil {
+			return nil, errors.Errorf(errors.ReceiptRouteInvalidDestination, i, err)
+		}
+		for header, expr := range routeConf.Match {
+			if route.match[header], err = regexp.Compile(expr); err != nil {
+				return nil, errors.Errorf(errors.ReceiptRouteInvalidMatch, header, i, err)
+			}
+		}
+		if route.timeout <= 0 {
+			route.timeout = defaultRouteTimeout * time.Millisecond
+		}
+		rr.routes = append(rr.routes, route)
+	}
+	return rr, nil
+}
+
+// headerValue returns the value of a header as a string, where ctx.<key> is a value of the context
+func headerValue(headers map[string]interface{}, name string) string {
+	if key, isCtx := strings.CutPrefix(name, "ctx."); isCtx {
+		ctx, _ := headers["ctx"].(map[string]interface{})
+		return utils.GetMapString(ctx, key)
+	}
+	return utils.GetMapString(headers, name)
+}
+
+func (route *receiptRoute) matches(headers map[string]interface{}) bool {
+	for header, re := range route.match {
+		if !re.MatchString(headerValue(headers, header)) {
+			return false
+		}
+	}
+	return true
+}
+
+// route sends the receipt to the destination of the first route its headers match, returning
+// false when no route matches, or the destination cannot be built from the headers
+func (rr *receiptRouter) route(requestID string, headers map[string]interface{}, receipt map[string]interface{}) bool {
+	for _, route := range rr.routes {
+		if !route.matches(headers) {
+			continue
+		}
+		var destination bytes.Buffer
+		if err := route.destination.Execute(&destination, headers); err != nil {
+			log.Errorf("%s: Failed to build the destination of receipts.routes[%d]: %s", requestID, route.index, err)
+			return false
+		}
+		if err := rr.send(route, destination.String(), requestID, receipt); err != nil {
+			// the receipt is in the receipt store, for the application to query
+			log.Errorf("%s: Failed to send receipt to %s %s: %s", requestID, route.routeType, destination.String(), err)
+		} else {
+			log.Infof("%s: Sent receipt to %s %s", requestID, route.routeType, destination.String())
+		}
+		return true
+	}
+	return false
+}
+
+func (rr *receiptRouter) send(route *receiptRoute, destination, requestID string, receipt map[string]interface{}) error {
+	switch route.routeType {
+	case RouteTypeWebsocket:
+		_, broadcast, _, _ := rr.ws.GetChannels(destination)
+		broadcast <- receipt
+		return nil
+	case RouteTypeWebhook:
+		return rr.sendWebhook(route, destination, receipt)
+	default:
+		return rr.sendKafka(route, destination, requestID, receipt)
+	}
+}
+
+func (rr *receiptRouter) sendWebhook(route *receiptRoute, url string, receipt map[string]interface{}) error {
+	b, err := json.Marshal(receipt)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), route.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := rr.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.Errorf(errors.ReceiptRouteWebhookFailed, url, res.StatusCode)
+	}
+	return nil
+}
+
+func (rr *receiptRouter) producerConfig(timeout time.Duration) (*sarama.Config, error) {
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	config.Producer.RequiredAcks = sarama.WaitForLocal
+	config.Producer.Timeout = timeout
+	config.Net.DialTimeout = timeout
+	config.Net.ReadTimeout = timeout
+	config.Net.WriteTimeout = timeout
+	config.Version = sarama.V2_0_0_0
+	config.ClientID = rr.kafkaConf.ClientID
+	if config.ClientID == "" {
+		config.ClientID = utils.UUIDv4()
+	}
+	if rr.kafkaConf.SASL.Username != "" && rr.kafkaConf.SASL.Password != "" {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User = rr.kafkaConf.SASL.Username
+		config.Net.SASL.Password = rr.kafkaConf.SASL.Password
+	}
+	tlsConfig, err := utils.CreateTLSConfiguration(&rr.kafkaConf.TLS)
+	if err != nil {
+		return nil, err
+	}
+	config.Net.TLS.Enable = tlsConfig != nil
+	config.Net.TLS.Config = tlsConfig
+	return config, nil
+}
+
+func (rr *receiptRouter) sendKafka(route *receiptRoute, topic, requestID string, receipt map[string]interface{}) error {
+	b, err := json.Marshal(receipt)
+	if err != nil {
+		return err
+	}
+	rr.mux.Lock()
+	defer rr.mux.Unlock()
+	if rr.producer == nil {
+		config, err := rr.producerConfig(route.timeout)
+		if err != nil {
+			return err
+		}
+		if rr.producer, err = newReceiptProducer(rr.kafkaConf.Brokers, config); err != nil {
+			rr.producer = nil
+			return err
+		}
+	}
+	_, _, err = rr.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: topic,
+		Key:   sarama.StringEncoder(requestID),
+		Value: sarama.ByteEncoder(b),
+	})
+	if err != nil {
+		rr.closeProducer()
+	}
+	return err
+}
+
+func (rr *receiptRouter) closeProducer() {
+	if rr.producer != nil {
+		if err := rr.producer.Close(); err != nil {
+			log.Debugf("Failed to close the Kafka producer of receipt routes: %s", err)
+		}
+		rr.producer = nil
+	}
+}
+
+func (rr *receiptRouter) close() {
+	rr.mux.Lock()
+	defer rr.mux.Unlock()
+	rr.closeProducer()
+}
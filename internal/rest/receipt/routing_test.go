@@ -0,0 +1,227 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package receipt
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/messages"
+	"github.com/hyperledger/firefly-fabconnect/internal/utils"
+	mockws "github.com/hyperledger/firefly-fabconnect/mocks/ws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockReceiptProducer struct {
+	sent    []*sarama.ProducerMessage
+	sendErr error
+	closed  bool
+}
+
+func (m *mockReceiptProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	if m.sendErr != nil {
+		return 0, 0, m.sendErr
+	}
+	m.sent = append(m.sent, msg)
+	return 0, int64(len(m.sent)), nil
+}
+
+func (m *mockReceiptProducer) Close() error {
+	m.closed = true
+	return nil
+}
+
+func mockReceiptProducers(t *testing.T, producers ...*mockReceiptProducer) *[][]string {
+	var brokers [][]string
+	saved := newReceiptProducer
+	newReceiptProducer = func(b []string, config *sarama.Config) (receiptProducer, error) {
+		if len(producers) == 0 {
+			return nil, fmt.Errorf("pop")
+		}
+		brokers = append(brokers, b)
+		p := producers[0]
+		producers = producers[1:]
+		return p, nil
+	}
+	t.Cleanup(func() { newReceiptProducer = saved })
+	return &brokers
+}
+
+func newRoutedTestStore(t *testing.T, routes ...conf.ReceiptRouteConf) (*receiptStore, *mockws.WebSocketChannels) {
+	r, _ := newReceiptsTestStore()
+	r.config.Routes = routes
+	r.kafkaConf.Brokers = []string{"broker1:9092"}
+	assert.NoError(t, r.ValidateConf())
+	ws := &mockws.WebSocketChannels{}
+	ws.On("SendReply", mock.Anything).Return()
+	r.ws = ws
+	r.router.ws = ws
+	return r, ws
+}
+
+func testRoutedReceipt(channel, app string) []byte {
+	replyMsg := &messages.TransactionReceipt{}
+	replyMsg.Headers.MsgType = messages.MsgTypeTransactionSuccess
+	replyMsg.Headers.ID = utils.UUIDv4()
+	replyMsg.Headers.ReqID = utils.UUIDv4()
+	replyMsg.Headers.ChannelID = channel
+	replyMsg.Headers.ChaincodeName = "asset_transfer"
+	if app != "" {
+		replyMsg.Headers.Context = map[string]interface{}{"app": app}
+	}
+	replyMsg.TransactionHash = "9c842ffd430a56a5338f353a7b5b5052b4ac604564d82318af9329b4bf46dd89"
+	b, _ := json.Marshal(&replyMsg)
+	return b
+}
+
+func TestReceiptRoutesValidation(t *testing.T) {
+	assert := assert.New(t)
+	kafkaConf := &conf.KafkaConf{}
+
+	_, err := newReceiptRouter([]conf.ReceiptRouteConf{{Type: "amqp", Destination: "receipts"}}, kafkaConf)
+	assert.Regexp("Invalid type 'amqp' for receipts.routes\\[0\\]", err)
+	_, err = newReceiptRouter([]conf.ReceiptRouteConf{{Type: "websocket"}}, kafkaConf)
+	assert.Regexp("Must specify a destination for receipts.routes\\[0\\]", err)
+	_, err = newReceiptRouter([]conf.ReceiptRouteConf{{Type: "webhook", Destination: "http://app/{{.channel"}}, kafkaConf)
+	assert.Regexp("Invalid destination template for receipts.routes\\[0\\]", err)
+	_, err = newReceiptRouter([]conf.ReceiptRouteConf{{Type: "websocket", Destination: "receipts"}, {Type: "websocket", Destination: "receipts", Match: map[string]string{"channel": "["}}}, kafkaConf)
+	assert.Regexp("Invalid regular expression for header 'channel' of receipts.routes\\[1\\]", err)
+	_, err = newReceiptRouter([]conf.ReceiptRouteConf{{Type: "kafka", Destination: "receipts"}}, kafkaConf)
+	assert.Regexp("receipts.routes\\[0\\] sends to Kafka, but no Kafka brokers are configured", err)
+
+	kafkaConf.Brokers = []string{"broker1:9092"}
+	rr, err := newReceiptRouter([]conf.ReceiptRouteConf{{Type: "Kafka", Destination: "receipts"}}, kafkaConf)
+	assert.NoError(err)
+	assert.Equal(RouteTypeKafka, rr.routes[0].routeType)
+	assert.Equal(int64(defaultRouteTimeout), rr.routes[0].timeout.Milliseconds())
+
+	r, _ := newReceiptsTestStore()
+	r.config.Routes = []conf.ReceiptRouteConf{{Type: "websocket"}}
+	assert.Regexp("Must specify a destination", r.ValidateConf())
+}
+
+func TestReceiptRoutesWebsocket(t *testing.T) {
+	assert := assert.New(t)
+	r, ws := newRoutedTestStore(t,
+		conf.ReceiptRouteConf{Type: "websocket", Destination: "receipts-{{.ctx.app}}", Match: map[string]string{"ctx.app": "^app[0-9]+$"}},
+	)
+	broadcast := make(chan interface{}, 1)
+	ws.On("GetChannels", "receipts-app1").Return(nil, (chan<- interface{})(broadcast), nil, nil)
+
+	r.ProcessReceipt(testRoutedReceipt("default-channel", "app1"))
+	receipt := (<-broadcast).(map[string]interface{})
+	assert.NotEmpty(receipt["_id"])
+	ws.AssertNotCalled(t, "SendReply", mock.Anything)
+
+	// receipts that match no route are sent to the replies
+	r.ProcessReceipt(testRoutedReceipt("default-channel", "other"))
+	r.ProcessReceipt(testRoutedReceipt("default-channel", ""))
+	ws.AssertNumberOfCalls(t, "SendReply", 2)
+}
+
+func TestReceiptRoutesWebhook(t *testing.T) {
+	assert := assert.New(t)
+	received := make(chan map[string]interface{}, 1)
+	status := 204
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Equal("/receipts/channel1", req.URL.Path)
+		assert.Equal("application/json", req.Header.Get("Content-Type"))
+		b, _ := io.ReadAll(req.Body)
+		var receipt map[string]interface{}
+		_ = json.Unmarshal(b, &receipt)
+		received <- receipt
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	r, ws := newRoutedTestStore(t,
+		conf.ReceiptRouteConf{Type: "webhook", Destination: server.URL + "/receipts/{{.channel}}", Match: map[string]string{"channel": "channel1", "chaincode": "asset"}},
+		conf.ReceiptRouteConf{Type: "webhook", Destination: server.URL + "/{{.missing}}"},
+	)
+	r.ethconnectCompat = true
+
+	// the route matches the channel, which the ethconnect shape drops from the headers
+	r.ProcessReceipt(testRoutedReceipt("channel1", ""))
+	receipt := <-received
+	headers := receipt["headers"].(map[string]interface{})
+	assert.Nil(headers["channel"])
+	assert.Equal("1", receipt["status"])
+
+	// a receipt the webhook fails is not sent to the replies, as it matched a route
+	status = 500
+	r.ProcessReceipt(testRoutedReceipt("channel1", ""))
+	<-received
+	ws.AssertNotCalled(t, "SendReply", mock.Anything)
+
+	// a destination that cannot be built from the headers falls back to the replies
+	r.ProcessReceipt(testRoutedReceipt("channel2", ""))
+	ws.AssertNumberOfCalls(t, "SendReply", 1)
+
+	err := r.router.sendWebhook(r.router.routes[0], "://bad", nil)
+	assert.Error(err)
+	err = r.router.sendWebhook(r.router.routes[0], "http://127.0.0.1:1", nil)
+	assert.Error(err)
+	err = r.router.sendWebhook(r.router.routes[0], server.URL+"/receipts/channel1", map[string]interface{}{"bad": map[bool]bool{}})
+	assert.Error(err)
+}
+
+func TestReceiptRoutesKafka(t *testing.T) {
+	assert := assert.New(t)
+	failing := &mockReceiptProducer{sendErr: fmt.Errorf("pop")}
+	working := &mockReceiptProducer{}
+	brokers := mockReceiptProducers(t, failing, working)
+
+	r, ws := newRoutedTestStore(t,
+		conf.ReceiptRouteConf{Type: "kafka", Destination: "receipts-{{.chaincode}}", Match: map[string]string{"type": "TransactionSuccess"}},
+	)
+
+	// a failed send disconnects the producer, and the next receipt reconnects
+	r.ProcessReceipt(testRoutedReceipt("channel1", ""))
+	assert.True(failing.closed)
+	assert.Nil(r.router.producer)
+
+	b := testRoutedReceipt("channel1", "")
+	r.ProcessReceipt(b)
+	assert.Equal(2, len(*brokers))
+	assert.Equal([]string{"broker1:9092"}, (*brokers)[1])
+	assert.Equal(1, len(working.sent))
+	msg := working.sent[0]
+	assert.Equal("receipts-asset_transfer", msg.Topic)
+	var parsed map[string]interface{}
+	_ = json.Unmarshal(b, &parsed)
+	assert.Equal(sarama.StringEncoder(parsed["headers"].(map[string]interface{})["requestId"].(string)), msg.Key)
+	ws.AssertNotCalled(t, "SendReply", mock.Anything)
+
+	r.Close()
+	assert.True(working.closed)
+
+	// a producer that cannot be created is retried for the next receipt
+	r.ProcessReceipt(testRoutedReceipt("channel1", ""))
+	assert.Nil(r.router.producer)
+	r.kafkaConf.TLS.Enabled = true
+	r.kafkaConf.TLS.CACertsFile = "/does/not/exist.pem"
+	r.ProcessReceipt(testRoutedReceipt("channel1", ""))
+	assert.Nil(r.router.producer)
+	ws.AssertNotCalled(t, "SendReply", mock.Anything)
+}
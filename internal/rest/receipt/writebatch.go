@@ -0,0 +1,171 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package receipt
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/metrics"
+	"github.com/hyperledger/firefly-fabconnect/internal/rest/receipt/api"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultWriteBatchMaxSize       = 100
+	defaultWriteBatchFlushInterval = 50
+	defaultWriteBatchQueueDepth    = 10000
+)
+
+type queuedReceipt struct {
+	requestID string
+	headers   map[string]interface{}
+	receipt   map[string]interface{}
+}
+
+// receiptWriter queues receipts for the routine that writes them to the store in batches
+type receiptWriter struct {
+	queue         chan *queuedReceipt
+	done          chan struct{}
+	maxSize       int
+	flushInterval time.Duration
+	mux           sync.RWMutex
+	closed        bool
+	written       uint64
+	batches       uint64
+}
+
+func setWriteBatchDefaults(config *conf.ReceiptsWriteBatchConf) {
+	if config.MaxSize <= 0 {
+		config.MaxSize = defaultWriteBatchMaxSize
+	}
+	if config.FlushIntervalMS <= 0 {
+		config.FlushIntervalMS = defaultWriteBatchFlushInterval
+	}
+	if config.QueueDepth <= 0 {
+		config.QueueDepth = defaultWriteBatchQueueDepth
+	}
+}
+
+func newReceiptWriter(config *conf.ReceiptsWriteBatchConf) *receiptWriter {
+	return &receiptWriter{
+		queue:         make(chan *queuedReceipt, config.QueueDepth),
+		done:          make(chan struct{}),
+		maxSize:       config.MaxSize,
+		flushInterval: time.Duration(config.FlushIntervalMS) * time.Millisecond,
+	}
+}
+
+// enqueue adds a receipt to the queue, waiting for space when the queue is full. It returns
+// false once the writer is closed, for the receipt to be written by the caller
+func (w *receiptWriter) enqueue(q *queuedReceipt) bool {
+	w.mux.RLock()
+	defer w.mux.RUnlock()
+	if w.closed {
+		return false
+	}
+	w.queue <- q
+	return true
+}
+
+// nextBatch waits for a receipt, then collects those that follow it until the batch is full or
+// the flush interval has passed. It returns nil when the writer is closed and the queue is empty
+func (w *receiptWriter) nextBatch() []*queuedReceipt {
+	first, ok := <-w.queue
+	if !ok {
+		return nil
+	}
+	batch := []*queuedReceipt{first}
+	timer := time.NewTimer(w.flushInterval)
+	defer timer.Stop()
+	for len(batch) < w.maxSize {
+		select {
+		case q, ok := <-w.queue:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, q)
+		case <-timer.C:
+			return batch
+		}
+	}
+	return batch
+}
+
+// close stops accepting receipts, and waits for those queued to be written
+func (w *receiptWriter) close() {
+	w.mux.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mux.Unlock()
+	<-w.done
+}
+
+func (r *receiptStore) writeBatches() {
+	defer close(r.writer.done)
+	for batch := r.writer.nextBatch(); batch != nil; batch = r.writer.nextBatch() {
+		r.writeBatch(batch)
+	}
+}
+
+// writeBatch writes the batch in a single commit, when the persistence layer supports it, then
+// delivers the receipts. A batch that fails is written a receipt at a time, so the retry of each
+// write and the detection of duplicates is the same as for receipts that are not batched
+func (r *receiptStore) writeBatch(batch []*queuedReceipt) {
+	batchPersistence, ok := r.persistence.(api.ReceiptStoreBatchPersistence)
+	if ok {
+		requestIDs := make([]string, len(batch))
+		receipts := make([]*map[string]interface{}, len(batch))
+		for i, q := range batch {
+			requestIDs[i] = q.requestID
+			receipts[i] = &q.receipt
+		}
+		err := batchPersistence.AddReceipts(requestIDs, receipts)
+		if err == nil {
+			log.Infof("Inserted %d receipts into receipt store", len(batch))
+		} else {
+			log.Errorf("Failed to insert %d receipts into receipt store, inserting each: %s", len(batch), err)
+			ok = false
+		}
+	}
+	if !ok {
+		for _, q := range batch {
+			r.persistReceipt(q.requestID, q.receipt)
+		}
+	}
+	atomic.AddUint64(&r.writer.written, uint64(len(batch)))
+	atomic.AddUint64(&r.writer.batches, 1)
+	for _, q := range batch {
+		r.deliverReceipt(q.requestID, q.headers, q.receipt)
+	}
+}
+
+// Metrics reports the receipts waiting to be written, when writes are batched
+func (r *receiptStore) Metrics() []metrics.Metric {
+	if r.writer == nil {
+		return nil
+	}
+	return []metrics.Metric{
+		{Name: "receipts.queue.depth", Kind: metrics.Gauge, Value: float64(len(r.writer.queue))},
+		{Name: "receipts.written", Kind: metrics.Counter, Value: float64(atomic.LoadUint64(&r.writer.written))},
+		{Name: "receipts.batches", Kind: metrics.Counter, Value: float64(atomic.LoadUint64(&r.writer.batches))},
+	}
+}
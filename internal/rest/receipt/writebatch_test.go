@@ -0,0 +1,160 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package receipt
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/metrics"
+	"github.com/hyperledger/firefly-fabconnect/internal/rest/test"
+	mockws "github.com/hyperledger/firefly-fabconnect/mocks/ws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// batchMemoryReceipts adds batch writes to the memory store, recording the size of each batch
+type batchMemoryReceipts struct {
+	*memoryReceipts
+	batches  []int
+	batchErr error
+}
+
+func (b *batchMemoryReceipts) AddReceipts(requestIDs []string, receipts []*map[string]interface{}) error {
+	b.batches = append(b.batches, len(requestIDs))
+	if b.batchErr != nil {
+		return b.batchErr
+	}
+	for i, requestID := range requestIDs {
+		_ = b.AddReceipt(requestID, receipts[i])
+	}
+	return nil
+}
+
+func newBatchTestStore(t *testing.T, maxSize, flushIntervalMS int) (*receiptStore, *batchMemoryReceipts, chan interface{}) {
+	_, testConfig := test.Setup()
+	testConfig.Receipts.LevelDB.Path = ""
+	testConfig.Receipts.WriteBatch.Enabled = true
+	testConfig.Receipts.WriteBatch.MaxSize = maxSize
+	testConfig.Receipts.WriteBatch.FlushIntervalMS = flushIntervalMS
+	r := NewReceiptStore(testConfig).(*receiptStore)
+	p := &batchMemoryReceipts{memoryReceipts: newMemoryReceipts(&testConfig.Receipts)}
+	replies := make(chan interface{}, 100)
+	ws := &mockws.WebSocketChannels{}
+	ws.On("SendReply", mock.Anything).Run(func(args mock.Arguments) {
+		replies <- args[0]
+	}).Return()
+	err := r.Init(ws, p)
+	assert.NoError(t, err)
+	return r, p, replies
+}
+
+func metricValue(m []metrics.Metric, name string) float64 {
+	for _, metric := range m {
+		if metric.Name == name {
+			return metric.Value
+		}
+	}
+	return -1
+}
+
+func TestWriteBatchDefaults(t *testing.T) {
+	assert := assert.New(t)
+	_, testConfig := test.Setup()
+	testConfig.Receipts.WriteBatch.Enabled = true
+	r := NewReceiptStore(testConfig).(*receiptStore)
+	assert.Equal(defaultWriteBatchMaxSize, r.config.WriteBatch.MaxSize)
+	assert.Equal(defaultWriteBatchFlushInterval, r.config.WriteBatch.FlushIntervalMS)
+	assert.Equal(defaultWriteBatchQueueDepth, r.config.WriteBatch.QueueDepth)
+
+	r, _ = newReceiptsTestStore()
+	assert.Nil(r.Metrics())
+}
+
+func TestWriteBatchGroupCommit(t *testing.T) {
+	assert := assert.New(t)
+	r, p, replies := newBatchTestStore(t, 3, 60000)
+
+	for i := 0; i < 7; i++ {
+		r.ProcessReceipt(testRoutedReceipt(fmt.Sprintf("channel%d", i), ""))
+	}
+	// full batches are written without waiting for the flush interval
+	for i := 0; i < 6; i++ {
+		<-replies
+	}
+	assert.Equal([]int{3, 3}, p.batches)
+
+	// the last receipt is written when the store is closed
+	r.Close()
+	<-replies
+	assert.Equal([]int{3, 3, 1}, p.batches)
+	assert.Equal(7, p.receipts.Len())
+	m := r.Metrics()
+	assert.Equal(float64(0), metricValue(m, "receipts.queue.depth"))
+	assert.Equal(float64(7), metricValue(m, "receipts.written"))
+	assert.Equal(float64(3), metricValue(m, "receipts.batches"))
+
+	// receipts after the store is closed are written directly
+	r.ProcessReceipt(testRoutedReceipt("channel1", ""))
+	<-replies
+	assert.Equal(8, p.receipts.Len())
+	assert.Equal(3, len(p.batches))
+}
+
+func TestWriteBatchFlushInterval(t *testing.T) {
+	assert := assert.New(t)
+	r, p, replies := newBatchTestStore(t, 100, 10)
+	defer r.Close()
+
+	r.ProcessReceipt(testRoutedReceipt("channel1", ""))
+	r.ProcessReceipt(testRoutedReceipt("channel1", ""))
+	<-replies
+	<-replies
+	assert.Equal(2, p.receipts.Len())
+	assert.NotEmpty(p.batches)
+}
+
+func TestWriteBatchFailureWritesEach(t *testing.T) {
+	assert := assert.New(t)
+	r, p, replies := newBatchTestStore(t, 2, 60000)
+	p.batchErr = fmt.Errorf("pop")
+
+	r.ProcessReceipt(testRoutedReceipt("channel1", ""))
+	r.ProcessReceipt(testRoutedReceipt("channel2", ""))
+	<-replies
+	<-replies
+	assert.Equal([]int{2}, p.batches)
+	assert.Equal(2, p.receipts.Len())
+	r.Close()
+}
+
+func TestWriteBatchWithoutBatchPersistence(t *testing.T) {
+	assert := assert.New(t)
+	_, testConfig := test.Setup()
+	testConfig.Receipts.WriteBatch.Enabled = true
+	testConfig.Receipts.WriteBatch.FlushIntervalMS = 1
+	r := NewReceiptStore(testConfig).(*receiptStore)
+	p := newMemoryReceipts(&testConfig.Receipts)
+	err := r.Init(nil, p)
+	assert.NoError(err)
+
+	r.ProcessReceipt(testRoutedReceipt("channel1", ""))
+	r.ProcessReceipt(testRoutedReceipt("channel2", ""))
+	r.Close()
+	assert.Equal(2, p.receipts.Len())
+	assert.Equal(float64(2), metricValue(r.Metrics(), "receipts.written"))
+}
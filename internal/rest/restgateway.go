@@ -22,6 +22,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sort"
 	"sync"
 	"syscall"
 	"time"
@@ -30,10 +31,13 @@ import (
 	"github.com/hyperledger/firefly-fabconnect/internal/errors"
 	"github.com/hyperledger/firefly-fabconnect/internal/events"
 	"github.com/hyperledger/firefly-fabconnect/internal/fabric/client"
+	"github.com/hyperledger/firefly-fabconnect/internal/metrics"
+	"github.com/hyperledger/firefly-fabconnect/internal/ordereradmin"
 	restasync "github.com/hyperledger/firefly-fabconnect/internal/rest/async"
 	"github.com/hyperledger/firefly-fabconnect/internal/rest/receipt"
 	restsync "github.com/hyperledger/firefly-fabconnect/internal/rest/sync"
 	"github.com/hyperledger/firefly-fabconnect/internal/tx"
+	"github.com/hyperledger/firefly-fabconnect/internal/usage"
 	"github.com/hyperledger/firefly-fabconnect/internal/utils"
 	"github.com/hyperledger/firefly-fabconnect/internal/ws"
 
@@ -52,11 +56,18 @@ type Gateway struct {
 	receiptStore    receipt.Store
 	syncDispatcher  restsync.Dispatcher
 	asyncDispatcher restasync.Dispatcher
+	kafkaBridge     restasync.KafkaBridge
 	sm              events.SubscriptionManager
 	ws              ws.WebSocketServer
+	systemEvents    *ws.SystemEventPublisher
 	rpc             client.RPCClient
+	metrics         *metrics.Pusher
+	usage           *usage.Tracker
+	usageExporter   *usage.Exporter
 	router          *router
+	networks        []*network
 	srv             *http.Server
+	adminSrv        *http.Server
 	sendCond        *sync.Cond
 	pendingMsgs     map[string]bool
 	successMsgs     map[string]interface{}
@@ -64,7 +75,9 @@ type Gateway struct {
 }
 
 type statusMsg struct {
-	OK bool `json:"ok"`
+	OK            bool                    `json:"ok"`
+	BlockCache    *client.BlockCacheStats `json:"blockCache,omitempty"`
+	CommitLatency *tx.CommitLatencyStats  `json:"commitLatency,omitempty"`
 }
 
 // NewRESTGateway constructor
@@ -82,12 +95,28 @@ func NewRESTGateway(config *conf.RESTGatewayConf) *Gateway {
 }
 
 func (g *Gateway) Init() error {
-	g.syncDispatcher = restsync.NewDispatcher(g.processor)
+	if err := utils.ConfigureIDs(g.config.IDs.Prefix, g.config.IDs.Format); err != nil {
+		return err
+	}
+	resultDecoders, err := utils.NewResultDecoders(g.config.ResultDecoders)
+	if err != nil {
+		return err
+	}
+	if processor, ok := g.processor.(tx.ResultDecodingProcessor); ok {
+		processor.SetResultDecoders(resultDecoders)
+	}
+	g.syncDispatcher = restsync.NewDispatcher(g.config, g.processor, resultDecoders)
 	g.asyncDispatcher = restasync.NewAsyncDispatcher(g.config, g.processor, g.receiptStore)
-	err := g.asyncDispatcher.ValidateConf()
+	err = g.asyncDispatcher.ValidateConf()
 	if err != nil {
 		return err
 	}
+	if len(g.config.KafkaBridge.Brokers) > 0 {
+		g.kafkaBridge = restasync.NewKafkaBridge(g.config.KafkaBridge, g.processor)
+		if err = g.kafkaBridge.ValidateConf(); err != nil {
+			return err
+		}
+	}
 
 	rpcClient, identityClient, err := client.RPCConnect(g.config.RPC, g.config.MaxTXWaitTime)
 	if err != nil {
@@ -95,41 +124,146 @@ func (g *Gateway) Init() error {
 	}
 	g.rpc = rpcClient
 	g.processor.Init(rpcClient)
+	if processor, ok := g.processor.(tx.QuotaProcessor); ok {
+		if idClient, ok := identityClient.(client.IdentityClient); ok {
+			processor.SetIdentityClient(idClient)
+		}
+	}
 
-	ws := ws.NewWebSocketServer()
-	g.ws = ws
+	g.ws = ws.NewWebSocketServer()
+	if notifier, ok := rpcClient.(client.ChannelConfigNotifier); ok {
+		g.systemEvents = ws.NewSystemEventPublisher(g.ws)
+		notifier.AddChannelConfigListener(&systemEvents{publisher: g.systemEvents})
+	}
 
-	err = g.receiptStore.Init(ws)
+	err = g.receiptStore.Init(g.ws)
 	if err != nil {
 		return err
 	}
 
 	if g.config.Events.LevelDB.Path != "" {
-		g.sm = events.NewSubscriptionManager(&g.config.Events, rpcClient, ws)
+		g.sm = events.NewSubscriptionManager(&g.config.Events, rpcClient, g.ws)
 		err = g.sm.Init()
 		if err != nil {
 			return errors.Errorf(errors.RESTGatewayEventManagerInitFailed, err)
 		}
+		if processor, ok := g.processor.(tx.OutboxProcessor); ok {
+			if deliverer, ok := g.sm.(tx.EventDeliverer); ok {
+				processor.SetEventDeliverer(deliverer)
+			}
+		}
 	}
 
-	g.router = newRouter(g.syncDispatcher, g.asyncDispatcher, identityClient, g.sm, ws)
+	if err := g.startMetrics(); err != nil {
+		return err
+	}
+	if err := g.startUsage(); err != nil {
+		return err
+	}
+
+	g.router = newRouter(g.syncDispatcher, g.asyncDispatcher, identityClient, rpcClient, g.sm, g.ws)
+	g.router.headerPassthrough = &g.config.HTTP.HeaderPassthrough
+	if provider, ok := g.processor.(tx.CommitLatencyStatsProvider); ok {
+		g.router.commitLatency = provider
+	}
+	g.router.usage = g.usage
+	if processor, ok := g.processor.(tx.QuotaProcessor); ok {
+		g.router.quotas = processor
+	}
+	if len(g.config.OrdererAdmin.Orderers) > 0 {
+		if g.router.ordererAdmin, err = ordereradmin.NewProxy(&g.config.OrdererAdmin); err != nil {
+			return err
+		}
+	}
+	if g.router.consumerTokens, err = newConsumerTokenIssuer(&g.config.HTTP.ConsumerTokens); err != nil {
+		return err
+	}
+	g.ws.SetAuthenticator(g.router.authenticateToken)
+	if g.router.identitySync, err = newIdentitySync(&g.config.IdentitySync); err != nil {
+		return err
+	}
+	g.router.subsystems, g.router.asyncSubsystem = g.newSubsystems()
+	if g.config.HTTP.Admin.Port != 0 {
+		g.router.useAdminListener()
+	}
 	g.router.addRoutes()
+	if !g.config.HTTP.DisableUI {
+		g.router.addUIRoutes()
+	}
+	return g.initNetworks(resultDecoders)
+}
 
+// initNetworks connects to the networks served under /networks/:network
+func (g *Gateway) initNetworks(resultDecoders *utils.ResultDecoders) error {
+	if len(g.config.Networks) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(g.config.Networks))
+	for name := range g.config.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	routers := make(map[string]*router, len(g.config.Networks))
+	for _, name := range names {
+		networkConfig := g.config.Networks[name]
+		n, err := newNetwork(name, networkConf(g.config, &networkConfig), resultDecoders, g.router)
+		if err != nil {
+			// the networks that did initialize are closed, as the gateway does not start
+			for _, n := range g.networks {
+				n.close()
+			}
+			g.networks = nil
+			return errors.Errorf(errors.RESTGatewayNetworkInitFailed, name, err)
+		}
+		g.networks = append(g.networks, n)
+		routers[name] = n.router
+	}
+	g.router.addNetworkRoutes(routers)
 	return nil
 }
 
+// newSubsystems registers the parts of the gateway that can be stopped and started through the
+// admin API, returning the name of the one async transactions are dispatched through
+func (g *Gateway) newSubsystems() (*subsystems, string) {
+	s := newSubsystems()
+	if g.sm != nil {
+		s.add(subsystemEvents, g.sm.Close, func() error { return g.sm.Init() })
+	}
+	// closing the connections is all there is to stop, as new ones are refused until it is started
+	s.add(subsystemWebSocket, g.ws.Close, func() error { return nil })
+	asyncSubsystem := subsystemRESTAsync
+	if len(g.config.Kafka.Brokers) > 0 {
+		asyncSubsystem = subsystemKafka
+	}
+	if dispatcher, ok := g.asyncDispatcher.(restasync.StoppableDispatcher); ok {
+		s.add(asyncSubsystem, dispatcher.Stop, dispatcher.Resume)
+	}
+	return s, asyncSubsystem
+}
+
 func (g *Gateway) ValidateConf() error {
 	// HTTP and RPC configurations are mandatory
-	if g.config.HTTP.Port == 0 {
+	if g.config.HTTP.Port == 0 && g.config.HTTP.UnixSocket == "" {
 		return errors.Errorf(errors.ConfigRESTGatewayRequiredHTTPPort)
 	}
 	if g.config.RPC.ConfigPath == "" {
 		return errors.Errorf(errors.ConfigRESTGatewayRequiredRPCPath)
 	}
+	if err := validateNetworks(g.config); err != nil {
+		return err
+	}
 	if g.config.HTTP.LocalAddr == "" {
 		g.config.HTTP.LocalAddr = "0.0.0.0"
 	}
-	return nil
+	if g.config.HTTP.Admin.Port != 0 {
+		if g.config.HTTP.Admin.LocalAddr == "" {
+			g.config.HTTP.Admin.LocalAddr = g.config.HTTP.LocalAddr
+		}
+		if g.config.HTTP.Admin.Port == g.config.HTTP.Port && g.config.HTTP.Admin.LocalAddr == g.config.HTTP.LocalAddr {
+			return errors.Errorf(errors.ConfigRESTGatewayAdminPortConflict)
+		}
+	}
+	return validateClientCertSigners(&g.config.HTTP)
 }
 
 // Start kicks off the HTTP listener and router
@@ -138,35 +272,75 @@ func (g *Gateway) Start() error {
 	if err != nil {
 		return err
 	}
-	// TODO: Fix linting: G112: Potential Slowloris Attack because ReadHeaderTimeout is not configured in the http.Server
-	// #nosec
+	timeouts := newServerTimeouts(&g.config.HTTP)
 	g.srv = &http.Server{
-		Addr:           fmt.Sprintf("%s:%d", g.config.HTTP.LocalAddr, g.config.HTTP.Port),
-		TLSConfig:      tlsConfig,
-		Handler:        g.router.newAccessTokenContextHandler(),
-		MaxHeaderBytes: MaxHeaderSize,
+		Addr:              fmt.Sprintf("%s:%d", g.config.HTTP.LocalAddr, g.config.HTTP.Port),
+		TLSConfig:         tlsConfig,
+		Handler:           g.newRouteTimeoutHandler(timeouts, newClientCertSignerHandler(g.config.HTTP.ClientCertSigners, g.router.newAccessTokenContextHandler(g.router.httpRouter))),
+		MaxHeaderBytes:    MaxHeaderSize,
+		ReadHeaderTimeout: timeouts.readHeader,
+		ReadTimeout:       timeouts.read,
+		WriteTimeout:      timeouts.write,
+		IdleTimeout:       timeouts.idle,
+	}
+	if g.config.HTTP.Admin.Port != 0 {
+		adminTLSConfig, err := utils.CreateTLSConfiguration(&g.config.HTTP.Admin.TLS)
+		if err != nil {
+			return err
+		}
+		g.adminSrv = &http.Server{
+			Addr:              fmt.Sprintf("%s:%d", g.config.HTTP.Admin.LocalAddr, g.config.HTTP.Admin.Port),
+			TLSConfig:         adminTLSConfig,
+			Handler:           g.router.newAccessTokenContextHandler(g.router.adminRouter),
+			MaxHeaderBytes:    MaxHeaderSize,
+			ReadHeaderTimeout: timeouts.readHeader,
+			ReadTimeout:       timeouts.read,
+			WriteTimeout:      timeouts.write,
+			IdleTimeout:       timeouts.idle,
+		}
 	}
 
 	readyToListen := make(chan bool)
-	gwDone := make(chan error)
-	svrDone := make(chan error)
+	gwDone := make(chan error, 1)
+	// buffered, so the listeners that did not end the gateway can finish after shutdown
+	svrDone := make(chan error, 3)
 
-	go func() {
-		<-readyToListen
-		log.Printf("HTTP server listening on %s", g.srv.Addr)
-		var err error
-		if tlsConfig != nil {
-			// Under the covers it will use g.srv.TLSConfig
-			// If the cert and key file are not present, it will use the CA from the TLSConfig
-			err = g.srv.ListenAndServeTLS(g.config.HTTP.TLS.ClientCertsFile, g.config.HTTP.TLS.ClientKeyFile)
-		} else {
-			err = g.srv.ListenAndServe()
-		}
-		if err != nil {
-			log.Errorf("Listening ended with: %s", err)
-		}
-		svrDone <- err
-	}()
+	if g.config.HTTP.Port != 0 {
+		go func() {
+			<-readyToListen
+			log.Printf("HTTP server listening on %s", g.srv.Addr)
+			err := serve(g.srv, &g.config.HTTP.TLS, g.config.HTTP.MaxConnections)
+			if err != nil {
+				log.Errorf("Listening ended with: %s", err)
+			}
+			svrDone <- err
+		}()
+	}
+	if g.config.HTTP.UnixSocket != "" {
+		go func() {
+			<-readyToListen
+			log.Printf("HTTP server listening on unix socket %s", g.config.HTTP.UnixSocket)
+			listener, err := listenUnix(g.config.HTTP.UnixSocket, g.config.HTTP.MaxConnections)
+			if err == nil {
+				err = g.srv.Serve(listener)
+			}
+			if err != nil {
+				log.Errorf("Listening on unix socket ended with: %s", err)
+			}
+			svrDone <- err
+		}()
+	}
+	if g.adminSrv != nil {
+		go func() {
+			<-readyToListen
+			log.Printf("Admin HTTP server listening on %s", g.adminSrv.Addr)
+			err := serve(g.adminSrv, &g.config.HTTP.Admin.TLS, 0)
+			if err != nil {
+				log.Errorf("Admin listening ended with: %s", err)
+			}
+			svrDone <- err
+		}()
+	}
 	go func() {
 		err := g.asyncDispatcher.Run()
 		if err != nil {
@@ -174,10 +348,30 @@ func (g *Gateway) Start() error {
 		}
 		gwDone <- err
 	}()
+	if g.kafkaBridge != nil {
+		go func() {
+			if err := g.kafkaBridge.Run(); err != nil {
+				log.Errorf("Kafka bridge ended with: %s", err)
+			}
+		}()
+	}
+	// the dispatcher of a network ending does not end the gateway, which serves the other networks
+	for _, n := range g.networks {
+		go func(n *network) {
+			if err := n.asyncDispatcher.Run(); err != nil {
+				log.Errorf("Async dispatcher of network %s ended with: %s", n.name, err)
+			}
+		}(n)
+	}
 	for !g.asyncDispatcher.IsInitialized() {
 		time.Sleep(250 * time.Millisecond)
 	}
-	readyToListen <- true
+	for _, n := range g.networks {
+		for !n.asyncDispatcher.IsInitialized() {
+			time.Sleep(250 * time.Millisecond)
+		}
+	}
+	close(readyToListen)
 
 	// Clean up on SIGINT
 	signals := make(chan os.Signal, 1)
@@ -197,16 +391,51 @@ func (g *Gateway) Start() error {
 	log.Infof("Shutting down HTTP server")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	_ = g.srv.Shutdown(ctx)
+	if g.adminSrv != nil {
+		_ = g.adminSrv.Shutdown(ctx)
+	}
 	defer cancel()
 
 	return err
 }
 
+// serve accepts connections for the server until it is shut down
+func serve(srv *http.Server, tlsConf *conf.TLSConfig, maxConnections int) error {
+	listener, err := listen(srv.Addr, maxConnections)
+	if err != nil {
+		return err
+	}
+	if srv.TLSConfig != nil {
+		// Under the covers it will use srv.TLSConfig
+		// If the cert and key file are not present, it will use the CA from the TLSConfig
+		return srv.ServeTLS(listener, tlsConf.ClientCertsFile, tlsConf.ClientKeyFile)
+	}
+	return srv.Serve(listener)
+}
+
 func (g *Gateway) Shutdown() {
+	if g.metrics != nil {
+		g.metrics.Close()
+	}
+	if g.usageExporter != nil {
+		g.usageExporter.Close()
+	}
 	if g.sm != nil {
 		g.sm.Close()
 	}
+	if g.kafkaBridge != nil {
+		g.kafkaBridge.Stop()
+	}
 	g.asyncDispatcher.Close()
+	if g.router != nil && g.router.identitySync != nil {
+		g.router.identitySync.Close()
+	}
 	g.rpc.Close()
+	for _, n := range g.networks {
+		n.close()
+	}
+	if g.systemEvents != nil {
+		g.systemEvents.Close()
+	}
 	g.ws.Close()
 }
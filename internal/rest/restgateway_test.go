@@ -18,6 +18,7 @@ package rest
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -30,14 +31,20 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang/protobuf/proto" //nolint
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/msp"
 	"github.com/hyperledger/firefly-fabconnect/internal/auth"
 	"github.com/hyperledger/firefly-fabconnect/internal/auth/authtest"
 	"github.com/hyperledger/firefly-fabconnect/internal/conf"
 	"github.com/hyperledger/firefly-fabconnect/internal/errors"
 	"github.com/hyperledger/firefly-fabconnect/internal/events"
+	"github.com/hyperledger/firefly-fabconnect/internal/fabric/client"
 	fabtest "github.com/hyperledger/firefly-fabconnect/internal/fabric/test"
+	"github.com/hyperledger/firefly-fabconnect/internal/ordereradmin"
 	"github.com/hyperledger/firefly-fabconnect/internal/rest/identity"
 	"github.com/hyperledger/firefly-fabconnect/internal/rest/test"
+	"github.com/hyperledger/firefly-fabconnect/internal/usage"
 	"github.com/hyperledger/firefly-fabconnect/internal/utils"
 	mockfabric "github.com/hyperledger/firefly-fabconnect/mocks/fabric/client"
 	mockkvstore "github.com/hyperledger/firefly-fabconnect/mocks/kvstore"
@@ -111,7 +118,7 @@ func newTestGateway(t *testing.T, mockDB ...bool) (*assert.Assertions, *Gateway,
 
 	testIdentityClient := &mockidentity.IdentityClient{}
 	if mockIdentity {
-		testRouter := newRouter(g.syncDispatcher, g.asyncDispatcher, testIdentityClient, g.sm, g.ws)
+		testRouter := newRouter(g.syncDispatcher, g.asyncDispatcher, testIdentityClient, testRPC, g.sm, g.ws)
 		testRouter.addRoutes()
 		g.router = testRouter
 	}
@@ -461,6 +468,343 @@ func TestQueryEndpoints(t *testing.T) {
 	assert.Equal(float64(123000), rr["AppraisedValue"])
 	assert.Equal("asset01", rr["ID"])
 
+	// the mock chain has a height of 10, so it has committed block 9 but not block 10
+	url, _ = url.Parse(fmt.Sprintf("http://localhost:%d/query?fly-channel=default-channel&fly-signer=user1&fly-chaincode=asset_transfer&fly-blocknumber=9", g.config.HTTP.Port))
+	req.URL = url
+	req.Body = io.NopCloser(bytes.NewReader([]byte("{\"func\":\"CreateAsset\",\"args\":[]}")))
+	resp, _ = http.DefaultClient.Do(req)
+	assert.Equal(200, resp.StatusCode)
+
+	url, _ = url.Parse(fmt.Sprintf("http://localhost:%d/query?fly-channel=default-channel&fly-signer=user1&fly-chaincode=asset_transfer&fly-blocknumber=10&fly-blocknumberTimeout=1", g.config.HTTP.Port))
+	req.URL = url
+	req.Body = io.NopCloser(bytes.NewReader([]byte("{\"func\":\"CreateAsset\",\"args\":[]}")))
+	start := time.Now()
+	resp, _ = http.DefaultClient.Do(req)
+	assert.Equal(504, resp.StatusCode)
+	assert.GreaterOrEqual(time.Since(start), time.Second)
+	bodyBytes, _ = io.ReadAll(resp.Body)
+	assert.Equal("{\"error\":\"Block 10 is not committed on channel default-channel. The height of the chain is 10\"}", string(bodyBytes))
+
+	g.srv.Close()
+	wg.Wait()
+	auth.RegisterSecurityModule(nil)
+}
+
+func TestQueryStreaming(t *testing.T) {
+	assert, g, wg, _, _, _ := newTestGateway(t)
+	header := http.Header{
+		"authorization": []string{"bearer testat"},
+	}
+	rpc := &mockfabric.RPCClient{}
+	rpc.On("Query", mock.Anything, "default-channel", "user1", "asset_transfer", "GetAllAssets", []string{}, false).Return([]byte("[\n  {\"ID\": \"asset01\"},\n  {\"ID\": \"asset02\"}\n]"), nil)
+	g.processor.Init(rpc)
+
+	query := func(format string) (int, string, string) {
+		url, _ := url.Parse(fmt.Sprintf("http://localhost:%d/query?fly-channel=default-channel&fly-signer=user1&fly-chaincode=asset_transfer&format=%s", g.config.HTTP.Port, format))
+		resp, err := http.DefaultClient.Do(&http.Request{
+			URL:    url,
+			Method: http.MethodPost,
+			Header: header,
+			Body:   io.NopCloser(bytes.NewReader([]byte(`{"func":"GetAllAssets","args":[]}`))),
+		})
+		assert.NoError(err)
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, resp.Header.Get("Content-Type"), string(bodyBytes)
+	}
+
+	status, contentType, body := query("ndjson")
+	assert.Equal(200, status)
+	assert.Equal("application/x-ndjson", contentType)
+	assert.Equal("{\"ID\":\"asset01\"}\n{\"ID\":\"asset02\"}\n", body)
+
+	status, contentType, body = query("stream")
+	assert.Equal(200, status)
+	assert.Equal("application/json", contentType)
+	result := utils.DecodePayload([]byte(body)).(map[string]interface{})
+	assert.Equal(2, len(result["result"].([]interface{})))
+	assert.Equal("default-channel", result["headers"].(map[string]interface{})["channel"])
+
+	status, _, body = query("xml")
+	assert.Equal(400, status)
+	assert.Equal("{\"error\":\"Invalid format 'xml'. Must be 'json', 'stream' or 'ndjson'\"}", body)
+
+	g.srv.Close()
+	wg.Wait()
+	auth.RegisterSecurityModule(nil)
+}
+
+func TestQueryPagination(t *testing.T) {
+	assert, g, wg, _, _, _ := newTestGateway(t)
+	header := http.Header{
+		"authorization": []string{"bearer testat"},
+	}
+	rpc := &mockfabric.RPCClient{}
+	rpc.On("Query", mock.Anything, "default-channel", "user1", "asset_transfer", "QueryAssetsWithPagination", []string{"{}", "2", ""}, false).Return([]byte(`{"records":[{"ID":"asset01"},{"ID":"asset02"}],"fetchedRecordsCount":2,"bookmark":"g1AAAA"}`), nil)
+	rpc.On("Query", mock.Anything, "default-channel", "user1", "asset_transfer", "QueryAssetsWithPagination", []string{"{}", "2", "g1AAAA"}, false).Return([]byte(`{"records":[{"ID":"asset03"}],"fetchedRecordsCount":1,"bookmark":"g1BBBB"}`), nil)
+	g.processor.Init(rpc)
+
+	query := func(format, pagination string) map[string]interface{} {
+		url, _ := url.Parse(fmt.Sprintf("http://localhost:%d/query?fly-channel=default-channel&fly-signer=user1&fly-chaincode=asset_transfer&format=%s", g.config.HTTP.Port, format))
+		resp, err := http.DefaultClient.Do(&http.Request{
+			URL:    url,
+			Method: http.MethodPost,
+			Header: header,
+			Body:   io.NopCloser(bytes.NewReader([]byte(`{"func":"QueryAssetsWithPagination","args":["{}"],` + pagination + `}`))),
+		})
+		assert.NoError(err)
+		assert.Equal(200, resp.StatusCode)
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return utils.DecodePayload(bodyBytes).(map[string]interface{})
+	}
+
+	reply := query("json", `"pageSize":2`)
+	page := reply["page"].(map[string]interface{})
+	assert.Equal(float64(2), page["pageSize"])
+	assert.Equal("", page["bookmark"])
+	assert.Equal("g1AAAA", page["nextBookmark"])
+	assert.Equal(float64(2), page["fetchedRecordsCount"])
+	assert.Equal(2, len(reply["result"].(map[string]interface{})["records"].([]interface{})))
+
+	reply = query("stream", `"pageSize":2,"bookmark":"g1AAAA"`)
+	page = reply["page"].(map[string]interface{})
+	assert.Equal("g1AAAA", page["bookmark"])
+	assert.Equal("g1BBBB", page["nextBookmark"])
+	assert.Equal(float64(1), page["fetchedRecordsCount"])
+
+	g.srv.Close()
+	wg.Wait()
+	auth.RegisterSecurityModule(nil)
+}
+
+func TestBlockHeightEndpoint(t *testing.T) {
+	assert, g, wg, _, _, _ := newTestGateway(t)
+	header := http.Header{
+		"authorization": []string{"bearer testat"},
+	}
+
+	get := func(query string) (int, string) {
+		url, _ := url.Parse(fmt.Sprintf("http://localhost:%d/channels/default-channel/blockheight?%s", g.config.HTTP.Port, query))
+		resp, err := http.DefaultClient.Do(&http.Request{URL: url, Method: http.MethodGet, Header: header})
+		assert.NoError(err)
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(bodyBytes)
+	}
+
+	status, body := get("waitAbove=5")
+	assert.Equal(400, status)
+	assert.Equal("{\"error\":\"Must specify the signer\"}", body)
+
+	status, body = get("fly-signer=user1&timeout=soon")
+	assert.Equal(400, status)
+	assert.Equal("{\"error\":\"Invalid timeout: soon\"}", body)
+
+	status, body = get("fly-signer=user1&waitAbove=5")
+	assert.Equal(200, status)
+	result := utils.DecodePayload([]byte(body)).(map[string]interface{})["result"].(map[string]interface{})
+	assert.Equal(float64(10), result["height"])
+	assert.Equal(false, result["timedOut"])
+
+	// the mock chain never grows, so the wait times out with the current height
+	start := time.Now()
+	status, body = get("fly-signer=user1&waitAbove=10&timeout=1s")
+	assert.Equal(200, status)
+	assert.GreaterOrEqual(time.Since(start), time.Second)
+	result = utils.DecodePayload([]byte(body)).(map[string]interface{})["result"].(map[string]interface{})
+	assert.Equal(float64(10), result["height"])
+	assert.Equal(true, result["timedOut"])
+
+	g.srv.Close()
+	wg.Wait()
+	auth.RegisterSecurityModule(nil)
+}
+
+func TestPrivateDataEndpoint(t *testing.T) {
+	assert, g, wg, _, _, _ := newTestGateway(t)
+	header := http.Header{
+		"authorization": []string{"bearer testat"},
+	}
+	rpc := &mockfabric.RPCClient{}
+	rpc.On("Query", mock.Anything, "default-channel", "user1", "asset_transfer", "ReadPrivateData", []string{"assetCollection", "asset01"}, false).Return([]byte(`{"ID":"asset01"}`), nil)
+	rpc.On("Query", mock.Anything, "default-channel", "user1", "asset_transfer", "ReadAsset", []string{"assetCollection", "asset02"}, false).Return([]byte{}, nil)
+	rpc.On("Query", mock.Anything, "default-channel", "user2", "asset_transfer", "ReadPrivateData", []string{"assetCollection", "asset01"}, false).Return(nil, fmt.Errorf("tx creator does not have read access permission on privatedata in chaincodeName:asset_transfer collectionName: assetCollection"))
+	g.processor.Init(rpc)
+
+	get := func(query string) (int, string) {
+		url, _ := url.Parse(fmt.Sprintf("http://localhost:%d/channels/default-channel/chaincodes/asset_transfer/privatedata/assetCollection?%s", g.config.HTTP.Port, query))
+		resp, err := http.DefaultClient.Do(&http.Request{URL: url, Method: http.MethodGet, Header: header})
+		assert.NoError(err)
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(bodyBytes)
+	}
+
+	status, body := get("key=asset01")
+	assert.Equal(400, status)
+	assert.Equal("{\"error\":\"Must specify the signer\"}", body)
+
+	status, body = get("fly-signer=user1")
+	assert.Equal(400, status)
+	assert.Equal("{\"error\":\"Must specify the key\"}", body)
+
+	status, body = get("fly-signer=user1&key=asset01")
+	assert.Equal(200, status)
+	result := utils.DecodePayload([]byte(body)).(map[string]interface{})
+	assert.Equal("asset01", result["result"].(map[string]interface{})["ID"])
+
+	status, _ = get("fly-signer=user1&key=asset02&func=ReadAsset")
+	assert.Equal(404, status)
+
+	status, body = get("fly-signer=user2&key=asset01")
+	assert.Equal(403, status)
+	assert.Contains(body, "Signer user2 is not permitted to read collection assetCollection")
+
+	g.srv.Close()
+	wg.Wait()
+	auth.RegisterSecurityModule(nil)
+}
+
+// testConfigUpdater applies channel config changes to an in-memory config, in place of the network
+type testConfigUpdater struct {
+	*mockfabric.RPCClient
+	config *common.Config
+	submit bool
+}
+
+func (u *testConfigUpdater) UpdateChannelConfig(_ context.Context, channelID, _ string, modify func(config *common.Config) error, submit bool) (*client.ChannelConfigUpdateResult, error) {
+	if err := modify(u.config); err != nil {
+		return nil, err
+	}
+	u.submit = submit
+	return &client.ChannelConfigUpdateResult{ChannelID: channelID, Updated: true, TransactionID: "tx1"}, nil
+}
+
+func TestChannelConfigEndpoints(t *testing.T) {
+	assert, g, wg, _, testRPC, _ := newTestGateway(t)
+	put := func(path, body string) (int, map[string]interface{}) {
+		url, _ := url.Parse(fmt.Sprintf("http://localhost:%d/channels/default-channel/msps/Org1MSP/%s", g.config.HTTP.Port, path))
+		req, _ := http.NewRequest(http.MethodPut, url.String(), bytes.NewReader([]byte(body)))
+		req.Header.Set("authorization", "bearer testat")
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(err)
+		var result map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result
+	}
+
+	status, result := put("anchorpeers", `{"headers":{"signer":"admin"},"anchorPeers":["peer0.org1.example.com:7051"]}`)
+	assert.Equal(405, status)
+	assert.Equal("Channel config updates are not supported by the RPC client", result["error"])
+
+	fabricMSPConfig, _ := proto.Marshal(&msp.FabricMSPConfig{Name: "Org1MSP"})
+	mspConfig, _ := proto.Marshal(&msp.MSPConfig{Config: fabricMSPConfig})
+	org := &common.ConfigGroup{Values: map[string]*common.ConfigValue{"MSP": {Value: mspConfig}}}
+	updater := &testConfigUpdater{
+		RPCClient: testRPC,
+		config: &common.Config{ChannelGroup: &common.ConfigGroup{Groups: map[string]*common.ConfigGroup{
+			"Application": {Groups: map[string]*common.ConfigGroup{"Org1": org}},
+		}}},
+	}
+	g.processor.Init(updater)
+
+	status, result = put("anchorpeers", `{"headers":{"signer":"admin"},"anchorPeers":["peer0.org1.example.com:7051"]}`)
+	assert.Equal(200, status)
+	assert.Equal(map[string]interface{}{"channel": "default-channel", "updated": true, "transactionID": "tx1"}, result["result"])
+	assert.True(updater.submit)
+	assert.Contains(org.Values, "AnchorPeers")
+
+	status, result = put("anchorpeers", `{"headers":{"signer":"admin"},"anchorPeers":["peer0.org1.example.com"]}`)
+	assert.Equal(400, status)
+	assert.Regexp("Invalid config update for channel default-channel: invalid anchor peer", result["error"])
+
+	status, result = put("cacerts", `{"headers":{"signer":"admin"},"tlsRootCerts":["not a cert"],"submit":false}`)
+	assert.Equal(400, status)
+	assert.Regexp("Invalid config update for channel default-channel: certificates must be PEM encoded", result["error"])
+
+	status, result = put("cacerts", `{"headers":{"signer":"admin"}}`)
+	assert.Equal(400, status)
+	assert.Regexp("Must specify at least one of", result["error"])
+
+	g.srv.Close()
+	wg.Wait()
+	auth.RegisterSecurityModule(nil)
+}
+
+func TestUsageEndpoint(t *testing.T) {
+	assert, g, wg, _, _, _ := newTestGateway(t)
+	header := http.Header{
+		"authorization": []string{"bearer testat"},
+	}
+	counters := usage.NewCounters()
+	counters.RecordTransaction("user1", 10, false)
+	g.usage.AddSource(counters)
+
+	get := func(query string) (int, string) {
+		url, _ := url.Parse(fmt.Sprintf("http://localhost:%d/usage?%s", g.config.HTTP.Port, query))
+		resp, err := http.DefaultClient.Do(&http.Request{URL: url, Method: http.MethodGet, Header: header})
+		assert.NoError(err)
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(bodyBytes)
+	}
+
+	status, body := get("")
+	assert.Equal(200, status)
+	var report usage.Report
+	assert.NoError(json.Unmarshal([]byte(body), &report))
+	assert.Equal([]usage.Usage{{Tenant: "user1", Transactions: 1, TransactionBytes: 10}}, report.Tenants)
+
+	status, body = get("format=csv")
+	assert.Equal(200, status)
+	assert.Regexp("^from,to,tenant,transactions.*\n.*,user1,1,0,10,0,0\n$", body)
+
+	g.srv.Close()
+	wg.Wait()
+	auth.RegisterSecurityModule(nil)
+}
+
+func TestOrdererAdminEndpoints(t *testing.T) {
+	assert, g, wg, _, _, _ := newTestGateway(t)
+	header := http.Header{
+		"authorization": []string{"bearer testat"},
+	}
+	call := func(method, path string) (int, string) {
+		url, _ := url.Parse(fmt.Sprintf("http://localhost:%d%s", g.config.HTTP.Port, path))
+		resp, err := http.DefaultClient.Do(&http.Request{URL: url, Method: method, Header: header})
+		assert.NoError(err)
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(bodyBytes)
+	}
+
+	status, body := call(http.MethodGet, "/orderers")
+	assert.Equal(405, status)
+	assert.Regexp("No orderer admin endpoints are configured", body)
+
+	osn := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "application/json")
+		_, _ = res.Write([]byte(fmt.Sprintf(`{"method":"%s","path":"%s"}`, req.Method, req.URL.Path)))
+	}))
+	defer osn.Close()
+	proxy, err := ordereradmin.NewProxy(&conf.OrdererAdminConf{
+		Orderers: map[string]conf.OrdererAdminEndpointConf{
+			"orderer0": {URL: osn.URL},
+		},
+	})
+	assert.NoError(err)
+	g.router.ordererAdmin = proxy
+
+	status, body = call(http.MethodGet, "/orderers")
+	assert.Equal(200, status)
+	assert.JSONEq(`["orderer0"]`, body)
+
+	status, body = call(http.MethodGet, "/orderers/orderer0/channels")
+	assert.Equal(200, status)
+	assert.JSONEq(`{"method":"GET","path":"/participation/v1/channels"}`, body)
+
+	status, body = call(http.MethodDelete, "/orderers/orderer0/channels/default-channel")
+	assert.Equal(200, status)
+	assert.JSONEq(`{"method":"DELETE","path":"/participation/v1/channels/default-channel"}`, body)
+
+	status, _ = call(http.MethodGet, "/orderers/orderer1/channels")
+	assert.Equal(404, status)
+
 	g.srv.Close()
 	wg.Wait()
 	auth.RegisterSecurityModule(nil)
@@ -619,7 +963,7 @@ func TestEventsAPI(t *testing.T) {
 	result1 := make(map[string]interface{})
 	_ = json.NewDecoder(resp.Body).Decode(&result1)
 	assert.Equal(200, resp.StatusCode)
-	assert.Equal(13, len(result1))
+	assert.Equal(16, len(result1))
 	assert.Equal(float64(1), result1["batchSize"])
 	assert.Equal(float64(5000), result1["batchTimeoutMS"])
 	assert.Equal("skip", result1["errorHandling"])
@@ -651,7 +995,7 @@ func TestEventsAPI(t *testing.T) {
 	result3 := make(map[string]interface{})
 	_ = json.NewDecoder(resp.Body).Decode(&result3)
 	assert.Equal(200, resp.StatusCode)
-	assert.Equal(13, len(result3))
+	assert.Equal(17, len(result3))
 
 	// GET /eventstreams/:streamId success calls
 	url, _ = url.Parse(fmt.Sprintf("http://localhost:%d/eventstreams/badId", g.config.HTTP.Port))
@@ -682,7 +1026,7 @@ func TestEventsAPI(t *testing.T) {
 	result4 := make(map[string]interface{})
 	_ = json.NewDecoder(resp.Body).Decode(&result4)
 	assert.Equal(200, resp.StatusCode)
-	assert.Equal(13, len(result3))
+	assert.Equal(17, len(result3))
 	assert.Equal(float64(5), result4["batchSize"])
 	assert.Equal(float64(100), result4["batchTimeoutMS"]) // batch timeout lowered for the resume testing in later steps
 	assert.Equal("test-2", result4["name"])
@@ -883,7 +1227,7 @@ func TestEventsAPI(t *testing.T) {
 	result7 := make(map[string]interface{})
 	_ = json.NewDecoder(resp.Body).Decode(&result7)
 	assert.Equal(200, resp.StatusCode)
-	assert.Equal(10, len(result7))
+	assert.Equal(12, len(result7))
 	assert.Equal("channel-1", result7["channel"])
 	assert.Equal("user1", result7["signer"])
 	assert.Equal("string", result7["payloadType"])
@@ -991,7 +1335,7 @@ func TestEventsAPI(t *testing.T) {
 	resp, _ = http.DefaultClient.Do(req)
 	_ = json.NewDecoder(resp.Body).Decode(&errorResp)
 	assert.Equal(400, resp.StatusCode)
-	assert.Equal(`Parameter "filter.blockType" must be an empty string, "tx" or "config"`, errorResp.Message)
+	assert.Equal(`Parameter "filter.blockType" must be an empty string, "tx", "config" or "all"`, errorResp.Message)
 
 	// GET /subscriptions success calls
 	url, _ = url.Parse(fmt.Sprintf("http://localhost:%d/subscriptions", g.config.HTTP.Port))
@@ -1029,7 +1373,7 @@ func TestEventsAPI(t *testing.T) {
 	result9 := make(map[string]interface{})
 	_ = json.NewDecoder(resp.Body).Decode(&result9)
 	assert.Equal(200, resp.StatusCode)
-	assert.Equal(10, len(result9))
+	assert.Equal(12, len(result9))
 
 	// POST /subscriptions/:subId/reset success calls
 	mockedKV8 := newMockKV()
@@ -1161,7 +1505,11 @@ func TestEventsAPI(t *testing.T) {
 	result12 := make(map[string]interface{})
 	_ = json.NewDecoder(resp.Body).Decode(&result12)
 	esID = result12["id"]
-	mockedKV11.On("Delete", mock.Anything).Return(nil).Twice() // once for stream, once for checkpoint
+	mockedKV11.On("Delete", mock.Anything).Return(nil).Times(2) // once for stream, once for checkpoint
+	noDeadLetters := &mockkvstore.KVIterator{}
+	noDeadLetters.On("Next").Return(false)
+	noDeadLetters.On("Release").Return()
+	mockedKV11.On("NewIteratorWithRange", mock.Anything).Return(noDeadLetters)
 	url, _ = url.Parse(fmt.Sprintf("http://localhost:%d/eventstreams/%s", g.config.HTTP.Port, esID))
 	req = &http.Request{
 		URL:    url,
@@ -1224,6 +1572,63 @@ func TestStartStatusStopNoKafkaHandlerMissingToken(t *testing.T) {
 
 }
 
+func TestStartAdminListener(t *testing.T) {
+	assert := assert.New(t)
+
+	config := *testConfig
+	config.HTTP.Port = lastPort
+	config.HTTP.LocalAddr = "127.0.0.1"
+	config.HTTP.Admin.Port = lastPort + 1
+	config.RPC.ConfigPath = path.Join(tmpdir, "ccp.yml")
+	g := NewRESTGateway(&config)
+	err := g.ValidateConf()
+	assert.NoError(err)
+	err = g.Init()
+	assert.NoError(err)
+
+	lastPort += 2
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		err = g.Start()
+		wg.Done()
+	}()
+
+	var resp *http.Response
+	for i := 0; i < 5; i++ {
+		time.Sleep(200 * time.Millisecond)
+		resp, err = http.Get(fmt.Sprintf("http://127.0.0.1:%d/status", config.HTTP.Admin.Port))
+		if err == nil {
+			break
+		}
+	}
+	assert.NoError(err)
+	assert.Equal(200, resp.StatusCode)
+	resp, err = http.Get(fmt.Sprintf("http://127.0.0.1:%d/status", config.HTTP.Port))
+	assert.NoError(err)
+	assert.Equal(404, resp.StatusCode)
+
+	g.srv.Close()
+	wg.Wait()
+}
+
+func TestValidateConfAdminPortConflict(t *testing.T) {
+	assert := assert.New(t)
+
+	config := *testConfig
+	config.HTTP.Port = 8080
+	config.HTTP.LocalAddr = ""
+	config.HTTP.Admin.Port = 8080
+	config.RPC.ConfigPath = "ccp.yml"
+	g := NewRESTGateway(&config)
+	err := g.ValidateConf()
+	assert.EqualError(err, errors.ConfigRESTGatewayAdminPortConflict)
+
+	config.HTTP.Admin.LocalAddr = "127.0.0.1"
+	err = g.ValidateConf()
+	assert.NoError(err)
+}
+
 func TestStartWithBadTLS(t *testing.T) {
 	assert := assert.New(t)
 
@@ -1278,12 +1683,61 @@ func TestStartWithMissingUserStorePath(t *testing.T) {
 	assert.EqualError(err, "User credentials store creation failed. User credentials store path is empty")
 }
 
+func TestStartWithInvalidResultDecoder(t *testing.T) {
+	assert := assert.New(t)
+
+	config := &conf.RESTGatewayConf{
+		ResultDecoders: []conf.ResultDecoderConf{{Chaincode: "asset_transfer", Format: "xml"}},
+	}
+	g := NewRESTGateway(config)
+	err := g.Init()
+	assert.EqualError(err, "Invalid result decoder 0 for chaincode 'asset_transfer': unknown format 'xml'")
+}
+
+func TestStartWithInvalidIDFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	config := &conf.RESTGatewayConf{
+		IDs: conf.IDsConf{Format: "snowflake"},
+	}
+	g := NewRESTGateway(config)
+	err := g.Init()
+	assert.EqualError(err, "Invalid ID format 'snowflake'. Must be 'uuid' or 'ulid'")
+}
+
 func newMockKV() *mockkvstore.KVStore {
 	mockedKV := &mockkvstore.KVStore{}
 	mockedItr := &mockkvstore.KVIterator{}
 	mockedItr.On("Release").Return()
 	mockedItr.On("Next").Return(false).Once() // called by recoverStreams() during Init()
 	mockedItr.On("Next").Return(false).Once() // called by recoverSubscriptions() during Init()
+	mockedItr.On("Next").Return(false).Once() // called by recoverEventSchemas() during Init()
 	mockedKV.On("NewIterator").Return(mockedItr)
 	return mockedKV
 }
+
+func TestUIRoutes(t *testing.T) {
+	assert := assert.New(t)
+	r := newRouter(nil, nil, nil, nil, nil, nil)
+	r.addUIRoutes()
+
+	res := httptest.NewRecorder()
+	r.httpRouter.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/ui", nil))
+	assert.Equal(301, res.Code)
+	assert.Equal("/ui/", res.Header().Get("Location"))
+
+	res = httptest.NewRecorder()
+	r.httpRouter.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/ui/", nil))
+	assert.Equal(200, res.Code)
+	assert.Regexp("text/html", res.Header().Get("Content-Type"))
+	assert.Contains(res.Body.String(), `<script src="app.js">`)
+
+	res = httptest.NewRecorder()
+	r.httpRouter.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/ui/app.js", nil))
+	assert.Equal(200, res.Code)
+	assert.Contains(res.Body.String(), "fabconnect_system")
+
+	res = httptest.NewRecorder()
+	r.httpRouter.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/ui/missing.js", nil))
+	assert.Equal(404, res.Code)
+}
@@ -17,20 +17,28 @@
 package rest
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"runtime/pprof"
 	"strings"
+	"time"
 
 	"github.com/hyperledger/firefly-fabconnect/internal/auth"
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
 	"github.com/hyperledger/firefly-fabconnect/internal/errors"
 	"github.com/hyperledger/firefly-fabconnect/internal/events"
+	"github.com/hyperledger/firefly-fabconnect/internal/fabric/client"
 	"github.com/hyperledger/firefly-fabconnect/internal/messages"
+	"github.com/hyperledger/firefly-fabconnect/internal/ordereradmin"
 	restasync "github.com/hyperledger/firefly-fabconnect/internal/rest/async"
 	"github.com/hyperledger/firefly-fabconnect/internal/rest/identity"
 	restsync "github.com/hyperledger/firefly-fabconnect/internal/rest/sync"
+	"github.com/hyperledger/firefly-fabconnect/internal/rest/ui"
 	restutil "github.com/hyperledger/firefly-fabconnect/internal/rest/utils"
+	"github.com/hyperledger/firefly-fabconnect/internal/tx"
+	"github.com/hyperledger/firefly-fabconnect/internal/usage"
 	"github.com/hyperledger/firefly-fabconnect/internal/utils"
 	"github.com/hyperledger/firefly-fabconnect/internal/ws"
 	"github.com/julienschmidt/httprouter"
@@ -44,27 +52,46 @@ const (
 )
 
 type router struct {
-	syncDispatcher  restsync.Dispatcher
-	asyncDispatcher restasync.Dispatcher
-	identityClient  identity.Client
-	subManager      events.SubscriptionManager
-	ws              ws.WebSocketServer
-	httpRouter      *httprouter.Router
+	syncDispatcher    restsync.Dispatcher
+	asyncDispatcher   restasync.Dispatcher
+	identityClient    identity.Client
+	rpc               client.RPCClient
+	subManager        events.SubscriptionManager
+	ws                ws.WebSocketServer
+	httpRouter        *httprouter.Router
+	adminRouter       *httprouter.Router // the same as httpRouter, unless there is an admin listener
+	headerPassthrough *conf.HeaderPassthroughConf
+	commitLatency     tx.CommitLatencyStatsProvider
+	usage             *usage.Tracker
+	quotas            tx.QuotaProcessor
+	ordererAdmin      *ordereradmin.Proxy
+	consumerTokens    *consumerTokenIssuer // nil unless consumer tokens are enabled
+	identitySync      *identitySync        // nil unless an identity sync webhook is configured
+	subsystems        *subsystems
+	asyncSubsystem    string             // the subsystem async transactions are dispatched through
+	networks          map[string]*router // the routers of the networks served under /networks/:network
 }
 
-func newRouter(syncDispatcher restsync.Dispatcher, asyncDispatcher restasync.Dispatcher, idClient identity.Client, sm events.SubscriptionManager, ws ws.WebSocketServer) *router {
+func newRouter(syncDispatcher restsync.Dispatcher, asyncDispatcher restasync.Dispatcher, idClient identity.Client, rpc client.RPCClient, sm events.SubscriptionManager, ws ws.WebSocketServer) *router {
 	r := httprouter.New()
 	cors.Default().Handler(r)
 	return &router{
 		syncDispatcher:  syncDispatcher,
 		asyncDispatcher: asyncDispatcher,
 		identityClient:  idClient,
+		rpc:             rpc,
 		subManager:      sm,
 		ws:              ws,
 		httpRouter:      r,
+		adminRouter:     r,
 	}
 }
 
+// useAdminListener routes the operational endpoints apart from the application APIs
+func (r *router) useAdminListener() {
+	r.adminRouter = httprouter.New()
+}
+
 func (r *router) addRoutes() {
 	r.httpRouter.GET("/api", r.serveSwaggerUI)
 	r.httpRouter.ServeFiles("/api/*filepath", http.Dir("./openapi"))
@@ -79,32 +106,105 @@ func (r *router) addRoutes() {
 	r.httpRouter.GET("/chaininfo", r.queryChainInfo)
 	r.httpRouter.GET("/blocks/:blockNumber", r.queryBlock)
 	r.httpRouter.GET("/blockByTxId/:txId", r.queryBlockByTxID)
+	r.httpRouter.GET("/channels/:channel/blockheight", r.getBlockHeight)
+	r.httpRouter.GET("/channels/:channel/chaincodes/:name/privatedata/:collection", r.getPrivateData)
+	r.httpRouter.PUT("/channels/:channel/msps/:mspId/anchorpeers", r.setAnchorPeers)
+	r.httpRouter.PUT("/channels/:channel/msps/:mspId/cacerts", r.setMSPCACerts)
 
 	r.httpRouter.POST("/query", r.queryChaincode)
 	r.httpRouter.POST("/transactions", r.sendTransaction)
+	r.httpRouter.POST("/transactions/outbox", r.events(r.sendOutboxTransaction))
 	r.httpRouter.GET("/transactions/:txId", r.getTransaction)
 	r.httpRouter.GET("/receipts", r.handleReceipts)
 	r.httpRouter.GET("/receipts/:id", r.handleReceipts)
 
-	r.httpRouter.POST("/eventstreams", r.createStream)
-	r.httpRouter.PATCH("/eventstreams/:streamId", r.updateStream)
-	r.httpRouter.GET("/eventstreams", r.listStreams)
-	r.httpRouter.GET("/eventstreams/:streamId", r.getStream)
-	r.httpRouter.DELETE("/eventstreams/:streamId", r.deleteStream)
-	r.httpRouter.POST("/eventstreams/:streamId/suspend", r.suspendStream)
-	r.httpRouter.POST("/eventstreams/:streamId/resume", r.resumeStream)
-	r.httpRouter.POST("/subscriptions", r.createSubscription)
-	r.httpRouter.GET("/subscriptions", r.listSubscription)
-	r.httpRouter.GET("/subscriptions/:subscriptionId", r.getSubscription)
-	r.httpRouter.DELETE("/subscriptions/:subscriptionId", r.deleteSubscription)
-	r.httpRouter.POST("/subscriptions/:subscriptionId/reset", r.resetSubscription)
-
-	r.httpRouter.GET("/ws", r.wsHandler)
-	r.httpRouter.GET("/status", r.statusHandler)
-	r.httpRouter.POST("/pprof", r.dumpGoRoutines)
-}
-
-func (r *router) newAccessTokenContextHandler() http.Handler {
+	r.httpRouter.POST("/eventstreams", r.events(r.createStream))
+	r.httpRouter.PATCH("/eventstreams/:streamId", r.events(r.updateStream))
+	r.httpRouter.GET("/eventstreams", r.events(r.listStreams))
+	r.httpRouter.GET("/eventstreams/:streamId", r.events(r.getStream))
+	r.httpRouter.DELETE("/eventstreams/:streamId", r.events(r.deleteStream))
+	r.httpRouter.POST("/eventstreams/:streamId/suspend", r.events(r.suspendStream))
+	r.httpRouter.POST("/eventstreams/:streamId/resume", r.events(r.resumeStream))
+	r.httpRouter.GET("/eventstreams/:streamId/deadletters", r.events(r.listDeadLetters))
+	r.httpRouter.DELETE("/eventstreams/:streamId/deadletters/:deadLetterId", r.events(r.deleteDeadLetter))
+	r.httpRouter.GET("/eventstreams/:streamId/deliveries", r.events(r.listDeliveries))
+	r.httpRouter.POST("/eventstreams/:streamId/ping", r.events(r.pingStream))
+	r.httpRouter.POST("/eventstreams/:streamId/rotatesecret", r.events(r.rotateStreamSecret))
+	r.httpRouter.GET("/eventstreams/:streamId/listeners", r.events(r.listStreamListeners))
+	r.httpRouter.POST("/eventstreams/:streamId/listeners", r.events(r.createSubscription))
+	r.httpRouter.GET("/eventstreams/:streamId/listeners/:subscriptionId", r.events(r.getSubscription))
+	r.httpRouter.DELETE("/eventstreams/:streamId/listeners/:subscriptionId", r.events(r.deleteSubscription))
+	r.httpRouter.POST("/eventstreams/:streamId/listeners/:subscriptionId/reset", r.events(r.resetSubscription))
+	r.httpRouter.POST("/subscriptions", r.events(r.createSubscription))
+	r.httpRouter.GET("/subscriptions", r.events(r.listSubscription))
+	r.httpRouter.DELETE("/subscriptions", r.events(r.deleteSubscriptions))
+	r.httpRouter.GET("/subscriptions/:subscriptionId", r.events(r.getSubscription))
+	r.httpRouter.DELETE("/subscriptions/:subscriptionId", r.events(r.deleteSubscription))
+	r.httpRouter.POST("/subscriptions/:subscriptionId/reset", r.events(r.resetSubscription))
+	r.httpRouter.GET("/subscriptions/:subscriptionId/stats", r.events(r.getSubscriptionStats))
+	r.httpRouter.POST("/subscriptiongroups", r.events(r.createSubscriptionGroup))
+	r.httpRouter.GET("/subscriptiongroups", r.events(r.listSubscriptionGroups))
+	r.httpRouter.GET("/subscriptiongroups/:groupId", r.events(r.getSubscriptionGroup))
+	r.httpRouter.DELETE("/subscriptiongroups/:groupId", r.events(r.deleteSubscriptionGroup))
+	r.httpRouter.POST("/eventschemas", r.events(r.createEventSchema))
+	r.httpRouter.GET("/eventschemas", r.events(r.listEventSchemas))
+	r.httpRouter.GET("/eventschemas/:schemaId", r.events(r.getEventSchema))
+	r.httpRouter.DELETE("/eventschemas/:schemaId", r.events(r.deleteEventSchema))
+	r.httpRouter.GET("/consumeroffsets/:topic/:consumerGroup", r.events(r.getConsumerOffset))
+	r.httpRouter.PUT("/consumeroffsets/:topic/:consumerGroup", r.events(r.commitConsumerOffset))
+	r.httpRouter.DELETE("/consumeroffsets/:topic/:consumerGroup", r.events(r.deleteConsumerOffset))
+
+	r.httpRouter.GET("/ws", r.subsystems.guard(subsystemWebSocket, r.wsHandler))
+
+	r.adminRouter.GET("/status", r.statusHandler)
+	r.adminRouter.GET("/usage", r.usageReport)
+	r.adminRouter.GET("/quotas", r.quotaReport)
+	r.adminRouter.GET("/asyncqueue", r.asyncQueueStatus)
+	r.adminRouter.POST("/pprof", r.dumpGoRoutines)
+	r.adminRouter.GET("/orderers", r.listOrderers)
+	r.adminRouter.GET("/orderers/:orderer/channels", r.ordererChannels)
+	r.adminRouter.POST("/orderers/:orderer/channels", r.ordererChannels)
+	r.adminRouter.GET("/orderers/:orderer/channels/:channel", r.ordererChannels)
+	r.adminRouter.DELETE("/orderers/:orderer/channels/:channel", r.ordererChannels)
+	r.adminRouter.GET("/subsystems", r.listSubsystems)
+	r.adminOperation(http.MethodPost, "/consumertokens", r.issueConsumerToken)
+	r.adminOperation(http.MethodPost, "/subsystems/:name/stop", r.stopSubsystem)
+	r.adminOperation(http.MethodPost, "/subsystems/:name/start", r.startSubsystem)
+}
+
+// adminOperation adds a route that changes the state of the gateway. Without an admin listener it
+// would be served to the applications, so it is only added when the security module authorizes
+// each call
+func (r *router) adminOperation(method, path string, handle httprouter.Handle) {
+	if r.adminRouter != r.httpRouter {
+		r.adminRouter.Handle(method, path, handle)
+		return
+	}
+	if !auth.AuthorizesAdmin() {
+		log.Warnf("%s %s is only served on an admin listener, or with a security module that authorizes admin operations", method, path)
+		return
+	}
+	operation := method + " " + path
+	r.httpRouter.Handle(method, path, func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		if err := auth.Admin(req.Context(), operation); err != nil {
+			errors.RestErrReply(res, req, err, 403)
+			return
+		}
+		handle(res, req, params)
+	})
+}
+
+// events guards the routes of the event streams API, and of the transactions delivered through it
+func (r *router) events(handle httprouter.Handle) httprouter.Handle {
+	return r.subsystems.guard(subsystemEvents, handle)
+}
+
+func (r *router) addUIRoutes() {
+	r.httpRouter.GET(ui.PathPrefix, r.redirectToUI)
+	r.httpRouter.ServeFiles(ui.PathPrefix+"/*filepath", ui.FileSystem())
+}
+
+func (r *router) newAccessTokenContextHandler(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
 
 		// Extract an access token from bearer token (only - no support for query params)
@@ -113,34 +213,197 @@ func (r *router) newAccessTokenContextHandler() http.Handler {
 		if len(hSplit) == 2 && strings.ToLower(hSplit[0]) == "bearer" {
 			accessToken = hSplit[1]
 		}
-		authCtx, err := auth.WithAuthContext(req.Context(), accessToken)
+		authCtx, err := r.authenticateToken(req.Context(), accessToken)
 		if err != nil {
-			log.Errorf("Error getting auth context: %s", err)
-			errors.RestErrReply(res, req, fmt.Errorf("Unauthorized"), 401)
+			errors.RestErrReply(res, req, err, 401)
+			return
+		}
+		if scope := auth.GetConsumerScope(authCtx); scope != nil && !consumerScopeAllows(req, scope) {
+			errors.RestErrReply(res, req, errors.Errorf(errors.ConsumerTokenForbidden, req.Method, req.URL.Path), 403)
 			return
 		}
 
-		r.httpRouter.ServeHTTP(res, req.WithContext(authCtx))
+		handler.ServeHTTP(res, req.WithContext(authCtx))
 	})
 }
 
+// authenticateToken derives the context of a client from its access token. A consumer token this
+// gateway issued is authorized by its scope, and any other token by the security module. It is
+// also how websocket clients re-authenticate, when their token is about to expire
+func (r *router) authenticateToken(ctx context.Context, accessToken string) (context.Context, error) {
+	if r.consumerTokens != nil && accessToken != "" {
+		claims, err := r.consumerTokens.verify(accessToken)
+		if err != nil {
+			return nil, err
+		}
+		if claims != nil {
+			scope := &auth.ConsumerScope{Subject: claims.Subject, Topics: claims.Topics, Streams: claims.Streams}
+			ctx = auth.WithTokenExpiry(ctx, time.Unix(claims.ExpiresAt, 0))
+			return auth.WithConsumerScope(ctx, scope), nil
+		}
+	}
+	authCtx, err := auth.WithAuthContext(ctx, accessToken)
+	if err != nil {
+		log.Errorf("Error getting auth context: %s", err)
+		return nil, fmt.Errorf("Unauthorized")
+	}
+	return authCtx, nil
+}
+
 func (r *router) wsHandler(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	r.ws.NewConnection(res, req, params)
 }
 
 func (r *router) statusHandler(res http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
-	reply, _ := json.Marshal(&statusMsg{OK: true})
+	status := &statusMsg{OK: true}
+	if statsProvider, ok := r.rpc.(client.BlockCacheStatsProvider); ok {
+		status.BlockCache = statsProvider.BlockCacheStats()
+	}
+	if r.commitLatency != nil {
+		status.CommitLatency = r.commitLatency.CommitLatencyStats()
+	}
+	reply, _ := json.Marshal(status)
 	res.Header().Set("Content-Type", "application/json")
 	res.WriteHeader(200)
 	_, _ = res.Write(reply)
 }
 
+// usageReport returns the usage of each tenant since the connector started, as JSON or with format=csv
+func (r *router) usageReport(res http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	if r.usage == nil {
+		errors.RestErrReply(res, req, fmt.Errorf("Usage tracking is not enabled"), 405)
+		return
+	}
+	report := r.usage.Report()
+	if strings.EqualFold(req.URL.Query().Get("format"), "csv") {
+		log.Infof("<-- %s %s [%d]", req.Method, req.URL, 200)
+		res.Header().Set("Content-Type", "text/csv")
+		res.WriteHeader(200)
+		_ = report.WriteCSV(res)
+		return
+	}
+	marshalAndReply(res, req, report)
+}
+
+// quotaReport returns the transactions submitted by each organization in the current hour and
+// day, against its quota
+func (r *router) quotaReport(res http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	var report *tx.QuotaReport
+	if r.quotas != nil {
+		report = r.quotas.QuotaReport()
+	}
+	if report == nil {
+		errors.RestErrReply(res, req, fmt.Errorf("Submission quotas are not enabled"), 405)
+		return
+	}
+	marshalAndReply(res, req, report)
+}
+
+// asyncQueueStatus returns the depth of the queue of the transactions accepted asynchronously
+func (r *router) asyncQueueStatus(res http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	var status *restasync.QueueStatus
+	var err error
+	if reporter, ok := r.asyncDispatcher.(restasync.QueueReporter); ok {
+		status, err = reporter.QueueStatus()
+	}
+	if err != nil {
+		errors.RestErrReply(res, req, err, 500)
+		return
+	}
+	if status == nil {
+		errors.RestErrReply(res, req, fmt.Errorf("The async queue is only held by the gateway when Kafka is not configured"), 405)
+		return
+	}
+	marshalAndReply(res, req, status)
+}
+
+// listOrderers returns the names of the orderers whose channel participation API is proxied
+func (r *router) listOrderers(res http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	if r.ordererAdmin == nil {
+		errors.RestErrReply(res, req, fmt.Errorf("No orderer admin endpoints are configured"), 405)
+		return
+	}
+	marshalAndReply(res, req, r.ordererAdmin.Orderers())
+}
+
+// ordererChannels proxies the channel participation API of an orderer, to list, join or remove its channels
+func (r *router) ordererChannels(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	if r.ordererAdmin == nil {
+		errors.RestErrReply(res, req, fmt.Errorf("No orderer admin endpoints are configured"), 405)
+		return
+	}
+	r.ordererAdmin.ServeChannels(res, req, params.ByName("orderer"), params.ByName("channel"))
+}
+
+// listSubsystems returns whether each subsystem that can be stopped through the admin API is running
+func (r *router) listSubsystems(res http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	marshalAndReply(res, req, r.subsystems.status())
+}
+
+// stopSubsystem stops a subsystem, once the requests using it have completed, so it can be
+// restarted without restarting the gateway
+func (r *router) stopSubsystem(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	status, err := r.subsystems.stopSubsystem(params.ByName("name"))
+	if err != nil {
+		errors.RestErrReply(res, req, err, 404)
+		return
+	}
+	marshalAndReply(res, req, status)
+}
+
+func (r *router) startSubsystem(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	name := params.ByName("name")
+	if _, err := r.subsystems.get(name); err != nil {
+		errors.RestErrReply(res, req, err, 404)
+		return
+	}
+	status, err := r.subsystems.startSubsystem(name)
+	if err != nil {
+		errors.RestErrReply(res, req, err, 500)
+		return
+	}
+	marshalAndReply(res, req, status)
+}
+
+// issueConsumerToken signs a token for an event consumer, scoped to websocket topics and event streams
+func (r *router) issueConsumerToken(res http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	if r.consumerTokens == nil {
+		errors.RestErrReply(res, req, errors.Errorf(errors.ConsumerTokensNotEnabled), 405)
+		return
+	}
+	var tokenReq consumerTokenRequest
+	if err := json.NewDecoder(req.Body).Decode(&tokenReq); err != nil {
+		errors.RestErrReply(res, req, errors.Errorf(errors.ConsumerTokenRequestInvalid, err), 400)
+		return
+	}
+	token, err := r.consumerTokens.issue(&tokenReq)
+	if err != nil {
+		errors.RestErrReply(res, req, err, 400)
+		return
+	}
+	log.Infof("Issued consumer token %s to '%s' for topics %v and streams %v, expiring %s", token.ID, token.Subject, token.Topics, token.Streams, token.Expires)
+	marshalAndReply(res, req, token)
+}
+
 func (r *router) serveSwaggerUI(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
 	res.Header().Add("Content-Type", "text/html")
 	_, _ = res.Write(utils.SwaggerUIHTML(req.Context()))
 }
 
+func (r *router) redirectToUI(res http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	http.Redirect(res, req, ui.PathPrefix+"/", http.StatusMovedPermanently)
+}
+
 func (r *router) queryChainInfo(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
 	// query requests are always synchronous
@@ -165,6 +428,32 @@ func (r *router) queryChaincode(res http.ResponseWriter, req *http.Request, para
 	r.syncDispatcher.QueryChaincode(res, req, params)
 }
 
+func (r *router) getBlockHeight(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	// query requests are always synchronous
+	r.syncDispatcher.GetBlockHeight(res, req, params)
+}
+
+func (r *router) getPrivateData(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	// query requests are always synchronous
+	r.syncDispatcher.GetPrivateData(res, req, params)
+}
+
+// setAnchorPeers computes and submits the config update that sets the anchor peers of an organization
+func (r *router) setAnchorPeers(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	// config updates are always synchronous
+	r.syncDispatcher.SetAnchorPeers(res, req, params)
+}
+
+// setMSPCACerts computes and submits the config update that replaces the CA certificates of an MSP
+func (r *router) setMSPCACerts(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	// config updates are always synchronous
+	r.syncDispatcher.SetMSPCACerts(res, req, params)
+}
+
 func (r *router) getTransaction(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
 	// query requests are always synchronous
@@ -175,13 +464,25 @@ func (r *router) sendTransaction(res http.ResponseWriter, req *http.Request, par
 	log.Infof("--> %s %s", req.Method, req.URL)
 
 	msg, opts, err := restutil.BuildTxMessage(res, req, params)
+	if err == nil && r.headerPassthrough != nil {
+		err = restutil.ApplyHeaderPassthrough(req, msg, r.headerPassthrough)
+	}
 	if err != nil {
 		errors.RestErrReply(res, req, err.Error, err.StatusCode)
 		return
 	}
+	r.dispatchTransaction(res, req, msg, opts)
+}
+
+func (r *router) dispatchTransaction(res http.ResponseWriter, req *http.Request, msg *messages.SendTransaction, opts *restutil.TxOpts) {
 	if opts.Sync {
 		r.syncDispatcher.DispatchMsgSync(req.Context(), res, req, msg)
 	} else {
+		if !r.subsystems.enter(r.asyncSubsystem) {
+			errors.RestErrReply(res, req, errors.Errorf(errors.RESTGatewaySubsystemStopped, r.asyncSubsystem), 503)
+			return
+		}
+		defer r.subsystems.exit(r.asyncSubsystem)
 		if asyncResponse, err := r.asyncDispatcher.DispatchMsgAsync(req.Context(), msg, opts.Ack); err != nil {
 			errors.RestErrReply(res, req, err, 500)
 		} else if opts.Ack {
@@ -190,58 +491,113 @@ func (r *router) sendTransaction(res http.ResponseWriter, req *http.Request, par
 	}
 }
 
+// sendOutboxTransaction submits a transaction, holding its receipt until its chaincode
+// event has been delivered to the event stream named in the request
+func (r *router) sendOutboxTransaction(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	if r.subManager == nil {
+		errors.RestErrReply(res, req, errors.Errorf(errEventSupportMissing), 405)
+		return
+	}
+
+	msg, opts, err := restutil.BuildOutboxTxMessage(res, req, params)
+	if err == nil && r.headerPassthrough != nil {
+		err = restutil.ApplyHeaderPassthrough(req, msg, r.headerPassthrough)
+	}
+	if err != nil {
+		errors.RestErrReply(res, req, err.Error, err.StatusCode)
+		return
+	}
+	r.dispatchTransaction(res, req, msg, opts)
+}
+
 func (r *router) registerUser(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
 
+	var change *identityChange
+	if r.identitySync != nil {
+		change = readIdentityChange(req, params)
+	}
 	result, err := r.identityClient.Register(res, req, params)
 	if err != nil {
 		errors.RestErrReply(res, req, err.Error, err.StatusCode)
 		return
 	}
+	if r.identitySync != nil {
+		r.identitySync.publish(identityRegistered, change, nil)
+	}
 	marshalAndReply(res, req, result)
 }
 
 func (r *router) modifyUser(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
 
+	var change *identityChange
+	if r.identitySync != nil {
+		change = readIdentityChange(req, params)
+	}
 	result, err := r.identityClient.Modify(res, req, params)
 	if err != nil {
 		errors.RestErrReply(res, req, err.Error, err.StatusCode)
 		return
 	}
+	if r.identitySync != nil {
+		r.identitySync.publish(identityModified, change, nil)
+	}
 	marshalAndReply(res, req, result)
 }
 
 func (r *router) enrollUser(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
 
+	var change *identityChange
+	if r.identitySync != nil {
+		change = readIdentityChange(req, params)
+	}
 	result, err := r.identityClient.Enroll(res, req, params)
 	if err != nil {
 		errors.RestErrReply(res, req, err.Error, err.StatusCode)
 		return
 	}
+	if r.identitySync != nil {
+		r.identitySync.publish(identityEnrolled, change, nil)
+	}
 	marshalAndReply(res, req, result)
 }
 
 func (r *router) reenrollUser(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
 
+	var change *identityChange
+	if r.identitySync != nil {
+		change = readIdentityChange(req, params)
+	}
 	result, err := r.identityClient.Reenroll(res, req, params)
 	if err != nil {
 		errors.RestErrReply(res, req, err.Error, err.StatusCode)
 		return
 	}
+	if r.identitySync != nil {
+		r.identitySync.publish(identityReenrolled, change, nil)
+	}
 	marshalAndReply(res, req, result)
 }
 
 func (r *router) revokeUser(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
 
+	var change *identityChange
+	if r.identitySync != nil {
+		change = readIdentityChange(req, params)
+	}
 	result, err := r.identityClient.Revoke(res, req, params)
 	if err != nil {
 		errors.RestErrReply(res, req, err.Error, err.StatusCode)
 		return
 	}
+	if r.identitySync != nil {
+		r.identitySync.publish(identityRevoked, change, result.RevokedCerts)
+	}
 	marshalAndReply(res, req, result)
 }
 
@@ -281,6 +637,7 @@ func (r *router) createStream(res http.ResponseWriter, req *http.Request, params
 		errors.RestErrReply(res, req, err.Error, err.StatusCode)
 		return
 	}
+	res.Header().Set("ETag", events.ETag(result.ResourceVersion))
 	marshalAndReply(res, req, result)
 }
 
@@ -296,6 +653,7 @@ func (r *router) updateStream(res http.ResponseWriter, req *http.Request, params
 		errors.RestErrReply(res, req, err.Error, err.StatusCode)
 		return
 	}
+	res.Header().Set("ETag", events.ETag(result.ResourceVersion))
 	marshalAndReply(res, req, result)
 }
 
@@ -322,6 +680,7 @@ func (r *router) getStream(res http.ResponseWriter, req *http.Request, params ht
 		errors.RestErrReply(res, req, err.Error, err.StatusCode)
 		return
 	}
+	res.Header().Set("ETag", events.ETag(result.ResourceVersion))
 	marshalAndReply(res, req, result)
 }
 
@@ -382,6 +741,7 @@ func (r *router) createSubscription(res http.ResponseWriter, req *http.Request,
 		errors.RestErrReply(res, req, err.Error, err.StatusCode)
 		return
 	}
+	res.Header().Set("ETag", events.ETag(result.ResourceVersion))
 	marshalAndReply(res, req, result)
 }
 
@@ -396,6 +756,23 @@ func (r *router) listSubscription(res http.ResponseWriter, req *http.Request, pa
 	marshalAndReply(res, req, result)
 }
 
+// listStreamListeners lists the subscriptions of an event stream, addressed as its listeners
+// as in the FireFly connector toolkit
+func (r *router) listStreamListeners(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	if r.subManager == nil {
+		errors.RestErrReply(res, req, errors.Errorf(errEventSupportMissing), 405)
+		return
+	}
+
+	if _, err := r.subManager.StreamByID(res, req, params); err != nil {
+		errors.RestErrReply(res, req, err.Error, err.StatusCode)
+		return
+	}
+	result := r.subManager.Subscriptions(res, req, params)
+	marshalAndReply(res, req, result)
+}
+
 func (r *router) getSubscription(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
 	if r.subManager == nil {
@@ -408,6 +785,7 @@ func (r *router) getSubscription(res http.ResponseWriter, req *http.Request, par
 		errors.RestErrReply(res, req, err.Error, err.StatusCode)
 		return
 	}
+	res.Header().Set("ETag", events.ETag(result.ResourceVersion))
 	marshalAndReply(res, req, result)
 }
 
@@ -426,6 +804,21 @@ func (r *router) deleteSubscription(res http.ResponseWriter, req *http.Request,
 	marshalAndReply(res, req, result)
 }
 
+func (r *router) deleteSubscriptions(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	if r.subManager == nil {
+		errors.RestErrReply(res, req, errors.Errorf(errEventSupportMissing), 405)
+		return
+	}
+
+	result, err := r.subManager.DeleteSubscriptions(res, req, params)
+	if err != nil {
+		errors.RestErrReply(res, req, err.Error, err.StatusCode)
+		return
+	}
+	marshalAndReply(res, req, result)
+}
+
 func (r *router) resetSubscription(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
 	if r.subManager == nil {
@@ -441,6 +834,253 @@ func (r *router) resetSubscription(res http.ResponseWriter, req *http.Request, p
 	marshalAndReply(res, req, result)
 }
 
+func (r *router) getSubscriptionStats(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	if r.subManager == nil {
+		errors.RestErrReply(res, req, errors.Errorf(errEventSupportMissing), 405)
+		return
+	}
+
+	result, err := r.subManager.SubscriptionStats(res, req, params)
+	if err != nil {
+		errors.RestErrReply(res, req, err.Error, err.StatusCode)
+		return
+	}
+	marshalAndReply(res, req, result)
+}
+
+func (r *router) createSubscriptionGroup(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	if r.subManager == nil {
+		errors.RestErrReply(res, req, errors.Errorf(errEventSupportMissing), 405)
+		return
+	}
+
+	result, err := r.subManager.AddSubscriptionGroup(res, req, params)
+	if err != nil {
+		errors.RestErrReply(res, req, err.Error, err.StatusCode)
+		return
+	}
+	marshalAndReply(res, req, result)
+}
+
+func (r *router) listSubscriptionGroups(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	if r.subManager == nil {
+		errors.RestErrReply(res, req, errors.Errorf(errEventSupportMissing), 405)
+		return
+	}
+
+	result := r.subManager.SubscriptionGroups(res, req, params)
+	marshalAndReply(res, req, result)
+}
+
+func (r *router) getSubscriptionGroup(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	if r.subManager == nil {
+		errors.RestErrReply(res, req, errors.Errorf(errEventSupportMissing), 405)
+		return
+	}
+
+	result, err := r.subManager.SubscriptionGroupByID(res, req, params)
+	if err != nil {
+		errors.RestErrReply(res, req, err.Error, err.StatusCode)
+		return
+	}
+	marshalAndReply(res, req, result)
+}
+
+func (r *router) deleteSubscriptionGroup(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	if r.subManager == nil {
+		errors.RestErrReply(res, req, errors.Errorf(errEventSupportMissing), 405)
+		return
+	}
+
+	result, err := r.subManager.DeleteSubscriptionGroup(res, req, params)
+	if err != nil {
+		errors.RestErrReply(res, req, err.Error, err.StatusCode)
+		return
+	}
+	marshalAndReply(res, req, result)
+}
+
+func (r *router) createEventSchema(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	if r.subManager == nil {
+		errors.RestErrReply(res, req, errors.Errorf(errEventSupportMissing), 405)
+		return
+	}
+
+	result, err := r.subManager.AddEventSchema(res, req, params)
+	if err != nil {
+		errors.RestErrReply(res, req, err.Error, err.StatusCode)
+		return
+	}
+	marshalAndReply(res, req, result)
+}
+
+func (r *router) listEventSchemas(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	if r.subManager == nil {
+		errors.RestErrReply(res, req, errors.Errorf(errEventSupportMissing), 405)
+		return
+	}
+
+	result := r.subManager.EventSchemas(res, req, params)
+	marshalAndReply(res, req, result)
+}
+
+func (r *router) getEventSchema(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	if r.subManager == nil {
+		errors.RestErrReply(res, req, errors.Errorf(errEventSupportMissing), 405)
+		return
+	}
+
+	result, err := r.subManager.EventSchemaByID(res, req, params)
+	if err != nil {
+		errors.RestErrReply(res, req, err.Error, err.StatusCode)
+		return
+	}
+	marshalAndReply(res, req, result)
+}
+
+func (r *router) deleteEventSchema(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	if r.subManager == nil {
+		errors.RestErrReply(res, req, errors.Errorf(errEventSupportMissing), 405)
+		return
+	}
+
+	result, err := r.subManager.DeleteEventSchema(res, req, params)
+	if err != nil {
+		errors.RestErrReply(res, req, err.Error, err.StatusCode)
+		return
+	}
+	marshalAndReply(res, req, result)
+}
+
+func (r *router) getConsumerOffset(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	if r.subManager == nil {
+		errors.RestErrReply(res, req, errors.Errorf(errEventSupportMissing), 405)
+		return
+	}
+
+	result, err := r.subManager.ConsumerOffset(res, req, params)
+	if err != nil {
+		errors.RestErrReply(res, req, err.Error, err.StatusCode)
+		return
+	}
+	marshalAndReply(res, req, result)
+}
+
+func (r *router) commitConsumerOffset(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	if r.subManager == nil {
+		errors.RestErrReply(res, req, errors.Errorf(errEventSupportMissing), 405)
+		return
+	}
+
+	result, err := r.subManager.CommitConsumerOffset(res, req, params)
+	if err != nil {
+		errors.RestErrReply(res, req, err.Error, err.StatusCode)
+		return
+	}
+	marshalAndReply(res, req, result)
+}
+
+func (r *router) deleteConsumerOffset(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	if r.subManager == nil {
+		errors.RestErrReply(res, req, errors.Errorf(errEventSupportMissing), 405)
+		return
+	}
+
+	result, err := r.subManager.DeleteConsumerOffset(res, req, params)
+	if err != nil {
+		errors.RestErrReply(res, req, err.Error, err.StatusCode)
+		return
+	}
+	marshalAndReply(res, req, result)
+}
+
+func (r *router) listDeadLetters(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	if r.subManager == nil {
+		errors.RestErrReply(res, req, errors.Errorf(errEventSupportMissing), 405)
+		return
+	}
+
+	result, err := r.subManager.DeadLetters(res, req, params)
+	if err != nil {
+		errors.RestErrReply(res, req, err.Error, err.StatusCode)
+		return
+	}
+	marshalAndReply(res, req, result)
+}
+
+func (r *router) listDeliveries(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	if r.subManager == nil {
+		errors.RestErrReply(res, req, errors.Errorf(errEventSupportMissing), 405)
+		return
+	}
+
+	result, err := r.subManager.Deliveries(res, req, params)
+	if err != nil {
+		errors.RestErrReply(res, req, err.Error, err.StatusCode)
+		return
+	}
+	marshalAndReply(res, req, result)
+}
+
+func (r *router) pingStream(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	if r.subManager == nil {
+		errors.RestErrReply(res, req, errors.Errorf(errEventSupportMissing), 405)
+		return
+	}
+
+	result, err := r.subManager.PingStream(res, req, params)
+	if err != nil {
+		errors.RestErrReply(res, req, err.Error, err.StatusCode)
+		return
+	}
+	marshalAndReply(res, req, result)
+}
+
+func (r *router) rotateStreamSecret(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	if r.subManager == nil {
+		errors.RestErrReply(res, req, errors.Errorf(errEventSupportMissing), 405)
+		return
+	}
+
+	result, err := r.subManager.RotateStreamSecret(res, req, params)
+	if err != nil {
+		errors.RestErrReply(res, req, err.Error, err.StatusCode)
+		return
+	}
+	marshalAndReply(res, req, result)
+}
+
+func (r *router) deleteDeadLetter(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	log.Infof("--> %s %s", req.Method, req.URL)
+	if r.subManager == nil {
+		errors.RestErrReply(res, req, errors.Errorf(errEventSupportMissing), 405)
+		return
+	}
+
+	result, err := r.subManager.DeleteDeadLetter(res, req, params)
+	if err != nil {
+		errors.RestErrReply(res, req, err.Error, err.StatusCode)
+		return
+	}
+	marshalAndReply(res, req, result)
+}
+
 func (r *router) dumpGoRoutines(res http.ResponseWriter, req *http.Request, _ httprouter.Params) {
 	log.Infof("--> %s %s", req.Method, req.URL)
 	_ = pprof.Lookup("goroutine").WriteTo(res, 1)
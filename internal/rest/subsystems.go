@@ -0,0 +1,157 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	subsystemEvents    = "events"
+	subsystemWebSocket = "ws"
+	subsystemKafka     = "kafka"
+	subsystemRESTAsync = "rest-async"
+)
+
+// subsystem is a part of the gateway that can be stopped and started through the admin API,
+// without restarting the process
+type subsystem struct {
+	name    string
+	mux     sync.RWMutex // read locked by each request using the subsystem, so it stops once they complete
+	running bool
+	stop    func()
+	start   func() error
+}
+
+type subsystemStatus struct {
+	Name    string `json:"name"`
+	Running bool   `json:"running"`
+}
+
+// subsystems are the parts of the gateway that can be stopped, in the order they were added
+type subsystems struct {
+	byName map[string]*subsystem
+	names  []string
+}
+
+func newSubsystems() *subsystems {
+	return &subsystems{
+		byName: make(map[string]*subsystem),
+	}
+}
+
+// add registers a running subsystem
+func (s *subsystems) add(name string, stop func(), start func() error) {
+	s.byName[name] = &subsystem{name: name, running: true, stop: stop, start: start}
+	s.names = append(s.names, name)
+}
+
+func (s *subsystems) get(name string) (*subsystem, error) {
+	if s != nil {
+		if ss, ok := s.byName[name]; ok {
+			return ss, nil
+		}
+	}
+	return nil, errors.Errorf(errors.RESTGatewaySubsystemUnknown, name)
+}
+
+func (s *subsystems) status() []*subsystemStatus {
+	statuses := []*subsystemStatus{}
+	if s == nil {
+		return statuses
+	}
+	for _, name := range s.names {
+		ss := s.byName[name]
+		ss.mux.RLock()
+		statuses = append(statuses, &subsystemStatus{Name: name, Running: ss.running})
+		ss.mux.RUnlock()
+	}
+	return statuses
+}
+
+// enter marks a request as using the subsystem, which is not stopped until the request exits.
+// Returns false if the subsystem is stopped. Subsystems the gateway is not running are not
+// guarded, as their routes reply that they are not configured
+func (s *subsystems) enter(name string) bool {
+	ss, err := s.get(name)
+	if err != nil {
+		return true
+	}
+	ss.mux.RLock()
+	if !ss.running {
+		ss.mux.RUnlock()
+		return false
+	}
+	return true
+}
+
+func (s *subsystems) exit(name string) {
+	if ss, err := s.get(name); err == nil {
+		ss.mux.RUnlock()
+	}
+}
+
+// guard wraps the handler of a route that uses the subsystem, to reply with a 503 while it is stopped
+func (s *subsystems) guard(name string, handle httprouter.Handle) httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		if !s.enter(name) {
+			log.Infof("--> %s %s", req.Method, req.URL)
+			errors.RestErrReply(res, req, errors.Errorf(errors.RESTGatewaySubsystemStopped, name), 503)
+			return
+		}
+		defer s.exit(name)
+		handle(res, req, params)
+	}
+}
+
+// stopSubsystem waits for the requests using the subsystem to complete, then stops it
+func (s *subsystems) stopSubsystem(name string) (*subsystemStatus, error) {
+	ss, err := s.get(name)
+	if err != nil {
+		return nil, err
+	}
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+	if ss.running {
+		log.Infof("Stopping the %s subsystem", name)
+		ss.stop()
+		ss.running = false
+	}
+	return &subsystemStatus{Name: name, Running: ss.running}, nil
+}
+
+func (s *subsystems) startSubsystem(name string) (*subsystemStatus, error) {
+	ss, err := s.get(name)
+	if err != nil {
+		return nil, err
+	}
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+	if !ss.running {
+		log.Infof("Starting the %s subsystem", name)
+		if err := ss.start(); err != nil {
+			return nil, errors.Errorf(errors.RESTGatewaySubsystemStartFailed, name, err)
+		}
+		ss.running = true
+	}
+	return &subsystemStatus{Name: name, Running: ss.running}, nil
+}
@@ -0,0 +1,125 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/auth"
+	"github.com/hyperledger/firefly-fabconnect/internal/auth/authtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubsystemsAdminAPI(t *testing.T) {
+	assert := assert.New(t)
+	r := newRouter(nil, nil, nil, nil, nil, nil)
+	r.subsystems = newSubsystems()
+	stops, starts := 0, 0
+	var startErr error
+	r.subsystems.add(subsystemEvents, func() { stops++ }, func() error {
+		starts++
+		return startErr
+	})
+	r.useAdminListener()
+	r.addRoutes()
+	call := func(method, path string) (int, string) {
+		res := httptest.NewRecorder()
+		if strings.HasPrefix(path, "/subsystems") {
+			r.adminRouter.ServeHTTP(res, httptest.NewRequest(method, path, nil))
+		} else {
+			r.httpRouter.ServeHTTP(res, httptest.NewRequest(method, path, nil))
+		}
+		return res.Code, res.Body.String()
+	}
+
+	// the events API replies as normal while the subsystem runs
+	status, body := call("GET", "/eventstreams")
+	assert.Equal(405, status)
+	assert.Regexp("Event support is not configured", body)
+
+	status, body = call("POST", "/subsystems/events/stop")
+	assert.Equal(200, status)
+	assert.JSONEq(`{"name":"events","running":false}`, body)
+	status, _ = call("POST", "/subsystems/events/stop")
+	assert.Equal(200, status)
+	assert.Equal(1, stops)
+
+	status, body = call("GET", "/eventstreams")
+	assert.Equal(503, status)
+	assert.Regexp("The events subsystem is stopped", body)
+	status, body = call("GET", "/subsystems")
+	assert.Equal(200, status)
+	assert.JSONEq(`[{"name":"events","running":false}]`, body)
+
+	startErr = fmt.Errorf("pop")
+	status, body = call("POST", "/subsystems/events/start")
+	assert.Equal(500, status)
+	assert.Regexp("Failed to start the events subsystem: pop", body)
+
+	startErr = nil
+	status, body = call("POST", "/subsystems/events/start")
+	assert.Equal(200, status)
+	assert.JSONEq(`{"name":"events","running":true}`, body)
+	assert.Equal(2, starts)
+	status, _ = call("GET", "/eventstreams")
+	assert.Equal(405, status)
+
+	// subsystems the gateway is not running cannot be stopped, and do not guard their routes
+	status, body = call("POST", "/subsystems/kafka/stop")
+	assert.Equal(404, status)
+	assert.Regexp("Unknown subsystem 'kafka'", body)
+	status, _ = call("POST", "/subsystems/ws/start")
+	assert.Equal(404, status)
+}
+
+func TestSubsystemsAdminAPIWithoutAdminListener(t *testing.T) {
+	assert := assert.New(t)
+	newTestRouter := func() *router {
+		r := newRouter(nil, nil, nil, nil, nil, nil)
+		r.subsystems = newSubsystems()
+		r.subsystems.add(subsystemEvents, func() {}, func() error { return nil })
+		r.addRoutes()
+		return r
+	}
+	call := func(r *router, ctx context.Context, path string) int {
+		res := httptest.NewRecorder()
+		r.httpRouter.ServeHTTP(res, httptest.NewRequest("POST", path, strings.NewReader(`{}`)).WithContext(ctx))
+		return res.Code
+	}
+
+	// without an admin listener, or a security module to authorize them, the operations are not served
+	r := newTestRouter()
+	assert.Equal(404, call(r, context.Background(), "/subsystems/events/stop"))
+	assert.Equal(404, call(r, context.Background(), "/consumertokens"))
+
+	auth.RegisterSecurityModule(&authtest.TestSecurityModule{})
+	defer auth.RegisterSecurityModule(nil)
+	r = newTestRouter()
+	assert.Equal(403, call(r, context.Background(), "/subsystems/events/stop"))
+	assert.True(r.subsystems.status()[0].Running)
+	verified, err := auth.WithAuthContext(context.Background(), "testat")
+	assert.NoError(err)
+	assert.Equal(200, call(r, verified, "/subsystems/events/stop"))
+	assert.False(r.subsystems.status()[0].Running)
+	assert.Equal(403, call(r, verified, "/consumertokens"))
+	consumer := auth.WithConsumerScope(context.Background(), &auth.ConsumerScope{Subject: "app1"})
+	assert.Equal(403, call(r, consumer, "/subsystems/events/start"))
+}
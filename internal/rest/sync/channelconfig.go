@@ -0,0 +1,107 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+	internalErrors "github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/fabric/client"
+	"github.com/hyperledger/firefly-fabconnect/internal/fabric/utils"
+	"github.com/hyperledger/firefly-fabconnect/internal/messages"
+	restutil "github.com/hyperledger/firefly-fabconnect/internal/rest/utils"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// SetAnchorPeers replaces the anchor peers of an organization in the config of a channel
+func (d *dispatcher) SetAnchorPeers(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	msg, err := restutil.BuildSetAnchorPeersMessage(res, req, params)
+	if err != nil {
+		internalErrors.RestErrReply(res, req, err.Error, err.StatusCode)
+		return
+	}
+	d.updateChannelConfig(res, req, msg, func(config *common.Config) error {
+		return utils.SetAnchorPeers(config, msg.MSPID, msg.AnchorPeers)
+	})
+}
+
+// SetMSPCACerts replaces the CA certificates of an MSP in the config of a channel, for example
+// to add the new root CA of an organization ahead of rotating its certificates
+func (d *dispatcher) SetMSPCACerts(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	msg, err := restutil.BuildSetMSPCACertsMessage(res, req, params)
+	if err != nil {
+		internalErrors.RestErrReply(res, req, err.Error, err.StatusCode)
+		return
+	}
+	certs := &utils.MSPCACerts{
+		RootCerts:            pemCerts(msg.RootCerts),
+		IntermediateCerts:    pemCerts(msg.IntermediateCerts),
+		TLSRootCerts:         pemCerts(msg.TLSRootCerts),
+		TLSIntermediateCerts: pemCerts(msg.TLSIntermediateCerts),
+	}
+	d.updateChannelConfig(res, req, msg, func(config *common.Config) error {
+		return utils.SetMSPCACerts(config, msg.MSPID, certs)
+	})
+}
+
+// updateChannelConfig applies the change to the latest config of the channel, and submits the
+// computed config update, or returns it to collect the signatures of other organizations
+func (d *dispatcher) updateChannelConfig(res http.ResponseWriter, req *http.Request, msg *messages.UpdateChannelConfig, modify func(config *common.Config) error) {
+	updater, ok := d.processor.GetRPCClient().(client.ChannelConfigUpdater)
+	if !ok {
+		internalErrors.RestErrReply(res, req, fmt.Errorf("Channel config updates are not supported by the RPC client"), 405)
+		return
+	}
+
+	start := time.Now().UTC()
+	// errors applying the change are problems with the request, rather than with the network
+	var modifyErr error
+	result, err := updater.UpdateChannelConfig(req.Context(), msg.Headers.ChannelID, msg.Headers.Signer, func(config *common.Config) error {
+		modifyErr = modify(config)
+		return modifyErr
+	}, msg.Submit)
+	callTime := time.Now().UTC().Sub(start)
+	if modifyErr != nil {
+		internalErrors.RestErrReply(res, req, internalErrors.Errorf(internalErrors.RESTGatewayChannelConfigInvalid, msg.Headers.ChannelID, modifyErr), 400)
+		return
+	}
+	if err != nil {
+		log.Warnf("Config update of channel %s [msp=%s] failed: %s [%.2fs]", msg.Headers.ChannelID, msg.MSPID, err, callTime.Seconds())
+		internalErrors.RestErrReply(res, req, internalErrors.Errorf(internalErrors.RESTGatewayChannelConfigUpdateFailed, msg.Headers.ChannelID, err), 500)
+		return
+	}
+	log.Infof("Config update of channel %s [msp=%s, updated=%t, submitted=%t] [%.2fs]", msg.Headers.ChannelID, msg.MSPID, result.Updated, result.TransactionID != "", callTime.Seconds())
+	var reply messages.LedgerQueryResult
+	reply.Result = result
+
+	sendReply(res, req, reply)
+}
+
+func pemCerts(certs []string) [][]byte {
+	if certs == nil {
+		return nil
+	}
+	result := make([][]byte, len(certs))
+	for i, cert := range certs {
+		result[i] = []byte(cert)
+	}
+	return result
+}
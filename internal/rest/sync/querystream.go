@@ -0,0 +1,143 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sync
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	internalErrors "github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/messages"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	queryFormatJSON   = "json"
+	queryFormatStream = "stream"
+	queryFormatNDJSON = "ndjson"
+
+	// Streamed query results are written and flushed to the client in chunks of this size
+	queryStreamChunkSize = 64 * 1024
+)
+
+func getQueryFormat(req *http.Request) (string, error) {
+	format := strings.ToLower(req.URL.Query().Get("format"))
+	switch format {
+	case "":
+		return queryFormatJSON, nil
+	case queryFormatJSON, queryFormatStream, queryFormatNDJSON:
+		return format, nil
+	default:
+		return "", internalErrors.Errorf(internalErrors.RESTGatewayQueryFormatInvalid, format)
+	}
+}
+
+// chunkedWriter flushes a streamed reply to the client each time a chunk has been written
+type chunkedWriter struct {
+	res     http.ResponseWriter
+	flusher http.Flusher
+	pending int
+	err     error
+}
+
+func newChunkedWriter(res http.ResponseWriter) *chunkedWriter {
+	flusher, _ := res.(http.Flusher)
+	return &chunkedWriter{res: res, flusher: flusher}
+}
+
+func (w *chunkedWriter) write(b []byte) {
+	for len(b) > 0 && w.err == nil {
+		n := queryStreamChunkSize - w.pending
+		if n > len(b) {
+			n = len(b)
+		}
+		_, w.err = w.res.Write(b[:n])
+		b = b[n:]
+		w.pending += n
+		if w.pending >= queryStreamChunkSize {
+			if w.flusher != nil {
+				w.flusher.Flush()
+			}
+			w.pending = 0
+		}
+	}
+}
+
+// streamQueryReply writes the same reply as sendReply, but copies the result returned by the
+// chaincode straight into the response, rather than decoding it and marshalling the whole reply
+// before the first byte is sent
+func streamQueryReply(res http.ResponseWriter, req *http.Request, reply *messages.QueryResult, result []byte) {
+	log.Infof("<-- %s %s [%d] (streamed %d bytes)", req.Method, req.URL, 200, len(result))
+	headers, _ := json.Marshal(&reply.Headers)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(200)
+	w := newChunkedWriter(res)
+	w.write([]byte(`{"headers":`))
+	w.write(headers)
+	if reply.Page != nil {
+		page, _ := json.Marshal(reply.Page)
+		w.write([]byte(`,"page":`))
+		w.write(page)
+	}
+	w.write([]byte(`,"result":`))
+	if json.Valid(result) {
+		w.write(result)
+	} else {
+		str, _ := json.Marshal(string(result))
+		w.write(str)
+	}
+	w.write([]byte("}\n"))
+	if w.err != nil {
+		log.Warnf("Streaming query result to the client failed: %s", w.err)
+	}
+}
+
+// streamQueryNDJSON writes a result that is a JSON array as newline delimited JSON, with one
+// element on each line. Any other result is written as a single line
+func streamQueryNDJSON(res http.ResponseWriter, req *http.Request, result []byte) {
+	log.Infof("<-- %s %s [%d] (streamed %d bytes as ndjson)", req.Method, req.URL, 200, len(result))
+	res.Header().Set("Content-Type", "application/x-ndjson")
+	res.WriteHeader(200)
+	w := newChunkedWriter(res)
+	if !json.Valid(result) {
+		str, _ := json.Marshal(string(result))
+		w.write(append(str, '\n'))
+		return
+	}
+	var line bytes.Buffer
+	dec := json.NewDecoder(bytes.NewReader(result))
+	if token, _ := dec.Token(); token != json.Delim('[') {
+		_ = json.Compact(&line, result)
+		line.WriteByte('\n')
+		w.write(line.Bytes())
+		return
+	}
+	// the result is valid JSON, so the elements decode without errors
+	for dec.More() && w.err == nil {
+		var element json.RawMessage
+		_ = dec.Decode(&element)
+		line.Reset()
+		_ = json.Compact(&line, element)
+		line.WriteByte('\n')
+		w.write(line.Bytes())
+	}
+	if w.err != nil {
+		log.Warnf("Streaming query result to the client failed: %s", w.err)
+	}
+}
@@ -23,9 +23,12 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
 	internalErrors "github.com/hyperledger/firefly-fabconnect/internal/errors"
 	"github.com/hyperledger/firefly-fabconnect/internal/messages"
 	restutil "github.com/hyperledger/firefly-fabconnect/internal/rest/utils"
@@ -45,15 +48,32 @@ type Dispatcher interface {
 	GetChainInfo(res http.ResponseWriter, req *http.Request, params httprouter.Params)
 	GetBlock(res http.ResponseWriter, req *http.Request, params httprouter.Params)
 	GetBlockByTxID(res http.ResponseWriter, req *http.Request, params httprouter.Params)
+	GetPrivateData(res http.ResponseWriter, req *http.Request, params httprouter.Params)
+	GetBlockHeight(res http.ResponseWriter, req *http.Request, params httprouter.Params)
+	SetAnchorPeers(res http.ResponseWriter, req *http.Request, params httprouter.Params)
+	SetMSPCACerts(res http.ResponseWriter, req *http.Request, params httprouter.Params)
+}
+
+// How often the height of the chain is checked, while a block height request waits for it to grow
+const blockHeightPollInterval = 500 * time.Millisecond
+
+// Errors from the peer when the org of the signer is not a member of a collection with memberOnlyRead
+var privateDataAccessDenied = []string{
+	"does not have read access permission",
+	"access denied",
 }
 
 type dispatcher struct {
-	processor tx.Processor
+	processor        tx.Processor
+	ethconnectCompat bool
+	resultDecoders   *utils.ResultDecoders
 }
 
-func NewDispatcher(processor tx.Processor) Dispatcher {
+func NewDispatcher(conf *conf.RESTGatewayConf, processor tx.Processor, resultDecoders *utils.ResultDecoders) Dispatcher {
 	return &dispatcher{
-		processor: processor,
+		processor:        processor,
+		ethconnectCompat: conf.EthconnectCompat,
+		resultDecoders:   resultDecoders,
 	}
 }
 
@@ -96,7 +116,7 @@ func (t *syncTxInflight) SendErrorReplyWithTX(status int, err error, txHash stri
 func (t *syncTxInflight) Reply(replyMessage messages.ReplyWithHeaders) {
 	headers := t.Headers()
 	replyHeaders := replyMessage.ReplyHeaders()
-	replyHeaders.ID = utils.UUIDv4()
+	replyHeaders.ID = utils.NewID()
 	replyHeaders.Context = headers.Context
 	replyHeaders.ReqID = headers.ID
 	replyHeaders.Received = t.timeReceived.UTC().Format(time.RFC3339Nano)
@@ -116,10 +136,11 @@ type restReceiptAndError struct {
 }
 
 type syncResponder struct {
-	res    http.ResponseWriter
-	req    *http.Request
-	done   bool
-	waiter *sync.Cond
+	res              http.ResponseWriter
+	req              *http.Request
+	done             bool
+	waiter           *sync.Cond
+	ethconnectCompat bool
 }
 
 func (i *syncResponder) ReplyWithError(err error) {
@@ -145,7 +166,12 @@ func (i *syncResponder) ReplyWithReceipt(receipt messages.ReplyWithHeaders) {
 	if receipt.ReplyHeaders().MsgType != messages.MsgTypeTransactionSuccess && receipt.ReplyHeaders().MsgType != messages.MsgTypeQuerySuccess {
 		status = 500
 	}
-	reply, _ := json.MarshalIndent(receipt, "", "  ")
+	var reply []byte
+	if i.ethconnectCompat {
+		reply, _ = messages.MarshalEthconnectReply(receipt)
+	} else {
+		reply, _ = json.MarshalIndent(receipt, "", "  ")
+	}
 	log.Infof("<-- %s %s [%d]", i.req.Method, i.req.URL, status)
 	log.Debugf("<-- %s", reply)
 	i.res.Header().Set("Content-Type", "application/json")
@@ -158,10 +184,11 @@ func (i *syncResponder) ReplyWithReceipt(receipt messages.ReplyWithHeaders) {
 // handles transactions that require tracking transaction results
 func (d *dispatcher) DispatchMsgSync(ctx context.Context, res http.ResponseWriter, req *http.Request, msg interface{}) {
 	responder := &syncResponder{
-		res:    res,
-		req:    req,
-		done:   false,
-		waiter: sync.NewCond(&sync.Mutex{}),
+		res:              res,
+		req:              req,
+		done:             false,
+		waiter:           sync.NewCond(&sync.Mutex{}),
+		ethconnectCompat: d.ethconnectCompat,
 	}
 	syncCtx := &syncTxInflight{
 		replyProcessor: responder,
@@ -187,8 +214,31 @@ func (d *dispatcher) QueryChaincode(res http.ResponseWriter, req *http.Request,
 		internalErrors.RestErrReply(res, req, err.Error, err.StatusCode)
 		return
 	}
+	format, err1 := getQueryFormat(req)
+	if err1 != nil {
+		internalErrors.RestErrReply(res, req, err1, 400)
+		return
+	}
 
-	result, err1 := d.processor.GetRPCClient().Query(msg.Headers.ChannelID, msg.Headers.Signer, msg.Headers.ChaincodeName, msg.Function, msg.Args, msg.StrongRead)
+	if msg.MinBlockNumber > 0 {
+		// the height is the number of blocks, so block N is committed once it is above N
+		height, err1 := d.waitForHeight(req.Context(), msg.Headers.ChannelID, msg.Headers.Signer, msg.MinBlockNumber, msg.BlockNumberTimeout)
+		if err1 != nil {
+			internalErrors.RestErrReply(res, req, err1, 500)
+			return
+		}
+		if height <= msg.MinBlockNumber {
+			internalErrors.RestErrReply(res, req, internalErrors.Errorf(internalErrors.RESTGatewayQueryBlockNotCommitted, msg.MinBlockNumber, msg.Headers.ChannelID, height), 504)
+			return
+		}
+	}
+
+	args := msg.Args
+	if msg.PageSize > 0 {
+		args = append(append([]string{}, msg.Args...), strconv.FormatInt(int64(msg.PageSize), 10), msg.Bookmark)
+	}
+
+	result, err1 := d.processor.GetRPCClient().Query(req.Context(), msg.Headers.ChannelID, msg.Headers.Signer, msg.Headers.ChaincodeName, msg.Function, args, msg.StrongRead)
 	callTime := time.Now().UTC().Sub(start)
 	if err1 != nil {
 		log.Warnf("Query [chaincode=%s, func=%s] failed to send: %s [%.2fs]", msg.Headers.ChaincodeName, msg.Function, err1, callTime.Seconds())
@@ -199,8 +249,36 @@ func (d *dispatcher) QueryChaincode(res http.ResponseWriter, req *http.Request,
 	var reply messages.QueryResult
 	reply.Headers.ChannelID = msg.Headers.ChannelID
 	reply.Headers.ID = msg.Headers.ID
-	reply.Result = utils.DecodePayload(result)
-	sendReply(res, req, reply)
+	if msg.PageSize > 0 {
+		reply.Page = queryPage(msg, result)
+	}
+	switch format {
+	case queryFormatStream:
+		streamQueryReply(res, req, &reply, result)
+	case queryFormatNDJSON:
+		streamQueryNDJSON(res, req, result)
+	default:
+		reply.Result = d.resultDecoders.Decode(msg.Headers.ChannelID, msg.Headers.ChaincodeName, msg.Function, result)
+		sendReply(res, req, reply)
+	}
+}
+
+// queryPage reads the bookmark of the next page from the result of a paginated query. Chaincodes
+// following the convention return it with the records, as {"records":[],"fetchedRecordsCount":0,"bookmark":""}
+func queryPage(msg *messages.QueryChaincode, result []byte) *messages.QueryPage {
+	var metadata struct {
+		FetchedRecordsCount int32  `json:"fetchedRecordsCount"`
+		Bookmark            string `json:"bookmark"`
+	}
+	if err := json.Unmarshal(result, &metadata); err != nil {
+		log.Warnf("Result of paginated query [chaincode=%s, func=%s] has no bookmark: %s", msg.Headers.ChaincodeName, msg.Function, err)
+	}
+	return &messages.QueryPage{
+		PageSize:            msg.PageSize,
+		Bookmark:            msg.Bookmark,
+		NextBookmark:        metadata.Bookmark,
+		FetchedRecordsCount: metadata.FetchedRecordsCount,
+	}
 }
 
 func (d *dispatcher) GetTxByID(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
@@ -211,7 +289,7 @@ func (d *dispatcher) GetTxByID(res http.ResponseWriter, req *http.Request, param
 		return
 	}
 
-	result, err1 := d.processor.GetRPCClient().QueryTransaction(msg.Headers.ChannelID, msg.Headers.Signer, msg.TxID)
+	result, err1 := d.processor.GetRPCClient().QueryTransaction(req.Context(), msg.Headers.ChannelID, msg.Headers.Signer, msg.TxID)
 	callTime := time.Now().UTC().Sub(start)
 	if err1 != nil {
 		log.Warnf("Query transaction %s failed to send: %s [%.2fs]", msg.TxID, err1, callTime.Seconds())
@@ -225,6 +303,91 @@ func (d *dispatcher) GetTxByID(res http.ResponseWriter, req *http.Request, param
 	sendReply(res, req, reply)
 }
 
+// GetBlockHeight long-polls until the height of the chain is above waitAbove, so clients can wait
+// for a commit without an event subscription. The current height is returned when the timeout expires
+func (d *dispatcher) GetBlockHeight(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	msg, err := restutil.BuildGetBlockHeightMessage(res, req, params)
+	if err != nil {
+		internalErrors.RestErrReply(res, req, err.Error, err.StatusCode)
+		return
+	}
+
+	height, err1 := d.waitForHeight(req.Context(), msg.Headers.ChannelID, msg.Headers.Signer, msg.WaitAbove, msg.Timeout)
+	if err1 != nil {
+		internalErrors.RestErrReply(res, req, err1, 500)
+		return
+	}
+	if req.Context().Err() != nil {
+		log.Infof("Block height request for channel %s abandoned by the client", msg.Headers.ChannelID)
+		return
+	}
+	var reply messages.LedgerQueryResult
+	m := make(map[string]interface{})
+	m["height"] = height
+	m["timedOut"] = height <= msg.WaitAbove
+	reply.Result = m
+	sendReply(res, req, reply)
+}
+
+// waitForHeight polls the height of the chain until it is above waitAbove, the timeout expires or
+// the context is cancelled, and returns the last height
+func (d *dispatcher) waitForHeight(ctx context.Context, channelID, signer string, waitAbove uint64, timeout time.Duration) (uint64, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		result, err := d.processor.GetRPCClient().QueryChainInfo(ctx, channelID, signer)
+		if err != nil {
+			return 0, err
+		}
+		height := result.BCI.Height
+		wait := time.Until(deadline)
+		if height > waitAbove || wait <= 0 {
+			return height, nil
+		}
+		if wait > blockHeightPollInterval {
+			wait = blockHeightPollInterval
+		}
+		select {
+		case <-ctx.Done():
+			return height, nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (d *dispatcher) GetPrivateData(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	start := time.Now().UTC()
+	msg, err := restutil.BuildGetPrivateDataMessage(res, req, params)
+	if err != nil {
+		internalErrors.RestErrReply(res, req, err.Error, err.StatusCode)
+		return
+	}
+
+	result, err1 := d.processor.GetRPCClient().Query(req.Context(), msg.Headers.ChannelID, msg.Headers.Signer, msg.Headers.ChaincodeName, msg.Function, []string{msg.Collection, msg.Key}, false)
+	callTime := time.Now().UTC().Sub(start)
+	if err1 != nil {
+		log.Warnf("Private data query [chaincode=%s, collection=%s] failed to send: %s [%.2fs]", msg.Headers.ChaincodeName, msg.Collection, err1, callTime.Seconds())
+		errMsg := strings.ToLower(err1.Error())
+		for _, denied := range privateDataAccessDenied {
+			if strings.Contains(errMsg, denied) {
+				internalErrors.RestErrReply(res, req, internalErrors.Errorf(internalErrors.RESTGatewayPrivateDataAccessDenied, msg.Headers.Signer, msg.Collection, err1), 403)
+				return
+			}
+		}
+		internalErrors.RestErrReply(res, req, err1, 500)
+		return
+	}
+	log.Infof("Private data query [chaincode=%s, collection=%s] [%.2fs]", msg.Headers.ChaincodeName, msg.Collection, callTime.Seconds())
+	if len(result) == 0 {
+		internalErrors.RestErrReply(res, req, internalErrors.Errorf(internalErrors.RESTGatewayPrivateDataNotFound, msg.Key, msg.Collection), 404)
+		return
+	}
+	var reply messages.QueryResult
+	reply.Headers.ChannelID = msg.Headers.ChannelID
+	reply.Headers.ID = msg.Headers.ID
+	reply.Result = utils.DecodePayload(result)
+	sendReply(res, req, reply)
+}
+
 func (d *dispatcher) GetChainInfo(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	msg, err := restutil.BuildGetChainInfoMessage(res, req, params)
 	if err != nil {
@@ -232,7 +395,7 @@ func (d *dispatcher) GetChainInfo(res http.ResponseWriter, req *http.Request, pa
 		return
 	}
 
-	result, err1 := d.processor.GetRPCClient().QueryChainInfo(msg.Headers.ChannelID, msg.Headers.Signer)
+	result, err1 := d.processor.GetRPCClient().QueryChainInfo(req.Context(), msg.Headers.ChannelID, msg.Headers.Signer)
 	if err1 != nil {
 		internalErrors.RestErrReply(res, req, err1, 500)
 		return
@@ -254,7 +417,7 @@ func (d *dispatcher) GetBlock(res http.ResponseWriter, req *http.Request, params
 		return
 	}
 
-	rawblock, block, err1 := d.processor.GetRPCClient().QueryBlock(msg.Headers.ChannelID, msg.Headers.Signer, msg.BlockNumber, msg.BlockHash)
+	rawblock, block, err1 := d.processor.GetRPCClient().QueryBlock(req.Context(), msg.Headers.ChannelID, msg.Headers.Signer, msg.BlockNumber, msg.BlockHash)
 	if err1 != nil {
 		internalErrors.RestErrReply(res, req, err1, 500)
 		return
@@ -275,7 +438,7 @@ func (d *dispatcher) GetBlockByTxID(res http.ResponseWriter, req *http.Request,
 		return
 	}
 
-	rawblock, block, err1 := d.processor.GetRPCClient().QueryBlockByTxID(msg.Headers.ChannelID, msg.Headers.Signer, msg.TxID)
+	rawblock, block, err1 := d.processor.GetRPCClient().QueryBlockByTxID(req.Context(), msg.Headers.ChannelID, msg.Headers.Signer, msg.TxID)
 	if err1 != nil {
 		internalErrors.RestErrReply(res, req, err1, 500)
 		return
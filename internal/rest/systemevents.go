@@ -0,0 +1,36 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"github.com/hyperledger/firefly-fabconnect/internal/fabric/client"
+	"github.com/hyperledger/firefly-fabconnect/internal/ws"
+)
+
+const (
+	systemEventChannelConfigUpdated = "channelConfigUpdated"
+)
+
+// systemEvents broadcasts the events of the RPC client to the WebSocket clients
+// listening on the reserved system topic
+type systemEvents struct {
+	publisher *ws.SystemEventPublisher
+}
+
+func (s *systemEvents) ChannelConfigUpdated(update *client.ChannelConfigUpdate) {
+	s.publisher.Publish(systemEventChannelConfigUpdated, update)
+}
@@ -0,0 +1,49 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"testing"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/fabric/client"
+	"github.com/hyperledger/firefly-fabconnect/internal/ws"
+	mockws "github.com/hyperledger/firefly-fabconnect/mocks/ws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSystemEventChannelConfigUpdated(t *testing.T) {
+	assert := assert.New(t)
+	broadcast := make(chan interface{}, 1)
+	wsChannels := &mockws.WebSocketChannels{}
+	wsChannels.On("GetChannels", "fabconnect_system").Return(nil, (chan<- interface{})(broadcast), nil, nil)
+
+	update := &client.ChannelConfigUpdate{
+		ChannelID:        "channel1",
+		BlockNumber:      10,
+		Orderers:         []string{"orderer1:7050"},
+		PreviousOrderers: []string{"orderer0:7050"},
+	}
+	publisher := ws.NewSystemEventPublisher(wsChannels)
+	defer publisher.Close()
+	(&systemEvents{publisher: publisher}).ChannelConfigUpdated(update)
+
+	event := (<-broadcast).(*ws.SystemEvent)
+	assert.Equal("channelConfigUpdated", event.Type)
+	assert.NotZero(event.Timestamp)
+	assert.Same(update, event.Data)
+	wsChannels.AssertExpectations(t)
+}
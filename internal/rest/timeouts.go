@@ -0,0 +1,117 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	restutil "github.com/hyperledger/firefly-fabconnect/internal/rest/utils"
+	"github.com/hyperledger/firefly-fabconnect/internal/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadTimeout       = 60 * time.Second
+	defaultWriteTimeout      = 60 * time.Second
+	defaultIdleTimeout       = 120 * time.Second
+)
+
+type serverTimeouts struct {
+	readHeader time.Duration
+	read       time.Duration
+	write      time.Duration
+	idle       time.Duration
+	// write timeouts of routes, keyed by lowercase path prefix
+	routeWrite map[string]time.Duration
+}
+
+func timeoutOrDefault(sec int, def time.Duration) time.Duration {
+	if sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+	return def
+}
+
+func newServerTimeouts(config *conf.HTTPConf) *serverTimeouts {
+	t := &serverTimeouts{
+		readHeader: timeoutOrDefault(config.ReadHeaderTimeoutSec, defaultReadHeaderTimeout),
+		read:       timeoutOrDefault(config.ReadTimeoutSec, defaultReadTimeout),
+		write:      timeoutOrDefault(config.WriteTimeoutSec, defaultWriteTimeout),
+		idle:       timeoutOrDefault(config.IdleTimeoutSec, defaultIdleTimeout),
+		routeWrite: make(map[string]time.Duration),
+	}
+	for prefix, sec := range config.RouteWriteTimeouts {
+		t.routeWrite[strings.ToLower(prefix)] = time.Duration(sec) * time.Second
+	}
+	return t
+}
+
+// routeWriteTimeout returns the configured write timeout of the longest path prefix matching the route
+func (t *serverTimeouts) routeWriteTimeout(path string) (time.Duration, bool) {
+	path = strings.ToLower(path)
+	match := ""
+	for prefix := range t.routeWrite {
+		if strings.HasPrefix(path, prefix) && len(prefix) > len(match) {
+			match = prefix
+		}
+	}
+	if match == "" {
+		return 0, false
+	}
+	return t.routeWrite[match], true
+}
+
+// newRouteTimeoutHandler relaxes the server timeouts for the routes that legitimately outlive them.
+// WebSockets are long-lived, and transactions can wait up to maxTXWaitTime for their receipt
+// before the reply is written, as can block height long-polls and queries waiting for a block. Routes with a configured write timeout use that instead (0=none)
+func (g *Gateway) newRouteTimeoutHandler(timeouts *serverTimeouts, handler http.Handler) http.Handler {
+	txWait := time.Duration(g.config.MaxTXWaitTime) * time.Second
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		rc := http.NewResponseController(res)
+		var err error
+		routeWrite, hasRouteWrite := timeouts.routeWriteTimeout(req.URL.Path)
+		switch {
+		case req.URL.Path == "/ws":
+			if err = rc.SetReadDeadline(time.Time{}); err == nil {
+				err = rc.SetWriteDeadline(time.Time{})
+			}
+		case hasRouteWrite && routeWrite == 0:
+			err = rc.SetWriteDeadline(time.Time{})
+		case hasRouteWrite:
+			err = rc.SetWriteDeadline(time.Now().Add(routeWrite))
+		case strings.HasSuffix(req.URL.Path, "/blockheight"), req.URL.Path == "/query" && waitsForBlock(req):
+			err = rc.SetWriteDeadline(time.Now().Add(restutil.MaxBlockHeightWait + timeouts.write))
+		case req.Method == http.MethodPost && req.URL.Path == "/transactions" && txWait > 0:
+			err = rc.SetWriteDeadline(time.Now().Add(txWait + timeouts.write))
+		}
+		if err != nil {
+			log.Warnf("Failed to relax the timeouts of %s %s: %s", req.Method, req.URL.Path, err)
+		}
+		handler.ServeHTTP(res, req)
+	})
+}
+
+// waitsForBlock is true for a query that sets the block it must see in its query parameters or
+// headers. Queries that set it in the body wait within the default write timeout
+func waitsForBlock(req *http.Request) bool {
+	return req.URL.Query().Get(utils.GetenvOrDefaultLowerCase("PREFIX_SHORT", "fly")+"-blocknumber") != "" ||
+		req.Header.Get("x-"+utils.GetenvOrDefaultLowerCase("PREFIX_LONG", "firefly")+"-blocknumber") != ""
+}
@@ -0,0 +1,69 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerTimeoutDefaults(t *testing.T) {
+	assert := assert.New(t)
+	timeouts := newServerTimeouts(&conf.HTTPConf{
+		WriteTimeoutSec:    5,
+		RouteWriteTimeouts: map[string]int{"/blockByTxId": 30, "/blocks": 0, "/block": 10},
+	})
+	assert.Equal(defaultReadHeaderTimeout, timeouts.readHeader)
+	assert.Equal(defaultReadTimeout, timeouts.read)
+	assert.Equal(5*time.Second, timeouts.write)
+	assert.Equal(defaultIdleTimeout, timeouts.idle)
+
+	d, ok := timeouts.routeWriteTimeout("/blockbytxid/abc")
+	assert.True(ok)
+	assert.Equal(30*time.Second, d)
+	d, ok = timeouts.routeWriteTimeout("/blocks/1")
+	assert.True(ok)
+	assert.Equal(time.Duration(0), d)
+	_, ok = timeouts.routeWriteTimeout("/status")
+	assert.False(ok)
+}
+
+func TestRouteTimeoutHandlerExtendsTransactions(t *testing.T) {
+	assert := assert.New(t)
+	g := &Gateway{config: &conf.RESTGatewayConf{MaxTXWaitTime: 1}}
+	timeouts := newServerTimeouts(&conf.HTTPConf{})
+	timeouts.write = 100 * time.Millisecond
+	svr := httptest.NewUnstartedServer(g.newRouteTimeoutHandler(timeouts, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		res.WriteHeader(200)
+	})))
+	svr.Config.WriteTimeout = timeouts.write
+	svr.Start()
+	defer svr.Close()
+
+	res, err := http.Post(svr.URL+"/transactions", "application/json", nil)
+	assert.NoError(err)
+	assert.Equal(200, res.StatusCode)
+
+	_, err = http.Post(svr.URL+"/query", "application/json", nil)
+	assert.Error(err)
+}
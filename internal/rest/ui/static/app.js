@@ -0,0 +1,282 @@
+// Admin UI for fabconnect, built only on the REST APIs and the WebSocket
+// system topic of the connector, so it needs no server side support
+(function () {
+  'use strict';
+
+  const SYSTEM_TOPIC = 'fabconnect_system';
+  const HEIGHT_SAMPLES = 60;
+  const HEIGHT_INTERVAL_MS = 10000;
+
+  const heights = {};
+  let subscriptions = [];
+
+  function token() {
+    return sessionStorage.getItem('fabconnect-token') || '';
+  }
+
+  async function api(method, path, body) {
+    const headers = { 'Content-Type': 'application/json' };
+    if (token()) {
+      headers.Authorization = 'Bearer ' + token();
+    }
+    const res = await fetch(path, {
+      method: method,
+      headers: headers,
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    const text = await res.text();
+    let json;
+    try {
+      json = text ? JSON.parse(text) : null;
+    } catch (err) {
+      json = text;
+    }
+    if (!res.ok) {
+      throw new Error((json && json.error) || res.status + ' ' + res.statusText);
+    }
+    return json;
+  }
+
+  function el(tag, text, className) {
+    const e = document.createElement(tag);
+    if (text !== undefined && text !== null) {
+      e.textContent = String(text);
+    }
+    if (className) {
+      e.className = className;
+    }
+    return e;
+  }
+
+  function button(label, onClick) {
+    const b = el('button', label);
+    b.addEventListener('click', onClick);
+    return b;
+  }
+
+  function fillTable(id, rows) {
+    const tbody = document.querySelector('#' + id + ' tbody');
+    tbody.replaceChildren();
+    rows.forEach(function (cells) {
+      const tr = el('tr');
+      cells.forEach(function (cell) {
+        const td = el('td');
+        if (cell instanceof Node) {
+          td.appendChild(cell);
+        } else if (Array.isArray(cell)) {
+          cell.forEach(function (c) { td.appendChild(c); });
+        } else {
+          td.textContent = cell === undefined || cell === null ? '' : String(cell);
+        }
+        tr.appendChild(td);
+      });
+      tbody.appendChild(tr);
+    });
+  }
+
+  function log(message, isError) {
+    const list = document.getElementById('activity');
+    list.insertBefore(el('li', new Date().toLocaleTimeString() + '  ' + message, isError ? 'error' : ''), list.firstChild);
+    while (list.children.length > 200) {
+      list.removeChild(list.lastChild);
+    }
+  }
+
+  function action(description, fn) {
+    return async function () {
+      try {
+        await fn();
+        log(description);
+      } catch (err) {
+        log(description + ' failed: ' + err.message, true);
+      }
+      refresh();
+    };
+  }
+
+  async function loadStreams() {
+    const streams = await api('GET', '/eventstreams');
+    fillTable('streams', streams.map(function (s) {
+      const suspended = !!s.suspended;
+      const target = s.type === 'websocket' ? (s.websocket && s.websocket.topic) : (s.webhook && s.webhook.url);
+      return [
+        s.id, s.name, s.type, target, s.batchSize, s.errorHandling,
+        suspended ? 'suspended' : 'running',
+        [
+          suspended ?
+            button('Resume', action('Resumed stream ' + s.id, function () { return api('POST', '/eventstreams/' + s.id + '/resume'); })) :
+            button('Suspend', action('Suspended stream ' + s.id, function () { return api('POST', '/eventstreams/' + s.id + '/suspend'); })),
+          button('Delete', function () {
+            if (confirm('Delete event stream ' + s.id + ' and all its subscriptions?')) {
+              action('Deleted stream ' + s.id, function () { return api('DELETE', '/eventstreams/' + s.id); })();
+            }
+          }),
+        ],
+      ];
+    }));
+  }
+
+  async function loadSubscriptions() {
+    subscriptions = await api('GET', '/subscriptions');
+    fillTable('subscriptions', subscriptions.map(function (s) {
+      return [
+        s.id, s.name, s.channel, s.filter.chaincodeId, s.filter.eventFilter || s.filter.blockType, s.stream, s.signer, s.fromBlock,
+        [
+          button('Reset', function () {
+            const block = prompt('Restart subscription ' + s.id + ' from block ("newest" or a block number)', 'newest');
+            if (block !== null) {
+              action('Reset subscription ' + s.id, function () { return api('POST', '/subscriptions/' + s.id + '/reset', { initialBlock: block }); })();
+            }
+          }),
+          button('Delete', function () {
+            if (confirm('Delete subscription ' + s.id + '?')) {
+              action('Deleted subscription ' + s.id, function () { return api('DELETE', '/subscriptions/' + s.id); })();
+            }
+          }),
+        ],
+      ];
+    }));
+  }
+
+  async function loadReceipts() {
+    const receipts = await api('GET', '/receipts?limit=100');
+    fillTable('receipts', receipts.map(function (r) {
+      const h = r.headers || {};
+      return [h.requestId || r._id, h.type, h.timeReceived, h.timeElapsed, r.blockNumber, r.transactionHash];
+    }));
+    drawChart(document.getElementById('latency-chart'), receipts
+      .filter(function (r) { return r.headers && r.headers.timeElapsed !== undefined; })
+      .map(function (r) { return r.headers.timeElapsed; })
+      .reverse());
+  }
+
+  async function loadIdentities() {
+    const identities = await api('GET', '/identities');
+    fillTable('identities', identities.map(function (i) {
+      const attrs = Object.keys(i.attributes || {}).map(function (k) { return k + '=' + i.attributes[k]; }).join(', ');
+      return [i.name, i.type, i.affiliation, i.caname, i.maxEnrollments, attrs];
+    }));
+  }
+
+  async function sampleHeights() {
+    const channels = {};
+    subscriptions.forEach(function (s) {
+      if (s.channel && !channels[s.channel]) {
+        channels[s.channel] = s.signer;
+      }
+    });
+    await Promise.all(Object.keys(channels).map(async function (channel) {
+      try {
+        const info = await api('GET', '/chaininfo?fly-channel=' + encodeURIComponent(channel) + '&fly-signer=' + encodeURIComponent(channels[channel]));
+        const samples = heights[channel] = heights[channel] || [];
+        samples.push(info.result.height);
+        if (samples.length > HEIGHT_SAMPLES) {
+          samples.shift();
+        }
+      } catch (err) {
+        log('Failed to query the height of channel ' + channel + ': ' + err.message, true);
+      }
+    }));
+    const charts = document.getElementById('height-charts');
+    charts.replaceChildren();
+    Object.keys(heights).sort().forEach(function (channel) {
+      charts.appendChild(el('h3', channel));
+      const svg = document.createElementNS('http://www.w3.org/2000/svg', 'svg');
+      svg.setAttribute('class', 'chart');
+      svg.setAttribute('viewBox', '0 0 600 160');
+      svg.setAttribute('preserveAspectRatio', 'none');
+      charts.appendChild(svg);
+      drawChart(svg, heights[channel]);
+    });
+  }
+
+  function drawChart(svg, values) {
+    svg.replaceChildren();
+    if (values.length === 0) {
+      return;
+    }
+    const min = Math.min.apply(null, values);
+    const max = Math.max.apply(null, values);
+    const range = max - min || 1;
+    const step = values.length > 1 ? 580 / (values.length - 1) : 0;
+    const points = values.map(function (v, i) {
+      return (10 + i * step).toFixed(1) + ',' + (150 - ((v - min) / range) * 130).toFixed(1);
+    });
+    const line = document.createElementNS('http://www.w3.org/2000/svg', 'polyline');
+    line.setAttribute('points', points.join(' '));
+    svg.appendChild(line);
+    [[max, 12], [min, 158]].forEach(function (label) {
+      const text = document.createElementNS('http://www.w3.org/2000/svg', 'text');
+      text.setAttribute('x', '2');
+      text.setAttribute('y', String(label[1]));
+      text.textContent = String(label[0]);
+      svg.appendChild(text);
+    });
+  }
+
+  async function loadStatus() {
+    const status = document.getElementById('status');
+    try {
+      await api('GET', '/status');
+      status.textContent = 'ok';
+      status.className = 'badge ok';
+    } catch (err) {
+      status.textContent = 'unavailable';
+      status.className = 'badge error';
+    }
+  }
+
+  async function refresh() {
+    const loaders = [loadStatus, loadStreams, loadSubscriptions, loadReceipts, loadIdentities];
+    await Promise.all(loaders.map(async function (load) {
+      try {
+        await load();
+      } catch (err) {
+        log(load.name.replace(/^load/, '') + ': ' + err.message, true);
+      }
+    }));
+  }
+
+  function connectSystemEvents() {
+    const live = document.getElementById('live');
+    const ws = new WebSocket((location.protocol === 'https:' ? 'wss://' : 'ws://') + location.host + '/ws');
+    ws.onopen = function () {
+      ws.send(JSON.stringify({ type: 'listen', topic: SYSTEM_TOPIC }));
+      live.textContent = 'live: on';
+      live.className = 'badge ok';
+    };
+    ws.onmessage = function (msg) {
+      const event = JSON.parse(msg.data);
+      const data = event.data || {};
+      let description = event.type + (data.id ? ' ' + data.id : '') + (data.channel ? ' ' + data.channel : '');
+      if (data.error) {
+        description += ': ' + data.error;
+      }
+      log(description, /Errored$/.test(event.type));
+      refresh();
+    };
+    ws.onclose = function () {
+      live.textContent = 'live: off';
+      live.className = 'badge';
+      setTimeout(connectSystemEvents, 5000);
+    };
+  }
+
+  document.querySelectorAll('nav button').forEach(function (b) {
+    b.addEventListener('click', function () {
+      document.querySelectorAll('nav button, .tab').forEach(function (e) { e.classList.remove('active'); });
+      b.classList.add('active');
+      document.getElementById(b.dataset.tab).classList.add('active');
+    });
+  });
+
+  document.getElementById('token-form').addEventListener('submit', function (e) {
+    e.preventDefault();
+    sessionStorage.setItem('fabconnect-token', document.getElementById('token').value);
+    refresh();
+  });
+
+  refresh().then(sampleHeights);
+  setInterval(sampleHeights, HEIGHT_INTERVAL_MS);
+  connectSystemEvents();
+})();
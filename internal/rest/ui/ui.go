@@ -0,0 +1,38 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ui
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// PathPrefix is the path the admin UI is served under
+const PathPrefix = "/ui"
+
+// The admin UI is a static single page app, built only on the REST APIs of
+// the connector, so it is embedded into the binary as-is
+//
+//go:embed static
+var staticFiles embed.FS
+
+// FileSystem returns the static assets of the admin UI
+func FileSystem() http.FileSystem {
+	static, _ := fs.Sub(staticFiles, "static")
+	return http.FS(static)
+}
@@ -0,0 +1,43 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"github.com/hyperledger/firefly-fabconnect/internal/usage"
+)
+
+// startUsage accounts the usage of the components that track it to tenants, and
+// exports it periodically when an export path is configured
+func (g *Gateway) startUsage() error {
+	g.usage = usage.NewTracker()
+	if source, ok := g.processor.(usage.Source); ok {
+		g.usage.AddSource(source)
+	}
+	if source, ok := g.sm.(usage.Source); ok {
+		g.usage.AddSource(source)
+	}
+	if g.config.Usage.ExportPath == "" {
+		return nil
+	}
+	exporter, err := usage.NewExporter(&g.config.Usage, g.usage)
+	if err != nil {
+		return err
+	}
+	exporter.Start()
+	g.usageExporter = exporter
+	return nil
+}
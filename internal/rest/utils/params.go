@@ -21,10 +21,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/hyperledger/firefly-fabconnect/internal/auth"
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	internalErrors "github.com/hyperledger/firefly-fabconnect/internal/errors"
 	"github.com/hyperledger/firefly-fabconnect/internal/messages"
 	"github.com/hyperledger/firefly-fabconnect/internal/utils"
 	"github.com/julienschmidt/httprouter"
@@ -71,6 +76,22 @@ func getFlyParam(name string, body map[string]interface{}, req *http.Request) st
 	return valStr
 }
 
+// getSigner reads the fly-signer param. A client bound to a signer by its TLS client certificate
+// uses that signer without specifying it, and cannot specify a different one
+func getSigner(body map[string]interface{}, req *http.Request) (string, *RestError) {
+	signer := getFlyParam("signer", body, req)
+	if bound := auth.GetClientCertSigner(req.Context()); bound != "" {
+		if signer != "" && signer != bound {
+			return "", NewRestError(internalErrors.Errorf(internalErrors.RESTGatewayClientCertSignerMismatch, signer, bound).Error(), 403)
+		}
+		return bound, nil
+	}
+	if signer == "" {
+		return "", NewRestError("Must specify the signer", 400)
+	}
+	return signer, nil
+}
+
 func getQueryParamNoCase(name string, req *http.Request) []string {
 	name = strings.ToLower(name)
 	for k, vs := range req.Form {
@@ -96,9 +117,9 @@ func BuildQueryMessage(_ http.ResponseWriter, req *http.Request, _ httprouter.Pa
 	if channel == "" {
 		return nil, NewRestError("Must specify the channel", 400)
 	}
-	signer := getFlyParam("signer", body, req)
-	if signer == "" {
-		return nil, NewRestError("Must specify the signer", 400)
+	signer, restErr := getSigner(body, req)
+	if restErr != nil {
+		return nil, restErr
 	}
 	chaincode := getFlyParam("chaincode", body, req)
 	if chaincode == "" {
@@ -135,10 +156,79 @@ func BuildQueryMessage(_ http.ResponseWriter, req *http.Request, _ httprouter.Pa
 			msg.StrongRead = strongread.(bool)
 		}
 	}
+	if restErr := processPagination(body, &msg); restErr != nil {
+		return nil, restErr
+	}
+	if restErr := processMinBlockNumber(body, req, &msg); restErr != nil {
+		return nil, restErr
+	}
 
 	return &msg, nil
 }
 
+// processMinBlockNumber reads the "blocknumber" fly parameter, of the block a query must see, and
+// the "blocknumberTimeout" in seconds to wait for it to be committed, capped at MaxBlockHeightWait
+func processMinBlockNumber(body map[string]interface{}, req *http.Request, msg *messages.QueryChaincode) *RestError {
+	blockNumber := getFlyParam("blocknumber", body, req)
+	if blockNumber == "" {
+		return nil
+	}
+	var err error
+	msg.MinBlockNumber, err = strconv.ParseUint(blockNumber, 10, 64)
+	if err != nil {
+		return NewRestError(fmt.Sprintf("Invalid blocknumber '%s'", blockNumber), 400)
+	}
+	msg.BlockNumberTimeout = DefaultBlockHeightWait
+	if timeoutVal := getFlyParam("blocknumberTimeout", body, req); timeoutVal != "" {
+		timeout, err := strconv.Atoi(timeoutVal)
+		if err != nil || timeout < 0 {
+			return NewRestError(fmt.Sprintf("Invalid blocknumber timeout '%s'", timeoutVal), 400)
+		}
+		msg.BlockNumberTimeout = time.Duration(timeout) * time.Second
+		if msg.BlockNumberTimeout > MaxBlockHeightWait {
+			msg.BlockNumberTimeout = MaxBlockHeightWait
+		}
+	}
+	return nil
+}
+
+// processPagination reads the "pageSize" and "bookmark" of a paginated query. The bookmark is
+// empty for the first page, and the "nextBookmark" of the previous page for the others
+func processPagination(body map[string]interface{}, msg *messages.QueryChaincode) *RestError {
+	pageSize := body["pageSize"]
+	if pageSize != nil {
+		var size int64
+		var err error
+		switch v := pageSize.(type) {
+		case string:
+			size, err = strconv.ParseInt(v, 10, 32)
+		case float64:
+			size = int64(v)
+			if float64(size) != v || size > math.MaxInt32 {
+				err = fmt.Errorf("not an int32")
+			}
+		default:
+			err = fmt.Errorf("not a number")
+		}
+		if err != nil || size <= 0 {
+			return NewRestError(fmt.Sprintf("Invalid pageSize '%v'", pageSize), 400)
+		}
+		msg.PageSize = int32(size)
+	}
+	bookmark := body["bookmark"]
+	if bookmark != nil {
+		bookmarkStr, ok := bookmark.(string)
+		if !ok {
+			return NewRestError(`The "bookmark" must be a string`, 400)
+		}
+		msg.Bookmark = bookmarkStr
+	}
+	if msg.Bookmark != "" && msg.PageSize == 0 {
+		return NewRestError("Must specify the pageSize with a bookmark", 400)
+	}
+	return nil
+}
+
 func BuildTxByIDMessage(_ http.ResponseWriter, req *http.Request, params httprouter.Params) (*messages.GetTxByID, *RestError) {
 	var body map[string]interface{}
 	err := req.ParseForm()
@@ -150,9 +240,9 @@ func BuildTxByIDMessage(_ http.ResponseWriter, req *http.Request, params httprou
 	if channel == "" {
 		return nil, NewRestError("Must specify the channel", 400)
 	}
-	signer := getFlyParam("signer", body, req)
-	if signer == "" {
-		return nil, NewRestError("Must specify the signer", 400)
+	signer, restErr := getSigner(body, req)
+	if restErr != nil {
+		return nil, restErr
 	}
 
 	msg := messages.GetTxByID{}
@@ -175,9 +265,9 @@ func BuildGetChainInfoMessage(_ http.ResponseWriter, req *http.Request, _ httpro
 	if channel == "" {
 		return nil, NewRestError("Must specify the channel", 400)
 	}
-	signer := getFlyParam("signer", body, req)
-	if signer == "" {
-		return nil, NewRestError("Must specify the signer", 400)
+	signer, restErr := getSigner(body, req)
+	if restErr != nil {
+		return nil, restErr
 	}
 
 	msg := messages.GetChainInfo{}
@@ -188,6 +278,193 @@ func BuildGetChainInfoMessage(_ http.ResponseWriter, req *http.Request, _ httpro
 	return &msg, nil
 }
 
+const (
+	// DefaultBlockHeightWait is how long a block height request waits for the chain to grow, unless it sets a timeout
+	DefaultBlockHeightWait = 30 * time.Second
+	// MaxBlockHeightWait caps the timeout of a block height request
+	MaxBlockHeightWait = 2 * time.Minute
+)
+
+func BuildGetBlockHeightMessage(_ http.ResponseWriter, req *http.Request, params httprouter.Params) (*messages.GetBlockHeight, *RestError) {
+	var body map[string]interface{}
+	err := req.ParseForm()
+	if err != nil {
+		return nil, NewRestError(err.Error(), 400)
+	}
+	msgID := getFlyParam("id", body, req)
+	signer, restErr := getSigner(body, req)
+	if restErr != nil {
+		return nil, restErr
+	}
+
+	msg := messages.GetBlockHeight{}
+	msg.Headers.ID = msgID // this could be empty
+	msg.Headers.ChannelID = params.ByName("channel")
+	msg.Headers.Signer = signer
+	msg.Timeout = DefaultBlockHeightWait
+	if waitAbove := req.Form.Get("waitAbove"); waitAbove != "" {
+		msg.WaitAbove, err = strconv.ParseUint(waitAbove, 10, 64)
+		if err != nil {
+			return nil, NewRestError(fmt.Sprintf("Invalid waitAbove: %s", waitAbove), 400)
+		}
+	}
+	if timeout := req.Form.Get("timeout"); timeout != "" {
+		msg.Timeout, err = time.ParseDuration(timeout)
+		if err != nil || msg.Timeout < 0 {
+			return nil, NewRestError(fmt.Sprintf("Invalid timeout: %s", timeout), 400)
+		}
+		if msg.Timeout > MaxBlockHeightWait {
+			msg.Timeout = MaxBlockHeightWait
+		}
+	}
+
+	return &msg, nil
+}
+
+// DefaultPrivateDataFunction is the chaincode function queried to read private data, unless
+// the request names another with the "func" query parameter. It is passed the collection and key
+const DefaultPrivateDataFunction = "ReadPrivateData"
+
+func BuildGetPrivateDataMessage(_ http.ResponseWriter, req *http.Request, params httprouter.Params) (*messages.GetPrivateData, *RestError) {
+	var body map[string]interface{}
+	err := req.ParseForm()
+	if err != nil {
+		return nil, NewRestError(err.Error(), 400)
+	}
+	msgID := getFlyParam("id", body, req)
+	signer, restErr := getSigner(body, req)
+	if restErr != nil {
+		return nil, restErr
+	}
+	key := req.Form.Get("key")
+	if key == "" {
+		return nil, NewRestError("Must specify the key", 400)
+	}
+	function := req.Form.Get("func")
+	if function == "" {
+		function = DefaultPrivateDataFunction
+	}
+
+	msg := messages.GetPrivateData{}
+	msg.Headers.ID = msgID // this could be empty
+	msg.Headers.ChannelID = params.ByName("channel")
+	msg.Headers.ChaincodeName = params.ByName("name")
+	msg.Headers.Signer = signer
+	msg.Function = function
+	msg.Collection = params.ByName("collection")
+	msg.Key = key
+
+	return &msg, nil
+}
+
+// BuildSetAnchorPeersMessage builds an update of the anchor peers of the organization in the
+// path to the "anchorPeers" host:port addresses in the body. An empty list removes them all
+func BuildSetAnchorPeersMessage(_ http.ResponseWriter, req *http.Request, params httprouter.Params) (*messages.UpdateChannelConfig, *RestError) {
+	body, msg, restErr := buildUpdateChannelConfigMessage(req, params)
+	if restErr != nil {
+		return nil, restErr
+	}
+	anchorPeers, ok, err := getStringList(body, "anchorPeers")
+	if err != nil {
+		return nil, NewRestError(err.Error(), 400)
+	}
+	if !ok {
+		return nil, NewRestError(`Must specify the "anchorPeers"`, 400)
+	}
+	msg.AnchorPeers = anchorPeers
+	return msg, nil
+}
+
+// BuildSetMSPCACertsMessage builds an update of the CA certificates of the MSP in the path.
+// Each of "rootCerts", "intermediateCerts", "tlsRootCerts" and "tlsIntermediateCerts" that
+// is set in the body replaces the certificates of that kind
+func BuildSetMSPCACertsMessage(_ http.ResponseWriter, req *http.Request, params httprouter.Params) (*messages.UpdateChannelConfig, *RestError) {
+	body, msg, restErr := buildUpdateChannelConfigMessage(req, params)
+	if restErr != nil {
+		return nil, restErr
+	}
+	lists := []struct {
+		name   string
+		target *[]string
+	}{
+		{"rootCerts", &msg.RootCerts},
+		{"intermediateCerts", &msg.IntermediateCerts},
+		{"tlsRootCerts", &msg.TLSRootCerts},
+		{"tlsIntermediateCerts", &msg.TLSIntermediateCerts},
+	}
+	found := false
+	for _, list := range lists {
+		certs, ok, err := getStringList(body, list.name)
+		if err != nil {
+			return nil, NewRestError(err.Error(), 400)
+		}
+		if ok {
+			*list.target = certs
+			found = true
+		}
+	}
+	if !found {
+		return nil, NewRestError(`Must specify at least one of "rootCerts", "intermediateCerts", "tlsRootCerts" or "tlsIntermediateCerts"`, 400)
+	}
+	return msg, nil
+}
+
+// buildUpdateChannelConfigMessage reads the signer of a config update, and whether to submit it,
+// or only return it for the signatures of other organizations with "submit": false
+func buildUpdateChannelConfigMessage(req *http.Request, params httprouter.Params) (map[string]interface{}, *messages.UpdateChannelConfig, *RestError) {
+	body, err := utils.ParseJSONPayload(req)
+	if err != nil {
+		return nil, nil, NewRestError(err.Error(), 400)
+	}
+	err = req.ParseForm()
+	if err != nil {
+		return nil, nil, NewRestError(err.Error(), 400)
+	}
+	msgID := getFlyParam("id", body, req)
+	signer, restErr := getSigner(body, req)
+	if restErr != nil {
+		return nil, nil, restErr
+	}
+
+	msg := &messages.UpdateChannelConfig{}
+	msg.Headers.ID = msgID // this could be empty
+	msg.Headers.ChannelID = params.ByName("channel")
+	msg.Headers.Signer = signer
+	msg.MSPID = params.ByName("mspId")
+	msg.Submit = true
+	switch submit := body["submit"].(type) {
+	case nil:
+	case bool:
+		msg.Submit = submit
+	case string:
+		if msg.Submit, err = strconv.ParseBool(submit); err != nil {
+			return nil, nil, NewRestError(fmt.Sprintf("Invalid submit '%s'", submit), 400)
+		}
+	default:
+		return nil, nil, NewRestError(fmt.Sprintf("Invalid submit '%v'", submit), 400)
+	}
+	return body, msg, nil
+}
+
+// getStringList reads an array of strings from the body, and whether it was set
+func getStringList(body map[string]interface{}, name string) ([]string, bool, error) {
+	value := body[name]
+	if value == nil {
+		return nil, false, nil
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, true, fmt.Errorf(`The "%s" must be an array of strings`, name)
+	}
+	list := make([]string, len(items))
+	for i, item := range items {
+		if list[i], ok = item.(string); !ok {
+			return nil, true, fmt.Errorf(`The "%s" must be an array of strings`, name)
+		}
+	}
+	return list, true, nil
+}
+
 func BuildGetBlockMessage(_ http.ResponseWriter, req *http.Request, params httprouter.Params) (*messages.GetBlock, *RestError) {
 	var body map[string]interface{}
 	err := req.ParseForm()
@@ -199,9 +476,9 @@ func BuildGetBlockMessage(_ http.ResponseWriter, req *http.Request, params httpr
 	if channel == "" {
 		return nil, NewRestError("Must specify the channel", 400)
 	}
-	signer := getFlyParam("signer", body, req)
-	if signer == "" {
-		return nil, NewRestError("Must specify the signer", 400)
+	signer, restErr := getSigner(body, req)
+	if restErr != nil {
+		return nil, restErr
 	}
 
 	msg := messages.GetBlock{}
@@ -238,9 +515,9 @@ func BuildGetBlockByTxIDMessage(_ http.ResponseWriter, req *http.Request, params
 	if channel == "" {
 		return nil, NewRestError("Must specify the channel", 400)
 	}
-	signer := getFlyParam("signer", body, req)
-	if signer == "" {
-		return nil, NewRestError("Must specify the signer", 400)
+	signer, restErr := getSigner(body, req)
+	if restErr != nil {
+		return nil, restErr
 	}
 
 	msg := messages.GetBlockByTxID{}
@@ -260,15 +537,53 @@ func BuildTxMessage(_ http.ResponseWriter, req *http.Request, _ httprouter.Param
 	if err != nil {
 		return nil, nil, NewRestError(err.Error(), 400)
 	}
+	return buildTxMessage(body, req)
+}
 
+// BuildOutboxTxMessage builds a transaction whose receipt is held until its chaincode event
+// has been delivered to the event stream in the "stream" fly parameter. The "eventFilter"
+// and "outboxTimeout" (in seconds) fly parameters are optional
+func BuildOutboxTxMessage(_ http.ResponseWriter, req *http.Request, _ httprouter.Params) (*messages.SendTransaction, *TxOpts, *RestError) {
+	body, err := utils.ParseJSONPayload(req)
+	if err != nil {
+		return nil, nil, NewRestError(err.Error(), 400)
+	}
+	err = req.ParseForm()
+	if err != nil {
+		return nil, nil, NewRestError(err.Error(), 400)
+	}
+	stream := getFlyParam("stream", body, req)
+	if stream == "" {
+		return nil, nil, NewRestError("Must specify the event stream", 400)
+	}
+	outbox := &messages.Outbox{
+		Stream:      stream,
+		EventFilter: getFlyParam("eventFilter", body, req),
+	}
+	if timeoutVal := getFlyParam("outboxTimeout", body, req); timeoutVal != "" {
+		timeout, err := strconv.Atoi(timeoutVal)
+		if err != nil || timeout <= 0 {
+			return nil, nil, NewRestError(fmt.Sprintf("Invalid outbox timeout '%s'", timeoutVal), 400)
+		}
+		outbox.TimeoutSec = timeout
+	}
+	msg, opts, restErr := buildTxMessage(body, req)
+	if restErr != nil {
+		return nil, nil, restErr
+	}
+	msg.Outbox = outbox
+	return msg, opts, nil
+}
+
+func buildTxMessage(body map[string]interface{}, req *http.Request) (*messages.SendTransaction, *TxOpts, *RestError) {
 	msgID := getFlyParam("id", body, req)
 	channel := getFlyParam("channel", body, req)
 	if channel == "" {
 		return nil, nil, NewRestError("Must specify the channel", 400)
 	}
-	signer := getFlyParam("signer", body, req)
-	if signer == "" {
-		return nil, nil, NewRestError("Must specify the signer", 400)
+	signer, restErr := getSigner(body, req)
+	if restErr != nil {
+		return nil, nil, restErr
 	}
 	chaincode := getFlyParam("chaincode", body, req)
 	if chaincode == "" {
@@ -331,10 +646,47 @@ func BuildTxMessage(_ http.ResponseWriter, req *http.Request, _ httprouter.Param
 		}
 		opts.Ack = !noack
 	}
+	echoVal := getFlyParam("echoRequest", body, req)
+	if echoVal != "" {
+		echo, err := strconv.ParseBool(echoVal)
+		if err != nil {
+			return nil, nil, NewRestError(err.Error(), 400)
+		}
+		msg.Headers.EchoRequest = &echo
+	}
 
 	return &msg, &opts, nil
 }
 
+// ApplyHeaderPassthrough copies the configured headers of a transaction request into
+// the transient data, and into a JSON object appended to the args. The mapped transient
+// keys are reserved, so a caller can not set them in the body instead of the header
+func ApplyHeaderPassthrough(req *http.Request, msg *messages.SendTransaction, passthrough *conf.HeaderPassthroughConf) *RestError {
+	for header, key := range passthrough.Transient {
+		if _, exists := msg.TransientMap[key]; exists {
+			return NewRestError(fmt.Sprintf("Transient data key '%s' is reserved for the '%s' header", key, header), 400)
+		}
+		if value := req.Header.Get(header); value != "" {
+			if msg.TransientMap == nil {
+				msg.TransientMap = make(map[string]string)
+			}
+			msg.TransientMap[key] = value
+		}
+	}
+	if len(passthrough.Args) > 0 {
+		// always passed, so the chaincode function has a fixed number of args
+		headers := make(map[string]string, len(passthrough.Args))
+		for header, property := range passthrough.Args {
+			if value := req.Header.Get(header); value != "" {
+				headers[property] = value
+			}
+		}
+		headersArg, _ := json.Marshal(headers)
+		msg.Args = append(msg.Args, string(headersArg))
+	}
+	return nil
+}
+
 func processArgs(body map[string]interface{}) ([]string, error) {
 	var args []string
 	argsVal := body["args"]
@@ -18,8 +18,14 @@ package util
 
 import (
 	"encoding/json"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/hyperledger/firefly-fabconnect/internal/auth"
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/messages"
+	"github.com/julienschmidt/httprouter"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -581,3 +587,251 @@ func TestProcessArgsTypesInvalidIntegerArray(t *testing.T) {
 	_, err := processArgs(body)
 	assert.ErrorContains(err, "Expected: integer, given: string")
 }
+
+func TestApplyHeaderPassthrough(t *testing.T) {
+	assert := assert.New(t)
+	passthrough := &conf.HeaderPassthroughConf{
+		Transient: map[string]string{"x-user-id": "userId", "x-tenant": "tenant"},
+		Args:      map[string]string{"x-user-id": "user", "x-request-origin": "origin"},
+	}
+	req := httptest.NewRequest("POST", "/transactions", nil)
+	req.Header.Set("X-User-Id", "alice")
+	msg := &messages.SendTransaction{Args: []string{"asset204"}}
+
+	err := ApplyHeaderPassthrough(req, msg, passthrough)
+	assert.Nil(err)
+	assert.Equal(map[string]string{"userId": "alice"}, msg.TransientMap)
+	assert.Equal([]string{"asset204", `{"user":"alice"}`}, msg.Args)
+}
+
+func TestApplyHeaderPassthroughArgAlwaysPassed(t *testing.T) {
+	assert := assert.New(t)
+	passthrough := &conf.HeaderPassthroughConf{
+		Args: map[string]string{"x-user-id": "user"},
+	}
+	req := httptest.NewRequest("POST", "/transactions", nil)
+	msg := &messages.SendTransaction{Args: []string{"asset204"}}
+
+	err := ApplyHeaderPassthrough(req, msg, passthrough)
+	assert.Nil(err)
+	assert.Nil(msg.TransientMap)
+	assert.Equal([]string{"asset204", `{}`}, msg.Args)
+}
+
+func TestApplyHeaderPassthroughReservedTransientKey(t *testing.T) {
+	assert := assert.New(t)
+	passthrough := &conf.HeaderPassthroughConf{
+		Transient: map[string]string{"x-user-id": "userId"},
+	}
+	req := httptest.NewRequest("POST", "/transactions", nil)
+	msg := &messages.SendTransaction{TransientMap: map[string]string{"userId": "mallory"}}
+
+	err := ApplyHeaderPassthrough(req, msg, passthrough)
+	assert.Equal(400, err.StatusCode)
+	assert.Equal("Transient data key 'userId' is reserved for the 'x-user-id' header", err.Error.Error())
+}
+
+func TestBuildOutboxTxMessage(t *testing.T) {
+	assert := assert.New(t)
+	body := `{"headers":{"channel":"default-channel","signer":"user1","chaincode":"asset_transfer"},"func":"CreateAsset","args":["asset204"]}`
+
+	req := httptest.NewRequest("POST", "/transactions/outbox?fly-stream=es-1&fly-eventFilter=AssetCreated&fly-outboxTimeout=30", strings.NewReader(body))
+	msg, opts, err := BuildOutboxTxMessage(nil, req, nil)
+	assert.Nil(err)
+	assert.True(opts.Sync)
+	assert.Equal("CreateAsset", msg.Function)
+	assert.Equal(&messages.Outbox{Stream: "es-1", EventFilter: "AssetCreated", TimeoutSec: 30}, msg.Outbox)
+
+	req = httptest.NewRequest("POST", "/transactions/outbox", strings.NewReader(body))
+	_, _, err = BuildOutboxTxMessage(nil, req, nil)
+	assert.Equal(400, err.StatusCode)
+	assert.Equal("Must specify the event stream", err.Error.Error())
+
+	req = httptest.NewRequest("POST", "/transactions/outbox?fly-stream=es-1&fly-outboxTimeout=0", strings.NewReader(body))
+	_, _, err = BuildOutboxTxMessage(nil, req, nil)
+	assert.Equal(400, err.StatusCode)
+	assert.Equal("Invalid outbox timeout '0'", err.Error.Error())
+
+	req = httptest.NewRequest("POST", "/transactions/outbox?fly-stream=es-1", strings.NewReader(`{"headers":{"channel":"default-channel"}}`))
+	_, _, err = BuildOutboxTxMessage(nil, req, nil)
+	assert.Equal(400, err.StatusCode)
+	assert.Equal("Must specify the signer", err.Error.Error())
+}
+
+func TestBuildQueryMessagePagination(t *testing.T) {
+	assert := assert.New(t)
+	query := func(pagination string) (*messages.QueryChaincode, *RestError) {
+		body := `{"headers":{"channel":"default-channel","signer":"user1","chaincode":"asset_transfer"},"func":"QueryAssetsWithPagination","args":["{}"]` + pagination + `}`
+		return BuildQueryMessage(nil, httptest.NewRequest("POST", "/query", strings.NewReader(body)), nil)
+	}
+
+	msg, err := query("")
+	assert.Nil(err)
+	assert.Zero(msg.PageSize)
+
+	msg, err = query(`,"pageSize":10`)
+	assert.Nil(err)
+	assert.Equal(int32(10), msg.PageSize)
+	assert.Empty(msg.Bookmark)
+
+	msg, err = query(`,"pageSize":"10","bookmark":"g1AAAA"`)
+	assert.Nil(err)
+	assert.Equal(int32(10), msg.PageSize)
+	assert.Equal("g1AAAA", msg.Bookmark)
+	assert.Equal([]string{"{}"}, msg.Args)
+
+	for _, pageSize := range []string{`0`, `1.5`, `"ten"`, `3000000000`, `true`} {
+		_, err = query(`,"pageSize":` + pageSize)
+		assert.Equal(400, err.StatusCode)
+		assert.Regexp("Invalid pageSize", err.Error.Error())
+	}
+
+	_, err = query(`,"pageSize":10,"bookmark":1`)
+	assert.Equal(400, err.StatusCode)
+	assert.Equal(`The "bookmark" must be a string`, err.Error.Error())
+
+	_, err = query(`,"bookmark":"g1AAAA"`)
+	assert.Equal(400, err.StatusCode)
+	assert.Equal("Must specify the pageSize with a bookmark", err.Error.Error())
+}
+
+func TestBuildQueryMessageBlockNumber(t *testing.T) {
+	assert := assert.New(t)
+	body := `{"headers":{"channel":"default-channel","signer":"user1","chaincode":"asset_transfer"},"func":"ReadAsset","args":["asset1"]}`
+	query := func(params string) (*messages.QueryChaincode, *RestError) {
+		return BuildQueryMessage(nil, httptest.NewRequest("POST", "/query"+params, strings.NewReader(body)), nil)
+	}
+
+	msg, err := query("")
+	assert.Nil(err)
+	assert.Zero(msg.MinBlockNumber)
+
+	msg, err = query("?fly-blocknumber=42")
+	assert.Nil(err)
+	assert.Equal(uint64(42), msg.MinBlockNumber)
+	assert.Equal(DefaultBlockHeightWait, msg.BlockNumberTimeout)
+
+	msg, err = query("?fly-blocknumber=42&fly-blocknumberTimeout=0")
+	assert.Nil(err)
+	assert.Zero(msg.BlockNumberTimeout)
+
+	msg, err = query("?fly-blocknumber=42&fly-blocknumberTimeout=3600")
+	assert.Nil(err)
+	assert.Equal(MaxBlockHeightWait, msg.BlockNumberTimeout)
+
+	_, err = query("?fly-blocknumber=latest")
+	assert.Equal(400, err.StatusCode)
+	assert.Equal("Invalid blocknumber 'latest'", err.Error.Error())
+
+	_, err = query("?fly-blocknumber=42&fly-blocknumberTimeout=-1")
+	assert.Equal(400, err.StatusCode)
+	assert.Equal("Invalid blocknumber timeout '-1'", err.Error.Error())
+}
+
+func TestBuildSetAnchorPeersMessage(t *testing.T) {
+	assert := assert.New(t)
+	params := httprouter.Params{{Key: "channel", Value: "default-channel"}, {Key: "mspId", Value: "Org1MSP"}}
+	build := func(body string) (*messages.UpdateChannelConfig, *RestError) {
+		return BuildSetAnchorPeersMessage(nil, httptest.NewRequest("PUT", "/channels/default-channel/msps/Org1MSP/anchorpeers", strings.NewReader(body)), params)
+	}
+
+	msg, err := build(`{"headers":{"signer":"admin"},"anchorPeers":["peer0.org1.example.com:7051"]}`)
+	assert.Nil(err)
+	assert.Equal("default-channel", msg.Headers.ChannelID)
+	assert.Equal("admin", msg.Headers.Signer)
+	assert.Equal("Org1MSP", msg.MSPID)
+	assert.Equal([]string{"peer0.org1.example.com:7051"}, msg.AnchorPeers)
+	assert.True(msg.Submit)
+
+	msg, err = build(`{"headers":{"signer":"admin"},"anchorPeers":[],"submit":"false"}`)
+	assert.Nil(err)
+	assert.Equal([]string{}, msg.AnchorPeers)
+	assert.False(msg.Submit)
+
+	_, err = build(`{"anchorPeers":[]}`)
+	assert.Equal(400, err.StatusCode)
+	assert.Equal("Must specify the signer", err.Error.Error())
+
+	_, err = build(`{"headers":{"signer":"admin"}}`)
+	assert.Equal(400, err.StatusCode)
+	assert.Equal(`Must specify the "anchorPeers"`, err.Error.Error())
+
+	_, err = build(`{"headers":{"signer":"admin"},"anchorPeers":[7051]}`)
+	assert.Equal(400, err.StatusCode)
+	assert.Equal(`The "anchorPeers" must be an array of strings`, err.Error.Error())
+
+	_, err = build(`{"headers":{"signer":"admin"},"anchorPeers":[],"submit":"maybe"}`)
+	assert.Equal(400, err.StatusCode)
+	assert.Equal("Invalid submit 'maybe'", err.Error.Error())
+}
+
+func TestBuildSetMSPCACertsMessage(t *testing.T) {
+	assert := assert.New(t)
+	params := httprouter.Params{{Key: "channel", Value: "default-channel"}, {Key: "mspId", Value: "Org1MSP"}}
+	build := func(body string) (*messages.UpdateChannelConfig, *RestError) {
+		return BuildSetMSPCACertsMessage(nil, httptest.NewRequest("PUT", "/channels/default-channel/msps/Org1MSP/cacerts", strings.NewReader(body)), params)
+	}
+
+	msg, err := build(`{"headers":{"signer":"admin"},"rootCerts":["cert1","cert2"],"tlsIntermediateCerts":[],"submit":false}`)
+	assert.Nil(err)
+	assert.Equal("Org1MSP", msg.MSPID)
+	assert.Equal([]string{"cert1", "cert2"}, msg.RootCerts)
+	assert.Nil(msg.IntermediateCerts)
+	assert.Nil(msg.TLSRootCerts)
+	assert.Equal([]string{}, msg.TLSIntermediateCerts)
+	assert.False(msg.Submit)
+
+	_, err = build(`{"headers":{"signer":"admin"}}`)
+	assert.Equal(400, err.StatusCode)
+	assert.Regexp("Must specify at least one of", err.Error.Error())
+
+	_, err = build(`{"headers":{"signer":"admin"},"tlsRootCerts":"cert1"}`)
+	assert.Equal(400, err.StatusCode)
+	assert.Equal(`The "tlsRootCerts" must be an array of strings`, err.Error.Error())
+}
+
+func TestBuildTxMessageClientCertSigner(t *testing.T) {
+	assert := assert.New(t)
+	build := func(signer string) (*messages.SendTransaction, *RestError) {
+		body := `{"headers":{"channel":"default-channel","chaincode":"asset_transfer"` + signer + `},"func":"CreateAsset","args":["asset204"]}`
+		req := httptest.NewRequest("POST", "/transactions/outbox?fly-stream=es-1", strings.NewReader(body))
+		req = req.WithContext(auth.WithClientCertSigner(req.Context(), "user1"))
+		msg, _, err := BuildOutboxTxMessage(nil, req, nil)
+		return msg, err
+	}
+
+	// the client does not need to specify the signer it is bound to, but can
+	msg, err := build("")
+	assert.Nil(err)
+	assert.Equal("user1", msg.Headers.Signer)
+	msg, err = build(`,"signer":"user1"`)
+	assert.Nil(err)
+	assert.Equal("user1", msg.Headers.Signer)
+
+	_, err = build(`,"signer":"admin"`)
+	assert.Equal(403, err.StatusCode)
+	assert.Equal("Signer 'admin' cannot be used by a client whose certificate is bound to signer 'user1'", err.Error.Error())
+}
+
+func TestBuildTxMessageEchoRequest(t *testing.T) {
+	assert := assert.New(t)
+	build := func(query string) (*messages.SendTransaction, *RestError) {
+		body := `{"headers":{"channel":"default-channel","chaincode":"asset_transfer","signer":"user1"},"func":"CreateAsset","args":["asset204"]}`
+		req := httptest.NewRequest("POST", "/transactions"+query, strings.NewReader(body))
+		msg, _, err := BuildTxMessage(nil, req, nil)
+		return msg, err
+	}
+
+	msg, err := build("")
+	assert.Nil(err)
+	assert.Nil(msg.Headers.EchoRequest)
+	msg, err = build("?fly-echoRequest=true")
+	assert.Nil(err)
+	assert.True(*msg.Headers.EchoRequest)
+	msg, err = build("?fly-echoRequest=false")
+	assert.Nil(err)
+	assert.False(*msg.Headers.EchoRequest)
+
+	_, err = build("?fly-echoRequest=maybe")
+	assert.Equal(400, err.StatusCode)
+}
@@ -0,0 +1,66 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+)
+
+// chaincodeLimiter caps the transactions in-flight to each chaincode on a channel.
+// Transactions updating the same hot keys all but the first fail MVCC validation
+// when they race, so queuing the excess is cheaper than submitting them all
+type chaincodeLimiter struct {
+	mux          sync.Mutex
+	defaultLimit int
+	limits       map[string]int
+	slots        map[string]chan bool
+}
+
+func newChaincodeLimiter(config *conf.ChaincodeConcurrencyConf) *chaincodeLimiter {
+	l := &chaincodeLimiter{
+		defaultLimit: config.Default,
+		limits:       make(map[string]int, len(config.Limits)),
+		slots:        make(map[string]chan bool),
+	}
+	for key, limit := range config.Limits {
+		// config keys are case insensitive, and Fabric channel names are lower case
+		l.limits[strings.ToLower(key)] = limit
+	}
+	return l
+}
+
+// slotsFor returns the slots of a chaincode, or nil if it is not limited
+func (l *chaincodeLimiter) slotsFor(channelID, chaincode string) chan bool {
+	key := channelID + "/" + chaincode
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	slots, exists := l.slots[key]
+	if !exists {
+		limit, configured := l.limits[strings.ToLower(key)]
+		if !configured {
+			limit = l.defaultLimit
+		}
+		if limit > 0 {
+			slots = make(chan bool, limit)
+		}
+		l.slots[key] = slots
+	}
+	return slots
+}
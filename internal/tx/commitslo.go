@@ -0,0 +1,170 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultCommitSLOWindow  = 1000
+	commitSLOCheckInterval  = 10 * time.Second
+	commitSLOWebhookTimeout = 30 * time.Second
+)
+
+const (
+	// CommitSLOBreachedEvent is notified when the p95 commit latency goes over the threshold
+	CommitSLOBreachedEvent = "CommitSLOBreached"
+	// CommitSLORecoveredEvent is notified when the p95 commit latency is back under the threshold
+	CommitSLORecoveredEvent = "CommitSLORecovered"
+)
+
+// CommitLatencyStats reports the time from submitting transactions to them being
+// committed in a block, over the most recent transactions
+type CommitLatencyStats struct {
+	Committed      uint64  `json:"committed"`
+	Samples        int     `json:"samples"`
+	P50MS          float64 `json:"p50"`
+	P95MS          float64 `json:"p95"`
+	P99MS          float64 `json:"p99"`
+	MaxMS          float64 `json:"max"`
+	P95ThresholdMS int     `json:"p95Threshold,omitempty"`
+	Breached       bool    `json:"breached"`
+}
+
+// CommitLatencyStatsProvider is implemented by processors that track commit latency
+type CommitLatencyStatsProvider interface {
+	CommitLatencyStats() *CommitLatencyStats
+}
+
+// CommitSLONotification is POSTed to the webhook when the objective is breached or recovered
+type CommitSLONotification struct {
+	Type  string              `json:"type"`
+	Time  time.Time           `json:"time"`
+	Stats *CommitLatencyStats `json:"stats"`
+}
+
+type commitLatencyTracker struct {
+	mux        sync.Mutex
+	config     *conf.CommitSLOConf
+	samples    []time.Duration // ring of the most recent commit latencies
+	next       int
+	committed  uint64
+	breached   bool
+	lastCheck  time.Time
+	httpClient *http.Client
+}
+
+func newCommitLatencyTracker(config *conf.CommitSLOConf) *commitLatencyTracker {
+	window := config.Window
+	if window <= 0 {
+		window = defaultCommitSLOWindow
+	}
+	return &commitLatencyTracker{
+		config:     config,
+		samples:    make([]time.Duration, 0, window),
+		httpClient: &http.Client{Timeout: commitSLOWebhookTimeout},
+	}
+}
+
+func (t *commitLatencyTracker) record(latency time.Duration) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if len(t.samples) < cap(t.samples) {
+		t.samples = append(t.samples, latency)
+	} else {
+		t.samples[t.next] = latency
+		t.next = (t.next + 1) % len(t.samples)
+	}
+	t.committed++
+
+	// The percentiles are only worth sorting the window for periodically
+	if t.config.P95ThresholdMS <= 0 || time.Since(t.lastCheck) < commitSLOCheckInterval {
+		return
+	}
+	t.lastCheck = time.Now()
+	stats := t.statsLocked()
+	if stats.Breached == t.breached {
+		return
+	}
+	t.breached = stats.Breached
+	notification := &CommitSLONotification{Time: time.Now().UTC(), Stats: stats}
+	if stats.Breached {
+		notification.Type = CommitSLOBreachedEvent
+		log.Warnf("Commit latency SLO breached: p95=%.0fms threshold=%dms", stats.P95MS, stats.P95ThresholdMS)
+	} else {
+		notification.Type = CommitSLORecoveredEvent
+		log.Infof("Commit latency SLO recovered: p95=%.0fms threshold=%dms", stats.P95MS, stats.P95ThresholdMS)
+	}
+	if t.config.WebhookURL != "" {
+		go t.notify(notification)
+	}
+}
+
+func (t *commitLatencyTracker) stats() *CommitLatencyStats {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	return t.statsLocked()
+}
+
+func (t *commitLatencyTracker) statsLocked() *CommitLatencyStats {
+	stats := &CommitLatencyStats{
+		Committed:      t.committed,
+		Samples:        len(t.samples),
+		P95ThresholdMS: t.config.P95ThresholdMS,
+	}
+	if len(t.samples) == 0 {
+		return stats
+	}
+	sorted := make([]time.Duration, len(t.samples))
+	copy(sorted, t.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(p float64) float64 {
+		idx := int(p*float64(len(sorted))+0.5) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		return float64(sorted[idx]) / float64(time.Millisecond)
+	}
+	stats.P50MS = percentile(0.50)
+	stats.P95MS = percentile(0.95)
+	stats.P99MS = percentile(0.99)
+	stats.MaxMS = float64(sorted[len(sorted)-1]) / float64(time.Millisecond)
+	stats.Breached = t.config.P95ThresholdMS > 0 && stats.P95MS > float64(t.config.P95ThresholdMS)
+	return stats
+}
+
+func (t *commitLatencyTracker) notify(notification *CommitSLONotification) {
+	body, _ := json.Marshal(notification)
+	res, err := t.httpClient.Post(t.config.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Errorf("Failed to notify %s of %s: %s", t.config.WebhookURL, notification.Type, err)
+		return
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		log.Errorf("Failed to notify %s of %s: [%d]", t.config.WebhookURL, notification.Type, res.StatusCode)
+	}
+}
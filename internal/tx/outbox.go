@@ -0,0 +1,54 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"context"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/messages"
+)
+
+// EventDeliverer delivers the chaincode event of a committed transaction to the event
+// stream of its outbox, returning once the stream has delivered it
+type EventDeliverer interface {
+	CheckOutbox(outbox *messages.Outbox) error
+	DeliverTransactionEvents(ctx context.Context, outbox *messages.Outbox, channelID, chaincodeID, signer, txID string, blockNumber uint64) error
+}
+
+// OutboxProcessor is implemented by processors that can hold the receipts of transactions
+// until their chaincode events are delivered
+type OutboxProcessor interface {
+	SetEventDeliverer(EventDeliverer)
+}
+
+// SetEventDeliverer enables transactions with an outbox
+func (p *txProcessor) SetEventDeliverer(deliverer EventDeliverer) {
+	p.eventDeliverer = deliverer
+}
+
+// completeOutbox finalizes the receipt of a transaction once its chaincode event is delivered.
+// If it cannot be, the transaction is still committed, so the error reply includes its ID
+func (p *txProcessor) completeOutbox(inflight *inflightTx, reply *messages.TransactionReceipt) {
+	err := p.eventDeliverer.DeliverTransactionEvents(inflight.txContext.Context(), inflight.outbox,
+		inflight.tx.ChannelID, inflight.tx.ChaincodeName, inflight.signer, reply.TransactionHash, reply.BlockNumber)
+	if err != nil {
+		inflight.txContext.SendErrorReplyWithTX(500, err, reply.TransactionHash)
+	} else {
+		inflight.txContext.Reply(reply)
+	}
+	p.cancelInFlight(inflight, true)
+}
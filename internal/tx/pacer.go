@@ -0,0 +1,149 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/fabric/client"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPacingWindow           = 20
+	defaultPacingFailureThreshold = 0.2
+	defaultPacingInitialDelayMS   = 50
+	defaultPacingMaxDelayMS       = 2000
+)
+
+// submissionPacer spaces out the submissions to a chaincode while its transactions
+// are being invalidated by contention. Each window of receipts the interval doubles
+// if the ratio of conflicts is over the threshold, and halves otherwise, until the
+// submissions are back to full speed
+type submissionPacer struct {
+	mux          sync.Mutex
+	enabled      bool
+	window       int
+	threshold    float64
+	initialDelay time.Duration
+	maxDelay     time.Duration
+	chaincodes   map[string]*chaincodePace
+}
+
+type chaincodePace struct {
+	receipts  int
+	conflicts int
+	interval  time.Duration
+	nextSend  time.Time
+}
+
+func newSubmissionPacer(config *conf.AdaptivePacingConf) *submissionPacer {
+	p := &submissionPacer{
+		enabled:      config.Enabled,
+		window:       config.Window,
+		threshold:    config.FailureThreshold,
+		initialDelay: time.Duration(config.InitialDelayMS) * time.Millisecond,
+		maxDelay:     time.Duration(config.MaxDelayMS) * time.Millisecond,
+		chaincodes:   make(map[string]*chaincodePace),
+	}
+	if p.window <= 0 {
+		p.window = defaultPacingWindow
+	}
+	if p.threshold <= 0 {
+		p.threshold = defaultPacingFailureThreshold
+	}
+	if p.initialDelay <= 0 {
+		p.initialDelay = defaultPacingInitialDelayMS * time.Millisecond
+	}
+	if p.maxDelay <= 0 {
+		p.maxDelay = defaultPacingMaxDelayMS * time.Millisecond
+	}
+	return p
+}
+
+func (p *submissionPacer) getPace(channelID, chaincode string) *chaincodePace {
+	key := channelID + "/" + chaincode
+	pace, exists := p.chaincodes[key]
+	if !exists {
+		pace = &chaincodePace{}
+		p.chaincodes[key] = pace
+	}
+	return pace
+}
+
+// pause reserves the next submission time of a chaincode, and returns how
+// long the caller must wait for it
+func (p *submissionPacer) pause(channelID, chaincode string) time.Duration {
+	if !p.enabled {
+		return 0
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	pace := p.getPace(channelID, chaincode)
+	if pace.interval == 0 {
+		return 0
+	}
+	now := time.Now()
+	sendAt := pace.nextSend
+	if sendAt.Before(now) {
+		sendAt = now
+	}
+	pace.nextSend = sendAt.Add(pace.interval)
+	return sendAt.Sub(now)
+}
+
+// recordReceipt feeds the outcome of a submission back into the pacing of its chaincode.
+// Sends that failed without a receipt say nothing about contention, so are ignored
+func (p *submissionPacer) recordReceipt(channelID, chaincode string, receipt *client.TxReceipt) {
+	if !p.enabled || receipt == nil {
+		return
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	pace := p.getPace(channelID, chaincode)
+	pace.receipts++
+	if receipt.IsConflict() {
+		pace.conflicts++
+	}
+	if pace.receipts < p.window {
+		return
+	}
+	ratio := float64(pace.conflicts) / float64(pace.receipts)
+	interval := pace.interval
+	if ratio > p.threshold {
+		interval *= 2
+		if interval < p.initialDelay {
+			interval = p.initialDelay
+		}
+		if interval > p.maxDelay {
+			interval = p.maxDelay
+		}
+	} else {
+		interval /= 2
+		if interval < p.initialDelay {
+			interval = 0
+		}
+	}
+	if interval != pace.interval {
+		log.Infof("Pacing submissions to chaincode %s on channel %s at %s intervals (was %s), after %d of the last %d transactions conflicted", chaincode, channelID, interval, pace.interval, pace.conflicts, pace.receipts)
+		pace.interval = interval
+	}
+	pace.receipts = 0
+	pace.conflicts = 0
+}
@@ -0,0 +1,206 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tx
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	"github.com/hyperledger/firefly-fabconnect/internal/fabric/client"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// QuotaModeEnforce rejects the submissions of an organization over its quota
+	QuotaModeEnforce = "enforce"
+	// QuotaModeReport only tracks the submissions of each organization, and warns when over quota
+	QuotaModeReport = "report"
+)
+
+// QuotaProcessor is implemented by processors that track the submissions of the signers of each
+// organization against the quotas agreed by a consortium
+type QuotaProcessor interface {
+	SetIdentityClient(client.IdentityClient)
+	QuotaReport() *QuotaReport
+}
+
+// QuotaReport is the submissions of each organization in the current hour and day (UTC)
+type QuotaReport struct {
+	Mode string     `json:"mode"`
+	Orgs []OrgQuota `json:"orgs"`
+}
+
+// OrgQuota is the submissions of the signers of an organization, against its quota
+type OrgQuota struct {
+	MSPID           string    `json:"mspId"`
+	PerHour         int       `json:"perHour,omitempty"`
+	PerDay          int       `json:"perDay,omitempty"`
+	HourStart       time.Time `json:"hourStart"`
+	HourSubmissions int       `json:"hourSubmissions"`
+	DayStart        time.Time `json:"dayStart"`
+	DaySubmissions  int       `json:"daySubmissions"`
+	Exceeded        bool      `json:"exceeded"`
+	Rejected        uint64    `json:"rejected"`
+}
+
+// quotaTracker counts the submissions of each organization, by the MSP of the signer, in fixed
+// hourly and daily windows. There are no fees on a Fabric network, so quotas are how a consortium
+// caps the share of the network each member uses
+type quotaTracker struct {
+	mux      sync.Mutex
+	mode     string
+	defaults conf.SubmissionQuotaConf
+	limits   map[string]conf.SubmissionQuotaConf
+	orgs     map[string]*OrgQuota
+	idClient client.IdentityClient
+}
+
+func newQuotaTracker(config *conf.SubmissionQuotasConf) *quotaTracker {
+	q := &quotaTracker{
+		mode:     config.Mode,
+		defaults: config.Default,
+		limits:   make(map[string]conf.SubmissionQuotaConf, len(config.Orgs)),
+		orgs:     make(map[string]*OrgQuota),
+	}
+	for mspID, limits := range config.Orgs {
+		// config keys are case insensitive, so organizations are matched regardless of case
+		q.limits[strings.ToLower(mspID)] = limits
+	}
+	if q.mode != "" && q.mode != QuotaModeEnforce && q.mode != QuotaModeReport {
+		log.Warnf("Unknown submission quota mode '%s', quotas will only be reported", q.mode)
+		q.mode = QuotaModeReport
+	}
+	return q
+}
+
+func (q *quotaTracker) enabled() bool {
+	return q.mode != ""
+}
+
+// signerMSP resolves the organization a signer belongs to, or returns empty if it cannot be
+// resolved, in which case the submission fails on the unknown signer anyway
+func (q *quotaTracker) signerMSP(signer string) string {
+	q.mux.Lock()
+	idClient := q.idClient
+	q.mux.Unlock()
+	if idClient == nil {
+		return ""
+	}
+	id, err := idClient.GetSigningIdentity(signer)
+	if err != nil {
+		return ""
+	}
+	return id.Identifier().MSPID
+}
+
+// getOrg returns the counts of an organization, starting new windows once the current ones end
+func (q *quotaTracker) getOrg(mspID string, now time.Time) *OrgQuota {
+	key := strings.ToLower(mspID)
+	org, exists := q.orgs[key]
+	if !exists {
+		limits, configured := q.limits[key]
+		if !configured {
+			limits = q.defaults
+		}
+		org = &OrgQuota{MSPID: mspID, PerHour: limits.PerHour, PerDay: limits.PerDay}
+		q.orgs[key] = org
+	}
+	if hourStart := now.Truncate(time.Hour); !hourStart.Equal(org.HourStart) {
+		org.HourStart = hourStart
+		org.HourSubmissions = 0
+	}
+	if dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC); !dayStart.Equal(org.DayStart) {
+		org.DayStart = dayStart
+		org.DaySubmissions = 0
+	}
+	org.Exceeded = (org.PerHour > 0 && org.HourSubmissions >= org.PerHour) || (org.PerDay > 0 && org.DaySubmissions >= org.PerDay)
+	return org
+}
+
+// admit counts a submission by the signer against the quota of its organization. In enforce mode
+// a submission over quota is rejected with an error, and not counted
+func (q *quotaTracker) admit(signer string) error {
+	if !q.enabled() {
+		return nil
+	}
+	mspID := q.signerMSP(signer)
+	if mspID == "" {
+		return nil
+	}
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	org := q.getOrg(mspID, time.Now().UTC())
+	// submissions are attributed to the MSP ID as the signer reports it, not as configured
+	org.MSPID = mspID
+	if org.Exceeded {
+		limit, count, period := org.PerDay, org.DaySubmissions, "day"
+		if org.PerHour > 0 && org.HourSubmissions >= org.PerHour {
+			limit, count, period = org.PerHour, org.HourSubmissions, "hour"
+		}
+		if q.mode == QuotaModeEnforce {
+			org.Rejected++
+			return errors.Errorf(errors.TransactionQuotaExceeded, mspID, limit, period)
+		}
+		if count == limit {
+			log.Warnf("Organization %s is over its submission quota of %d transactions per %s", mspID, limit, period)
+		}
+	}
+	org.HourSubmissions++
+	org.DaySubmissions++
+	return nil
+}
+
+// report returns the counts of every organization that has submitted, or has a quota configured
+func (q *quotaTracker) report() *QuotaReport {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	now := time.Now().UTC()
+	for key := range q.limits {
+		if _, exists := q.orgs[key]; !exists {
+			q.getOrg(key, now)
+		}
+	}
+	r := &QuotaReport{
+		Mode: q.mode,
+		Orgs: make([]OrgQuota, 0, len(q.orgs)),
+	}
+	for _, org := range q.orgs {
+		r.Orgs = append(r.Orgs, *q.getOrg(org.MSPID, now))
+	}
+	sort.Slice(r.Orgs, func(i, j int) bool { return r.Orgs[i].MSPID < r.Orgs[j].MSPID })
+	return r
+}
+
+// SetIdentityClient enables the signers of transactions to be resolved to their organization
+func (p *txProcessor) SetIdentityClient(idClient client.IdentityClient) {
+	p.quotas.mux.Lock()
+	defer p.quotas.mux.Unlock()
+	p.quotas.idClient = idClient
+}
+
+// QuotaReport returns the submissions of each organization against its quota, or nil if
+// quotas are not enabled
+func (p *txProcessor) QuotaReport() *QuotaReport {
+	if !p.quotas.enabled() {
+		return nil
+	}
+	return p.quotas.report()
+}
@@ -26,6 +26,8 @@ import (
 	"github.com/hyperledger/firefly-fabconnect/internal/fabric"
 	"github.com/hyperledger/firefly-fabconnect/internal/fabric/client"
 	"github.com/hyperledger/firefly-fabconnect/internal/messages"
+	"github.com/hyperledger/firefly-fabconnect/internal/usage"
+	"github.com/hyperledger/firefly-fabconnect/internal/utils"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -41,6 +43,12 @@ type Processor interface {
 	GetRPCClient() client.RPCClient
 }
 
+// ResultDecodingProcessor is implemented by processors that decode the results chaincodes
+// return to transactions into their receipts
+type ResultDecodingProcessor interface {
+	SetResultDecoders(*utils.ResultDecoders)
+}
+
 var highestID = 1000000
 
 type inflightTx struct {
@@ -49,6 +57,7 @@ type inflightTx struct {
 	txContext Context
 	tx        *fabric.Tx
 	rpc       client.RPCClient
+	outbox    *messages.Outbox
 }
 
 func (i *inflightTx) String() string {
@@ -66,6 +75,13 @@ type txProcessor struct {
 	rpc              client.RPCClient
 	config           *conf.RESTGatewayConf
 	concurrencySlots chan bool
+	chaincodeLimiter *chaincodeLimiter
+	pacer            *submissionPacer
+	commitLatency    *commitLatencyTracker
+	usage            *usage.Counters
+	quotas           *quotaTracker
+	eventDeliverer   EventDeliverer
+	resultDecoders   *utils.ResultDecoders
 }
 
 // NewTxnProcessor constructor for message procss
@@ -78,6 +94,11 @@ func NewTxProcessor(conf *conf.RESTGatewayConf) Processor {
 		inflightTxs:      []*inflightTx{},
 		config:           conf,
 		concurrencySlots: make(chan bool, conf.SendConcurrency),
+		chaincodeLimiter: newChaincodeLimiter(&conf.ChaincodeConcurrency),
+		pacer:            newSubmissionPacer(&conf.AdaptivePacing),
+		commitLatency:    newCommitLatencyTracker(&conf.CommitSLO),
+		usage:            usage.NewCounters(),
+		quotas:           newQuotaTracker(&conf.SubmissionQuotas),
 	}
 	return p
 }
@@ -91,6 +112,12 @@ func (p *txProcessor) GetRPCClient() client.RPCClient {
 	return p.rpc
 }
 
+// SetResultDecoders enables the results of transactions to chaincodes with a result decoder to
+// be returned in their receipts
+func (p *txProcessor) SetResultDecoders(decoders *utils.ResultDecoders) {
+	p.resultDecoders = decoders
+}
+
 // OnMessage checks the type and dispatches to the correct logic
 // ** From this point on the processor MUST ensure Reply is called
 //
@@ -186,6 +213,15 @@ func (p *txProcessor) processCompletion(inflight *inflightTx, _ *fabric.Tx) {
 	reply.Signer = receipt.Signer
 	reply.SignerMSP = receipt.SignerMSP
 	reply.TransactionHash = receipt.TransactionID
+	if isSuccess && p.resultDecoders.Lookup(inflight.tx.ChannelID, inflight.tx.ChaincodeName, inflight.tx.Function) != nil {
+		reply.Result = p.resultDecoders.Decode(inflight.tx.ChannelID, inflight.tx.ChaincodeName, inflight.tx.Function, receipt.ResponsePayload)
+	}
+
+	if isSuccess && inflight.outbox != nil {
+		// waits for the event stream, so must not hold up the transactions behind this one
+		go p.completeOutbox(inflight, &reply)
+		return
+	}
 
 	inflight.txContext.Reply(&reply)
 
@@ -216,6 +252,23 @@ func (p *txProcessor) processCompletion(inflight *inflightTx, _ *fabric.Tx) {
 
 func (p *txProcessor) OnSendTransactionMessage(txContext Context, msg *messages.SendTransaction) {
 
+	if msg.Outbox != nil {
+		// check the outbox can be delivered to, before committing a transaction it would fail for
+		if p.eventDeliverer == nil {
+			txContext.SendErrorReply(400, errors.Errorf(errors.TransactionOutboxUnavailable))
+			return
+		}
+		if err := p.eventDeliverer.CheckOutbox(msg.Outbox); err != nil {
+			txContext.SendErrorReply(400, err)
+			return
+		}
+	}
+
+	if err := p.quotas.admit(msg.Headers.Signer); err != nil {
+		txContext.SendErrorReply(429, err)
+		return
+	}
+
 	inflight, err := p.addInflightWrapper(txContext, &msg.RequestCommon)
 	if err != nil {
 		txContext.SendErrorReply(400, err)
@@ -224,26 +277,71 @@ func (p *txProcessor) OnSendTransactionMessage(txContext Context, msg *messages.
 
 	tx := fabric.NewSendTx(msg, inflight.signer)
 	inflight.tx = tx
+	inflight.outbox = msg.Outbox
 	p.sendTransactionCommon(txContext, inflight, tx)
 }
 
 func (p *txProcessor) sendTransactionCommon(txContext Context, inflight *inflightTx, tx *fabric.Tx) {
+	pause := p.pacer.pause(tx.ChannelID, tx.ChaincodeName)
 	if p.config.SendConcurrency > 1 {
 		// The above must happen synchronously for each partition in Kafka - as it is where we assign the nonce.
 		// However, the send to the node can happen at high concurrency.
+		if chaincodeSlots := p.chaincodeLimiter.slotsFor(tx.ChannelID, tx.ChaincodeName); chaincodeSlots != nil || pause > 0 {
+			// Queue behind the pacing and the in-flight transactions of the same chaincode, without
+			// taking a send slot (or holding up the caller) that transactions to others could use
+			go func() {
+				time.Sleep(pause)
+				if chaincodeSlots != nil {
+					chaincodeSlots <- true
+					defer func() { <-chaincodeSlots }()
+				}
+				p.concurrencySlots <- true
+				p.sendAndTrackMining(txContext, inflight, tx)
+			}()
+			return
+		}
 		p.concurrencySlots <- true
 		go p.sendAndTrackMining(txContext, inflight, tx)
 	} else {
 		// For the special case of 1 we do it synchronously, so we don't assign the next nonce until we've sent this one
+		time.Sleep(pause)
 		p.sendAndTrackMining(txContext, inflight, tx)
 	}
 }
 
+// CommitLatencyStats returns the recent time from submit to commit of transactions
+func (p *txProcessor) CommitLatencyStats() *CommitLatencyStats {
+	return p.commitLatency.stats()
+}
+
+// Usage returns the transactions submitted by each signer
+func (p *txProcessor) Usage() []usage.Usage {
+	return p.usage.Usage()
+}
+
+// txSize is the data volume of a transaction, accounted to its signer
+func txSize(tx *fabric.Tx) int {
+	size := len(tx.Function)
+	for _, arg := range tx.Args {
+		size += len(arg)
+	}
+	for k, v := range tx.TransientMap {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
 func (p *txProcessor) sendAndTrackMining(txContext Context, inflight *inflightTx, tx *fabric.Tx) {
+	submitted := time.Now()
 	err := tx.Send(txContext.Context(), inflight.rpc)
+	if tx.Receipt != nil && tx.Receipt.BlockNumber > 0 {
+		p.commitLatency.record(time.Since(submitted))
+	}
 	if p.config.SendConcurrency > 1 {
 		<-p.concurrencySlots // return our slot as soon as send is complete, to let an awaiting send go
 	}
+	p.pacer.recordReceipt(tx.ChannelID, tx.ChaincodeName, tx.Receipt)
+	p.usage.RecordTransaction(inflight.signer, txSize(tx), err != nil || tx.Receipt == nil || !tx.Receipt.IsSuccess())
 	if err != nil {
 		p.cancelInFlight(inflight, false /* not confirmed as submitted, as send failed */)
 		txContext.SendErrorReply(500, err)
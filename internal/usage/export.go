@@ -0,0 +1,131 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultExportInterval = time.Hour
+	formatJSON            = "json"
+	formatCSV             = "csv"
+)
+
+// Exporter periodically writes the usage of each tenant over the last interval to a new file,
+// for collection by a billing system
+type Exporter struct {
+	tracker  *Tracker
+	dir      string
+	format   string
+	interval time.Duration
+	last     *Report
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewExporter constructor
+func NewExporter(config *conf.UsageConf, tracker *Tracker) (*Exporter, error) {
+	e := &Exporter{
+		tracker:  tracker,
+		dir:      config.ExportPath,
+		format:   strings.ToLower(config.ExportFormat),
+		interval: time.Duration(config.ExportIntervalSec) * time.Second,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if e.format == "" {
+		e.format = formatJSON
+	}
+	if e.format != formatJSON && e.format != formatCSV {
+		return nil, errors.Errorf(errors.UsageExportInvalidFormat, config.ExportFormat)
+	}
+	if e.interval <= 0 {
+		e.interval = defaultExportInterval
+	}
+	if err := os.MkdirAll(e.dir, 0755); err != nil {
+		return nil, errors.Errorf(errors.UsageExportInitFailed, e.dir, err)
+	}
+	return e, nil
+}
+
+// Start exports the usage every interval, until closed
+func (e *Exporter) Start() {
+	log.Infof("Exporting usage to %s every %s", e.dir, e.interval)
+	e.last = &Report{To: e.tracker.started}
+	go e.exportLoop()
+}
+
+// Close stops exporting, after writing the usage of the partial interval
+func (e *Exporter) Close() {
+	close(e.stop)
+	<-e.done
+}
+
+func (e *Exporter) exportLoop() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.stop:
+			e.export()
+			return
+		case <-ticker.C:
+			e.export()
+		}
+	}
+}
+
+func (e *Exporter) export() {
+	report := e.tracker.Report()
+	delta := report.Since(e.last)
+	e.last = report
+	if err := e.write(delta); err != nil {
+		log.Errorf("Failed to export usage: %s", err)
+	}
+}
+
+func (e *Exporter) write(r *Report) error {
+	var buf bytes.Buffer
+	if e.format == formatCSV {
+		if err := r.WriteCSV(&buf); err != nil {
+			return err
+		}
+	} else {
+		b, _ := json.MarshalIndent(r, "", "  ")
+		buf.Write(b)
+	}
+	name := fmt.Sprintf("usage-%s.%s", r.To.UTC().Format("20060102T150405Z"), e.format)
+	// Write then rename, so collectors never pick up a partial file
+	path := filepath.Join(e.dir, name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,217 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usage
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Usage totals the activity of one tenant. A tenant is the signer of transactions, and
+// the signer of the subscriptions events are delivered for
+type Usage struct {
+	Tenant             string `json:"tenant"`
+	Transactions       uint64 `json:"transactions"`
+	FailedTransactions uint64 `json:"failedTransactions"`
+	TransactionBytes   uint64 `json:"transactionBytes"`
+	EventsDelivered    uint64 `json:"eventsDelivered"`
+	EventBytes         uint64 `json:"eventBytes"`
+}
+
+func (u *Usage) add(o *Usage) {
+	u.Transactions += o.Transactions
+	u.FailedTransactions += o.FailedTransactions
+	u.TransactionBytes += o.TransactionBytes
+	u.EventsDelivered += o.EventsDelivered
+	u.EventBytes += o.EventBytes
+}
+
+func (u *Usage) since(prev *Usage) Usage {
+	return Usage{
+		Tenant:             u.Tenant,
+		Transactions:       u.Transactions - prev.Transactions,
+		FailedTransactions: u.FailedTransactions - prev.FailedTransactions,
+		TransactionBytes:   u.TransactionBytes - prev.TransactionBytes,
+		EventsDelivered:    u.EventsDelivered - prev.EventsDelivered,
+		EventBytes:         u.EventBytes - prev.EventBytes,
+	}
+}
+
+func (u *Usage) isZero() bool {
+	return u.Transactions == 0 && u.FailedTransactions == 0 && u.TransactionBytes == 0 && u.EventsDelivered == 0 && u.EventBytes == 0
+}
+
+// Source is implemented by the components of the connector that account usage to tenants
+type Source interface {
+	Usage() []Usage
+}
+
+// Counters accumulates usage by tenant, and is safe for concurrent use
+type Counters struct {
+	mux     sync.Mutex
+	tenants map[string]*Usage
+}
+
+// NewCounters constructor
+func NewCounters() *Counters {
+	return &Counters{
+		tenants: make(map[string]*Usage),
+	}
+}
+
+func (c *Counters) record(tenant string, u *Usage) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	t, ok := c.tenants[tenant]
+	if !ok {
+		t = &Usage{Tenant: tenant}
+		c.tenants[tenant] = t
+	}
+	t.add(u)
+}
+
+// RecordTransaction accounts a submitted transaction, with the size of its arguments
+func (c *Counters) RecordTransaction(tenant string, bytes int, failed bool) {
+	u := &Usage{TransactionBytes: uint64(bytes)}
+	if failed {
+		u.FailedTransactions = 1
+	} else {
+		u.Transactions = 1
+	}
+	c.record(tenant, u)
+}
+
+// RecordEvents accounts events delivered to a stream, with the size of their JSON
+func (c *Counters) RecordEvents(tenant string, events, bytes int) {
+	c.record(tenant, &Usage{EventsDelivered: uint64(events), EventBytes: uint64(bytes)})
+}
+
+// Usage returns a copy of the totals of every tenant
+func (c *Counters) Usage() []Usage {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	result := make([]Usage, 0, len(c.tenants))
+	for _, u := range c.tenants {
+		result = append(result, *u)
+	}
+	return result
+}
+
+// Report is the usage of each tenant over a period
+type Report struct {
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Tenants []Usage   `json:"tenants"`
+}
+
+// Tracker merges the usage of its sources into reports
+type Tracker struct {
+	mux     sync.Mutex
+	sources []Source
+	started time.Time
+}
+
+// NewTracker constructor
+func NewTracker() *Tracker {
+	return &Tracker{
+		started: time.Now(),
+	}
+}
+
+// AddSource registers a component whose usage is reported
+func (t *Tracker) AddSource(source Source) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	t.sources = append(t.sources, source)
+}
+
+// Report returns the usage of each tenant since the connector started, ordered by tenant
+func (t *Tracker) Report() *Report {
+	t.mux.Lock()
+	sources := t.sources
+	t.mux.Unlock()
+	byTenant := make(map[string]*Usage)
+	for _, source := range sources {
+		for _, u := range source.Usage() {
+			total, ok := byTenant[u.Tenant]
+			if !ok {
+				total = &Usage{Tenant: u.Tenant}
+				byTenant[u.Tenant] = total
+			}
+			total.add(&u)
+		}
+	}
+	r := &Report{
+		From:    t.started,
+		To:      time.Now(),
+		Tenants: make([]Usage, 0, len(byTenant)),
+	}
+	for _, u := range byTenant {
+		r.Tenants = append(r.Tenants, *u)
+	}
+	sort.Slice(r.Tenants, func(i, j int) bool { return r.Tenants[i].Tenant < r.Tenants[j].Tenant })
+	return r
+}
+
+// Since returns the usage between a previous report and this one, omitting idle tenants
+func (r *Report) Since(prev *Report) *Report {
+	before := make(map[string]*Usage, len(prev.Tenants))
+	for i := range prev.Tenants {
+		before[prev.Tenants[i].Tenant] = &prev.Tenants[i]
+	}
+	delta := &Report{
+		From:    prev.To,
+		To:      r.To,
+		Tenants: make([]Usage, 0, len(r.Tenants)),
+	}
+	for _, u := range r.Tenants {
+		d := u
+		if b, ok := before[u.Tenant]; ok {
+			d = u.since(b)
+		}
+		if !d.isZero() {
+			delta.Tenants = append(delta.Tenants, d)
+		}
+	}
+	return delta
+}
+
+// WriteCSV writes the report with a header row, and a row per tenant
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"from", "to", "tenant", "transactions", "failedTransactions", "transactionBytes", "eventsDelivered", "eventBytes"})
+	from := r.From.UTC().Format(time.RFC3339)
+	to := r.To.UTC().Format(time.RFC3339)
+	for _, u := range r.Tenants {
+		_ = cw.Write([]string{
+			from,
+			to,
+			u.Tenant,
+			strconv.FormatUint(u.Transactions, 10),
+			strconv.FormatUint(u.FailedTransactions, 10),
+			strconv.FormatUint(u.TransactionBytes, 10),
+			strconv.FormatUint(u.EventsDelivered, 10),
+			strconv.FormatUint(u.EventBytes, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
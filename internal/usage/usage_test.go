@@ -0,0 +1,136 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usage
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReport(t *testing.T) {
+	assert := assert.New(t)
+	txs := NewCounters()
+	events := NewCounters()
+	tracker := NewTracker()
+	tracker.AddSource(txs)
+	tracker.AddSource(events)
+
+	txs.RecordTransaction("user2", 100, false)
+	txs.RecordTransaction("user1", 10, false)
+	txs.RecordTransaction("user1", 20, true)
+	events.RecordEvents("user1", 5, 500)
+
+	first := tracker.Report()
+	assert.Equal([]Usage{
+		{Tenant: "user1", Transactions: 1, FailedTransactions: 1, TransactionBytes: 30, EventsDelivered: 5, EventBytes: 500},
+		{Tenant: "user2", Transactions: 1, TransactionBytes: 100},
+	}, first.Tenants)
+
+	// the usage between reports omits the tenants that were idle
+	events.RecordEvents("user1", 2, 200)
+	events.RecordEvents("user3", 1, 50)
+	delta := tracker.Report().Since(first)
+	assert.Equal(first.To, delta.From)
+	assert.Equal([]Usage{
+		{Tenant: "user1", EventsDelivered: 2, EventBytes: 200},
+		{Tenant: "user3", EventsDelivered: 1, EventBytes: 50},
+	}, delta.Tenants)
+}
+
+func TestWriteCSV(t *testing.T) {
+	assert := assert.New(t)
+	r := &Report{
+		From:    time.Unix(0, 0),
+		To:      time.Unix(3600, 0),
+		Tenants: []Usage{{Tenant: "user1", Transactions: 2, TransactionBytes: 30, EventsDelivered: 5, EventBytes: 500}},
+	}
+	var buf bytes.Buffer
+	assert.NoError(r.WriteCSV(&buf))
+	assert.Equal("from,to,tenant,transactions,failedTransactions,transactionBytes,eventsDelivered,eventBytes\n"+
+		"1970-01-01T00:00:00Z,1970-01-01T01:00:00Z,user1,2,0,30,5,500\n", buf.String())
+}
+
+func TestExporter(t *testing.T) {
+	assert := assert.New(t)
+	dir := filepath.Join(t.TempDir(), "usage")
+	txs := NewCounters()
+	tracker := NewTracker()
+	tracker.AddSource(txs)
+
+	e, err := NewExporter(&conf.UsageConf{ExportPath: dir, ExportFormat: "CSV"}, tracker)
+	assert.NoError(err)
+	e.Start()
+	txs.RecordTransaction("user1", 10, false)
+	e.Close()
+
+	files, err := os.ReadDir(dir)
+	assert.NoError(err)
+	assert.Len(files, 1)
+	assert.True(strings.HasPrefix(files[0].Name(), "usage-"))
+	assert.True(strings.HasSuffix(files[0].Name(), ".csv"))
+	content, _ := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	assert.Contains(string(content), ",user1,1,0,10,0,0\n")
+}
+
+func TestExporterJSON(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	txs := NewCounters()
+	tracker := NewTracker()
+	tracker.AddSource(txs)
+
+	e, err := NewExporter(&conf.UsageConf{ExportPath: dir}, tracker)
+	assert.NoError(err)
+	e.Start()
+	txs.RecordTransaction("user1", 10, true)
+	e.export()
+	txs.RecordTransaction("user1", 10, false)
+	time.Sleep(time.Second) // the files are named to the second
+	e.Close()
+
+	files, _ := os.ReadDir(dir)
+	assert.Len(files, 2)
+	var reports []*Report
+	for _, f := range files {
+		var r Report
+		content, _ := os.ReadFile(filepath.Join(dir, f.Name()))
+		assert.NoError(json.Unmarshal(content, &r))
+		reports = append(reports, &r)
+	}
+	assert.Equal(uint64(1), reports[0].Tenants[0].FailedTransactions)
+	assert.Equal(uint64(0), reports[0].Tenants[0].Transactions)
+	assert.Equal(uint64(1), reports[1].Tenants[0].Transactions)
+	assert.Equal(uint64(0), reports[1].Tenants[0].FailedTransactions)
+}
+
+func TestExporterBadConfig(t *testing.T) {
+	_, err := NewExporter(&conf.UsageConf{ExportPath: t.TempDir(), ExportFormat: "xml"}, NewTracker())
+	assert.Regexp(t, "Unknown usage export format 'xml'", err)
+
+	file := filepath.Join(t.TempDir(), "file")
+	assert.NoError(t, os.WriteFile(file, []byte{}, 0644))
+	_, err = NewExporter(&conf.UsageConf{ExportPath: filepath.Join(file, "dir")}, NewTracker())
+	assert.Regexp(t, "Failed to create the usage export directory", err)
+}
@@ -0,0 +1,87 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+)
+
+const (
+	// RetryStrategyExponential multiplies the delay by the backoff factor after each retry. The default
+	RetryStrategyExponential = "exponential"
+	// RetryStrategyLinear adds the initial delay to the delay after each retry
+	RetryStrategyLinear = "linear"
+	// RetryStrategyFixed waits the initial delay before every retry
+	RetryStrategyFixed = "fixed"
+)
+
+// Backoff computes the delays between the retries of an operation
+type Backoff struct {
+	Strategy string
+	Initial  time.Duration
+	Factor   float64       // the multiplier of the exponential strategy
+	Max      time.Duration // caps the delay when set
+	Jitter   float64       // randomizes each delay by up to this fraction of it, either way
+}
+
+// ValidateRetryStrategy checks the strategy and jitter of retries, and returns the strategy
+// normalized to lower case. An empty strategy is the default
+func ValidateRetryStrategy(strategy string, jitter float64) (string, error) {
+	strategy = strings.ToLower(strategy)
+	if strategy != "" && strategy != RetryStrategyExponential && strategy != RetryStrategyLinear && strategy != RetryStrategyFixed {
+		return "", errors.Errorf(errors.RetryStrategyInvalid, strategy)
+	}
+	if jitter < 0 || jitter > 1 {
+		return "", errors.Errorf(errors.RetryJitterInvalid, jitter)
+	}
+	return strategy, nil
+}
+
+// Delay returns the delay before the retry that follows the given number of attempts, counting from 1
+func (b *Backoff) Delay(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	var delay float64
+	switch b.Strategy {
+	case RetryStrategyFixed:
+		delay = float64(b.Initial)
+	case RetryStrategyLinear:
+		delay = float64(b.Initial) * float64(attempts)
+	default:
+		factor := b.Factor
+		if factor < 1 {
+			factor = 1
+		}
+		delay = float64(b.Initial) * math.Pow(factor, float64(attempts-1))
+	}
+	if b.Max > 0 && delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		delay += delay * b.Jitter * (2*rand.Float64() - 1) // #nosec
+	}
+	if delay > math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(delay)
+}
@@ -0,0 +1,73 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoffStrategies(t *testing.T) {
+	assert := assert.New(t)
+
+	b := &Backoff{Initial: time.Second, Factor: 2}
+	assert.Equal(time.Second, b.Delay(0))
+	assert.Equal(time.Second, b.Delay(1))
+	assert.Equal(2*time.Second, b.Delay(2))
+	assert.Equal(8*time.Second, b.Delay(4))
+	b.Max = 5 * time.Second
+	assert.Equal(5*time.Second, b.Delay(4))
+	b.Factor = 0.5
+	assert.Equal(time.Second, b.Delay(4))
+
+	b = &Backoff{Strategy: RetryStrategyLinear, Initial: time.Second, Factor: 2}
+	assert.Equal(time.Second, b.Delay(1))
+	assert.Equal(3*time.Second, b.Delay(3))
+
+	b = &Backoff{Strategy: RetryStrategyFixed, Initial: time.Second, Factor: 2}
+	assert.Equal(time.Second, b.Delay(1))
+	assert.Equal(time.Second, b.Delay(10))
+}
+
+func TestBackoffJitter(t *testing.T) {
+	assert := assert.New(t)
+	b := &Backoff{Strategy: RetryStrategyFixed, Initial: time.Second, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		delay := b.Delay(1)
+		assert.GreaterOrEqual(delay, 500*time.Millisecond)
+		assert.LessOrEqual(delay, 1500*time.Millisecond)
+	}
+}
+
+func TestValidateRetryStrategy(t *testing.T) {
+	assert := assert.New(t)
+	strategy, err := ValidateRetryStrategy("Linear", 0.2)
+	assert.NoError(err)
+	assert.Equal(RetryStrategyLinear, strategy)
+	strategy, err = ValidateRetryStrategy("", 0)
+	assert.NoError(err)
+	assert.Empty(strategy)
+
+	_, err = ValidateRetryStrategy("random", 0)
+	assert.EqualError(err, "Invalid retryStrategy 'random'. Must be 'exponential', 'linear' or 'fixed'")
+	_, err = ValidateRetryStrategy(RetryStrategyFixed, 1.5)
+	assert.EqualError(err, "Invalid retryJitter 1.5. Must be between 0 and 1")
+	_, err = ValidateRetryStrategy(RetryStrategyFixed, -0.1)
+	assert.Error(err)
+}
@@ -0,0 +1,79 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"crypto/rand"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	ulid "github.com/oklog/ulid/v2"
+)
+
+const (
+	// IDFormatUUID generates random UUID V4s. The default
+	IDFormatUUID = "uuid"
+	// IDFormatULID generates ULIDs, which sort by the time they were generated
+	IDFormatULID = "ulid"
+)
+
+// the prefix is part of URLs and of the keys of the stores, so is limited to characters safe in both
+var idPrefixRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.-]{0,32}$`)
+
+// idScheme is how the IDs of streams, subscriptions and receipts are generated, configured at startup
+var idScheme = struct {
+	mux     sync.Mutex
+	prefix  string
+	format  string
+	entropy *ulid.MonotonicEntropy
+}{
+	format:  IDFormatUUID,
+	entropy: ulid.Monotonic(rand.Reader, 0),
+}
+
+// ConfigureIDs sets the prefix and format of the IDs returned by NewID. The prefix can embed
+// an identifier of the instance in multi-instance deployments
+func ConfigureIDs(prefix, format string) error {
+	format = strings.ToLower(format)
+	if format == "" {
+		format = IDFormatUUID
+	}
+	if format != IDFormatUUID && format != IDFormatULID {
+		return errors.Errorf(errors.ConfigIDFormatInvalid, format)
+	}
+	if !idPrefixRegexp.MatchString(prefix) {
+		return errors.Errorf(errors.ConfigIDPrefixInvalid, prefix)
+	}
+	idScheme.mux.Lock()
+	defer idScheme.mux.Unlock()
+	idScheme.prefix = prefix
+	idScheme.format = format
+	return nil
+}
+
+// NewID returns a new ID for a stream, subscription or receipt, in the configured scheme
+func NewID() string {
+	idScheme.mux.Lock()
+	defer idScheme.mux.Unlock()
+	if idScheme.format == IDFormatULID {
+		return idScheme.prefix + strings.ToLower(ulid.MustNew(ulid.Timestamp(time.Now()), idScheme.entropy).String())
+	}
+	return idScheme.prefix + UUIDv4()
+}
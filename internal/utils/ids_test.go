@@ -0,0 +1,46 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewID(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { _ = ConfigureIDs("", "") }()
+
+	assert.Regexp("^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[0-9a-f]{4}-[0-9a-f]{12}$", NewID())
+
+	err := ConfigureIDs("node1-", "ULID")
+	assert.NoError(err)
+	ids := make([]string, 100)
+	for i := range ids {
+		ids[i] = NewID()
+		assert.Regexp("^node1-[0-9a-hjkmnp-tv-z]{26}$", ids[i])
+	}
+	assert.True(sort.StringsAreSorted(ids))
+
+	err = ConfigureIDs("node/1", "uuid")
+	assert.Regexp("Invalid ID prefix 'node/1'", err)
+	err = ConfigureIDs("", "snowflake")
+	assert.Regexp("Invalid ID format 'snowflake'", err)
+	assert.Regexp("^node1-", NewID())
+}
@@ -0,0 +1,287 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+)
+
+// JSONPatchContentType is the media type of RFC 6902 JSON Patch documents
+const JSONPatchContentType = "application/json-patch+json"
+
+// JSONPatchOperation is one operation of an RFC 6902 JSON Patch
+type JSONPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// ParseJSONPatch parses the operations of an RFC 6902 JSON Patch
+func ParseJSONPatch(patch []byte) ([]JSONPatchOperation, error) {
+	var ops []JSONPatchOperation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, errors.Errorf(errors.JSONPatchInvalid, err)
+	}
+	return ops, nil
+}
+
+// ApplyJSONPatch applies an RFC 6902 JSON Patch to a JSON document. The operations are
+// applied in order, and the document is unchanged if any of them fails
+func ApplyJSONPatch(doc []byte, patch []byte) ([]byte, error) {
+	ops, err := ParseJSONPatch(patch)
+	if err != nil {
+		return nil, err
+	}
+	var root interface{}
+	if err := json.Unmarshal(doc, &root); err != nil {
+		return nil, errors.Errorf(errors.JSONPatchInvalid, err)
+	}
+	for i, op := range ops {
+		if root, err = applyJSONPatchOperation(root, &op); err != nil {
+			return nil, errors.Errorf(errors.JSONPatchOperationFailed, i, op.Op, op.Path, err)
+		}
+	}
+	return json.Marshal(root)
+}
+
+func applyJSONPatchOperation(root interface{}, op *JSONPatchOperation) (interface{}, error) {
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, errors.Errorf(errors.JSONPatchMissingValue)
+		}
+		var value interface{}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, err
+		}
+		switch op.Op {
+		case "add":
+			return jsonPointerAdd(root, op.Path, value)
+		case "replace":
+			return jsonPointerReplace(root, op.Path, value)
+		default:
+			current, err := JSONPointerGet(root, op.Path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, errors.Errorf(errors.JSONPatchTestFailed)
+			}
+			return root, nil
+		}
+	case "remove":
+		return jsonPointerRemove(root, op.Path)
+	case "move", "copy":
+		value, err := JSONPointerGet(root, op.From)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if strings.HasPrefix(op.Path, op.From+"/") {
+				return nil, errors.Errorf(errors.JSONPatchMoveIntoChild)
+			}
+			if root, err = jsonPointerRemove(root, op.From); err != nil {
+				return nil, err
+			}
+		} else {
+			// the copy must not share maps or slices with the original
+			b, _ := json.Marshal(value)
+			_ = json.Unmarshal(b, &value)
+		}
+		return jsonPointerAdd(root, op.Path, value)
+	default:
+		return nil, errors.Errorf(errors.JSONPatchUnknownOp, op.Op)
+	}
+}
+
+// parseJSONPointer splits an RFC 6901 JSON Pointer into its unescaped reference tokens
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errors.Errorf(errors.JSONPatchInvalidPointer, pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 || idx > length || (idx == length && !allowEnd) || (len(token) > 1 && token[0] == '0') {
+		return -1, errors.Errorf(errors.JSONPatchPathNotFound, token)
+	}
+	return idx, nil
+}
+
+// JSONPointerGet returns the value an RFC 6901 JSON Pointer refers to, in a decoded JSON document
+func JSONPointerGet(root interface{}, pointer string) (interface{}, error) {
+	tokens, err := parseJSONPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	current := root
+	for _, t := range tokens {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			v, ok := node[t]
+			if !ok {
+				return nil, errors.Errorf(errors.JSONPatchPathNotFound, pointer)
+			}
+			current = v
+		case []interface{}:
+			idx, err := arrayIndex(t, len(node), false)
+			if err != nil {
+				return nil, errors.Errorf(errors.JSONPatchPathNotFound, pointer)
+			}
+			current = node[idx]
+		default:
+			return nil, errors.Errorf(errors.JSONPatchPathNotFound, pointer)
+		}
+	}
+	return current, nil
+}
+
+// jsonPointerUpdate calls the update function with the parent of the target of the pointer,
+// and the last reference token, then sets the parent to the result. This lets arrays grow and shrink
+func jsonPointerUpdate(root interface{}, pointer string, update func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	tokens, err := parseJSONPointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return update(nil, "")
+	}
+	var walk func(node interface{}, tokens []string) (interface{}, error)
+	walk = func(node interface{}, tokens []string) (interface{}, error) {
+		if len(tokens) == 1 {
+			return update(node, tokens[0])
+		}
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[tokens[0]]
+			if !ok {
+				return nil, errors.Errorf(errors.JSONPatchPathNotFound, pointer)
+			}
+			updated, err := walk(child, tokens[1:])
+			if err != nil {
+				return nil, err
+			}
+			n[tokens[0]] = updated
+			return n, nil
+		case []interface{}:
+			idx, err := arrayIndex(tokens[0], len(n), false)
+			if err != nil {
+				return nil, errors.Errorf(errors.JSONPatchPathNotFound, pointer)
+			}
+			updated, err := walk(n[idx], tokens[1:])
+			if err != nil {
+				return nil, err
+			}
+			n[idx] = updated
+			return n, nil
+		default:
+			return nil, errors.Errorf(errors.JSONPatchPathNotFound, pointer)
+		}
+	}
+	return walk(root, tokens)
+}
+
+func jsonPointerAdd(root interface{}, pointer string, value interface{}) (interface{}, error) {
+	return jsonPointerUpdate(root, pointer, func(parent interface{}, token string) (interface{}, error) {
+		if pointer == "" {
+			return value, nil
+		}
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			p[token] = value
+			return p, nil
+		case []interface{}:
+			idx, err := arrayIndex(token, len(p), true)
+			if err != nil {
+				return nil, errors.Errorf(errors.JSONPatchPathNotFound, pointer)
+			}
+			p = append(p, nil)
+			copy(p[idx+1:], p[idx:])
+			p[idx] = value
+			return p, nil
+		default:
+			return nil, errors.Errorf(errors.JSONPatchPathNotFound, pointer)
+		}
+	})
+}
+
+func jsonPointerReplace(root interface{}, pointer string, value interface{}) (interface{}, error) {
+	return jsonPointerUpdate(root, pointer, func(parent interface{}, token string) (interface{}, error) {
+		if pointer == "" {
+			return value, nil
+		}
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := p[token]; !ok {
+				return nil, errors.Errorf(errors.JSONPatchPathNotFound, pointer)
+			}
+			p[token] = value
+			return p, nil
+		case []interface{}:
+			idx, err := arrayIndex(token, len(p), false)
+			if err != nil {
+				return nil, errors.Errorf(errors.JSONPatchPathNotFound, pointer)
+			}
+			p[idx] = value
+			return p, nil
+		default:
+			return nil, errors.Errorf(errors.JSONPatchPathNotFound, pointer)
+		}
+	})
+}
+
+func jsonPointerRemove(root interface{}, pointer string) (interface{}, error) {
+	return jsonPointerUpdate(root, pointer, func(parent interface{}, token string) (interface{}, error) {
+		if pointer == "" {
+			return nil, nil
+		}
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := p[token]; !ok {
+				return nil, errors.Errorf(errors.JSONPatchPathNotFound, pointer)
+			}
+			delete(p, token)
+			return p, nil
+		case []interface{}:
+			idx, err := arrayIndex(token, len(p), false)
+			if err != nil {
+				return nil, errors.Errorf(errors.JSONPatchPathNotFound, pointer)
+			}
+			return append(p[:idx], p[idx+1:]...), nil
+		default:
+			return nil, errors.Errorf(errors.JSONPatchPathNotFound, pointer)
+		}
+	})
+}
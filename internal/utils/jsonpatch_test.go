@@ -0,0 +1,78 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyJSONPatch(t *testing.T) {
+	// examples from appendix A of RFC 6902
+	tests := []struct {
+		doc      string
+		patch    string
+		expected string
+	}{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{`{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"child":{"grandchild":{}},"foo":"bar"}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`},
+		{`{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10},{"op":"remove","path":"/~1"}]`, `{"~1":10}`},
+		{`{"foo":{"bar":1}}`, `[{"op":"copy","from":"/foo","path":"/baz"},{"op":"replace","path":"/baz/bar","value":2}]`, `{"baz":{"bar":2},"foo":{"bar":1}}`},
+		{`{"foo":true}`, `[{"op":"replace","path":"/foo","value":null}]`, `{"foo":null}`},
+		{`{"foo":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`},
+	}
+	for _, test := range tests {
+		result, err := ApplyJSONPatch([]byte(test.doc), []byte(test.patch))
+		assert.NoError(t, err, test.patch)
+		assert.JSONEq(t, test.expected, string(result), test.patch)
+	}
+}
+
+func TestApplyJSONPatchErrors(t *testing.T) {
+	tests := []struct {
+		doc   string
+		patch string
+		err   string
+	}{
+		{`{}`, `{}`, "Invalid JSON Patch"},
+		{`!`, `[]`, "Invalid JSON Patch"},
+		{`{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, "Value does not match"},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, "Path '/baz/bat' not found"},
+		{`{"foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"qux"}]`, "Path '/baz' not found"},
+		{`{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, "Path '/baz' not found"},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/2","value":"qux"}]`, "Path '/foo/2' not found"},
+		{`{"foo":["bar"]}`, `[{"op":"remove","path":"/foo/01"}]`, "Path '/foo/01' not found"},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz"}]`, "Missing value"},
+		{`{"foo":"bar"}`, `[{"op":"merge","path":"/foo","value":1}]`, "Unknown operation 'merge'"},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"foo","value":1}]`, "Invalid JSON Pointer 'foo'"},
+		{`{"foo":{"bar":1}}`, `[{"op":"move","from":"/foo","path":"/foo/bar/baz"}]`, "Cannot move a value into one of its children"},
+		{`{"foo":"bar"}`, `[{"op":"copy","from":"/baz","path":"/foo"}]`, "Path '/baz' not found"},
+	}
+	for _, test := range tests {
+		_, err := ApplyJSONPatch([]byte(test.doc), []byte(test.patch))
+		assert.Regexp(t, test.err, err, test.patch)
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/hyperledger/firefly-fabconnect/internal/errors"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	ResultFormatJSON       = "json"
+	ResultFormatString     = "string"
+	ResultFormatHex        = "hex"
+	ResultFormatBase64     = "base64"
+	ResultFormatHexJSON    = "hex-json"
+	ResultFormatBase64JSON = "base64-json"
+	ResultFormatProtobuf   = "protobuf"
+)
+
+// ResultDecoder decodes the results of the functions of a chaincode matching its rule
+type ResultDecoder struct {
+	channel  string
+	function string
+	format   string
+	message  protoreflect.MessageDescriptor
+}
+
+// ResultDecoders holds the result decoder rules, by chaincode
+type ResultDecoders struct {
+	byChaincode map[string][]*ResultDecoder
+}
+
+// NewResultDecoders validates the rules, and loads the protobuf descriptors they refer to
+func NewResultDecoders(rules []conf.ResultDecoderConf) (*ResultDecoders, error) {
+	rd := &ResultDecoders{
+		byChaincode: make(map[string][]*ResultDecoder),
+	}
+	for i := range rules {
+		rule := &rules[i]
+		decoder, err := newResultDecoder(rule)
+		if err != nil {
+			return nil, errors.Errorf(errors.ConfigRESTGatewayResultDecoderInvalid, i, rule.Chaincode, err)
+		}
+		rd.byChaincode[rule.Chaincode] = append(rd.byChaincode[rule.Chaincode], decoder)
+	}
+	return rd, nil
+}
+
+func newResultDecoder(rule *conf.ResultDecoderConf) (*ResultDecoder, error) {
+	if rule.Chaincode == "" {
+		return nil, fmt.Errorf("chaincode must be set")
+	}
+	decoder := &ResultDecoder{
+		channel:  rule.Channel,
+		function: rule.Function,
+		format:   strings.ToLower(rule.Format),
+	}
+	switch decoder.format {
+	case ResultFormatJSON, ResultFormatString, ResultFormatHex, ResultFormatBase64, ResultFormatHexJSON, ResultFormatBase64JSON:
+	case ResultFormatProtobuf:
+		message, err := loadProtoMessage(rule.ProtoDescriptorSet, rule.ProtoMessage)
+		if err != nil {
+			return nil, err
+		}
+		decoder.message = message
+	default:
+		return nil, fmt.Errorf("unknown format '%s'", rule.Format)
+	}
+	return decoder, nil
+}
+
+func loadProtoMessage(descriptorSetFile, messageName string) (protoreflect.MessageDescriptor, error) {
+	if descriptorSetFile == "" || messageName == "" {
+		return nil, fmt.Errorf("protoDescriptorSet and protoMessage must be set for the protobuf format")
+	}
+	b, err := os.ReadFile(descriptorSetFile)
+	if err != nil {
+		return nil, err
+	}
+	var fds descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(b, &fds); err != nil {
+		return nil, fmt.Errorf("failed to parse protoDescriptorSet: %s", err)
+	}
+	files, err := protodesc.NewFiles(&fds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse protoDescriptorSet: %s", err)
+	}
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(messageName))
+	if err != nil {
+		return nil, fmt.Errorf("message '%s' not found in protoDescriptorSet", messageName)
+	}
+	message, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("'%s' is not a message", messageName)
+	}
+	return message, nil
+}
+
+// Lookup returns the most specific decoder for the results of a function of a chaincode, or
+// nil if no rule matches it. A rule for the function is more specific than a rule for the channel
+func (rd *ResultDecoders) Lookup(channel, chaincode, function string) *ResultDecoder {
+	if rd == nil {
+		return nil
+	}
+	var match *ResultDecoder
+	bestScore := -1
+	for _, decoder := range rd.byChaincode[chaincode] {
+		if (decoder.channel != "" && decoder.channel != channel) || (decoder.function != "" && decoder.function != function) {
+			continue
+		}
+		score := 0
+		if decoder.function != "" {
+			score += 2
+		}
+		if decoder.channel != "" {
+			score++
+		}
+		if score > bestScore {
+			match = decoder
+			bestScore = score
+		}
+	}
+	return match
+}
+
+// Decode decodes the result of a function of a chaincode with the rule matching it. Results without
+// a rule, or that fail to decode with theirs, are decoded the same as DecodePayload
+func (rd *ResultDecoders) Decode(channel, chaincode, function string, payload []byte) interface{} {
+	decoder := rd.Lookup(channel, chaincode, function)
+	if decoder == nil {
+		return DecodePayload(payload)
+	}
+	result, err := decoder.Decode(payload)
+	if err != nil {
+		log.Warnf("Result of [chaincode=%s, func=%s] returned undecoded: %s", chaincode, function, err)
+		return DecodePayload(payload)
+	}
+	return result
+}
+
+// Decode decodes a result with the format of the rule
+func (d *ResultDecoder) Decode(payload []byte) (interface{}, error) {
+	var err error
+	switch d.format {
+	case ResultFormatString:
+		return string(payload), nil
+	case ResultFormatHex:
+		return hex.EncodeToString(payload), nil
+	case ResultFormatBase64:
+		return base64.StdEncoding.EncodeToString(payload), nil
+	case ResultFormatHexJSON:
+		payload, err = hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(payload)), "0x"))
+	case ResultFormatBase64JSON:
+		payload, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(payload)))
+	case ResultFormatProtobuf:
+		message := dynamicpb.NewMessage(d.message)
+		if err = proto.Unmarshal(payload, message); err == nil {
+			payload, err = protojson.Marshal(message)
+		}
+	}
+	if err != nil {
+		return nil, errors.Errorf(errors.ResultDecodingFailed, d.format, err)
+	}
+	var structured interface{}
+	if err := json.Unmarshal(payload, &structured); err != nil {
+		return nil, errors.Errorf(errors.ResultDecodingFailed, d.format, err)
+	}
+	return structured, nil
+}
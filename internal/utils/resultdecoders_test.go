@@ -0,0 +1,120 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/hyperledger/firefly-fabconnect/internal/conf"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func writeAssetDescriptorSet(t *testing.T) string {
+	fds := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{{
+			Name:    proto.String("asset.proto"),
+			Package: proto.String("example"),
+			Syntax:  proto.String("proto3"),
+			MessageType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("Asset"),
+				Field: []*descriptorpb.FieldDescriptorProto{{
+					Name:     proto.String("asset_id"),
+					JsonName: proto.String("assetId"),
+					Number:   proto.Int32(1),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				}},
+			}},
+		}},
+	}
+	b, err := proto.Marshal(fds)
+	assert.NoError(t, err)
+	file := path.Join(t.TempDir(), "asset.pb")
+	assert.NoError(t, os.WriteFile(file, b, 0600))
+	return file
+}
+
+func TestResultDecodersFormats(t *testing.T) {
+	assert := assert.New(t)
+	rd, err := NewResultDecoders([]conf.ResultDecoderConf{
+		{Chaincode: "hexcc", Format: "hex-json"},
+		{Chaincode: "b64cc", Format: "base64-json"},
+		{Chaincode: "rawcc", Format: "hex"},
+		{Chaincode: "strcc", Format: "String"},
+		{Chaincode: "assetcc", Format: "protobuf", ProtoDescriptorSet: writeAssetDescriptorSet(t), ProtoMessage: "example.Asset"},
+	})
+	assert.NoError(err)
+
+	assert.Equal(map[string]interface{}{"a": "b"}, rd.Decode("ch1", "hexcc", "get", []byte("0x7b2261223a2262227d")))
+	assert.Equal(map[string]interface{}{"a": "b"}, rd.Decode("ch1", "b64cc", "get", []byte("eyJhIjoiYiJ9")))
+	assert.Equal("0102", rd.Decode("ch1", "rawcc", "get", []byte{1, 2}))
+	assert.Equal(`{"a":"b"}`, rd.Decode("ch1", "strcc", "get", []byte(`{"a":"b"}`)))
+
+	asset := protowire.AppendTag(nil, 1, protowire.BytesType)
+	asset = protowire.AppendString(asset, "asset1")
+	assert.Equal(map[string]interface{}{"assetId": "asset1"}, rd.Decode("ch1", "assetcc", "get", asset))
+
+	// results without a rule, or that fail to decode with theirs, are decoded as before
+	assert.Equal(map[string]interface{}{"a": "b"}, rd.Decode("ch1", "othercc", "get", []byte(`{"a":"b"}`)))
+	assert.Equal("not hex", rd.Decode("ch1", "hexcc", "get", []byte("not hex")))
+	assert.Equal(string([]byte{0xff}), rd.Decode("ch1", "assetcc", "get", []byte{0xff}))
+}
+
+func TestResultDecodersLookup(t *testing.T) {
+	assert := assert.New(t)
+	rd, err := NewResultDecoders([]conf.ResultDecoderConf{
+		{Chaincode: "cc1", Format: "json"},
+		{Chaincode: "cc1", Channel: "ch2", Format: "hex-json"},
+		{Chaincode: "cc1", Function: "getRaw", Format: "base64"},
+	})
+	assert.NoError(err)
+
+	assert.Equal("json", rd.Lookup("ch1", "cc1", "get").format)
+	assert.Equal("hex-json", rd.Lookup("ch2", "cc1", "get").format)
+	assert.Equal("base64", rd.Lookup("ch2", "cc1", "getRaw").format)
+	assert.Nil(rd.Lookup("ch1", "cc2", "get"))
+
+	var none *ResultDecoders
+	assert.Nil(none.Lookup("ch1", "cc1", "get"))
+	assert.Equal("raw", none.Decode("ch1", "cc1", "get", []byte("raw")))
+}
+
+func TestResultDecodersInvalid(t *testing.T) {
+	assert := assert.New(t)
+	_, err := NewResultDecoders([]conf.ResultDecoderConf{{Format: "json"}})
+	assert.EqualError(err, "Invalid result decoder 0 for chaincode '': chaincode must be set")
+	_, err = NewResultDecoders([]conf.ResultDecoderConf{{Chaincode: "cc1", Format: "xml"}})
+	assert.EqualError(err, "Invalid result decoder 0 for chaincode 'cc1': unknown format 'xml'")
+	_, err = NewResultDecoders([]conf.ResultDecoderConf{{Chaincode: "cc1", Format: "protobuf"}})
+	assert.Regexp("protoDescriptorSet and protoMessage must be set", err)
+	_, err = NewResultDecoders([]conf.ResultDecoderConf{{Chaincode: "cc1", Format: "protobuf", ProtoDescriptorSet: "/missing.pb", ProtoMessage: "example.Asset"}})
+	assert.Regexp("no such file", err)
+	descriptors := writeAssetDescriptorSet(t)
+	_, err = NewResultDecoders([]conf.ResultDecoderConf{{Chaincode: "cc1", Format: "protobuf", ProtoDescriptorSet: descriptors, ProtoMessage: "example.Missing"}})
+	assert.Regexp("message 'example.Missing' not found", err)
+	_, err = NewResultDecoders([]conf.ResultDecoderConf{{Chaincode: "cc1", Format: "protobuf", ProtoDescriptorSet: descriptors, ProtoMessage: "example.Asset.asset_id"}})
+	assert.Regexp("is not a message", err)
+	bad := path.Join(t.TempDir(), "bad.pb")
+	assert.NoError(os.WriteFile(bad, []byte{0xff}, 0600))
+	_, err = NewResultDecoders([]conf.ResultDecoderConf{{Chaincode: "cc1", Format: "protobuf", ProtoDescriptorSet: bad, ProtoMessage: "example.Asset"}})
+	assert.Regexp("failed to parse protoDescriptorSet", err)
+}
@@ -68,5 +68,9 @@ func CreateTLSConfiguration(tlsConfig *conf.TLSConfig) (t *tls.Config, err error
 		RootCAs:            caCertPool,
 		InsecureSkipVerify: tlsConfig.InsecureSkipVerify,
 	}
+	if tlsConfig.ClientAuth {
+		t.ClientAuth = tls.RequireAndVerifyClientCert
+		t.ClientCAs = caCertPool
+	}
 	return t, nil
 }
@@ -0,0 +1,87 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ws
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const systemEventQueueLength = 100
+
+// SystemEvent is an event about the connector itself, broadcast on the SystemTopic
+type SystemEvent struct {
+	Type      string      `json:"type"`
+	Timestamp int64       `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// SystemEventPublisher broadcasts system events in the order they are published.
+// Events are queued, so that publishers never wait for slow WebSocket clients, and
+// dropped with a warning if the queue is full
+type SystemEventPublisher struct {
+	broadcast chan<- interface{}
+	queue     chan *SystemEvent
+	done      chan struct{}
+}
+
+// NewSystemEventPublisher constructor
+func NewSystemEventPublisher(channels WebSocketChannels) *SystemEventPublisher {
+	_, broadcast, _, _ := channels.GetChannels(SystemTopic)
+	p := &SystemEventPublisher{
+		broadcast: broadcast,
+		queue:     make(chan *SystemEvent, systemEventQueueLength),
+		done:      make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Publish queues an event for broadcast
+func (p *SystemEventPublisher) Publish(eventType string, data interface{}) {
+	event := &SystemEvent{
+		Type:      eventType,
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+		Data:      data,
+	}
+	select {
+	case p.queue <- event:
+	default:
+		log.Warnf("System event queue full, dropping %s event", eventType)
+	}
+}
+
+// Close stops the broadcast of queued events
+func (p *SystemEventPublisher) Close() {
+	close(p.done)
+}
+
+func (p *SystemEventPublisher) run() {
+	for {
+		select {
+		case event := <-p.queue:
+			select {
+			case p.broadcast <- event:
+			case <-p.done:
+				return
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright © 2023 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ws
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSystemEventBroadcast(t *testing.T) {
+	assert := assert.New(t)
+
+	w, ts := newTestWebSocketServer()
+	defer ts.Close()
+	defer w.Close()
+
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	u.Path = "/ws"
+	c, _, err := ws.DefaultDialer.Dial(u.String(), nil)
+	assert.NoError(err)
+	_ = c.WriteJSON(&webSocketCommandMessage{
+		Type:  "listen",
+		Topic: SystemTopic,
+	})
+	for {
+		w.mux.Lock()
+		listening := len(w.topicMap[SystemTopic]) > 0
+		w.mux.Unlock()
+		if listening {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	p := NewSystemEventPublisher(w)
+	defer p.Close()
+	p.Publish("event1", map[string]string{"id": "1"})
+	p.Publish("event2", nil)
+
+	var event map[string]interface{}
+	_ = c.ReadJSON(&event)
+	assert.Equal("event1", event["type"])
+	assert.Equal(map[string]interface{}{"id": "1"}, event["data"])
+	assert.NotZero(event["timestamp"])
+	_ = c.ReadJSON(&event)
+	assert.Equal("event2", event["type"])
+}
+
+type blockedChannels struct {
+	broadcast chan interface{}
+}
+
+func (b *blockedChannels) GetChannels(topic string) (chan<- interface{}, chan<- interface{}, <-chan error, <-chan struct{}) {
+	return nil, b.broadcast, nil, nil
+}
+
+func (b *blockedChannels) SendReply(message interface{}) {}
+
+func TestSystemEventPublisherQueueFull(t *testing.T) {
+	assert := assert.New(t)
+	channels := &blockedChannels{broadcast: make(chan interface{})}
+	p := NewSystemEventPublisher(channels)
+
+	// publishers are not blocked by a broadcast that cannot complete
+	for i := 0; i < systemEventQueueLength+5; i++ {
+		p.Publish("event", i)
+	}
+	assert.True(len(p.queue) >= systemEventQueueLength-1)
+	p.Close()
+}
@@ -17,6 +17,7 @@
 package ws
 
 import (
+	"context"
 	"reflect"
 	"strings"
 	"sync"
@@ -25,6 +26,7 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
 
+	"github.com/hyperledger/firefly-fabconnect/internal/auth"
 	"github.com/hyperledger/firefly-fabconnect/internal/errors"
 	"github.com/hyperledger/firefly-fabconnect/internal/utils"
 )
@@ -40,16 +42,28 @@ type webSocketConnection struct {
 	newTopic  chan bool
 	receive   chan error
 	closing   chan struct{}
+	scope     *auth.ConsumerScope // set when the client connected with a consumer token
+	expires   time.Time           // zero unless the token the client authenticated with expires
+	expiry    *time.Timer
 }
 
 type webSocketCommandMessage struct {
 	Type    string `json:"type,omitempty"`
 	Topic   string `json:"topic,omitempty"`
 	Message string `json:"message,omitempty"`
+	Token   string `json:"token,omitempty"`
 }
 
-func newConnection(server *webSocketServer, conn *websocket.Conn) *webSocketConnection {
+// webSocketAuthReply answers a client that re-authenticated, with when the new token expires
+type webSocketAuthReply struct {
+	Type    string     `json:"type"`
+	Expires *time.Time `json:"expires,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+func newConnection(server *webSocketServer, conn *websocket.Conn, scope *auth.ConsumerScope, expires time.Time) *webSocketConnection {
 	wsc := &webSocketConnection{
+		scope:     scope,
 		id:        utils.UUIDv4(),
 		server:    server,
 		conn:      conn,
@@ -59,6 +73,7 @@ func newConnection(server *webSocketServer, conn *websocket.Conn) *webSocketConn
 		receive:   make(chan error),
 		closing:   make(chan struct{}),
 	}
+	wsc.setExpiry(expires)
 	go wsc.listen()
 	go wsc.sender()
 	return wsc
@@ -71,6 +86,9 @@ func (c *webSocketConnection) close() {
 		c.conn.Close()
 		close(c.closing)
 	}
+	if c.expiry != nil {
+		c.expiry.Stop()
+	}
 	c.mux.Unlock()
 
 	for _, t := range c.topics {
@@ -144,8 +162,16 @@ func (c *webSocketConnection) listen() {
 			logrus.Errorf("WS/%s: Error: %s", c.id, err)
 			return
 		}
-		logrus.Debugf("WS/%s: Received: %+v", c.id, msg)
+		logrus.Debugf("WS/%s: Received: %+v", c.id, msg.Type)
 
+		if strings.ToLower(msg.Type) == "auth" {
+			c.reauthenticate(msg.Token)
+			continue
+		}
+		if !c.allowed(&msg) {
+			logrus.Errorf("WS/%s: Consumer '%s' is not permitted to %s on topic '%s'", c.id, c.scope.Subject, msg.Type, msg.Topic)
+			continue
+		}
 		t := c.server.getTopic(msg.Topic)
 		switch strings.ToLower(msg.Type) {
 		case "listen":
@@ -163,6 +189,98 @@ func (c *webSocketConnection) listen() {
 	}
 }
 
+// setExpiry closes the connection when the token the client authenticated with expires, replacing
+// the deadline of any token it authenticated with before
+func (c *webSocketConnection) setExpiry(expires time.Time) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.expiry != nil {
+		c.expiry.Stop()
+		c.expiry = nil
+	}
+	c.expires = expires
+	if !expires.IsZero() && !c.closed {
+		c.expiry = time.AfterFunc(time.Until(expires), c.expired)
+	}
+}
+
+func (c *webSocketConnection) expired() {
+	c.mux.Lock()
+	// the client may have re-authenticated as the timer fired
+	refreshed := c.expires.IsZero() || time.Now().Before(c.expires)
+	c.mux.Unlock()
+	if refreshed {
+		return
+	}
+	logrus.Infof("WS/%s: Token expired without the client re-authenticating. Closing connection", c.id)
+	reason := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, errors.Errorf(errors.WebSocketTokenExpired).Error())
+	_ = c.conn.WriteControl(websocket.CloseMessage, reason, time.Now().Add(time.Second))
+	c.close()
+}
+
+// reauthenticate replaces the token of the connection with a new one, before the old one expires.
+// The new token must be for the same consumer, and cover the topics the client is listening on
+func (c *webSocketConnection) reauthenticate(token string) {
+	err := c.verifyToken(token)
+	reply := &webSocketAuthReply{Type: "authenticated"}
+	if err != nil {
+		logrus.Errorf("WS/%s: %s", c.id, err)
+		reply = &webSocketAuthReply{Type: "error", Message: err.Error()}
+	} else {
+		c.mux.Lock()
+		if !c.expires.IsZero() {
+			expires := c.expires.UTC()
+			reply.Expires = &expires
+		}
+		c.mux.Unlock()
+		logrus.Infof("WS/%s: Re-authenticated. Expires=%v", c.id, reply.Expires)
+	}
+	select {
+	case c.broadcast <- reply:
+	case <-c.closing:
+	}
+}
+
+func (c *webSocketConnection) verifyToken(token string) error {
+	authenticator := c.server.getAuthenticator()
+	if authenticator == nil {
+		return errors.Errorf(errors.WebSocketAuthNotSupported)
+	}
+	ctx, err := authenticator(context.Background(), token)
+	if err != nil {
+		return errors.Errorf(errors.WebSocketAuthFailed, err)
+	}
+	scope := auth.GetConsumerScope(ctx)
+	if (scope == nil) != (c.scope == nil) || (scope != nil && scope.Subject != c.scope.Subject) {
+		return errors.Errorf(errors.WebSocketAuthIdentityChanged)
+	}
+	if scope != nil {
+		c.mux.Lock()
+		for topic := range c.topics {
+			if !scope.AllowsTopic(topic) {
+				c.mux.Unlock()
+				return errors.Errorf(errors.WebSocketAuthTopicNotAllowed, topic)
+			}
+		}
+		c.mux.Unlock()
+		c.scope = scope
+	}
+	c.setExpiry(auth.GetTokenExpiry(ctx))
+	return nil
+}
+
+// allowed checks a client that connected with a consumer token only uses the topics it is scoped
+// to. Replies are the receipts of all transactions, so they are not available to consumers
+func (c *webSocketConnection) allowed(msg *webSocketCommandMessage) bool {
+	if c.scope == nil {
+		return true
+	}
+	if strings.ToLower(msg.Type) == "listenreplies" {
+		return false
+	}
+	return c.scope.AllowsTopic(msg.Topic)
+}
+
 func (c *webSocketConnection) handleAckOrError(t *webSocketTopic, err error) {
 	isError := err != nil
 	select {
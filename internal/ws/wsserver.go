@@ -17,16 +17,21 @@
 package ws
 
 import (
+	"context"
 	"net/http"
 	"reflect"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/hyperledger/firefly-fabconnect/internal/auth"
 	"github.com/julienschmidt/httprouter"
 	log "github.com/sirupsen/logrus"
 )
 
+// SystemTopic is the reserved topic that events about the connector itself are broadcast on
+const SystemTopic = "fabconnect_system"
+
 // WebSocketChannels is provided to allow us to do a blocking send to a namespace that will complete once a client connects on it
 // We also provide a channel to listen on for closing of the connection, to allow a select to wake on a blocking send
 type WebSocketChannels interface {
@@ -38,9 +43,14 @@ type WebSocketChannels interface {
 type WebSocketServer interface {
 	WebSocketChannels
 	NewConnection(w http.ResponseWriter, r *http.Request, p httprouter.Params)
+	SetAuthenticator(authenticator Authenticator)
 	Close()
 }
 
+// Authenticator verifies the access token a client re-authenticates with on an open connection,
+// returning a context with its consumer scope, and when it expires
+type Authenticator func(ctx context.Context, accessToken string) (context.Context, error)
+
 type webSocketServer struct {
 	processingTimeout time.Duration
 	mux               sync.Mutex
@@ -51,6 +61,7 @@ type webSocketServer struct {
 	replyChannel      chan interface{}
 	upgrader          *websocket.Upgrader
 	connections       map[string]*webSocketConnection
+	authenticator     Authenticator
 }
 
 type webSocketTopic struct {
@@ -89,10 +100,24 @@ func (s *webSocketServer) NewConnection(w http.ResponseWriter, r *http.Request,
 	}
 	s.mux.Lock()
 	defer s.mux.Unlock()
-	c := newConnection(s, conn)
+	c := newConnection(s, conn, auth.GetConsumerScope(r.Context()), auth.GetTokenExpiry(r.Context()))
 	s.connections[c.id] = c
 }
 
+// SetAuthenticator enables clients to re-authenticate on open connections, so they are not
+// disconnected when the token they connected with expires
+func (s *webSocketServer) SetAuthenticator(authenticator Authenticator) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.authenticator = authenticator
+}
+
+func (s *webSocketServer) getAuthenticator() Authenticator {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.authenticator
+}
+
 func (s *webSocketServer) cycleTopic(t *webSocketTopic) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
@@ -17,6 +17,8 @@
 package ws
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -25,6 +27,7 @@ import (
 	"time"
 
 	ws "github.com/gorilla/websocket"
+	"github.com/hyperledger/firefly-fabconnect/internal/auth"
 	"github.com/julienschmidt/httprouter"
 
 	"github.com/stretchr/testify/assert"
@@ -352,3 +355,133 @@ func TestSendReply(t *testing.T) {
 	_ = c.ReadJSON(&val)
 	assert.Equal("Hello World", val)
 }
+
+func TestConsumerScopedTopics(t *testing.T) {
+	assert := assert.New(t)
+
+	w := NewWebSocketServer().(*webSocketServer)
+	r := &httprouter.Router{}
+	scope := &auth.ConsumerScope{Subject: "app1", Topics: []string{"topic1"}}
+	r.GET("/ws", func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		w.NewConnection(res, req.WithContext(auth.WithConsumerScope(req.Context(), scope)), params)
+	})
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	u.Path = "/ws"
+	c, _, err := ws.DefaultDialer.Dial(u.String(), nil)
+	assert.NoError(err)
+
+	// commands on topics outside the scope of the consumer, and for replies, are ignored
+	_ = c.WriteJSON(&webSocketCommandMessage{Type: "listen", Topic: "topic2"})
+	_ = c.WriteJSON(&webSocketCommandMessage{Type: "listenReplies"})
+	_ = c.WriteJSON(&webSocketCommandMessage{Type: "listen", Topic: "topic1"})
+
+	s, _, _, _ := w.GetChannels("topic1")
+	s <- "Hello World"
+	var val string
+	_ = c.ReadJSON(&val)
+	assert.Equal("Hello World", val)
+
+	w.mux.Lock()
+	assert.NotContains(w.topics, "topic2")
+	assert.Empty(w.replyMap)
+	w.mux.Unlock()
+	c.Close()
+}
+
+func newTestAuthWebSocketServer(scope *auth.ConsumerScope, expires time.Time) (*webSocketServer, *httptest.Server, string) {
+	w := NewWebSocketServer().(*webSocketServer)
+	r := &httprouter.Router{}
+	r.GET("/ws", func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := auth.WithTokenExpiry(auth.WithConsumerScope(req.Context(), scope), expires)
+		w.NewConnection(res, req.WithContext(ctx), params)
+	})
+	ts := httptest.NewServer(r)
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	u.Path = "/ws"
+	return w, ts, u.String()
+}
+
+func TestReauthenticate(t *testing.T) {
+	assert := assert.New(t)
+
+	scope := &auth.ConsumerScope{Subject: "app1", Topics: []string{"topic1"}}
+	w, ts, u := newTestAuthWebSocketServer(scope, time.Now().Add(500*time.Millisecond))
+	defer ts.Close()
+	refreshed := time.Now().Add(time.Hour).Truncate(time.Second)
+	w.SetAuthenticator(func(ctx context.Context, token string) (context.Context, error) {
+		switch token {
+		case "app1":
+			ctx = auth.WithConsumerScope(ctx, &auth.ConsumerScope{Subject: "app1", Topics: []string{"topic1", "topic2"}})
+		case "app2":
+			ctx = auth.WithConsumerScope(ctx, &auth.ConsumerScope{Subject: "app2", Topics: []string{"topic1"}})
+		case "narrowed":
+			ctx = auth.WithConsumerScope(ctx, &auth.ConsumerScope{Subject: "app1", Topics: []string{"topic2"}})
+		default:
+			return nil, fmt.Errorf("pop")
+		}
+		return auth.WithTokenExpiry(ctx, refreshed), nil
+	})
+
+	c, _, err := ws.DefaultDialer.Dial(u, nil)
+	assert.NoError(err)
+	defer c.Close()
+	_ = c.WriteJSON(&webSocketCommandMessage{Type: "listen", Topic: "topic1"})
+	s, _, _, _ := w.GetChannels("topic1")
+
+	var reply webSocketAuthReply
+	for _, test := range []struct{ token, message string }{
+		{"bad", "Re-authentication failed: pop"},
+		{"app2", "Re-authentication must be as the consumer the WebSocket connected as"},
+		{"narrowed", "The new token does not grant access to topic 'topic1'"},
+	} {
+		_ = c.WriteJSON(&webSocketCommandMessage{Type: "auth", Token: test.token})
+		_ = c.ReadJSON(&reply)
+		assert.Equal("error", reply.Type)
+		assert.Regexp(test.message, reply.Message)
+	}
+
+	_ = c.WriteJSON(&webSocketCommandMessage{Type: "auth", Token: "app1"})
+	reply = webSocketAuthReply{}
+	_ = c.ReadJSON(&reply)
+	assert.Equal("authenticated", reply.Type)
+	assert.True(refreshed.Equal(*reply.Expires))
+
+	// the connection outlives the token it connected with, and has the scope of the new one
+	time.Sleep(time.Second)
+	_ = c.WriteJSON(&webSocketCommandMessage{Type: "listen", Topic: "topic2"})
+	s2, _, _, _ := w.GetChannels("topic2")
+	s <- "Hello World"
+	var val string
+	_ = c.ReadJSON(&val)
+	assert.Equal("Hello World", val)
+	s2 <- "Hello Topic2"
+	_ = c.ReadJSON(&val)
+	assert.Equal("Hello Topic2", val)
+}
+
+func TestTokenExpiryClosesConnection(t *testing.T) {
+	assert := assert.New(t)
+
+	_, ts, u := newTestAuthWebSocketServer(&auth.ConsumerScope{Subject: "app1", Topics: []string{"topic1"}}, time.Now().Add(100*time.Millisecond))
+	defer ts.Close()
+
+	c, _, err := ws.DefaultDialer.Dial(u, nil)
+	assert.NoError(err)
+	defer c.Close()
+
+	// without an authenticator the client cannot refresh its token
+	_ = c.WriteJSON(&webSocketCommandMessage{Type: "auth", Token: "app1"})
+	var reply webSocketAuthReply
+	_ = c.ReadJSON(&reply)
+	assert.Equal("error", reply.Type)
+	assert.Equal("Re-authentication is not supported on this WebSocket", reply.Message)
+
+	_, _, err = c.ReadMessage()
+	assert.True(ws.IsCloseError(err, ws.ClosePolicyViolation))
+	assert.Regexp("The token the WebSocket authenticated with has expired", err)
+}
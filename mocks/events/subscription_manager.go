@@ -22,6 +22,38 @@ type SubscriptionManager struct {
 	mock.Mock
 }
 
+// AddEventSchema provides a mock function with given fields: res, req, params
+func (_m *SubscriptionManager) AddEventSchema(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*api.EventSchemaInfo, *util.RestError) {
+	ret := _m.Called(res, req, params)
+
+	if len(ret) == 0 {
+		panic("no return value specified for AddEventSchema")
+	}
+
+	var r0 *api.EventSchemaInfo
+	var r1 *util.RestError
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) (*api.EventSchemaInfo, *util.RestError)); ok {
+		return rf(res, req, params)
+	}
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) *api.EventSchemaInfo); ok {
+		r0 = rf(res, req, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*api.EventSchemaInfo)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(http.ResponseWriter, *http.Request, httprouter.Params) *util.RestError); ok {
+		r1 = rf(res, req, params)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*util.RestError)
+		}
+	}
+
+	return r0, r1
+}
+
 // AddStream provides a mock function with given fields: res, req, params
 func (_m *SubscriptionManager) AddStream(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*events.StreamInfo, *util.RestError) {
 	ret := _m.Called(res, req, params)
@@ -86,11 +118,235 @@ func (_m *SubscriptionManager) AddSubscription(res http.ResponseWriter, req *htt
 	return r0, r1
 }
 
+// AddSubscriptionGroup provides a mock function with given fields: res, req, params
+func (_m *SubscriptionManager) AddSubscriptionGroup(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*api.SubscriptionGroupInfo, *util.RestError) {
+	ret := _m.Called(res, req, params)
+
+	if len(ret) == 0 {
+		panic("no return value specified for AddSubscriptionGroup")
+	}
+
+	var r0 *api.SubscriptionGroupInfo
+	var r1 *util.RestError
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) (*api.SubscriptionGroupInfo, *util.RestError)); ok {
+		return rf(res, req, params)
+	}
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) *api.SubscriptionGroupInfo); ok {
+		r0 = rf(res, req, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*api.SubscriptionGroupInfo)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(http.ResponseWriter, *http.Request, httprouter.Params) *util.RestError); ok {
+		r1 = rf(res, req, params)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*util.RestError)
+		}
+	}
+
+	return r0, r1
+}
+
 // Close provides a mock function with given fields:
 func (_m *SubscriptionManager) Close() {
 	_m.Called()
 }
 
+// CommitConsumerOffset provides a mock function with given fields: res, req, params
+func (_m *SubscriptionManager) CommitConsumerOffset(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*events.ConsumerOffset, *util.RestError) {
+	ret := _m.Called(res, req, params)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CommitConsumerOffset")
+	}
+
+	var r0 *events.ConsumerOffset
+	var r1 *util.RestError
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) (*events.ConsumerOffset, *util.RestError)); ok {
+		return rf(res, req, params)
+	}
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) *events.ConsumerOffset); ok {
+		r0 = rf(res, req, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*events.ConsumerOffset)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(http.ResponseWriter, *http.Request, httprouter.Params) *util.RestError); ok {
+		r1 = rf(res, req, params)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*util.RestError)
+		}
+	}
+
+	return r0, r1
+}
+
+// ConsumerOffset provides a mock function with given fields: res, req, params
+func (_m *SubscriptionManager) ConsumerOffset(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*events.ConsumerOffset, *util.RestError) {
+	ret := _m.Called(res, req, params)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ConsumerOffset")
+	}
+
+	var r0 *events.ConsumerOffset
+	var r1 *util.RestError
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) (*events.ConsumerOffset, *util.RestError)); ok {
+		return rf(res, req, params)
+	}
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) *events.ConsumerOffset); ok {
+		r0 = rf(res, req, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*events.ConsumerOffset)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(http.ResponseWriter, *http.Request, httprouter.Params) *util.RestError); ok {
+		r1 = rf(res, req, params)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*util.RestError)
+		}
+	}
+
+	return r0, r1
+}
+
+// DeadLetters provides a mock function with given fields: res, req, params
+func (_m *SubscriptionManager) DeadLetters(res http.ResponseWriter, req *http.Request, params httprouter.Params) ([]*events.DeadLetter, *util.RestError) {
+	ret := _m.Called(res, req, params)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeadLetters")
+	}
+
+	var r0 []*events.DeadLetter
+	var r1 *util.RestError
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) ([]*events.DeadLetter, *util.RestError)); ok {
+		return rf(res, req, params)
+	}
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) []*events.DeadLetter); ok {
+		r0 = rf(res, req, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*events.DeadLetter)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(http.ResponseWriter, *http.Request, httprouter.Params) *util.RestError); ok {
+		r1 = rf(res, req, params)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*util.RestError)
+		}
+	}
+
+	return r0, r1
+}
+
+// DeleteConsumerOffset provides a mock function with given fields: res, req, params
+func (_m *SubscriptionManager) DeleteConsumerOffset(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*map[string]string, *util.RestError) {
+	ret := _m.Called(res, req, params)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteConsumerOffset")
+	}
+
+	var r0 *map[string]string
+	var r1 *util.RestError
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) (*map[string]string, *util.RestError)); ok {
+		return rf(res, req, params)
+	}
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) *map[string]string); ok {
+		r0 = rf(res, req, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*map[string]string)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(http.ResponseWriter, *http.Request, httprouter.Params) *util.RestError); ok {
+		r1 = rf(res, req, params)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*util.RestError)
+		}
+	}
+
+	return r0, r1
+}
+
+// DeleteDeadLetter provides a mock function with given fields: res, req, params
+func (_m *SubscriptionManager) DeleteDeadLetter(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*map[string]string, *util.RestError) {
+	ret := _m.Called(res, req, params)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteDeadLetter")
+	}
+
+	var r0 *map[string]string
+	var r1 *util.RestError
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) (*map[string]string, *util.RestError)); ok {
+		return rf(res, req, params)
+	}
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) *map[string]string); ok {
+		r0 = rf(res, req, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*map[string]string)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(http.ResponseWriter, *http.Request, httprouter.Params) *util.RestError); ok {
+		r1 = rf(res, req, params)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*util.RestError)
+		}
+	}
+
+	return r0, r1
+}
+
+// DeleteEventSchema provides a mock function with given fields: res, req, params
+func (_m *SubscriptionManager) DeleteEventSchema(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*map[string]string, *util.RestError) {
+	ret := _m.Called(res, req, params)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteEventSchema")
+	}
+
+	var r0 *map[string]string
+	var r1 *util.RestError
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) (*map[string]string, *util.RestError)); ok {
+		return rf(res, req, params)
+	}
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) *map[string]string); ok {
+		r0 = rf(res, req, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*map[string]string)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(http.ResponseWriter, *http.Request, httprouter.Params) *util.RestError); ok {
+		r1 = rf(res, req, params)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*util.RestError)
+		}
+	}
+
+	return r0, r1
+}
+
 // DeleteStream provides a mock function with given fields: res, req, params
 func (_m *SubscriptionManager) DeleteStream(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*map[string]string, *util.RestError) {
 	ret := _m.Called(res, req, params)
@@ -155,6 +411,154 @@ func (_m *SubscriptionManager) DeleteSubscription(res http.ResponseWriter, req *
 	return r0, r1
 }
 
+// DeleteSubscriptions provides a mock function with given fields: res, req, params
+func (_m *SubscriptionManager) DeleteSubscriptions(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*api.SubscriptionsDeleted, *util.RestError) {
+	ret := _m.Called(res, req, params)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteSubscriptions")
+	}
+
+	var r0 *api.SubscriptionsDeleted
+	var r1 *util.RestError
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) (*api.SubscriptionsDeleted, *util.RestError)); ok {
+		return rf(res, req, params)
+	}
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) *api.SubscriptionsDeleted); ok {
+		r0 = rf(res, req, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*api.SubscriptionsDeleted)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(http.ResponseWriter, *http.Request, httprouter.Params) *util.RestError); ok {
+		r1 = rf(res, req, params)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*util.RestError)
+		}
+	}
+
+	return r0, r1
+}
+
+// DeleteSubscriptionGroup provides a mock function with given fields: res, req, params
+func (_m *SubscriptionManager) DeleteSubscriptionGroup(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*map[string]string, *util.RestError) {
+	ret := _m.Called(res, req, params)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteSubscriptionGroup")
+	}
+
+	var r0 *map[string]string
+	var r1 *util.RestError
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) (*map[string]string, *util.RestError)); ok {
+		return rf(res, req, params)
+	}
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) *map[string]string); ok {
+		r0 = rf(res, req, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*map[string]string)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(http.ResponseWriter, *http.Request, httprouter.Params) *util.RestError); ok {
+		r1 = rf(res, req, params)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*util.RestError)
+		}
+	}
+
+	return r0, r1
+}
+
+// Deliveries provides a mock function with given fields: res, req, params
+func (_m *SubscriptionManager) Deliveries(res http.ResponseWriter, req *http.Request, params httprouter.Params) ([]*events.WebhookDelivery, *util.RestError) {
+	ret := _m.Called(res, req, params)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Deliveries")
+	}
+
+	var r0 []*events.WebhookDelivery
+	var r1 *util.RestError
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) ([]*events.WebhookDelivery, *util.RestError)); ok {
+		return rf(res, req, params)
+	}
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) []*events.WebhookDelivery); ok {
+		r0 = rf(res, req, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*events.WebhookDelivery)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(http.ResponseWriter, *http.Request, httprouter.Params) *util.RestError); ok {
+		r1 = rf(res, req, params)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*util.RestError)
+		}
+	}
+
+	return r0, r1
+}
+
+// EventSchemaByID provides a mock function with given fields: res, req, params
+func (_m *SubscriptionManager) EventSchemaByID(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*api.EventSchemaInfo, *util.RestError) {
+	ret := _m.Called(res, req, params)
+
+	if len(ret) == 0 {
+		panic("no return value specified for EventSchemaByID")
+	}
+
+	var r0 *api.EventSchemaInfo
+	var r1 *util.RestError
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) (*api.EventSchemaInfo, *util.RestError)); ok {
+		return rf(res, req, params)
+	}
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) *api.EventSchemaInfo); ok {
+		r0 = rf(res, req, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*api.EventSchemaInfo)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(http.ResponseWriter, *http.Request, httprouter.Params) *util.RestError); ok {
+		r1 = rf(res, req, params)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*util.RestError)
+		}
+	}
+
+	return r0, r1
+}
+
+// EventSchemas provides a mock function with given fields: res, req, params
+func (_m *SubscriptionManager) EventSchemas(res http.ResponseWriter, req *http.Request, params httprouter.Params) []*api.EventSchemaInfo {
+	ret := _m.Called(res, req, params)
+
+	if len(ret) == 0 {
+		panic("no return value specified for EventSchemas")
+	}
+
+	var r0 []*api.EventSchemaInfo
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) []*api.EventSchemaInfo); ok {
+		r0 = rf(res, req, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*api.EventSchemaInfo)
+		}
+	}
+
+	return r0
+}
+
 // Init provides a mock function with given fields: mocked
 func (_m *SubscriptionManager) Init(mocked ...kvstore.KVStore) error {
 	_va := make([]interface{}, len(mocked))
@@ -179,6 +583,38 @@ func (_m *SubscriptionManager) Init(mocked ...kvstore.KVStore) error {
 	return r0
 }
 
+// PingStream provides a mock function with given fields: res, req, params
+func (_m *SubscriptionManager) PingStream(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*events.PingResult, *util.RestError) {
+	ret := _m.Called(res, req, params)
+
+	if len(ret) == 0 {
+		panic("no return value specified for PingStream")
+	}
+
+	var r0 *events.PingResult
+	var r1 *util.RestError
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) (*events.PingResult, *util.RestError)); ok {
+		return rf(res, req, params)
+	}
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) *events.PingResult); ok {
+		r0 = rf(res, req, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*events.PingResult)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(http.ResponseWriter, *http.Request, httprouter.Params) *util.RestError); ok {
+		r1 = rf(res, req, params)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*util.RestError)
+		}
+	}
+
+	return r0, r1
+}
+
 // ResetSubscription provides a mock function with given fields: res, req, params
 func (_m *SubscriptionManager) ResetSubscription(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*map[string]string, *util.RestError) {
 	ret := _m.Called(res, req, params)
@@ -243,6 +679,38 @@ func (_m *SubscriptionManager) ResumeStream(res http.ResponseWriter, req *http.R
 	return r0, r1
 }
 
+// RotateStreamSecret provides a mock function with given fields: res, req, params
+func (_m *SubscriptionManager) RotateStreamSecret(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*events.SecretRotation, *util.RestError) {
+	ret := _m.Called(res, req, params)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RotateStreamSecret")
+	}
+
+	var r0 *events.SecretRotation
+	var r1 *util.RestError
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) (*events.SecretRotation, *util.RestError)); ok {
+		return rf(res, req, params)
+	}
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) *events.SecretRotation); ok {
+		r0 = rf(res, req, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*events.SecretRotation)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(http.ResponseWriter, *http.Request, httprouter.Params) *util.RestError); ok {
+		r1 = rf(res, req, params)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*util.RestError)
+		}
+	}
+
+	return r0, r1
+}
+
 // StreamByID provides a mock function with given fields: res, req, params
 func (_m *SubscriptionManager) StreamByID(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*events.StreamInfo, *util.RestError) {
 	ret := _m.Called(res, req, params)
@@ -327,6 +795,90 @@ func (_m *SubscriptionManager) SubscriptionByID(res http.ResponseWriter, req *ht
 	return r0, r1
 }
 
+// SubscriptionGroupByID provides a mock function with given fields: res, req, params
+func (_m *SubscriptionManager) SubscriptionGroupByID(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*api.SubscriptionGroupInfo, *util.RestError) {
+	ret := _m.Called(res, req, params)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SubscriptionGroupByID")
+	}
+
+	var r0 *api.SubscriptionGroupInfo
+	var r1 *util.RestError
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) (*api.SubscriptionGroupInfo, *util.RestError)); ok {
+		return rf(res, req, params)
+	}
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) *api.SubscriptionGroupInfo); ok {
+		r0 = rf(res, req, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*api.SubscriptionGroupInfo)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(http.ResponseWriter, *http.Request, httprouter.Params) *util.RestError); ok {
+		r1 = rf(res, req, params)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*util.RestError)
+		}
+	}
+
+	return r0, r1
+}
+
+// SubscriptionGroups provides a mock function with given fields: res, req, params
+func (_m *SubscriptionManager) SubscriptionGroups(res http.ResponseWriter, req *http.Request, params httprouter.Params) []*api.SubscriptionGroupInfo {
+	ret := _m.Called(res, req, params)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SubscriptionGroups")
+	}
+
+	var r0 []*api.SubscriptionGroupInfo
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) []*api.SubscriptionGroupInfo); ok {
+		r0 = rf(res, req, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*api.SubscriptionGroupInfo)
+		}
+	}
+
+	return r0
+}
+
+// SubscriptionStats provides a mock function with given fields: res, req, params
+func (_m *SubscriptionManager) SubscriptionStats(res http.ResponseWriter, req *http.Request, params httprouter.Params) (*api.SubscriptionStats, *util.RestError) {
+	ret := _m.Called(res, req, params)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SubscriptionStats")
+	}
+
+	var r0 *api.SubscriptionStats
+	var r1 *util.RestError
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) (*api.SubscriptionStats, *util.RestError)); ok {
+		return rf(res, req, params)
+	}
+	if rf, ok := ret.Get(0).(func(http.ResponseWriter, *http.Request, httprouter.Params) *api.SubscriptionStats); ok {
+		r0 = rf(res, req, params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*api.SubscriptionStats)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(http.ResponseWriter, *http.Request, httprouter.Params) *util.RestError); ok {
+		r1 = rf(res, req, params)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*util.RestError)
+		}
+	}
+
+	return r0, r1
+}
+
 // Subscriptions provides a mock function with given fields: res, req, params
 func (_m *SubscriptionManager) Subscriptions(res http.ResponseWriter, req *http.Request, params httprouter.Params) []*api.SubscriptionInfo {
 	ret := _m.Called(res, req, params)
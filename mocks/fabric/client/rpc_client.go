@@ -3,6 +3,8 @@
 package mockfabric
 
 import (
+	context "context"
+
 	api "github.com/hyperledger/firefly-fabconnect/internal/events/api"
 	client "github.com/hyperledger/firefly-fabconnect/internal/fabric/client"
 
@@ -36,9 +38,9 @@ func (_m *RPCClient) Close() error {
 	return r0
 }
 
-// Invoke provides a mock function with given fields: channelID, signer, chaincodeName, method, args, transientMap, isInit
-func (_m *RPCClient) Invoke(channelID string, signer string, chaincodeName string, method string, args []string, transientMap map[string]string, isInit bool) (*client.TxReceipt, error) {
-	ret := _m.Called(channelID, signer, chaincodeName, method, args, transientMap, isInit)
+// Invoke provides a mock function with given fields: ctx, channelID, signer, chaincodeName, method, args, transientMap, isInit
+func (_m *RPCClient) Invoke(ctx context.Context, channelID string, signer string, chaincodeName string, method string, args []string, transientMap map[string]string, isInit bool) (*client.TxReceipt, error) {
+	ret := _m.Called(ctx, channelID, signer, chaincodeName, method, args, transientMap, isInit)
 
 	if len(ret) == 0 {
 		panic("no return value specified for Invoke")
@@ -46,19 +48,19 @@ func (_m *RPCClient) Invoke(channelID string, signer string, chaincodeName strin
 
 	var r0 *client.TxReceipt
 	var r1 error
-	if rf, ok := ret.Get(0).(func(string, string, string, string, []string, map[string]string, bool) (*client.TxReceipt, error)); ok {
-		return rf(channelID, signer, chaincodeName, method, args, transientMap, isInit)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, string, []string, map[string]string, bool) (*client.TxReceipt, error)); ok {
+		return rf(ctx, channelID, signer, chaincodeName, method, args, transientMap, isInit)
 	}
-	if rf, ok := ret.Get(0).(func(string, string, string, string, []string, map[string]string, bool) *client.TxReceipt); ok {
-		r0 = rf(channelID, signer, chaincodeName, method, args, transientMap, isInit)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, string, []string, map[string]string, bool) *client.TxReceipt); ok {
+		r0 = rf(ctx, channelID, signer, chaincodeName, method, args, transientMap, isInit)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*client.TxReceipt)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(string, string, string, string, []string, map[string]string, bool) error); ok {
-		r1 = rf(channelID, signer, chaincodeName, method, args, transientMap, isInit)
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string, string, []string, map[string]string, bool) error); ok {
+		r1 = rf(ctx, channelID, signer, chaincodeName, method, args, transientMap, isInit)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -66,9 +68,9 @@ func (_m *RPCClient) Invoke(channelID string, signer string, chaincodeName strin
 	return r0, r1
 }
 
-// Query provides a mock function with given fields: channelID, signer, chaincodeName, method, args, strongread
-func (_m *RPCClient) Query(channelID string, signer string, chaincodeName string, method string, args []string, strongread bool) ([]byte, error) {
-	ret := _m.Called(channelID, signer, chaincodeName, method, args, strongread)
+// Query provides a mock function with given fields: ctx, channelID, signer, chaincodeName, method, args, strongread
+func (_m *RPCClient) Query(ctx context.Context, channelID string, signer string, chaincodeName string, method string, args []string, strongread bool) ([]byte, error) {
+	ret := _m.Called(ctx, channelID, signer, chaincodeName, method, args, strongread)
 
 	if len(ret) == 0 {
 		panic("no return value specified for Query")
@@ -76,19 +78,19 @@ func (_m *RPCClient) Query(channelID string, signer string, chaincodeName string
 
 	var r0 []byte
 	var r1 error
-	if rf, ok := ret.Get(0).(func(string, string, string, string, []string, bool) ([]byte, error)); ok {
-		return rf(channelID, signer, chaincodeName, method, args, strongread)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, string, []string, bool) ([]byte, error)); ok {
+		return rf(ctx, channelID, signer, chaincodeName, method, args, strongread)
 	}
-	if rf, ok := ret.Get(0).(func(string, string, string, string, []string, bool) []byte); ok {
-		r0 = rf(channelID, signer, chaincodeName, method, args, strongread)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, string, []string, bool) []byte); ok {
+		r0 = rf(ctx, channelID, signer, chaincodeName, method, args, strongread)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]byte)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(string, string, string, string, []string, bool) error); ok {
-		r1 = rf(channelID, signer, chaincodeName, method, args, strongread)
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string, string, []string, bool) error); ok {
+		r1 = rf(ctx, channelID, signer, chaincodeName, method, args, strongread)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -96,9 +98,9 @@ func (_m *RPCClient) Query(channelID string, signer string, chaincodeName string
 	return r0, r1
 }
 
-// QueryBlock provides a mock function with given fields: channelID, signer, blocknumber, blockhash
-func (_m *RPCClient) QueryBlock(channelID string, signer string, blocknumber uint64, blockhash []byte) (*utils.RawBlock, *utils.Block, error) {
-	ret := _m.Called(channelID, signer, blocknumber, blockhash)
+// QueryBlock provides a mock function with given fields: ctx, channelID, signer, blocknumber, blockhash
+func (_m *RPCClient) QueryBlock(ctx context.Context, channelID string, signer string, blocknumber uint64, blockhash []byte) (*utils.RawBlock, *utils.Block, error) {
+	ret := _m.Called(ctx, channelID, signer, blocknumber, blockhash)
 
 	if len(ret) == 0 {
 		panic("no return value specified for QueryBlock")
@@ -107,27 +109,27 @@ func (_m *RPCClient) QueryBlock(channelID string, signer string, blocknumber uin
 	var r0 *utils.RawBlock
 	var r1 *utils.Block
 	var r2 error
-	if rf, ok := ret.Get(0).(func(string, string, uint64, []byte) (*utils.RawBlock, *utils.Block, error)); ok {
-		return rf(channelID, signer, blocknumber, blockhash)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, uint64, []byte) (*utils.RawBlock, *utils.Block, error)); ok {
+		return rf(ctx, channelID, signer, blocknumber, blockhash)
 	}
-	if rf, ok := ret.Get(0).(func(string, string, uint64, []byte) *utils.RawBlock); ok {
-		r0 = rf(channelID, signer, blocknumber, blockhash)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, uint64, []byte) *utils.RawBlock); ok {
+		r0 = rf(ctx, channelID, signer, blocknumber, blockhash)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*utils.RawBlock)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(string, string, uint64, []byte) *utils.Block); ok {
-		r1 = rf(channelID, signer, blocknumber, blockhash)
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, uint64, []byte) *utils.Block); ok {
+		r1 = rf(ctx, channelID, signer, blocknumber, blockhash)
 	} else {
 		if ret.Get(1) != nil {
 			r1 = ret.Get(1).(*utils.Block)
 		}
 	}
 
-	if rf, ok := ret.Get(2).(func(string, string, uint64, []byte) error); ok {
-		r2 = rf(channelID, signer, blocknumber, blockhash)
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, uint64, []byte) error); ok {
+		r2 = rf(ctx, channelID, signer, blocknumber, blockhash)
 	} else {
 		r2 = ret.Error(2)
 	}
@@ -135,9 +137,9 @@ func (_m *RPCClient) QueryBlock(channelID string, signer string, blocknumber uin
 	return r0, r1, r2
 }
 
-// QueryBlockByTxID provides a mock function with given fields: channelID, signer, txID
-func (_m *RPCClient) QueryBlockByTxID(channelID string, signer string, txID string) (*utils.RawBlock, *utils.Block, error) {
-	ret := _m.Called(channelID, signer, txID)
+// QueryBlockByTxID provides a mock function with given fields: ctx, channelID, signer, txID
+func (_m *RPCClient) QueryBlockByTxID(ctx context.Context, channelID string, signer string, txID string) (*utils.RawBlock, *utils.Block, error) {
+	ret := _m.Called(ctx, channelID, signer, txID)
 
 	if len(ret) == 0 {
 		panic("no return value specified for QueryBlockByTxID")
@@ -146,27 +148,27 @@ func (_m *RPCClient) QueryBlockByTxID(channelID string, signer string, txID stri
 	var r0 *utils.RawBlock
 	var r1 *utils.Block
 	var r2 error
-	if rf, ok := ret.Get(0).(func(string, string, string) (*utils.RawBlock, *utils.Block, error)); ok {
-		return rf(channelID, signer, txID)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) (*utils.RawBlock, *utils.Block, error)); ok {
+		return rf(ctx, channelID, signer, txID)
 	}
-	if rf, ok := ret.Get(0).(func(string, string, string) *utils.RawBlock); ok {
-		r0 = rf(channelID, signer, txID)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) *utils.RawBlock); ok {
+		r0 = rf(ctx, channelID, signer, txID)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*utils.RawBlock)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(string, string, string) *utils.Block); ok {
-		r1 = rf(channelID, signer, txID)
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string) *utils.Block); ok {
+		r1 = rf(ctx, channelID, signer, txID)
 	} else {
 		if ret.Get(1) != nil {
 			r1 = ret.Get(1).(*utils.Block)
 		}
 	}
 
-	if rf, ok := ret.Get(2).(func(string, string, string) error); ok {
-		r2 = rf(channelID, signer, txID)
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, string) error); ok {
+		r2 = rf(ctx, channelID, signer, txID)
 	} else {
 		r2 = ret.Error(2)
 	}
@@ -174,9 +176,9 @@ func (_m *RPCClient) QueryBlockByTxID(channelID string, signer string, txID stri
 	return r0, r1, r2
 }
 
-// QueryChainInfo provides a mock function with given fields: channelID, signer
-func (_m *RPCClient) QueryChainInfo(channelID string, signer string) (*fab.BlockchainInfoResponse, error) {
-	ret := _m.Called(channelID, signer)
+// QueryChainInfo provides a mock function with given fields: ctx, channelID, signer
+func (_m *RPCClient) QueryChainInfo(ctx context.Context, channelID string, signer string) (*fab.BlockchainInfoResponse, error) {
+	ret := _m.Called(ctx, channelID, signer)
 
 	if len(ret) == 0 {
 		panic("no return value specified for QueryChainInfo")
@@ -184,19 +186,19 @@ func (_m *RPCClient) QueryChainInfo(channelID string, signer string) (*fab.Block
 
 	var r0 *fab.BlockchainInfoResponse
 	var r1 error
-	if rf, ok := ret.Get(0).(func(string, string) (*fab.BlockchainInfoResponse, error)); ok {
-		return rf(channelID, signer)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (*fab.BlockchainInfoResponse, error)); ok {
+		return rf(ctx, channelID, signer)
 	}
-	if rf, ok := ret.Get(0).(func(string, string) *fab.BlockchainInfoResponse); ok {
-		r0 = rf(channelID, signer)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) *fab.BlockchainInfoResponse); ok {
+		r0 = rf(ctx, channelID, signer)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*fab.BlockchainInfoResponse)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(string, string) error); ok {
-		r1 = rf(channelID, signer)
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, channelID, signer)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -204,9 +206,9 @@ func (_m *RPCClient) QueryChainInfo(channelID string, signer string) (*fab.Block
 	return r0, r1
 }
 
-// QueryTransaction provides a mock function with given fields: channelID, signer, txID
-func (_m *RPCClient) QueryTransaction(channelID string, signer string, txID string) (map[string]interface{}, error) {
-	ret := _m.Called(channelID, signer, txID)
+// QueryTransaction provides a mock function with given fields: ctx, channelID, signer, txID
+func (_m *RPCClient) QueryTransaction(ctx context.Context, channelID string, signer string, txID string) (map[string]interface{}, error) {
+	ret := _m.Called(ctx, channelID, signer, txID)
 
 	if len(ret) == 0 {
 		panic("no return value specified for QueryTransaction")
@@ -214,19 +216,19 @@ func (_m *RPCClient) QueryTransaction(channelID string, signer string, txID stri
 
 	var r0 map[string]interface{}
 	var r1 error
-	if rf, ok := ret.Get(0).(func(string, string, string) (map[string]interface{}, error)); ok {
-		return rf(channelID, signer, txID)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) (map[string]interface{}, error)); ok {
+		return rf(ctx, channelID, signer, txID)
 	}
-	if rf, ok := ret.Get(0).(func(string, string, string) map[string]interface{}); ok {
-		r0 = rf(channelID, signer, txID)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) map[string]interface{}); ok {
+		r0 = rf(ctx, channelID, signer, txID)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(map[string]interface{})
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(string, string, string) error); ok {
-		r1 = rf(channelID, signer, txID)
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string) error); ok {
+		r1 = rf(ctx, channelID, signer, txID)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -234,9 +236,9 @@ func (_m *RPCClient) QueryTransaction(channelID string, signer string, txID stri
 	return r0, r1
 }
 
-// SubscribeEvent provides a mock function with given fields: subInfo, since
-func (_m *RPCClient) SubscribeEvent(subInfo *api.SubscriptionInfo, since uint64) (*client.RegistrationWrapper, <-chan *fab.BlockEvent, <-chan *fab.CCEvent, error) {
-	ret := _m.Called(subInfo, since)
+// SubscribeEvent provides a mock function with given fields: ctx, subInfo, since
+func (_m *RPCClient) SubscribeEvent(ctx context.Context, subInfo *api.SubscriptionInfo, since uint64) (*client.RegistrationWrapper, <-chan *fab.BlockEvent, <-chan *fab.CCEvent, error) {
+	ret := _m.Called(ctx, subInfo, since)
 
 	if len(ret) == 0 {
 		panic("no return value specified for SubscribeEvent")
@@ -246,35 +248,35 @@ func (_m *RPCClient) SubscribeEvent(subInfo *api.SubscriptionInfo, since uint64)
 	var r1 <-chan *fab.BlockEvent
 	var r2 <-chan *fab.CCEvent
 	var r3 error
-	if rf, ok := ret.Get(0).(func(*api.SubscriptionInfo, uint64) (*client.RegistrationWrapper, <-chan *fab.BlockEvent, <-chan *fab.CCEvent, error)); ok {
-		return rf(subInfo, since)
+	if rf, ok := ret.Get(0).(func(context.Context, *api.SubscriptionInfo, uint64) (*client.RegistrationWrapper, <-chan *fab.BlockEvent, <-chan *fab.CCEvent, error)); ok {
+		return rf(ctx, subInfo, since)
 	}
-	if rf, ok := ret.Get(0).(func(*api.SubscriptionInfo, uint64) *client.RegistrationWrapper); ok {
-		r0 = rf(subInfo, since)
+	if rf, ok := ret.Get(0).(func(context.Context, *api.SubscriptionInfo, uint64) *client.RegistrationWrapper); ok {
+		r0 = rf(ctx, subInfo, since)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*client.RegistrationWrapper)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(*api.SubscriptionInfo, uint64) <-chan *fab.BlockEvent); ok {
-		r1 = rf(subInfo, since)
+	if rf, ok := ret.Get(1).(func(context.Context, *api.SubscriptionInfo, uint64) <-chan *fab.BlockEvent); ok {
+		r1 = rf(ctx, subInfo, since)
 	} else {
 		if ret.Get(1) != nil {
 			r1 = ret.Get(1).(<-chan *fab.BlockEvent)
 		}
 	}
 
-	if rf, ok := ret.Get(2).(func(*api.SubscriptionInfo, uint64) <-chan *fab.CCEvent); ok {
-		r2 = rf(subInfo, since)
+	if rf, ok := ret.Get(2).(func(context.Context, *api.SubscriptionInfo, uint64) <-chan *fab.CCEvent); ok {
+		r2 = rf(ctx, subInfo, since)
 	} else {
 		if ret.Get(2) != nil {
 			r2 = ret.Get(2).(<-chan *fab.CCEvent)
 		}
 	}
 
-	if rf, ok := ret.Get(3).(func(*api.SubscriptionInfo, uint64) error); ok {
-		r3 = rf(subInfo, since)
+	if rf, ok := ret.Get(3).(func(context.Context, *api.SubscriptionInfo, uint64) error); ok {
+		r3 = rf(ctx, subInfo, since)
 	} else {
 		r3 = ret.Error(3)
 	}
@@ -48,6 +48,24 @@ func (_m *KVStore) Delete(key string) error {
 	return r0
 }
 
+// DeleteBatch provides a mock function with given fields: keys
+func (_m *KVStore) DeleteBatch(keys []string) error {
+	ret := _m.Called(keys)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteBatch")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func([]string) error); ok {
+		r0 = rf(keys)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Get provides a mock function with given fields: key
 func (_m *KVStore) Get(key string) ([]byte, error) {
 	ret := _m.Called(key)
@@ -154,6 +172,24 @@ func (_m *KVStore) Put(key string, val []byte) error {
 	return r0
 }
 
+// PutBatch provides a mock function with given fields: puts
+func (_m *KVStore) PutBatch(puts []kvstore.KVPut) error {
+	ret := _m.Called(puts)
+
+	if len(ret) == 0 {
+		panic("no return value specified for PutBatch")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func([]kvstore.KVPut) error); ok {
+		r0 = rf(puts)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // NewKVStore creates a new instance of KVStore. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewKVStore(t interface {
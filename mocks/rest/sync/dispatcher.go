@@ -31,11 +31,21 @@ func (_m *Dispatcher) GetBlockByTxID(res http.ResponseWriter, req *http.Request,
 	_m.Called(res, req, params)
 }
 
+// GetBlockHeight provides a mock function with given fields: res, req, params
+func (_m *Dispatcher) GetBlockHeight(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	_m.Called(res, req, params)
+}
+
 // GetChainInfo provides a mock function with given fields: res, req, params
 func (_m *Dispatcher) GetChainInfo(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	_m.Called(res, req, params)
 }
 
+// GetPrivateData provides a mock function with given fields: res, req, params
+func (_m *Dispatcher) GetPrivateData(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	_m.Called(res, req, params)
+}
+
 // GetTxByID provides a mock function with given fields: res, req, params
 func (_m *Dispatcher) GetTxByID(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 	_m.Called(res, req, params)
@@ -46,6 +56,16 @@ func (_m *Dispatcher) QueryChaincode(res http.ResponseWriter, req *http.Request,
 	_m.Called(res, req, params)
 }
 
+// SetAnchorPeers provides a mock function with given fields: res, req, params
+func (_m *Dispatcher) SetAnchorPeers(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	_m.Called(res, req, params)
+}
+
+// SetMSPCACerts provides a mock function with given fields: res, req, params
+func (_m *Dispatcher) SetMSPCACerts(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	_m.Called(res, req, params)
+}
+
 // NewDispatcher creates a new instance of Dispatcher. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewDispatcher(t interface {
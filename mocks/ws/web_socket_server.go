@@ -7,6 +7,8 @@ import (
 
 	httprouter "github.com/julienschmidt/httprouter"
 	mock "github.com/stretchr/testify/mock"
+
+	ws "github.com/hyperledger/firefly-fabconnect/internal/ws"
 )
 
 // WebSocketServer is an autogenerated mock type for the WebSocketServer type
@@ -79,6 +81,11 @@ func (_m *WebSocketServer) SendReply(message interface{}) {
 	_m.Called(message)
 }
 
+// SetAuthenticator provides a mock function with given fields: authenticator
+func (_m *WebSocketServer) SetAuthenticator(authenticator ws.Authenticator) {
+	_m.Called(authenticator)
+}
+
 // NewWebSocketServer creates a new instance of WebSocketServer. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewWebSocketServer(t interface {
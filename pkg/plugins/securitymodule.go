@@ -16,6 +16,8 @@
 
 package plugins
 
+import "time"
+
 // EventOperation enumerates operation types on events
 type EventOperation int
 
@@ -39,3 +41,40 @@ type SecurityModule interface {
 	// AuthReadAsyncReplyByUUID - Authorization plugpoint for getting an individual reply by UUID (containing an individual receipt/error)
 	AuthReadAsyncReplyByUUID(authCtx interface{}) error
 }
+
+// ServiceIdentityResolver is an optional extension a SecurityModule can implement.
+//
+//	When implemented, background operations configured to run as a named service identity
+//	(such as the event poller of an event stream) are authorized against the context object
+//	returned here, rather than running with the unrestricted system context. Callers can
+//	only assign the service identities AuthServiceIdentity authorizes them for.
+type ServiceIdentityResolver interface {
+
+	// ResolveServiceIdentity - Returns a context object for a service identity, that will be returned to authorization points
+	ResolveServiceIdentity(identity string) (interface{}, error)
+	// AuthServiceIdentity - Authorization plugpoint for a caller assigning a service identity to a background operation, such as an event stream
+	AuthServiceIdentity(authCtx interface{}, identity string) error
+}
+
+// AdminAuthorizer is an optional extension a SecurityModule can implement.
+//
+//	When implemented, the admin operations that change the state of the gateway, such as stopping
+//	a subsystem or issuing a consumer token, are served on the application listener when there is
+//	no separate admin listener, and each call is authorized here. Without it those operations are
+//	only served on an admin listener.
+type AdminAuthorizer interface {
+
+	// AuthAdmin - Authorization plugpoint for an admin operation, named by its method and route, such as "POST /subsystems/:name/stop"
+	AuthAdmin(authCtx interface{}, operation string) error
+}
+
+// TokenExpiryProvider is an optional extension a SecurityModule can implement.
+//
+//	When implemented, long-lived connections authenticated with a token, such as websockets,
+//	are closed when the token expires, unless the client re-authenticates with a new token
+//	before then.
+type TokenExpiryProvider interface {
+
+	// TokenExpiry - Returns when the token a context object was verified from expires, or the zero time if it does not expire
+	TokenExpiry(authCtx interface{}) time.Time
+}